@@ -0,0 +1,198 @@
+package bridge
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// Access log: every API request gets an ID, taken from X-Request-ID when
+// the client sent a sane one and generated otherwise, returned in the
+// X-Request-ID response header and logged with the method, path, status and
+// duration, so a failed call can be found from the client's own logs.
+// Handlers add details to the line (the message ID and error of a failed
+// send, say) with annotateRequest.
+//
+//	ACCESS_LOG        - log requests (default true)
+//	ACCESS_LOG_FORMAT - text or json (default text)
+//	ACCESS_LOG_SKIP   - comma-separated paths not logged (default /health)
+
+type requestIDKey struct{}
+type accessAttrsKey struct{}
+
+// requestIDFromContext returns the ID of the request ctx belongs to.
+func requestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// withRequestID restores the request ID of work done on behalf of a
+// request after it returned, like a re-send.
+func withRequestID(ctx context.Context, id string) context.Context {
+	if id == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// requestNote tags send log lines with the request ID, so they can be
+// matched with the access log line; empty outside API requests.
+func requestNote(ctx context.Context) string {
+	if id := requestIDFromContext(ctx); id != "" {
+		return " [request " + id + "]"
+	}
+	return ""
+}
+
+// accessAttrs collects the attributes handlers add to a request's line.
+type accessAttrs struct {
+	mu    sync.Mutex
+	attrs []any
+}
+
+// annotateRequest adds key/value pairs to the access log line of the
+// request ctx belongs to.
+func annotateRequest(ctx context.Context, args ...any) {
+	if a, ok := ctx.Value(accessAttrsKey{}).(*accessAttrs); ok {
+		a.mu.Lock()
+		a.attrs = append(a.attrs, args...)
+		a.mu.Unlock()
+	}
+}
+
+// validRequestID accepts client IDs of up to 128 printable ASCII
+// characters, so they cannot break the log format.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, c := range id {
+		if c < '!' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// accessLogger returns the access logger, or nil when ACCESS_LOG is off.
+func accessLogger() *slog.Logger {
+	if !envBool("ACCESS_LOG", true) {
+		return nil
+	}
+	if envString("ACCESS_LOG_FORMAT", "text") == "json" {
+		return slog.New(slog.NewJSONHandler(os.Stderr, nil))
+	}
+	return slog.New(slog.NewTextHandler(os.Stderr, nil))
+}
+
+// statusRecorder captures the status and size of a response. It passes
+// flushing and hijacking through for /events and /ws.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(p []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(p)
+	r.bytes += n
+	return n, err
+}
+
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response does not support hijacking")
+	}
+	if r.status == 0 {
+		r.status = http.StatusSwitchingProtocols
+	}
+	return h.Hijack()
+}
+
+func (r *statusRecorder) Unwrap() http.ResponseWriter { return r.ResponseWriter }
+
+// accessLogMiddleware assigns the request ID and logs the request once it
+// is done. It is the outermost middleware, so rejected requests are logged
+// too.
+func accessLogMiddleware(next http.Handler) http.Handler {
+	logger := accessLogger()
+	skip := envList("ACCESS_LOG_SKIP")
+	if len(skip) == 0 && os.Getenv("ACCESS_LOG_SKIP") == "" {
+		skip = []string{"/health"}
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set("X-Request-ID", id)
+		attrs := &accessAttrs{}
+		ctx := context.WithValue(r.Context(), requestIDKey{}, id)
+		ctx = context.WithValue(ctx, accessAttrsKey{}, attrs)
+		r = r.WithContext(ctx)
+
+		if logger == nil || containsString(skip, r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		rec := &statusRecorder{ResponseWriter: w}
+		start := time.Now()
+		next.ServeHTTP(rec, r)
+
+		status := rec.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		level := slog.LevelInfo
+		switch {
+		case status >= 500:
+			level = slog.LevelError
+		case status >= 400:
+			level = slog.LevelWarn
+		}
+		args := []any{
+			"request_id", id,
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", status,
+			"duration_ms", float64(time.Since(start).Microseconds()) / 1000,
+			"bytes", rec.bytes,
+			"remote", r.RemoteAddr,
+		}
+		attrs.mu.Lock()
+		args = append(args, attrs.attrs...)
+		attrs.mu.Unlock()
+		logger.Log(r.Context(), level, "http request", args...)
+	})
+}
@@ -0,0 +1,43 @@
+package bridge_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/phenobarbital/ai-parrot/whatsapp-bridge/bridge"
+	"github.com/phenobarbital/ai-parrot/whatsapp-bridge/bridgetest"
+)
+
+func TestSendCarriesRequestID(t *testing.T) {
+	h := bridgetest.New(t, bridgetest.WithEnv("PUBLISH_EVENTS", "messages,receipts"))
+	body, _ := json.Marshal(bridge.OutgoingMessage{Phone: "5215512345678", Message: "hola"})
+	req, _ := http.NewRequest(http.MethodPost, h.Server.URL+"/send", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Request-ID", "req-42")
+	resp, err := h.Server.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("X-Request-ID") != "req-42" {
+		t.Fatalf("send = %d with X-Request-ID %q", resp.StatusCode, resp.Header.Get("X-Request-ID"))
+	}
+
+	var status bridge.MessageStatus
+	h.DecodePayload(h.ExpectEvent(bridge.EventMessageStatus), &status)
+	if status.RequestID != "req-42" {
+		t.Fatalf("sent status request_id = %q", status.RequestID)
+	}
+
+	code, archived := h.Do(http.MethodGet, "/archive/messages?direction=out", nil)
+	if code != http.StatusOK {
+		t.Fatalf("GET /archive/messages: %d %s", code, archived.Error)
+	}
+	var messages []bridge.ArchivedMessage
+	decodeData(t, archived.Data, &messages)
+	if len(messages) != 1 || messages[0].RequestID != "req-42" {
+		t.Fatalf("archived = %+v", messages)
+	}
+}
@@ -0,0 +1,43 @@
+package bridge
+
+import (
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func TestAMQPDeliveriesWithoutDeliveryCount(t *testing.T) {
+	mr := miniredis.RunT(t)
+	redisClient := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer redisClient.Close()
+	b := New(redisClient, nil)
+	cfg := &AMQPOutboundConfig{Queue: "outbound", MaxDeliveries: 5}
+
+	// A classic queue only flags redeliveries.
+	first := amqp.Delivery{MessageId: "m1", Body: []byte(`{}`)}
+	redelivered := first
+	redelivered.Redelivered = true
+	for i, d := range []amqp.Delivery{first, redelivered, redelivered} {
+		if got := b.amqpDeliveries(cfg, d, d.MessageId); got != i+1 {
+			t.Fatalf("delivery %d counted as %d", i+1, got)
+		}
+	}
+	// Delivered afresh, e.g. republished: the count starts over.
+	if got := b.amqpDeliveries(cfg, first, first.MessageId); got != 1 {
+		t.Fatalf("fresh delivery counted as %d", got)
+	}
+
+	// Messages without an ID are counted by body.
+	other := amqp.Delivery{Body: []byte(`{"phone":"1"}`), Redelivered: true}
+	if got := b.amqpDeliveries(cfg, other, ""); got != 1 {
+		t.Fatalf("first failure of a message without ID counted as %d", got)
+	}
+
+	// Quorum queues count deliveries themselves.
+	quorum := amqp.Delivery{MessageId: "m2", Redelivered: true, Headers: amqp.Table{"x-delivery-count": int64(3)}}
+	if got := b.amqpDeliveries(cfg, quorum, quorum.MessageId); got != 4 {
+		t.Fatalf("quorum delivery counted as %d, want 4", got)
+	}
+}
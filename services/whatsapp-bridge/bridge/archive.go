@@ -0,0 +1,374 @@
+package bridge
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Message directions stored in the archive.
+const (
+	DirectionInbound  = "in"
+	DirectionOutbound = "out"
+)
+
+// Archive persists every inbound and outbound message in a bridge-owned
+// SQLite database, separate from whatsmeow's session store. A nil Archive
+// is a valid no-op.
+type Archive struct {
+	db *sql.DB
+}
+
+// ArchivedMessage is one archived message row.
+type ArchivedMessage struct {
+	ID          int64  `json:"id"`
+	MessageID   string `json:"message_id"`
+	Direction   string `json:"direction"`
+	Chat        string `json:"chat"`
+	Sender      string `json:"sender"`
+	Type        string `json:"type"`
+	Content     string `json:"content"`
+	ContentHash string `json:"content_hash"`
+	Operator    string `json:"operator,omitempty"`   // who triggered an outbound message
+	ContactID   string `json:"contact_id,omitempty"` // stable internal ID of the remote party
+	Timestamp   int64  `json:"timestamp"`
+	ReadAt      int64  `json:"read_at,omitempty"`    // outbound messages read by the recipient
+	Template    string `json:"template,omitempty"`   // outbound messages rendered from a template
+	Variant     string `json:"variant,omitempty"`    // and the template's A/B variant
+	RequestID   string `json:"request_id,omitempty"` // API request that sent an outbound message
+}
+
+// ArchiveFilter narrows archive queries; zero values are ignored.
+type ArchiveFilter struct {
+	Chat      string
+	Direction string
+	Operator  string
+	Since     int64
+	Until     int64
+	Limit     int
+}
+
+// messageColumns is the column list matching scanMessage.
+const messageColumns = `id, message_id, direction, chat, sender, type, content, content_hash, operator, contact_id, timestamp, read_at, template, variant, request_id`
+
+// rowScanner is satisfied by *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanMessage(row rowScanner) (ArchivedMessage, error) {
+	var m ArchivedMessage
+	err := row.Scan(&m.ID, &m.MessageID, &m.Direction, &m.Chat, &m.Sender, &m.Type,
+		&m.Content, &m.ContentHash, &m.Operator, &m.ContactID, &m.Timestamp, &m.ReadAt,
+		&m.Template, &m.Variant, &m.RequestID)
+	return m, err
+}
+
+// OpenArchiveFromEnv opens ARCHIVE_DB unless ARCHIVE_ENABLED=false. With
+// ARCHIVE_AUTO_MIGRATE=false pending migrations are not applied and the
+// archive refuses to open until they are, with "whatsapp-bridge migrate".
+func OpenArchiveFromEnv() (*Archive, error) {
+	if !envBool("ARCHIVE_ENABLED", true) {
+		return nil, nil
+	}
+	return openArchive(archiveDSN(), envBool("ARCHIVE_AUTO_MIGRATE", true))
+}
+
+func archiveDSN() string {
+	return envString("ARCHIVE_DB", "file:data/bridge.db?_foreign_keys=on&_busy_timeout=5000")
+}
+
+// OpenArchive opens (and creates if needed) the archive database, applying
+// pending migrations.
+func OpenArchive(dsn string) (*Archive, error) {
+	return openArchive(dsn, true)
+}
+
+func openArchive(dsn string, autoMigrate bool) (*Archive, error) {
+	db, err := openArchiveDB(dsn)
+	if err != nil {
+		return nil, err
+	}
+	if autoMigrate {
+		_, err = migrate(db, 0)
+	} else {
+		err = checkMigrated(db)
+	}
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize archive schema: %v", err)
+	}
+	return &Archive{db: db}, nil
+}
+
+func openArchiveDB(dsn string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open archive: %v", err)
+	}
+	// SQLite allows a single writer; serializing avoids "database is locked".
+	db.SetMaxOpenConns(1)
+	return db, nil
+}
+
+// checkMigrated fails when migrations are pending.
+func checkMigrated(db *sql.DB) error {
+	pending, err := pendingMigrations(db)
+	if err != nil || len(pending) == 0 {
+		return err
+	}
+	names := make([]string, len(pending))
+	for i, m := range pending {
+		names[i] = fmt.Sprintf("%04d_%s", m.Version, m.Name)
+	}
+	return fmt.Errorf("%d pending migration(s) (%s); run \"whatsapp-bridge migrate\" or set ARCHIVE_AUTO_MIGRATE=true",
+		len(pending), strings.Join(names, ", "))
+}
+
+// Store appends a message to the archive and updates the dashboard
+// projections.
+func (a *Archive) Store(m ArchivedMessage) error {
+	if a == nil {
+		return nil
+	}
+	tx, err := a.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	_, err = tx.Exec(`INSERT INTO messages
+		(message_id, direction, chat, sender, type, content, content_hash, operator, contact_id, timestamp, template, variant, request_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		m.MessageID, m.Direction, m.Chat, m.Sender, m.Type, m.Content, m.ContentHash, m.Operator, m.ContactID, m.Timestamp,
+		m.Template, m.Variant, m.RequestID)
+	if err != nil {
+		return err
+	}
+	if err := project(tx, m); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// where renders f's conditions as a SQL WHERE clause (or "") and its args.
+func (f ArchiveFilter) where() (string, []interface{}) {
+	var where []string
+	var args []interface{}
+	if f.Chat != "" {
+		where = append(where, "chat = ?")
+		args = append(args, f.Chat)
+	}
+	if f.Direction != "" {
+		where = append(where, "direction = ?")
+		args = append(args, f.Direction)
+	}
+	if f.Operator != "" {
+		where = append(where, "operator = ?")
+		args = append(args, f.Operator)
+	}
+	if f.Since > 0 {
+		where = append(where, "timestamp >= ?")
+		args = append(args, f.Since)
+	}
+	if f.Until > 0 {
+		where = append(where, "timestamp < ?")
+		args = append(args, f.Until)
+	}
+	if len(where) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(where, " AND "), args
+}
+
+// Query returns archived messages matching f, oldest first.
+func (a *Archive) Query(f ArchiveFilter) ([]ArchivedMessage, error) {
+	if a == nil {
+		return nil, fmt.Errorf("archive is disabled")
+	}
+
+	where, args := f.where()
+	query := `SELECT ` + messageColumns + ` FROM messages` + where + " ORDER BY timestamp, id"
+	if f.Limit > 0 {
+		query += " LIMIT " + strconv.Itoa(f.Limit)
+	}
+
+	rows, err := a.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []ArchivedMessage
+	for rows.Next() {
+		m, err := scanMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, m)
+	}
+	return out, rows.Err()
+}
+
+// Chats lists the distinct chats with messages matching f (Limit ignored).
+func (a *Archive) Chats(f ArchiveFilter) ([]string, error) {
+	if a == nil {
+		return nil, fmt.Errorf("archive is disabled")
+	}
+	where, args := f.where()
+	rows, err := a.db.Query(`SELECT DISTINCT chat FROM messages`+where+` ORDER BY chat`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []string
+	for rows.Next() {
+		var chat string
+		if err := rows.Scan(&chat); err != nil {
+			return nil, err
+		}
+		out = append(out, chat)
+	}
+	return out, rows.Err()
+}
+
+// FindMessage returns the most recent archived row for a WhatsApp message ID.
+func (a *Archive) FindMessage(messageID string) (*ArchivedMessage, error) {
+	if a == nil {
+		return nil, fmt.Errorf("archive is disabled")
+	}
+	m, err := scanMessage(a.db.QueryRow(`SELECT `+messageColumns+`
+		FROM messages WHERE message_id = ? ORDER BY id DESC LIMIT 1`, messageID))
+	if err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// archive stores m, logging rather than failing the caller on errors, and
+// counts it in its chat's conversation session.
+func (b *WhatsAppBridge) archive(m ArchivedMessage) {
+	if err := b.archiveDB.Store(m); err != nil {
+		log.Printf("Error archiving message %s: %v", m.MessageID, err)
+	}
+	b.idle.Touch(b.ctx, m)
+}
+
+// archiveOutgoing records a sent message attributed to the operator found in
+// ctx. Every successful send passes through here, so it also feeds the
+// account health score and starts the message's status tracking.
+func (b *WhatsAppBridge) archiveOutgoing(ctx context.Context, chat, messageID, msgType, content string, ts time.Time) {
+	b.health.Record(SignalSendSuccess)
+	b.trackSent(ctx, chat, messageID, ts)
+	b.recordUsage(ctx, operatorFromContext(ctx), UsageMessagesSent, 1)
+	rendered := templateFromContext(ctx)
+	b.archive(ArchivedMessage{
+		MessageID:   messageID,
+		Direction:   DirectionOutbound,
+		Chat:        chat,
+		Sender:      b.ownJID(),
+		Type:        msgType,
+		Content:     content,
+		ContentHash: contentHash(msgType, content, nil),
+		Operator:    operatorFromContext(ctx),
+		ContactID:   b.contactForChat(chat),
+		Timestamp:   ts.Unix(),
+		Template:    rendered.Template,
+		Variant:     rendered.Variant,
+		RequestID:   requestIDFromContext(ctx),
+	})
+}
+
+// ownJID returns the logged-in account's JID, or "" before pairing.
+func (b *WhatsAppBridge) ownJID() string {
+	if b.client == nil || b.client.Device().ID == nil {
+		return ""
+	}
+	return b.client.Device().ID.ToNonAD().String()
+}
+
+// parseArchiveFilter reads chat, direction, operator, since, until (Unix
+// seconds or RFC3339) and limit from the query string.
+func parseArchiveFilter(r *http.Request) (ArchiveFilter, error) {
+	q := r.URL.Query()
+	f := ArchiveFilter{
+		Chat:      q.Get("chat"),
+		Direction: q.Get("direction"),
+		Operator:  q.Get("operator"),
+	}
+	var err error
+	if f.Since, err = parseTimeParam(q.Get("since")); err != nil {
+		return f, fmt.Errorf("invalid since: %v", err)
+	}
+	if f.Until, err = parseTimeParam(q.Get("until")); err != nil {
+		return f, fmt.Errorf("invalid until: %v", err)
+	}
+	if limit := q.Get("limit"); limit != "" {
+		if f.Limit, err = strconv.Atoi(limit); err != nil {
+			return f, fmt.Errorf("invalid limit: %v", err)
+		}
+	}
+	return f, nil
+}
+
+func parseTimeParam(v string) (int64, error) {
+	if v == "" {
+		return 0, nil
+	}
+	if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return n, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return 0, err
+	}
+	return t.Unix(), nil
+}
+
+// handleArchiveMessages serves GET /archive/messages.
+func (b *WhatsAppBridge) handleArchiveMessages(w http.ResponseWriter, r *http.Request) {
+	f, err := parseArchiveFilter(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, Response{Success: false, Error: err.Error()})
+		return
+	}
+	if f.Limit == 0 {
+		f.Limit = 100
+	}
+
+	messages, err := b.archiveDB.Query(f)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, Response{Success: true, Data: messages})
+}
+
+// handleArchiveExport serves GET /archive/export as newline-delimited JSON,
+// including operator attribution for outbound messages.
+func (b *WhatsAppBridge) handleArchiveExport(w http.ResponseWriter, r *http.Request) {
+	f, err := parseArchiveFilter(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, Response{Success: false, Error: err.Error()})
+		return
+	}
+
+	messages, err := b.archiveDB.Query(f)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", `attachment; filename="archive.jsonl"`)
+	enc := json.NewEncoder(w)
+	for _, m := range messages {
+		enc.Encode(m)
+	}
+}
@@ -0,0 +1,62 @@
+package bridge
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// EventAudio is published once an inbound audio or voice note is stored,
+// so a speech-to-text pipeline can transcribe it and reply without
+// handling WhatsApp media itself. Redis sinks publish it on whatsapp:audio.
+// With AUDIO_EVENTS (default false) audio is downloaded as it arrives, even
+// without MEDIA_DOWNLOAD, unless a download rule says otherwise.
+const EventAudio = "audio"
+
+// AudioEvent is the payload of audio events. The file is read from Path
+// with the local store, else from URL or GET /media/{message_id}.
+type AudioEvent struct {
+	MessageID    string `json:"message_id"`
+	Chat         string `json:"chat"`
+	From         string `json:"from"` // sender JID
+	FromName     string `json:"from_name,omitempty"`
+	ContactID    string `json:"contact_id,omitempty"`
+	PTT          bool   `json:"ptt"`      // recorded as a voice note
+	Duration     uint32 `json:"duration"` // seconds, as reported by the sender
+	MimeType     string `json:"mime_type"`
+	Size         int64  `json:"size"`
+	SHA256       string `json:"sha256"`
+	Key          string `json:"key"`
+	Path         string `json:"path,omitempty"`
+	URL          string `json:"url,omitempty"`
+	Timestamp    int64  `json:"timestamp"`
+	TimestampISO string `json:"timestamp_iso"`
+}
+
+// publishAudio announces a downloaded audio file.
+func (d *MediaDownloader) publishAudio(ctx context.Context, job mediaJob, blob *StoredMedia) {
+	if !d.AudioEvents || job.Type != "audio" {
+		return
+	}
+	evt := AudioEvent{
+		MessageID: job.MessageID,
+		Chat:      job.Chat,
+		From:      job.Sender,
+		FromName:  job.SenderName,
+		ContactID: job.ContactID,
+		PTT:       job.PTT,
+		Duration:  job.Seconds,
+		MimeType:  job.MimeType,
+		Size:      blob.Size,
+		SHA256:    blob.SHA256,
+		Key:       blob.Key,
+		Path:      blob.Path,
+		URL:       d.library.URL(ctx, blob),
+		Timestamp: job.Timestamp,
+	}
+	if job.Timestamp > 0 {
+		evt.TimestampISO = d.bridge.formatTime(time.Unix(job.Timestamp, 0))
+	}
+	log.Printf("🎙️ Audio from %s ready for transcription (%ds)", job.Sender, job.Seconds)
+	d.bridge.publish(EventAudio, job.Chat, evt)
+}
@@ -0,0 +1,59 @@
+package bridge_test
+
+import (
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/phenobarbital/ai-parrot/whatsapp-bridge/bridge"
+	"github.com/phenobarbital/ai-parrot/whatsapp-bridge/bridgetest"
+)
+
+// receiveVoiceNote simulates an inbound voice note served by url.
+func receiveVoiceNote(h *bridgetest.Harness, id, phone, url string, media encryptedMedia) {
+	jid := types.NewJID(phone, types.DefaultUserServer)
+	h.Emit(&events.Message{
+		Info: types.MessageInfo{
+			MessageSource: types.MessageSource{Chat: jid, Sender: jid},
+			ID:            id,
+			Timestamp:     time.Now(),
+		},
+		Message: &waE2E.Message{AudioMessage: &waE2E.AudioMessage{
+			URL:           proto.String(url),
+			DirectPath:    proto.String("/v/t62/voice"),
+			MediaKey:      media.MediaKey,
+			FileEncSHA256: media.FileEncSHA256,
+			FileSHA256:    media.FileSHA256,
+			FileLength:    proto.Uint64(uint64(len(media.Plaintext))),
+			Mimetype:      proto.String("audio/ogg; codecs=opus"),
+			Seconds:       proto.Uint32(3),
+			PTT:           proto.Bool(true),
+		}},
+	})
+}
+
+func TestAudioEventsPublishVoiceNotes(t *testing.T) {
+	media := encryptMedia(t, []byte("OggS voice note"), whatsmeow.MediaAudio)
+	srv := serveMedia(t, media.File)
+	h := bridgetest.New(t, bridgetest.WithEnv("AUDIO_EVENTS", "true"))
+	receiveVoiceNote(h, "AUDIO1", "5215512345678", srv.URL, media)
+
+	var audio bridge.AudioEvent
+	h.DecodePayload(h.ExpectEvent(bridge.EventAudio), &audio)
+	if audio.MessageID != "AUDIO1" || !audio.PTT || audio.Duration != 3 || audio.Size != int64(len(media.Plaintext)) {
+		t.Fatalf("audio event = %+v", audio)
+	}
+}
+
+func TestAudioEventsOffByDefault(t *testing.T) {
+	media := encryptMedia(t, []byte("OggS voice note"), whatsmeow.MediaAudio)
+	srv := serveMedia(t, media.File)
+	h := bridgetest.New(t)
+	receiveVoiceNote(h, "AUDIO2", "5215512345678", srv.URL, media)
+	h.ExpectNoEvent(bridge.EventAudio, 300*time.Millisecond)
+}
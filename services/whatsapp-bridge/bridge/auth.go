@@ -0,0 +1,201 @@
+package bridge
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// anonymousOperator attributes requests when authentication is disabled.
+const anonymousOperator = "anonymous"
+
+type operatorKey struct{}
+
+// Authenticator validates API keys (BRIDGE_API_KEYS="key:operator,...") and
+// HS256 JWTs (BRIDGE_JWT_SECRET), resolving each request to an operator name
+// used for audit attribution. With neither configured every request passes as
+// "anonymous". Operators in BRIDGE_ADMIN_OPERATORS may see other operators'
+// data, like their usage.
+type Authenticator struct {
+	apiKeys   map[string]string // key -> operator
+	jwtSecret []byte
+	admins    map[string]bool
+	public    map[string]bool
+
+	publicPrefixes []string
+}
+
+// NewAuthenticatorFromEnv loads credentials from the environment.
+func NewAuthenticatorFromEnv() *Authenticator {
+	a := &Authenticator{
+		apiKeys:   make(map[string]string),
+		jwtSecret: []byte(envString("BRIDGE_JWT_SECRET", "")),
+		admins:    make(map[string]bool),
+		public: map[string]bool{
+			"/health": true,
+			"/qr":     true,
+			"/qr.png": true,
+			"/ws":     true,
+			// Chatwoot can't send headers; it authenticates with ?token=.
+			"/chatwoot/webhook": true,
+		},
+		// The Matrix homeserver authenticates with its own hs_token.
+		publicPrefixes: []string{"/_matrix/app/"},
+	}
+	for i, entry := range envList("BRIDGE_API_KEYS") {
+		key, operator, ok := strings.Cut(entry, ":")
+		if !ok || operator == "" {
+			operator = fmt.Sprintf("key-%d", i+1)
+		}
+		a.apiKeys[key] = operator
+	}
+	for _, operator := range envList("BRIDGE_ADMIN_OPERATORS") {
+		a.admins[operator] = true
+	}
+	return a
+}
+
+// Enabled reports whether any credential source is configured.
+func (a *Authenticator) Enabled() bool {
+	return len(a.apiKeys) > 0 || len(a.jwtSecret) > 0
+}
+
+// IsAdmin reports whether operator may see other operators' data. Without
+// authentication there is nobody to keep apart.
+func (a *Authenticator) IsAdmin(operator string) bool {
+	return !a.Enabled() || a.admins[operator]
+}
+
+// Middleware rejects unauthenticated requests to non-public paths and stores
+// the resolved operator in the request context.
+func (a *Authenticator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !a.Enabled() {
+			next.ServeHTTP(w, r.WithContext(withOperator(r.Context(), anonymousOperator)))
+			return
+		}
+		if a.isPublic(r.URL.Path) || r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		operator, err := a.authenticate(r)
+		if err != nil {
+			writeJSON(w, http.StatusUnauthorized, Response{Success: false, Error: err.Error()})
+			return
+		}
+		annotateRequest(r.Context(), "operator", operator)
+		next.ServeHTTP(w, r.WithContext(withOperator(r.Context(), operator)))
+	})
+}
+
+func (a *Authenticator) isPublic(path string) bool {
+	if a.public[path] {
+		return true
+	}
+	for _, prefix := range a.publicPrefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *Authenticator) authenticate(r *http.Request) (string, error) {
+	apiKey := r.Header.Get("X-API-Key")
+	if apiKey == "" && r.URL.Path == "/events" {
+		// EventSource cannot send headers.
+		apiKey = r.URL.Query().Get("access_token")
+	}
+	return a.authenticateCredentials(apiKey, r.Header.Get("Authorization"))
+}
+
+// authenticateCredentials resolves an API key, else a bearer Authorization
+// value, to its operator.
+func (a *Authenticator) authenticateCredentials(apiKey, authorization string) (string, error) {
+	token := apiKey
+	if token == "" {
+		if bearer, ok := strings.CutPrefix(authorization, "Bearer "); ok {
+			token = strings.TrimSpace(bearer)
+		}
+	}
+	if token == "" {
+		return "", fmt.Errorf("missing credentials")
+	}
+
+	for key, operator := range a.apiKeys {
+		if subtle.ConstantTimeCompare([]byte(key), []byte(token)) == 1 {
+			return operator, nil
+		}
+	}
+
+	if len(a.jwtSecret) > 0 && strings.Count(token, ".") == 2 {
+		sub, err := verifyJWT(token, a.jwtSecret)
+		if err != nil {
+			return "", err
+		}
+		return "jwt:" + sub, nil
+	}
+	return "", fmt.Errorf("invalid credentials")
+}
+
+// verifyJWT checks an HS256 token's signature and expiry and returns its subject.
+func verifyJWT(token string, secret []byte) (string, error) {
+	parts := strings.Split(token, ".")
+
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeJWTPart(parts[0], &header); err != nil || header.Alg != "HS256" {
+		return "", fmt.Errorf("unsupported token")
+	}
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !hmac.Equal(signature, mac.Sum(nil)) {
+		return "", fmt.Errorf("invalid token signature")
+	}
+
+	var claims struct {
+		Sub string `json:"sub"`
+		Exp int64  `json:"exp"`
+	}
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return "", fmt.Errorf("invalid token claims")
+	}
+	if claims.Exp != 0 && time.Now().Unix() >= claims.Exp {
+		return "", fmt.Errorf("token expired")
+	}
+	if claims.Sub == "" {
+		return "", fmt.Errorf("token has no subject")
+	}
+	return claims.Sub, nil
+}
+
+func decodeJWTPart(part string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func withOperator(ctx context.Context, operator string) context.Context {
+	return context.WithValue(ctx, operatorKey{}, operator)
+}
+
+// operatorFromContext returns the operator that triggered the current action.
+func operatorFromContext(ctx context.Context) string {
+	if operator, ok := ctx.Value(operatorKey{}).(string); ok {
+		return operator
+	}
+	return anonymousOperator
+}
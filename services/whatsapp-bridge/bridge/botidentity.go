@@ -0,0 +1,87 @@
+package bridge
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// BotIdentity tells consumers serving several WhatsApp accounts which one
+// an event belongs to. It is added as "bot" to every JSON object payload
+// the sinks publish, unless PAYLOAD_BOT_IDENTITY=false.
+type BotIdentity struct {
+	JID   string `json:"jid,omitempty"`   // own account, empty before pairing
+	Name  string `json:"name,omitempty"`  // display (push) name of the account
+	Alias string `json:"alias,omitempty"` // BOT_ALIAS, an operator-chosen label
+}
+
+// botIdentityFromEnv returns what the fan-out calls for the identity of
+// each event, or nil when disabled. The JID and name are read per event,
+// since they change on pairing.
+func (b *WhatsAppBridge) botIdentityFromEnv() func() *BotIdentity {
+	if !envBool("PAYLOAD_BOT_IDENTITY", true) {
+		return nil
+	}
+	alias := envString("BOT_ALIAS", "")
+	return func() *BotIdentity {
+		identity := &BotIdentity{JID: b.ownJID(), Alias: alias}
+		if b.client != nil {
+			identity.Name = b.client.Device().PushName
+		}
+		return identity
+	}
+}
+
+// MarshalPayload encodes the event's payload as sinks publish it, with the
+// bot identity and the shard key added. Payloads that are not JSON objects
+// are encoded unchanged, and keys a payload already has are kept.
+func (evt BridgeEvent) MarshalPayload() ([]byte, error) {
+	data, err := json.Marshal(evt.Payload)
+	if err != nil || len(data) < 2 || data[0] != '{' {
+		return data, err
+	}
+	var fields []string
+	var values []interface{}
+	if evt.Bot != nil {
+		fields, values = append(fields, "bot"), append(values, evt.Bot)
+	}
+	if evt.ShardKey != "" {
+		fields, values = append(fields, "shard_key"), append(values, evt.ShardKey)
+	}
+	return prependFields(data, fields, values)
+}
+
+// prependFields adds fields to the JSON object data, skipping those it
+// already has.
+func prependFields(data []byte, fields []string, values []interface{}) ([]byte, error) {
+	var probe map[string]json.RawMessage
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, field := range fields {
+		if bytes.Contains(data, []byte(`"`+field+`":`)) {
+			if probe == nil && json.Unmarshal(data, &probe) != nil {
+				return data, nil
+			}
+			if _, taken := probe[field]; taken {
+				continue
+			}
+		}
+		value, err := json.Marshal(values[i])
+		if err != nil {
+			return nil, err
+		}
+		if buf.Len() > 1 {
+			buf.WriteByte(',')
+		}
+		fmt.Fprintf(&buf, "%q:", field)
+		buf.Write(value)
+	}
+	if buf.Len() == 1 {
+		return data, nil
+	}
+	if len(data) > 2 {
+		buf.WriteByte(',')
+	}
+	buf.Write(data[1:])
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,32 @@
+package bridge_test
+
+import (
+	"testing"
+
+	"github.com/phenobarbital/ai-parrot/whatsapp-bridge/bridge"
+	"github.com/phenobarbital/ai-parrot/whatsapp-bridge/bridgetest"
+)
+
+func TestPayloadsCarryBotIdentity(t *testing.T) {
+	h := bridgetest.New(t, bridgetest.WithEnv("BOT_ALIAS", "support"))
+	h.ReceiveText("5215512345678", "hola")
+
+	var payload struct {
+		Bot bridge.BotIdentity `json:"bot"`
+	}
+	h.DecodePayload(h.ExpectEvent(bridge.EventMessage), &payload)
+	if payload.Bot.JID != bridgetest.DefaultOwnJID.String() || payload.Bot.Alias != "support" {
+		t.Fatalf("bot identity = %+v", payload.Bot)
+	}
+}
+
+func TestPayloadBotIdentityDisabled(t *testing.T) {
+	h := bridgetest.New(t, bridgetest.WithEnv("PAYLOAD_BOT_IDENTITY", "false"))
+	h.ReceiveText("5215512345678", "hola")
+
+	var payload map[string]any
+	h.DecodePayload(h.ExpectEvent(bridge.EventMessage), &payload)
+	if _, ok := payload["bot"]; ok {
+		t.Fatalf("payload has a bot identity: %v", payload["bot"])
+	}
+}
@@ -0,0 +1,919 @@
+package bridge
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/gorilla/websocket"
+	_ "github.com/mattn/go-sqlite3"
+	qrterminal "github.com/mdp/qrterminal/v3"
+	"github.com/phenobarbital/ai-parrot/whatsapp-bridge/pairing"
+	"github.com/skip2/go-qrcode"
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/store"
+	"go.mau.fi/whatsmeow/store/sqlstore"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	waLog "go.mau.fi/whatsmeow/util/log"
+	"google.golang.org/protobuf/proto"
+)
+
+// WhatsAppBridge manages WhatsApp connection and message routing.
+type WhatsAppBridge struct {
+	client          Client
+	redisClient     *redis.Client
+	ctx             context.Context // cancelled at the end of Shutdown
+	cancel          context.CancelFunc
+	intake          context.Context // cancelled by Drain: stops queue consumers and event streams
+	stopIntake      context.CancelFunc
+	qrCodeData      string
+	qrCodePNG       []byte
+	authenticated   bool
+	callbackURL     string // HTTP callback URL for direct integration
+	reporter        *ErrorReporter
+	sinks           *FanOut
+	stdoutSink      bool // events go to stdout, so the QR code goes to stderr
+	events          EventFilter
+	archiveDB       *Archive
+	auth            *Authenticator
+	mediaPolicy     *MediaPolicy
+	media           *MediaLibrary
+	downloader      *MediaDownloader
+	thumbnails      *Thumbnailer
+	inbound         *inboundWorkers
+	janitor         *Janitor
+	digester        *Digester
+	debouncer       *Debouncer
+	feedback        *FeedbackDetector
+	idle            *IdleWatcher
+	router          *MessageRouter
+	health          *HealthTracker
+	splitter        *MessageSplitter
+	pacer           *Pacer
+	sendSlots       *sendSlots
+	transforms      []func(string) string // OUTBOUND_TRANSFORMS stages
+	chatwoot        *ChatwootConnector
+	matrix          *MatrixConnector
+	grpc            *grpcServer
+	sse             *sseHub
+	resendMu        sync.Mutex // serializes re-sends after reconnect
+	lifecycle       lifecycleHooks
+	notifier        *TelegramNotifier
+	consent         *ConsentPolicy
+	verification    RecipientVerification
+	business        BusinessLookup
+	countryPolicies *CountryPolicies
+	translator      *Translator
+	campaigns       *Campaigner
+	liveLocationTTL time.Duration  // LIVE_LOCATION_TTL, see live_location.go
+	location        *time.Location // timezone used for RFC3339 timestamps in payloads
+
+	// WebSocket connections for QR code streaming
+	wsUpgrader websocket.Upgrader
+	wsMu       sync.Mutex // guards wsClients, their subscriptions and pairing
+	wsClients  map[*wsClient]bool
+	pairing    pairingSnapshot
+}
+
+// IncomingMessage is the structure published to Redis for each received message.
+type IncomingMessage struct {
+	From             string                 `json:"from"`
+	FromServer       string                 `json:"from_server,omitempty"`
+	FromName         string                 `json:"from_name,omitempty"`
+	Content          string                 `json:"content"`
+	Type             string                 `json:"type"`
+	Media            string                 `json:"media,omitempty"`      // encrypted CDN URL
+	MediaInfo        *MediaInfo             `json:"media_info,omitempty"` // see media_inline.go
+	Location         *Location              `json:"location,omitempty"`   // location messages
+	Contacts         []SharedContact        `json:"contacts,omitempty"`   // contacts messages
+	InteractiveReply *InteractiveReply      `json:"interactive_reply,omitempty"`
+	Business         *BusinessProfile       `json:"business,omitempty"` // senders with a business account
+	Quoted           *QuotedMessage         `json:"quoted,omitempty"`   // the message this one replies to
+	Mentions         []string               `json:"mentions,omitempty"` // JIDs tagged in the message
+	MentionsMe       bool                   `json:"mentions_me"`        // the bridge's account is among them
+	Timestamp        int64                  `json:"timestamp"`
+	TimestampISO     string                 `json:"timestamp_iso"` // RFC3339 in Timezone
+	Timezone         string                 `json:"timezone"`
+	MessageID        string                 `json:"message_id"`
+	IsGroup          bool                   `json:"is_group"`
+	GroupName        string                 `json:"group_name,omitempty"`
+	ContentHash      string                 `json:"content_hash"`         // sha256 of normalized content + media
+	ContactID        string                 `json:"contact_id,omitempty"` // stable ID across phone number/LID
+	SuggestionReply  *SuggestionReply       `json:"suggestion_reply,omitempty"`
+	Route            string                 `json:"route,omitempty"` // routing rule that matched
+	Translation      *Translation           `json:"translation,omitempty"`
+	Consent          string                 `json:"consent,omitempty"` // granted or revoked; empty when unknown
+	Conversation     *ConversationState     `json:"conversation,omitempty"`
+	Burst            []IncomingMessage      `json:"burst,omitempty"` // debounced messages combined into this one, oldest first
+	Extra            map[string]interface{} `json:"extra,omitempty"`
+}
+
+// OutgoingMessage is the payload accepted by the /send endpoint.
+type OutgoingMessage struct {
+	Phone    string `json:"phone"`
+	Server   string `json:"server,omitempty"`
+	Message  string `json:"message"`
+	MediaURL string `json:"media_url,omitempty"`
+
+	// ChatType selects the server when Phone is not a full JID: user (the
+	// default), lid, group, broadcast or newsletter.
+	ChatType string `json:"chat_type,omitempty"`
+
+	// Quoted reply: the message being answered and, optionally, its author
+	// (phone or JID) and text when they are not in the archive.
+	ReplyToMessageID   string `json:"reply_to_message_id,omitempty"`
+	ReplyToParticipant string `json:"reply_to_participant,omitempty"`
+	ReplyToText        string `json:"reply_to_text,omitempty"`
+
+	// Mentions lists phones or JIDs to tag in addition to @<phone> tokens
+	// found in Message.
+	Mentions []string `json:"mentions,omitempty"`
+
+	// MentionAll tags every participant of the group Phone names (see
+	// mentionAllChunks).
+	MentionAll bool `json:"mention_all,omitempty"`
+
+	// Suggestions are rendered as a numbered list; a numeric reply is mapped
+	// back to the suggestion ID in the inbound payload.
+	Suggestions []Suggestion `json:"suggestions,omitempty"`
+
+	// ViewOnce sends MediaURL as view-once media. EphemeralTTL (seconds)
+	// makes the message disappear, matching the chat's disappearing timer
+	// (86400, 604800 or 7776000).
+	ViewOnce     bool `json:"view_once,omitempty"`
+	EphemeralTTL int  `json:"ephemeral_ttl,omitempty"`
+
+	// Raw skips the outbound transforms (e.g. Markdown conversion) and
+	// translation.
+	Raw bool `json:"raw,omitempty"`
+
+	// ConsentOverride sends even when CONSENT_REQUIRED would block a
+	// proactive message to a contact without consent.
+	ConsentOverride bool `json:"consent_override,omitempty"`
+
+	// ClientMessageID is the caller's ID for the message; like the
+	// Idempotency-Key header, a repeated ID returns the original response
+	// instead of sending again.
+	ClientMessageID string `json:"client_message_id,omitempty"`
+
+	// Priority is the send class: realtime, transactional or campaign
+	// (see PriorityRealtime). Empty picks one from the conversation.
+	Priority string `json:"priority,omitempty"`
+
+	// Language translates Message into this language code; when empty and
+	// TRANSLATE_OUTGOING is on, the chat's detected language is used.
+	Language string `json:"language,omitempty"`
+
+	// Template names a stored template rendered with Params in place of
+	// Message.
+	Template string                 `json:"template,omitempty"`
+	Params   map[string]interface{} `json:"params,omitempty"`
+
+	// templateHeader is set when MediaURL comes from Template's header, so
+	// the upload can be cached.
+	templateHeader *TemplateHeader
+}
+
+// Response is the standard JSON envelope returned by all HTTP handlers.
+type Response struct {
+	Success bool        `json:"success"`
+	Data    interface{} `json:"data,omitempty"`
+	Error   string      `json:"error,omitempty"`
+}
+
+// NewWhatsAppBridge creates a bridge connected to Redis.
+func NewWhatsAppBridge(redisURL string) (*WhatsAppBridge, error) {
+	opt, err := redis.ParseURL(redisURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Redis URL: %v", err)
+	}
+
+	redisClient := redis.NewClient(opt)
+	ctx := context.Background()
+
+	if err := redisClient.Ping(ctx).Err(); err != nil {
+		return nil, fmt.Errorf("Redis connection failed: %v", err)
+	}
+
+	return New(redisClient, nil), nil
+}
+
+// New builds a bridge around an existing Redis client and, optionally, a
+// WhatsApp client; InitializeWhatsApp provides the real one when nil.
+func New(redisClient *redis.Client, client Client) *WhatsAppBridge {
+	ctx, cancel := context.WithCancel(context.Background())
+	intake, stopIntake := context.WithCancel(ctx)
+	b := &WhatsAppBridge{
+		ctx:         ctx,
+		cancel:      cancel,
+		intake:      intake,
+		stopIntake:  stopIntake,
+		redisClient: redisClient,
+		location:    loadLocation(),
+		wsUpgrader: websocket.Upgrader{
+			CheckOrigin: func(r *http.Request) bool { return true },
+		},
+		wsClients: make(map[*wsClient]bool),
+	}
+	if client != nil {
+		b.setClient(client)
+	}
+	return b
+}
+
+func (b *WhatsAppBridge) setClient(client Client) {
+	b.client = client
+	b.client.AddEventHandler(b.handleEvent)
+}
+
+// dataDir holds the session store, the archive and downloaded media.
+const dataDir = "data"
+
+// sessionDSN is whatsmeow's SQLite session store.
+const sessionDSN = "file:" + dataDir + "/whatsapp.db?_foreign_keys=on"
+
+// InitializeWhatsApp sets up the whatsmeow client with SQLite session storage.
+func (b *WhatsAppBridge) InitializeWhatsApp() error {
+	dbLog := waLog.Stdout("Database", "INFO", true)
+
+	// Ensure data directory exists
+	if _, err := os.Stat(dataDir); os.IsNotExist(err) {
+		os.Mkdir(dataDir, 0755)
+	}
+
+	container, err := sqlstore.New(b.ctx, "sqlite3", sessionDSN, dbLog)
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %v", err)
+	}
+
+	deviceStore, err := container.GetFirstDevice(b.ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get device: %v", err)
+	}
+
+	clientLog := waLog.Stdout("Client", "INFO", true)
+
+	// Customize device name shown in WhatsApp > Linked Devices
+	store.DeviceProps.Os = proto.String("Parrot Bridge")
+	store.DeviceProps.RequireFullSync = proto.Bool(false)
+
+	b.setClient(whatsmeowClient{whatsmeow.NewClient(deviceStore, clientLog)})
+
+	return nil
+}
+
+func (b *WhatsAppBridge) handleEvent(evt interface{}) {
+	log.Printf("🔔 Event received: %T", evt)
+	switch v := evt.(type) {
+	case *events.Message:
+		log.Printf("📩 Message event: from=%s, isFromMe=%v, chat=%s, type=%T",
+			v.Info.Sender.User, v.Info.IsFromMe, v.Info.Chat.User, v.Message)
+		b.dispatchIncoming(v)
+	case *events.Receipt:
+		log.Printf("Receipt: %v", v)
+		b.recordReceipt(v.Type)
+		b.recordRead(v)
+		b.recordStatusReceipt(v)
+	case *events.Presence:
+		log.Printf("Presence: %s is unavailable=%v", v.From, v.Unavailable)
+		b.publishPresence(v)
+	case *events.ChatPresence:
+		log.Printf("ChatPresence: %s", v.State)
+		b.publishChatPresence(v)
+	case *events.GroupInfo:
+		b.publishGroupUpdate(v)
+	case *events.JoinedGroup:
+		b.publishJoinedGroup(v)
+	case *events.LabelEdit:
+		b.handleLabelEdit(v)
+	case *events.LabelAssociationChat:
+		b.handleLabelAssociation(v)
+	case *events.CallOffer:
+		b.publishCall(v.BasicCallMeta, "offer", "", "")
+	case *events.CallOfferNotice:
+		b.publishCall(v.BasicCallMeta, "offer", v.Media, "")
+	case *events.CallAccept:
+		b.publishCall(v.BasicCallMeta, "accept", "", "")
+	case *events.CallReject:
+		b.publishCall(v.BasicCallMeta, "reject", "", "")
+	case *events.CallTerminate:
+		b.publishCall(v.BasicCallMeta, "terminate", "", v.Reason)
+	case *events.Connected:
+		log.Println("✅ WhatsApp connected")
+		b.authenticated = true
+		b.broadcastAuthenticated()
+		b.notifier.Notify(AlertReconnect, "✅ WhatsApp connected again")
+		b.publishConnection("connected", "")
+		b.enterPhase(b.ctx, PhaseConnected)
+		go b.resendPending()
+	case *events.LoggedOut:
+		log.Println("⚠️ Logged out from WhatsApp")
+		b.authenticated = false
+		b.setPairingState(pairing.StateLoggedOut, v.Reason.String())
+		b.publishConnection("logged_out", v.Reason.String())
+		b.health.Record(SignalLoggedOut)
+		b.notifier.Notify(AlertReauth, fmt.Sprintf("⚠️ Logged out from WhatsApp (%s): re-authentication needed, scan the QR code at /qr", v.Reason))
+		b.reporter.CaptureMessage("warning", "connection", "logged out from WhatsApp", map[string]string{
+			"reason": v.Reason.String(),
+		})
+	case *events.Disconnected:
+		log.Println("⚠️ WhatsApp disconnected")
+		b.health.Record(SignalDisconnect)
+		b.notifier.Notify(AlertDisconnect, "⚠️ WhatsApp disconnected")
+		b.publishConnection("disconnected", "")
+		b.reporter.CaptureMessage("warning", "connection", "disconnected from WhatsApp", nil)
+	case *events.StreamReplaced:
+		log.Println("⚠️ Stream replaced by another client")
+		b.reporter.CaptureMessage("error", "connection", "stream replaced by another client", nil)
+		b.notifier.Notify(AlertDisconnect, "⚠️ WhatsApp session taken over by another client")
+		b.publishConnection("stream_replaced", "")
+	case *events.TemporaryBan:
+		log.Printf("🚫 Temporary ban: %s", v.String())
+		b.health.Record(SignalTemporaryBan)
+		b.notifier.Notify(AlertBan, "🚫 WhatsApp temporary ban: "+v.String())
+		b.publishConnection("temporary_ban", v.String())
+		b.reporter.CaptureMessage("fatal", "connection", "temporary ban", map[string]string{
+			"code":   v.Code.String(),
+			"expire": v.Expire.String(),
+		})
+	case *events.ConnectFailure:
+		log.Printf("❌ Connect failure: %d %s", v.Reason, v.Message)
+		b.health.Record(SignalConnectFailure)
+		b.notifier.Notify(AlertDisconnect, fmt.Sprintf("❌ WhatsApp connect failure: %s %s", v.Reason, v.Message))
+		b.publishConnection("connect_failure", fmt.Sprintf("%s %s", v.Reason, v.Message))
+		b.reporter.CaptureMessage("error", "connection", "connect failure", map[string]string{
+			"reason":  v.Reason.String(),
+			"message": v.Message,
+		})
+	case *events.ClientOutdated:
+		log.Println("❌ Client outdated, update whatsmeow")
+		b.reporter.CaptureMessage("fatal", "connection", "client outdated", nil)
+	case *events.KeepAliveTimeout:
+		log.Printf("⚠️ Keepalive timeout (errors: %d)", v.ErrorCount)
+		b.reporter.CaptureMessage("warning", "connection", "keepalive timeout", map[string]string{
+			"error_count": fmt.Sprint(v.ErrorCount),
+		})
+	case *events.StreamError:
+		log.Printf("❌ Stream error: %s", v.Code)
+		b.reporter.CaptureMessage("error", "connection", "stream error", map[string]string{
+			"code": v.Code,
+		})
+	}
+}
+
+func (b *WhatsAppBridge) handleIncomingMessage(msg *events.Message) {
+	info := msg.Info
+
+	log.Printf("📋 handleIncomingMessage: sender=%s, isFromMe=%v, isGroup=%v, chat=%s",
+		info.Sender.User, info.IsFromMe, info.IsGroup, info.Chat.User)
+
+	// Skip messages from self
+	if info.IsFromMe {
+		log.Printf("⏭️ Skipping message from self (IsFromMe=true)")
+		return
+	}
+	log.Printf("✅ Processing incoming message from %s", info.Sender.User)
+
+	// Nothing about the message is published during maintenance.
+	maintenance := b.inMaintenance()
+	held := maintenance != nil
+
+	if msg.Message.GetPollUpdateMessage() != nil {
+		b.handlePollVote(msg, held)
+		return
+	}
+	if msg.Message.GetReactionMessage() != nil {
+		b.handleInboundReaction(msg, held)
+		return
+	}
+	if isEdit(msg.Message) {
+		b.handleInboundEdit(msg, held)
+		return
+	}
+	if isRevoke(msg.Message) {
+		b.handleInboundRevoke(msg, held)
+		return
+	}
+	if msg.Message.GetLiveLocationMessage() != nil && b.handleLiveLocation(msg, held) {
+		return
+	}
+
+	incomingMsg := IncomingMessage{
+		From:         info.Sender.User,
+		FromServer:   info.Sender.Server,
+		Timestamp:    info.Timestamp.Unix(),
+		TimestampISO: b.formatTime(info.Timestamp),
+		Timezone:     b.location.String(),
+		MessageID:    info.ID,
+		IsGroup:      info.IsGroup,
+		ContactID:    b.resolveContact(info.Sender, info.SenderAlt),
+		Extra:        make(map[string]interface{}),
+	}
+
+	if info.PushName != "" {
+		incomingMsg.FromName = info.PushName
+	}
+	incomingMsg.Business = b.businessProfile(info)
+	incomingMsg.Quoted = b.quotedMessage(msg.Message)
+	incomingMsg.Mentions, incomingMsg.MentionsMe = b.inboundMentions(msg.Message)
+
+	if info.IsGroup {
+		groupInfo, err := b.client.GetGroupInfo(b.ctx, info.Chat)
+		if err == nil {
+			incomingMsg.GroupName = groupInfo.Name
+		}
+	}
+
+	// Extract message content based on type
+	var mediaSHA256 []byte
+	if msg.Message.GetConversation() != "" {
+		incomingMsg.Type = "text"
+		incomingMsg.Content = msg.Message.GetConversation()
+	} else if extendedMsg := msg.Message.GetExtendedTextMessage(); extendedMsg != nil {
+		incomingMsg.Type = "text"
+		incomingMsg.Content = extendedMsg.GetText()
+	} else if imageMsg := msg.Message.GetImageMessage(); imageMsg != nil {
+		incomingMsg.Type = "image"
+		incomingMsg.Content = imageMsg.GetCaption()
+		incomingMsg.Media = imageMsg.GetURL()
+		mediaSHA256 = imageMsg.GetFileSHA256()
+	} else if audioMsg := msg.Message.GetAudioMessage(); audioMsg != nil {
+		incomingMsg.Type = "audio"
+		incomingMsg.Media = audioMsg.GetURL()
+		mediaSHA256 = audioMsg.GetFileSHA256()
+	} else if videoMsg := msg.Message.GetVideoMessage(); videoMsg != nil {
+		incomingMsg.Type = "video"
+		incomingMsg.Content = videoMsg.GetCaption()
+		incomingMsg.Media = videoMsg.GetURL()
+		mediaSHA256 = videoMsg.GetFileSHA256()
+	} else if docMsg := msg.Message.GetDocumentMessage(); docMsg != nil {
+		incomingMsg.Type = "document"
+		incomingMsg.Content = docMsg.GetFileName()
+		incomingMsg.Media = docMsg.GetURL()
+		mediaSHA256 = docMsg.GetFileSHA256()
+	} else if stickerMsg := msg.Message.GetStickerMessage(); stickerMsg != nil {
+		incomingMsg.Type = "sticker"
+		incomingMsg.Content = stickerMsg.GetAccessibilityLabel()
+		incomingMsg.Media = stickerMsg.GetURL()
+		mediaSHA256 = stickerMsg.GetFileSHA256()
+	} else if locationMsg := msg.Message.GetLocationMessage(); locationMsg != nil {
+		incomingMsg.Type = "location"
+		incomingMsg.Location = locationFromMessage(locationMsg)
+		incomingMsg.Content = incomingMsg.Location.content()
+	} else if msg.Message.GetContactMessage() != nil || msg.Message.GetContactsArrayMessage() != nil {
+		incomingMsg.Type = "contacts"
+		incomingMsg.Contacts = contactsFromMessage(msg.Message)
+		names := make([]string, len(incomingMsg.Contacts))
+		for i, c := range incomingMsg.Contacts {
+			names[i] = c.Name
+		}
+		incomingMsg.Content = strings.Join(names, ", ")
+	} else if reply := interactiveReplyFromMessage(msg.Message); reply != nil {
+		incomingMsg.Type = "interactive_reply"
+		incomingMsg.InteractiveReply = reply
+		incomingMsg.Content = reply.Title
+	} else if liveMsg := msg.Message.GetLiveLocationMessage(); liveMsg != nil {
+		incomingMsg.Type = "live_location"
+		incomingMsg.Location = liveLocationFromMessage(liveMsg)
+		incomingMsg.Content = incomingMsg.Location.content()
+	} else {
+		incomingMsg.Type = "unknown"
+		incomingMsg.Content = "Unsupported message type"
+	}
+	incomingMsg.ContentHash = contentHash(incomingMsg.Type, incomingMsg.Content, mediaSHA256)
+	if incomingMsg.Type == "text" {
+		incomingMsg.SuggestionReply = b.matchSuggestion(info.Chat.String(), incomingMsg.Content)
+	}
+	media := mediaFromMessage(msg)
+	incomingMsg.MediaInfo = mediaInfo(media)
+
+	log.Printf("📨 Message from %s (%s): %s", incomingMsg.From, incomingMsg.FromName, incomingMsg.Content)
+
+	b.archive(ArchivedMessage{
+		MessageID:   info.ID,
+		Direction:   DirectionInbound,
+		Chat:        info.Chat.String(),
+		Sender:      info.Sender.ToNonAD().String(),
+		Type:        incomingMsg.Type,
+		Content:     incomingMsg.Content,
+		ContentHash: incomingMsg.ContentHash,
+		ContactID:   incomingMsg.ContactID,
+		Timestamp:   incomingMsg.Timestamp,
+	})
+	incomingMsg.Consent = b.handleConsentKeyword(info.Chat, incomingMsg)
+	if state, err := b.archiveDB.ConversationState(info.Chat.String()); err != nil {
+		log.Printf("Error computing conversation state of %s: %v", info.Chat, err)
+	} else {
+		incomingMsg.Conversation = state
+	}
+	if b.holdForMaintenance(maintenance, info, incomingMsg) {
+		return
+	}
+	b.feedback.Text(info, incomingMsg)
+
+	// Rejected media is still archived, but sinks only see the rejection.
+	if rejection := b.mediaPolicy.Check(b.ctx, b.client, media); rejection != nil {
+		b.rejectMedia(info, incomingMsg, media, rejection)
+		return
+	}
+	b.embedMedia(info.ID, incomingMsg.MediaInfo, media)
+	b.downloader.Enqueue(b.ctx, info.Chat.String(), incomingMsg, media)
+	if media != nil {
+		incomingMsg.MediaInfo.Thumbnail = b.thumbnails.Embedded(info.ID, incomingMsg.MediaInfo.SHA256, media)
+	}
+
+	incomingMsg.Translation = b.translator.Inbound(b.ctx, info.Chat.String(), incomingMsg.Content)
+
+	if b.digester.Add(info.Chat.String(), incomingMsg) || b.debouncer.Add(info.Chat.String(), incomingMsg) {
+		return
+	}
+	b.publishMessage(info.Chat.String(), incomingMsg)
+}
+
+// Connect performs QR-based authentication or resumes an existing session.
+func (b *WhatsAppBridge) Connect() error {
+	if b.client.Device().ID == nil {
+		qrChan, err := b.client.GetQRChannel(b.ctx)
+		if err != nil {
+			return fmt.Errorf("failed to get QR channel: %v", err)
+		}
+
+		err = b.client.Connect()
+		if err != nil {
+			return fmt.Errorf("failed to connect: %v", err)
+		}
+
+		b.setPairingState(pairing.StateStarting, "")
+		for evt := range qrChan {
+			if evt.Event == "code" {
+				b.qrCodeData = evt.Code
+
+				png, err := qrcode.Encode(evt.Code, qrcode.Medium, 256)
+				if err == nil {
+					b.qrCodePNG = png
+				}
+
+				// Keep stdout to the JSON lines of a stdout sink.
+				terminal := os.Stdout
+				if b.stdoutSink {
+					terminal = os.Stderr
+				}
+				qrterminal.GenerateHalfBlock(evt.Code, qrterminal.L, terminal)
+				fmt.Fprintln(terminal, "\n📱 Scan this QR code with WhatsApp")
+				fmt.Fprintln(terminal, "Or visit http://localhost:8765/qr for web QR code")
+
+				b.broadcastQRCode(evt.Code, png, evt.Timeout)
+			} else {
+				log.Printf("QR event: %s", evt.Event)
+				b.qrChannelEvent(evt)
+			}
+		}
+	} else {
+		err := b.client.Connect()
+		if err != nil {
+			return fmt.Errorf("failed to connect: %v", err)
+		}
+		log.Println("✅ WhatsApp connected (already authenticated)")
+		b.authenticated = true
+	}
+
+	return nil
+}
+
+// --- HTTP Handlers ---
+
+func (b *WhatsAppBridge) handleHealth(w http.ResponseWriter, r *http.Request) {
+	draining := b.Draining()
+	response := Response{
+		Success: !draining,
+		Data: map[string]interface{}{
+			"connected":     b.client.IsConnected(),
+			"authenticated": b.authenticated,
+			"logged_in":     b.client.Device().ID != nil,
+			"draining":      draining,
+			"server_time":   b.formatTime(time.Now()),
+			"timezone":      b.location.String(),
+		},
+	}
+	if draining {
+		// Load balancers stop routing here.
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+// Validate checks the fields required to send a text message.
+func (m OutgoingMessage) Validate() error {
+	if m.Phone == "" || (m.Message == "" && m.Template == "") {
+		return fmt.Errorf("phone and message are required")
+	}
+	if m.ViewOnce && m.MediaURL == "" {
+		return fmt.Errorf("view_once requires media_url")
+	}
+	if m.EphemeralTTL < 0 {
+		return fmt.Errorf("ephemeral_ttl must be positive")
+	}
+	if err := validPriority(m.Priority); err != nil {
+		return err
+	}
+	jid, err := m.recipient()
+	if err != nil {
+		return err
+	}
+	if jid.Server == types.BroadcastServer && jid != types.StatusBroadcastJID {
+		return fmt.Errorf("send to broadcast lists with POST /broadcast-lists/{id}/send")
+	}
+	if m.MentionAll && jid.Server != types.GroupServer {
+		return fmt.Errorf("mention_all requires a group chat")
+	}
+	return nil
+}
+
+// recipient resolves the destination chat of the message.
+func (m OutgoingMessage) recipient() (types.JID, error) {
+	return resolveRecipient(m.Phone, m.Server, m.ChatType)
+}
+
+// sendSingle sends msg as one WhatsApp message, returning its type as
+// archived.
+func (b *WhatsAppBridge) sendSingle(ctx context.Context, msg OutgoingMessage) (whatsmeow.SendResponse, string, error) {
+	jid, err := msg.recipient()
+	if err != nil {
+		return whatsmeow.SendResponse{}, "", fmt.Errorf("%w: %v", errPermanent, err)
+	}
+
+	log.Printf("Sending message to %s (server: %s)%s: %s", jid.User, jid.Server, requestNote(ctx), msg.Message)
+
+	// Assign the ID up front so the message can be tracked while queued.
+	id := b.client.GenerateMessageID()
+	b.trackQueued(ctx, jid.String(), id)
+
+	content, msgType, err := b.buildOutgoingMessage(ctx, jid, id, msg)
+	if err != nil {
+		log.Printf("Error preparing message to %s%s: %v", jid.User, requestNote(ctx), err)
+		b.trackFailed(ctx, id, err)
+		return whatsmeow.SendResponse{ID: id}, "", err
+	}
+
+	resp, err := b.deliver(ctx, jid, content, len([]rune(msg.Message)), whatsmeow.SendRequestExtra{ID: id})
+	if err != nil {
+		log.Printf("Error sending message to %s%s: %v", jid.User, requestNote(ctx), err)
+		b.reportSendFailure(err, jid, msgType)
+		resp.ID = id
+		if isDisconnectError(err) && b.queueResend(ctx, id, jid.String(), msg) {
+			return resp, msgType, fmt.Errorf("%w (%v)", errResendQueued, err)
+		}
+		b.trackFailed(ctx, id, err)
+		return resp, msgType, err
+	}
+
+	log.Printf("Message sent to %s, ID: %s%s", jid.User, resp.ID, requestNote(ctx))
+	if len(msg.Suggestions) > 0 {
+		b.rememberSuggestions(jid.String(), resp.ID, msg.Suggestions)
+	}
+	b.archiveOutgoing(ctx, jid.String(), resp.ID, msgType, msg.Message, resp.Timestamp)
+	go b.chatwoot.MirrorOutgoing(b.ctx, jid.String(), msg.Message, operatorFromContext(ctx))
+	go b.matrix.MirrorOutgoing(b.ctx, jid.String(), msg.Message, operatorFromContext(ctx))
+	return resp, msgType, nil
+}
+
+func (b *WhatsAppBridge) handleSend(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var msg OutgoingMessage
+	if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{Success: false, Error: err.Error()})
+		return
+	}
+
+	if err := msg.Validate(); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(Response{Success: false, Error: err.Error()})
+		return
+	}
+
+	idempotencyKey := r.Header.Get("Idempotency-Key")
+	if idempotencyKey == "" {
+		idempotencyKey = msg.ClientMessageID
+	}
+
+	// Keep the operator attribution but don't abort the send if the client hangs up.
+	ctx := context.WithoutCancel(r.Context())
+	resp, data, replayed, err := b.sendIdempotent(ctx, operatorFromContext(ctx), idempotencyKey, msg)
+	switch {
+	case errors.Is(err, errIdempotencyInProgress), errors.Is(err, errIdempotencyMismatch):
+		writeJSON(w, http.StatusConflict, Response{Success: false, Error: err.Error()})
+	case replayed:
+		w.Header().Set("Idempotent-Replayed", "true")
+		switch data["status"] {
+		case SendStatusPartial:
+			writeJSON(w, http.StatusInternalServerError, Response{Success: false, Error: fmt.Sprint(data["error"]), Data: data})
+		case SendStatusQueued:
+			writeJSON(w, http.StatusAccepted, Response{Success: true, Data: data})
+		default:
+			writeJSON(w, http.StatusOK, Response{Success: true, Data: data})
+		}
+	case err != nil:
+		annotateRequest(r.Context(), "message_id", resp.ID)
+		annotateRequest(r.Context(), "error", err.Error())
+		b.writeSendError(w, err, resp)
+	case resp.Queued:
+		annotateRequest(r.Context(), "message_id", resp.ID)
+		writeJSON(w, http.StatusAccepted, Response{Success: true, Data: data})
+	default:
+		annotateRequest(r.Context(), "message_id", resp.ID)
+		writeJSON(w, http.StatusOK, Response{Success: true, Data: data})
+	}
+}
+
+// Statuses of a send's response data.
+const (
+	SendStatusSent    = "sent"
+	SendStatusQueued  = "queued"  // disconnected: re-sent after reconnect, answered with 202
+	SendStatusPartial = "partial" // some parts of a split message went out
+)
+
+// sendResponse is the data a send answers with, and that idempotent retries
+// get back.
+func (b *WhatsAppBridge) sendResponse(ctx context.Context, result SendResult, err error) map[string]interface{} {
+	data := map[string]interface{}{}
+	if !result.Queued {
+		data = b.timestampFields(result.Timestamp)
+	}
+	data["status"] = result.status()
+	data["message_id"] = result.ID
+	if len(result.PartIDs) > 1 {
+		data["part_ids"] = result.PartIDs
+	}
+	if err != nil {
+		data["status"], data["error"] = SendStatusPartial, err.Error()
+		data["part_ids"] = result.PartIDs
+	}
+	if result.Type != "" {
+		data["content_hash"] = contentHash(result.Type, result.Text, nil)
+	}
+	data["operator"] = operatorFromContext(ctx)
+	if result.Template != "" {
+		data["template"] = result.Template
+	}
+	if result.Variant != "" {
+		data["variant"] = result.Variant
+	}
+	return data
+}
+
+// chatTypeServers maps chat_type values to WhatsApp servers.
+var chatTypeServers = map[string]string{
+	"user":       types.DefaultUserServer,
+	"lid":        types.HiddenUserServer,
+	"group":      types.GroupServer,
+	"broadcast":  types.BroadcastServer,
+	"newsletter": types.NewsletterServer,
+}
+
+// recipientJID builds the destination JID of an already validated recipient.
+func recipientJID(phone, server string) types.JID {
+	jid, _ := resolveRecipient(phone, server, "")
+	return jid
+}
+
+// resolveRecipient builds the destination JID. phone may be a full JID
+// ("120363...@g.us", "status@broadcast"); otherwise it is sanitized (+ and
+// spaces stripped; phone numbers go through normalizePhone) and combined
+// with server, or the server of chatType, defaulting to the regular user
+// server. Both server and chatType accept the chat_type names ("group",
+// "newsletter", ...).
+func resolveRecipient(phone, server, chatType string) (types.JID, error) {
+	if strings.Contains(phone, "@") {
+		jid, err := types.ParseJID(strings.TrimSpace(phone))
+		if err != nil {
+			return jid, fmt.Errorf("invalid JID %q: %v", phone, err)
+		}
+		return jid, nil
+	}
+
+	if server == "" {
+		server = chatType
+	}
+	if mapped, ok := chatTypeServers[server]; ok {
+		server = mapped
+	}
+	if server == "" {
+		server = types.DefaultUserServer
+	}
+
+	if server == types.DefaultUserServer {
+		normalized, err := normalizePhone(phone)
+		if err != nil {
+			return types.NewJID(strings.TrimLeft(phone, "+"), server), err
+		}
+		return types.NewJID(normalized, server), nil
+	}
+
+	phone = strings.TrimLeft(phone, "+")
+	phone = strings.ReplaceAll(phone, " ", "")
+	// Legacy group IDs ("<creator>-<timestamp>") keep their dash.
+	if server == types.HiddenUserServer {
+		phone = strings.ReplaceAll(phone, "-", "")
+	}
+	jid := types.NewJID(phone, server)
+
+	for _, known := range chatTypeServers {
+		if server == known {
+			return jid, nil
+		}
+	}
+	return jid, fmt.Errorf("unknown chat_type or server %q", server)
+}
+
+// writeJSON writes a Response envelope with the given HTTP status.
+func writeJSON(w http.ResponseWriter, status int, resp Response) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (b *WhatsAppBridge) handleQRCode(w http.ResponseWriter, r *http.Request) {
+	if b.qrCodePNG == nil {
+		http.Error(w, "No QR code available", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Write(b.qrCodePNG)
+}
+
+func (b *WhatsAppBridge) handleQRPage(w http.ResponseWriter, r *http.Request) {
+	html := `
+<!DOCTYPE html>
+<html>
+<head>
+    <title>WhatsApp QR Code</title>
+    <style>
+        body {
+            font-family: Arial, sans-serif;
+            display: flex;
+            flex-direction: column;
+            align-items: center;
+            justify-content: center;
+            min-height: 100vh;
+            margin: 0;
+            background: linear-gradient(135deg, #667eea 0%, #764ba2 100%);
+        }
+        .container {
+            background: white;
+            padding: 2rem;
+            border-radius: 10px;
+            box-shadow: 0 10px 40px rgba(0,0,0,0.2);
+            text-align: center;
+        }
+        h1 { color: #333; margin-bottom: 1rem; }
+        #qrcode { margin: 1rem 0; }
+        .status {
+            padding: 0.5rem 1rem;
+            border-radius: 5px;
+            margin-top: 1rem;
+        }
+        .status.connected { background: #10b981; color: white; }
+        .status.waiting   { background: #f59e0b; color: white; }
+    </style>
+</head>
+<body>
+    <div class="container">
+        <h1>🔐 WhatsApp Authentication</h1>
+        <p>Scan this QR code with WhatsApp on your phone</p>
+        <div id="qrcode"></div>
+        <div id="status" class="status waiting">Waiting for scan...</div>
+    </div>
+    <script>
+        const ws = new WebSocket('ws://' + window.location.host + '/ws');
+        const qrDiv = document.getElementById('qrcode');
+        const statusDiv = document.getElementById('status');
+        ws.onmessage = function(event) {
+            const data = JSON.parse(event.data);
+            if (data.type === 'qr_code') {
+                qrDiv.innerHTML = '<img src="/qr.png?' + Date.now() + '" alt="QR Code">';
+            } else if (data.type === 'authenticated') {
+                statusDiv.className = 'status connected';
+                statusDiv.textContent = '✅ Connected to WhatsApp!';
+                setTimeout(() => { window.close(); }, 2000);
+            }
+        };
+        fetch('/qr.png').then(r => { if (r.ok) qrDiv.innerHTML = '<img src="/qr.png" alt="QR Code">'; });
+    </script>
+</body>
+</html>
+	`
+	w.Header().Set("Content-Type", "text/html")
+	w.Write([]byte(html))
+}
@@ -0,0 +1,195 @@
+package bridge
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/gorilla/mux"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// broadcastListsKey is the Redis hash holding broadcast lists by ID.
+const broadcastListsKey = "whatsapp:broadcast_lists"
+
+// BroadcastList is a named set of recipients messaged individually, like a
+// WhatsApp broadcast list. whatsmeow can neither read the lists created on
+// the phone nor send to them, so lists are managed through the bridge API
+// and sent as throttled campaigns. The status broadcast (status@broadcast)
+// is listed as a built-in and is sent to through /send.
+type BroadcastList struct {
+	ID         string   `json:"id"`
+	Name       string   `json:"name"`
+	Recipients []string `json:"recipients"` // phones or JIDs
+	BuiltIn    bool     `json:"built_in,omitempty"`
+	UpdatedAt  int64    `json:"updated_at,omitempty"`
+	UpdatedBy  string   `json:"updated_by,omitempty"`
+}
+
+func (b *WhatsAppBridge) loadBroadcastList(r *http.Request, id string) (*BroadcastList, error) {
+	data, err := b.redisClient.HGet(r.Context(), broadcastListsKey, id).Bytes()
+	if err == redis.Nil {
+		return nil, fmt.Errorf("broadcast list %q not found", id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var list BroadcastList
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("broadcast list %q is corrupt: %v", id, err)
+	}
+	return &list, nil
+}
+
+// handleListBroadcastLists serves GET /broadcast-lists.
+func (b *WhatsAppBridge) handleListBroadcastLists(w http.ResponseWriter, r *http.Request) {
+	all, err := b.redisClient.HGetAll(r.Context(), broadcastListsKey).Result()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	lists := make([]BroadcastList, 0, len(all)+1)
+	for _, data := range all {
+		var list BroadcastList
+		if json.Unmarshal([]byte(data), &list) == nil {
+			lists = append(lists, list)
+		}
+	}
+	sort.Slice(lists, func(i, j int) bool { return lists[i].Name < lists[j].Name })
+	// Status recipients follow the account's status privacy settings.
+	lists = append([]BroadcastList{{
+		ID:         types.StatusBroadcastJID.String(),
+		Name:       "Status",
+		Recipients: []string{},
+		BuiltIn:    true,
+	}}, lists...)
+	writeJSON(w, http.StatusOK, Response{Success: true, Data: lists})
+}
+
+// handleGetBroadcastList serves GET /broadcast-lists/{id}.
+func (b *WhatsAppBridge) handleGetBroadcastList(w http.ResponseWriter, r *http.Request) {
+	list, err := b.loadBroadcastList(r, mux.Vars(r)["id"])
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, Response{Success: false, Error: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, Response{Success: true, Data: list})
+}
+
+// handlePutBroadcastList serves PUT /broadcast-lists/{id}, creating or
+// replacing a list. Recipients are validated and de-duplicated.
+func (b *WhatsAppBridge) handlePutBroadcastList(w http.ResponseWriter, r *http.Request) {
+	var list BroadcastList
+	if err := json.NewDecoder(r.Body).Decode(&list); err != nil {
+		writeJSON(w, http.StatusBadRequest, Response{Success: false, Error: err.Error()})
+		return
+	}
+	list.ID = mux.Vars(r)["id"]
+	if list.ID == types.StatusBroadcastJID.String() {
+		writeJSON(w, http.StatusBadRequest, Response{Success: false, Error: "the status broadcast cannot be modified"})
+		return
+	}
+	if list.Name == "" {
+		list.Name = list.ID
+	}
+	if len(list.Recipients) == 0 {
+		writeJSON(w, http.StatusBadRequest, Response{Success: false, Error: "recipients are required"})
+		return
+	}
+	if max := b.campaigns.maxRecipients; max > 0 && len(list.Recipients) > max {
+		writeJSON(w, http.StatusBadRequest, Response{Success: false, Error: fmt.Sprintf("at most %d recipients per list", max)})
+		return
+	}
+
+	seen := make(map[types.JID]bool, len(list.Recipients))
+	recipients := make([]string, 0, len(list.Recipients))
+	for _, recipient := range list.Recipients {
+		jid, err := resolveRecipient(recipient, "", "")
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, Response{Success: false, Error: err.Error()})
+			return
+		}
+		if jid.Server != types.DefaultUserServer && jid.Server != types.HiddenUserServer {
+			writeJSON(w, http.StatusBadRequest, Response{Success: false, Error: fmt.Sprintf("broadcast recipients must be users: %s", recipient)})
+			return
+		}
+		if !seen[jid] {
+			seen[jid] = true
+			recipients = append(recipients, jid.String())
+		}
+	}
+	list.Recipients = recipients
+	list.BuiltIn = false
+	list.UpdatedAt = time.Now().Unix()
+	list.UpdatedBy = operatorFromContext(r.Context())
+
+	data, _ := json.Marshal(list)
+	if err := b.redisClient.HSet(r.Context(), broadcastListsKey, list.ID, data).Err(); err != nil {
+		writeJSON(w, http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, Response{Success: true, Data: list})
+}
+
+// handleDeleteBroadcastList serves DELETE /broadcast-lists/{id}.
+func (b *WhatsAppBridge) handleDeleteBroadcastList(w http.ResponseWriter, r *http.Request) {
+	n, err := b.redisClient.HDel(r.Context(), broadcastListsKey, mux.Vars(r)["id"]).Result()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	if n == 0 {
+		writeJSON(w, http.StatusNotFound, Response{Success: false, Error: "broadcast list not found"})
+		return
+	}
+	writeJSON(w, http.StatusOK, Response{Success: true})
+}
+
+// handleSendBroadcast serves POST /broadcast-lists/{id}/send. The body is a
+// /send/bulk request without recipients; the list's members are messaged
+// as a campaign, whose progress is at GET /send/bulk/{campaign id}.
+func (b *WhatsAppBridge) handleSendBroadcast(w http.ResponseWriter, r *http.Request) {
+	list, err := b.loadBroadcastList(r, mux.Vars(r)["id"])
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, Response{Success: false, Error: err.Error()})
+		return
+	}
+
+	var req BulkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, Response{Success: false, Error: err.Error()})
+		return
+	}
+	if req.Message == "" && req.Template == "" {
+		writeJSON(w, http.StatusBadRequest, Response{Success: false, Error: "message or template is required"})
+		return
+	}
+	if req.Template != "" {
+		if _, err := b.loadTemplate(req.Template); err != nil {
+			writeJSON(w, http.StatusBadRequest, Response{Success: false, Error: err.Error()})
+			return
+		}
+	}
+	if req.Name == "" {
+		req.Name = "broadcast:" + list.ID
+	}
+	req.Recipients = make([]BulkRecipient, 0, len(list.Recipients))
+	for _, recipient := range list.Recipients {
+		req.Recipients = append(req.Recipients, BulkRecipient{Phone: recipient})
+	}
+
+	campaign, err := b.campaigns.Submit(r.Context(), req)
+	if errors.Is(err, errPermanent) {
+		writeJSON(w, http.StatusBadRequest, Response{Success: false, Error: err.Error()})
+		return
+	}
+	if err != nil {
+		writeJSON(w, http.StatusServiceUnavailable, Response{Success: false, Error: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusAccepted, Response{Success: true, Data: campaign})
+}
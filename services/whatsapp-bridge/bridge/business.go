@@ -0,0 +1,198 @@
+package bridge
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	waBinary "go.mau.fi/whatsmeow/binary"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// Messages from WhatsApp Business accounts carry the sender's business
+// profile in their business field, so agents can treat businesses
+// differently from consumers. Profiles are fetched on the first message of
+// a business and cached in Redis for BUSINESS_PROFILE_TTL (default 24h);
+// failed lookups are retried after BUSINESS_PROFILE_RETRY (default 1h) and
+// leave only the verified name. Lookups wait at most
+// BUSINESS_PROFILE_TIMEOUT (default 5s). BUSINESS_PROFILE_ENRICH=false turns
+// the lookups off.
+
+// BusinessProfile describes a business sender.
+type BusinessProfile struct {
+	JID           string   `json:"jid"`
+	Name          string   `json:"name,omitempty"` // the verified business name
+	Category      string   `json:"category,omitempty"`
+	Categories    []string `json:"categories,omitempty"`
+	Address       string   `json:"address,omitempty"`
+	Email         string   `json:"email,omitempty"`
+	Description   string   `json:"description,omitempty"`
+	Websites      []string `json:"websites,omitempty"`
+	HoursTimezone string   `json:"hours_timezone,omitempty"`
+	Hours         []string `json:"hours,omitempty"` // e.g. "mon open 540-1080"
+	FetchedAt     int64    `json:"fetched_at,omitempty"`
+}
+
+// BusinessInfo is a business profile as WhatsApp returns it: the client
+// library's profile, plus the description and websites it does not parse.
+type BusinessInfo struct {
+	types.BusinessProfile
+	Description string
+	Websites    []string
+}
+
+// BusinessLookup configures the business profile lookups.
+type BusinessLookup struct {
+	Enrich  bool
+	TTL     time.Duration
+	Retry   time.Duration
+	Timeout time.Duration
+}
+
+func businessLookupFromEnv() BusinessLookup {
+	return BusinessLookup{
+		Enrich:  envBool("BUSINESS_PROFILE_ENRICH", true),
+		TTL:     envDuration("BUSINESS_PROFILE_TTL", 24*time.Hour),
+		Retry:   envDuration("BUSINESS_PROFILE_RETRY", time.Hour),
+		Timeout: envDuration("BUSINESS_PROFILE_TIMEOUT", 5*time.Second),
+	}
+}
+
+func businessProfileKey(jid string) string { return "whatsapp:business_profile:" + jid }
+
+// businessProfile returns the profile of the sender of info, or nil when it
+// is not a business.
+func (b *WhatsAppBridge) businessProfile(info types.MessageInfo) *BusinessProfile {
+	if info.VerifiedName == nil {
+		return nil
+	}
+	jid := info.Sender.ToNonAD()
+	if jid.Server != types.DefaultUserServer && info.SenderAlt.Server == types.DefaultUserServer {
+		jid = info.SenderAlt.ToNonAD()
+	}
+	profile := &BusinessProfile{JID: jid.String()}
+	if b.business.Enrich {
+		if cached := b.fetchBusinessProfile(jid); cached != nil {
+			profile = cached
+		}
+	}
+	profile.Name = info.VerifiedName.Details.GetVerifiedName()
+	return profile
+}
+
+// fetchBusinessProfile returns the cached profile of jid, looking it up
+// when it is not cached; nil when the lookup failed.
+func (b *WhatsAppBridge) fetchBusinessProfile(jid types.JID) *BusinessProfile {
+	key := businessProfileKey(jid.String())
+	if data, err := b.redisClient.Get(b.ctx, key).Bytes(); err == nil {
+		if len(data) == 0 {
+			return nil
+		}
+		var profile BusinessProfile
+		if json.Unmarshal(data, &profile) == nil {
+			return &profile
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(b.ctx, b.business.Timeout)
+	defer cancel()
+	found, err := b.client.GetBusinessProfile(ctx, jid)
+	if err != nil {
+		log.Printf("Error fetching the business profile of %s: %v", jid.User, err)
+		b.redisClient.Set(b.ctx, key, "", b.business.Retry)
+		return nil
+	}
+	profile := &BusinessProfile{
+		JID:           jid.String(),
+		Address:       found.Address,
+		Email:         found.Email,
+		Description:   found.Description,
+		Websites:      found.Websites,
+		HoursTimezone: found.BusinessHoursTimeZone,
+		FetchedAt:     time.Now().Unix(),
+	}
+	for _, category := range found.Categories {
+		profile.Categories = append(profile.Categories, category.Name)
+	}
+	if len(profile.Categories) > 0 {
+		profile.Category = profile.Categories[0]
+	}
+	for _, hours := range found.BusinessHours {
+		entry := hours.DayOfWeek + " " + hours.Mode
+		if hours.OpenTime != "" || hours.CloseTime != "" {
+			entry += " " + hours.OpenTime + "-" + hours.CloseTime
+		}
+		profile.Hours = append(profile.Hours, entry)
+	}
+	data, _ := json.Marshal(profile)
+	b.redisClient.Set(b.ctx, key, data, b.business.TTL)
+	return profile
+}
+
+// businessProfileQuery is the w:biz query whatsmeow sends for
+// GetBusinessProfile.
+func businessProfileQuery(jid types.JID) waBinary.Node {
+	return waBinary.Node{
+		Tag:   "business_profile",
+		Attrs: waBinary.Attrs{"v": "244"},
+		Content: []waBinary.Node{{
+			Tag:   "profile",
+			Attrs: waBinary.Attrs{"jid": jid},
+		}},
+	}
+}
+
+// parseBusinessProfile reads the response to businessProfileQuery.
+func parseBusinessProfile(resp *waBinary.Node) (*BusinessInfo, error) {
+	node, ok := resp.GetOptionalChildByTag("business_profile")
+	if !ok {
+		return nil, errors.New("missing business_profile in the response")
+	}
+	profile := node.GetChildByTag("profile")
+	jid, ok := profile.AttrGetter().GetJID("jid", true)
+	if !ok {
+		return nil, errors.New("missing jid in business profile")
+	}
+	text := func(tag string) string {
+		content, _ := profile.GetChildByTag(tag).Content.([]byte)
+		return string(content)
+	}
+	info := &BusinessInfo{
+		BusinessProfile: types.BusinessProfile{
+			JID:            jid,
+			Address:        text("address"),
+			Email:          text("email"),
+			ProfileOptions: map[string]string{},
+		},
+		Description: text("description"),
+	}
+	for _, website := range profile.GetChildrenByTag("website") {
+		if url, _ := website.Content.([]byte); len(url) > 0 {
+			info.Websites = append(info.Websites, string(url))
+		}
+	}
+	categories := profile.GetChildByTag("categories")
+	for _, category := range categories.GetChildrenByTag("category") {
+		name, _ := category.Content.([]byte)
+		info.Categories = append(info.Categories, types.Category{ID: category.AttrGetter().String("id"), Name: string(name)})
+	}
+	hours := profile.GetChildByTag("business_hours")
+	info.BusinessHoursTimeZone = hours.AttrGetter().String("timezone")
+	for _, config := range hours.GetChildrenByTag("business_hours_config") {
+		attrs := config.AttrGetter()
+		info.BusinessHours = append(info.BusinessHours, types.BusinessHoursConfig{
+			DayOfWeek: attrs.String("day_of_week"),
+			Mode:      attrs.String("mode"),
+			OpenTime:  attrs.OptionalString("open_time"),
+			CloseTime: attrs.OptionalString("close_time"),
+		})
+	}
+	options := profile.GetChildByTag("profile_options")
+	for _, option := range options.GetChildren() {
+		value, _ := option.Content.([]byte)
+		info.ProfileOptions[option.Tag] = string(value)
+	}
+	return info, nil
+}
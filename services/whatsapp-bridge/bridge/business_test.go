@@ -0,0 +1,53 @@
+package bridge
+
+import (
+	"slices"
+	"testing"
+
+	waBinary "go.mau.fi/whatsmeow/binary"
+	"go.mau.fi/whatsmeow/types"
+)
+
+func TestParseBusinessProfile(t *testing.T) {
+	jid := types.NewJID("5215512345678", types.DefaultUserServer)
+	resp := &waBinary.Node{Tag: "iq", Content: []waBinary.Node{{
+		Tag: "business_profile",
+		Content: []waBinary.Node{{
+			Tag:   "profile",
+			Attrs: waBinary.Attrs{"jid": jid},
+			Content: []waBinary.Node{
+				{Tag: "description", Content: []byte("Tacos since 1987")},
+				{Tag: "website", Content: []byte("https://tacos.example")},
+				{Tag: "website", Content: []byte("https://shop.tacos.example")},
+				{Tag: "email", Content: []byte("hola@tacos.example")},
+				{Tag: "categories", Content: []waBinary.Node{
+					{Tag: "category", Attrs: waBinary.Attrs{"id": "1"}, Content: []byte("Restaurant")},
+				}},
+				{Tag: "business_hours", Attrs: waBinary.Attrs{"timezone": "America/Mexico_City"}, Content: []waBinary.Node{
+					{Tag: "business_hours_config", Attrs: waBinary.Attrs{"day_of_week": "mon", "mode": "open_24h"}},
+				}},
+			},
+		}},
+	}}}
+
+	info, err := parseBusinessProfile(resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.JID != jid || info.Description != "Tacos since 1987" || info.Email != "hola@tacos.example" {
+		t.Errorf("profile = %+v", info)
+	}
+	if want := []string{"https://tacos.example", "https://shop.tacos.example"}; !slices.Equal(info.Websites, want) {
+		t.Errorf("websites = %v, want %v", info.Websites, want)
+	}
+	if len(info.Categories) != 1 || info.Categories[0].Name != "Restaurant" {
+		t.Errorf("categories = %+v", info.Categories)
+	}
+	if info.BusinessHoursTimeZone != "America/Mexico_City" || len(info.BusinessHours) != 1 || info.BusinessHours[0].Mode != "open_24h" {
+		t.Errorf("hours = %s %+v", info.BusinessHoursTimeZone, info.BusinessHours)
+	}
+
+	if _, err := parseBusinessProfile(&waBinary.Node{Tag: "iq"}); err == nil {
+		t.Error("parsed a response without a business profile")
+	}
+}
@@ -0,0 +1,600 @@
+package bridge
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	mrand "math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/gorilla/mux"
+)
+
+// EventCampaignFinished is published when a bulk campaign completes or is
+// cancelled.
+const EventCampaignFinished = "campaign_finished"
+
+// Campaign statuses.
+const (
+	CampaignQueued    = "queued"
+	CampaignRunning   = "running"
+	CampaignCompleted = "completed"
+	CampaignCancelled = "cancelled"
+)
+
+// maxCampaignFailures caps the per-recipient errors (and skips) kept in a
+// campaign.
+const maxCampaignFailures = 100
+
+// Reasons a campaign skips a recipient.
+const (
+	SkipDuplicate       = "duplicate"        // listed more than once
+	SkipAlreadyMessaged = "already_messaged" // reached by an earlier run of the campaign
+)
+
+// BulkRecipient is one destination of a bulk send. Params are merged over
+// the request's shared params; Message overrides the shared text.
+type BulkRecipient struct {
+	Phone    string                 `json:"phone"`
+	Server   string                 `json:"server,omitempty"`
+	ChatType string                 `json:"chat_type,omitempty"`
+	Message  string                 `json:"message,omitempty"`
+	Params   map[string]interface{} `json:"params,omitempty"`
+	Timezone string                 `json:"timezone,omitempty"` // IANA name, for SendWindow
+}
+
+// BulkRequest is the body of POST /send/bulk. Message may itself use
+// template syntax ({{.name}}) filled from each recipient's params; Template
+// names a stored template instead.
+//
+// The audience is Recipients plus the members of BroadcastLists; a chat
+// listed several times is messaged once, with the first listing's params.
+// Campaigns with a Name remember whom they reached, and SkipMessaged leaves
+// out recipients an earlier campaign of the same name already messaged.
+type BulkRequest struct {
+	Name           string                 `json:"name,omitempty"`
+	Recipients     []BulkRecipient        `json:"recipients"`
+	BroadcastLists []string               `json:"broadcast_lists,omitempty"`
+	SkipMessaged   bool                   `json:"skip_messaged,omitempty"`
+	Message        string                 `json:"message,omitempty"`
+	Template       string                 `json:"template,omitempty"`
+	Params         map[string]interface{} `json:"params,omitempty"`
+	MediaURL       string                 `json:"media_url,omitempty"`
+	Raw            bool                   `json:"raw,omitempty"`
+	SendWindow     *SendWindow            `json:"send_window,omitempty"`
+
+	ConsentOverride bool `json:"consent_override,omitempty"`
+}
+
+// CampaignFailure records a recipient the campaign could not reach.
+type CampaignFailure struct {
+	Phone string `json:"phone"`
+	Error string `json:"error"`
+}
+
+// CampaignSkip records a recipient the campaign deliberately left out.
+type CampaignSkip struct {
+	Phone  string `json:"phone"`
+	Reason string `json:"reason"` // duplicate or already_messaged
+}
+
+// Campaign is the progress report returned by GET /send/bulk/{id} and
+// carried by campaign_finished events.
+type Campaign struct {
+	ID         string            `json:"id"`
+	Name       string            `json:"name,omitempty"`
+	Status     string            `json:"status"`
+	Total      int               `json:"total"`
+	Sent       int               `json:"sent"`
+	Failed     int               `json:"failed"`
+	Skipped    int               `json:"skipped"`
+	Variants   map[string]int    `json:"variants,omitempty"` // sends per template variant
+	Pending    int               `json:"pending"`
+	Deferred   int               `json:"deferred,omitempty"`       // pending recipients outside their send window
+	NextWindow int64             `json:"next_window_at,omitempty"` // when the next deferred recipient's window opens
+	Failures   []CampaignFailure `json:"failures,omitempty"`
+	Skips      []CampaignSkip    `json:"skips,omitempty"`
+	Operator   string            `json:"operator,omitempty"`
+	CreatedAt  int64             `json:"created_at"`
+	StartedAt  int64             `json:"started_at,omitempty"`
+	FinishedAt int64             `json:"finished_at,omitempty"`
+}
+
+type campaignJob struct {
+	campaign *Campaign
+	req      BulkRequest
+	window   *sendWindow
+	ctx      context.Context
+	cancel   context.CancelFunc
+}
+
+// Campaigner runs bulk sends one campaign at a time, spacing messages by
+// 60s/BULK_RATE_PER_MINUTE (default 20) plus a random BULK_JITTER (default
+// 3s), and doubling the delay while the account health is at_risk.
+// Recipients outside the campaign's send window are held back and retried
+// once their window opens. Progress is kept in Redis for CAMPAIGN_TTL
+// (default 7 days); campaigns still queued or running when the bridge stops
+// are not resumed.
+type Campaigner struct {
+	ratePerMinute int
+	jitter        time.Duration
+	maxRecipients int
+	ttl           time.Duration
+	bridge        *WhatsAppBridge
+
+	queue chan *campaignJob
+
+	mu     sync.Mutex
+	active map[string]*campaignJob
+}
+
+func (b *WhatsAppBridge) campaignerFromEnv() *Campaigner {
+	rate := envInt("BULK_RATE_PER_MINUTE", 20)
+	if rate <= 0 {
+		rate = 20
+	}
+	return &Campaigner{
+		ratePerMinute: rate,
+		jitter:        envDuration("BULK_JITTER", 3*time.Second),
+		maxRecipients: envInt("BULK_MAX_RECIPIENTS", 1000),
+		ttl:           envDuration("CAMPAIGN_TTL", 7*24*time.Hour),
+		bridge:        b,
+		queue:         make(chan *campaignJob, max(envInt("BULK_QUEUE_SIZE", 100), 0)),
+		active:        make(map[string]*campaignJob),
+	}
+}
+
+func campaignKey(id string) string {
+	return "whatsapp:campaign:" + id
+}
+
+// campaignAudienceKey is the set of chats reached by campaigns named name.
+func campaignAudienceKey(name string) string {
+	return "whatsapp:campaign_audience:" + name
+}
+
+// recipientKey identifies a recipient's chat, so the same contact written
+// two ways ("+1 555..." and "1555...@s.whatsapp.net") counts once.
+func recipientKey(recipient BulkRecipient) string {
+	jid, err := resolveRecipient(recipient.Phone, recipient.Server, recipient.ChatType)
+	if err != nil {
+		return recipient.Phone
+	}
+	return jid.ToNonAD().String()
+}
+
+// dedupeRecipients keeps the first listing of each chat.
+func dedupeRecipients(recipients []BulkRecipient) ([]BulkRecipient, []CampaignSkip) {
+	seen := make(map[string]bool, len(recipients))
+	unique := make([]BulkRecipient, 0, len(recipients))
+	var skips []CampaignSkip
+	for _, recipient := range recipients {
+		key := recipientKey(recipient)
+		if seen[key] {
+			skips = append(skips, CampaignSkip{Phone: recipient.Phone, Reason: SkipDuplicate})
+			continue
+		}
+		seen[key] = true
+		unique = append(unique, recipient)
+	}
+	return unique, skips
+}
+
+func newCampaignID() string {
+	buf := make([]byte, 8)
+	rand.Read(buf)
+	return "cmp_" + hex.EncodeToString(buf)
+}
+
+// Run processes queued campaigns until ctx is done.
+func (c *Campaigner) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case job := <-c.queue:
+			c.runJob(job)
+		}
+	}
+}
+
+// Submit queues a campaign and returns a snapshot of it, failing when the
+// queue is full or, permanently, when its send window is invalid.
+func (c *Campaigner) Submit(ctx context.Context, req BulkRequest) (*Campaign, error) {
+	window, err := req.SendWindow.parse()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errPermanent, err)
+	}
+	if req.SkipMessaged && req.Name == "" {
+		return nil, fmt.Errorf("%w: skip_messaged needs a campaign name", errPermanent)
+	}
+	total := len(req.Recipients)
+	recipients, skips := dedupeRecipients(req.Recipients)
+	req.Recipients = recipients
+	campaign := &Campaign{
+		ID:        newCampaignID(),
+		Name:      req.Name,
+		Status:    CampaignQueued,
+		Total:     total,
+		Skipped:   len(skips),
+		Pending:   len(recipients),
+		Skips:     skips[:min(len(skips), maxCampaignFailures)],
+		Operator:  operatorFromContext(ctx),
+		CreatedAt: time.Now().Unix(),
+	}
+	jobCtx, cancel := context.WithCancel(withPriority(withOperator(c.bridge.ctx, campaign.Operator), PriorityCampaign))
+	job := &campaignJob{campaign: campaign, req: req, window: window, ctx: jobCtx, cancel: cancel}
+
+	c.save(campaign)
+	c.mu.Lock()
+	select {
+	case c.queue <- job:
+		c.active[campaign.ID] = job
+		bufferMarks.observe("campaigns", "", int64(len(c.queue)))
+		// The job may already be running and updating campaign.
+		snapshot := campaign.copy()
+		c.mu.Unlock()
+		return snapshot, nil
+	default:
+		c.mu.Unlock()
+		cancel()
+		c.bridge.redisClient.Del(c.bridge.ctx, campaignKey(campaign.ID))
+		return nil, fmt.Errorf("campaign queue is full")
+	}
+}
+
+// copy returns a deep copy of the campaign; callers hold the lock.
+func (campaign *Campaign) copy() *Campaign {
+	dup := *campaign
+	dup.Failures = append([]CampaignFailure(nil), campaign.Failures...)
+	dup.Skips = append([]CampaignSkip(nil), campaign.Skips...)
+	if campaign.Variants != nil {
+		dup.Variants = make(map[string]int, len(campaign.Variants))
+		for variant, n := range campaign.Variants {
+			dup.Variants[variant] = n
+		}
+	}
+	return &dup
+}
+
+// Cancel stops a queued or running campaign, reporting whether it was active.
+func (c *Campaigner) Cancel(id string) bool {
+	c.mu.Lock()
+	job, ok := c.active[id]
+	c.mu.Unlock()
+	if ok {
+		job.cancel()
+	}
+	return ok
+}
+
+// Get returns a campaign's latest progress.
+func (c *Campaigner) Get(ctx context.Context, id string) (*Campaign, error) {
+	data, err := c.bridge.redisClient.Get(ctx, campaignKey(id)).Bytes()
+	if err != nil {
+		return nil, err
+	}
+	var campaign Campaign
+	if err := json.Unmarshal(data, &campaign); err != nil {
+		return nil, err
+	}
+	return &campaign, nil
+}
+
+func (c *Campaigner) save(campaign *Campaign) {
+	c.mu.Lock()
+	data, _ := json.Marshal(campaign)
+	c.mu.Unlock()
+	if err := c.bridge.redisClient.Set(c.bridge.ctx, campaignKey(campaign.ID), data, c.ttl).Err(); err != nil {
+		log.Printf("⚠️ Failed to save campaign %s: %v", campaign.ID, err)
+	}
+}
+
+func (c *Campaigner) runJob(job *campaignJob) {
+	campaign := job.campaign
+	defer func() {
+		job.cancel()
+		c.mu.Lock()
+		delete(c.active, campaign.ID)
+		c.mu.Unlock()
+	}()
+
+	c.update(campaign, func() {
+		campaign.Status = CampaignRunning
+		campaign.StartedAt = time.Now().Unix()
+	})
+	log.Printf("📣 Campaign %s started: %d recipients", campaign.ID, campaign.Total)
+
+	pending, sent := job.req.Recipients, 0
+	for len(pending) > 0 && job.ctx.Err() == nil {
+		var deferred []BulkRecipient
+		var opensIn time.Duration
+		for _, recipient := range pending {
+			if wait := job.window.opensIn(job.window.locationFor(recipient, c.bridge.location), time.Now()); wait > 0 {
+				deferred = append(deferred, recipient)
+				if opensIn == 0 || wait < opensIn {
+					opensIn = wait
+				}
+				continue
+			}
+			if job.req.SkipMessaged && c.alreadyMessaged(job, recipient) {
+				c.update(campaign, func() {
+					campaign.Pending--
+					campaign.Skipped++
+					if len(campaign.Skips) < maxCampaignFailures {
+						campaign.Skips = append(campaign.Skips, CampaignSkip{Phone: recipient.Phone, Reason: SkipAlreadyMessaged})
+					}
+				})
+				continue
+			}
+			if job.ctx.Err() != nil || (sent > 0 && !c.wait(job.ctx)) {
+				break
+			}
+			sent++
+			result, err := c.sendOne(job, recipient)
+			if err == nil {
+				c.markMessaged(job, recipient)
+			}
+			c.update(campaign, func() {
+				campaign.Pending--
+				if err != nil {
+					campaign.Failed++
+					if len(campaign.Failures) < maxCampaignFailures {
+						campaign.Failures = append(campaign.Failures, CampaignFailure{Phone: recipient.Phone, Error: err.Error()})
+					}
+					return
+				}
+				campaign.Sent++
+				if result.Variant != "" {
+					if campaign.Variants == nil {
+						campaign.Variants = make(map[string]int)
+					}
+					campaign.Variants[result.Variant]++
+				}
+			})
+		}
+		if len(deferred) == 0 || job.ctx.Err() != nil {
+			break
+		}
+
+		opensAt := time.Now().Add(opensIn)
+		c.update(campaign, func() {
+			campaign.Deferred = len(deferred)
+			campaign.NextWindow = opensAt.Unix()
+		})
+		log.Printf("📣 Campaign %s holding %d recipients until %s", campaign.ID, len(deferred), c.bridge.formatTime(opensAt))
+		if err := sleepContext(job.ctx, opensIn); err != nil {
+			break
+		}
+		pending = deferred
+	}
+
+	c.update(campaign, func() {
+		campaign.Status = CampaignCompleted
+		campaign.Deferred, campaign.NextWindow = 0, 0
+		if job.ctx.Err() != nil {
+			campaign.Status = CampaignCancelled
+		}
+		campaign.FinishedAt = time.Now().Unix()
+	})
+	log.Printf("📣 Campaign %s %s: %d sent, %d failed", campaign.ID, campaign.Status, campaign.Sent, campaign.Failed)
+
+	c.mu.Lock()
+	final := campaign.copy()
+	c.mu.Unlock()
+	c.bridge.publish(EventCampaignFinished, "", *final)
+}
+
+// update applies fn under the lock and persists the campaign.
+func (c *Campaigner) update(campaign *Campaign, fn func()) {
+	c.mu.Lock()
+	fn()
+	c.mu.Unlock()
+	c.save(campaign)
+}
+
+// alreadyMessaged reports whether a campaign of the same name reached
+// recipient before. Lookup errors count as not messaged.
+func (c *Campaigner) alreadyMessaged(job *campaignJob, recipient BulkRecipient) bool {
+	ok, err := c.bridge.redisClient.SIsMember(job.ctx, campaignAudienceKey(job.req.Name), recipientKey(recipient)).Result()
+	if err != nil {
+		log.Printf("Error checking campaign audience of %s: %v", job.req.Name, err)
+	}
+	return ok
+}
+
+// markMessaged remembers that the campaign's name reached recipient, for
+// CAMPAIGN_TTL after its latest send.
+func (c *Campaigner) markMessaged(job *campaignJob, recipient BulkRecipient) {
+	if job.req.Name == "" {
+		return
+	}
+	key := campaignAudienceKey(job.req.Name)
+	pipe := c.bridge.redisClient.TxPipeline()
+	pipe.SAdd(c.bridge.ctx, key, recipientKey(recipient))
+	pipe.Expire(c.bridge.ctx, key, c.ttl)
+	if _, err := pipe.Exec(c.bridge.ctx); err != nil {
+		log.Printf("Error recording campaign audience of %s: %v", job.req.Name, err)
+	}
+}
+
+// wait sleeps for the throttle delay, returning false if cancelled first.
+func (c *Campaigner) wait(ctx context.Context) bool {
+	delay := time.Minute / time.Duration(c.ratePerMinute)
+	if c.jitter > 0 {
+		delay += time.Duration(mrand.Int63n(int64(c.jitter)))
+	}
+	if c.bridge.health != nil && c.bridge.health.Report().Status == HealthAtRisk {
+		delay *= 2
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+func (c *Campaigner) sendOne(job *campaignJob, recipient BulkRecipient) (SendResult, error) {
+	msg := OutgoingMessage{
+		Phone:    recipient.Phone,
+		Server:   recipient.Server,
+		ChatType: recipient.ChatType,
+		Message:  job.req.Message,
+		MediaURL: job.req.MediaURL,
+		Raw:      job.req.Raw,
+		Template: job.req.Template,
+		Params:   mergeParams(job.req.Params, recipient.Params),
+
+		ConsentOverride: job.req.ConsentOverride,
+	}
+	if recipient.Message != "" {
+		msg.Message = recipient.Message
+	}
+	if msg.Template == "" && len(msg.Params) > 0 {
+		text, err := renderInline(msg.Message, msg.Params)
+		if err != nil {
+			return SendResult{}, err
+		}
+		msg.Message = text
+	}
+	if err := msg.Validate(); err != nil {
+		return SendResult{}, err
+	}
+	return c.bridge.sendOutgoing(job.ctx, msg)
+}
+
+// mergeParams overlays per-recipient params on the shared ones.
+func mergeParams(shared, own map[string]interface{}) map[string]interface{} {
+	if len(own) == 0 {
+		return shared
+	}
+	merged := make(map[string]interface{}, len(shared)+len(own))
+	for k, v := range shared {
+		merged[k] = v
+	}
+	for k, v := range own {
+		merged[k] = v
+	}
+	return merged
+}
+
+// renderInline renders a message body as an ad-hoc template.
+func renderInline(body string, params map[string]interface{}) (string, error) {
+	t, err := parseTemplate("inline", body)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", errPermanent, err)
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, params); err != nil {
+		return "", fmt.Errorf("%w: %v", errPermanent, err)
+	}
+	return buf.String(), nil
+}
+
+// handleSendBulk serves POST /send/bulk and returns the queued campaign.
+func (b *WhatsAppBridge) handleSendBulk(w http.ResponseWriter, r *http.Request) {
+	var req BulkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, Response{Success: false, Error: err.Error()})
+		return
+	}
+	for _, id := range req.BroadcastLists {
+		list, err := b.loadBroadcastList(r, id)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, Response{Success: false, Error: err.Error()})
+			return
+		}
+		for _, recipient := range list.Recipients {
+			req.Recipients = append(req.Recipients, BulkRecipient{Phone: recipient})
+		}
+	}
+	if len(req.Recipients) == 0 {
+		writeJSON(w, http.StatusBadRequest, Response{Success: false, Error: "recipients are required"})
+		return
+	}
+	if max := b.campaigns.maxRecipients; max > 0 && len(req.Recipients) > max {
+		writeJSON(w, http.StatusBadRequest, Response{Success: false, Error: fmt.Sprintf("at most %d recipients per campaign", max)})
+		return
+	}
+	if req.Template != "" {
+		if _, err := b.loadTemplate(req.Template); err != nil {
+			writeJSON(w, http.StatusBadRequest, Response{Success: false, Error: err.Error()})
+			return
+		}
+	}
+	for i, recipient := range req.Recipients {
+		if recipient.Phone == "" {
+			writeJSON(w, http.StatusBadRequest, Response{Success: false, Error: fmt.Sprintf("recipient %d: phone is required", i)})
+			return
+		}
+		if req.Message == "" && req.Template == "" && recipient.Message == "" {
+			writeJSON(w, http.StatusBadRequest, Response{Success: false, Error: fmt.Sprintf("recipient %d: message or template is required", i)})
+			return
+		}
+	}
+
+	campaign, err := b.campaigns.Submit(r.Context(), req)
+	if errors.Is(err, errPermanent) {
+		writeJSON(w, http.StatusBadRequest, Response{Success: false, Error: err.Error()})
+		return
+	}
+	if err != nil {
+		writeJSON(w, http.StatusServiceUnavailable, Response{Success: false, Error: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusAccepted, Response{Success: true, Data: campaign})
+}
+
+// callerCampaign loads the campaign named in the request. Campaigns of other
+// operators are not found, except by admins, so their IDs reveal nothing.
+func (b *WhatsAppBridge) callerCampaign(r *http.Request) (*Campaign, error) {
+	campaign, err := b.campaigns.Get(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		return nil, err
+	}
+	if caller := operatorFromContext(r.Context()); campaign.Operator != caller && !b.auth.IsAdmin(caller) {
+		return nil, redis.Nil
+	}
+	return campaign, nil
+}
+
+// handleGetCampaign serves GET /send/bulk/{id}.
+func (b *WhatsAppBridge) handleGetCampaign(w http.ResponseWriter, r *http.Request) {
+	campaign, err := b.callerCampaign(r)
+	if err == redis.Nil {
+		writeJSON(w, http.StatusNotFound, Response{Success: false, Error: "campaign not found"})
+		return
+	}
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, Response{Success: true, Data: campaign})
+}
+
+// handleCancelCampaign serves DELETE /send/bulk/{id}; messages already sent
+// are not recalled.
+func (b *WhatsAppBridge) handleCancelCampaign(w http.ResponseWriter, r *http.Request) {
+	campaign, err := b.callerCampaign(r)
+	if err != nil && err != redis.Nil {
+		writeJSON(w, http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	if campaign == nil || !b.campaigns.Cancel(campaign.ID) {
+		writeJSON(w, http.StatusNotFound, Response{Success: false, Error: "campaign not found or already finished"})
+		return
+	}
+	writeJSON(w, http.StatusOK, Response{Success: true})
+}
@@ -0,0 +1,47 @@
+package bridge_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/phenobarbital/ai-parrot/whatsapp-bridge/bridge"
+	"github.com/phenobarbital/ai-parrot/whatsapp-bridge/bridgetest"
+)
+
+func TestCampaignsScopedToOperator(t *testing.T) {
+	h := bridgetest.New(t,
+		bridgetest.WithEnv("BRIDGE_API_KEYS", "team-key:team,other-key:other,ops-key:ops"),
+		bridgetest.WithEnv("BRIDGE_ADMIN_OPERATORS", "ops"),
+	)
+	// A window that is closed now keeps the campaign running.
+	now := time.Now().UTC()
+	status, resp := doWithKey(t, h, "team-key", http.MethodPost, "/send/bulk", bridge.BulkRequest{
+		Recipients: []bridge.BulkRecipient{{Phone: "5215512345678"}},
+		Message:    "Our new menu is out",
+		SendWindow: &bridge.SendWindow{
+			Start:    now.Add(2 * time.Hour).Format("15:04"),
+			End:      now.Add(3 * time.Hour).Format("15:04"),
+			Timezone: "UTC",
+		},
+	})
+	if status != http.StatusAccepted {
+		t.Fatalf("POST /send/bulk = %d %s", status, resp.Error)
+	}
+	var campaign bridge.Campaign
+	decodeData(t, resp.Data, &campaign)
+	path := "/send/bulk/" + campaign.ID
+
+	if status, _ := doWithKey(t, h, "other-key", http.MethodGet, path, nil); status != http.StatusNotFound {
+		t.Errorf("another operator's GET = %d, want 404", status)
+	}
+	if status, _ := doWithKey(t, h, "other-key", http.MethodDelete, path, nil); status != http.StatusNotFound {
+		t.Errorf("another operator's DELETE = %d, want 404", status)
+	}
+	if status, _ := doWithKey(t, h, "ops-key", http.MethodGet, path, nil); status != http.StatusOK {
+		t.Errorf("admin GET = %d, want 200", status)
+	}
+	if status, resp := doWithKey(t, h, "team-key", http.MethodDelete, path, nil); status != http.StatusOK {
+		t.Errorf("owner DELETE = %d %s, want 200", status, resp.Error)
+	}
+}
@@ -0,0 +1,310 @@
+package bridge
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+// ChatwootConnector mirrors WhatsApp conversations into a Chatwoot API
+// inbox and sends agent replies back. Configured with:
+//
+//	CHATWOOT_URL            - e.g. https://app.chatwoot.com
+//	CHATWOOT_API_TOKEN      - agent/bot access token
+//	CHATWOOT_ACCOUNT_ID     - account the inbox belongs to
+//	CHATWOOT_INBOX_ID       - an "API" channel inbox
+//	CHATWOOT_WEBHOOK_TOKEN  - shared secret expected as ?token= on the
+//	                          inbox webhook pointing at /chatwoot/webhook
+//
+// It acts as the "chatwoot" sink for inbound messages; bridge-sent replies
+// are mirrored as outgoing messages so agents see the AI's side too. The
+// webhook is exempt from API authentication, so without
+// CHATWOOT_WEBHOOK_TOKEN it is not served and agent replies are not relayed.
+// The sink always gets the default payload profile.
+type ChatwootConnector struct {
+	baseURL      string
+	token        string
+	accountID    string
+	inboxID      int
+	webhookToken string
+	client       *http.Client
+	bridge       *WhatsAppBridge
+}
+
+// chatwootOperatorPrefix attributes sends that originate from Chatwoot
+// agents; those are already in the inbox and are not mirrored back.
+const chatwootOperatorPrefix = "chatwoot:"
+
+// chatwootFromEnv returns nil unless CHATWOOT_URL is set.
+func (b *WhatsAppBridge) chatwootFromEnv() (*ChatwootConnector, error) {
+	baseURL := strings.TrimRight(envString("CHATWOOT_URL", ""), "/")
+	if baseURL == "" {
+		return nil, nil
+	}
+	c := &ChatwootConnector{
+		baseURL:      baseURL,
+		token:        envString("CHATWOOT_API_TOKEN", ""),
+		accountID:    envString("CHATWOOT_ACCOUNT_ID", ""),
+		inboxID:      envInt("CHATWOOT_INBOX_ID", 0),
+		webhookToken: envString("CHATWOOT_WEBHOOK_TOKEN", ""),
+		client:       &http.Client{Timeout: 15 * time.Second},
+		bridge:       b,
+	}
+	if c.token == "" || c.accountID == "" || c.inboxID == 0 {
+		return nil, fmt.Errorf("CHATWOOT_URL requires CHATWOOT_API_TOKEN, CHATWOOT_ACCOUNT_ID and CHATWOOT_INBOX_ID")
+	}
+	if c.webhookToken == "" {
+		log.Printf("⚠️ CHATWOOT_WEBHOOK_TOKEN is not set: /chatwoot/webhook is disabled and agent replies are not sent")
+	}
+	return c, nil
+}
+
+func (c *ChatwootConnector) Name() string { return "chatwoot" }
+
+// Deliver appends an inbound message to the chat's Chatwoot conversation,
+// creating the contact and conversation on first contact.
+func (c *ChatwootConnector) Deliver(ctx context.Context, evt BridgeEvent) error {
+	msg, ok := evt.Payload.(IncomingMessage)
+	if evt.Type != EventMessage || !ok {
+		return nil
+	}
+	convID, err := c.conversationFor(ctx, evt.Chat, msg)
+	if err != nil {
+		return err
+	}
+
+	content := msg.Content
+	if msg.Type != "text" {
+		content = strings.TrimSpace(fmt.Sprintf("[%s] %s", msg.Type, msg.Content))
+	}
+	if msg.IsGroup {
+		content = msg.FromName + ": " + content
+	}
+	return c.createMessage(ctx, convID, content, "incoming")
+}
+
+// MirrorOutgoing records a message the bridge sent (e.g. an AI reply) in the
+// chat's conversation. It only mirrors into conversations that already exist.
+func (c *ChatwootConnector) MirrorOutgoing(ctx context.Context, chat, content, operator string) {
+	if c == nil || strings.HasPrefix(operator, chatwootOperatorPrefix) {
+		return
+	}
+	b := c.bridge
+	convID, err := b.redisClient.Get(b.ctx, chatwootConvKey(chat)).Int()
+	if err != nil {
+		return
+	}
+	if err := c.createMessage(ctx, convID, content, "outgoing"); err != nil {
+		log.Printf("Error mirroring message to Chatwoot conversation %d: %v", convID, err)
+	}
+}
+
+func chatwootConvKey(chat string) string { return "whatsapp:chatwoot:conv:" + chat }
+
+func chatwootChatKey(convID int) string { return "whatsapp:chatwoot:chat:" + strconv.Itoa(convID) }
+
+// conversationFor returns the Chatwoot conversation of chat, cached in Redis
+// in both directions so webhook replies can find their way back.
+func (c *ChatwootConnector) conversationFor(ctx context.Context, chat string, msg IncomingMessage) (int, error) {
+	b := c.bridge
+	if id, err := b.redisClient.Get(ctx, chatwootConvKey(chat)).Int(); err == nil {
+		return id, nil
+	}
+
+	name, phone := msg.FromName, "+"+msg.From
+	if msg.IsGroup {
+		name, phone = msg.GroupName, ""
+	}
+	contactID, sourceID, err := c.findOrCreateContact(ctx, chat, name, phone)
+	if err != nil {
+		return 0, err
+	}
+
+	var conv struct {
+		ID int `json:"id"`
+	}
+	err = c.do(ctx, http.MethodPost, "/conversations", map[string]interface{}{
+		"source_id":  sourceID,
+		"inbox_id":   c.inboxID,
+		"contact_id": contactID,
+	}, &conv)
+	if err != nil {
+		return 0, fmt.Errorf("create conversation: %v", err)
+	}
+
+	b.redisClient.Set(ctx, chatwootConvKey(chat), conv.ID, 0)
+	b.redisClient.Set(ctx, chatwootChatKey(conv.ID), chat, 0)
+	log.Printf("💬 Chatwoot conversation %d opened for %s", conv.ID, chat)
+	return conv.ID, nil
+}
+
+// findOrCreateContact looks the chat up by identifier and creates the
+// contact in the inbox when missing, returning its ID and inbox source ID.
+func (c *ChatwootConnector) findOrCreateContact(ctx context.Context, chat, name, phone string) (int, string, error) {
+	type contactInbox struct {
+		SourceID string `json:"source_id"`
+		Inbox    struct {
+			ID int `json:"id"`
+		} `json:"inbox"`
+	}
+	type contact struct {
+		ID             int            `json:"id"`
+		Identifier     string         `json:"identifier"`
+		ContactInboxes []contactInbox `json:"contact_inboxes"`
+	}
+
+	var search struct {
+		Payload []contact `json:"payload"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/contacts/search?q="+url.QueryEscape(chat), nil, &search); err != nil {
+		return 0, "", fmt.Errorf("search contact: %v", err)
+	}
+	for _, ct := range search.Payload {
+		if ct.Identifier != chat {
+			continue
+		}
+		for _, ci := range ct.ContactInboxes {
+			if ci.Inbox.ID == c.inboxID {
+				return ct.ID, ci.SourceID, nil
+			}
+		}
+	}
+
+	body := map[string]interface{}{
+		"inbox_id":   c.inboxID,
+		"name":       name,
+		"identifier": chat,
+	}
+	if phone != "" {
+		body["phone_number"] = phone
+	}
+	var created struct {
+		Payload struct {
+			Contact contact `json:"contact"`
+		} `json:"payload"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/contacts", body, &created); err != nil {
+		return 0, "", fmt.Errorf("create contact: %v", err)
+	}
+	ct := created.Payload.Contact
+	for _, ci := range ct.ContactInboxes {
+		if ci.Inbox.ID == c.inboxID {
+			return ct.ID, ci.SourceID, nil
+		}
+	}
+	return ct.ID, chat, nil
+}
+
+func (c *ChatwootConnector) createMessage(ctx context.Context, convID int, content, messageType string) error {
+	return c.do(ctx, http.MethodPost, fmt.Sprintf("/conversations/%d/messages", convID), map[string]interface{}{
+		"content":      content,
+		"message_type": messageType,
+		"private":      false,
+		// Marks our own writes so their webhook echo is not sent again.
+		"content_attributes": map[string]interface{}{"whatsapp_bridge": true},
+	}, nil)
+}
+
+// do calls the Chatwoot account API.
+func (c *ChatwootConnector) do(ctx context.Context, method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	endpoint := fmt.Sprintf("%s/api/v1/accounts/%s%s", c.baseURL, c.accountID, path)
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("api_access_token", c.token)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("chatwoot %s %s returned %d: %s", method, path, resp.StatusCode, strings.TrimSpace(string(detail)))
+	}
+	if out != nil {
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+	return nil
+}
+
+// chatwootWebhook is the subset of Chatwoot's message_created webhook used
+// to relay agent replies.
+type chatwootWebhook struct {
+	Event             string                 `json:"event"`
+	MessageType       string                 `json:"message_type"`
+	Private           bool                   `json:"private"`
+	Content           string                 `json:"content"`
+	ContentAttributes map[string]interface{} `json:"content_attributes"`
+	Conversation      struct {
+		ID int `json:"id"`
+	} `json:"conversation"`
+	Sender struct {
+		Name string `json:"name"`
+	} `json:"sender"`
+}
+
+// handleChatwootWebhook serves POST /chatwoot/webhook, sending public
+// outgoing messages written by agents to the conversation's WhatsApp chat.
+func (b *WhatsAppBridge) handleChatwootWebhook(w http.ResponseWriter, r *http.Request) {
+	c := b.chatwoot
+	if c == nil {
+		writeJSON(w, http.StatusNotFound, Response{Success: false, Error: "chatwoot integration is disabled"})
+		return
+	}
+	if c.webhookToken == "" || subtle.ConstantTimeCompare([]byte(r.URL.Query().Get("token")), []byte(c.webhookToken)) != 1 {
+		writeJSON(w, http.StatusUnauthorized, Response{Success: false, Error: "invalid webhook token"})
+		return
+	}
+
+	var hook chatwootWebhook
+	if err := json.NewDecoder(r.Body).Decode(&hook); err != nil {
+		writeJSON(w, http.StatusBadRequest, Response{Success: false, Error: err.Error()})
+		return
+	}
+	if hook.Event != "message_created" || hook.MessageType != "outgoing" || hook.Private ||
+		hook.ContentAttributes["whatsapp_bridge"] == true || hook.Content == "" {
+		writeJSON(w, http.StatusOK, Response{Success: true, Data: map[string]string{"status": "ignored"}})
+		return
+	}
+
+	chat, err := b.redisClient.Get(r.Context(), chatwootChatKey(hook.Conversation.ID)).Result()
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, Response{Success: false, Error: "unknown conversation"})
+		return
+	}
+	jid, err := types.ParseJID(chat)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+
+	ctx := withOperator(context.WithoutCancel(r.Context()), chatwootOperatorPrefix+hook.Sender.Name)
+	resp, err := b.sendOutgoing(ctx, OutgoingMessage{Phone: jid.User, Server: jid.Server, Message: hook.Content})
+	if err != nil {
+		writeJSON(w, http.StatusBadGateway, Response{Success: false, Error: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, Response{Success: true, Data: map[string]string{"message_id": resp.ID}})
+}
@@ -0,0 +1,69 @@
+package bridge
+
+import (
+	"context"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/appstate"
+	waBinary "go.mau.fi/whatsmeow/binary"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/store"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// Client is the subset of *whatsmeow.Client the bridge depends on, so tests
+// and embedders can substitute a fake (see the bridgetest package).
+type Client interface {
+	AddEventHandler(handler whatsmeow.EventHandler) uint32
+	Connect() error
+	Disconnect()
+	IsConnected() bool
+	GetQRChannel(ctx context.Context) (<-chan whatsmeow.QRChannelItem, error)
+	PairPhone(ctx context.Context, phone string, showPushNotification bool, clientType whatsmeow.PairClientType, clientDisplayName string) (string, error)
+
+	GenerateMessageID() types.MessageID
+	SendMessage(ctx context.Context, to types.JID, message *waE2E.Message, extra ...whatsmeow.SendRequestExtra) (whatsmeow.SendResponse, error)
+	Upload(ctx context.Context, plaintext []byte, appInfo whatsmeow.MediaType) (whatsmeow.UploadResponse, error)
+	Download(ctx context.Context, msg whatsmeow.DownloadableMessage) ([]byte, error)
+	GetGroupInfo(ctx context.Context, jid types.JID) (*types.GroupInfo, error)
+	GetJoinedGroups(ctx context.Context) ([]*types.GroupInfo, error)
+	FetchAppState(ctx context.Context, name appstate.WAPatchName, fullSync, onlyIfNotSynced bool) error
+	SendAppState(ctx context.Context, patch appstate.PatchInfo) error
+	IsOnWhatsApp(ctx context.Context, phones []string) ([]types.IsOnWhatsAppResponse, error)
+	GetUserDevices(ctx context.Context, jids []types.JID) ([]types.JID, error)
+	GetBusinessProfile(ctx context.Context, jid types.JID) (*BusinessInfo, error)
+	SendChatPresence(ctx context.Context, jid types.JID, state types.ChatPresence, media types.ChatPresenceMedia) error
+
+	BuildEdit(chat types.JID, id types.MessageID, newContent *waE2E.Message) *waE2E.Message
+	BuildReaction(chat, sender types.JID, id types.MessageID, reaction string) *waE2E.Message
+	BuildPollCreation(name string, optionNames []string, selectableOptionCount int) *waE2E.Message
+	DecryptPollVote(ctx context.Context, vote *events.Message) (*waE2E.PollVoteMessage, error)
+
+	// Device returns the session store: own JID, LID mappings.
+	Device() *store.Device
+}
+
+// whatsmeowClient adapts *whatsmeow.Client, whose store is a field, to Client.
+type whatsmeowClient struct {
+	*whatsmeow.Client
+}
+
+func (c whatsmeowClient) Device() *store.Device {
+	return c.Store
+}
+
+// GetBusinessProfile sends whatsmeow's business profile query itself, as
+// whatsmeow's parser drops the description and websites.
+func (c whatsmeowClient) GetBusinessProfile(ctx context.Context, jid types.JID) (*BusinessInfo, error) {
+	resp, err := c.DangerousInternals().SendIQ(ctx, whatsmeow.DangerousInfoQuery{
+		Namespace: "w:biz",
+		Type:      "get",
+		To:        types.ServerJID,
+		Content:   []waBinary.Node{businessProfileQuery(jid)},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return parseBusinessProfile(resp)
+}
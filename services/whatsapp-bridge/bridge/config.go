@@ -0,0 +1,90 @@
+package bridge
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// envString returns the value of an environment variable or def when unset.
+func envString(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// envBool parses a boolean environment variable ("1", "true", "yes", "on").
+func envBool(key string, def bool) bool {
+	v := strings.ToLower(strings.TrimSpace(os.Getenv(key)))
+	switch v {
+	case "":
+		return def
+	case "1", "true", "yes", "on":
+		return true
+	case "0", "false", "no", "off":
+		return false
+	}
+	log.Printf("⚠️ Invalid boolean for %s: %q, using default %v", key, v, def)
+	return def
+}
+
+// envInt parses an integer environment variable.
+func envInt(key string, def int) int {
+	v := strings.TrimSpace(os.Getenv(key))
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		log.Printf("⚠️ Invalid integer for %s: %q, using default %d", key, v, def)
+		return def
+	}
+	return n
+}
+
+// envFloat parses a floating point environment variable.
+func envFloat(key string, def float64) float64 {
+	v := strings.TrimSpace(os.Getenv(key))
+	if v == "" {
+		return def
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		log.Printf("⚠️ Invalid number for %s: %q, using default %v", key, v, def)
+		return def
+	}
+	return f
+}
+
+// envDuration parses a Go duration environment variable (e.g. "30s", "5m").
+func envDuration(key string, def time.Duration) time.Duration {
+	v := strings.TrimSpace(os.Getenv(key))
+	if v == "" {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		log.Printf("⚠️ Invalid duration for %s: %q, using default %s", key, v, def)
+		return def
+	}
+	return d
+}
+
+// envList splits a comma-separated environment variable, dropping empty items.
+func envList(key string) []string {
+	return splitList(os.Getenv(key))
+}
+
+// splitList splits a comma-separated list, dropping empty items.
+func splitList(s string) []string {
+	var out []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
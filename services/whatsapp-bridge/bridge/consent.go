@@ -0,0 +1,381 @@
+package bridge
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// EventConsentChanged is published whenever a contact's consent is recorded.
+const EventConsentChanged = "consent_changed"
+
+// Consent statuses; contacts without a record have none.
+const (
+	ConsentGranted = "granted"
+	ConsentRevoked = "revoked"
+)
+
+// Consent sources.
+const (
+	ConsentSourceKeyword = "keyword" // the contact sent an opt-in/out keyword
+	ConsentSourceImport  = "import"  // bulk import of consent gathered elsewhere
+	ConsentSourceAPI     = "api"     // set by an operator through the API
+)
+
+// Consent is a contact's current consent, also carried by consent_changed
+// events and (as its status) by message payloads.
+type Consent struct {
+	ContactID  string `json:"contact_id"`
+	Status     string `json:"status"`
+	Source     string `json:"source"`
+	Keyword    string `json:"keyword,omitempty"`
+	Evidence   string `json:"evidence,omitempty"` // message ID, form URL, import batch...
+	ObtainedAt int64  `json:"obtained_at"`
+	UpdatedAt  int64  `json:"updated_at,omitempty"`
+	UpdatedBy  string `json:"updated_by,omitempty"`
+}
+
+// SetConsent records consent for a contact and appends it to the audit log.
+func (a *Archive) SetConsent(c Consent) error {
+	if a == nil {
+		return fmt.Errorf("archive is disabled")
+	}
+	tx, err := a.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`INSERT INTO contact_consent
+		(contact_id, status, source, keyword, evidence, obtained_at, updated_at, updated_by)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (contact_id) DO UPDATE SET status = excluded.status, source = excluded.source,
+			keyword = excluded.keyword, evidence = excluded.evidence, obtained_at = excluded.obtained_at,
+			updated_at = excluded.updated_at, updated_by = excluded.updated_by`,
+		c.ContactID, c.Status, c.Source, c.Keyword, c.Evidence, c.ObtainedAt, c.UpdatedAt, c.UpdatedBy)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`INSERT INTO contact_consent_log
+		(contact_id, status, source, keyword, evidence, obtained_at, updated_by, logged_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		c.ContactID, c.Status, c.Source, c.Keyword, c.Evidence, c.ObtainedAt, c.UpdatedBy, c.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetConsent returns a contact's consent, or nil when none is recorded.
+func (a *Archive) GetConsent(contactID string) (*Consent, error) {
+	if a == nil || contactID == "" {
+		return nil, nil
+	}
+	c := Consent{ContactID: contactID}
+	err := a.db.QueryRow(`SELECT status, source, keyword, evidence, obtained_at, updated_at, updated_by
+		FROM contact_consent WHERE contact_id = ?`, contactID).
+		Scan(&c.Status, &c.Source, &c.Keyword, &c.Evidence, &c.ObtainedAt, &c.UpdatedAt, &c.UpdatedBy)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// ConsentHistory lists a contact's consent changes, oldest first.
+func (a *Archive) ConsentHistory(contactID string) ([]Consent, error) {
+	if a == nil {
+		return nil, fmt.Errorf("archive is disabled")
+	}
+	rows, err := a.db.Query(`SELECT status, source, keyword, evidence, obtained_at, logged_at, updated_by
+		FROM contact_consent_log WHERE contact_id = ? ORDER BY logged_at, rowid`, contactID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []Consent
+	for rows.Next() {
+		c := Consent{ContactID: contactID}
+		if err := rows.Scan(&c.Status, &c.Source, &c.Keyword, &c.Evidence, &c.ObtainedAt, &c.UpdatedAt, &c.UpdatedBy); err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+// LastInbound returns the time of the latest message received in chat, or
+// zero when there is none.
+func (a *Archive) LastInbound(chat string) int64 {
+	if a == nil {
+		return 0
+	}
+	var ts sql.NullInt64
+	a.db.QueryRow(`SELECT MAX(timestamp) FROM messages WHERE chat = ? AND direction = ?`,
+		chat, DirectionInbound).Scan(&ts)
+	return ts.Int64
+}
+
+// ConsentPolicy captures opt-in/out keywords and, with CONSENT_REQUIRED,
+// blocks proactive sends to contacts that have not granted consent. A send
+// is proactive unless the contact wrote within CONSENT_SESSION_WINDOW
+// (default 24h, WhatsApp's customer service window); consent_override on
+// the request lifts the block and is audited through the operator. Groups,
+// broadcasts and newsletters are not checked.
+//
+//	CONSENT_OPT_IN_KEYWORDS   - default START,SUBSCRIBE
+//	CONSENT_OPT_OUT_KEYWORDS  - default STOP,UNSUBSCRIBE
+//	CONSENT_OPT_IN_REPLY      - optional confirmation sent on opt-in
+//	CONSENT_OPT_OUT_REPLY     - optional confirmation sent on opt-out
+type ConsentPolicy struct {
+	required      bool
+	sessionWindow time.Duration
+	optIn         []string
+	optOut        []string
+	optInReply    string
+	optOutReply   string
+}
+
+func consentPolicyFromEnv() *ConsentPolicy {
+	p := &ConsentPolicy{
+		required:      envBool("CONSENT_REQUIRED", false),
+		sessionWindow: envDuration("CONSENT_SESSION_WINDOW", 24*time.Hour),
+		optIn:         envList("CONSENT_OPT_IN_KEYWORDS"),
+		optOut:        envList("CONSENT_OPT_OUT_KEYWORDS"),
+		optInReply:    envString("CONSENT_OPT_IN_REPLY", ""),
+		optOutReply:   envString("CONSENT_OPT_OUT_REPLY", ""),
+	}
+	if len(p.optIn) == 0 {
+		p.optIn = []string{"START", "SUBSCRIBE"}
+	}
+	if len(p.optOut) == 0 {
+		p.optOut = []string{"STOP", "UNSUBSCRIBE"}
+	}
+	return p
+}
+
+// keyword maps a message to the consent status its keyword requests.
+func (p *ConsentPolicy) keyword(text string) (status, keyword string) {
+	text = strings.TrimSpace(text)
+	for _, k := range p.optOut {
+		if strings.EqualFold(text, k) {
+			return ConsentRevoked, strings.ToUpper(k)
+		}
+	}
+	for _, k := range p.optIn {
+		if strings.EqualFold(text, k) {
+			return ConsentGranted, strings.ToUpper(k)
+		}
+	}
+	return "", ""
+}
+
+// errNoConsent blocks proactive sends to contacts without consent.
+var errNoConsent = fmt.Errorf("%w: recipient has not granted consent", errPermanent)
+
+// recordConsent stores consent and announces the change.
+func (b *WhatsAppBridge) recordConsent(c Consent) error {
+	now := time.Now()
+	c.UpdatedAt = now.Unix()
+	if c.ObtainedAt == 0 {
+		c.ObtainedAt = c.UpdatedAt
+	}
+	if err := b.archiveDB.SetConsent(c); err != nil {
+		return err
+	}
+	log.Printf("📝 Consent %s for contact %s (%s)", c.Status, c.ContactID, c.Source)
+	b.publish(EventConsentChanged, "", c)
+	return nil
+}
+
+// handleConsentKeyword records consent when a 1:1 text is an opt-in/out
+// keyword and returns the contact's current status for the payload.
+func (b *WhatsAppBridge) handleConsentKeyword(chat types.JID, msg IncomingMessage) string {
+	if msg.ContactID == "" {
+		return ""
+	}
+	if !msg.IsGroup && msg.Type == "text" {
+		if status, keyword := b.consent.keyword(msg.Content); status != "" {
+			err := b.recordConsent(Consent{
+				ContactID: msg.ContactID,
+				Status:    status,
+				Source:    ConsentSourceKeyword,
+				Keyword:   keyword,
+				Evidence:  msg.MessageID,
+				UpdatedBy: "contact",
+			})
+			if err != nil {
+				log.Printf("Error recording consent for %s: %v", msg.ContactID, err)
+			} else {
+				b.confirmConsent(chat, status)
+			}
+			return status
+		}
+	}
+	consent, err := b.archiveDB.GetConsent(msg.ContactID)
+	if err != nil || consent == nil {
+		return ""
+	}
+	return consent.Status
+}
+
+func (b *WhatsAppBridge) confirmConsent(chat types.JID, status string) {
+	reply := b.consent.optInReply
+	if status == ConsentRevoked {
+		reply = b.consent.optOutReply
+	}
+	if reply == "" {
+		return
+	}
+	go func() {
+		ctx := withOperator(b.ctx, "system:consent")
+		// The contact asked for it, so even an opt-out is acknowledged.
+		msg := OutgoingMessage{Phone: chat.User, Server: chat.Server, Message: reply, Raw: true, ConsentOverride: true}
+		if _, err := b.sendOutgoing(ctx, msg); err != nil {
+			log.Printf("Error confirming consent change to %s: %v", chat, err)
+		}
+	}()
+}
+
+// checkConsent enforces CONSENT_REQUIRED for a send to chat.
+func (b *WhatsAppBridge) checkConsent(chat types.JID, override bool) error {
+	if !b.consent.required || override {
+		return nil
+	}
+	if chat.Server != types.DefaultUserServer && chat.Server != types.HiddenUserServer {
+		return nil
+	}
+	consent, err := b.archiveDB.GetConsent(b.contactForChat(chat.String()))
+	if err != nil {
+		return fmt.Errorf("checking consent: %v", err)
+	}
+	if consent != nil && consent.Status == ConsentGranted {
+		return nil
+	}
+	if consent == nil || consent.Status != ConsentRevoked {
+		// Replies inside the contact's session are not proactive.
+		last := b.archiveDB.LastInbound(chat.String())
+		if last > 0 && time.Since(time.Unix(last, 0)) < b.consent.sessionWindow {
+			return nil
+		}
+	}
+	return errNoConsent
+}
+
+// ConsentRequest is the body of PUT /contacts/{id}/consent and one entry of
+// POST /contacts/consent/import (which identifies contacts by phone).
+type ConsentRequest struct {
+	Phone      string `json:"phone,omitempty"`
+	Status     string `json:"status"`
+	Keyword    string `json:"keyword,omitempty"`
+	Evidence   string `json:"evidence,omitempty"`
+	ObtainedAt int64  `json:"obtained_at,omitempty"`
+}
+
+func (req ConsentRequest) validate() error {
+	if req.Status != ConsentGranted && req.Status != ConsentRevoked {
+		return fmt.Errorf("status must be %q or %q", ConsentGranted, ConsentRevoked)
+	}
+	return nil
+}
+
+// contactIDFor resolves a contact ID, phone or JID, creating the contact for
+// phones and JIDs never seen before.
+func (b *WhatsAppBridge) contactIDFor(id string) (string, error) {
+	if strings.HasPrefix(id, "c_") {
+		return id, nil
+	}
+	jid, err := resolveRecipient(id, "", "")
+	if err != nil {
+		return "", err
+	}
+	if contactID := b.contactForChat(jid.String()); contactID != "" {
+		return contactID, nil
+	}
+	return "", fmt.Errorf("%s is not a user", id)
+}
+
+// handlePutConsent serves PUT /contacts/{id}/consent.
+func (b *WhatsAppBridge) handlePutConsent(w http.ResponseWriter, r *http.Request) {
+	var req ConsentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, Response{Success: false, Error: err.Error()})
+		return
+	}
+	if err := req.validate(); err != nil {
+		writeJSON(w, http.StatusBadRequest, Response{Success: false, Error: err.Error()})
+		return
+	}
+	contactID, err := b.contactIDFor(mux.Vars(r)["id"])
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, Response{Success: false, Error: err.Error()})
+		return
+	}
+
+	consent := Consent{
+		ContactID:  contactID,
+		Status:     req.Status,
+		Source:     ConsentSourceAPI,
+		Keyword:    req.Keyword,
+		Evidence:   req.Evidence,
+		ObtainedAt: req.ObtainedAt,
+		UpdatedBy:  operatorFromContext(r.Context()),
+	}
+	if err := b.recordConsent(consent); err != nil {
+		writeJSON(w, http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	current, _ := b.archiveDB.GetConsent(contactID)
+	writeJSON(w, http.StatusOK, Response{Success: true, Data: current})
+}
+
+// handleImportConsent serves POST /contacts/consent/import with a JSON array
+// of ConsentRequest entries, reporting the entries it could not import.
+func (b *WhatsAppBridge) handleImportConsent(w http.ResponseWriter, r *http.Request) {
+	var entries []ConsentRequest
+	if err := json.NewDecoder(r.Body).Decode(&entries); err != nil {
+		writeJSON(w, http.StatusBadRequest, Response{Success: false, Error: err.Error()})
+		return
+	}
+
+	operator := operatorFromContext(r.Context())
+	imported := 0
+	failures := []map[string]string{}
+	for _, entry := range entries {
+		err := entry.validate()
+		var contactID string
+		if err == nil {
+			contactID, err = b.contactIDFor(entry.Phone)
+		}
+		if err == nil {
+			err = b.recordConsent(Consent{
+				ContactID:  contactID,
+				Status:     entry.Status,
+				Source:     ConsentSourceImport,
+				Keyword:    entry.Keyword,
+				Evidence:   entry.Evidence,
+				ObtainedAt: entry.ObtainedAt,
+				UpdatedBy:  operator,
+			})
+		}
+		if err != nil {
+			failures = append(failures, map[string]string{"phone": entry.Phone, "error": err.Error()})
+			continue
+		}
+		imported++
+	}
+	writeJSON(w, http.StatusOK, Response{Success: true, Data: map[string]interface{}{
+		"imported": imported,
+		"failed":   failures,
+	}})
+}
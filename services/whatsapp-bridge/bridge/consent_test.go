@@ -0,0 +1,36 @@
+package bridge_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/phenobarbital/ai-parrot/whatsapp-bridge/bridge"
+	"github.com/phenobarbital/ai-parrot/whatsapp-bridge/bridgetest"
+)
+
+func TestConsentKeywords(t *testing.T) {
+	h := bridgetest.New(t, bridgetest.WithEnv("CONSENT_REQUIRED", "true"))
+	msg := bridge.OutgoingMessage{Phone: "5215512345678", Message: "Our new menu is out"}
+
+	if status, _ := h.Do(http.MethodPost, "/send", msg); status != http.StatusForbidden {
+		t.Fatalf("proactive send without consent answered %d, want 403", status)
+	}
+
+	h.ReceiveText("5215512345678", " start ")
+	var consent bridge.Consent
+	h.DecodePayload(h.ExpectEvent(bridge.EventConsentChanged), &consent)
+	if consent.Status != bridge.ConsentGranted || consent.Source != bridge.ConsentSourceKeyword || consent.Keyword != "START" {
+		t.Errorf("opt-in recorded %+v", consent)
+	}
+	h.Send(msg)
+
+	h.ReceiveText("5215512345678", "STOP")
+	h.DecodePayload(h.ExpectEvent(bridge.EventConsentChanged), &consent)
+	if consent.Status != bridge.ConsentRevoked {
+		t.Errorf("opt-out recorded %+v", consent)
+	}
+	// The contact just wrote, but an opt-out outranks the session window.
+	if status, _ := h.Do(http.MethodPost, "/send", msg); status != http.StatusForbidden {
+		t.Errorf("send after opting out answered %d, want 403", status)
+	}
+}
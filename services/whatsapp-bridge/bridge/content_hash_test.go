@@ -0,0 +1,38 @@
+package bridge_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/phenobarbital/ai-parrot/whatsapp-bridge/bridge"
+	"github.com/phenobarbital/ai-parrot/whatsapp-bridge/bridgetest"
+)
+
+func TestSendContentHashMatchesArchive(t *testing.T) {
+	h := bridgetest.New(t)
+	if status, resp := h.Do(http.MethodPut, "/admin/templates/welcome", bridge.MessageTemplate{
+		Body: "Hi {{.name}}, welcome!",
+	}); status != http.StatusOK {
+		t.Fatalf("PUT /admin/templates/welcome = %d %s", status, resp.Error)
+	}
+
+	for _, msg := range []bridge.OutgoingMessage{
+		{Phone: "5215512345678", Message: "Hola"},
+		{Phone: "5215512345678", Template: "welcome", Params: map[string]interface{}{"name": "Ana"}},
+		{Phone: "5215512345678", Message: "**bold** move"},
+	} {
+		data, _ := h.Send(msg).Data.(map[string]any)
+		_, resp := h.Do(http.MethodGet, "/archive/messages?chat=5215512345678@s.whatsapp.net&direction=out", nil)
+		var archived []bridge.ArchivedMessage
+		decodeData(t, resp.Data, &archived)
+		var hash string
+		for _, m := range archived {
+			if m.MessageID == data["message_id"] {
+				hash = m.ContentHash
+			}
+		}
+		if hash == "" || data["content_hash"] != hash {
+			t.Errorf("%+v: content_hash %v, archived %q", msg, data["content_hash"], hash)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package bridge
+
+import (
+	"database/sql"
+	"log"
+	"strings"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// ConversationState is derived from the archive and attached to inbound
+// payloads so agents can prioritize the chats waiting longest.
+type ConversationState struct {
+	UnansweredCount    int   `json:"unanswered_count"` // inbound messages since our last reply, this one included
+	AwaitingReply      bool  `json:"awaiting_reply"`
+	WaitingSince       int64 `json:"waiting_since,omitempty"` // oldest unanswered inbound message
+	LastBotReplyAt     int64 `json:"last_bot_reply_at,omitempty"`
+	LastBotReplyReadAt int64 `json:"last_bot_reply_read_at,omitempty"` // from read receipts; 0 if unread
+}
+
+// ConversationState computes the state of chat, or nil when the archive is
+// disabled.
+func (a *Archive) ConversationState(chat string) (*ConversationState, error) {
+	if a == nil {
+		return nil, nil
+	}
+	var state ConversationState
+	var lastReplyID int64
+	err := a.db.QueryRow(`SELECT id, timestamp, read_at FROM messages
+		WHERE chat = ? AND direction = ? ORDER BY id DESC LIMIT 1`, chat, DirectionOutbound).
+		Scan(&lastReplyID, &state.LastBotReplyAt, &state.LastBotReplyReadAt)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	var waitingSince sql.NullInt64
+	err = a.db.QueryRow(`SELECT COUNT(*), MIN(timestamp) FROM messages
+		WHERE chat = ? AND direction = ? AND id > ?`, chat, DirectionInbound, lastReplyID).
+		Scan(&state.UnansweredCount, &waitingSince)
+	if err != nil {
+		return nil, err
+	}
+	state.WaitingSince = waitingSince.Int64
+	state.AwaitingReply = state.UnansweredCount > 0
+	return &state, nil
+}
+
+// MarkRead records when outbound messages were read by their recipient.
+// Only the first read counts.
+func (a *Archive) MarkRead(ids []types.MessageID, readAt int64) error {
+	if a == nil || len(ids) == 0 {
+		return nil
+	}
+	args := make([]interface{}, 0, len(ids)+2)
+	args = append(args, readAt, DirectionOutbound)
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ")
+	_, err := a.db.Exec(`UPDATE messages SET read_at = ?
+		WHERE direction = ? AND read_at = 0 AND message_id IN (`+placeholders+`)`, args...)
+	if err != nil {
+		return err
+	}
+	_, err = a.db.Exec(`UPDATE chat_summaries SET last_read_at = MAX(last_read_at, ?)
+		WHERE chat IN (SELECT chat FROM messages WHERE direction = ? AND message_id IN (`+placeholders+`))`, args...)
+	return err
+}
+
+// recordRead stores read receipts for our messages in the archive.
+func (b *WhatsAppBridge) recordRead(receipt *events.Receipt) {
+	if receipt.IsFromMe {
+		return
+	}
+	if receipt.Type != types.ReceiptTypeRead && receipt.Type != types.ReceiptTypePlayed {
+		return
+	}
+	readAt := receipt.Timestamp
+	if readAt.IsZero() {
+		readAt = time.Now()
+	}
+	if err := b.archiveDB.MarkRead(receipt.MessageIDs, readAt.Unix()); err != nil {
+		log.Printf("Error recording read receipt from %s: %v", receipt.Chat, err)
+	}
+}
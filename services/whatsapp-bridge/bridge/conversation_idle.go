@@ -0,0 +1,185 @@
+package bridge
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// EventConversationIdle is published when a chat has had no messages, in
+// either direction, for CONVERSATION_IDLE_AFTER since its last one, so the
+// agent can summarize the session and persist long-term memory. The next
+// message starts a new session.
+const EventConversationIdle = "conversation_idle"
+
+// conversationsActiveKey scores every chat with an open session by the
+// Unix time of its last message.
+const conversationsActiveKey = "whatsapp:conversations:active"
+
+// conversationKey holds a session's counters; conversationIDsKey the IDs
+// of its latest messages.
+func conversationKey(chat string) string    { return "whatsapp:conversation:" + chat }
+func conversationIDsKey(chat string) string { return "whatsapp:conversation:" + chat + ":ids" }
+
+// maxSessionIDs caps the message IDs kept per session.
+const maxSessionIDs = 500
+
+// ConversationIdle is the payload of conversation_idle events.
+type ConversationIdle struct {
+	Chat           string   `json:"chat"`
+	ContactID      string   `json:"contact_id,omitempty"`
+	StartedAt      int64    `json:"started_at"`
+	LastActivityAt int64    `json:"last_activity_at"`
+	IdleSeconds    int64    `json:"idle_seconds"`
+	MessageCount   int      `json:"message_count"`
+	InboundCount   int      `json:"inbound_count"`
+	OutboundCount  int      `json:"outbound_count"`
+	MessageIDs     []string `json:"message_ids"`                     // oldest first
+	Truncated      bool     `json:"message_ids_truncated,omitempty"` // only the latest 500 are listed
+	Timestamp      int64    `json:"timestamp"`
+}
+
+// IdleWatcher tracks conversation sessions and publishes
+// conversation_idle events. Sessions live in Redis, so every replica sees
+// them and each idle session is announced once.
+//
+//	CONVERSATION_IDLE_AFTER - inactivity that ends a session (default 0, disabled)
+//	CONVERSATION_IDLE_CHECK - how often sessions are checked (default 1m)
+type IdleWatcher struct {
+	After    time.Duration
+	Interval time.Duration
+
+	bridge *WhatsAppBridge
+}
+
+// idleWatcherFromEnv returns nil unless CONVERSATION_IDLE_AFTER is set.
+func (b *WhatsAppBridge) idleWatcherFromEnv() *IdleWatcher {
+	after := envDuration("CONVERSATION_IDLE_AFTER", 0)
+	if after <= 0 {
+		return nil
+	}
+	return &IdleWatcher{
+		After:    after,
+		Interval: min(envDuration("CONVERSATION_IDLE_CHECK", time.Minute), after),
+		bridge:   b,
+	}
+}
+
+// Touch records a message in chat's session.
+func (w *IdleWatcher) Touch(ctx context.Context, m ArchivedMessage) {
+	if w == nil {
+		return
+	}
+	key, ids := conversationKey(m.Chat), conversationIDsKey(m.Chat)
+	ttl := 2*w.After + 24*time.Hour // outlives the session if the watcher stops
+	pipe := w.bridge.redisClient.TxPipeline()
+	// GT: a late message (a history sync, a slow worker) must not make the
+	// chat look idle sooner.
+	pipe.ZAddArgs(ctx, conversationsActiveKey, redis.ZAddArgs{
+		GT:      true,
+		Members: []redis.Z{{Score: float64(m.Timestamp), Member: m.Chat}},
+	})
+	pipe.HSetNX(ctx, key, "started_at", m.Timestamp)
+	pipe.HIncrBy(ctx, key, "messages", 1)
+	pipe.HIncrBy(ctx, key, m.Direction, 1)
+	if m.ContactID != "" {
+		pipe.HSet(ctx, key, "contact_id", m.ContactID)
+	}
+	pipe.RPush(ctx, ids, m.MessageID)
+	pipe.LTrim(ctx, ids, -maxSessionIDs, -1)
+	pipe.Expire(ctx, key, ttl)
+	pipe.Expire(ctx, ids, ttl)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("Error tracking the conversation of %s: %v", m.Chat, err)
+	}
+}
+
+// Run checks for idle sessions every Interval until ctx is done.
+func (w *IdleWatcher) Run(ctx context.Context) {
+	if w == nil {
+		return
+	}
+	log.Printf("💤 Conversations go idle after %s", w.After)
+	ticker := time.NewTicker(w.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.Check(ctx)
+		}
+	}
+}
+
+// closeIdleSession ends a session whose last message is not newer than
+// ARGV[2], returning its counters and message IDs, or false when the chat
+// was active since or another replica closed it first.
+var closeIdleSession = redis.NewScript(`
+local score = redis.call('ZSCORE', KEYS[1], ARGV[1])
+if not score or tonumber(score) > tonumber(ARGV[2]) then return false end
+redis.call('ZREM', KEYS[1], ARGV[1])
+local session = redis.call('HGETALL', KEYS[2])
+local ids = redis.call('LRANGE', KEYS[3], 0, -1)
+redis.call('DEL', KEYS[2], KEYS[3])
+return {score, session, ids}
+`)
+
+// Check publishes an event for every session idle for After.
+func (w *IdleWatcher) Check(ctx context.Context) {
+	now := time.Now()
+	cutoff := strconv.FormatInt(now.Add(-w.After).Unix(), 10)
+	chats, err := w.bridge.redisClient.ZRangeByScore(ctx, conversationsActiveKey, &redis.ZRangeBy{
+		Min: "-inf", Max: cutoff,
+	}).Result()
+	if err != nil {
+		log.Printf("Error listing idle conversations: %v", err)
+		return
+	}
+	for _, chat := range chats {
+		res, err := closeIdleSession.Run(ctx, w.bridge.redisClient,
+			[]string{conversationsActiveKey, conversationKey(chat), conversationIDsKey(chat)}, chat, cutoff).Result()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			log.Printf("Error closing the conversation of %s: %v", chat, err)
+			continue
+		}
+		evt := idleEvent(chat, res.([]interface{}), now)
+		log.Printf("💤 Conversation %s idle after %d messages", chat, evt.MessageCount)
+		w.bridge.publish(EventConversationIdle, chat, evt)
+	}
+}
+
+// idleEvent builds the event from closeIdleSession's result.
+func idleEvent(chat string, res []interface{}, now time.Time) ConversationIdle {
+	evt := ConversationIdle{Chat: chat, MessageIDs: []string{}, Timestamp: now.Unix()}
+	evt.LastActivityAt, _ = strconv.ParseInt(res[0].(string), 10, 64)
+	evt.IdleSeconds = now.Unix() - evt.LastActivityAt
+	fields := res[1].([]interface{})
+	for i := 0; i+1 < len(fields); i += 2 {
+		value := fields[i+1].(string)
+		n, _ := strconv.Atoi(value)
+		switch fields[i].(string) {
+		case "started_at":
+			evt.StartedAt = int64(n)
+		case "messages":
+			evt.MessageCount = n
+		case DirectionInbound:
+			evt.InboundCount = n
+		case DirectionOutbound:
+			evt.OutboundCount = n
+		case "contact_id":
+			evt.ContactID = value
+		}
+	}
+	for _, id := range res[2].([]interface{}) {
+		evt.MessageIDs = append(evt.MessageIDs, id.(string))
+	}
+	evt.Truncated = evt.MessageCount > len(evt.MessageIDs)
+	return evt
+}
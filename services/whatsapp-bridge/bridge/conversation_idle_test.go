@@ -0,0 +1,39 @@
+package bridge_test
+
+import (
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/phenobarbital/ai-parrot/whatsapp-bridge/bridgetest"
+)
+
+func TestLateMessageKeepsSessionActive(t *testing.T) {
+	h := bridgetest.New(t, bridgetest.WithEnv("CONVERSATION_IDLE_AFTER", "1h"))
+	jid := types.NewJID("5215512345678", types.DefaultUserServer)
+	receiveAt := func(id string, at time.Time) {
+		h.Emit(&events.Message{
+			Info: types.MessageInfo{
+				MessageSource: types.MessageSource{Chat: jid, Sender: jid},
+				ID:            id,
+				Timestamp:     at,
+			},
+			Message: &waE2E.Message{Conversation: proto.String("hola")},
+		})
+	}
+	now := time.Now().Truncate(time.Second)
+	receiveAt("LATEST", now)
+	receiveAt("EARLIER", now.Add(-30*time.Minute))
+
+	score, err := h.Redis.ZScore("whatsapp:conversations:active", jid.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int64(score) != now.Unix() {
+		t.Fatalf("last activity = %d, want %d", int64(score), now.Unix())
+	}
+}
@@ -0,0 +1,212 @@
+package bridge
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+// Country policies apply per destination market: profiles in
+// COUNTRY_POLICIES (inline JSON) or COUNTRY_POLICIES_CONFIG (a JSON file)
+// match recipients by the calling code of their phone number, the longest
+// code winning, e.g.
+//
+//	[
+//	  {"name": "india", "country_codes": ["91"], "per_minute": 10, "burst": 2,
+//	   "allowed_hours": {"start": "09:00", "end": "21:00"}, "require_template": true},
+//	  {"name": "latam", "country_codes": ["52", "54", "55", "57"], "per_minute": 30}
+//	]
+//
+// per_minute and burst cap the sends to all of the profile's countries
+// together, on top of the pacer's limits. allowed_hours limits sends to
+// local hours, in the window's timezone or else the one of the recipient's
+// country; sends outside them are rejected as rate limited until the window
+// opens. require_template only lets templated messages through. Replies to
+// a contact who wrote within session_window (default 24h, WhatsApp's
+// customer service window) are exempt from allowed_hours and
+// require_template. Groups and LID-only chats, whose country is unknown,
+// are not checked.
+type CountryProfile struct {
+	Name            string      `json:"name"`
+	CountryCodes    []string    `json:"country_codes"`
+	PerMinute       int         `json:"per_minute,omitempty"`
+	Burst           int         `json:"burst,omitempty"`
+	AllowedHours    *SendWindow `json:"allowed_hours,omitempty"`
+	RequireTemplate bool        `json:"require_template,omitempty"`
+	SessionWindow   string      `json:"session_window,omitempty"`
+
+	window        *sendWindow
+	sessionWindow time.Duration
+}
+
+// errTemplateRequired rejects free-form proactive sends to countries whose
+// profile requires templates.
+var errTemplateRequired = fmt.Errorf("%w: the recipient's country policy requires a template", errPermanent)
+
+// CountryPolicies holds the profiles and the rate of each. A nil
+// CountryPolicies checks nothing.
+type CountryPolicies struct {
+	Profiles []*CountryProfile
+
+	maxWait time.Duration // RATE_LIMIT_MAX_WAIT, capped as for the pacer
+	byCode  map[string]*CountryProfile
+	mu      sync.Mutex
+	rates   map[string]*tokenBucket // by profile name
+}
+
+// countryPoliciesFromEnv returns nil when no profile is configured.
+func countryPoliciesFromEnv() (*CountryPolicies, error) {
+	raw := []byte(envString("COUNTRY_POLICIES", ""))
+	if file := envString("COUNTRY_POLICIES_CONFIG", ""); file != "" && len(raw) == 0 {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read COUNTRY_POLICIES_CONFIG: %v", err)
+		}
+		raw = data
+	}
+	if len(raw) == 0 {
+		return nil, nil
+	}
+
+	var profiles []*CountryProfile
+	if err := json.Unmarshal(raw, &profiles); err != nil {
+		return nil, fmt.Errorf("invalid country policies: %v", err)
+	}
+	p := &CountryPolicies{
+		Profiles: profiles,
+		maxWait:  rateLimitMaxWait(0),
+		byCode:   make(map[string]*CountryProfile),
+		rates:    make(map[string]*tokenBucket),
+	}
+	for i, profile := range profiles {
+		if profile.Name == "" {
+			profile.Name = fmt.Sprintf("profile-%d", i+1)
+		}
+		if len(profile.CountryCodes) == 0 {
+			return nil, fmt.Errorf("country policy %s: country_codes is required", profile.Name)
+		}
+		for _, code := range profile.CountryCodes {
+			if code == "" || len(code) > 4 || strings.Trim(code, "0123456789") != "" {
+				return nil, fmt.Errorf("country policy %s: invalid calling code %q", profile.Name, code)
+			}
+			if other, ok := p.byCode[code]; ok {
+				return nil, fmt.Errorf("country policy %s: calling code %s is already in %s", profile.Name, code, other.Name)
+			}
+			p.byCode[code] = profile
+		}
+		var err error
+		if profile.window, err = profile.AllowedHours.parse(); err != nil {
+			return nil, fmt.Errorf("country policy %s: %v", profile.Name, err)
+		}
+		profile.sessionWindow = 24 * time.Hour
+		if profile.SessionWindow != "" {
+			if profile.sessionWindow, err = time.ParseDuration(profile.SessionWindow); err != nil {
+				return nil, fmt.Errorf("country policy %s: invalid session_window: %v", profile.Name, err)
+			}
+		}
+		if profile.PerMinute > 0 {
+			p.rates[profile.Name] = newTokenBucket(profile.PerMinute, max(profile.Burst, 1), time.Now())
+		}
+	}
+	log.Printf("🌍 %d country policy profile(s) loaded", len(profiles))
+	return p, nil
+}
+
+// profileFor returns the profile of chat's country, or nil.
+func (p *CountryPolicies) profileFor(chat types.JID) *CountryProfile {
+	if p == nil || chat.Server != types.DefaultUserServer {
+		return nil
+	}
+	for n := min(4, len(chat.User)-1); n >= 1; n-- {
+		if profile, ok := p.byCode[chat.User[:n]]; ok {
+			return profile
+		}
+	}
+	return nil
+}
+
+// countryRules checks a send against the profile's allowed hours and
+// template requirement, which replies within the session window skip.
+func (b *WhatsAppBridge) countryRules(profile *CountryProfile, chat types.JID, msg OutgoingMessage, now time.Time) error {
+	if profile.window == nil && !profile.RequireTemplate {
+		return nil
+	}
+	if last := b.archiveDB.LastInbound(chat.String()); last > 0 && now.Sub(time.Unix(last, 0)) < profile.sessionWindow {
+		return nil
+	}
+	if profile.RequireTemplate && msg.Template == "" {
+		return errTemplateRequired
+	}
+	loc := profile.window.locationFor(BulkRecipient{Phone: chat.User}, b.location)
+	if wait := profile.window.opensIn(loc, now); wait > 0 {
+		return &RateLimitError{
+			Scope:      "allowed_hours",
+			Chat:       chat.String(),
+			RetryAfter: wait,
+			RetryAt:    now.Add(wait),
+			Quota:      []RateLimitQuota{},
+		}
+	}
+	return nil
+}
+
+// peek returns how long a send under profile would wait for its rate,
+// without taking a token, and the rate's state; nil when it has none.
+func (p *CountryPolicies) peek(profile *CountryProfile) (time.Duration, *RateLimitQuota) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	known := p.rates[profile.Name]
+	if known == nil {
+		return 0, nil
+	}
+	bucket := *known
+	bucket.refill(time.Now())
+	quota := bucket.quota("country", profile.PerMinute)
+	return bucket.wait(), &quota
+}
+
+// wait takes a token from the profile's rate, sleeping until it is due. API
+// sends that would wait over RATE_LIMIT_MAX_WAIT are rejected instead.
+func (p *CountryPolicies) wait(ctx context.Context, profile *CountryProfile, chat types.JID) error {
+	p.mu.Lock()
+	bucket := p.rates[profile.Name]
+	if bucket == nil {
+		p.mu.Unlock()
+		return nil
+	}
+	now := time.Now()
+	bucket.refill(now)
+	delay := bucket.wait()
+	if rejectsOverLimit(ctx) && delay > p.maxWait {
+		quota := bucket.quota("country", profile.PerMinute)
+		p.mu.Unlock()
+		return &RateLimitError{
+			Scope:      "country",
+			Chat:       chat.String(),
+			RetryAfter: delay,
+			RetryAt:    now.Add(delay),
+			Quota:      []RateLimitQuota{quota},
+		}
+	}
+	bucket.tokens--
+	p.mu.Unlock()
+
+	if delay >= 5*time.Second {
+		log.Printf("⏳ Pacing message to %s by %s under country policy %s", chat, delay.Round(time.Second), profile.Name)
+	}
+	if err := sleepContext(ctx, delay); err != nil {
+		// Cancelled before sending: give the token back.
+		p.mu.Lock()
+		bucket.tokens = min(bucket.burst, bucket.tokens+1)
+		p.mu.Unlock()
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,27 @@
+package bridge_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/phenobarbital/ai-parrot/whatsapp-bridge/bridge"
+	"github.com/phenobarbital/ai-parrot/whatsapp-bridge/bridgetest"
+)
+
+func TestCountryRateUsesPacerMaxWait(t *testing.T) {
+	// A token every 15s is over the default 10s wait.
+	h := bridgetest.New(t,
+		bridgetest.WithEnv("COUNTRY_POLICIES", `[{"name": "mexico", "country_codes": ["52"], "per_minute": 4, "burst": 1}]`),
+		bridgetest.WithEnv("RATE_LIMIT_CHAT_PER_MINUTE", "0"),
+		bridgetest.WithEnv("RATE_LIMIT_GLOBAL_PER_MINUTE", "0"),
+	)
+	h.Send(bridge.OutgoingMessage{Phone: "5215512345678", Message: "first"})
+
+	status, resp := h.Do(http.MethodPost, "/send", bridge.OutgoingMessage{Phone: "5215587654321", Message: "second"})
+	if status != http.StatusTooManyRequests {
+		t.Fatalf("second send answered %d, want 429: %s", status, resp.Error)
+	}
+	if data, _ := resp.Data.(map[string]any); data["scope"] != "country" {
+		t.Errorf("rate limit scope = %v, want country", data["scope"])
+	}
+}
@@ -0,0 +1,144 @@
+package bridge
+
+import (
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Debouncer holds the inbound messages of a chat for REPLY_DEBOUNCE after
+// the first one of a burst and then publishes them as a single message
+// event, so the agent answers the whole thought once. The combined event is
+// the burst's last message with the contents of every message joined by
+// newlines; the individual messages, which are still archived as they
+// arrive, are listed in its burst field. A burst of one is published
+// unchanged. A nil Debouncer passes every message through.
+//
+//	REPLY_DEBOUNCE              - how long to hold a burst (default 0, disabled)
+//	REPLY_DEBOUNCE_CHATS        - JID globs of the chats to debounce (default all direct chats)
+//	REPLY_DEBOUNCE_MAX_MESSAGES - publish a burst early once it has this many (default 20)
+type Debouncer struct {
+	Window      time.Duration
+	Chats       []string
+	MaxMessages int
+
+	bridge *WhatsAppBridge
+
+	mu     sync.Mutex
+	bursts map[string]*burst
+}
+
+type burst struct {
+	messages []IncomingMessage
+	timer    *time.Timer
+}
+
+// debouncerFromEnv returns nil unless REPLY_DEBOUNCE is set.
+func (b *WhatsAppBridge) debouncerFromEnv() *Debouncer {
+	window := envDuration("REPLY_DEBOUNCE", 0)
+	if window <= 0 {
+		return nil
+	}
+	d := &Debouncer{
+		Window:      window,
+		Chats:       envList("REPLY_DEBOUNCE_CHATS"),
+		MaxMessages: max(envInt("REPLY_DEBOUNCE_MAX_MESSAGES", 20), 1),
+		bridge:      b,
+		bursts:      make(map[string]*burst),
+	}
+	if len(d.Chats) == 0 {
+		d.Chats = []string{"*@s.whatsapp.net", "*@lid"}
+	}
+	log.Printf("⏳ Debouncing replies in %v for %s", d.Chats, d.Window)
+	return d
+}
+
+// Add holds msg when its chat is debounced, reporting whether it did so;
+// the caller publishes the message itself otherwise.
+func (d *Debouncer) Add(chat string, msg IncomingMessage) bool {
+	if d == nil || !matchesAny(d.Chats, chat) {
+		return false
+	}
+
+	d.mu.Lock()
+	current, ok := d.bursts[chat]
+	if !ok {
+		current = &burst{}
+		current.timer = time.AfterFunc(d.Window, func() { d.flushChat(chat, current) })
+		d.bursts[chat] = current
+	}
+	current.messages = append(current.messages, msg)
+	full := len(current.messages) >= d.MaxMessages
+	if full {
+		current.timer.Stop()
+		delete(d.bursts, chat)
+	}
+	d.mu.Unlock()
+
+	if full {
+		d.emit(chat, current.messages)
+	}
+	return true
+}
+
+// held returns the number of messages held.
+func (d *Debouncer) held() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	n := 0
+	for _, held := range d.bursts {
+		n += len(held.messages)
+	}
+	return n
+}
+
+// Flush publishes every held burst immediately, e.g. on shutdown.
+func (d *Debouncer) Flush() {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	pending := d.bursts
+	d.bursts = make(map[string]*burst)
+	for _, held := range pending {
+		held.timer.Stop()
+	}
+	d.mu.Unlock()
+
+	for chat, held := range pending {
+		d.emit(chat, held.messages)
+	}
+}
+
+// flushChat publishes held once its window ends, unless it was already
+// published because it filled up or the bridge shut down.
+func (d *Debouncer) flushChat(chat string, held *burst) {
+	d.mu.Lock()
+	if d.bursts[chat] != held {
+		d.mu.Unlock()
+		return
+	}
+	delete(d.bursts, chat)
+	d.mu.Unlock()
+
+	d.emit(chat, held.messages)
+}
+
+func (d *Debouncer) emit(chat string, messages []IncomingMessage) {
+	if len(messages) == 1 {
+		d.bridge.publishMessage(chat, messages[0])
+		return
+	}
+	combined := messages[len(messages)-1]
+	var contents []string
+	for _, m := range messages {
+		if m.Content != "" {
+			contents = append(contents, m.Content)
+		}
+	}
+	combined.Content = strings.Join(contents, "\n")
+	combined.Burst = messages
+	log.Printf("⏳ Publishing a burst of %d message(s) from %s", len(messages), chat)
+	d.bridge.publishMessage(chat, combined)
+}
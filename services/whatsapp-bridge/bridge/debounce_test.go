@@ -0,0 +1,40 @@
+package bridge_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/phenobarbital/ai-parrot/whatsapp-bridge/bridge"
+	"github.com/phenobarbital/ai-parrot/whatsapp-bridge/bridgetest"
+)
+
+func TestDebounceCombinesBurst(t *testing.T) {
+	h := bridgetest.New(t, bridgetest.WithEnv("REPLY_DEBOUNCE", "100ms"))
+	h.ReceiveText("5215512345678", "hi")
+	last := h.ReceiveText("5215512345678", "are you open today?")
+	h.ExpectNoEvent(bridge.EventMessage, 50*time.Millisecond)
+
+	msg := h.ExpectMessage()
+	if msg.MessageID != last || msg.Content != "hi\nare you open today?" || len(msg.Burst) != 2 {
+		t.Errorf("burst published as %s %q with %d message(s)", msg.MessageID, msg.Content, len(msg.Burst))
+	}
+	h.ExpectNoEvent(bridge.EventMessage, 150*time.Millisecond)
+}
+
+func TestDebounceMaxMessagesAndGroups(t *testing.T) {
+	h := bridgetest.New(t,
+		bridgetest.WithEnv("REPLY_DEBOUNCE", "1h"),
+		bridgetest.WithEnv("REPLY_DEBOUNCE_MAX_MESSAGES", "2"),
+	)
+	// Groups are not debounced by default.
+	h.ReceiveGroupText("120363012345678901", "5215512345678", "hello all")
+	if msg := h.ExpectMessage(); msg.Content != "hello all" || len(msg.Burst) != 0 {
+		t.Errorf("group message published as %q with a burst of %d", msg.Content, len(msg.Burst))
+	}
+
+	h.ReceiveText("5215512345678", "one")
+	h.ReceiveText("5215512345678", "two")
+	if msg := h.ExpectMessage(); msg.Content != "one\ntwo" || len(msg.Burst) != 2 {
+		t.Errorf("full burst published as %q with %d message(s)", msg.Content, len(msg.Burst))
+	}
+}
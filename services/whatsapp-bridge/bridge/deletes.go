@@ -0,0 +1,80 @@
+package bridge
+
+import (
+	"log"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// EventMessageDeleted is published when a contact deletes a message for
+// everyone, so consumers can drop it from their archives and agent context.
+// The deletion is archived as an inbound "revoke" row whose content is the
+// deleted message's ID; the deleted message itself stays in the bridge's
+// archive until retention removes it.
+const EventMessageDeleted = "message_deleted"
+
+// MessageDeleted is the payload of message_deleted events. From deleted the
+// message; in groups an admin may delete someone else's, whose JID is then
+// Author. DeletedDirection is out when the message was the bridge's own.
+type MessageDeleted struct {
+	MessageID        string `json:"message_id"` // of the deletion itself
+	DeletedMessageID string `json:"deleted_message_id"`
+	DeletedDirection string `json:"deleted_direction,omitempty"`
+	Chat             string `json:"chat"`
+	From             string `json:"from"`
+	FromName         string `json:"from_name,omitempty"`
+	ContactID        string `json:"contact_id,omitempty"`
+	Author           string `json:"author,omitempty"`
+	IsGroup          bool   `json:"is_group"`
+	Timestamp        int64  `json:"timestamp"`
+	TimestampISO     string `json:"timestamp_iso"`
+}
+
+// isRevoke reports whether msg deletes an earlier message for everyone.
+// REVOKE is the zero type, so a protocol message without a type (or no
+// protocol message at all) is not taken for one.
+func isRevoke(msg *waE2E.Message) bool {
+	protocol := msg.GetProtocolMessage()
+	return protocol != nil && protocol.Type != nil && protocol.GetType() == waE2E.ProtocolMessage_REVOKE
+}
+
+// handleInboundRevoke archives a contact's deletion and publishes it, unless
+// held for maintenance.
+func (b *WhatsAppBridge) handleInboundRevoke(msg *events.Message, held bool) {
+	info := msg.Info
+	key := msg.Message.GetProtocolMessage().GetKey()
+	evt := MessageDeleted{
+		MessageID:        info.ID,
+		DeletedMessageID: key.GetID(),
+		Chat:             info.Chat.String(),
+		From:             info.Sender.User,
+		FromName:         info.PushName,
+		ContactID:        b.resolveContact(info.Sender, info.SenderAlt),
+		IsGroup:          info.IsGroup,
+		Timestamp:        info.Timestamp.Unix(),
+		TimestampISO:     b.formatTime(info.Timestamp),
+	}
+	if author := key.GetParticipant(); author != "" && author != info.Sender.ToNonAD().String() {
+		evt.Author = author
+	}
+	if deleted, err := b.archiveDB.FindMessage(evt.DeletedMessageID); err == nil {
+		evt.DeletedDirection = deleted.Direction
+	}
+	log.Printf("🗑️ Message %s deleted by %s", evt.DeletedMessageID, info.Sender.User)
+
+	b.archive(ArchivedMessage{
+		MessageID:   info.ID,
+		Direction:   DirectionInbound,
+		Chat:        evt.Chat,
+		Sender:      info.Sender.ToNonAD().String(),
+		Type:        "revoke",
+		Content:     evt.DeletedMessageID,
+		ContentHash: contentHash("revoke", evt.DeletedMessageID, nil),
+		ContactID:   evt.ContactID,
+		Timestamp:   evt.Timestamp,
+	})
+	if !held {
+		b.publish(EventMessageDeleted, evt.Chat, evt)
+	}
+}
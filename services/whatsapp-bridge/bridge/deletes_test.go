@@ -0,0 +1,50 @@
+package bridge_test
+
+import (
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow/proto/waCommon"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/phenobarbital/ai-parrot/whatsapp-bridge/bridge"
+	"github.com/phenobarbital/ai-parrot/whatsapp-bridge/bridgetest"
+)
+
+func TestInboundRevoke(t *testing.T) {
+	h := bridgetest.New(t)
+	jid := types.NewJID("5215512345678", types.DefaultUserServer)
+	target := h.ReceiveText("5215512345678", "oops, wrong chat")
+	h.ExpectMessage()
+
+	revoke := h.Receive(jid, jid, &waE2E.Message{ProtocolMessage: &waE2E.ProtocolMessage{
+		Type: waE2E.ProtocolMessage_REVOKE.Enum(),
+		Key:  &waCommon.MessageKey{ID: proto.String(target)},
+	}})
+	var evt bridge.MessageDeleted
+	h.DecodePayload(h.ExpectEvent(bridge.EventMessageDeleted), &evt)
+	if evt.MessageID != revoke || evt.DeletedMessageID != target || evt.DeletedDirection != bridge.DirectionInbound || evt.Author != "" {
+		t.Errorf("deletion published as %+v", evt)
+	}
+	h.ExpectNoEvent(bridge.EventMessage, 50*time.Millisecond)
+}
+
+func TestInboundRevokeByGroupAdmin(t *testing.T) {
+	h := bridgetest.New(t)
+	target := h.ReceiveGroupText("120363012345678901", "5215512345678", "spam")
+	h.ExpectMessage()
+
+	group := types.NewJID("120363012345678901", types.GroupServer)
+	admin := types.NewJID("5215587654321", types.DefaultUserServer)
+	h.Receive(group, admin, &waE2E.Message{ProtocolMessage: &waE2E.ProtocolMessage{
+		Type: waE2E.ProtocolMessage_REVOKE.Enum(),
+		Key:  &waCommon.MessageKey{ID: proto.String(target), Participant: proto.String("5215512345678@s.whatsapp.net")},
+	}})
+	var evt bridge.MessageDeleted
+	h.DecodePayload(h.ExpectEvent(bridge.EventMessageDeleted), &evt)
+	if !evt.IsGroup || evt.From != admin.User || evt.Author != "5215512345678@s.whatsapp.net" {
+		t.Errorf("admin deletion published as %+v", evt)
+	}
+}
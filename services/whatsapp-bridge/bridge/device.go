@@ -0,0 +1,112 @@
+package bridge
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"go.mau.fi/whatsmeow/proto/waAdv"
+	"go.mau.fi/whatsmeow/types"
+	"google.golang.org/protobuf/proto"
+)
+
+// GET /admin/device describes the companion device the bridge is linked as,
+// from the session store, to inventory which phone owns which bridge: its
+// JID, platform, business and push names and when it was paired. While
+// connected it also lists the account's other devices, the phone and any
+// other linked companions, as WhatsApp reports them.
+//
+//	DEVICE_LOOKUP_TIMEOUT - how long listing the other devices may take (default 10s)
+
+// DeviceInfo is the response of GET /admin/device.
+type DeviceInfo struct {
+	JID          string `json:"jid"`   // the device JID, e.g. 15551234567:12@s.whatsapp.net
+	Phone        string `json:"phone"` // the account's phone number
+	LID          string `json:"lid,omitempty"`
+	DeviceID     uint16 `json:"device_id"`
+	Platform     string `json:"platform,omitempty"`
+	BusinessName string `json:"business_name,omitempty"`
+	PushName     string `json:"push_name,omitempty"`
+	PairedAt     int64  `json:"paired_at,omitempty"` // Unix seconds, when the phone linked this device
+	PairedAtISO  string `json:"paired_at_iso,omitempty"`
+	Connected    bool   `json:"connected"`
+
+	// LinkedDevices is nil when the list could not be fetched, with
+	// LinkedDevicesError telling why.
+	LinkedDevices      []LinkedDevice `json:"linked_devices"`
+	LinkedDevicesError string         `json:"linked_devices_error,omitempty"`
+}
+
+// LinkedDevice is another device of the account.
+type LinkedDevice struct {
+	JID      string `json:"jid"`
+	DeviceID uint16 `json:"device_id"`
+	Primary  bool   `json:"primary,omitempty"` // the phone itself
+}
+
+// deviceInfo reads the session store, or returns nil when no device is
+// paired.
+func (b *WhatsAppBridge) deviceInfo(ctx context.Context) *DeviceInfo {
+	if b.client == nil {
+		return nil
+	}
+	device := b.client.Device()
+	if device == nil || device.ID == nil {
+		return nil
+	}
+	info := &DeviceInfo{
+		JID:          device.ID.String(),
+		Phone:        device.ID.User,
+		DeviceID:     device.ID.Device,
+		Platform:     device.Platform,
+		BusinessName: device.BusinessName,
+		PushName:     device.PushName,
+		Connected:    b.client.IsConnected(),
+	}
+	if !device.LID.IsEmpty() {
+		info.LID = device.LID.ToNonAD().String()
+	}
+	// The phone signs the pairing time into the device identity it issues.
+	var identity waAdv.ADVDeviceIdentity
+	if details := device.Account.GetDetails(); details != nil && proto.Unmarshal(details, &identity) == nil && identity.GetTimestamp() > 0 {
+		paired := time.Unix(int64(identity.GetTimestamp()), 0)
+		info.PairedAt = paired.Unix()
+		info.PairedAtISO = b.formatTime(paired)
+	}
+
+	if !info.Connected {
+		info.LinkedDevicesError = "not connected to WhatsApp"
+		return info
+	}
+	ctx, cancel := context.WithTimeout(ctx, envDuration("DEVICE_LOOKUP_TIMEOUT", 10*time.Second))
+	defer cancel()
+	jids, err := b.client.GetUserDevices(ctx, []types.JID{device.ID.ToNonAD()})
+	if err != nil {
+		log.Printf("Error listing the devices of %s: %v", device.ID.User, err)
+		info.LinkedDevicesError = err.Error()
+		return info
+	}
+	info.LinkedDevices = []LinkedDevice{}
+	for _, jid := range jids {
+		if jid.User != device.ID.User || jid.Device == device.ID.Device {
+			continue
+		}
+		info.LinkedDevices = append(info.LinkedDevices, LinkedDevice{
+			JID:      jid.String(),
+			DeviceID: jid.Device,
+			Primary:  jid.Device == 0,
+		})
+	}
+	return info
+}
+
+// handleGetDevice serves GET /admin/device.
+func (b *WhatsAppBridge) handleGetDevice(w http.ResponseWriter, r *http.Request) {
+	info := b.deviceInfo(r.Context())
+	if info == nil {
+		writeJSON(w, http.StatusNotFound, Response{Success: false, Error: "no device is paired"})
+		return
+	}
+	writeJSON(w, http.StatusOK, Response{Success: true, Data: info})
+}
@@ -0,0 +1,183 @@
+package bridge
+
+import (
+	"context"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// EventGroupDigest is published once per interval for groups in digest mode.
+const EventGroupDigest = "group_digest"
+
+// GroupDigest batches the messages a digest-mode group received during one
+// interval. Each message is still archived individually as it arrives.
+type GroupDigest struct {
+	Chat         string            `json:"chat"`
+	GroupName    string            `json:"group_name"`
+	MessageCount int               `json:"message_count"`
+	Senders      []DigestSender    `json:"senders"` // most active first
+	Messages     []IncomingMessage `json:"messages"`
+	PeriodStart  string            `json:"period_start"`
+	PeriodEnd    string            `json:"period_end"`
+	Timestamp    int64             `json:"timestamp"`
+	TimestampISO string            `json:"timestamp_iso"`
+	Timezone     string            `json:"timezone"`
+}
+
+// DigestSender counts one participant's messages within a digest.
+type DigestSender struct {
+	From         string `json:"from"`
+	FromName     string `json:"from_name"`
+	MessageCount int    `json:"message_count"`
+}
+
+type digestBatch struct {
+	started  time.Time
+	messages []IncomingMessage
+}
+
+// Digester accumulates messages of groups matching DIGEST_GROUPS (JID globs,
+// e.g. "*@g.us") and publishes them as one group_digest event every
+// DIGEST_INTERVAL, or earlier once DIGEST_MAX_MESSAGES are buffered. A nil
+// Digester passes every message through.
+type Digester struct {
+	groups      []string
+	interval    time.Duration
+	maxMessages int
+	bridge      *WhatsAppBridge
+
+	mu      sync.Mutex
+	batches map[string]*digestBatch
+}
+
+// digesterFromEnv returns nil unless DIGEST_GROUPS is set.
+func (b *WhatsAppBridge) digesterFromEnv() *Digester {
+	groups := envList("DIGEST_GROUPS")
+	if len(groups) == 0 {
+		return nil
+	}
+	return &Digester{
+		groups:      groups,
+		interval:    envDuration("DIGEST_INTERVAL", 10*time.Minute),
+		maxMessages: envInt("DIGEST_MAX_MESSAGES", 500),
+		bridge:      b,
+		batches:     make(map[string]*digestBatch),
+	}
+}
+
+// Add buffers msg when its group is in digest mode, reporting whether it did
+// so; the caller publishes the message itself otherwise.
+func (d *Digester) Add(chat string, msg IncomingMessage) bool {
+	if d == nil || !msg.IsGroup || !matchesAny(d.groups, chat) {
+		return false
+	}
+
+	d.mu.Lock()
+	batch, ok := d.batches[chat]
+	if !ok {
+		batch = &digestBatch{started: time.Now()}
+		d.batches[chat] = batch
+	}
+	batch.messages = append(batch.messages, msg)
+	full := len(batch.messages) >= d.maxMessages
+	if full {
+		delete(d.batches, chat)
+	}
+	d.mu.Unlock()
+
+	if full {
+		d.emit(chat, batch)
+	}
+	return true
+}
+
+// held returns the number of messages buffered.
+func (d *Digester) held() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	n := 0
+	for _, batch := range d.batches {
+		n += len(batch.messages)
+	}
+	return n
+}
+
+// Run flushes due batches until ctx is cancelled.
+func (d *Digester) Run(ctx context.Context) {
+	log.Printf("🗞️ Digest mode for %v every %s", d.groups, d.interval)
+	// Tick faster than the interval so each group's window stays close to it.
+	ticker := time.NewTicker(min(d.interval, time.Minute))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			d.flush(false)
+		}
+	}
+}
+
+// Flush publishes every buffered batch immediately, e.g. on shutdown.
+func (d *Digester) Flush() {
+	if d != nil {
+		d.flush(true)
+	}
+}
+
+func (d *Digester) flush(all bool) {
+	d.mu.Lock()
+	due := make(map[string]*digestBatch)
+	for chat, batch := range d.batches {
+		if all || time.Since(batch.started) >= d.interval {
+			due[chat] = batch
+			delete(d.batches, chat)
+		}
+	}
+	d.mu.Unlock()
+
+	for chat, batch := range due {
+		d.emit(chat, batch)
+	}
+}
+
+func (d *Digester) emit(chat string, batch *digestBatch) {
+	b := d.bridge
+	now := time.Now()
+
+	counts := make(map[string]*DigestSender)
+	var senders []DigestSender
+	for _, m := range batch.messages {
+		if s, ok := counts[m.From]; ok {
+			s.MessageCount++
+			continue
+		}
+		counts[m.From] = &DigestSender{From: m.From, FromName: m.FromName, MessageCount: 1}
+	}
+	for _, s := range counts {
+		senders = append(senders, *s)
+	}
+	sort.Slice(senders, func(i, j int) bool {
+		if senders[i].MessageCount != senders[j].MessageCount {
+			return senders[i].MessageCount > senders[j].MessageCount
+		}
+		return senders[i].From < senders[j].From
+	})
+
+	last := batch.messages[len(batch.messages)-1]
+	log.Printf("🗞️ Publishing digest of %d message(s) for %s", len(batch.messages), last.GroupName)
+	b.publish(EventGroupDigest, chat, GroupDigest{
+		Chat:         chat,
+		GroupName:    last.GroupName,
+		MessageCount: len(batch.messages),
+		Senders:      senders,
+		Messages:     batch.messages,
+		PeriodStart:  b.formatTime(batch.started),
+		PeriodEnd:    b.formatTime(now),
+		Timestamp:    now.Unix(),
+		TimestampISO: b.formatTime(now),
+		Timezone:     b.location.String(),
+	})
+}
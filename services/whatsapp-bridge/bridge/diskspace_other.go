@@ -0,0 +1,10 @@
+//go:build !unix
+
+package bridge
+
+import "errors"
+
+// freeSpace is not implemented on this platform.
+func freeSpace(path string) (uint64, error) {
+	return 0, errors.New("not supported on this platform")
+}
@@ -0,0 +1,346 @@
+package bridge
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"go.mau.fi/whatsmeow/store/sqlstore"
+	"go.mau.fi/whatsmeow/store/sqlstore/upgrades"
+	waLog "go.mau.fi/whatsmeow/util/log"
+)
+
+// Self-test outcomes.
+const (
+	CheckOK   = "ok"
+	CheckWarn = "warn"
+	CheckFail = "fail"
+	CheckSkip = "skip"
+)
+
+// CheckResult is the outcome of one self-test.
+type CheckResult struct {
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	Message string `json:"message"`
+	Hint    string `json:"hint,omitempty"` // what to do about a failure
+}
+
+func (c CheckResult) String() string {
+	icon := map[string]string{CheckOK: "✅", CheckWarn: "⚠️", CheckFail: "❌", CheckSkip: "⏭️"}[c.Status]
+	s := fmt.Sprintf("%s %s: %s", icon, c.Name, c.Message)
+	if c.Hint != "" && c.Status != CheckOK {
+		s += "\n   → " + c.Hint
+	}
+	return s
+}
+
+// ChecksFailed reports whether any result failed.
+func ChecksFailed(results []CheckResult) bool {
+	for _, r := range results {
+		if r.Status == CheckFail {
+			return true
+		}
+	}
+	return false
+}
+
+type selfCheck struct {
+	name string
+	run  func(ctx context.Context, redisURL string) CheckResult
+}
+
+var selfChecks = []selfCheck{
+	{"redis", checkRedis},
+	{"data_dir", checkDataDir},
+	{"disk_space", checkDiskSpace},
+	{"session_store", checkSessionStore},
+	{"archive", checkArchive},
+	{"ffmpeg", checkFFmpeg},
+	{"proxy", checkProxy},
+}
+
+// RunChecks validates the environment the bridge depends on, in order:
+// Redis, the data directory and its free space, the session and archive
+// schemas, ffmpeg and proxies. The checks change nothing: databases are
+// opened read-only and pending migrations are only reported. Checks listed
+// in STARTUP_CHECKS_SKIP are skipped ("all" skips every check); failures
+// of those in STARTUP_CHECKS_OPTIONAL (default "ffmpeg") are downgraded to
+// warnings.
+func RunChecks(ctx context.Context, redisURL string) []CheckResult {
+	skip := envList("STARTUP_CHECKS_SKIP")
+	optional := envList("STARTUP_CHECKS_OPTIONAL")
+	if _, set := os.LookupEnv("STARTUP_CHECKS_OPTIONAL"); !set {
+		optional = []string{"ffmpeg"}
+	}
+
+	results := make([]CheckResult, 0, len(selfChecks))
+	for _, check := range selfChecks {
+		if containsString(skip, "all") || containsString(skip, check.name) {
+			results = append(results, CheckResult{Name: check.name, Status: CheckSkip, Message: "skipped by STARTUP_CHECKS_SKIP"})
+			continue
+		}
+		result := check.run(ctx, redisURL)
+		result.Name = check.name
+		if result.Status == CheckFail && containsString(optional, check.name) {
+			result.Status = CheckWarn
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+func checkRedis(ctx context.Context, redisURL string) CheckResult {
+	opt, err := redis.ParseURL(redisURL)
+	if err != nil {
+		return CheckResult{Status: CheckFail, Message: fmt.Sprintf("invalid REDIS_URL: %v", err),
+			Hint: "use the form redis://[:password@]host:port/db"}
+	}
+	client := redis.NewClient(opt)
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		return CheckResult{Status: CheckFail, Message: fmt.Sprintf("cannot reach %s: %v", opt.Addr, err),
+			Hint: "check that Redis is running and REDIS_URL points at it"}
+	}
+
+	version := ""
+	if info, err := client.Info(ctx, "server").Result(); err == nil {
+		for _, line := range strings.Split(info, "\n") {
+			if v, ok := strings.CutPrefix(strings.TrimSpace(line), "redis_version:"); ok {
+				version = v
+			}
+		}
+	}
+	// Consumer groups (OUTGOING_STREAM) need Redis 5.
+	major, _, _ := strings.Cut(version, ".")
+	if n, err := strconv.Atoi(major); err == nil && n < 5 {
+		return CheckResult{Status: CheckFail, Message: "Redis " + version + " has no streams support",
+			Hint: "upgrade to Redis 5 or newer"}
+	}
+	return CheckResult{Status: CheckOK, Message: fmt.Sprintf("connected to %s (Redis %s)", opt.Addr, version)}
+}
+
+func checkDataDir(ctx context.Context, _ string) CheckResult {
+	if _, err := os.Stat(dataDir); os.IsNotExist(err) {
+		return CheckResult{Status: CheckWarn, Message: dataDir + " does not exist yet",
+			Hint: "it is created on startup; mount a writable volume at ./" + dataDir + " to keep the session"}
+	}
+	probe, err := os.CreateTemp(dataDir, ".doctor-*")
+	if err != nil {
+		return CheckResult{Status: CheckFail, Message: fmt.Sprintf("%s is not writable: %v", dataDir, err),
+			Hint: "fix the volume permissions for the bridge user"}
+	}
+	probe.Close()
+	os.Remove(probe.Name())
+	abs, _ := filepath.Abs(dataDir)
+	return CheckResult{Status: CheckOK, Message: abs + " is writable"}
+}
+
+func checkDiskSpace(ctx context.Context, _ string) CheckResult {
+	minFree := uint64(envInt("STARTUP_MIN_FREE_MB", 200)) << 20
+	dir := dataDir
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		dir = "." // where it will be created
+	}
+	free, err := freeSpace(dir)
+	if err != nil {
+		return CheckResult{Status: CheckWarn, Message: fmt.Sprintf("cannot measure free space: %v", err)}
+	}
+	msg := fmt.Sprintf("%s free in %s", formatBytes(int64(free)), dir)
+	switch {
+	case free < minFree:
+		return CheckResult{Status: CheckFail, Message: msg,
+			Hint: fmt.Sprintf("free up space or grow the volume; STARTUP_MIN_FREE_MB requires %s", formatBytes(int64(minFree)))}
+	case free < 5*minFree:
+		return CheckResult{Status: CheckWarn, Message: msg + ", running low",
+			Hint: "media downloads and the archive will fill the volume soon"}
+	}
+	return CheckResult{Status: CheckOK, Message: msg}
+}
+
+func checkSessionStore(ctx context.Context, _ string) CheckResult {
+	db, err := openReadOnly(sessionDSN)
+	if os.IsNotExist(err) {
+		return CheckResult{Status: CheckWarn, Message: "no session store yet",
+			Hint: "it is created on startup; scan the QR code at /qr to link the device"}
+	}
+	if err != nil {
+		return CheckResult{Status: CheckFail, Message: fmt.Sprintf("cannot open session store: %v", err)}
+	}
+	defer db.Close()
+	var version int
+	if err := db.QueryRowContext(ctx, "SELECT version FROM whatsmeow_version LIMIT 1").Scan(&version); err != nil {
+		return CheckResult{Status: CheckFail, Message: fmt.Sprintf("cannot read the session schema version: %v", err),
+			Hint: "restore data/whatsapp.db from a backup or remove it and re-link the device"}
+	}
+	if latest := len(upgrades.Table); version < latest {
+		return CheckResult{Status: CheckWarn, Message: fmt.Sprintf("schema v%d, upgraded to v%d on startup", version, latest)}
+	}
+	device, err := sqlstore.NewWithDB(db, "sqlite3", waLog.Noop).GetFirstDevice(ctx)
+	if err != nil {
+		return CheckResult{Status: CheckFail, Message: fmt.Sprintf("cannot read device: %v", err)}
+	}
+	if device.ID == nil {
+		return CheckResult{Status: CheckWarn, Message: "schema up to date, no device linked yet",
+			Hint: "scan the QR code at /qr after startup"}
+	}
+	return CheckResult{Status: CheckOK, Message: "schema up to date, linked as " + device.ID.String()}
+}
+
+func checkArchive(ctx context.Context, _ string) CheckResult {
+	if !envBool("ARCHIVE_ENABLED", true) {
+		return CheckResult{Status: CheckOK, Message: "disabled (ARCHIVE_ENABLED=false)"}
+	}
+	db, err := openReadOnly(archiveDSN())
+	if os.IsNotExist(err) {
+		return CheckResult{Status: CheckOK, Message: "not created yet, set up on startup"}
+	}
+	if err != nil {
+		return CheckResult{Status: CheckFail, Message: fmt.Sprintf("cannot open archive: %v", err),
+			Hint: "check ARCHIVE_DB, or set ARCHIVE_ENABLED=false to run without the archive"}
+	}
+	defer db.Close()
+	pending, err := pendingMigrationsReadOnly(ctx, db)
+	if err != nil {
+		return CheckResult{Status: CheckFail, Message: err.Error(),
+			Hint: "check ARCHIVE_DB, or set ARCHIVE_ENABLED=false to run without the archive"}
+	}
+	if pending == 0 {
+		return CheckResult{Status: CheckOK, Message: "schema up to date"}
+	}
+	msg := fmt.Sprintf("%d pending migration(s)", pending)
+	if !envBool("ARCHIVE_AUTO_MIGRATE", true) {
+		return CheckResult{Status: CheckFail, Message: msg, Hint: "run \"whatsapp-bridge migrate\" before starting"}
+	}
+	return CheckResult{Status: CheckWarn, Message: msg + ", applied on startup"}
+}
+
+// openReadOnly opens the SQLite database of dsn read-only, failing with an
+// os.IsNotExist error when its file does not exist.
+func openReadOnly(dsn string) (*sql.DB, error) {
+	path, query, _ := strings.Cut(strings.TrimPrefix(dsn, "file:"), "?")
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+	values, _ := url.ParseQuery(query)
+	values.Set("mode", "ro")
+	db, err := sql.Open("sqlite3", "file:"+path+"?"+values.Encode())
+	if err != nil {
+		return nil, err
+	}
+	return db, db.Ping()
+}
+
+// pendingMigrationsReadOnly counts the archive migrations not yet applied
+// without recording anything, unlike migrationState. Databases created
+// before migrations were tracked count everything as pending; startup
+// adopts their schema.
+func pendingMigrationsReadOnly(ctx context.Context, db *sql.DB) (int, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return 0, err
+	}
+	var tracked int
+	if err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations'`).Scan(&tracked); err != nil {
+		return 0, err
+	}
+	if tracked == 0 {
+		return len(migrations), nil
+	}
+	applied := make(map[int]bool)
+	rows, err := db.QueryContext(ctx, `SELECT version FROM schema_migrations`)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			return 0, err
+		}
+		applied[version] = true
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	latest := migrations[len(migrations)-1].Version
+	pending := 0
+	for version := range applied {
+		if version > latest {
+			return 0, fmt.Errorf("archive schema is at version %d, newer than this release knows (%d); upgrade the bridge", version, latest)
+		}
+	}
+	for _, m := range migrations {
+		if !applied[m.Version] {
+			pending++
+		}
+	}
+	return pending, nil
+}
+
+func checkFFmpeg(ctx context.Context, _ string) CheckResult {
+	bin := envString("FFMPEG_PATH", "ffmpeg")
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, bin, "-hide_banner", "-version").Output()
+	if err != nil {
+		return CheckResult{Status: CheckFail, Message: fmt.Sprintf("%s is not usable: %v", bin, err),
+			Hint: "install ffmpeg (needed for /send/voice) or point FFMPEG_PATH at it"}
+	}
+	version, _, _ := strings.Cut(string(out), "\n")
+	return CheckResult{Status: CheckOK, Message: strings.TrimSpace(version)}
+}
+
+// checkProxy dials the HTTP(S)_PROXY used by webhooks and media fetches.
+func checkProxy(ctx context.Context, _ string) CheckResult {
+	var checked []string
+	for _, key := range []string{"HTTPS_PROXY", "HTTP_PROXY"} {
+		raw := os.Getenv(key)
+		if raw == "" {
+			raw = os.Getenv(strings.ToLower(key))
+		}
+		if raw == "" {
+			continue
+		}
+		u, err := url.Parse(raw)
+		if err != nil || u.Host == "" {
+			return CheckResult{Status: CheckFail, Message: fmt.Sprintf("invalid %s %q", key, raw),
+				Hint: "use the form scheme://[user:pass@]host:port"}
+		}
+		port := u.Port()
+		if port == "" {
+			switch u.Scheme {
+			case "https":
+				port = "443"
+			case "socks5", "socks5h":
+				port = "1080"
+			default:
+				port = "80"
+			}
+		}
+		host := net.JoinHostPort(u.Hostname(), port)
+		conn, err := (&net.Dialer{Timeout: 5 * time.Second}).DialContext(ctx, "tcp", host)
+		if err != nil {
+			return CheckResult{Status: CheckFail, Message: fmt.Sprintf("%s %s is unreachable: %v", key, host, err),
+				Hint: "check the proxy is up and reachable from this host, or unset " + key}
+		}
+		conn.Close()
+		checked = append(checked, key+" "+host)
+	}
+	if len(checked) == 0 {
+		return CheckResult{Status: CheckOK, Message: "no proxy configured"}
+	}
+	return CheckResult{Status: CheckOK, Message: "reachable: " + strings.Join(checked, ", ")}
+}
@@ -0,0 +1,22 @@
+package bridge
+
+import (
+	"context"
+	"testing"
+)
+
+func TestRunChecksSkipAll(t *testing.T) {
+	t.Setenv("STARTUP_CHECKS_SKIP", "all")
+	results := RunChecks(context.Background(), "redis://127.0.0.1:1")
+	if len(results) != len(selfChecks) {
+		t.Fatalf("%d results, want one per check", len(results))
+	}
+	for _, r := range results {
+		if r.Status != CheckSkip {
+			t.Errorf("%s ran with STARTUP_CHECKS_SKIP=all: %s", r.Name, r)
+		}
+	}
+	if ChecksFailed(results) {
+		t.Error("skipped checks failed the startup")
+	}
+}
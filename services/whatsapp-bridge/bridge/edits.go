@@ -0,0 +1,165 @@
+package bridge
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+)
+
+// EditRequest is the payload accepted by PATCH /messages/{id}.
+//
+// Phone/Server identify the chat and may be omitted when the message is in
+// the archive. Only messages sent by the bridge account can be edited, and
+// only within whatsmeow.EditWindow of sending.
+type EditRequest struct {
+	Phone   string `json:"phone,omitempty"`
+	Server  string `json:"server,omitempty"`
+	Message string `json:"message"`
+}
+
+func (b *WhatsAppBridge) handleEditMessage(w http.ResponseWriter, r *http.Request) {
+	messageID := mux.Vars(r)["id"]
+
+	var req EditRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, Response{Success: false, Error: err.Error()})
+		return
+	}
+	if req.Message == "" {
+		writeJSON(w, http.StatusBadRequest, Response{Success: false, Error: "message is required"})
+		return
+	}
+
+	// The archive tells us whether the message is ours and still editable;
+	// without it we trust the caller and let WhatsApp enforce the window.
+	if archived, err := b.archiveDB.FindMessage(messageID); err == nil {
+		if archived.Direction != DirectionOutbound {
+			writeJSON(w, http.StatusForbidden, Response{Success: false, Error: "only messages sent by the bridge can be edited"})
+			return
+		}
+		if time.Since(time.Unix(archived.Timestamp, 0)) > whatsmeow.EditWindow {
+			writeJSON(w, http.StatusConflict, Response{Success: false, Error: "edit window has expired"})
+			return
+		}
+	}
+
+	chat, _, err := b.resolveMessageTarget(messageID, req.Phone, req.Server, "", true)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, Response{Success: false, Error: err.Error()})
+		return
+	}
+
+	ctx, chat, err := b.checkSend(context.WithoutCancel(r.Context()), chat, OutgoingMessage{})
+	if err != nil {
+		b.writeSendError(w, err, SendResult{})
+		return
+	}
+
+	log.Printf("Editing message %s in %s", messageID, chat.User)
+
+	edit := b.client.BuildEdit(chat, messageID, &waE2E.Message{Conversation: proto.String(req.Message)})
+	resp, err := b.deliver(ctx, chat, edit, len([]rune(req.Message)))
+	if err != nil {
+		log.Printf("Error editing message %s in %s: %v", messageID, chat.User, err)
+		b.reportSendFailure(err, chat, "edit")
+		b.writeSendError(w, err, SendResult{})
+		return
+	}
+
+	b.archiveOutgoing(r.Context(), chat.String(), resp.ID, "edit", req.Message, resp.Timestamp)
+	data := b.timestampFields(resp.Timestamp)
+	data["message_id"] = resp.ID
+	data["target_message_id"] = messageID
+	writeJSON(w, http.StatusOK, Response{Success: true, Data: data})
+}
+
+// EventMessageEdited is published when a contact edits a message they sent,
+// so agents can reconsider a question the user corrected. The edit is
+// archived as an inbound "edit" row with the new content.
+const EventMessageEdited = "message_edited"
+
+// MessageEdited is the payload of message_edited events. OriginalContent is
+// the text first archived for the message, when the archive has it.
+type MessageEdited struct {
+	MessageID         string `json:"message_id"` // of the edit itself
+	OriginalMessageID string `json:"original_message_id"`
+	Chat              string `json:"chat"`
+	From              string `json:"from"`
+	FromName          string `json:"from_name,omitempty"`
+	ContactID         string `json:"contact_id,omitempty"`
+	IsGroup           bool   `json:"is_group"`
+	Content           string `json:"content"`
+	OriginalContent   string `json:"original_content,omitempty"`
+	Timestamp         int64  `json:"timestamp"`
+	TimestampISO      string `json:"timestamp_iso"`
+}
+
+// isEdit reports whether msg edits an earlier message. whatsmeow unwraps the
+// edit envelope, leaving the protocol message that carries the new content.
+func isEdit(msg *waE2E.Message) bool {
+	return msg.GetProtocolMessage().GetType() == waE2E.ProtocolMessage_MESSAGE_EDIT
+}
+
+// editedText returns the new text of an edit: the text, or the caption of
+// edited media.
+func editedText(msg *waE2E.Message) string {
+	switch {
+	case msg.GetConversation() != "":
+		return msg.GetConversation()
+	case msg.GetExtendedTextMessage() != nil:
+		return msg.GetExtendedTextMessage().GetText()
+	case msg.GetImageMessage() != nil:
+		return msg.GetImageMessage().GetCaption()
+	case msg.GetVideoMessage() != nil:
+		return msg.GetVideoMessage().GetCaption()
+	case msg.GetDocumentMessage() != nil:
+		return msg.GetDocumentMessage().GetCaption()
+	}
+	return ""
+}
+
+// handleInboundEdit archives a contact's edit and publishes it, unless held
+// for maintenance.
+func (b *WhatsAppBridge) handleInboundEdit(msg *events.Message, held bool) {
+	info := msg.Info
+	protocol := msg.Message.GetProtocolMessage()
+	evt := MessageEdited{
+		MessageID:         info.ID,
+		OriginalMessageID: protocol.GetKey().GetID(),
+		Chat:              info.Chat.String(),
+		From:              info.Sender.User,
+		FromName:          info.PushName,
+		ContactID:         b.resolveContact(info.Sender, info.SenderAlt),
+		IsGroup:           info.IsGroup,
+		Content:           editedText(protocol.GetEditedMessage()),
+		Timestamp:         info.Timestamp.Unix(),
+		TimestampISO:      b.formatTime(info.Timestamp),
+	}
+	if original, err := b.archiveDB.FindMessage(evt.OriginalMessageID); err == nil {
+		evt.OriginalContent = original.Content
+	}
+	log.Printf("✏️ Message %s edited by %s: %s", evt.OriginalMessageID, info.Sender.User, evt.Content)
+
+	b.archive(ArchivedMessage{
+		MessageID:   info.ID,
+		Direction:   DirectionInbound,
+		Chat:        evt.Chat,
+		Sender:      info.Sender.ToNonAD().String(),
+		Type:        "edit",
+		Content:     evt.Content,
+		ContentHash: contentHash("edit", evt.Content, nil),
+		ContactID:   evt.ContactID,
+		Timestamp:   evt.Timestamp,
+	})
+	if !held {
+		b.publish(EventMessageEdited, evt.Chat, evt)
+	}
+}
@@ -0,0 +1,37 @@
+package bridge_test
+
+import (
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow/proto/waCommon"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/phenobarbital/ai-parrot/whatsapp-bridge/bridge"
+	"github.com/phenobarbital/ai-parrot/whatsapp-bridge/bridgetest"
+)
+
+func TestInboundEdit(t *testing.T) {
+	h := bridgetest.New(t)
+	jid := types.NewJID("5215512345678", types.DefaultUserServer)
+	target := h.ReceiveText("5215512345678", "see you at 5")
+	h.ExpectMessage()
+
+	edit := h.Receive(jid, jid, &waE2E.Message{ProtocolMessage: &waE2E.ProtocolMessage{
+		Type: waE2E.ProtocolMessage_MESSAGE_EDIT.Enum(),
+		Key:  &waCommon.MessageKey{ID: proto.String(target)},
+		EditedMessage: &waE2E.Message{ExtendedTextMessage: &waE2E.ExtendedTextMessage{
+			Text: proto.String("see you at 6"),
+		}},
+	}})
+	var evt bridge.MessageEdited
+	h.DecodePayload(h.ExpectEvent(bridge.EventMessageEdited), &evt)
+	if evt.MessageID != edit || evt.OriginalMessageID != target || evt.Content != "see you at 6" ||
+		evt.OriginalContent != "see you at 5" || evt.Chat != jid.String() {
+		t.Errorf("edit published as %+v", evt)
+	}
+	// An edit is not a new message.
+	h.ExpectNoEvent(bridge.EventMessage, 50*time.Millisecond)
+}
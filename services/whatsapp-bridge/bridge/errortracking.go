@@ -0,0 +1,196 @@
+package bridge
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+)
+
+// ErrorReporter forwards handler errors, send failures and connection
+// anomalies to Sentry and/or a generic error webhook. A nil reporter is a
+// valid no-op, so call sites never need to check whether tracking is enabled.
+type ErrorReporter struct {
+	sentry      bool
+	webhookURL  string
+	sampleRate  float64
+	scrubPII    bool
+	environment string
+	httpClient  *http.Client
+}
+
+// ErrorEvent is the JSON body POSTed to ERROR_WEBHOOK_URL.
+type ErrorEvent struct {
+	Level       string            `json:"level"`
+	Category    string            `json:"category"`
+	Message     string            `json:"message"`
+	Context     map[string]string `json:"context,omitempty"`
+	Environment string            `json:"environment,omitempty"`
+	Timestamp   int64             `json:"timestamp"`
+}
+
+// piiContextKeys lists context fields that carry phone numbers or JIDs.
+var piiContextKeys = map[string]bool{"jid": true, "phone": true, "from": true, "to": true, "chat": true, "sender": true}
+
+// phonePattern matches digit runs long enough to be phone numbers.
+var phonePattern = regexp.MustCompile(`\d{7,}`)
+
+// NewErrorReporterFromEnv builds a reporter from SENTRY_DSN / ERROR_WEBHOOK_URL.
+// It returns nil when neither destination is configured.
+func NewErrorReporterFromEnv() *ErrorReporter {
+	dsn := envString("SENTRY_DSN", "")
+	webhookURL := envString("ERROR_WEBHOOK_URL", "")
+	if dsn == "" && webhookURL == "" {
+		return nil
+	}
+
+	r := &ErrorReporter{
+		webhookURL:  webhookURL,
+		sampleRate:  envFloat("ERROR_SAMPLE_RATE", 1.0),
+		scrubPII:    envBool("ERROR_SCRUB_PII", true),
+		environment: envString("ERROR_ENVIRONMENT", "production"),
+		httpClient:  &http.Client{Timeout: 5 * time.Second},
+	}
+
+	if dsn != "" {
+		err := sentry.Init(sentry.ClientOptions{
+			Dsn:            dsn,
+			Environment:    r.environment,
+			SendDefaultPII: !r.scrubPII,
+			// Sampling is applied by the reporter so Sentry and the webhook agree.
+			SampleRate: 1.0,
+		})
+		if err != nil {
+			log.Printf("⚠️ Sentry initialization failed: %v", err)
+		} else {
+			r.sentry = true
+		}
+	}
+
+	return r
+}
+
+// Capture reports an error under the given category with optional context.
+func (r *ErrorReporter) Capture(err error, category string, ctx map[string]string) {
+	if r == nil || err == nil {
+		return
+	}
+	r.report("error", category, err.Error(), err, ctx)
+}
+
+// CaptureMessage reports a non-error anomaly (e.g. a disconnect) at the given level.
+func (r *ErrorReporter) CaptureMessage(level, category, message string, ctx map[string]string) {
+	if r == nil {
+		return
+	}
+	r.report(level, category, message, nil, ctx)
+}
+
+// Flush waits for buffered Sentry events to be delivered.
+func (r *ErrorReporter) Flush(timeout time.Duration) {
+	if r == nil || !r.sentry {
+		return
+	}
+	sentry.Flush(timeout)
+}
+
+func (r *ErrorReporter) report(level, category, message string, err error, ctx map[string]string) {
+	if r.sampleRate < 1.0 && rand.Float64() >= r.sampleRate {
+		return
+	}
+
+	message = r.scrub(message)
+	scrubbed := make(map[string]string, len(ctx))
+	for k, v := range ctx {
+		if r.scrubPII && piiContextKeys[k] {
+			v = maskIdentifier(v)
+		}
+		scrubbed[k] = r.scrub(v)
+	}
+
+	if r.sentry {
+		sentry.WithScope(func(scope *sentry.Scope) {
+			scope.SetLevel(sentry.Level(level))
+			scope.SetTag("category", category)
+			for k, v := range scrubbed {
+				scope.SetTag(k, v)
+			}
+			if err != nil {
+				sentry.CaptureException(fmt.Errorf("%s", message))
+			} else {
+				sentry.CaptureMessage(message)
+			}
+		})
+	}
+
+	if r.webhookURL != "" {
+		go r.postWebhook(ErrorEvent{
+			Level:       level,
+			Category:    category,
+			Message:     message,
+			Context:     scrubbed,
+			Environment: r.environment,
+			Timestamp:   time.Now().Unix(),
+		})
+	}
+}
+
+func (r *ErrorReporter) postWebhook(evt ErrorEvent) {
+	data, err := json.Marshal(evt)
+	if err != nil {
+		return
+	}
+	resp, err := r.httpClient.Post(r.webhookURL, "application/json", bytes.NewReader(data))
+	if err != nil {
+		log.Printf("Error posting to error webhook: %v", err)
+		return
+	}
+	resp.Body.Close()
+}
+
+// scrub masks phone-number-like digit runs when PII scrubbing is enabled.
+func (r *ErrorReporter) scrub(s string) string {
+	if !r.scrubPII {
+		return s
+	}
+	return phonePattern.ReplaceAllStringFunc(s, maskIdentifier)
+}
+
+// maskIdentifier keeps only the last four characters of the user part of a
+// phone number or JID, e.g. "5215512345678@s.whatsapp.net" -> "*********5678@s.whatsapp.net".
+func maskIdentifier(s string) string {
+	user, server, hasServer := strings.Cut(s, "@")
+	if len(user) > 4 {
+		user = strings.Repeat("*", len(user)-4) + user[len(user)-4:]
+	}
+	if hasServer {
+		return user + "@" + server
+	}
+	return user
+}
+
+// recoverMiddleware turns handler panics into 500 responses and reports them.
+func (b *WhatsAppBridge) recoverMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if rec := recover(); rec != nil {
+				log.Printf("❌ Panic in %s %s: %v", r.Method, r.URL.Path, rec)
+				b.reporter.Capture(fmt.Errorf("panic: %v", rec), "handler_panic", map[string]string{
+					"method": r.Method,
+					"path":   r.URL.Path,
+				})
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(Response{Success: false, Error: "internal server error"})
+			}
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,242 @@
+package bridge
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// Event types for WhatsApp activity other than messages.
+const (
+	EventPresence     = "presence"      // a contact came online or went offline
+	EventChatPresence = "chat_presence" // typing or recording in a chat
+	EventGroupUpdate  = "group_update"  // membership, name, topic or settings changed
+	EventCall         = "call"          // incoming call offered, accepted, rejected or ended
+	EventConnection   = "connection"    // the WhatsApp session changed state
+)
+
+// Event categories selectable with PUBLISH_EVENTS.
+const (
+	CategoryMessages = "messages"
+	CategoryReceipts = "receipts"
+	CategoryPresence = "presence"
+	CategoryGroups   = "groups"
+	CategoryCalls    = "calls"
+	CategoryState    = "state"
+)
+
+var eventCategoryNames = []string{CategoryMessages, CategoryReceipts, CategoryPresence, CategoryGroups, CategoryCalls, CategoryState}
+
+// eventCategories maps event types to their category. Events answering an
+// API call (campaign, consent, identity and similar bookkeeping) have none
+// and are always published.
+var eventCategories = map[string]string{
+	EventMessage:          CategoryMessages,
+	EventGroupDigest:      CategoryMessages,
+	EventPollVote:         CategoryMessages,
+	EventReaction:         CategoryMessages,
+	EventReactionsUpdated: CategoryMessages,
+	EventMessageEdited:    CategoryMessages,
+	EventMessageDeleted:   CategoryMessages,
+	EventFeedback:         CategoryMessages,
+	EventConversationIdle: CategoryMessages,
+	EventMediaRejected:    CategoryMessages,
+	EventMediaDownloaded:  CategoryMessages,
+	EventMediaFailed:      CategoryMessages,
+	EventMediaStored:      CategoryMessages,
+	EventAudio:            CategoryMessages,
+	EventLiveLocation:     CategoryMessages,
+	EventMessageStatus:    CategoryReceipts,
+	EventPresence:         CategoryPresence,
+	EventChatPresence:     CategoryPresence,
+	EventGroupUpdate:      CategoryGroups,
+	EventCall:             CategoryCalls,
+	EventConnection:       CategoryState,
+	EventAccountHealth:    CategoryState,
+	EventResyncProgress:   CategoryState,
+	EventLabel:            CategoryState,
+	EventLifecycle:        CategoryState,
+	EventSessionVerified:  CategoryState,
+}
+
+// EventFilter holds the categories named in PUBLISH_EVENTS (default
+// "messages"; "all" enables every category). Disabled events are dropped
+// before reaching any sink or stream, so nobody pays for unused events.
+type EventFilter map[string]bool
+
+func eventFilterFromEnv() (EventFilter, error) {
+	names := envList("PUBLISH_EVENTS")
+	if len(names) == 0 {
+		names = []string{CategoryMessages}
+	}
+	known := eventCategoryNames
+	filter := make(EventFilter)
+	for _, name := range names {
+		name = strings.ToLower(name)
+		if name == "all" {
+			for _, category := range known {
+				filter[category] = true
+			}
+			continue
+		}
+		if !containsString(known, name) {
+			return nil, fmt.Errorf("unknown PUBLISH_EVENTS category %q (known: all, %s)", name, strings.Join(known, ", "))
+		}
+		filter[name] = true
+	}
+	return filter, nil
+}
+
+// Enabled reports whether events of eventType are published.
+func (f EventFilter) Enabled(eventType string) bool {
+	category, ok := eventCategories[eventType]
+	return !ok || f == nil || f[category]
+}
+
+// PresenceEvent is the payload of presence events.
+type PresenceEvent struct {
+	JID       string `json:"jid"`
+	Available bool   `json:"available"`
+	LastSeen  int64  `json:"last_seen,omitempty"` // 0 when hidden
+}
+
+// ChatPresenceEvent is the payload of chat_presence events.
+type ChatPresenceEvent struct {
+	Chat   string `json:"chat"`
+	Sender string `json:"sender"`
+	State  string `json:"state"`           // composing or paused
+	Media  string `json:"media,omitempty"` // audio while recording a voice note
+}
+
+// GroupUpdateEvent is the payload of group_update events; only the fields
+// that changed are set.
+type GroupUpdateEvent struct {
+	Chat         string   `json:"chat"`
+	Type         string   `json:"type"` // update, or joined when we were added
+	Author       string   `json:"author,omitempty"`
+	Name         string   `json:"name,omitempty"`
+	Topic        string   `json:"topic,omitempty"`
+	Announce     *bool    `json:"announce,omitempty"` // only admins can send
+	Locked       *bool    `json:"locked,omitempty"`   // only admins can edit info
+	EphemeralTTL *uint32  `json:"ephemeral_ttl,omitempty"`
+	Deleted      bool     `json:"deleted,omitempty"`
+	Joined       []string `json:"joined,omitempty"`
+	Left         []string `json:"left,omitempty"`
+	Promoted     []string `json:"promoted,omitempty"`
+	Demoted      []string `json:"demoted,omitempty"`
+	Timestamp    int64    `json:"timestamp"`
+}
+
+// CallEvent is the payload of call events.
+type CallEvent struct {
+	CallID    string `json:"call_id"`
+	From      string `json:"from"`
+	Group     string `json:"group,omitempty"`
+	State     string `json:"state"` // offer, accept, reject or terminate
+	Media     string `json:"media,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+// ConnectionEvent is the payload of connection events.
+type ConnectionEvent struct {
+	State     string `json:"state"` // connected, disconnected, logged_out, stream_replaced, temporary_ban, connect_failure
+	Detail    string `json:"detail,omitempty"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+func (b *WhatsAppBridge) publishConnection(state, detail string) {
+	b.publish(EventConnection, "", ConnectionEvent{State: state, Detail: detail, Timestamp: time.Now().Unix()})
+}
+
+func (b *WhatsAppBridge) publishPresence(v *events.Presence) {
+	evt := PresenceEvent{JID: v.From.ToNonAD().String(), Available: !v.Unavailable}
+	if !v.LastSeen.IsZero() {
+		evt.LastSeen = v.LastSeen.Unix()
+	}
+	b.publish(EventPresence, evt.JID, evt)
+}
+
+func (b *WhatsAppBridge) publishChatPresence(v *events.ChatPresence) {
+	b.publish(EventChatPresence, v.Chat.String(), ChatPresenceEvent{
+		Chat:   v.Chat.String(),
+		Sender: v.Sender.ToNonAD().String(),
+		State:  string(v.State),
+		Media:  string(v.Media),
+	})
+}
+
+func (b *WhatsAppBridge) publishGroupUpdate(v *events.GroupInfo) {
+	evt := GroupUpdateEvent{
+		Chat:      v.JID.String(),
+		Type:      "update",
+		Deleted:   v.Delete != nil,
+		Joined:    jidStrings(v.Join),
+		Left:      jidStrings(v.Leave),
+		Promoted:  jidStrings(v.Promote),
+		Demoted:   jidStrings(v.Demote),
+		Timestamp: v.Timestamp.Unix(),
+	}
+	if v.Sender != nil {
+		evt.Author = v.Sender.ToNonAD().String()
+	}
+	if v.Name != nil {
+		evt.Name = v.Name.Name
+	}
+	if v.Topic != nil {
+		evt.Topic = v.Topic.Topic
+	}
+	if v.Announce != nil {
+		evt.Announce = &v.Announce.IsAnnounce
+	}
+	if v.Locked != nil {
+		evt.Locked = &v.Locked.IsLocked
+	}
+	if v.Ephemeral != nil {
+		evt.EphemeralTTL = &v.Ephemeral.DisappearingTimer
+	}
+	b.publish(EventGroupUpdate, evt.Chat, evt)
+}
+
+func (b *WhatsAppBridge) publishJoinedGroup(v *events.JoinedGroup) {
+	evt := GroupUpdateEvent{
+		Chat:      v.JID.String(),
+		Type:      "joined",
+		Name:      v.Name,
+		Topic:     v.Topic,
+		Timestamp: time.Now().Unix(),
+	}
+	if v.Sender != nil {
+		evt.Author = v.Sender.ToNonAD().String()
+	}
+	b.publish(EventGroupUpdate, evt.Chat, evt)
+}
+
+func (b *WhatsAppBridge) publishCall(meta types.BasicCallMeta, state, media, reason string) {
+	evt := CallEvent{
+		CallID:    meta.CallID,
+		From:      meta.From.ToNonAD().String(),
+		State:     state,
+		Media:     media,
+		Reason:    reason,
+		Timestamp: meta.Timestamp.Unix(),
+	}
+	if !meta.GroupJID.IsEmpty() {
+		evt.Group = meta.GroupJID.String()
+	}
+	b.publish(EventCall, evt.From, evt)
+}
+
+func jidStrings(jids []types.JID) []string {
+	if len(jids) == 0 {
+		return nil
+	}
+	out := make([]string, len(jids))
+	for i, jid := range jids {
+		out[i] = jid.ToNonAD().String()
+	}
+	return out
+}
@@ -0,0 +1,250 @@
+package bridge
+
+import (
+	"database/sql"
+	"log"
+	"strings"
+	"time"
+	"unicode"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+// EventFeedback carries agent-quality signals derived from how contacts
+// respond to the bridge's messages. Redis sinks publish it on
+// whatsapp:feedback.
+const EventFeedback = "feedback"
+
+// Feedback signals.
+const (
+	FeedbackNegativeReaction = "negative_reaction" // a negative emoji on one of our messages
+	FeedbackPositiveReaction = "positive_reaction" // a positive emoji on one of our messages
+	FeedbackRephrase         = "rephrase"          // the contact asked the same question again after our reply
+	FeedbackHumanRequest     = "human_request"     // the contact asked for a person
+)
+
+// FeedbackDetector turns reactions and inbound texts into feedback events.
+// A nil detector detects nothing.
+//
+//	FEEDBACK_ENABLED              - detect feedback signals (default false)
+//	FEEDBACK_NEGATIVE_EMOJIS      - reactions counted as negative (default 👎,😡,😠,😞,👿)
+//	FEEDBACK_POSITIVE_EMOJIS      - reactions counted as positive (default 👍,❤️,🙏,👏,😍)
+//	FEEDBACK_HUMAN_KEYWORDS       - words or phrases asking for a person
+//	FEEDBACK_REPHRASE_WINDOW      - how soon after our reply a repeated question
+//	                                counts as a rephrase (default 10m)
+//	FEEDBACK_REPHRASE_SIMILARITY  - share of words two questions must have in
+//	                                common to be the same one (default 0.5)
+type FeedbackDetector struct {
+	NegativeEmojis     []string
+	PositiveEmojis     []string
+	HumanKeywords      []string
+	RephraseWindow     time.Duration
+	RephraseSimilarity float64
+
+	bridge *WhatsAppBridge
+}
+
+// Feedback is the payload of feedback events.
+type Feedback struct {
+	Signal       string  `json:"signal"`
+	Chat         string  `json:"chat"`
+	From         string  `json:"from"`
+	ContactID    string  `json:"contact_id,omitempty"`
+	MessageID    string  `json:"message_id"`               // the contact's message or reaction
+	BotMessageID string  `json:"bot_message_id,omitempty"` // our message the signal is about
+	BotMessage   string  `json:"bot_message,omitempty"`
+	Text         string  `json:"text,omitempty"`   // the contact's message
+	Detail       string  `json:"detail,omitempty"` // the emoji, the matched keyword or the earlier question
+	Similarity   float64 `json:"similarity,omitempty"`
+	Timestamp    int64   `json:"timestamp"`
+	TimestampISO string  `json:"timestamp_iso"`
+}
+
+func (b *WhatsAppBridge) feedbackFromEnv() *FeedbackDetector {
+	if !envBool("FEEDBACK_ENABLED", false) {
+		return nil
+	}
+	f := &FeedbackDetector{
+		NegativeEmojis:     envList("FEEDBACK_NEGATIVE_EMOJIS"),
+		PositiveEmojis:     envList("FEEDBACK_POSITIVE_EMOJIS"),
+		HumanKeywords:      envList("FEEDBACK_HUMAN_KEYWORDS"),
+		RephraseWindow:     envDuration("FEEDBACK_REPHRASE_WINDOW", 10*time.Minute),
+		RephraseSimilarity: envFloat("FEEDBACK_REPHRASE_SIMILARITY", 0.5),
+		bridge:             b,
+	}
+	if len(f.NegativeEmojis) == 0 {
+		f.NegativeEmojis = []string{"👎", "😡", "😠", "😞", "👿"}
+	}
+	if len(f.PositiveEmojis) == 0 {
+		f.PositiveEmojis = []string{"👍", "❤️", "🙏", "👏", "😍"}
+	}
+	if len(f.HumanKeywords) == 0 {
+		f.HumanKeywords = []string{
+			"human", "real person", "agent", "representative", "operator",
+			"humano", "persona real", "agente", "asesor", "operador",
+		}
+	}
+	return f
+}
+
+// Reaction reports a reaction to one of our messages.
+func (f *FeedbackDetector) Reaction(info types.MessageInfo, contactID, target, emoji string) {
+	if f == nil || emoji == "" {
+		return
+	}
+	archived, err := f.bridge.archiveDB.FindMessage(target)
+	if err != nil || archived.Direction != DirectionOutbound {
+		return
+	}
+	signal := ""
+	switch {
+	case containsEmoji(f.NegativeEmojis, emoji):
+		signal = FeedbackNegativeReaction
+	case containsEmoji(f.PositiveEmojis, emoji):
+		signal = FeedbackPositiveReaction
+	default:
+		return
+	}
+	f.publish(info, Feedback{
+		Signal:       signal,
+		ContactID:    contactID,
+		BotMessageID: archived.MessageID,
+		BotMessage:   archived.Content,
+		Detail:       emoji,
+	})
+}
+
+// Text checks an archived inbound text for a request for a person and for
+// a rephrase of the question our last reply answered.
+func (f *FeedbackDetector) Text(info types.MessageInfo, msg IncomingMessage) {
+	if f == nil || msg.Type != "text" || msg.Content == "" {
+		return
+	}
+	exchange, err := f.bridge.archiveDB.lastExchange(info.Chat.String(), info.Sender.ToNonAD().String())
+	if err != nil {
+		log.Printf("Error loading the last exchange of %s: %v", info.Chat, err)
+		return
+	}
+	base := Feedback{ContactID: msg.ContactID, Text: msg.Content}
+	if exchange != nil {
+		base.BotMessageID, base.BotMessage = exchange.answer.MessageID, exchange.answer.Content
+	}
+
+	if keyword := f.humanKeyword(msg.Content); keyword != "" {
+		evt := base
+		evt.Signal, evt.Detail = FeedbackHumanRequest, keyword
+		f.publish(info, evt)
+	}
+
+	// A rephrase is the first message after our reply, soon after it.
+	if exchange == nil || exchange.question == nil || exchange.since != 1 ||
+		msg.Timestamp-exchange.answer.Timestamp > int64(f.RephraseWindow.Seconds()) {
+		return
+	}
+	if similarity := wordSimilarity(exchange.question.Content, msg.Content); similarity >= f.RephraseSimilarity {
+		evt := base
+		evt.Signal, evt.Detail, evt.Similarity = FeedbackRephrase, exchange.question.Content, similarity
+		f.publish(info, evt)
+	}
+}
+
+func (f *FeedbackDetector) publish(info types.MessageInfo, evt Feedback) {
+	evt.Chat = info.Chat.String()
+	evt.From = info.Sender.ToNonAD().String()
+	evt.MessageID = info.ID
+	evt.Timestamp = info.Timestamp.Unix()
+	evt.TimestampISO = f.bridge.formatTime(info.Timestamp)
+	log.Printf("📊 Feedback from %s: %s %s", info.Sender.User, evt.Signal, evt.Detail)
+	f.bridge.publish(EventFeedback, evt.Chat, evt)
+}
+
+// humanKeyword returns the keyword of text asking for a person, matched as
+// whole words.
+func (f *FeedbackDetector) humanKeyword(text string) string {
+	normalized := " " + strings.Join(words(text), " ") + " "
+	for _, keyword := range f.HumanKeywords {
+		if phrase := strings.Join(words(keyword), " "); phrase != "" && strings.Contains(normalized, " "+phrase+" ") {
+			return keyword
+		}
+	}
+	return ""
+}
+
+// words lowercases text and splits it into words, in order.
+func words(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// wordSimilarity is the Jaccard index of the word sets of a and b.
+func wordSimilarity(a, b string) float64 {
+	wa, wb := wordSet(a), wordSet(b)
+	if len(wa) == 0 || len(wb) == 0 {
+		return 0
+	}
+	shared := 0
+	for w := range wa {
+		if wb[w] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(wa)+len(wb)-shared)
+}
+
+// containsEmoji reports whether list has emoji, ignoring the variation
+// selectors and skin tones clients add, so 👍🏽 counts as 👍.
+func containsEmoji(list []string, emoji string) bool {
+	normalize := func(s string) string {
+		return strings.Map(func(r rune) rune {
+			if r == 0xfe0f || (r >= 0x1f3fb && r <= 0x1f3ff) {
+				return -1
+			}
+			return r
+		}, s)
+	}
+	for _, item := range list {
+		if normalize(item) == normalize(emoji) {
+			return true
+		}
+	}
+	return false
+}
+
+// exchange is the last reply we sent in a chat and the sender's text
+// before it.
+type exchange struct {
+	answer   ArchivedMessage
+	question *ArchivedMessage // nil when the sender wrote no text before the reply
+	since    int              // inbound messages after the reply
+}
+
+// lastExchange returns the chat's last exchange with sender, or nil when
+// we never wrote in the chat or the archive is disabled.
+func (a *Archive) lastExchange(chat, sender string) (*exchange, error) {
+	if a == nil {
+		return nil, nil
+	}
+	answer, err := scanMessage(a.db.QueryRow(`SELECT `+messageColumns+` FROM messages
+		WHERE chat = ? AND direction = ? ORDER BY id DESC LIMIT 1`, chat, DirectionOutbound))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	ex := &exchange{answer: answer}
+	if err := a.db.QueryRow(`SELECT COUNT(*) FROM messages WHERE chat = ? AND direction = ? AND id > ?`,
+		chat, DirectionInbound, answer.ID).Scan(&ex.since); err != nil {
+		return nil, err
+	}
+	question, err := scanMessage(a.db.QueryRow(`SELECT `+messageColumns+` FROM messages
+		WHERE chat = ? AND direction = ? AND sender = ? AND type = 'text' AND id < ? ORDER BY id DESC LIMIT 1`,
+		chat, DirectionInbound, sender, answer.ID))
+	if err == nil {
+		ex.question = &question
+	} else if err != sql.ErrNoRows {
+		return nil, err
+	}
+	return ex, nil
+}
@@ -0,0 +1,26 @@
+package bridge_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/phenobarbital/ai-parrot/whatsapp-bridge/bridge"
+	"github.com/phenobarbital/ai-parrot/whatsapp-bridge/bridgetest"
+)
+
+func TestFeedbackHumanRequest(t *testing.T) {
+	h := bridgetest.New(t, bridgetest.WithEnv("FEEDBACK_ENABLED", "true"))
+	id := h.ReceiveText("5215512345678", "Quiero hablar con un humano, por favor")
+
+	var fb bridge.Feedback
+	h.DecodePayload(h.ExpectEvent(bridge.EventFeedback), &fb)
+	if fb.Signal != bridge.FeedbackHumanRequest || fb.Detail != "humano" || fb.MessageID != string(id) {
+		t.Fatalf("feedback = %+v", fb)
+	}
+}
+
+func TestFeedbackOffByDefault(t *testing.T) {
+	h := bridgetest.New(t)
+	h.ReceiveText("5215512345678", "Quiero hablar con un humano")
+	h.ExpectNoEvent(bridge.EventFeedback, 200*time.Millisecond)
+}
@@ -0,0 +1,141 @@
+package bridge
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// FineTuneTurn is one chat-format turn in an exported conversation.
+type FineTuneTurn struct {
+	Role    string `json:"role"` // system, user or assistant
+	Content string `json:"content"`
+}
+
+// FineTuneConversation is one JSONL line of a fine-tuning export.
+type FineTuneConversation struct {
+	Messages []FineTuneTurn `json:"messages"`
+}
+
+// PII patterns redacted from exported conversations, applied in order so
+// emails and URLs are replaced before their digits look like phone numbers.
+var redactionRules = []struct {
+	pattern     *regexp.Regexp
+	replacement string
+}{
+	{regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`), "[EMAIL]"},
+	{regexp.MustCompile(`https?://\S+`), "[URL]"},
+	{regexp.MustCompile(`\b(?:\d{4}[ -]){3}\d{4}\b|\b\d{16}\b`), "[CARD]"}, // E.164 numbers stop at 15 digits
+	{regexp.MustCompile(`\+?\d[\d\s().-]{6,}\d`), "[PHONE]"},
+}
+
+// redactPII replaces emails, URLs, card and phone numbers with placeholders.
+func redactPII(s string) string {
+	for _, rule := range redactionRules {
+		s = rule.pattern.ReplaceAllString(s, rule.replacement)
+	}
+	return s
+}
+
+// buildConversations turns one chat's archived messages (oldest first) into
+// user/assistant conversations. Inbound messages are user turns, outbound
+// ones assistant turns; consecutive messages from the same side are joined,
+// and a silence longer than gap starts a new conversation. Conversations
+// without both a user and an assistant turn are dropped.
+func buildConversations(messages []ArchivedMessage, gap time.Duration, system string) []FineTuneConversation {
+	var out []FineTuneConversation
+	var turns []FineTuneTurn
+	var last int64
+
+	flush := func() {
+		// Unanswered trailing user turns teach nothing; trim them.
+		for len(turns) > 0 && turns[len(turns)-1].Role == "user" {
+			turns = turns[:len(turns)-1]
+		}
+		if len(turns) > 0 {
+			conv := FineTuneConversation{}
+			if system != "" {
+				conv.Messages = append(conv.Messages, FineTuneTurn{Role: "system", Content: system})
+			}
+			conv.Messages = append(conv.Messages, turns...)
+			out = append(out, conv)
+		}
+		turns = nil
+	}
+
+	for _, m := range messages {
+		content := strings.TrimSpace(m.Content)
+		if content == "" {
+			continue
+		}
+		if last != 0 && time.Duration(m.Timestamp-last)*time.Second > gap {
+			flush()
+		}
+		last = m.Timestamp
+
+		role := "user"
+		if m.Direction == DirectionOutbound {
+			role = "assistant"
+		}
+		// A conversation must open with the user; leading agent messages
+		// (e.g. proactive notifications) carry no prompt to learn from.
+		if len(turns) == 0 && role == "assistant" {
+			continue
+		}
+		content = redactPII(content)
+		if n := len(turns); n > 0 && turns[n-1].Role == role {
+			turns[n-1].Content += "\n" + content
+			continue
+		}
+		turns = append(turns, FineTuneTurn{Role: role, Content: content})
+	}
+	flush()
+	return out
+}
+
+// handleFineTuneExport serves GET /archive/finetune, streaming JSONL
+// conversations for fine-tuning. It accepts the archive filters plus a
+// repeatable chat parameter, gap (session split, default 6h) and system (an
+// optional system prompt prepended to every conversation). Inbound and
+// outbound text is always PII-redacted.
+func (b *WhatsAppBridge) handleFineTuneExport(w http.ResponseWriter, r *http.Request) {
+	f, err := parseArchiveFilter(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, Response{Success: false, Error: err.Error()})
+		return
+	}
+	gap := 6 * time.Hour
+	if v := r.URL.Query().Get("gap"); v != "" {
+		if gap, err = time.ParseDuration(v); err != nil || gap <= 0 {
+			writeJSON(w, http.StatusBadRequest, Response{Success: false, Error: fmt.Sprintf("invalid gap: %q", v)})
+			return
+		}
+	}
+	system := r.URL.Query().Get("system")
+
+	chats := r.URL.Query()["chat"]
+	if len(chats) == 0 {
+		if chats, err = b.archiveDB.Chats(f); err != nil {
+			writeJSON(w, http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", `attachment; filename="finetune.jsonl"`)
+	enc := json.NewEncoder(w)
+	for _, chat := range chats {
+		f.Chat = chat
+		messages, err := b.archiveDB.Query(f)
+		if err != nil {
+			b.reporter.Capture(err, "finetune_export", map[string]string{"chat": chat})
+			return
+		}
+		for _, conv := range buildConversations(messages, gap, system) {
+			enc.Encode(conv)
+		}
+	}
+}
@@ -0,0 +1,322 @@
+package bridge
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/phenobarbital/ai-parrot/whatsapp-bridge/bridgepb"
+)
+
+// gRPC API (see bridgepb/bridge.proto), enabled by GRPC_ADDR (e.g. ":8766"):
+// a server stream of the published events and unary and bidirectional
+// streaming sends. GRPC_EVENT_BUFFER sets how many events a slow client may
+// fall behind before events are dropped for it (default 256).
+
+// grpcServer implements bridgepb.WhatsAppBridgeServer. It is also the sink
+// that feeds the Events streams.
+type grpcServer struct {
+	bridgepb.UnimplementedWhatsAppBridgeServer
+	bridge *WhatsAppBridge
+	addr   string
+	buffer int
+
+	mu          sync.Mutex
+	subscribers map[*grpcSubscriber]struct{}
+}
+
+type grpcSubscriber struct {
+	types  []string
+	chats  []string
+	events chan BridgeEvent
+}
+
+// grpcServerFromEnv returns nil unless GRPC_ADDR is set.
+func (b *WhatsAppBridge) grpcServerFromEnv() *grpcServer {
+	addr := envString("GRPC_ADDR", "")
+	if addr == "" {
+		return nil
+	}
+	return &grpcServer{
+		bridge:      b,
+		addr:        addr,
+		buffer:      envInt("GRPC_EVENT_BUFFER", 256),
+		subscribers: make(map[*grpcSubscriber]struct{}),
+	}
+}
+
+func (s *grpcServer) Name() string { return "grpc" }
+
+// Deliver hands evt to every matching Events stream without blocking.
+func (s *grpcServer) Deliver(ctx context.Context, evt BridgeEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for sub := range s.subscribers {
+		if len(sub.types) > 0 && !containsString(sub.types, evt.Type) {
+			continue
+		}
+		if len(sub.chats) > 0 && !matchesAny(sub.chats, evt.Chat) {
+			continue
+		}
+		select {
+		case sub.events <- evt:
+		default:
+			log.Printf("⚠️ gRPC event stream is behind, dropping %s event", evt.Type)
+		}
+	}
+	return nil
+}
+
+// serve runs the gRPC server until the bridge context is cancelled.
+func (s *grpcServer) serve() {
+	lis, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		log.Printf("❌ gRPC server failed to listen on %s: %v", s.addr, err)
+		return
+	}
+	srv := grpc.NewServer(
+		grpc.UnaryInterceptor(s.authUnary),
+		grpc.StreamInterceptor(s.authStream),
+	)
+	bridgepb.RegisterWhatsAppBridgeServer(srv, s)
+	go func() {
+		<-s.bridge.intake.Done()
+		stopped := make(chan struct{})
+		go func() {
+			srv.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-s.bridge.ctx.Done():
+			srv.Stop() // streams still open at Shutdown are cut
+		}
+	}()
+	log.Printf("🔌 gRPC API listening on %s", s.addr)
+	if err := srv.Serve(lis); err != nil {
+		log.Printf("gRPC server stopped: %v", err)
+	}
+}
+
+// authorize resolves the caller from the "x-api-key" or "authorization"
+// metadata, like the HTTP API's headers.
+func (s *grpcServer) authorize(ctx context.Context) (context.Context, error) {
+	auth := s.bridge.auth
+	if !auth.Enabled() {
+		return withOperator(ctx, anonymousOperator), nil
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	first := func(key string) string {
+		if values := md.Get(key); len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+	operator, err := auth.authenticateCredentials(first("x-api-key"), first("authorization"))
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	return withOperator(ctx, operator), nil
+}
+
+func (s *grpcServer) authUnary(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	ctx, err := s.authorize(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// authedStream carries the authenticated context into stream handlers.
+type authedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s authedStream) Context() context.Context { return s.ctx }
+
+func (s *grpcServer) authStream(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := s.authorize(ss.Context())
+	if err != nil {
+		return err
+	}
+	return handler(srv, authedStream{ServerStream: ss, ctx: ctx})
+}
+
+func (s *grpcServer) Events(req *bridgepb.EventsRequest, stream grpc.ServerStreamingServer[bridgepb.Event]) error {
+	sub := &grpcSubscriber{types: req.GetTypes(), chats: req.GetChats(), events: make(chan BridgeEvent, s.buffer)}
+	s.mu.Lock()
+	s.subscribers[sub] = struct{}{}
+	bufferMarks.observe("grpc_subscribers", "", int64(len(s.subscribers)))
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.subscribers, sub)
+		s.mu.Unlock()
+	}()
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case <-s.bridge.intake.Done():
+			return status.Error(codes.Unavailable, "bridge is shutting down")
+		case evt := <-sub.events:
+			out, err := eventToProto(evt)
+			if err != nil {
+				log.Printf("Error encoding %s event for gRPC: %v", evt.Type, err)
+				continue
+			}
+			if err := stream.Send(out); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func eventToProto(evt BridgeEvent) (*bridgepb.Event, error) {
+	payload, err := evt.MarshalPayload()
+	if err != nil {
+		return nil, err
+	}
+	out := &bridgepb.Event{Type: evt.Type, Chat: evt.Chat, Route: evt.Route, PayloadJson: string(payload)}
+	if msg, ok := evt.Payload.(IncomingMessage); ok {
+		out.Message = &bridgepb.IncomingMessage{
+			From:         msg.From,
+			FromServer:   msg.FromServer,
+			FromName:     msg.FromName,
+			Content:      msg.Content,
+			Type:         msg.Type,
+			Media:        msg.Media,
+			Timestamp:    msg.Timestamp,
+			TimestampIso: msg.TimestampISO,
+			Timezone:     msg.Timezone,
+			MessageId:    msg.MessageID,
+			IsGroup:      msg.IsGroup,
+			GroupName:    msg.GroupName,
+			ContentHash:  msg.ContentHash,
+			ContactId:    msg.ContactID,
+			Route:        msg.Route,
+			Consent:      msg.Consent,
+		}
+	}
+	return out, nil
+}
+
+func outgoingFromProto(m *bridgepb.OutgoingMessage) OutgoingMessage {
+	msg := OutgoingMessage{
+		Phone:              m.GetPhone(),
+		Server:             m.GetServer(),
+		Message:            m.GetMessage(),
+		MediaURL:           m.GetMediaUrl(),
+		ChatType:           m.GetChatType(),
+		ReplyToMessageID:   m.GetReplyToMessageId(),
+		ReplyToParticipant: m.GetReplyToParticipant(),
+		ReplyToText:        m.GetReplyToText(),
+		Mentions:           m.GetMentions(),
+		ViewOnce:           m.GetViewOnce(),
+		EphemeralTTL:       int(m.GetEphemeralTtl()),
+		Raw:                m.GetRaw(),
+		ConsentOverride:    m.GetConsentOverride(),
+		ClientMessageID:    m.GetClientMessageId(),
+		Language:           m.GetLanguage(),
+		Template:           m.GetTemplate(),
+	}
+	for _, s := range m.GetSuggestions() {
+		msg.Suggestions = append(msg.Suggestions, Suggestion{ID: s.GetId(), Title: s.GetTitle()})
+	}
+	if params := m.GetParams(); params != nil {
+		msg.Params = params.AsMap()
+	}
+	return msg
+}
+
+// send sends one message like POST /send, with client_message_id as the
+// idempotency key. Failures come back both in the response and as a gRPC
+// status error.
+func (s *grpcServer) send(ctx context.Context, m *bridgepb.OutgoingMessage) (*bridgepb.SendResponse, error) {
+	b := s.bridge
+	msg := outgoingFromProto(m)
+	resp := &bridgepb.SendResponse{ClientMessageId: msg.ClientMessageID}
+	fail := func(code codes.Code, err error) (*bridgepb.SendResponse, error) {
+		resp.Status, resp.Error = "failed", err.Error()
+		return resp, status.Error(code, err.Error())
+	}
+	if err := msg.Validate(); err != nil {
+		return fail(codes.InvalidArgument, err)
+	}
+
+	ctx = context.WithoutCancel(ctx)
+	result, previous, replayed, err := b.sendIdempotent(ctx, operatorFromContext(ctx), msg.ClientMessageID, msg)
+	switch {
+	case errors.Is(err, errIdempotencyInProgress), errors.Is(err, errIdempotencyMismatch):
+		return fail(codes.AlreadyExists, err)
+	case replayed:
+		resp.Status = "duplicate"
+		resp.MessageId, _ = previous["message_id"].(string)
+		return resp, nil
+	}
+	if err != nil {
+		resp.MessageId = result.ID
+		var limited *RateLimitError
+		code := codes.Internal
+		switch {
+		case errors.As(err, &limited):
+			code = codes.ResourceExhausted
+		case isPartialSend(err):
+			resp.PartIds = result.PartIDs
+		case errors.Is(err, errNoConsent), errors.Is(err, errTemplateRequired):
+			code = codes.PermissionDenied
+		case errors.Is(err, errNotOnWhatsApp):
+			code = codes.NotFound
+		case errors.Is(err, errPermanent):
+			code = codes.InvalidArgument
+		}
+		return fail(code, err)
+	}
+
+	resp.Status, resp.MessageId = result.status(), result.ID
+	if !result.Queued {
+		resp.Timestamp = result.Timestamp.Unix()
+	}
+	if len(result.PartIDs) > 1 {
+		resp.PartIds = result.PartIDs
+	}
+	return resp, nil
+}
+
+// Send rejects sends the pacer cannot take within RATE_LIMIT_MAX_WAIT with
+// RESOURCE_EXHAUSTED, like the HTTP API's 429.
+func (s *grpcServer) Send(ctx context.Context, m *bridgepb.OutgoingMessage) (*bridgepb.SendResponse, error) {
+	resp, err := s.send(context.WithValue(ctx, rejectOverLimitKey{}, true), m)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// SendStream sends messages in order, waiting for the pacer; a failed send
+// is reported in its response and does not end the stream.
+func (s *grpcServer) SendStream(stream grpc.BidiStreamingServer[bridgepb.OutgoingMessage, bridgepb.SendResponse]) error {
+	for {
+		m, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		resp, _ := s.send(stream.Context(), m)
+		if err := stream.Send(resp); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package bridge
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// contentHash returns a hex sha256 over the message type, the normalized text
+// and the plaintext media hash (FileSHA256) when present. Because WhatsApp
+// keeps FileSHA256 stable across forwards, identical media yields identical
+// hashes regardless of caption whitespace or sender.
+func contentHash(msgType, content string, mediaSHA256 []byte) string {
+	h := sha256.New()
+	h.Write([]byte(msgType))
+	h.Write([]byte{'\n'})
+	h.Write([]byte(normalizeContent(content)))
+	h.Write([]byte{'\n'})
+	h.Write([]byte(hex.EncodeToString(mediaSHA256)))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// normalizeContent trims the text and collapses internal whitespace runs so
+// trivially reformatted copies hash the same.
+func normalizeContent(content string) string {
+	return strings.Join(strings.Fields(content), " ")
+}
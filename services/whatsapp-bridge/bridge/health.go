@@ -0,0 +1,206 @@
+package bridge
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// EventAccountHealth is published when the account's health score crosses
+// the alert threshold in either direction.
+const EventAccountHealth = "account_health"
+
+// Health signals tracked in the scoring window.
+const (
+	SignalSendSuccess      = "send_success"
+	SignalSendFailure      = "send_failure"
+	SignalReceiptDelivered = "receipt_delivered"
+	SignalReceiptError     = "receipt_error" // server-error receipts
+	SignalReceiptRetry     = "receipt_retry" // recipients asking for a re-send
+	SignalDisconnect       = "disconnect"
+	SignalConnectFailure   = "connect_failure"
+	SignalTemporaryBan     = "temporary_ban"
+	SignalLoggedOut        = "logged_out"
+)
+
+// Health statuses derived from the score.
+const (
+	HealthHealthy  = "healthy"  // score >= 80
+	HealthDegraded = "degraded" // score >= 50
+	HealthAtRisk   = "at_risk"  // below 50: slow down campaigns
+)
+
+// AccountHealth is returned by GET /admin/accounts/{id}/health and carried
+// by account_health events.
+type AccountHealth struct {
+	Account         string         `json:"account"`
+	Score           int            `json:"score"`
+	Status          string         `json:"status"`
+	Signals         map[string]int `json:"signals"`
+	SendFailureRate float64        `json:"send_failure_rate"`
+	Window          string         `json:"window"`
+	AlertThreshold  int            `json:"alert_threshold"`
+	Alerting        bool           `json:"alerting"`
+	Timestamp       int64          `json:"timestamp"`
+	TimestampISO    string         `json:"timestamp_iso"`
+}
+
+type healthSignal struct {
+	kind string
+	at   time.Time
+}
+
+// HealthTracker keeps ban-risk signals for the last HEALTH_WINDOW (default
+// 1h) and alerts when the score drops below HEALTH_ALERT_THRESHOLD (default
+// 60), and again once it recovers.
+type HealthTracker struct {
+	window    time.Duration
+	threshold int
+	bridge    *WhatsAppBridge
+
+	mu       sync.Mutex
+	signals  []healthSignal
+	alerting bool
+}
+
+func (b *WhatsAppBridge) healthTrackerFromEnv() *HealthTracker {
+	return &HealthTracker{
+		window:    envDuration("HEALTH_WINDOW", time.Hour),
+		threshold: envInt("HEALTH_ALERT_THRESHOLD", 60),
+		bridge:    b,
+	}
+}
+
+// Record adds a signal and re-evaluates the alert state.
+func (h *HealthTracker) Record(kind string) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	h.signals = append(h.signals, healthSignal{kind: kind, at: time.Now()})
+	report := h.evaluate()
+	crossed := report.Alerting != h.alerting
+	h.alerting = report.Alerting
+	h.mu.Unlock()
+
+	if crossed {
+		h.alert(report)
+	}
+}
+
+// Report computes the current health.
+func (h *HealthTracker) Report() AccountHealth {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.evaluate()
+}
+
+// evaluate prunes expired signals and scores the rest; h.mu must be held.
+//
+// The score starts at 100 and loses up to 50 points for the send failure
+// rate, 2 per error or retry receipt (max 20), 5 per disconnect or connect
+// failure (max 20); a temporary ban or logout drops it to 0.
+func (h *HealthTracker) evaluate() AccountHealth {
+	now := time.Now()
+	cutoff := now.Add(-h.window)
+	kept := h.signals[:0]
+	for _, s := range h.signals {
+		if s.at.After(cutoff) {
+			kept = append(kept, s)
+		}
+	}
+	h.signals = kept
+
+	counts := make(map[string]int)
+	for _, s := range h.signals {
+		counts[s.kind]++
+	}
+
+	var failureRate float64
+	if sends := counts[SignalSendSuccess] + counts[SignalSendFailure]; sends > 0 {
+		failureRate = float64(counts[SignalSendFailure]) / float64(sends)
+	}
+	score := 100 - int(failureRate*50)
+	score -= min(20, 2*(counts[SignalReceiptError]+counts[SignalReceiptRetry]))
+	score -= min(20, 5*(counts[SignalDisconnect]+counts[SignalConnectFailure]))
+	if counts[SignalTemporaryBan] > 0 || counts[SignalLoggedOut] > 0 {
+		score = 0
+	}
+	score = max(score, 0)
+
+	status := HealthHealthy
+	switch {
+	case score < 50:
+		status = HealthAtRisk
+	case score < 80:
+		status = HealthDegraded
+	}
+
+	return AccountHealth{
+		Account:         h.bridge.ownJID(),
+		Score:           score,
+		Status:          status,
+		Signals:         counts,
+		SendFailureRate: failureRate,
+		Window:          h.window.String(),
+		AlertThreshold:  h.threshold,
+		Alerting:        score < h.threshold,
+		Timestamp:       now.Unix(),
+		TimestampISO:    h.bridge.formatTime(now),
+	}
+}
+
+func (h *HealthTracker) alert(report AccountHealth) {
+	b := h.bridge
+	if report.Alerting {
+		log.Printf("🩺 Account health dropped to %d (%s)", report.Score, report.Status)
+		b.notifier.Notify(AlertHealth, fmt.Sprintf("🩺 Account health dropped to %d (%s)", report.Score, report.Status))
+		b.reporter.CaptureMessage("warning", "account_health", "account health below threshold", map[string]string{
+			"score":  fmt.Sprint(report.Score),
+			"status": report.Status,
+		})
+	} else {
+		log.Printf("🩺 Account health recovered to %d (%s)", report.Score, report.Status)
+	}
+	b.publish(EventAccountHealth, report.Account, report)
+}
+
+// reportSendFailure records a failed send for error tracking and health scoring.
+func (b *WhatsAppBridge) reportSendFailure(err error, jid types.JID, msgType string) {
+	b.reporter.Capture(err, "send_failure", map[string]string{
+		"jid":          jid.String(),
+		"message_type": msgType,
+	})
+	b.health.Record(SignalSendFailure)
+}
+
+// recordReceipt turns delivery receipts into health signals.
+func (b *WhatsAppBridge) recordReceipt(receiptType types.ReceiptType) {
+	switch receiptType {
+	case types.ReceiptTypeDelivered:
+		b.health.Record(SignalReceiptDelivered)
+	case types.ReceiptTypeServerError:
+		b.health.Record(SignalReceiptError)
+	case types.ReceiptTypeRetry:
+		b.health.Record(SignalReceiptRetry)
+	}
+}
+
+// handleAccountHealth serves GET /admin/accounts/{id}/health. The bridge runs
+// a single account, addressed by "me", its phone number or its JID.
+func (b *WhatsAppBridge) handleAccountHealth(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	own := b.ownJID()
+	user, _, _ := strings.Cut(own, "@")
+	if id != "me" && id != own && id != user {
+		writeJSON(w, http.StatusNotFound, Response{Success: false, Error: "unknown account"})
+		return
+	}
+	writeJSON(w, http.StatusOK, Response{Success: true, Data: b.health.Report()})
+}
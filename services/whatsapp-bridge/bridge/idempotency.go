@@ -0,0 +1,117 @@
+package bridge
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Idempotent /send: a client retrying a request with the same
+// Idempotency-Key header (or client_message_id) within IDEMPOTENCY_TTL
+// (default 24h) gets the original response back instead of a second
+// message. Keys are scoped to the operator, so API clients cannot collide.
+
+var (
+	errIdempotencyInProgress = errors.New("a send with this idempotency key is still in progress")
+	errIdempotencyMismatch   = errors.New("idempotency key was already used for a different request")
+)
+
+// idempotencyLockTimeout bounds how long a crashed send blocks its key.
+const idempotencyLockTimeout = 5 * time.Minute
+
+type idempotentSend struct {
+	Hash string                 `json:"hash"` // of the original request
+	Data map[string]interface{} `json:"data"` // its response
+}
+
+func idempotencyKeys(operator, key string) (done, lock string) {
+	base := "whatsapp:idempotency:" + operator + ":" + key
+	return base, base + ":lock"
+}
+
+// requestHash fingerprints a request so a reused key with a different body
+// is rejected rather than silently answered with another message's result.
+func requestHash(v interface{}) string {
+	data, _ := json.Marshal(v)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// beginIdempotent returns the stored response when key was already used
+// for this request. Otherwise it locks the key for the caller, who must
+// call finishIdempotent or abortIdempotent.
+func (b *WhatsAppBridge) beginIdempotent(ctx context.Context, operator, key, hash string) (map[string]interface{}, error) {
+	doneKey, lockKey := idempotencyKeys(operator, key)
+	if data, err := b.redisClient.Get(ctx, doneKey).Bytes(); err == nil {
+		var previous idempotentSend
+		if err := json.Unmarshal(data, &previous); err == nil {
+			if previous.Hash != hash {
+				return nil, errIdempotencyMismatch
+			}
+			return previous.Data, nil
+		}
+	} else if err != redis.Nil {
+		return nil, err
+	}
+
+	locked, err := b.redisClient.SetNX(ctx, lockKey, hash, idempotencyLockTimeout).Result()
+	if err != nil {
+		return nil, err
+	}
+	if !locked {
+		return nil, errIdempotencyInProgress
+	}
+	return nil, nil
+}
+
+// finishIdempotent stores the response of a successful send under key.
+func (b *WhatsAppBridge) finishIdempotent(ctx context.Context, operator, key, hash string, data map[string]interface{}) {
+	doneKey, lockKey := idempotencyKeys(operator, key)
+	record, _ := json.Marshal(idempotentSend{Hash: hash, Data: data})
+	b.redisClient.Set(ctx, doneKey, record, envDuration("IDEMPOTENCY_TTL", 24*time.Hour))
+	b.redisClient.Del(ctx, lockKey)
+}
+
+// abortIdempotent releases key after a failed send so it can be retried.
+func (b *WhatsAppBridge) abortIdempotent(ctx context.Context, operator, key string) {
+	_, lockKey := idempotencyKeys(operator, key)
+	b.redisClient.Del(ctx, lockKey)
+}
+
+// sendIdempotent sends msg like sendOutgoing and returns the response data
+// (see sendResponse). With a key, unique within scope (the operator, or the
+// queue a message came from), a key already used for the same request
+// returns the stored data with replayed set and sends nothing. A send that
+// fails before anything went out releases the key so it can be retried;
+// once a part was sent, the partial response is stored instead, so retries
+// never repeat the parts already delivered. Errors of beginIdempotent are
+// returned as they are.
+func (b *WhatsAppBridge) sendIdempotent(ctx context.Context, scope, key string, msg OutgoingMessage) (result SendResult, data map[string]interface{}, replayed bool, err error) {
+	hash := requestHash(msg)
+	if key != "" {
+		previous, err := b.beginIdempotent(ctx, scope, key, hash)
+		if err != nil {
+			return SendResult{}, nil, false, err
+		}
+		if previous != nil {
+			return SendResult{}, previous, true, nil
+		}
+	}
+
+	result, err = b.sendOutgoing(ctx, msg)
+	data = b.sendResponse(ctx, result, err)
+	if key != "" {
+		done := context.WithoutCancel(ctx)
+		if err != nil && len(result.PartIDs) == 0 {
+			b.abortIdempotent(done, scope, key)
+		} else {
+			b.finishIdempotent(done, scope, key, hash, data)
+		}
+	}
+	return result, data, false, err
+}
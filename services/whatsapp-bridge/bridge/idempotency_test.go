@@ -0,0 +1,42 @@
+package bridge_test
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/phenobarbital/ai-parrot/whatsapp-bridge/bridge"
+	"github.com/phenobarbital/ai-parrot/whatsapp-bridge/bridgetest"
+)
+
+func TestIdempotentReplayOfPartialSend(t *testing.T) {
+	h := bridgetest.New(t,
+		bridgetest.WithEnv("MESSAGE_MAX_LENGTH", "12"),
+		bridgetest.WithEnv("MESSAGE_SPLIT_DELAY", "0"),
+	)
+	msg := bridge.OutgoingMessage{
+		Phone:           "5215512345678",
+		Message:         "first part. second part.",
+		ClientMessageID: "order-42",
+	}
+	h.Client.FailSendAfter(1, errors.New("connection lost"))
+
+	status, resp := h.Do(http.MethodPost, "/send", msg)
+	if status == http.StatusOK {
+		t.Fatalf("send with a failed part answered 200: %+v", resp.Data)
+	}
+	if sent := len(h.Sent()); sent != 1 {
+		t.Fatalf("%d parts went out, want 1", sent)
+	}
+
+	status, replay := h.Do(http.MethodPost, "/send", msg)
+	if status != http.StatusInternalServerError {
+		t.Errorf("retry answered %d, want the stored partial 500", status)
+	}
+	if data, _ := replay.Data.(map[string]any); data["status"] != bridge.SendStatusPartial {
+		t.Errorf("retry data = %+v, want status partial", replay.Data)
+	}
+	if sent := len(h.Sent()); sent != 1 {
+		t.Errorf("retry sent again: %d parts went out, want 1", sent)
+	}
+}
@@ -0,0 +1,274 @@
+package bridge
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// EventIdentityMerged is published when two contact records turn out to be
+// the same person and are folded into one.
+const EventIdentityMerged = "identity_merged"
+
+// IdentityMerged is the payload of an identity_merged event.
+type IdentityMerged struct {
+	ContactID        string   `json:"contact_id"`
+	MergedContactIDs []string `json:"merged_contact_ids"`
+	Identities       []string `json:"identities"`
+	Timestamp        int64    `json:"timestamp"`
+	TimestampISO     string   `json:"timestamp_iso"`
+}
+
+// ContactIdentity is one JID known for a contact.
+type ContactIdentity struct {
+	JID       string `json:"jid"`
+	Kind      string `json:"kind"` // pn or lid
+	FirstSeen int64  `json:"first_seen"`
+	LastSeen  int64  `json:"last_seen"`
+}
+
+// ResolveContact maps a set of JIDs belonging to one person to a contact ID,
+// creating a contact when none is known and merging contacts when the JIDs
+// are currently split across several. It returns the surviving contact ID
+// and the IDs that were merged into it.
+func (a *Archive) ResolveContact(jids []types.JID) (string, []string, error) {
+	if a == nil || len(jids) == 0 {
+		return "", nil, nil
+	}
+
+	tx, err := a.db.Begin()
+	if err != nil {
+		return "", nil, err
+	}
+	defer tx.Rollback()
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(jids)), ",")
+	args := make([]interface{}, len(jids))
+	for i, jid := range jids {
+		args[i] = jid.String()
+	}
+
+	// Oldest contact first: it survives any merge.
+	rows, err := tx.Query(`SELECT DISTINCT c.id FROM contacts c
+		JOIN contact_identities ci ON ci.contact_id = c.id
+		WHERE ci.jid IN (`+placeholders+`) ORDER BY c.created_at, c.id`, args...)
+	if err != nil {
+		return "", nil, err
+	}
+	var found []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return "", nil, err
+		}
+		found = append(found, id)
+	}
+	rows.Close()
+
+	now := time.Now().Unix()
+	var contactID string
+	if len(found) == 0 {
+		contactID = newContactID()
+		if _, err := tx.Exec(`INSERT INTO contacts (id, created_at) VALUES (?, ?)`, contactID, now); err != nil {
+			return "", nil, err
+		}
+	} else {
+		contactID = found[0]
+	}
+
+	merged := found[min(1, len(found)):]
+	for _, old := range merged {
+		if err := mergeContact(tx, contactID, old, now); err != nil {
+			return "", nil, err
+		}
+	}
+
+	for _, jid := range jids {
+		_, err := tx.Exec(`INSERT INTO contact_identities (jid, contact_id, kind, first_seen, last_seen)
+			VALUES (?, ?, ?, ?, ?)
+			ON CONFLICT (jid) DO UPDATE SET contact_id = excluded.contact_id, last_seen = excluded.last_seen`,
+			jid.String(), contactID, identityKind(jid), now, now)
+		if err != nil {
+			return "", nil, err
+		}
+	}
+
+	return contactID, merged, tx.Commit()
+}
+
+// mergeContact moves all identities and archived messages of old onto survivor.
+func mergeContact(tx *sql.Tx, survivor, old string, now int64) error {
+	stmts := []string{
+		`UPDATE contact_identities SET contact_id = ? WHERE contact_id = ?`,
+		`UPDATE messages SET contact_id = ? WHERE contact_id = ?`,
+		// The survivor keeps its own consent; otherwise it inherits old's.
+		`UPDATE OR IGNORE contact_consent SET contact_id = ? WHERE contact_id = ?`,
+		`UPDATE contact_consent_log SET contact_id = ? WHERE contact_id = ?`,
+	}
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(stmt, survivor, old); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec(`DELETE FROM contact_consent WHERE contact_id = ?`, old); err != nil {
+		return err
+	}
+	if err := mergeContactActivity(tx, survivor, old); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM contacts WHERE id = ?`, old); err != nil {
+		return err
+	}
+	_, err := tx.Exec(`INSERT INTO contact_merges (survivor_id, merged_id, merged_at) VALUES (?, ?, ?)`, survivor, old, now)
+	return err
+}
+
+// ContactIdentities lists the JIDs known for a contact.
+func (a *Archive) ContactIdentities(contactID string) ([]ContactIdentity, error) {
+	if a == nil {
+		return nil, fmt.Errorf("archive is disabled")
+	}
+	rows, err := a.db.Query(`SELECT jid, kind, first_seen, last_seen FROM contact_identities
+		WHERE contact_id = ? ORDER BY first_seen`, contactID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []ContactIdentity
+	for rows.Next() {
+		var ci ContactIdentity
+		if err := rows.Scan(&ci.JID, &ci.Kind, &ci.FirstSeen, &ci.LastSeen); err != nil {
+			return nil, err
+		}
+		out = append(out, ci)
+	}
+	return out, rows.Err()
+}
+
+// LookupContact returns the contact ID for a JID without creating one.
+func (a *Archive) LookupContact(jid string) string {
+	if a == nil {
+		return ""
+	}
+	var id string
+	a.db.QueryRow(`SELECT contact_id FROM contact_identities WHERE jid = ?`, jid).Scan(&id)
+	return id
+}
+
+func identityKind(jid types.JID) string {
+	if jid.Server == types.HiddenUserServer {
+		return "lid"
+	}
+	return "pn"
+}
+
+func newContactID() string {
+	buf := make([]byte, 8)
+	rand.Read(buf)
+	return "c_" + hex.EncodeToString(buf)
+}
+
+// resolveContact expands a sender with its alternate address (LID <-> phone
+// number, from the message or whatsmeow's mapping store), resolves it to a
+// stable contact ID and announces any merge that happened on the way.
+func (b *WhatsAppBridge) resolveContact(sender, alt types.JID) string {
+	if b.archiveDB == nil || sender.IsEmpty() {
+		return ""
+	}
+
+	jids := []types.JID{sender.ToNonAD()}
+	if alt.IsEmpty() {
+		alt = b.alternateJID(sender)
+	}
+	if !alt.IsEmpty() {
+		jids = append(jids, alt.ToNonAD())
+	}
+
+	contactID, merged, err := b.archiveDB.ResolveContact(jids)
+	if err != nil {
+		log.Printf("Error resolving contact for %s: %v", sender, err)
+		return ""
+	}
+
+	if len(merged) > 0 {
+		identities := make([]string, len(jids))
+		for i, jid := range jids {
+			identities[i] = jid.String()
+		}
+		log.Printf("🔗 Merged contacts %v into %s", merged, contactID)
+		now := time.Now()
+		b.publish(EventIdentityMerged, sender.ToNonAD().String(), IdentityMerged{
+			ContactID:        contactID,
+			MergedContactIDs: merged,
+			Identities:       identities,
+			Timestamp:        now.Unix(),
+			TimestampISO:     b.formatTime(now),
+		})
+	}
+	return contactID
+}
+
+// alternateJID looks up the LID for a phone-number JID or vice versa.
+func (b *WhatsAppBridge) alternateJID(jid types.JID) types.JID {
+	if b.client == nil || b.client.Device().LIDs == nil {
+		return types.EmptyJID
+	}
+	var alt types.JID
+	var err error
+	switch jid.Server {
+	case types.HiddenUserServer:
+		alt, err = b.client.Device().LIDs.GetPNForLID(b.ctx, jid)
+	case types.DefaultUserServer:
+		alt, err = b.client.Device().LIDs.GetLIDForPN(b.ctx, jid)
+	}
+	if err != nil {
+		return types.EmptyJID
+	}
+	return alt
+}
+
+// contactForChat resolves the contact ID of a 1:1 chat; groups have none.
+func (b *WhatsAppBridge) contactForChat(chat string) string {
+	jid, err := types.ParseJID(chat)
+	if err != nil || (jid.Server != types.DefaultUserServer && jid.Server != types.HiddenUserServer) {
+		return ""
+	}
+	return b.resolveContact(jid, types.EmptyJID)
+}
+
+// handleGetContact serves GET /contacts/{id}, listing the identities merged
+// under a contact. The id may also be a JID, which is resolved first.
+func (b *WhatsAppBridge) handleGetContact(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	if strings.Contains(id, "@") {
+		id = b.archiveDB.LookupContact(id)
+	}
+
+	identities, err := b.archiveDB.ContactIdentities(id)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	if len(identities) == 0 {
+		writeJSON(w, http.StatusNotFound, Response{Success: false, Error: "contact not found"})
+		return
+	}
+	consent, _ := b.archiveDB.GetConsent(id)
+	history, _ := b.archiveDB.ConsentHistory(id)
+	writeJSON(w, http.StatusOK, Response{Success: true, Data: map[string]interface{}{
+		"contact_id":      id,
+		"identities":      identities,
+		"consent":         consent,
+		"consent_history": history,
+	}})
+}
@@ -0,0 +1,97 @@
+package bridge
+
+import (
+	"hash/fnv"
+	"sync"
+
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// Inbound workers: whatsmeow runs event handlers on the connection's
+// goroutine, so a handler that waits (media downloads and uploads, the
+// translation API, the archive, business profile lookups) holds back every
+// later event, receipts and keepalives included. Messages are handed to
+// INBOUND_WORKERS workers (default 4) instead; each chat hashes to one
+// worker, so a chat's messages keep their order. INBOUND_BUFFER (default
+// 1000) messages may wait in total before the handler blocks.
+// INBOUND_WORKERS=0 handles messages on the event handler, as before.
+
+type inboundWorkers struct {
+	handle func(*events.Message)
+	queues []chan *events.Message
+	wg     sync.WaitGroup
+
+	mu     sync.RWMutex // guards closed against dispatches racing Close
+	closed bool
+}
+
+// inboundWorkersFromEnv returns nil when INBOUND_WORKERS is 0.
+func (b *WhatsAppBridge) inboundWorkersFromEnv() *inboundWorkers {
+	workers := envInt("INBOUND_WORKERS", 4)
+	if workers <= 0 {
+		return nil
+	}
+	buffer := max(envInt("INBOUND_BUFFER", 1000), 1)
+	w := &inboundWorkers{handle: b.processIncoming, queues: make([]chan *events.Message, workers)}
+	for i := range w.queues {
+		w.queues[i] = make(chan *events.Message, buffer/workers+1)
+	}
+	return w
+}
+
+// processIncoming is all the work done for a message event.
+func (b *WhatsAppBridge) processIncoming(msg *events.Message) {
+	b.recordRevoke(msg)
+	b.handleIncomingMessage(msg)
+}
+
+// Run starts the workers.
+func (w *inboundWorkers) Run() {
+	if w == nil {
+		return
+	}
+	for _, queue := range w.queues {
+		w.wg.Add(1)
+		go func(queue <-chan *events.Message) {
+			defer w.wg.Done()
+			for msg := range queue {
+				w.handle(msg)
+			}
+		}(queue)
+	}
+}
+
+// dispatchIncoming queues msg on its chat's worker, blocking while that
+// worker is full. Without workers (or after Close) msg is handled in place.
+func (b *WhatsAppBridge) dispatchIncoming(msg *events.Message) {
+	w := b.inbound
+	if w == nil {
+		b.processIncoming(msg)
+		return
+	}
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.closed {
+		w.handle(msg)
+		return
+	}
+	worker := fnv.New32a()
+	worker.Write([]byte(msg.Info.Chat.String()))
+	w.queues[worker.Sum32()%uint32(len(w.queues))] <- msg
+}
+
+// Close stops taking messages and waits until the queued ones are handled.
+func (w *inboundWorkers) Close() {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	if !w.closed {
+		w.closed = true
+		for _, queue := range w.queues {
+			close(queue)
+		}
+	}
+	w.mu.Unlock()
+	w.wg.Wait()
+}
@@ -0,0 +1,41 @@
+package bridge_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/phenobarbital/ai-parrot/whatsapp-bridge/bridgetest"
+)
+
+func TestInboundWorkersKeepChatOrder(t *testing.T) {
+	h := bridgetest.New(t, bridgetest.WithEnv("INBOUND_WORKERS", "3"))
+	phones := []string{"5215512345678", "5215587654321", "5215511112222"}
+	const perPhone = 20
+	for i := 0; i < perPhone; i++ {
+		for _, phone := range phones {
+			h.ReceiveText(phone, fmt.Sprintf("message %d", i))
+		}
+	}
+
+	next := make(map[string]int)
+	for range len(phones) * perPhone {
+		msg := h.ExpectMessage()
+		if want := fmt.Sprintf("message %d", next[msg.From]); msg.Content != want {
+			t.Fatalf("from %s got %q, want %q", msg.From, msg.Content, want)
+		}
+		next[msg.From]++
+	}
+}
+
+func TestShutdownHandlesQueuedMessages(t *testing.T) {
+	h := bridgetest.New(t, bridgetest.WithEnv("INBOUND_WORKERS", "1"))
+	for i := 0; i < 10; i++ {
+		h.ReceiveText("5215512345678", fmt.Sprintf("message %d", i))
+	}
+	h.Bridge.Shutdown()
+	for i := 0; i < 10; i++ {
+		if msg := h.ExpectMessage(); msg.Content != fmt.Sprintf("message %d", i) {
+			t.Fatalf("message %d = %q", i, msg.Content)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package bridge
+
+import "go.mau.fi/whatsmeow/proto/waE2E"
+
+// Kinds of interactive replies.
+const (
+	InteractiveButton         = "button"          // a reply button
+	InteractiveList           = "list"            // a row of a list message
+	InteractiveTemplateButton = "template_button" // a quick reply button of a template
+)
+
+// InteractiveReply is the choice a user made on a menu: a reply button, a
+// list row or a template's quick reply button. It is published as the
+// interactive_reply field of "interactive_reply" messages, whose content is
+// the choice's title.
+type InteractiveReply struct {
+	Kind        string `json:"kind"`
+	ID          string `json:"id"`    // the ID the menu gave the choice
+	Title       string `json:"title"` // the text shown for it
+	Description string `json:"description,omitempty"`
+	Index       int    `json:"index,omitempty"`      // 1-based position, for template buttons
+	MessageID   string `json:"message_id,omitempty"` // the menu message
+}
+
+// interactiveReplyFromMessage returns the choice carried by msg, or nil
+// when msg is not a menu reply.
+func interactiveReplyFromMessage(msg *waE2E.Message) *InteractiveReply {
+	switch {
+	case msg.GetButtonsResponseMessage() != nil:
+		r := msg.GetButtonsResponseMessage()
+		return &InteractiveReply{
+			Kind:      InteractiveButton,
+			ID:        r.GetSelectedButtonID(),
+			Title:     r.GetSelectedDisplayText(),
+			MessageID: r.GetContextInfo().GetStanzaID(),
+		}
+	case msg.GetListResponseMessage() != nil:
+		r := msg.GetListResponseMessage()
+		return &InteractiveReply{
+			Kind:        InteractiveList,
+			ID:          r.GetSingleSelectReply().GetSelectedRowID(),
+			Title:       r.GetTitle(),
+			Description: r.GetDescription(),
+			MessageID:   r.GetContextInfo().GetStanzaID(),
+		}
+	case msg.GetTemplateButtonReplyMessage() != nil:
+		r := msg.GetTemplateButtonReplyMessage()
+		return &InteractiveReply{
+			Kind:      InteractiveTemplateButton,
+			ID:        r.GetSelectedID(),
+			Title:     r.GetSelectedDisplayText(),
+			Index:     int(r.GetSelectedIndex()) + 1,
+			MessageID: r.GetContextInfo().GetStanzaID(),
+		}
+	}
+	return nil
+}
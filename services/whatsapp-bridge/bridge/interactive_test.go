@@ -0,0 +1,56 @@
+package bridge_test
+
+import (
+	"testing"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/phenobarbital/ai-parrot/whatsapp-bridge/bridge"
+	"github.com/phenobarbital/ai-parrot/whatsapp-bridge/bridgetest"
+)
+
+func TestInboundInteractiveReplies(t *testing.T) {
+	h := bridgetest.New(t)
+	jid := types.NewJID("5215512345678", types.DefaultUserServer)
+	menu := &waE2E.ContextInfo{StanzaID: proto.String("MENU1")}
+
+	for _, tc := range []struct {
+		msg  *waE2E.Message
+		want bridge.InteractiveReply
+	}{
+		{
+			&waE2E.Message{ButtonsResponseMessage: &waE2E.ButtonsResponseMessage{
+				SelectedButtonID: proto.String("yes"),
+				Response:         &waE2E.ButtonsResponseMessage_SelectedDisplayText{SelectedDisplayText: "Yes, please"},
+				ContextInfo:      menu,
+			}},
+			bridge.InteractiveReply{Kind: bridge.InteractiveButton, ID: "yes", Title: "Yes, please", MessageID: "MENU1"},
+		},
+		{
+			&waE2E.Message{ListResponseMessage: &waE2E.ListResponseMessage{
+				Title:             proto.String("Tacos al pastor"),
+				Description:       proto.String("With pineapple"),
+				SingleSelectReply: &waE2E.ListResponseMessage_SingleSelectReply{SelectedRowID: proto.String("pastor")},
+				ContextInfo:       menu,
+			}},
+			bridge.InteractiveReply{Kind: bridge.InteractiveList, ID: "pastor", Title: "Tacos al pastor", Description: "With pineapple", MessageID: "MENU1"},
+		},
+		{
+			&waE2E.Message{TemplateButtonReplyMessage: &waE2E.TemplateButtonReplyMessage{
+				SelectedID:          proto.String("track"),
+				SelectedDisplayText: proto.String("Track order"),
+				SelectedIndex:       proto.Uint32(1),
+				ContextInfo:         menu,
+			}},
+			bridge.InteractiveReply{Kind: bridge.InteractiveTemplateButton, ID: "track", Title: "Track order", Index: 2, MessageID: "MENU1"},
+		},
+	} {
+		h.Receive(jid, jid, tc.msg)
+		msg := h.ExpectMessage()
+		if msg.Type != "interactive_reply" || msg.InteractiveReply == nil || *msg.InteractiveReply != tc.want || msg.Content != tc.want.Title {
+			t.Errorf("%s reply published as %s %q %+v", tc.want.Kind, msg.Type, msg.Content, msg.InteractiveReply)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package bridge
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Kafka transport, for high-volume installations that want a replayable log
+// in both directions: a "kafka" sink produces events to the inbound topic,
+// and the outbound consumer sends the messages produced to the outbound
+// topic. Records are keyed by chat JID, so each chat stays in one partition
+// and keeps its order.
+//
+//	KAFKA_BROKERS                 - comma-separated bootstrap brokers (default localhost:9092)
+//	KAFKA_INBOUND_TOPIC           - topic receiving events (default whatsapp.inbound)
+//	KAFKA_OUTBOUND_TOPIC          - topic of messages to send; unset disables the consumer
+//	KAFKA_GROUP_ID                - consumer group shared by replicas (default whatsapp-bridge)
+//	KAFKA_OUTBOUND_RESULTS_TOPIC  - where send results go (default <outbound topic>.results)
+//	KAFKA_OUTBOUND_MAX_ATTEMPTS   - send attempts before a record is given up (default 5)
+
+func kafkaBrokers() []string {
+	if brokers := envList("KAFKA_BROKERS"); len(brokers) > 0 {
+		return brokers
+	}
+	return []string{"localhost:9092"}
+}
+
+// newKafkaWriter returns a producer for per-record topics that waits for
+// all in-sync replicas, without the default one second batching delay.
+func newKafkaWriter(brokers []string) *kafka.Writer {
+	return &kafka.Writer{
+		Addr:                   kafka.TCP(brokers...),
+		Balancer:               &kafka.Hash{},
+		RequiredAcks:           kafka.RequireAll,
+		BatchTimeout:           10 * time.Millisecond,
+		AllowAutoTopicCreation: true,
+	}
+}
+
+// invalidTopicChars matches what Kafka does not allow in topic names.
+var invalidTopicChars = regexp.MustCompile(`[^a-zA-Z0-9._-]`)
+
+// kafkaSink produces events to its topic, a per-type override or the routed
+// channel (with characters Kafka rejects, like ":", replaced by "."). Records
+// carry event-type, chat and route headers.
+type kafkaSink struct {
+	name   string
+	writer *kafka.Writer
+	topic  string
+	topics map[string]string
+}
+
+func (b *WhatsAppBridge) newKafkaSink(cfg SinkConfig) *kafkaSink {
+	brokers := kafkaBrokers()
+	if cfg.URL != "" {
+		brokers = strings.Split(cfg.URL, ",")
+	}
+	topic := cfg.Topic
+	if topic == "" {
+		topic = envString("KAFKA_INBOUND_TOPIC", "whatsapp.inbound")
+	}
+	return &kafkaSink{name: cfg.Name, writer: newKafkaWriter(brokers), topic: topic, topics: cfg.Channels}
+}
+
+func (s *kafkaSink) Name() string { return s.name }
+
+func (s *kafkaSink) Deliver(ctx context.Context, evt BridgeEvent) error {
+	data, err := evt.MarshalPayload()
+	if err != nil {
+		return err
+	}
+	topic := s.topic
+	if evt.Channel != "" {
+		topic = evt.Channel
+	} else if override, ok := s.topics[evt.Type]; ok {
+		topic = override
+	}
+	return s.writer.WriteMessages(ctx, kafka.Message{
+		Topic: invalidTopicChars.ReplaceAllString(topic, "."),
+		Key:   []byte(evt.Chat),
+		Value: data,
+		Headers: []kafka.Header{
+			{Key: "event-type", Value: []byte(evt.Type)},
+			{Key: "chat", Value: []byte(evt.Chat)},
+			{Key: "route", Value: []byte(evt.Route)},
+			{Key: "shard-key", Value: []byte(evt.ShardKey)},
+		},
+	})
+}
+
+// KafkaOutboundConfig configures the consumer of outbound messages.
+type KafkaOutboundConfig struct {
+	Brokers      []string
+	Topic        string
+	GroupID      string
+	ResultsTopic string
+	MaxAttempts  int
+}
+
+// kafkaOutboundConfigFromEnv returns nil unless KAFKA_OUTBOUND_TOPIC is set.
+func kafkaOutboundConfigFromEnv() *KafkaOutboundConfig {
+	topic := envString("KAFKA_OUTBOUND_TOPIC", "")
+	if topic == "" {
+		return nil
+	}
+	return &KafkaOutboundConfig{
+		Brokers:      kafkaBrokers(),
+		Topic:        topic,
+		GroupID:      envString("KAFKA_GROUP_ID", "whatsapp-bridge"),
+		ResultsTopic: envString("KAFKA_OUTBOUND_RESULTS_TOPIC", topic+".results"),
+		MaxAttempts:  envInt("KAFKA_OUTBOUND_MAX_ATTEMPTS", 5),
+	}
+}
+
+// consumeKafkaOutbound sends the records of the outbound topic as part of
+// the consumer group until the bridge context is cancelled.
+//
+// Records are OutgoingMessage JSON (same shape as /send), optionally with
+// idempotency-key and operator headers. Offsets are committed only after a
+// record was sent or given up, so a crash replays it; the idempotency key
+// (else client_message_id, else the record's topic/partition/offset) keeps
+// replays from messaging anyone twice. Kafka cannot skip a single record,
+// so failing sends are retried in place, holding back the rest of the
+// partition, and given up after MaxAttempts. Every record gets an
+// OutgoingResult on the results topic, keyed like the record.
+func (b *WhatsAppBridge) consumeKafkaOutbound(cfg *KafkaOutboundConfig) {
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers: cfg.Brokers,
+		GroupID: cfg.GroupID,
+		Topic:   cfg.Topic,
+	})
+	defer reader.Close()
+	writer := newKafkaWriter(cfg.Brokers)
+	defer writer.Close()
+	log.Printf("📥 Consuming outgoing messages from Kafka topic %s (group %s)", cfg.Topic, cfg.GroupID)
+
+	for {
+		record, err := reader.FetchMessage(b.intake)
+		if err != nil {
+			if b.intake.Err() != nil {
+				return
+			}
+			log.Printf("Error reading Kafka topic %s: %v", cfg.Topic, err)
+			if sleepContext(b.intake, 5*time.Second) != nil {
+				return
+			}
+			continue
+		}
+
+		result := b.processKafkaOutbound(cfg, record)
+		if b.ctx.Err() != nil {
+			return // shutting down mid-retry; the record is replayed
+		}
+		data, _ := json.Marshal(result)
+		if err := writer.WriteMessages(b.ctx, kafka.Message{Topic: cfg.ResultsTopic, Key: record.Key, Value: data}); err != nil {
+			log.Printf("Error publishing outgoing result to %s: %v", cfg.ResultsTopic, err)
+		}
+		if err := reader.CommitMessages(b.ctx, record); err != nil {
+			log.Printf("Error committing Kafka offset %d of %s/%d: %v", record.Offset, record.Topic, record.Partition, err)
+		}
+	}
+}
+
+// processKafkaOutbound sends one record, retrying transient failures.
+func (b *WhatsAppBridge) processKafkaOutbound(cfg *KafkaOutboundConfig, record kafka.Message) OutgoingResult {
+	id := kafkaHeader(record, "idempotency-key")
+	var msg OutgoingMessage
+	if err := json.Unmarshal(record.Value, &msg); err != nil {
+		return OutgoingResult{ID: id, Status: "failed", Error: fmt.Sprintf("invalid payload: %v", err)}
+	}
+	if id == "" {
+		id = msg.ClientMessageID
+	}
+	if id == "" {
+		id = fmt.Sprintf("%s/%d/%d", record.Topic, record.Partition, record.Offset)
+	}
+	result := OutgoingResult{ID: id}
+	if err := msg.Validate(); err != nil {
+		result.Status, result.Error = "failed", err.Error()
+		return result
+	}
+
+	operator := kafkaHeader(record, "operator")
+	if operator == "" {
+		operator = "kafka:" + cfg.Topic
+	}
+	scope := "kafka:" + cfg.Topic
+	ctx := withOperator(b.ctx, operator)
+	backoff := time.Second
+	for attempt := 1; ; attempt++ {
+		resp, previous, replayed, err := b.sendIdempotent(ctx, scope, id, msg)
+		switch {
+		case replayed:
+			result.Status = "duplicate"
+			result.MessageID, _ = previous["message_id"].(string)
+			return result
+		case errors.Is(err, errIdempotencyMismatch):
+			result.Status, result.Error = "failed", err.Error()
+			return result
+		case errors.Is(err, errPermanent):
+			log.Printf("Outgoing Kafka record %s failed permanently: %v", id, err)
+			result.Status, result.MessageID, result.Error = "failed", resp.ID, err.Error()
+			return result
+		case err == nil:
+			result.Status, result.MessageID = resp.status(), resp.ID
+			return result
+		}
+		if attempt >= cfg.MaxAttempts {
+			log.Printf("☠️ Outgoing Kafka record %s failed %d times, giving up: %v", id, attempt, err)
+			result.Status, result.Error = "dead_letter", err.Error()
+			return result
+		}
+		log.Printf("Outgoing Kafka record %s failed (attempt %d/%d), will retry: %v", id, attempt, cfg.MaxAttempts, err)
+		if sleepContext(b.ctx, backoff) != nil {
+			return result
+		}
+		backoff = min(backoff*2, time.Minute)
+	}
+}
+
+func kafkaHeader(record kafka.Message, key string) string {
+	for _, h := range record.Headers {
+		if h.Key == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,254 @@
+package bridge
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"go.mau.fi/whatsmeow/appstate"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// WhatsApp Business labels, mirrored from app state so that labeling a chat
+// on the phone drives routing: a chat's label names are among its tags in
+// ROUTES rules (prefixed with LABEL_TAG_PREFIX, default none). Labels can be
+// applied and removed through the API too; personal accounts have none.
+//
+//	whatsapp:labels             - hash: label ID -> Label JSON
+//	whatsapp:chat_labels:<jid>  - set of label IDs, under both the phone and LID form of the chat
+
+// EventLabel is published when a chat is labeled or unlabeled.
+const EventLabel = "label"
+
+const labelsKey = "whatsapp:labels"
+
+func chatLabelsKey(chat string) string { return "whatsapp:chat_labels:" + chat }
+
+// Label is a WhatsApp Business label.
+type Label struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Color int32  `json:"color"`
+}
+
+// LabelChange is the payload of label events.
+type LabelChange struct {
+	Chat    string `json:"chat"`
+	LabelID string `json:"label_id"`
+	Label   string `json:"label,omitempty"`
+	Labeled bool   `json:"labeled"`
+	Source  string `json:"source"` // "phone" (any linked device) or "api"
+}
+
+// handleLabelEdit stores a created, renamed or deleted label.
+func (b *WhatsAppBridge) handleLabelEdit(v *events.LabelEdit) {
+	if v.Action.GetDeleted() {
+		b.redisClient.HDel(b.ctx, labelsKey, v.LabelID)
+		return
+	}
+	label := Label{ID: v.LabelID, Name: v.Action.GetName(), Color: v.Action.GetColor()}
+	data, _ := json.Marshal(label)
+	if err := b.redisClient.HSet(b.ctx, labelsKey, v.LabelID, data).Err(); err != nil {
+		log.Printf("Error storing label %s: %v", v.LabelID, err)
+	}
+}
+
+// handleLabelAssociation records a chat being labeled or unlabeled.
+func (b *WhatsAppBridge) handleLabelAssociation(v *events.LabelAssociationChat) {
+	labeled := v.Action.GetLabeled()
+	if err := b.storeChatLabel(b.ctx, v.JID, v.LabelID, labeled); err != nil {
+		log.Printf("Error storing label %s of %s: %v", v.LabelID, v.JID, err)
+	}
+	if !v.FromFullSync {
+		b.publishLabelChange(v.JID, v.LabelID, labeled, "phone")
+	}
+}
+
+func (b *WhatsAppBridge) storeChatLabel(ctx context.Context, chat types.JID, labelID string, labeled bool) error {
+	pipe := b.redisClient.TxPipeline()
+	for _, jid := range []types.JID{chat, b.alternateJID(chat)} {
+		if jid.IsEmpty() {
+			continue
+		}
+		if labeled {
+			pipe.SAdd(ctx, chatLabelsKey(jid.String()), labelID)
+		} else {
+			pipe.SRem(ctx, chatLabelsKey(jid.String()), labelID)
+		}
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (b *WhatsAppBridge) publishLabelChange(chat types.JID, labelID string, labeled bool, source string) {
+	change := LabelChange{Chat: chat.String(), LabelID: labelID, Labeled: labeled, Source: source}
+	if label, ok := b.label(b.ctx, labelID); ok {
+		change.Label = label.Name
+	}
+	b.publish(EventLabel, chat.String(), change)
+}
+
+// labels returns every known label, keyed by ID.
+func (b *WhatsAppBridge) labels(ctx context.Context) (map[string]Label, error) {
+	all, err := b.redisClient.HGetAll(ctx, labelsKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	labels := make(map[string]Label, len(all))
+	for id, data := range all {
+		var label Label
+		if json.Unmarshal([]byte(data), &label) == nil {
+			labels[id] = label
+		}
+	}
+	return labels, nil
+}
+
+func (b *WhatsAppBridge) label(ctx context.Context, id string) (Label, bool) {
+	data, err := b.redisClient.HGet(ctx, labelsKey, id).Result()
+	if err != nil {
+		return Label{}, false
+	}
+	var label Label
+	return label, json.Unmarshal([]byte(data), &label) == nil
+}
+
+// chatLabels returns the labels of a chat.
+func (b *WhatsAppBridge) chatLabels(ctx context.Context, chat string) ([]Label, error) {
+	ids, err := b.redisClient.SMembers(ctx, chatLabelsKey(chat)).Result()
+	if err != nil || len(ids) == 0 {
+		return []Label{}, err
+	}
+	known, err := b.labels(ctx)
+	if err != nil {
+		return nil, err
+	}
+	labels := make([]Label, 0, len(ids))
+	for _, id := range ids {
+		label, ok := known[id]
+		if !ok {
+			label = Label{ID: id}
+		}
+		labels = append(labels, label)
+	}
+	sort.Slice(labels, func(i, j int) bool { return labels[i].Name < labels[j].Name })
+	return labels, nil
+}
+
+// labelTags returns the routing tags a chat gets from its labels.
+func (b *WhatsAppBridge) labelTags(chat string) []string {
+	labels, err := b.chatLabels(b.ctx, chat)
+	if err != nil {
+		return nil
+	}
+	prefix := envString("LABEL_TAG_PREFIX", "")
+	tags := make([]string, 0, len(labels))
+	for _, label := range labels {
+		if label.Name != "" {
+			tags = append(tags, prefix+label.Name)
+		}
+	}
+	return tags
+}
+
+// resolveLabel finds a label by ID or, case-insensitively, by name.
+func (b *WhatsAppBridge) resolveLabel(ctx context.Context, ref string) (Label, error) {
+	labels, err := b.labels(ctx)
+	if err != nil {
+		return Label{}, err
+	}
+	if label, ok := labels[ref]; ok {
+		return label, nil
+	}
+	for _, label := range labels {
+		if strings.EqualFold(label.Name, ref) {
+			return label, nil
+		}
+	}
+	return Label{}, fmt.Errorf("unknown label %q", ref)
+}
+
+// chatParam parses a chat given as JID or phone number.
+func chatParam(raw string) (types.JID, error) {
+	if strings.Contains(raw, "@") {
+		return types.ParseJID(raw)
+	}
+	phone, err := normalizePhone(raw)
+	if err != nil {
+		return types.EmptyJID, err
+	}
+	return types.NewJID(phone, types.DefaultUserServer), nil
+}
+
+// handleListLabels serves GET /labels.
+func (b *WhatsAppBridge) handleListLabels(w http.ResponseWriter, r *http.Request) {
+	known, err := b.labels(r.Context())
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	labels := make([]Label, 0, len(known))
+	for _, label := range known {
+		labels = append(labels, label)
+	}
+	sort.Slice(labels, func(i, j int) bool { return labels[i].Name < labels[j].Name })
+	writeJSON(w, http.StatusOK, Response{Success: true, Data: labels})
+}
+
+// handleGetChatLabels serves GET /chats/{chat}/labels.
+func (b *WhatsAppBridge) handleGetChatLabels(w http.ResponseWriter, r *http.Request) {
+	chat, err := chatParam(mux.Vars(r)["chat"])
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, Response{Success: false, Error: err.Error()})
+		return
+	}
+	labels, err := b.chatLabels(r.Context(), chat.String())
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, Response{Success: true, Data: labels})
+}
+
+// handlePutChatLabel serves PUT /chats/{chat}/labels/{label}, labeling the
+// chat on every device; {label} is a label ID or name.
+func (b *WhatsAppBridge) handlePutChatLabel(w http.ResponseWriter, r *http.Request) {
+	b.setChatLabel(w, r, true)
+}
+
+// handleDeleteChatLabel serves DELETE /chats/{chat}/labels/{label}.
+func (b *WhatsAppBridge) handleDeleteChatLabel(w http.ResponseWriter, r *http.Request) {
+	b.setChatLabel(w, r, false)
+}
+
+func (b *WhatsAppBridge) setChatLabel(w http.ResponseWriter, r *http.Request, labeled bool) {
+	vars := mux.Vars(r)
+	chat, err := chatParam(vars["chat"])
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, Response{Success: false, Error: err.Error()})
+		return
+	}
+	label, err := b.resolveLabel(r.Context(), vars["label"])
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, Response{Success: false, Error: err.Error()})
+		return
+	}
+	if err := b.client.SendAppState(r.Context(), appstate.BuildLabelChat(chat, label.ID, labeled)); err != nil {
+		writeJSON(w, http.StatusBadGateway, Response{Success: false, Error: fmt.Sprintf("failed to update label: %v", err)})
+		return
+	}
+	// Our own app state changes are not echoed back as events.
+	if err := b.storeChatLabel(r.Context(), chat, label.ID, labeled); err != nil {
+		log.Printf("Error storing label %s of %s: %v", label.ID, chat, err)
+	}
+	b.publishLabelChange(chat, label.ID, labeled, "api")
+	writeJSON(w, http.StatusOK, Response{Success: true, Data: LabelChange{
+		Chat: chat.String(), LabelID: label.ID, Label: label.Name, Labeled: labeled, Source: "api",
+	}})
+}
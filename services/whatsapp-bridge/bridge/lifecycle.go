@@ -0,0 +1,127 @@
+package bridge
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Lifecycle hooks let an embedding program, and through the matching
+// lifecycle events any supervising service, coordinate with the bridge:
+//
+//	starting  - Start is launching the background workers
+//	connected - the WhatsApp session is up, on every (re)connection
+//	draining  - Drain was called: new API writes get 503 and /health reports
+//	            draining, e.g. so an agent pauses its consumers
+//	stopped   - Shutdown disconnected from WhatsApp; nothing more is sent
+//
+// Hooks run synchronously, in registration order, before the event is
+// published, so a draining hook may block until its side is quiet.
+// LIFECYCLE_FLUSH_TIMEOUT (default 5s) is how long Shutdown waits for
+// sinks to deliver the last events, the stopped one included.
+
+// EventLifecycle is published when the bridge enters a lifecycle phase.
+const EventLifecycle = "lifecycle"
+
+// Lifecycle phases.
+const (
+	PhaseStarting  = "starting"
+	PhaseConnected = "connected"
+	PhaseDraining  = "draining"
+	PhaseStopped   = "stopped"
+)
+
+// LifecycleEvent is the payload of lifecycle events.
+type LifecycleEvent struct {
+	Phase     string `json:"phase"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+// LifecycleHook is called when the bridge enters a phase.
+type LifecycleHook func(ctx context.Context)
+
+type lifecycleHooks struct {
+	mu       sync.Mutex
+	hooks    map[string][]LifecycleHook
+	draining bool
+	stopped  bool
+}
+
+func (l *lifecycleHooks) markStopped() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	already := l.stopped
+	l.stopped = true
+	return !already
+}
+
+// OnStarting registers a hook run when Start begins.
+func (b *WhatsAppBridge) OnStarting(hook LifecycleHook) { b.addHook(PhaseStarting, hook) }
+
+// OnConnected registers a hook run on every connection to WhatsApp.
+func (b *WhatsAppBridge) OnConnected(hook LifecycleHook) { b.addHook(PhaseConnected, hook) }
+
+// OnDraining registers a hook run when the bridge starts draining.
+func (b *WhatsAppBridge) OnDraining(hook LifecycleHook) { b.addHook(PhaseDraining, hook) }
+
+// OnStopped registers a hook run once the bridge has stopped.
+func (b *WhatsAppBridge) OnStopped(hook LifecycleHook) { b.addHook(PhaseStopped, hook) }
+
+func (b *WhatsAppBridge) addHook(phase string, hook LifecycleHook) {
+	b.lifecycle.mu.Lock()
+	defer b.lifecycle.mu.Unlock()
+	if b.lifecycle.hooks == nil {
+		b.lifecycle.hooks = make(map[string][]LifecycleHook)
+	}
+	b.lifecycle.hooks[phase] = append(b.lifecycle.hooks[phase], hook)
+}
+
+// enterPhase runs the phase's hooks and publishes its event.
+func (b *WhatsAppBridge) enterPhase(ctx context.Context, phase string) {
+	b.lifecycle.mu.Lock()
+	hooks := append([]LifecycleHook(nil), b.lifecycle.hooks[phase]...)
+	b.lifecycle.mu.Unlock()
+	for _, hook := range hooks {
+		hook(ctx)
+	}
+	b.publish(EventLifecycle, "", LifecycleEvent{Phase: phase, Timestamp: time.Now().Unix()})
+}
+
+// Drain stops the bridge from taking new work ahead of Shutdown: API writes
+// are refused, /health reports draining, the queue consumers stop taking
+// messages (the ones being sent finish), and /events and gRPC streams are
+// closed so the HTTP and gRPC servers can shut down. It is idempotent.
+func (b *WhatsAppBridge) Drain(ctx context.Context) {
+	b.lifecycle.mu.Lock()
+	if b.lifecycle.draining {
+		b.lifecycle.mu.Unlock()
+		return
+	}
+	b.lifecycle.draining = true
+	b.lifecycle.mu.Unlock()
+	log.Println("🚰 Draining")
+	b.stopIntake()
+	b.enterPhase(ctx, PhaseDraining)
+}
+
+// Draining reports whether Drain was called.
+func (b *WhatsAppBridge) Draining() bool {
+	b.lifecycle.mu.Lock()
+	defer b.lifecycle.mu.Unlock()
+	return b.lifecycle.draining
+}
+
+// drainMiddleware refuses requests that would start new work while
+// draining; reads keep working.
+func (b *WhatsAppBridge) drainMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead && r.Method != http.MethodOptions && b.Draining() {
+			w.Header().Set("Retry-After", "30")
+			writeJSON(w, http.StatusServiceUnavailable, Response{Success: false, Error: "bridge is draining"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,35 @@
+package bridge_test
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/phenobarbital/ai-parrot/whatsapp-bridge/bridgetest"
+)
+
+func TestDrainClosesEventStreams(t *testing.T) {
+	h := bridgetest.New(t)
+	resp, err := h.Server.Client().Get(h.Server.URL + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	closed := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(io.Discard, resp.Body)
+		closed <- err
+	}()
+
+	h.Bridge.Drain(context.Background())
+	select {
+	case err := <-closed:
+		if err != nil {
+			t.Fatalf("event stream ended with %v", err)
+		}
+	case <-time.After(bridgetest.DefaultTimeout):
+		t.Fatal("event stream still open after Drain")
+	}
+}
@@ -0,0 +1,128 @@
+package bridge
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// EventLiveLocation is published for the start of a live location share and
+// for every position update after it, so tracking consumers can follow the
+// contact. The first message of a share is also published as a regular
+// "live_location" message; updates are only published as these events and
+// are not archived.
+const EventLiveLocation = "live_location"
+
+// LiveLocationUpdate is the payload of live_location events. StreamID is the
+// ID of the message that started the share and Sequence counts the
+// positions the bridge saw in it, from 1. WhatsApp does not tell how long a
+// share lasts: ExpiresAt is when the bridge stops treating positions as
+// part of it, LIVE_LOCATION_TTL (default 8h, the longest share WhatsApp
+// offers) after it started; a later position starts a new stream, as does
+// a position from a share that started at another time.
+type LiveLocationUpdate struct {
+	StreamID     string   `json:"stream_id"`
+	MessageID    string   `json:"message_id"`
+	Chat         string   `json:"chat"`
+	From         string   `json:"from"` // sender JID
+	FromName     string   `json:"from_name,omitempty"`
+	ContactID    string   `json:"contact_id,omitempty"`
+	Sequence     int64    `json:"sequence"`
+	WASequence   int64    `json:"wa_sequence,omitempty"` // the sender's own sequence number, when set
+	First        bool     `json:"first"`
+	Location     Location `json:"location"`
+	StartedAt    int64    `json:"started_at"`
+	ExpiresAt    int64    `json:"expires_at"`
+	Timestamp    int64    `json:"timestamp"`
+	TimestampISO string   `json:"timestamp_iso"`
+}
+
+// liveLocationKey holds the share of sender in chat: its stream ID, start
+// and the positions seen, expiring with it.
+func liveLocationKey(chat, sender string) string {
+	return "whatsapp:live_location:" + chat + ":" + sender
+}
+
+// handleLiveLocation publishes a live location position, reporting whether
+// it was an update of a known share; the caller handles the message that
+// starts one as any other. Held for maintenance, the share is tracked but
+// the position not published.
+func (b *WhatsAppBridge) handleLiveLocation(msg *events.Message, held bool) bool {
+	info := msg.Info
+	live := msg.Message.GetLiveLocationMessage()
+	chat, sender := info.Chat.String(), info.Sender.ToNonAD().String()
+	ttl := b.liveLocationTTL
+
+	// The sender reports how long ago the share started.
+	started := info.Timestamp.Add(-time.Duration(live.GetTimeOffset()) * time.Second)
+	stream, err := b.trackLiveLocation(b.ctx, liveLocationKey(chat, sender), info.ID, started, ttl)
+	if err != nil {
+		log.Printf("Error tracking the live location of %s: %v", info.Sender.User, err)
+		return false
+	}
+
+	evt := LiveLocationUpdate{
+		StreamID:     stream.id,
+		MessageID:    info.ID,
+		Chat:         chat,
+		From:         sender,
+		FromName:     info.PushName,
+		ContactID:    b.resolveContact(info.Sender, info.SenderAlt),
+		Sequence:     stream.sequence,
+		WASequence:   live.GetSequenceNumber(),
+		First:        stream.sequence == 1,
+		Location:     *liveLocationFromMessage(live),
+		StartedAt:    stream.startedAt,
+		ExpiresAt:    stream.startedAt + int64(ttl.Seconds()),
+		Timestamp:    info.Timestamp.Unix(),
+		TimestampISO: b.formatTime(info.Timestamp),
+	}
+	log.Printf("📍 Live location #%d from %s", evt.Sequence, info.Sender.User)
+	if !held {
+		b.publish(EventLiveLocation, chat, evt)
+	}
+	return !evt.First
+}
+
+type liveStream struct {
+	id        string
+	startedAt int64
+	sequence  int64
+}
+
+// liveLocationSlack is how far apart the starts reported by positions of
+// one share may be: senders round the share's age to the second.
+const liveLocationSlack = 5 * time.Second
+
+// startLiveLocation records a position in a share, starting a new share
+// with ARGV[1] as its stream ID and ARGV[2] as its start unless one that
+// started then (give or take ARGV[4] seconds) is known. The share expires
+// at ARGV[3]. It returns the stream ID, its start and the position's
+// sequence.
+var startLiveLocation = redis.NewScript(`
+local started = redis.call('HGET', KEYS[1], 'started_at')
+if not started or math.abs(tonumber(started) - tonumber(ARGV[2])) > tonumber(ARGV[4]) then
+	redis.call('DEL', KEYS[1])
+	redis.call('HSET', KEYS[1], 'stream_id', ARGV[1], 'started_at', ARGV[2])
+	redis.call('EXPIREAT', KEYS[1], ARGV[3])
+end
+local seq = redis.call('HINCRBY', KEYS[1], 'sequence', 1)
+return {redis.call('HGET', KEYS[1], 'stream_id'), redis.call('HGET', KEYS[1], 'started_at'), seq}
+`)
+
+func (b *WhatsAppBridge) trackLiveLocation(ctx context.Context, key, messageID string, started time.Time, ttl time.Duration) (*liveStream, error) {
+	// A share reported long after it ended is kept for a moment only.
+	expiresAt := max(started.Add(ttl).Unix(), time.Now().Unix()+1)
+	res, err := startLiveLocation.Run(ctx, b.redisClient, []string{key},
+		messageID, started.Unix(), expiresAt, int64(liveLocationSlack.Seconds())).Slice()
+	if err != nil {
+		return nil, err
+	}
+	stream := &liveStream{id: res[0].(string), sequence: res[2].(int64)}
+	stream.startedAt, _ = strconv.ParseInt(res[1].(string), 10, 64)
+	return stream, nil
+}
@@ -0,0 +1,69 @@
+package bridge_test
+
+import (
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/phenobarbital/ai-parrot/whatsapp-bridge/bridge"
+	"github.com/phenobarbital/ai-parrot/whatsapp-bridge/bridgetest"
+)
+
+// receiveLivePosition simulates a live location position sent at at by a
+// share that started offset earlier.
+func receiveLivePosition(h *bridgetest.Harness, id string, at time.Time, offset time.Duration) bridge.LiveLocationUpdate {
+	h.TB.Helper()
+	jid := types.NewJID("5215512345678", types.DefaultUserServer)
+	h.Emit(&events.Message{
+		Info: types.MessageInfo{
+			MessageSource: types.MessageSource{Chat: jid, Sender: jid},
+			ID:            id,
+			Timestamp:     at,
+		},
+		Message: &waE2E.Message{LiveLocationMessage: &waE2E.LiveLocationMessage{
+			DegreesLatitude:  proto.Float64(19.4326),
+			DegreesLongitude: proto.Float64(-99.1332),
+			TimeOffset:       proto.Uint32(uint32(offset.Seconds())),
+		}},
+	})
+	var update bridge.LiveLocationUpdate
+	h.DecodePayload(h.ExpectEvent(bridge.EventLiveLocation), &update)
+	return update
+}
+
+func TestLiveLocationStreams(t *testing.T) {
+	h := bridgetest.New(t, bridgetest.WithEnv("LIVE_LOCATION_TTL", "1h"))
+	start := time.Now().Add(-10 * time.Minute).Truncate(time.Second)
+
+	first := receiveLivePosition(h, "LIVE1", start, 0)
+	if !first.First || first.StreamID != "LIVE1" || first.ExpiresAt != start.Add(time.Hour).Unix() {
+		t.Fatalf("first position = %+v", first)
+	}
+	if msg := h.ExpectMessage(); msg.Type != "live_location" {
+		t.Fatalf("share start published as %q", msg.Type)
+	}
+
+	update := receiveLivePosition(h, "LIVE2", start.Add(time.Minute), time.Minute)
+	if update.First || update.StreamID != "LIVE1" || update.Sequence != 2 {
+		t.Fatalf("update = %+v", update)
+	}
+	h.ExpectNoEvent(bridge.EventMessage, 50*time.Millisecond)
+
+	// The key expires with the share, not an hour after its last position.
+	key := "whatsapp:live_location:5215512345678@s.whatsapp.net:5215512345678@s.whatsapp.net"
+	if ttl := h.Redis.TTL(key); ttl > 50*time.Minute+time.Second || ttl < 49*time.Minute {
+		t.Fatalf("share expires in %s, want about 50m", ttl)
+	}
+
+	// A share that started at another time is a new stream, though the
+	// last one has not expired.
+	restart := start.Add(2 * time.Minute)
+	again := receiveLivePosition(h, "LIVE3", restart, 0)
+	if !again.First || again.StreamID != "LIVE3" || again.StartedAt != restart.Unix() {
+		t.Fatalf("restarted share = %+v", again)
+	}
+}
@@ -0,0 +1,66 @@
+package bridge
+
+import (
+	"strings"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+)
+
+// Location is a pin dropped in a chat, published as the location field of
+// "location" messages.
+type Location struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Name      string  `json:"name,omitempty"`    // the place's name, when a place was picked
+	Address   string  `json:"address,omitempty"` // its address
+	URL       string  `json:"url,omitempty"`
+	Comment   string  `json:"comment,omitempty"`
+	Accuracy  uint32  `json:"accuracy_meters,omitempty"`
+
+	// Live locations only (see live_location.go).
+	Live    bool    `json:"live,omitempty"`
+	Speed   float32 `json:"speed_mps,omitempty"`
+	Heading uint32  `json:"heading_degrees,omitempty"` // clockwise from magnetic north
+}
+
+// locationFromMessage returns the Location of a location message.
+func locationFromMessage(msg *waE2E.LocationMessage) *Location {
+	return &Location{
+		Latitude:  msg.GetDegreesLatitude(),
+		Longitude: msg.GetDegreesLongitude(),
+		Name:      msg.GetName(),
+		Address:   msg.GetAddress(),
+		URL:       msg.GetURL(),
+		Comment:   msg.GetComment(),
+		Accuracy:  msg.GetAccuracyInMeters(),
+	}
+}
+
+// liveLocationFromMessage returns the Location of a live location message
+// or update.
+func liveLocationFromMessage(msg *waE2E.LiveLocationMessage) *Location {
+	return &Location{
+		Latitude:  msg.GetDegreesLatitude(),
+		Longitude: msg.GetDegreesLongitude(),
+		Comment:   msg.GetCaption(),
+		Accuracy:  msg.GetAccuracyInMeters(),
+		Live:      true,
+		Speed:     msg.GetSpeedInMps(),
+		Heading:   msg.GetDegreesClockwiseFromMagneticNorth(),
+	}
+}
+
+// content describes the location in words for the message's content: the
+// place and address, or the comment of a bare pin.
+func (l *Location) content() string {
+	var parts []string
+	for _, part := range []string{l.Name, l.Address} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	if len(parts) == 0 {
+		return l.Comment
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,41 @@
+package bridge_test
+
+import (
+	"testing"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/phenobarbital/ai-parrot/whatsapp-bridge/bridgetest"
+)
+
+func TestInboundLocation(t *testing.T) {
+	h := bridgetest.New(t)
+	jid := types.NewJID("5215512345678", types.DefaultUserServer)
+
+	h.Receive(jid, jid, &waE2E.Message{LocationMessage: &waE2E.LocationMessage{
+		DegreesLatitude:  proto.Float64(19.4326),
+		DegreesLongitude: proto.Float64(-99.1332),
+		Name:             proto.String("Zócalo"),
+		Address:          proto.String("Plaza de la Constitución, CDMX"),
+		AccuracyInMeters: proto.Uint32(12),
+	}})
+	msg := h.ExpectMessage()
+	loc := msg.Location
+	if msg.Type != "location" || loc == nil || loc.Latitude != 19.4326 || loc.Longitude != -99.1332 || loc.Accuracy != 12 || loc.Live {
+		t.Fatalf("place published as %s %+v", msg.Type, loc)
+	}
+	if msg.Content != "Zócalo, Plaza de la Constitución, CDMX" {
+		t.Errorf("place content = %q", msg.Content)
+	}
+
+	h.Receive(jid, jid, &waE2E.Message{LocationMessage: &waE2E.LocationMessage{
+		DegreesLatitude:  proto.Float64(19.4),
+		DegreesLongitude: proto.Float64(-99.1),
+		Comment:          proto.String("I'm here"),
+	}})
+	if msg := h.ExpectMessage(); msg.Content != "I'm here" || msg.Location.Name != "" {
+		t.Errorf("bare pin published as %q %+v", msg.Content, msg.Location)
+	}
+}
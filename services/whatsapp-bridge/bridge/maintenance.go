@@ -0,0 +1,201 @@
+package bridge
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// maintenanceKey holds the current maintenance window, expiring with it, so
+// every replica sees it and it ends on its own.
+const maintenanceKey = "whatsapp:maintenance"
+
+// maintenanceNotifiedKey marks a chat as told about the window started at
+// startedAt.
+func maintenanceNotifiedKey(startedAt int64, chat string) string {
+	return fmt.Sprintf("whatsapp:maintenance:%d:notified:%s", startedAt, chat)
+}
+
+// defaultMaintenanceMessage is sent when neither the request nor
+// MAINTENANCE_MESSAGE sets the reply.
+const defaultMaintenanceMessage = "We're doing some maintenance and can't answer right now. We'll be back by {{.until}}."
+
+// Maintenance is a window during which inbound messages are archived but
+// not published: direct chats get an automatic reply instead, once per
+// window, and nothing is kept to publish later. Reactions, edits,
+// deletions, live locations and poll votes are recorded as usual but not
+// published either, and media is neither scanned nor downloaded. It is
+// meant for planned downtime of the agent's backend, without taking the
+// number offline.
+type Maintenance struct {
+	Reason    string `json:"reason,omitempty"`
+	Template  string `json:"template,omitempty"` // stored template sent as the reply
+	Message   string `json:"message,omitempty"`  // inline reply when there is no Template
+	StartedAt int64  `json:"started_at"`
+	EndsAt    int64  `json:"ends_at"`
+	StartedBy string `json:"started_by,omitempty"`
+}
+
+// MaintenanceRequest is the body of POST /admin/maintenance. Duration is
+// a Go duration such as "90m". Replies are rendered with the params name
+// (the contact's push name), until (the end of the window) and reason.
+type MaintenanceRequest struct {
+	Duration string `json:"duration"`
+	Reason   string `json:"reason,omitempty"`
+	Template string `json:"template,omitempty"`
+	Message  string `json:"message,omitempty"`
+}
+
+// currentMaintenance returns the active maintenance window, or nil.
+func (b *WhatsAppBridge) currentMaintenance() (*Maintenance, error) {
+	data, err := b.redisClient.Get(b.ctx, maintenanceKey).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var m Maintenance
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// inMaintenance returns the active maintenance window, or nil when there is
+// none or it cannot be told: messages are published then.
+func (b *WhatsAppBridge) inMaintenance() *Maintenance {
+	m, err := b.currentMaintenance()
+	if err != nil {
+		log.Printf("Error checking maintenance mode: %v", err)
+		return nil
+	}
+	return m
+}
+
+// holdForMaintenance reports whether an inbound message falls in the
+// maintenance window m, replying to it if its chat was not told yet.
+func (b *WhatsAppBridge) holdForMaintenance(m *Maintenance, info types.MessageInfo, msg IncomingMessage) bool {
+	if m == nil {
+		return false
+	}
+	log.Printf("🚧 Maintenance: not publishing message %s from %s", info.ID, info.Sender.User)
+	if info.IsGroup {
+		return true
+	}
+
+	chat := info.Chat.String()
+	ttl := time.Until(time.Unix(m.EndsAt, 0))
+	if ttl <= 0 {
+		return true
+	}
+	first, err := b.redisClient.SetNX(b.ctx, maintenanceNotifiedKey(m.StartedAt, chat), 1, ttl).Result()
+	if err != nil || !first {
+		return true
+	}
+	params := map[string]interface{}{
+		"name":   msg.FromName,
+		"until":  time.Unix(m.EndsAt, 0).In(b.location).Format("Jan 2 15:04 MST"),
+		"reason": m.Reason,
+	}
+	reply := OutgoingMessage{Phone: info.Chat.User, Server: info.Chat.Server}
+	if m.Template != "" {
+		reply.Template, reply.Params = m.Template, params
+	} else if reply.Message, err = renderMaintenanceMessage(m.Message, params); err != nil {
+		log.Printf("Error rendering the maintenance reply: %v", err)
+		return true
+	}
+	go func() {
+		if _, err := b.sendOutgoing(withOperator(b.ctx, "system:maintenance"), reply); err != nil {
+			log.Printf("Error sending the maintenance reply to %s: %v", chat, err)
+		}
+	}()
+	return true
+}
+
+func renderMaintenanceMessage(body string, params map[string]interface{}) (string, error) {
+	t, err := parseTemplate("maintenance", body)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, params); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// handleGetMaintenance serves GET /admin/maintenance.
+func (b *WhatsAppBridge) handleGetMaintenance(w http.ResponseWriter, r *http.Request) {
+	m, err := b.currentMaintenance()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, Response{Success: true, Data: map[string]interface{}{
+		"active":      m != nil,
+		"maintenance": m,
+	}})
+}
+
+// handleStartMaintenance serves POST /admin/maintenance, starting a
+// maintenance window or replacing the current one.
+func (b *WhatsAppBridge) handleStartMaintenance(w http.ResponseWriter, r *http.Request) {
+	var req MaintenanceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, Response{Success: false, Error: err.Error()})
+		return
+	}
+	duration, err := time.ParseDuration(req.Duration)
+	if err != nil || duration <= 0 {
+		writeJSON(w, http.StatusBadRequest, Response{Success: false, Error: "duration must be a positive duration such as \"90m\""})
+		return
+	}
+	if req.Template != "" {
+		if _, err := b.loadTemplate(req.Template); err != nil {
+			writeJSON(w, http.StatusBadRequest, Response{Success: false, Error: err.Error()})
+			return
+		}
+	}
+	if req.Message == "" {
+		req.Message = envString("MAINTENANCE_MESSAGE", defaultMaintenanceMessage)
+	}
+	if _, err := parseTemplate("maintenance", req.Message); err != nil {
+		writeJSON(w, http.StatusBadRequest, Response{Success: false, Error: fmt.Sprintf("invalid message: %v", err)})
+		return
+	}
+
+	now := time.Now()
+	m := Maintenance{
+		Reason:    req.Reason,
+		Template:  req.Template,
+		Message:   req.Message,
+		StartedAt: now.Unix(),
+		EndsAt:    now.Add(duration).Unix(),
+		StartedBy: operatorFromContext(r.Context()),
+	}
+	data, _ := json.Marshal(m)
+	if err := b.redisClient.Set(r.Context(), maintenanceKey, data, duration).Err(); err != nil {
+		writeJSON(w, http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	log.Printf("🚧 Maintenance mode on for %s by %s", duration, m.StartedBy)
+	writeJSON(w, http.StatusOK, Response{Success: true, Data: m})
+}
+
+// handleStopMaintenance serves DELETE /admin/maintenance, ending the
+// current window early.
+func (b *WhatsAppBridge) handleStopMaintenance(w http.ResponseWriter, r *http.Request) {
+	if err := b.redisClient.Del(r.Context(), maintenanceKey).Err(); err != nil {
+		writeJSON(w, http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	log.Printf("🚧 Maintenance mode off")
+	writeJSON(w, http.StatusOK, Response{Success: true})
+}
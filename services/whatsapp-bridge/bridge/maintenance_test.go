@@ -0,0 +1,107 @@
+package bridge_test
+
+import (
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waCommon"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/phenobarbital/ai-parrot/whatsapp-bridge/bridge"
+	"github.com/phenobarbital/ai-parrot/whatsapp-bridge/bridgetest"
+)
+
+// startMaintenance starts an hour-long maintenance window.
+func startMaintenance(t *testing.T, h *bridgetest.Harness) {
+	t.Helper()
+	if status, resp := h.Do(http.MethodPost, "/admin/maintenance", bridge.MaintenanceRequest{
+		Duration: "1h",
+		Message:  "Back soon",
+	}); status != http.StatusOK {
+		t.Fatalf("POST /admin/maintenance = %d %s", status, resp.Error)
+	}
+}
+
+func TestMaintenanceRepliesOncePerChat(t *testing.T) {
+	h := bridgetest.New(t)
+	startMaintenance(t, h)
+
+	h.ReceiveText("5215512345678", "hola")
+	h.ReceiveText("5215512345678", "¿hay alguien?")
+	h.ExpectNoEvent(bridge.EventMessage, 100*time.Millisecond)
+
+	deadline := time.Now().Add(bridgetest.DefaultTimeout)
+	for len(h.Sent()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if sent := h.Sent(); len(sent) != 1 || sent[0].Message.GetConversation() != "Back soon" {
+		t.Fatalf("sent %d replies, want one \"Back soon\": %+v", len(sent), sent)
+	}
+}
+
+func TestMaintenanceHoldsEveryInboundEvent(t *testing.T) {
+	h := bridgetest.New(t)
+	jid := types.NewJID("5215512345678", types.DefaultUserServer)
+	target := h.ReceiveText(jid.User, "hola")
+	h.ExpectMessage()
+	startMaintenance(t, h)
+
+	h.Receive(jid, jid, &waE2E.Message{ReactionMessage: &waE2E.ReactionMessage{
+		Key:  &waCommon.MessageKey{ID: proto.String(target)},
+		Text: proto.String("👍"),
+	}})
+	h.Receive(jid, jid, &waE2E.Message{ProtocolMessage: &waE2E.ProtocolMessage{
+		Type:          waE2E.ProtocolMessage_MESSAGE_EDIT.Enum(),
+		Key:           &waCommon.MessageKey{ID: proto.String(target)},
+		EditedMessage: &waE2E.Message{Conversation: proto.String("hola!")},
+	}})
+	h.Receive(jid, jid, &waE2E.Message{ProtocolMessage: &waE2E.ProtocolMessage{
+		Type: waE2E.ProtocolMessage_REVOKE.Enum(),
+		Key:  &waCommon.MessageKey{ID: proto.String(target)},
+	}})
+	for _, eventType := range []string{bridge.EventReaction, bridge.EventReactionsUpdated,
+		bridge.EventMessageEdited, bridge.EventMessageDeleted} {
+		h.ExpectNoEvent(eventType, 50*time.Millisecond)
+	}
+
+	// The reaction is still recorded.
+	_, resp := h.Do(http.MethodGet, "/messages/"+target+"/reactions", nil)
+	var reactions bridge.MessageReactions
+	decodeData(t, resp.Data, &reactions)
+	if reactions.Total != 1 || reactions.Counts["👍"] != 1 {
+		t.Fatalf("reactions = %+v", reactions)
+	}
+}
+
+func TestMaintenanceSkipsMediaScan(t *testing.T) {
+	var scans atomic.Int32
+	scanner := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		scans.Add(1)
+	}))
+	t.Cleanup(scanner.Close)
+	h := bridgetest.New(t, bridgetest.WithEnv("MEDIA_SCAN_URL", scanner.URL))
+	media := encryptMedia(t, testPNG(t), whatsmeow.MediaImage)
+	url := serveMedia(t, media.File).URL + "/image"
+	h.Client.AddMedia("/v/t62/"+hex.EncodeToString(media.FileSHA256[:8]), media.Plaintext)
+
+	receiveImage(h, "IMG1", "5215512345678", url, media)
+	h.ExpectMessage()
+	if n := scans.Load(); n != 1 {
+		t.Fatalf("media scanned %d times, want 1", n)
+	}
+
+	startMaintenance(t, h)
+	receiveImage(h, "IMG2", "5215512345678", url, media)
+	h.ExpectNoEvent(bridge.EventMessage, 100*time.Millisecond)
+	if n := scans.Load(); n != 1 {
+		t.Fatalf("media scanned %d times during maintenance", n-1)
+	}
+}
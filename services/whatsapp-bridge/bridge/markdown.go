@@ -0,0 +1,122 @@
+package bridge
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// outboundTransforms are the text stages selectable via OUTBOUND_TRANSFORMS
+// (comma-separated, applied in order to every outgoing text unless the
+// message sets "raw": true).
+var outboundTransforms = map[string]func(string) string{
+	"markdown": markdownToWhatsApp,
+	"trim":     strings.TrimSpace,
+}
+
+// outboundTransformsFromEnv resolves OUTBOUND_TRANSFORMS, rejecting unknown stages.
+func outboundTransformsFromEnv() ([]func(string) string, error) {
+	var stages []func(string) string
+	for _, name := range envList("OUTBOUND_TRANSFORMS") {
+		fn, ok := outboundTransforms[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown outbound transform %q", name)
+		}
+		stages = append(stages, fn)
+	}
+	return stages, nil
+}
+
+// transformOutgoing runs the configured stages over text.
+func (b *WhatsAppBridge) transformOutgoing(text string) string {
+	for _, stage := range b.transforms {
+		text = stage(text)
+	}
+	return text
+}
+
+var (
+	mdFence      = regexp.MustCompile("^\\s*```")
+	mdHeader     = regexp.MustCompile(`^\s{0,3}#{1,6}\s+(.*?)\s*#*\s*$`)
+	mdBullet     = regexp.MustCompile(`^(\s*)[-*+]\s+`)
+	mdRule       = regexp.MustCompile(`^\s{0,3}([-*_]\s*){3,}$`)
+	mdInlineCode = regexp.MustCompile("`([^`\n]+)`")
+	mdImage      = regexp.MustCompile(`!\[([^\]]*)\]\(([^)\s]+)(?:\s+"[^"]*")?\)`)
+	mdLink       = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)(?:\s+"[^"]*")?\)`)
+	mdBold       = regexp.MustCompile(`\*\*([^*\n]+?)\*\*|__([^_\n]+?)__`)
+	mdItalic     = regexp.MustCompile(`\*([^*\s][^*\n]*?)\*`)
+	mdStrike     = regexp.MustCompile(`~~([^~\n]+?)~~`)
+)
+
+// Placeholders keep converted spans away from later inline rules.
+const (
+	mdBoldMark = "\x01"
+	mdCodeMark = "\x02"
+)
+
+// markdownToWhatsApp rewrites the Markdown an LLM typically produces into
+// WhatsApp's formatting: **bold** -> *bold*, *italic* -> _italic_,
+// ~~strike~~ -> ~strike~, `code` and fenced blocks -> ```monospace```,
+// headers -> bold lines, bullets -> •, links -> "text (url)". Content inside
+// code is left untouched.
+func markdownToWhatsApp(text string) string {
+	lines := strings.Split(text, "\n")
+	out := make([]string, 0, len(lines))
+	inFence := false
+	for _, line := range lines {
+		if mdFence.MatchString(line) {
+			// Drop the language tag; WhatsApp only knows plain ``` blocks.
+			out = append(out, "```")
+			inFence = !inFence
+			continue
+		}
+		if inFence {
+			out = append(out, line)
+			continue
+		}
+		out = append(out, markdownLine(line))
+	}
+	return strings.Join(out, "\n")
+}
+
+func markdownLine(line string) string {
+	if mdRule.MatchString(line) {
+		return ""
+	}
+	header := false
+	if m := mdHeader.FindStringSubmatch(line); m != nil {
+		line, header = m[1], true
+	}
+	line = mdBullet.ReplaceAllString(line, "${1}• ")
+
+	// Protect inline code from the emphasis rules.
+	var code []string
+	line = mdInlineCode.ReplaceAllStringFunc(line, func(s string) string {
+		code = append(code, s[1:len(s)-1])
+		return mdCodeMark + fmt.Sprint(len(code)-1) + mdCodeMark
+	})
+
+	line = mdImage.ReplaceAllString(line, "$2")
+	line = mdLink.ReplaceAllStringFunc(line, func(s string) string {
+		m := mdLink.FindStringSubmatch(s)
+		if m[1] == m[2] || strings.TrimPrefix(m[2], "mailto:") == m[1] {
+			return m[1]
+		}
+		return m[1] + " (" + m[2] + ")"
+	})
+	line = mdBold.ReplaceAllStringFunc(line, func(s string) string {
+		return mdBoldMark + s[2:len(s)-2] + mdBoldMark
+	})
+	line = mdItalic.ReplaceAllString(line, "_${1}_")
+	line = mdStrike.ReplaceAllString(line, "~${1}~")
+	line = strings.ReplaceAll(line, mdBoldMark, "*")
+
+	for i, c := range code {
+		line = strings.Replace(line, mdCodeMark+fmt.Sprint(i)+mdCodeMark, "```"+c+"```", 1)
+	}
+
+	if header && line != "" && !strings.HasPrefix(line, "*") {
+		line = "*" + line + "*"
+	}
+	return line
+}
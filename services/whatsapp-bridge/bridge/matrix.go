@@ -0,0 +1,327 @@
+package bridge
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// MatrixConnector mirrors WhatsApp chats into Matrix rooms through an
+// application service and relays room messages back. Configured with:
+//
+//	MATRIX_HOMESERVER_URL  - e.g. https://matrix.example.org
+//	MATRIX_SERVER_NAME     - the homeserver's domain, e.g. example.org
+//	MATRIX_AS_TOKEN        - as_token from the registration file
+//	MATRIX_HS_TOKEN        - hs_token the homeserver sends on transactions
+//	MATRIX_BOT_LOCALPART   - sender_localpart (default "whatsappbot")
+//	MATRIX_USER_PREFIX     - puppet namespace (default "whatsapp_")
+//	MATRIX_INVITE          - Matrix users invited to every room
+//
+// The registration's url must point at the bridge, whose
+// /_matrix/app/v1/transactions endpoint receives room events. Each chat gets
+// one room; every WhatsApp participant is a puppet user, so group rooms
+// show who said what. Messages the bridge sends are posted by the bot.
+type MatrixConnector struct {
+	homeserver string
+	serverName string
+	asToken    string
+	hsToken    string
+	botID      string
+	userPrefix string
+	invite     []string
+	client     *http.Client
+	bridge     *WhatsAppBridge
+}
+
+// matrixOperatorPrefix attributes sends relayed from Matrix rooms; those are
+// already in the room and are not mirrored back.
+const matrixOperatorPrefix = "matrix:"
+
+// matrixFromEnv returns nil unless MATRIX_HOMESERVER_URL is set.
+func (b *WhatsAppBridge) matrixFromEnv() (*MatrixConnector, error) {
+	homeserver := strings.TrimRight(envString("MATRIX_HOMESERVER_URL", ""), "/")
+	if homeserver == "" {
+		return nil, nil
+	}
+	m := &MatrixConnector{
+		homeserver: homeserver,
+		serverName: envString("MATRIX_SERVER_NAME", ""),
+		asToken:    envString("MATRIX_AS_TOKEN", ""),
+		hsToken:    envString("MATRIX_HS_TOKEN", ""),
+		userPrefix: envString("MATRIX_USER_PREFIX", "whatsapp_"),
+		invite:     envList("MATRIX_INVITE"),
+		client:     &http.Client{Timeout: 15 * time.Second},
+		bridge:     b,
+	}
+	if m.serverName == "" || m.asToken == "" || m.hsToken == "" {
+		return nil, fmt.Errorf("MATRIX_HOMESERVER_URL requires MATRIX_SERVER_NAME, MATRIX_AS_TOKEN and MATRIX_HS_TOKEN")
+	}
+	m.botID = m.userID(envString("MATRIX_BOT_LOCALPART", "whatsappbot"))
+	return m, nil
+}
+
+func (m *MatrixConnector) Name() string { return "matrix" }
+
+func (m *MatrixConnector) userID(localpart string) string {
+	return "@" + localpart + ":" + m.serverName
+}
+
+func matrixRoomKey(chat string) string { return "whatsapp:matrix:room:" + chat }
+
+func matrixChatKey(roomID string) string { return "whatsapp:matrix:chat:" + roomID }
+
+func matrixMembersKey(roomID string) string { return "whatsapp:matrix:members:" + roomID }
+
+const matrixPuppetsKey = "whatsapp:matrix:puppets"
+
+// Deliver posts an inbound message into the chat's room as the sender's
+// puppet, creating the room and puppet on first contact.
+func (m *MatrixConnector) Deliver(ctx context.Context, evt BridgeEvent) error {
+	msg, ok := evt.Payload.(IncomingMessage)
+	if evt.Type != EventMessage || !ok {
+		return nil
+	}
+	roomID, err := m.roomFor(ctx, evt.Chat, msg)
+	if err != nil {
+		return err
+	}
+	puppet, err := m.puppetFor(ctx, roomID, msg.From, msg.FromName)
+	if err != nil {
+		return err
+	}
+
+	body := msg.Content
+	if msg.Type != "text" {
+		body = strings.TrimSpace(fmt.Sprintf("[%s] %s", msg.Type, msg.Content))
+	}
+	// The WhatsApp message ID doubles as transaction ID, so a retried
+	// delivery is not posted twice.
+	return m.sendText(ctx, roomID, puppet, "wa-"+msg.MessageID, "m.text", body)
+}
+
+// MirrorOutgoing posts a message the bridge sent (e.g. an AI reply) in the
+// chat's room as the bot. It only mirrors into rooms that already exist.
+func (m *MatrixConnector) MirrorOutgoing(ctx context.Context, chat, content, operator string) {
+	if m == nil || strings.HasPrefix(operator, matrixOperatorPrefix) {
+		return
+	}
+	b := m.bridge
+	roomID, err := b.redisClient.Get(b.ctx, matrixRoomKey(chat)).Result()
+	if err != nil {
+		return
+	}
+	txnID := "out-" + strconv.FormatInt(time.Now().UnixNano(), 10)
+	if err := m.sendText(ctx, roomID, "", txnID, "m.notice", content); err != nil {
+		log.Printf("Error mirroring message to Matrix room %s: %v", roomID, err)
+	}
+}
+
+// roomFor returns the room of chat, cached in Redis in both directions so
+// room messages can find their way back.
+func (m *MatrixConnector) roomFor(ctx context.Context, chat string, msg IncomingMessage) (string, error) {
+	b := m.bridge
+	if id, err := b.redisClient.Get(ctx, matrixRoomKey(chat)).Result(); err == nil {
+		return id, nil
+	}
+
+	name, topic := msg.FromName, "WhatsApp chat with +"+msg.From
+	if msg.IsGroup {
+		name, topic = msg.GroupName, "WhatsApp group "+chat
+	}
+	if name == "" {
+		name = "+" + msg.From
+	}
+	var room struct {
+		RoomID string `json:"room_id"`
+	}
+	err := m.do(ctx, http.MethodPost, "/createRoom", "", map[string]interface{}{
+		"name":   name,
+		"topic":  topic,
+		"preset": "private_chat",
+		"invite": m.invite,
+	}, &room)
+	if err != nil {
+		return "", fmt.Errorf("create room: %v", err)
+	}
+
+	b.redisClient.Set(ctx, matrixRoomKey(chat), room.RoomID, 0)
+	b.redisClient.Set(ctx, matrixChatKey(room.RoomID), chat, 0)
+	log.Printf("💬 Matrix room %s opened for %s", room.RoomID, chat)
+	return room.RoomID, nil
+}
+
+// puppetFor registers the WhatsApp user's puppet if needed and joins it to
+// the room, returning its Matrix user ID.
+func (m *MatrixConnector) puppetFor(ctx context.Context, roomID, phone, displayName string) (string, error) {
+	b := m.bridge
+	localpart := m.userPrefix + phone
+	puppet := m.userID(localpart)
+
+	if added, _ := b.redisClient.SAdd(ctx, matrixPuppetsKey, puppet).Result(); added == 1 {
+		err := m.do(ctx, http.MethodPost, "/register", "", map[string]interface{}{
+			"type":     "m.login.application_service",
+			"username": localpart,
+		}, nil)
+		if err != nil && !strings.Contains(err.Error(), "M_USER_IN_USE") {
+			b.redisClient.SRem(ctx, matrixPuppetsKey, puppet)
+			return "", fmt.Errorf("register %s: %v", puppet, err)
+		}
+		if displayName == "" {
+			displayName = "+" + phone
+		}
+		path := "/profile/" + url.PathEscape(puppet) + "/displayname"
+		if err := m.do(ctx, http.MethodPut, path, puppet, map[string]string{"displayname": displayName}, nil); err != nil {
+			log.Printf("Error setting Matrix display name of %s: %v", puppet, err)
+		}
+	}
+
+	if added, _ := b.redisClient.SAdd(ctx, matrixMembersKey(roomID), puppet).Result(); added == 1 {
+		room := url.PathEscape(roomID)
+		err := m.do(ctx, http.MethodPost, "/rooms/"+room+"/invite", "", map[string]string{"user_id": puppet}, nil)
+		if err == nil {
+			err = m.do(ctx, http.MethodPost, "/rooms/"+room+"/join", puppet, map[string]string{}, nil)
+		}
+		if err != nil {
+			b.redisClient.SRem(ctx, matrixMembersKey(roomID), puppet)
+			return "", fmt.Errorf("join %s to %s: %v", puppet, roomID, err)
+		}
+	}
+	return puppet, nil
+}
+
+func (m *MatrixConnector) sendText(ctx context.Context, roomID, asUser, txnID, msgType, body string) error {
+	path := fmt.Sprintf("/rooms/%s/send/m.room.message/%s", url.PathEscape(roomID), url.PathEscape(txnID))
+	return m.do(ctx, http.MethodPut, path, asUser, map[string]string{
+		"msgtype": msgType,
+		"body":    body,
+	}, nil)
+}
+
+// do calls the client-server API, acting as asUser when set (application
+// services may masquerade as users in their namespace).
+func (m *MatrixConnector) do(ctx context.Context, method, path, asUser string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	endpoint := m.homeserver + "/_matrix/client/v3" + path
+	if asUser != "" {
+		endpoint += "?user_id=" + url.QueryEscape(asUser)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+m.asToken)
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("matrix %s %s returned %d: %s", method, path, resp.StatusCode, strings.TrimSpace(string(detail)))
+	}
+	if out != nil {
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+	return nil
+}
+
+// matrixTransaction is the body of an application service transaction.
+type matrixTransaction struct {
+	Events []struct {
+		Type    string `json:"type"`
+		RoomID  string `json:"room_id"`
+		Sender  string `json:"sender"`
+		EventID string `json:"event_id"`
+		Content struct {
+			MsgType string `json:"msgtype"`
+			Body    string `json:"body"`
+		} `json:"content"`
+	} `json:"events"`
+}
+
+// handleMatrixTransaction serves PUT /_matrix/app/v1/transactions/{txn},
+// sending text messages posted by room members to the room's WhatsApp chat.
+func (b *WhatsAppBridge) handleMatrixTransaction(w http.ResponseWriter, r *http.Request) {
+	m := b.matrix
+	if m == nil {
+		writeJSON(w, http.StatusNotFound, Response{Success: false, Error: "matrix integration is disabled"})
+		return
+	}
+	token := r.URL.Query().Get("access_token")
+	if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		token = bearer
+	}
+	if subtle.ConstantTimeCompare([]byte(token), []byte(m.hsToken)) != 1 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]string{"errcode": "M_FORBIDDEN", "error": "invalid hs_token"})
+		return
+	}
+
+	var txn matrixTransaction
+	if err := json.NewDecoder(r.Body).Decode(&txn); err != nil {
+		writeJSON(w, http.StatusBadRequest, Response{Success: false, Error: err.Error()})
+		return
+	}
+
+	// Homeservers retry transactions until acknowledged; handle each once.
+	txnKey := "whatsapp:matrix:txn:" + mux.Vars(r)["txn"]
+	if fresh, _ := b.redisClient.SetNX(r.Context(), txnKey, 1, 24*time.Hour).Result(); fresh {
+		// Acknowledge right away; sends are throttled and may be split.
+		go func() {
+			for _, evt := range txn.Events {
+				if evt.Type != "m.room.message" || evt.Sender == m.botID ||
+					strings.HasPrefix(evt.Sender, "@"+m.userPrefix) || evt.Content.Body == "" {
+					continue
+				}
+				if evt.Content.MsgType != "m.text" && evt.Content.MsgType != "m.emote" {
+					continue
+				}
+				m.relay(evt.RoomID, evt.Sender, evt.Content.Body)
+			}
+		}()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte("{}"))
+}
+
+// relay sends a room member's message to the room's WhatsApp chat.
+func (m *MatrixConnector) relay(roomID, sender, body string) {
+	b := m.bridge
+	chat, err := b.redisClient.Get(b.ctx, matrixChatKey(roomID)).Result()
+	if err != nil {
+		return
+	}
+	jid, err := types.ParseJID(chat)
+	if err != nil {
+		return
+	}
+	ctx := withOperator(b.ctx, matrixOperatorPrefix+sender)
+	if _, err := b.sendOutgoing(ctx, OutgoingMessage{Phone: jid.User, Server: jid.Server, Message: body}); err != nil {
+		log.Printf("Error relaying Matrix message from %s to %s: %v", sender, chat, err)
+		m.sendText(b.ctx, roomID, "", "err-"+strconv.FormatInt(time.Now().UnixNano(), 10), "m.notice",
+			"⚠️ Not delivered to WhatsApp: "+err.Error())
+	}
+}
@@ -0,0 +1,54 @@
+package bridge
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// maxOutgoingMediaBytes caps the size of media fetched for outgoing messages.
+const maxOutgoingMediaBytes = 64 << 20
+
+var mediaHTTPClient = &http.Client{Timeout: 60 * time.Second}
+
+// loadOutgoingMedia returns media bytes either from a URL or a base64 string,
+// whichever is set. The returned mimetype is the server-reported Content-Type
+// for URLs and empty for inline data.
+func loadOutgoingMedia(ctx context.Context, url, inline string) ([]byte, string, error) {
+	if inline != "" {
+		data, err := base64.StdEncoding.DecodeString(inline)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid base64 media: %v", err)
+		}
+		return data, "", nil
+	}
+	if url == "" {
+		return nil, "", fmt.Errorf("no media provided")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid media URL: %v", err)
+	}
+	resp, err := mediaHTTPClient.Do(req)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to fetch media: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return nil, "", fmt.Errorf("failed to fetch media: status %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxOutgoingMediaBytes+1))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read media: %v", err)
+	}
+	if len(data) > maxOutgoingMediaBytes {
+		return nil, "", fmt.Errorf("media exceeds %d bytes", maxOutgoingMediaBytes)
+	}
+	return data, resp.Header.Get("Content-Type"), nil
+}
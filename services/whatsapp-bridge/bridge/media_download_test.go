@@ -0,0 +1,126 @@
+package bridge_test
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"go.mau.fi/whatsmeow/util/cbcutil"
+	"go.mau.fi/whatsmeow/util/hkdfutil"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/phenobarbital/ai-parrot/whatsapp-bridge/bridge"
+	"github.com/phenobarbital/ai-parrot/whatsapp-bridge/bridgetest"
+)
+
+// encryptedMedia is a file encrypted the way WhatsApp's CDN serves it.
+type encryptedMedia struct {
+	Plaintext     []byte
+	File          []byte
+	MediaKey      []byte
+	FileEncSHA256 []byte
+	FileSHA256    []byte
+}
+
+func encryptMedia(t *testing.T, plaintext []byte, mediaType whatsmeow.MediaType) encryptedMedia {
+	t.Helper()
+	mediaKey := make([]byte, 32)
+	rand.Read(mediaKey)
+	keys := hkdfutil.SHA256(mediaKey, nil, []byte(mediaType), 112)
+	iv, cipherKey, macKey := keys[:16], keys[16:48], keys[48:80]
+	ciphertext, err := cbcutil.Encrypt(cipherKey, iv, plaintext)
+	if err != nil {
+		t.Fatalf("encrypt media: %v", err)
+	}
+	mac := hmac.New(sha256.New, macKey)
+	mac.Write(iv)
+	mac.Write(ciphertext)
+	file := append(ciphertext, mac.Sum(nil)[:10]...)
+	encSum, sum := sha256.Sum256(file), sha256.Sum256(plaintext)
+	return encryptedMedia{Plaintext: plaintext, File: file, MediaKey: mediaKey, FileEncSHA256: encSum[:], FileSHA256: sum[:]}
+}
+
+// serveMedia serves file with range support, as the CDN does.
+func serveMedia(t *testing.T, file []byte) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "media", time.Time{}, bytes.NewReader(file))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func testPNG(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 8, 8))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// receiveImage simulates an inbound image with the given message ID, its
+// encrypted file served by url.
+func receiveImage(h *bridgetest.Harness, id, phone, url string, media encryptedMedia) {
+	jid := types.NewJID(phone, types.DefaultUserServer)
+	h.Emit(&events.Message{
+		Info: types.MessageInfo{
+			MessageSource: types.MessageSource{Chat: jid, Sender: jid},
+			ID:            id,
+			Timestamp:     time.Now(),
+		},
+		Message: &waE2E.Message{ImageMessage: &waE2E.ImageMessage{
+			URL:           proto.String(url),
+			DirectPath:    proto.String("/v/t62/" + hex.EncodeToString(media.FileSHA256[:8])),
+			MediaKey:      media.MediaKey,
+			FileEncSHA256: media.FileEncSHA256,
+			FileSHA256:    media.FileSHA256,
+			FileLength:    proto.Uint64(uint64(len(media.Plaintext))),
+			Mimetype:      proto.String("image/png"),
+		}},
+	})
+}
+
+func TestMediaDownloadKeepsPartialFilesInDir(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "data", "media")
+	h := bridgetest.New(t,
+		bridgetest.WithEnv("MEDIA_DOWNLOAD", "true"),
+		bridgetest.WithEnv("MEDIA_DOWNLOAD_DIR", dir),
+	)
+	media := encryptMedia(t, testPNG(t), whatsmeow.MediaImage)
+	srv := serveMedia(t, media.File)
+
+	// A sender picks message IDs, so they must not become paths.
+	receiveImage(h, "../../outside/escaped", "5215512345678", srv.URL+"/image", media)
+
+	var downloaded bridge.MediaDownloaded
+	h.DecodePayload(h.ExpectEvent(bridge.EventMediaDownloaded), &downloaded)
+	if downloaded.MessageID != "../../outside/escaped" {
+		t.Fatalf("downloaded media of %q", downloaded.MessageID)
+	}
+	if !strings.HasPrefix(downloaded.Path, dir+string(filepath.Separator)) {
+		t.Errorf("media stored at %s, outside %s", downloaded.Path, dir)
+	}
+	stored, err := os.ReadFile(downloaded.Path)
+	if err != nil || !bytes.Equal(stored, media.Plaintext) {
+		t.Errorf("stored media differs from the sent file (err %v)", err)
+	}
+	if entries, _ := os.ReadDir(root); len(entries) != 1 || entries[0].Name() != "data" {
+		t.Errorf("files created outside the media directory: %v", entries)
+	}
+}
@@ -0,0 +1,100 @@
+package bridge
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// On-demand media: the download details of every inbound media message are
+// kept for MEDIA_SOURCE_TTL, so GET /media/{id} can fetch and decrypt a file
+// the first time a consumer asks for it instead of the bridge downloading
+// everything up front. The request that finds the file missing starts the
+// download in the background and gets 202 with Retry-After; the file is
+// served once stored, and a media_downloaded event announces it like any
+// other download. Concurrent requests for one message share the download.
+//
+//	MEDIA_ON_DEMAND         - download media when it is first requested (default false)
+//	MEDIA_SOURCE_TTL        - how long media stays downloadable (default 30 days,
+//	                          about as long as WhatsApp keeps it)
+//	MEDIA_ON_DEMAND_TIMEOUT - how long a background download may take (default 2m)
+
+// mediaSourceKey holds the mediaJob of an inbound message's media.
+func mediaSourceKey(messageID string) string { return "whatsapp:media_source:" + messageID }
+
+// mediaGoneKey marks media an on-demand download found no longer available,
+// so later requests are answered 410 rather than downloading again.
+func mediaGoneKey(messageID string) string { return "whatsapp:media_gone:" + messageID }
+
+func mediaSourceTTL() time.Duration {
+	return envDuration("MEDIA_SOURCE_TTL", 30*24*time.Hour)
+}
+
+var (
+	errNoMediaSource = errors.New("no media known for message")
+	errMediaPending  = errors.New("media download in progress")
+)
+
+// Fetch returns the stored media of messageID. Media that is not stored yet
+// is downloaded in the background, and Fetch fails with errMediaPending
+// meanwhile. It fails with errNoMediaSource for messages without known
+// media and errMediaGone when WhatsApp no longer has it.
+func (d *MediaDownloader) Fetch(ctx context.Context, messageID string) (*StoredMedia, error) {
+	if blob, ok := d.library.Get(ctx, messageID); ok {
+		return blob, nil
+	}
+	if gone, _ := d.bridge.redisClient.Exists(ctx, mediaGoneKey(messageID)).Result(); gone > 0 {
+		return nil, errMediaGone
+	}
+	data, err := d.bridge.redisClient.Get(ctx, mediaSourceKey(messageID)).Bytes()
+	if err == redis.Nil {
+		return nil, errNoMediaSource
+	}
+	if err != nil {
+		return nil, err
+	}
+	var job mediaJob
+	if err := json.Unmarshal(data, &job); err != nil {
+		return nil, err
+	}
+	// Joins the download already running, if any; nobody waits for it.
+	d.fetching.DoChan(messageID, func() (any, error) {
+		ctx, cancel := context.WithTimeout(d.bridge.ctx, envDuration("MEDIA_ON_DEMAND_TIMEOUT", 2*time.Minute))
+		defer cancel()
+		return nil, d.fetchOnDemand(ctx, job)
+	})
+	return nil, errMediaPending
+}
+
+func (d *MediaDownloader) fetchOnDemand(ctx context.Context, job mediaJob) error {
+	if _, ok := d.library.Get(ctx, job.MessageID); ok {
+		return nil
+	}
+	// The eager download of the message is still running.
+	if pending, _ := d.bridge.redisClient.HExists(ctx, mediaJobsKey, job.MessageID).Result(); pending {
+		return nil
+	}
+	if blob, ok := d.reuse(ctx, job); ok {
+		d.published(ctx, job, blob, 0, true)
+		return nil
+	}
+
+	part := d.partPath(job.MessageID, ".fetch.part")
+	blob, retries, err := d.download(ctx, job, part)
+	if err != nil {
+		os.Remove(part)
+		log.Printf("❌ On-demand download of media of %s failed: %v", job.MessageID, err)
+		if errors.Is(err, errMediaGone) {
+			d.bridge.redisClient.Set(d.bridge.ctx, mediaGoneKey(job.MessageID), err.Error(), mediaSourceTTL())
+		}
+		return err
+	}
+	log.Printf("📥 Downloaded media of %s on demand to %s (%s)", job.MessageID, blob.Key, formatBytes(blob.Size))
+	d.published(ctx, job, blob, retries, false)
+	return nil
+}
@@ -0,0 +1,85 @@
+package bridge_test
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+
+	"github.com/phenobarbital/ai-parrot/whatsapp-bridge/bridge"
+	"github.com/phenobarbital/ai-parrot/whatsapp-bridge/bridgetest"
+)
+
+// getMedia fetches GET /media/{id}, returning the status and body.
+func getMedia(t *testing.T, h *bridgetest.Harness, id string) (*http.Response, []byte) {
+	t.Helper()
+	resp, err := h.Server.Client().Get(h.Server.URL + "/media/" + id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return resp, body
+}
+
+func TestMediaOnDemandDownloadsInBackground(t *testing.T) {
+	h := bridgetest.New(t,
+		bridgetest.WithEnv("MEDIA_ON_DEMAND", "true"),
+		bridgetest.WithEnv("MEDIA_DOWNLOAD_DIR", t.TempDir()),
+	)
+	media := encryptMedia(t, testPNG(t), whatsmeow.MediaImage)
+	receiveImage(h, "IMG1", "5215512345678", serveMedia(t, media.File).URL+"/image", media)
+
+	resp, _ := getMedia(t, h, "IMG1")
+	if resp.StatusCode != http.StatusAccepted || resp.Header.Get("Retry-After") == "" {
+		t.Fatalf("first request = %d (Retry-After %q), want 202", resp.StatusCode, resp.Header.Get("Retry-After"))
+	}
+	var downloaded bridge.MediaDownloaded
+	h.DecodePayload(h.ExpectEvent(bridge.EventMediaDownloaded), &downloaded)
+	if downloaded.MessageID != "IMG1" {
+		t.Fatalf("downloaded media of %q", downloaded.MessageID)
+	}
+
+	resp, body := getMedia(t, h, "IMG1")
+	if resp.StatusCode != http.StatusOK || !bytes.Equal(body, media.Plaintext) {
+		t.Fatalf("after download = %d with %d bytes", resp.StatusCode, len(body))
+	}
+}
+
+func TestMediaOnDemandGone(t *testing.T) {
+	h := bridgetest.New(t,
+		bridgetest.WithEnv("MEDIA_ON_DEMAND", "true"),
+		bridgetest.WithEnv("MEDIA_DOWNLOAD_DIR", t.TempDir()),
+	)
+	media := encryptMedia(t, testPNG(t), whatsmeow.MediaImage)
+	// Expired before anyone asked.
+	cdn := httptest.NewServer(http.NotFoundHandler())
+	t.Cleanup(cdn.Close)
+	receiveImage(h, "IMG1", "5215512345678", cdn.URL+"/image", media)
+
+	deadline := time.Now().Add(bridgetest.DefaultTimeout)
+	for {
+		resp, _ := getMedia(t, h, "IMG1")
+		if resp.StatusCode == http.StatusGone {
+			break
+		}
+		if resp.StatusCode != http.StatusAccepted || time.Now().After(deadline) {
+			t.Fatalf("GET /media/IMG1 = %d, want 202 until 410", resp.StatusCode)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestMediaOnDemandOffByDefault(t *testing.T) {
+	h := bridgetest.New(t, bridgetest.WithEnv("MEDIA_DOWNLOAD_DIR", t.TempDir()))
+	media := encryptMedia(t, testPNG(t), whatsmeow.MediaImage)
+	receiveImage(h, "IMG1", "5215512345678", serveMedia(t, media.File).URL+"/image", media)
+
+	if resp, _ := getMedia(t, h, "IMG1"); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("GET /media/IMG1 = %d, want 404", resp.StatusCode)
+	}
+}
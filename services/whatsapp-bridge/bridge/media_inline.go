@@ -0,0 +1,85 @@
+package bridge
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"log"
+	"time"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+)
+
+// Media messages carry a media_info block with the file's MIME type, size
+// and hash; Media itself is WhatsApp's encrypted CDN URL, which consumers
+// cannot use. Files up to MEDIA_INLINE_MAX_BYTES (default 0, off) are
+// downloaded and decrypted before the message is published and embedded as
+// base64 in media_info.data, so agents handling small images or voice notes
+// need nothing else. Larger files are the job of MEDIA_DOWNLOAD.
+//
+//	MEDIA_INLINE_MAX_BYTES - largest file embedded in the payload (0 = none)
+//	MEDIA_INLINE_TIMEOUT   - how long the download may hold the message back (default 20s)
+
+// MediaInfo describes the media of an inbound message.
+type MediaInfo struct {
+	MimeType string `json:"mime_type"`
+	Size     int64  `json:"size"`
+	SHA256   string `json:"sha256,omitempty"`
+	FileName string `json:"file_name,omitempty"`
+	Data     string `json:"data,omitempty"` // base64 content, when embedded
+
+	// StorageKey is the media's key in the MediaStore once downloaded.
+	StorageKey string `json:"storage_key,omitempty"`
+
+	// Thumbnail is the storage key of the preview of an image or video,
+	// also served by GET /media/{id}/thumbnail (see thumbnails.go).
+	Thumbnail string `json:"thumbnail,omitempty"`
+
+	// Download is auto, on_demand or none (see media_rules.go), and
+	// DownloadRule the download rule that decided it.
+	Download     string `json:"download,omitempty"`
+	DownloadRule string `json:"download_rule,omitempty"`
+
+	// Animated is set for animated stickers.
+	Animated bool `json:"animated,omitempty"`
+}
+
+// mediaInfo returns the metadata of media, or nil for non-media messages.
+func mediaInfo(media inboundMedia) *MediaInfo {
+	if media == nil {
+		return nil
+	}
+	info := &MediaInfo{
+		MimeType: media.GetMimetype(),
+		Size:     int64(media.GetFileLength()),
+		SHA256:   hex.EncodeToString(media.GetFileSHA256()),
+	}
+	if doc, ok := media.(interface{ GetFileName() string }); ok {
+		info.FileName = doc.GetFileName()
+	}
+	if sticker, ok := media.(*waE2E.StickerMessage); ok {
+		info.Animated = sticker.GetIsAnimated()
+	}
+	return info
+}
+
+// embedMedia downloads small media into info.Data. Failures only cost the
+// embedding: the message is published without it.
+func (b *WhatsAppBridge) embedMedia(messageID string, info *MediaInfo, media inboundMedia) {
+	limit := int64(envInt("MEDIA_INLINE_MAX_BYTES", 0))
+	if info == nil || limit <= 0 || info.Size > limit {
+		return
+	}
+	ctx, cancel := context.WithTimeout(b.ctx, envDuration("MEDIA_INLINE_TIMEOUT", 20*time.Second))
+	defer cancel()
+	data, err := b.client.Download(ctx, media)
+	if err != nil {
+		log.Printf("Error downloading media of %s to embed: %v", messageID, err)
+		return
+	}
+	if int64(len(data)) > limit {
+		return // the message understated its size
+	}
+	info.Size = int64(len(data))
+	info.Data = base64.StdEncoding.EncodeToString(data)
+}
@@ -0,0 +1,236 @@
+package bridge
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// EventMediaRejected is published instead of a message event when inbound
+// media violates the media policy.
+const EventMediaRejected = "media_rejected"
+
+// Rejection codes carried in MediaRejected.Code.
+const (
+	RejectTooLarge       = "too_large"
+	RejectMIMENotAllowed = "mime_not_allowed"
+	RejectInfected       = "infected"
+	RejectScanFailed     = "scan_failed"
+)
+
+// inboundMedia is implemented by the image, audio, video, document and sticker
+// messages.
+type inboundMedia interface {
+	whatsmeow.DownloadableMessage
+	GetMimetype() string
+	GetFileLength() uint64
+}
+
+// MediaPolicy limits the inbound media forwarded to sinks. A nil policy
+// accepts everything.
+//
+//	MEDIA_MAX_BYTES        - largest accepted file (0 = unlimited)
+//	MEDIA_ALLOWED_TYPES    - comma-separated MIME globs, e.g. "image/*,application/pdf";
+//	                         stickers are accepted whatever it lists
+//	MEDIA_SCAN_URL         - scanner the file is POSTed to; 2xx = clean,
+//	                         406/422 = infected, anything else = scan failure
+//	MEDIA_REJECT_NOTIFY    - reply to the sender when media is rejected (default true)
+//	MEDIA_REJECT_TEMPLATE  - reply text; {type}, {reason}, {max_size} and
+//	                         {file_name} are substituted
+type MediaPolicy struct {
+	MaxBytes     int64
+	AllowedTypes []string
+	ScanURL      string
+	Notify       bool
+	Template     string
+
+	scanClient *http.Client
+}
+
+// MediaRejection explains why a piece of media was refused.
+type MediaRejection struct {
+	Code   string
+	Reason string
+}
+
+// MediaRejected is the payload of a media_rejected event.
+type MediaRejected struct {
+	MessageID    string `json:"message_id"`
+	From         string `json:"from"`
+	FromServer   string `json:"from_server"`
+	FromName     string `json:"from_name"`
+	Chat         string `json:"chat"`
+	ContactID    string `json:"contact_id,omitempty"`
+	Type         string `json:"type"`
+	MimeType     string `json:"mime_type"`
+	Size         uint64 `json:"size"`
+	FileName     string `json:"file_name,omitempty"`
+	Caption      string `json:"caption,omitempty"`
+	Code         string `json:"code"`
+	Reason       string `json:"reason"`
+	Notified     bool   `json:"notified"`
+	Timestamp    int64  `json:"timestamp"`
+	TimestampISO string `json:"timestamp_iso"`
+}
+
+// mediaPolicyFromEnv returns nil unless a size limit, type allowlist or
+// scanner is configured.
+func mediaPolicyFromEnv() *MediaPolicy {
+	p := &MediaPolicy{
+		MaxBytes:     int64(envInt("MEDIA_MAX_BYTES", 0)),
+		AllowedTypes: envList("MEDIA_ALLOWED_TYPES"),
+		ScanURL:      envString("MEDIA_SCAN_URL", ""),
+		Notify:       envBool("MEDIA_REJECT_NOTIFY", true),
+		Template: envString("MEDIA_REJECT_TEMPLATE",
+			"Sorry, we couldn't accept your {type}: {reason}."),
+		scanClient: &http.Client{Timeout: envDuration("MEDIA_SCAN_TIMEOUT", 30*time.Second)},
+	}
+	if p.MaxBytes <= 0 && len(p.AllowedTypes) == 0 && p.ScanURL == "" {
+		return nil
+	}
+	return p
+}
+
+// Check applies the policy to media, cheapest rules first so oversized or
+// disallowed files are never downloaded for scanning.
+func (p *MediaPolicy) Check(ctx context.Context, client Client, media inboundMedia) *MediaRejection {
+	if p == nil || media == nil {
+		return nil
+	}
+	if p.MaxBytes > 0 && media.GetFileLength() > uint64(p.MaxBytes) {
+		return &MediaRejection{Code: RejectTooLarge, Reason: "the file exceeds the " + formatBytes(p.MaxBytes) + " limit"}
+	}
+	mimeType, _, _ := strings.Cut(media.GetMimetype(), ";")
+	_, sticker := media.(*waE2E.StickerMessage)
+	if len(p.AllowedTypes) > 0 && !sticker && !matchesAny(p.AllowedTypes, strings.TrimSpace(mimeType)) {
+		return &MediaRejection{Code: RejectMIMENotAllowed, Reason: "files of type " + mimeType + " are not accepted"}
+	}
+	if p.ScanURL != "" {
+		return p.scan(ctx, client, media, mimeType)
+	}
+	return nil
+}
+
+// scan downloads the file and submits it to the scanner. Scanner errors
+// reject the file: unscanned content is never forwarded.
+func (p *MediaPolicy) scan(ctx context.Context, client Client, media inboundMedia, mimeType string) *MediaRejection {
+	failed := &MediaRejection{Code: RejectScanFailed, Reason: "the file could not be checked"}
+
+	data, err := client.Download(ctx, media)
+	if err != nil {
+		log.Printf("Error downloading media for scanning: %v", err)
+		return failed
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.ScanURL, bytes.NewReader(data))
+	if err != nil {
+		log.Printf("Error building scan request: %v", err)
+		return failed
+	}
+	req.Header.Set("Content-Type", mimeType)
+
+	resp, err := p.scanClient.Do(req)
+	if err != nil {
+		log.Printf("Error scanning media: %v", err)
+		return failed
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusNotAcceptable || resp.StatusCode == http.StatusUnprocessableEntity:
+		log.Printf("🦠 Media scanner flagged file: %s", strings.TrimSpace(string(body)))
+		return &MediaRejection{Code: RejectInfected, Reason: "the file failed our security check"}
+	default:
+		log.Printf("Media scanner returned status %d", resp.StatusCode)
+		return failed
+	}
+}
+
+// rejectMedia announces a policy violation and, if enabled, tells the sender.
+func (b *WhatsAppBridge) rejectMedia(info types.MessageInfo, msg IncomingMessage, media inboundMedia, rejection *MediaRejection) {
+	log.Printf("🚫 Rejected %s from %s: %s", msg.Type, info.Sender.User, rejection.Reason)
+
+	evt := MediaRejected{
+		MessageID:    info.ID,
+		From:         msg.From,
+		FromServer:   msg.FromServer,
+		FromName:     msg.FromName,
+		Chat:         info.Chat.String(),
+		ContactID:    msg.ContactID,
+		Type:         msg.Type,
+		MimeType:     media.GetMimetype(),
+		Size:         media.GetFileLength(),
+		Code:         rejection.Code,
+		Reason:       rejection.Reason,
+		Timestamp:    msg.Timestamp,
+		TimestampISO: msg.TimestampISO,
+	}
+	if msg.Type == "document" {
+		evt.FileName = msg.Content
+	} else {
+		evt.Caption = msg.Content
+	}
+
+	if b.mediaPolicy.Notify && b.mediaPolicy.Template != "" {
+		text := strings.NewReplacer(
+			"{type}", msg.Type,
+			"{reason}", rejection.Reason,
+			"{max_size}", formatBytes(b.mediaPolicy.MaxBytes),
+			"{file_name}", evt.FileName,
+		).Replace(b.mediaPolicy.Template)
+		_, err := b.sendOutgoing(withOperator(b.ctx, "system:media_policy"), OutgoingMessage{
+			Phone:              info.Chat.User,
+			Server:             info.Chat.Server,
+			Message:            text,
+			ReplyToMessageID:   info.ID,
+			ReplyToParticipant: info.Sender.ToNonAD().String(),
+		})
+		evt.Notified = err == nil
+	}
+
+	b.publish(EventMediaRejected, info.Chat.String(), evt)
+}
+
+// mediaFromMessage returns the downloadable media of msg, if any.
+func mediaFromMessage(msg *events.Message) inboundMedia {
+	switch {
+	case msg.Message.GetImageMessage() != nil:
+		return msg.Message.GetImageMessage()
+	case msg.Message.GetAudioMessage() != nil:
+		return msg.Message.GetAudioMessage()
+	case msg.Message.GetVideoMessage() != nil:
+		return msg.Message.GetVideoMessage()
+	case msg.Message.GetDocumentMessage() != nil:
+		return msg.Message.GetDocumentMessage()
+	case msg.Message.GetStickerMessage() != nil:
+		return msg.Message.GetStickerMessage()
+	}
+	return nil
+}
+
+// formatBytes renders a size for humans, e.g. 16777216 -> "16 MB".
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return strconv.FormatInt(n, 10) + " B"
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.0f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
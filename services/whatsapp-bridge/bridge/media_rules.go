@@ -0,0 +1,104 @@
+package bridge
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Media download rules decide per file whether inbound media is downloaded
+// as it arrives, overriding MEDIA_DOWNLOAD for the media they match. They
+// are read from MEDIA_DOWNLOAD_RULES (inline JSON) or
+// MEDIA_DOWNLOAD_RULES_CONFIG (a JSON file), and the first matching rule
+// decides:
+//
+//	[
+//	  {"name": "transcription", "types": ["audio"], "download": true},
+//	  {"name": "large-video", "types": ["video"], "min_bytes": 20971520, "download": false},
+//	  {"name": "pdf", "mime_types": ["application/pdf"], "download": true}
+//	]
+//
+// Media that is not downloaded stays available on demand with
+// MEDIA_ON_DEMAND. The decision is published in the message's
+// media_info: download is auto, on_demand or none, and download_rule names
+// the rule that decided.
+
+// Download decisions carried in MediaInfo.Download.
+const (
+	DownloadAuto     = "auto"      // downloaded as it arrived
+	DownloadOnDemand = "on_demand" // downloaded when GET /media/{id} asks for it
+	DownloadNone     = "none"      // not downloaded
+)
+
+// MediaDownloadRule matches inbound media by type, MIME type and size.
+type MediaDownloadRule struct {
+	Name      string   `json:"name,omitempty"`
+	Types     []string `json:"types,omitempty"`      // image, audio, video, document or sticker
+	MimeTypes []string `json:"mime_types,omitempty"` // MIME globs, e.g. "image/*"
+	MinBytes  int64    `json:"min_bytes,omitempty"`  // files of at least this size
+	MaxBytes  int64    `json:"max_bytes,omitempty"`  // files of at most this size
+	Download  bool     `json:"download"`
+}
+
+// matches reports whether the rule applies to a file of msgType.
+func (r MediaDownloadRule) matches(msgType, mimeType string, size int64) bool {
+	if len(r.Types) > 0 && !containsString(r.Types, msgType) {
+		return false
+	}
+	mimeType, _, _ = strings.Cut(mimeType, ";")
+	if len(r.MimeTypes) > 0 && !matchesAny(r.MimeTypes, strings.TrimSpace(mimeType)) {
+		return false
+	}
+	if r.MinBytes > 0 && size < r.MinBytes {
+		return false
+	}
+	return r.MaxBytes <= 0 || size <= r.MaxBytes
+}
+
+// mediaDownloadRulesFromEnv loads MEDIA_DOWNLOAD_RULES /
+// MEDIA_DOWNLOAD_RULES_CONFIG, returning nil when neither is set.
+func mediaDownloadRulesFromEnv() ([]MediaDownloadRule, error) {
+	raw := []byte(envString("MEDIA_DOWNLOAD_RULES", ""))
+	if file := envString("MEDIA_DOWNLOAD_RULES_CONFIG", ""); file != "" && len(raw) == 0 {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read MEDIA_DOWNLOAD_RULES_CONFIG: %v", err)
+		}
+		raw = data
+	}
+	if len(raw) == 0 {
+		return nil, nil
+	}
+
+	var rules []MediaDownloadRule
+	if err := json.Unmarshal(raw, &rules); err != nil {
+		return nil, fmt.Errorf("invalid media download rules: %v", err)
+	}
+	for i, rule := range rules {
+		for _, t := range rule.Types {
+			if !containsString([]string{"image", "audio", "video", "document", "sticker"}, t) {
+				return nil, fmt.Errorf("media download rule %d (%s): unknown type %q", i, rule.Name, t)
+			}
+		}
+		if rule.MaxBytes > 0 && rule.MinBytes > rule.MaxBytes {
+			return nil, fmt.Errorf("media download rule %d (%s): min_bytes is over max_bytes", i, rule.Name)
+		}
+		if rule.Name == "" {
+			rules[i].Name = fmt.Sprintf("rule-%d", i+1)
+		}
+	}
+	return rules, nil
+}
+
+// decide returns whether a file is downloaded as it arrives and the name of
+// the rule that said so ("" for the default: MEDIA_DOWNLOAD, audio with
+// AUDIO_EVENTS and stickers with STICKER_DOWNLOAD).
+func (d *MediaDownloader) decide(job mediaJob, size int64) (bool, string) {
+	for _, rule := range d.Rules {
+		if rule.matches(job.Type, job.MimeType, size) {
+			return rule.Download, rule.Name
+		}
+	}
+	return d.Eager || (d.AudioEvents && job.Type == "audio") || (d.Stickers && job.Type == "sticker"), ""
+}
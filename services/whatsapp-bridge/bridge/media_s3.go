@@ -0,0 +1,140 @@
+package bridge
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// S3MediaStore keeps media in S3-compatible object storage (AWS S3, MinIO,
+// R2, or GCS with HMAC keys and storage.googleapis.com as the endpoint), so
+// consumers on other hosts can fetch it. media_downloaded events carry the
+// object's URL: under MEDIA_S3_PUBLIC_URL when the bucket is served
+// publicly, else presigned. Staged files are removed once uploaded.
+//
+//	MEDIA_S3_ENDPOINT   - host[:port] of the S3 API (required)
+//	MEDIA_S3_BUCKET     - bucket (required)
+//	MEDIA_S3_ACCESS_KEY, MEDIA_S3_SECRET_KEY - credentials
+//	MEDIA_S3_REGION     - region (default none)
+//	MEDIA_S3_SECURE     - use HTTPS (default true)
+//	MEDIA_S3_PREFIX     - key prefix (default media/)
+//	MEDIA_S3_PUBLIC_URL - base URL objects are publicly served under
+//	MEDIA_S3_URL_TTL    - lifetime of presigned URLs (default 24h, at most 7 days)
+type S3MediaStore struct {
+	Bucket    string
+	Prefix    string
+	PublicURL string
+	URLTTL    time.Duration
+
+	client *minio.Client
+}
+
+func s3MediaStoreFromEnv() (*S3MediaStore, error) {
+	endpoint := envString("MEDIA_S3_ENDPOINT", "")
+	bucket := envString("MEDIA_S3_BUCKET", "")
+	if endpoint == "" || bucket == "" {
+		return nil, fmt.Errorf("MEDIA_STORE=%s requires MEDIA_S3_ENDPOINT and MEDIA_S3_BUCKET", envString("MEDIA_STORE", "mirror"))
+	}
+	client, err := minio.New(endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(envString("MEDIA_S3_ACCESS_KEY", ""), envString("MEDIA_S3_SECRET_KEY", ""), ""),
+		Secure: envBool("MEDIA_S3_SECURE", true),
+		Region: envString("MEDIA_S3_REGION", ""),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid object storage configuration: %v", err)
+	}
+	return &S3MediaStore{
+		Bucket:    bucket,
+		Prefix:    envString("MEDIA_S3_PREFIX", "media/"),
+		PublicURL: strings.TrimSuffix(envString("MEDIA_S3_PUBLIC_URL", ""), "/"),
+		URLTTL:    min(envDuration("MEDIA_S3_URL_TTL", 24*time.Hour), 7*24*time.Hour),
+		client:    client,
+	}, nil
+}
+
+func (s *S3MediaStore) object(key string) string { return path.Join(s.Prefix, key) }
+
+func (s *S3MediaStore) Put(ctx context.Context, key, src, mimeType string) error {
+	if err := s.upload(ctx, key, src, mimeType); err != nil {
+		return err
+	}
+	os.Remove(src)
+	return nil
+}
+
+// upload copies the file at src to the bucket under key.
+func (s *S3MediaStore) upload(ctx context.Context, key, src, mimeType string) error {
+	_, err := s.client.FPutObject(ctx, s.Bucket, s.object(key), src, minio.PutObjectOptions{ContentType: mimeType})
+	return err
+}
+
+func (s *S3MediaStore) Open(ctx context.Context, key string) (io.ReadSeekCloser, time.Time, error) {
+	obj, err := s.client.GetObject(ctx, s.Bucket, s.object(key), minio.GetObjectOptions{})
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	info, err := obj.Stat()
+	if err != nil {
+		obj.Close()
+		return nil, time.Time{}, err
+	}
+	return obj, info.LastModified, nil
+}
+
+func (s *S3MediaStore) Exists(ctx context.Context, key string) bool {
+	_, err := s.client.StatObject(ctx, s.Bucket, s.object(key), minio.StatObjectOptions{})
+	return err == nil
+}
+
+func (s *S3MediaStore) Delete(ctx context.Context, key string) error {
+	return s.client.RemoveObject(ctx, s.Bucket, s.object(key), minio.RemoveObjectOptions{})
+}
+
+func (s *S3MediaStore) URL(ctx context.Context, key string) (string, error) {
+	if s.PublicURL != "" {
+		return s.PublicURL + "/" + s.object(key), nil
+	}
+	signed, err := s.client.PresignedGetObject(ctx, s.Bucket, s.object(key), s.URLTTL, url.Values{})
+	if err != nil {
+		return "", err
+	}
+	return signed.String(), nil
+}
+
+// MirroredMediaStore keeps media in the local store, which serves
+// GET /media/{id}, and uploads a copy to S3, whose URL media_downloaded
+// events carry. It is what MEDIA_S3_ENDPOINT alone configured before there
+// were stores, and stays its default. Copies outlive local deletion; expire
+// them with a bucket lifecycle rule.
+type MirroredMediaStore struct {
+	*LocalMediaStore
+	S3 *S3MediaStore
+}
+
+// Put stores the file locally, then uploads the copy. A failed upload only
+// costs the URL, so it is logged rather than failing the download.
+func (s *MirroredMediaStore) Put(ctx context.Context, key, src, mimeType string) error {
+	if err := s.LocalMediaStore.Put(ctx, key, src, mimeType); err != nil {
+		return err
+	}
+	if err := s.S3.upload(ctx, key, s.path(key), mimeType); err != nil {
+		log.Printf("Error uploading media %s to bucket %s: %v", key, s.S3.Bucket, err)
+	}
+	return nil
+}
+
+func (s *MirroredMediaStore) URL(ctx context.Context, key string) (string, error) {
+	if !s.S3.Exists(ctx, key) {
+		return "", nil
+	}
+	return s.S3.URL(ctx, key)
+}
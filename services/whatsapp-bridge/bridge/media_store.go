@@ -0,0 +1,487 @@
+package bridge
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/gorilla/mux"
+)
+
+// MediaStore is where media files are kept: downloaded inbound media and,
+// with MEDIA_STORE_OUTGOING, the media the bridge sends. Keys are relative
+// slash-separated paths.
+//
+//	MEDIA_STORE - local, s3 or mirror (default mirror when MEDIA_S3_ENDPOINT
+//	              is set, as before there were stores, else local); s3
+//	              covers MinIO, R2 and GCS through its S3-compatible API
+type MediaStore interface {
+	// Put moves the file at src into the store under key.
+	Put(ctx context.Context, key, src, mimeType string) error
+	// Open returns the content under key and when it was stored.
+	Open(ctx context.Context, key string) (io.ReadSeekCloser, time.Time, error)
+	// Exists reports whether key is stored.
+	Exists(ctx context.Context, key string) bool
+	// Delete removes key; a missing key is not an error.
+	Delete(ctx context.Context, key string) error
+	// URL returns where consumers can fetch key from, "" when the store
+	// serves no URLs and GET /media/{id} is the way.
+	URL(ctx context.Context, key string) (string, error)
+}
+
+// mediaStoreFromEnv returns the configured store; dir is the root of the
+// local one.
+func mediaStoreFromEnv(dir string) (MediaStore, error) {
+	kind := envString("MEDIA_STORE", "")
+	if kind == "" {
+		kind = "local"
+		if envString("MEDIA_S3_ENDPOINT", "") != "" {
+			kind = "mirror"
+		}
+	}
+	switch kind {
+	case "local":
+		return &LocalMediaStore{Dir: dir}, nil
+	case "s3":
+		return s3MediaStoreFromEnv()
+	case "mirror":
+		s3, err := s3MediaStoreFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		return &MirroredMediaStore{LocalMediaStore: &LocalMediaStore{Dir: dir}, S3: s3}, nil
+	default:
+		return nil, fmt.Errorf("unknown MEDIA_STORE %q (want local, s3 or mirror)", kind)
+	}
+}
+
+// LocalMediaStore keeps media on disk under Dir.
+type LocalMediaStore struct {
+	Dir string
+}
+
+// path maps a key to its file. Absolute keys are paths recorded before
+// keys existed.
+func (s *LocalMediaStore) path(key string) string {
+	if filepath.IsAbs(key) {
+		return key
+	}
+	return filepath.Join(s.Dir, filepath.FromSlash(key))
+}
+
+func (s *LocalMediaStore) Put(ctx context.Context, key, src, mimeType string) error {
+	dst := s.path(key)
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	return os.Rename(src, dst)
+}
+
+func (s *LocalMediaStore) Open(ctx context.Context, key string) (io.ReadSeekCloser, time.Time, error) {
+	f, err := os.Open(s.path(key))
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, time.Time{}, err
+	}
+	return f, info.ModTime(), nil
+}
+
+func (s *LocalMediaStore) Exists(ctx context.Context, key string) bool {
+	_, err := os.Stat(s.path(key))
+	return err == nil
+}
+
+func (s *LocalMediaStore) Delete(ctx context.Context, key string) error {
+	file := s.path(key)
+	if err := os.Remove(file); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	os.Remove(filepath.Dir(file)) // only succeeds once the shard is empty
+	return nil
+}
+
+func (s *LocalMediaStore) URL(ctx context.Context, key string) (string, error) {
+	return "", nil
+}
+
+// MediaLibrary keeps media content-addressed in a MediaStore under
+// <first two hex digits>/<sha256><ext>, so a file forwarded into many chats
+// is stored once. Each blob counts the messages referencing it and is
+// deleted with the last one. Files are staged in Dir on their way into the
+// store.
+//
+//	whatsapp:media_blob:<sha256>  - hash: key, mime_type, size, stored_at
+//	whatsapp:media_refs:<sha256>  - set of message IDs referencing the blob
+//	whatsapp:media_messages       - hash: message ID -> sha256
+//	whatsapp:media_blobs          - sorted set: sha256 by stored_at, for retention
+type MediaLibrary struct {
+	Dir   string
+	Store MediaStore
+	redis *redis.Client
+}
+
+// mediaLibraryFromEnv stages files in MEDIA_DOWNLOAD_DIR, which is also the
+// root of the local store.
+func mediaLibraryFromEnv(redisClient *redis.Client) (*MediaLibrary, error) {
+	dir := envString("MEDIA_DOWNLOAD_DIR", filepath.Join(dataDir, "media"))
+	store, err := mediaStoreFromEnv(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &MediaLibrary{Dir: dir, Store: store, redis: redisClient}, nil
+}
+
+const (
+	mediaMessagesKey = "whatsapp:media_messages"
+	mediaBlobsKey    = "whatsapp:media_blobs"
+)
+
+func mediaBlobKey(sum string) string { return "whatsapp:media_blob:" + sum }
+func mediaRefsKey(sum string) string { return "whatsapp:media_refs:" + sum }
+
+// mediaStorageKey is where content with the given hex sha256 is stored.
+func mediaStorageKey(sum, ext string) string {
+	return path.Join(sum[:2], sum+ext)
+}
+
+// StoredMedia describes a blob in the library.
+type StoredMedia struct {
+	SHA256   string `json:"sha256"`
+	Key      string `json:"key"`
+	Path     string `json:"path,omitempty"` // with the local or mirrored store
+	MimeType string `json:"mime_type"`
+	Size     int64  `json:"size"`
+	Refs     int64  `json:"refs"`
+}
+
+// localPath returns the file of key in the local or mirrored store, ""
+// with others.
+func (l *MediaLibrary) localPath(key string) string {
+	switch store := l.Store.(type) {
+	case *LocalMediaStore:
+		return store.path(key)
+	case *MirroredMediaStore:
+		return store.path(key)
+	}
+	return ""
+}
+
+// Lookup returns the blob with the given hex sha256, if it is stored.
+func (l *MediaLibrary) Lookup(ctx context.Context, sum string) (*StoredMedia, bool) {
+	fields, err := l.redis.HGetAll(ctx, mediaBlobKey(sum)).Result()
+	if err != nil {
+		return nil, false
+	}
+	key := fields["key"]
+	if key == "" {
+		key = fields["path"]
+	}
+	if key == "" || !l.Store.Exists(ctx, key) {
+		return nil, false
+	}
+	size, _ := strconv.ParseInt(fields["size"], 10, 64)
+	refs, _ := l.redis.SCard(ctx, mediaRefsKey(sum)).Result()
+	return &StoredMedia{SHA256: sum, Key: key, Path: l.localPath(key), MimeType: fields["mime_type"], Size: size, Refs: refs}, true
+}
+
+// Reference records that messageID uses an already stored blob.
+func (l *MediaLibrary) Reference(ctx context.Context, messageID string, blob *StoredMedia) error {
+	pipe := l.redis.TxPipeline()
+	pipe.SAdd(ctx, mediaRefsKey(blob.SHA256), messageID)
+	pipe.HSet(ctx, mediaMessagesKey, messageID, blob.SHA256)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// Adopt moves a staged file into the store, or drops it when the same
+// content is already there, and references the blob from messageID. An
+// empty sum is computed from the file.
+func (l *MediaLibrary) Adopt(ctx context.Context, messageID, src, sum, ext, mimeType string) (*StoredMedia, error) {
+	if sum == "" {
+		var err error
+		if sum, err = fileSHA256(src); err != nil {
+			return nil, err
+		}
+	}
+	blob, ok := l.Lookup(ctx, sum)
+	if ok {
+		os.Remove(src)
+	} else {
+		info, err := os.Stat(src)
+		if err != nil {
+			return nil, err
+		}
+		key := mediaStorageKey(sum, ext)
+		if err := l.Store.Put(ctx, key, src, mimeType); err != nil {
+			return nil, err
+		}
+		blob = &StoredMedia{SHA256: sum, Key: key, Path: l.localPath(key), MimeType: mimeType, Size: info.Size()}
+		now := time.Now().Unix()
+		pipe := l.redis.TxPipeline()
+		pipe.HSet(ctx, mediaBlobKey(sum), "key", key, "mime_type", mimeType, "size", blob.Size, "stored_at", now)
+		pipe.ZAdd(ctx, mediaBlobsKey, &redis.Z{Score: float64(now), Member: sum})
+		if _, err := pipe.Exec(ctx); err != nil {
+			return nil, err
+		}
+	}
+	if err := l.Reference(ctx, messageID, blob); err != nil {
+		return nil, err
+	}
+	blob.Refs, _ = l.redis.SCard(ctx, mediaRefsKey(sum)).Result()
+	return blob, nil
+}
+
+// Keep stores data for messageID, for media that is not already a file.
+func (l *MediaLibrary) Keep(ctx context.Context, messageID string, data []byte, ext, mimeType string) (*StoredMedia, error) {
+	sum := sha256.Sum256(data)
+	hexSum := hex.EncodeToString(sum[:])
+	if blob, ok := l.Lookup(ctx, hexSum); ok {
+		if err := l.Reference(ctx, messageID, blob); err != nil {
+			return nil, err
+		}
+		return blob, nil
+	}
+	if err := os.MkdirAll(l.Dir, 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.CreateTemp(l.Dir, messageID+"-*.part")
+	if err != nil {
+		return nil, err
+	}
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return nil, err
+	}
+	blob, err := l.Adopt(ctx, messageID, f.Name(), hexSum, ext, mimeType)
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return blob, err
+}
+
+// URL returns where consumers can fetch blob from, "" when the store
+// serves no URLs or signing one failed.
+func (l *MediaLibrary) URL(ctx context.Context, blob *StoredMedia) string {
+	url, err := l.Store.URL(ctx, blob.Key)
+	if err != nil {
+		log.Printf("Error getting the URL of media %s: %v", blob.Key, err)
+	}
+	return url
+}
+
+// Get returns the blob referenced by messageID.
+func (l *MediaLibrary) Get(ctx context.Context, messageID string) (*StoredMedia, bool) {
+	sum, err := l.redis.HGet(ctx, mediaMessagesKey, messageID).Result()
+	if err != nil {
+		return nil, false
+	}
+	return l.Lookup(ctx, sum)
+}
+
+// releaseMedia drops a message's reference and, when it was the last one,
+// the blob's records, returning the key to delete ("" if still in use).
+var releaseMedia = redis.NewScript(`
+local sum = redis.call('HGET', KEYS[1], ARGV[1])
+if not sum then return false end
+redis.call('HDEL', KEYS[1], ARGV[1])
+local refs = 'whatsapp:media_refs:' .. sum
+local blob = 'whatsapp:media_blob:' .. sum
+redis.call('SREM', refs, ARGV[1])
+if redis.call('SCARD', refs) > 0 then return '' end
+local key = redis.call('HGET', blob, 'key') or redis.call('HGET', blob, 'path') or ''
+redis.call('DEL', refs, blob)
+redis.call('ZREM', KEYS[2], sum)
+return key
+`)
+
+// Release drops messageID's reference, deleting the blob once no message
+// uses it. It reports false when the message had no stored media.
+func (l *MediaLibrary) Release(ctx context.Context, messageID string) (bool, error) {
+	key, err := releaseMedia.Run(ctx, l.redis, []string{mediaMessagesKey, mediaBlobsKey}, messageID).Text()
+	if err == redis.Nil {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if key != "" {
+		if err := l.Store.Delete(ctx, key); err != nil {
+			log.Printf("Error removing media %s: %v", key, err)
+		}
+		l.deleteThumbnail(ctx, key)
+	}
+	return true, nil
+}
+
+// purgeMedia drops a blob's records, the references of every message to
+// it and their download details, returning the key to delete ("" if none).
+var purgeMedia = redis.NewScript(`
+local refs = 'whatsapp:media_refs:' .. ARGV[1]
+local blob = 'whatsapp:media_blob:' .. ARGV[1]
+for _, id in ipairs(redis.call('SMEMBERS', refs)) do
+	redis.call('HDEL', KEYS[1], id)
+	redis.call('DEL', 'whatsapp:media_source:' .. id)
+end
+local key = redis.call('HGET', blob, 'key') or redis.call('HGET', blob, 'path') or ''
+redis.call('DEL', refs, blob)
+redis.call('ZREM', KEYS[2], ARGV[1])
+return key
+`)
+
+// Purge deletes a blob whatever references it, along with the download
+// details of those messages so it is not fetched again on demand. The
+// records go first, in one step, so no message points at a deleted file.
+func (l *MediaLibrary) Purge(ctx context.Context, sum string) error {
+	key, err := purgeMedia.Run(ctx, l.redis, []string{mediaMessagesKey, mediaBlobsKey}, sum).Text()
+	if err != nil {
+		return err
+	}
+	if key != "" {
+		if err := l.Store.Delete(ctx, key); err != nil {
+			return err
+		}
+		l.deleteThumbnail(ctx, key)
+	}
+	return nil
+}
+
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// handleGetMedia serves GET /media/{id}, the decrypted media of a message,
+// downloading it first when it is not stored yet. The content hash is the
+// ETag, and Range requests are honored.
+func (b *WhatsAppBridge) handleGetMedia(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	blob, ok := b.media.Get(r.Context(), id)
+	if !ok && b.downloader != nil {
+		var err error
+		blob, err = b.downloader.Fetch(r.Context(), id)
+		switch {
+		case err == nil:
+			ok = true
+		case errors.Is(err, errMediaPending):
+			w.Header().Set("Retry-After", "5")
+			writeJSON(w, http.StatusAccepted, Response{Success: false, Error: err.Error()})
+			return
+		case errors.Is(err, errMediaGone):
+			writeJSON(w, http.StatusGone, Response{Success: false, Error: err.Error()})
+			return
+		case !errors.Is(err, errNoMediaSource):
+			writeJSON(w, http.StatusBadGateway, Response{Success: false, Error: err.Error()})
+			return
+		}
+	}
+	if !ok {
+		writeJSON(w, http.StatusNotFound, Response{Success: false, Error: "no media stored for message " + id})
+		return
+	}
+	content, modTime, err := b.media.Store.Open(r.Context(), blob.Key)
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, Response{Success: false, Error: "media of message " + id + " is gone"})
+		return
+	}
+	defer content.Close()
+	if blob.MimeType != "" {
+		w.Header().Set("Content-Type", blob.MimeType)
+	}
+	w.Header().Set("ETag", `"`+blob.SHA256+`"`)
+	w.Header().Set("Cache-Control", "private, max-age=31536000, immutable")
+	http.ServeContent(w, r, path.Base(blob.Key), modTime, content)
+}
+
+// handleDeleteMedia serves DELETE /media/{id}, dropping the message's
+// reference; the file goes once no other message uses it.
+func (b *WhatsAppBridge) handleDeleteMedia(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	found, err := b.media.Release(r.Context(), id)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	if !found {
+		writeJSON(w, http.StatusNotFound, Response{Success: false, Error: "no media stored for message " + id})
+		return
+	}
+	writeJSON(w, http.StatusOK, Response{Success: true})
+}
+
+// EventMediaStored is published when the media of an outgoing message is
+// kept, with MEDIA_STORE_OUTGOING (default false). It comes before the
+// message is sent; the message's status tells whether that worked.
+const EventMediaStored = "media_stored"
+
+// MediaStored is the payload of media_stored events.
+type MediaStored struct {
+	MessageID string `json:"message_id"`
+	Chat      string `json:"chat"`
+	Type      string `json:"type"`
+	Key       string `json:"key"`
+	URL       string `json:"url,omitempty"`
+	Thumbnail string `json:"thumbnail,omitempty"`
+	SHA256    string `json:"sha256"`
+	MimeType  string `json:"mime_type"`
+	Size      int64  `json:"size"`
+}
+
+// keepOutgoingMedia stores the media of outgoing message id. data is nil
+// for a cached template upload, which is found by its hash when some
+// earlier message stored it. Failures are logged; the send goes on.
+func (b *WhatsAppBridge) keepOutgoingMedia(ctx context.Context, chat, id, kind string, data, fileSHA256 []byte, ext, mimeType, thumbnail string) {
+	if !envBool("MEDIA_STORE_OUTGOING", false) {
+		return
+	}
+	var blob *StoredMedia
+	var err error
+	if data != nil {
+		blob, err = b.media.Keep(ctx, id, data, ext, mimeType)
+	} else if found, ok := b.media.Lookup(ctx, hex.EncodeToString(fileSHA256)); ok {
+		blob, err = found, b.media.Reference(ctx, id, found)
+	} else {
+		return
+	}
+	if err != nil {
+		log.Printf("Error storing media of %s: %v", id, err)
+		return
+	}
+	b.publish(EventMediaStored, chat, MediaStored{
+		MessageID: id,
+		Chat:      chat,
+		Type:      kind,
+		Key:       blob.Key,
+		URL:       b.media.URL(ctx, blob),
+		Thumbnail: thumbnail,
+		SHA256:    blob.SHA256,
+		MimeType:  blob.MimeType,
+		Size:      blob.Size,
+	})
+}
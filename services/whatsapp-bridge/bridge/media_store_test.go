@@ -0,0 +1,31 @@
+package bridge
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestMediaStoreFromEnv(t *testing.T) {
+	t.Setenv("MEDIA_S3_BUCKET", "media")
+	for _, tc := range []struct {
+		store, endpoint string
+		want            string
+	}{
+		{"", "", "*bridge.LocalMediaStore"},
+		// MEDIA_S3_ENDPOINT alone keeps the local copy and uploads one, as it
+		// did before stores existed.
+		{"", "localhost:9000", "*bridge.MirroredMediaStore"},
+		{"s3", "localhost:9000", "*bridge.S3MediaStore"},
+		{"local", "localhost:9000", "*bridge.LocalMediaStore"},
+	} {
+		t.Setenv("MEDIA_STORE", tc.store)
+		t.Setenv("MEDIA_S3_ENDPOINT", tc.endpoint)
+		store, err := mediaStoreFromEnv(t.TempDir())
+		if err != nil {
+			t.Fatalf("MEDIA_STORE=%q MEDIA_S3_ENDPOINT=%q: %v", tc.store, tc.endpoint, err)
+		}
+		if got := fmt.Sprintf("%T", store); got != tc.want {
+			t.Errorf("MEDIA_STORE=%q MEDIA_S3_ENDPOINT=%q: %s, want %s", tc.store, tc.endpoint, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package bridge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// mentionPattern matches @-tokens carrying a phone number, e.g. "@5215512345678"
+// or "@+5215512345678".
+var mentionPattern = regexp.MustCompile(`@\+?(\d{6,15})\b`)
+
+// extractMentions returns the text with "@+number" tokens normalized to the
+// "@number" form WhatsApp renders, and the JIDs to notify: those found in the
+// text plus any explicit mentions (phones or JIDs), deduplicated in order.
+func extractMentions(text string, explicit []string) (string, []string) {
+	seen := make(map[string]bool)
+	var jids []string
+	add := func(jid types.JID) {
+		s := jid.ToNonAD().String()
+		if !seen[s] {
+			seen[s] = true
+			jids = append(jids, s)
+		}
+	}
+
+	text = mentionPattern.ReplaceAllStringFunc(text, func(token string) string {
+		number := mentionPattern.FindStringSubmatch(token)[1]
+		add(types.NewJID(number, types.DefaultUserServer))
+		return "@" + number
+	})
+
+	for _, m := range explicit {
+		if jid, err := parseJIDOrPhone(m); err == nil && !jid.IsEmpty() {
+			add(jid)
+		}
+	}
+	return text, jids
+}
+
+// mention_all tags every current participant of a group. The mentions are
+// silent: they notify without adding @tokens to the text. Groups larger
+// than MENTION_ALL_CHUNK (default 0, no chunking) are tagged across
+// follow-up messages listing the remaining participants as @tokens, and
+// groups larger than MENTION_ALL_MAX (default 256) are refused so a typo'd
+// community chat is not pinged by the thousand.
+
+// mentionAllChunks resolves the participants of group, except the bridge's
+// own account, and splits them into the mention lists of the messages to
+// send.
+func (b *WhatsAppBridge) mentionAllChunks(ctx context.Context, group types.JID) ([][]string, error) {
+	info, err := b.client.GetGroupInfo(ctx, group)
+	if errors.Is(err, whatsmeow.ErrGroupNotFound) || errors.Is(err, whatsmeow.ErrNotInGroup) {
+		return nil, fmt.Errorf("%w: mention_all: %v", errPermanent, err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("mention_all: %v", err)
+	}
+	var own, ownLID types.JID
+	if device := b.client.Device(); device != nil && device.ID != nil {
+		own, ownLID = device.ID.ToNonAD(), device.LID.ToNonAD()
+	}
+	var jids []string
+	for _, p := range info.Participants {
+		if jid := p.JID.ToNonAD(); jid != own && (ownLID.IsEmpty() || jid != ownLID) {
+			jids = append(jids, jid.String())
+		}
+	}
+	if limit := envInt("MENTION_ALL_MAX", 256); limit > 0 && len(jids) > limit {
+		return nil, fmt.Errorf("%w: mention_all: group has %d participants, more than MENTION_ALL_MAX (%d)",
+			errPermanent, len(jids), limit)
+	}
+
+	size := envInt("MENTION_ALL_CHUNK", 0)
+	if size <= 0 || size >= len(jids) {
+		return [][]string{jids}, nil
+	}
+	var chunks [][]string
+	for len(jids) > size {
+		chunks = append(chunks, jids[:size])
+		jids = jids[size:]
+	}
+	return append(chunks, jids), nil
+}
+
+// mentionTokens renders jids as the @tokens of a follow-up mention message.
+func mentionTokens(jids []string) string {
+	tokens := make([]string, 0, len(jids))
+	for _, s := range jids {
+		if jid, err := types.ParseJID(s); err == nil {
+			tokens = append(tokens, "@"+jid.User)
+		}
+	}
+	return strings.Join(tokens, " ")
+}
+
+// inboundMentions returns the JIDs an inbound message tags, deduplicated
+// in order, and whether the bridge's account is one of them, so group bots
+// can answer only when tagged.
+func (b *WhatsAppBridge) inboundMentions(msg *waE2E.Message) ([]string, bool) {
+	var jids []string
+	me := false
+	seen := make(map[string]bool)
+	for _, raw := range contextInfo(msg).GetMentionedJID() {
+		jid, err := types.ParseJID(raw)
+		if err != nil || jid.IsEmpty() {
+			continue
+		}
+		s := jid.ToNonAD().String()
+		if seen[s] {
+			continue
+		}
+		seen[s] = true
+		jids = append(jids, s)
+		me = me || b.isOwnJID(jid)
+	}
+	return jids, me
+}
@@ -0,0 +1,42 @@
+package bridge_test
+
+import (
+	"slices"
+	"testing"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/phenobarbital/ai-parrot/whatsapp-bridge/bridgetest"
+)
+
+// mentioning builds a text tagging jids.
+func mentioning(text string, jids ...string) *waE2E.Message {
+	return &waE2E.Message{ExtendedTextMessage: &waE2E.ExtendedTextMessage{
+		Text:        proto.String(text),
+		ContextInfo: &waE2E.ContextInfo{MentionedJID: jids},
+	}}
+}
+
+func TestInboundMentions(t *testing.T) {
+	h := bridgetest.New(t)
+	h.ReceiveGroupText("120363012345678901", "5215512345678", "hi")
+	h.ExpectMessage()
+	group := types.NewJID("120363012345678901", types.GroupServer)
+	sender := types.NewJID("5215512345678", types.DefaultUserServer)
+
+	// The bridge's account, once by device, and a contact tagged twice.
+	h.Receive(group, sender, mentioning("@15550000000 @5215587654321 can you help?",
+		"15550000000:3@s.whatsapp.net", "5215587654321@s.whatsapp.net", "5215587654321@s.whatsapp.net", "not a jid@"))
+	msg := h.ExpectMessage()
+	want := []string{bridgetest.DefaultOwnJID.String(), "5215587654321@s.whatsapp.net"}
+	if !slices.Equal(msg.Mentions, want) || !msg.MentionsMe {
+		t.Errorf("mentions = %v (me: %v), want %v (me: true)", msg.Mentions, msg.MentionsMe, want)
+	}
+
+	h.Receive(group, sender, mentioning("@5215587654321 thanks", "5215587654321@s.whatsapp.net"))
+	if msg := h.ExpectMessage(); msg.MentionsMe || len(msg.Mentions) != 1 {
+		t.Errorf("mentions = %v (me: %v), want only the contact", msg.Mentions, msg.MentionsMe)
+	}
+}
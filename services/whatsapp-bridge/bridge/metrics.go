@@ -0,0 +1,173 @@
+package bridge
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// GET /metrics reports the depth of every internal buffer in the
+// OpenMetrics text format, so capacity alerts can be defined per buffer:
+//
+//	whatsapp_bridge_buffer_depth      - items waiting now
+//	whatsapp_bridge_buffer_capacity   - the most it holds, for bounded buffers
+//	whatsapp_bridge_buffer_high_water - the deepest it was since the bridge started
+//
+// The buffer label is one of sink_queue (per sink, also labelled with the
+// sink's name), send_slots (sends waiting for a slot), resend (sends
+// waiting for the connection to come back), webhook_failures,
+// outgoing_dead_letter, outgoing_pending (stream entries delivered but not
+// yet acknowledged), media_downloads (files waiting or downloading),
+// media_download_slots, campaigns, debounce, digest, ws_clients,
+// sse_clients and grpc_subscribers. Queues in memory record their high
+// water mark as they fill; those kept in Redis as they are scraped.
+
+// bufferSample is one buffer's state at scrape time.
+type bufferSample struct {
+	buffer   string
+	sink     string
+	depth    int64
+	capacity int64 // 0 when unbounded
+}
+
+func (s bufferSample) key() string { return s.buffer + "/" + s.sink }
+
+// highWater keeps the deepest depth seen per buffer.
+type highWater struct {
+	mu    sync.Mutex
+	marks map[string]int64
+}
+
+// bufferMarks holds the high water marks of every buffer.
+var bufferMarks = &highWater{marks: make(map[string]int64)}
+
+// observe records depth for buffer (and sink, for sink queues).
+func (h *highWater) observe(buffer, sink string, depth int64) {
+	key := bufferSample{buffer: buffer, sink: sink}.key()
+	h.mu.Lock()
+	if depth > h.marks[key] {
+		h.marks[key] = depth
+	}
+	h.mu.Unlock()
+}
+
+func (h *highWater) get(key string) int64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.marks[key]
+}
+
+// bufferSamples measures every buffer.
+func (b *WhatsAppBridge) bufferSamples(r *http.Request) []bufferSample {
+	ctx := r.Context()
+	var samples []bufferSample
+	add := func(s bufferSample) {
+		bufferMarks.observe(s.buffer, s.sink, s.depth)
+		samples = append(samples, s)
+	}
+	// Redis-backed queues are skipped when Redis does not answer rather
+	// than reported empty.
+	redisLen := func(buffer string, n int64, err error) {
+		if err == nil {
+			add(bufferSample{buffer: buffer, depth: n})
+		}
+	}
+
+	if b.sinks != nil {
+		for _, runner := range b.sinks.runners {
+			add(bufferSample{buffer: "sink_queue", sink: runner.cfg.Name,
+				depth: int64(len(runner.queue)), capacity: int64(cap(runner.queue))})
+		}
+	}
+	if b.sendSlots != nil {
+		add(bufferSample{buffer: "send_slots", depth: int64(b.sendSlots.waitingCount())})
+	}
+	n, err := b.redisClient.HLen(ctx, resendKey).Result()
+	redisLen("resend", n, err)
+	if q := b.sinks.failuresQueue(); q != nil {
+		n, err := b.redisClient.XLen(ctx, q.stream).Result()
+		redisLen("webhook_failures", n, err)
+	}
+	if cfg := outgoingStreamConfigFromEnv(); cfg != nil {
+		n, err := b.redisClient.XLen(ctx, cfg.DeadLetterStream).Result()
+		redisLen("outgoing_dead_letter", n, err)
+		if pending, err := b.redisClient.XPending(ctx, cfg.Stream, cfg.Group).Result(); err == nil {
+			add(bufferSample{buffer: "outgoing_pending", depth: pending.Count})
+		}
+	}
+	if d := b.downloader; d != nil {
+		n, err := b.redisClient.HLen(ctx, mediaJobsKey).Result()
+		redisLen("media_downloads", n, err)
+		add(bufferSample{buffer: "media_download_slots", depth: int64(len(d.slots)), capacity: int64(cap(d.slots))})
+	}
+	if c := b.campaigns; c != nil {
+		add(bufferSample{buffer: "campaigns", depth: int64(len(c.queue)), capacity: int64(cap(c.queue))})
+	}
+	if d := b.debouncer; d != nil {
+		add(bufferSample{buffer: "debounce", depth: int64(d.held())})
+	}
+	if d := b.digester; d != nil {
+		add(bufferSample{buffer: "digest", depth: int64(d.held())})
+	}
+
+	b.wsMu.Lock()
+	ws := len(b.wsClients)
+	b.wsMu.Unlock()
+	add(bufferSample{buffer: "ws_clients", depth: int64(ws)})
+	if b.sse != nil {
+		b.sse.mu.Lock()
+		n := len(b.sse.clients)
+		b.sse.mu.Unlock()
+		add(bufferSample{buffer: "sse_clients", depth: int64(n)})
+	}
+	if b.grpc != nil {
+		b.grpc.mu.Lock()
+		n := len(b.grpc.subscribers)
+		b.grpc.mu.Unlock()
+		add(bufferSample{buffer: "grpc_subscribers", depth: int64(n)})
+	}
+	return samples
+}
+
+// handleMetrics serves GET /metrics.
+func (b *WhatsAppBridge) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	samples := b.bufferSamples(r)
+	sort.SliceStable(samples, func(i, j int) bool { return samples[i].key() < samples[j].key() })
+
+	var out strings.Builder
+	family := func(name, help string, value func(bufferSample) (int64, bool)) {
+		fmt.Fprintf(&out, "# TYPE %s gauge\n# HELP %s %s\n", name, name, help)
+		for _, s := range samples {
+			if v, ok := value(s); ok {
+				fmt.Fprintf(&out, "%s{%s} %d\n", name, s.labels(), v)
+			}
+		}
+	}
+	family("whatsapp_bridge_buffer_depth", "Items waiting in an internal buffer.",
+		func(s bufferSample) (int64, bool) { return s.depth, true })
+	family("whatsapp_bridge_buffer_capacity", "Most items a bounded internal buffer holds.",
+		func(s bufferSample) (int64, bool) { return s.capacity, s.capacity > 0 })
+	family("whatsapp_bridge_buffer_high_water", "Deepest an internal buffer was since the bridge started.",
+		func(s bufferSample) (int64, bool) { return bufferMarks.get(s.key()), true })
+	out.WriteString("# EOF\n")
+
+	if strings.Contains(r.Header.Get("Accept"), "application/openmetrics-text") {
+		w.Header().Set("Content-Type", "application/openmetrics-text; version=1.0.0; charset=utf-8")
+	} else {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	}
+	w.Write([]byte(out.String()))
+}
+
+func (s bufferSample) labels() string {
+	labels := `buffer="` + labelEscaper.Replace(s.buffer) + `"`
+	if s.sink != "" {
+		labels += `,sink="` + labelEscaper.Replace(s.sink) + `"`
+	}
+	return labels
+}
+
+// labelEscaper escapes label values as the text format requires.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
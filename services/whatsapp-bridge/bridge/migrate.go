@@ -0,0 +1,236 @@
+package bridge
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"log"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// migrationFiles holds the archive schema as numbered migrations,
+// "NNNN_name.sql", applied in order. Released migrations must never be
+// edited; change the schema by adding a new file.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// Migration is one schema change of the archive database.
+type Migration struct {
+	Version   int    `json:"version"`
+	Name      string `json:"name"`
+	AppliedAt int64  `json:"applied_at,omitempty"` // 0 while pending
+	sql       string
+}
+
+const migrationsTable = `
+CREATE TABLE IF NOT EXISTS schema_migrations (
+	version    INTEGER PRIMARY KEY,
+	name       TEXT NOT NULL,
+	applied_at INTEGER NOT NULL
+);
+`
+
+// loadMigrations returns the embedded migrations sorted by version.
+func loadMigrations() ([]Migration, error) {
+	entries, err := migrationFiles.ReadDir("migrations")
+	if err != nil {
+		return nil, err
+	}
+	var migrations []Migration
+	for _, entry := range entries {
+		prefix, name, ok := strings.Cut(strings.TrimSuffix(entry.Name(), ".sql"), "_")
+		version, err := strconv.Atoi(prefix)
+		if !ok || err != nil || version <= 0 {
+			return nil, fmt.Errorf("migration %s is not named NNNN_name.sql", entry.Name())
+		}
+		data, err := migrationFiles.ReadFile(path.Join("migrations", entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, Migration{Version: version, Name: name, sql: string(data)})
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	for i := 1; i < len(migrations); i++ {
+		if migrations[i].Version == migrations[i-1].Version {
+			return nil, fmt.Errorf("duplicate migration version %d", migrations[i].Version)
+		}
+	}
+	return migrations, nil
+}
+
+// migrationState lists every known migration with its applied time, after
+// adopting databases created before migrations were tracked.
+func migrationState(db *sql.DB) ([]Migration, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(migrationsTable); err != nil {
+		return nil, fmt.Errorf("failed to create schema_migrations: %v", err)
+	}
+	if err := adoptLegacySchema(db, migrations); err != nil {
+		return nil, err
+	}
+
+	applied := make(map[int]int64)
+	rows, err := db.Query(`SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var version int
+		var at int64
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		applied[version] = at
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	latest := migrations[len(migrations)-1].Version
+	for version := range applied {
+		if version > latest {
+			return nil, fmt.Errorf("archive schema is at version %d, newer than this release knows (%d); upgrade the bridge", version, latest)
+		}
+	}
+	for i := range migrations {
+		migrations[i].AppliedAt = applied[migrations[i].Version]
+	}
+	return migrations, nil
+}
+
+// adoptLegacySchema records the migrations already reflected in a database
+// created by a release that set up its tables directly, so they are not
+// re-run: 0001 when the messages table exists, 0002 when it has contact_id.
+// Later migrations postdate tracking and simply run.
+func adoptLegacySchema(db *sql.DB, migrations []Migration) error {
+	var tracked int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM schema_migrations`).Scan(&tracked); err != nil || tracked > 0 {
+		return err
+	}
+	columns, err := tableColumns(db, "messages")
+	if err != nil || len(columns) == 0 {
+		return err
+	}
+	baseline := 1
+	if columns["contact_id"] {
+		baseline = 2
+	}
+	now := time.Now().Unix()
+	for _, m := range migrations {
+		if m.Version > baseline {
+			break
+		}
+		if _, err := db.Exec(`INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)`,
+			m.Version, m.Name, now); err != nil {
+			return err
+		}
+	}
+	log.Printf("🗃️ Adopted existing archive schema at version %d", baseline)
+	return nil
+}
+
+func tableColumns(db *sql.DB, table string) (map[string]bool, error) {
+	rows, err := db.Query("PRAGMA table_info(" + table + ")")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	columns := make(map[string]bool)
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, ctype string
+		var dflt sql.NullString
+		if err := rows.Scan(&cid, &name, &ctype, &notNull, &dflt, &pk); err != nil {
+			return nil, err
+		}
+		columns[name] = true
+	}
+	return columns, rows.Err()
+}
+
+// migrate applies pending migrations up to target (0 for all), each in its
+// own transaction, and returns those it applied.
+func migrate(db *sql.DB, target int) ([]Migration, error) {
+	migrations, err := migrationState(db)
+	if err != nil {
+		return nil, err
+	}
+	var applied []Migration
+	for _, m := range migrations {
+		if m.AppliedAt != 0 {
+			continue
+		}
+		if target > 0 && m.Version > target {
+			break
+		}
+		if err := applyMigration(db, &m); err != nil {
+			return applied, err
+		}
+		log.Printf("🗃️ Applied archive migration %04d_%s", m.Version, m.Name)
+		applied = append(applied, m)
+	}
+	return applied, nil
+}
+
+func applyMigration(db *sql.DB, m *Migration) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(m.sql); err != nil {
+		return fmt.Errorf("migration %04d_%s failed: %v", m.Version, m.Name, err)
+	}
+	m.AppliedAt = time.Now().Unix()
+	if _, err := tx.Exec(`INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)`,
+		m.Version, m.Name, m.AppliedAt); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// pendingMigrations returns the migrations not yet applied.
+func pendingMigrations(db *sql.DB) ([]Migration, error) {
+	migrations, err := migrationState(db)
+	if err != nil {
+		return nil, err
+	}
+	var pending []Migration
+	for _, m := range migrations {
+		if m.AppliedAt == 0 {
+			pending = append(pending, m)
+		}
+	}
+	return pending, nil
+}
+
+// ArchiveMigrations reports every archive migration and whether it has been
+// applied, for "whatsapp-bridge migrate status".
+func ArchiveMigrations() ([]Migration, error) {
+	db, err := openArchiveDB(archiveDSN())
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	return migrationState(db)
+}
+
+// MigrateArchive applies pending archive migrations up to target (0 for
+// all), for "whatsapp-bridge migrate".
+func MigrateArchive(target int) ([]Migration, error) {
+	db, err := openArchiveDB(archiveDSN())
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	return migrate(db, target)
+}
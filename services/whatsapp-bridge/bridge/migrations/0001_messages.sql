@@ -0,0 +1,16 @@
+-- Every inbound and outbound message.
+CREATE TABLE IF NOT EXISTS messages (
+	id           INTEGER PRIMARY KEY AUTOINCREMENT,
+	message_id   TEXT NOT NULL,
+	direction    TEXT NOT NULL,
+	chat         TEXT NOT NULL,
+	sender       TEXT NOT NULL,
+	type         TEXT NOT NULL,
+	content      TEXT NOT NULL DEFAULT '',
+	content_hash TEXT NOT NULL DEFAULT '',
+	operator     TEXT NOT NULL DEFAULT '',
+	timestamp    INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_messages_chat_ts ON messages (chat, timestamp);
+CREATE INDEX IF NOT EXISTS idx_messages_message_id ON messages (message_id);
+CREATE INDEX IF NOT EXISTS idx_messages_operator ON messages (operator);
@@ -0,0 +1,2 @@
+-- Stable contact ID of the remote party, see 0003_identity.sql.
+ALTER TABLE messages ADD COLUMN contact_id TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,20 @@
+-- WhatsApp addresses a person by phone-number JID (@s.whatsapp.net) and by a
+-- privacy-preserving LID (@lid). A LID survives number changes, so every JID
+-- seen together with the same LID resolves to a single stable contact ID.
+CREATE TABLE IF NOT EXISTS contacts (
+	id         TEXT PRIMARY KEY,
+	created_at INTEGER NOT NULL
+);
+CREATE TABLE IF NOT EXISTS contact_identities (
+	jid        TEXT PRIMARY KEY,
+	contact_id TEXT NOT NULL REFERENCES contacts (id),
+	kind       TEXT NOT NULL,
+	first_seen INTEGER NOT NULL,
+	last_seen  INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_contact_identities_contact ON contact_identities (contact_id);
+CREATE TABLE IF NOT EXISTS contact_merges (
+	survivor_id TEXT NOT NULL,
+	merged_id   TEXT NOT NULL,
+	merged_at   INTEGER NOT NULL
+);
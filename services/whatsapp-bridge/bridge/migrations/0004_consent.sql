@@ -0,0 +1,23 @@
+-- Consent is stored per contact, so it follows the person across phone
+-- number and LID; every change is also appended to an audit log.
+CREATE TABLE IF NOT EXISTS contact_consent (
+	contact_id  TEXT PRIMARY KEY,
+	status      TEXT NOT NULL,
+	source      TEXT NOT NULL,
+	keyword     TEXT NOT NULL DEFAULT '',
+	evidence    TEXT NOT NULL DEFAULT '',
+	obtained_at INTEGER NOT NULL,
+	updated_at  INTEGER NOT NULL,
+	updated_by  TEXT NOT NULL DEFAULT ''
+);
+CREATE TABLE IF NOT EXISTS contact_consent_log (
+	contact_id  TEXT NOT NULL,
+	status      TEXT NOT NULL,
+	source      TEXT NOT NULL,
+	keyword     TEXT NOT NULL DEFAULT '',
+	evidence    TEXT NOT NULL DEFAULT '',
+	obtained_at INTEGER NOT NULL,
+	updated_by  TEXT NOT NULL DEFAULT '',
+	logged_at   INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_contact_consent_log_contact ON contact_consent_log (contact_id, logged_at);
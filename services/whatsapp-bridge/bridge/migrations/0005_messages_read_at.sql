@@ -0,0 +1,2 @@
+-- When the recipient read an outbound message, from read receipts; 0 until then.
+ALTER TABLE messages ADD COLUMN read_at INTEGER NOT NULL DEFAULT 0;
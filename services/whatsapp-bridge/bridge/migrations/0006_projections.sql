@@ -0,0 +1,69 @@
+-- Read models for dashboards, kept up to date as messages are archived so
+-- they never scan the messages table. Existing messages are backfilled.
+CREATE TABLE IF NOT EXISTS chat_summaries (
+	chat              TEXT PRIMARY KEY,
+	contact_id        TEXT NOT NULL DEFAULT '',
+	message_count     INTEGER NOT NULL DEFAULT 0,
+	inbound_count     INTEGER NOT NULL DEFAULT 0,
+	outbound_count    INTEGER NOT NULL DEFAULT 0,
+	first_message_at  INTEGER NOT NULL DEFAULT 0,
+	last_message_at   INTEGER NOT NULL DEFAULT 0,
+	last_inbound_at   INTEGER NOT NULL DEFAULT 0,
+	last_outbound_at  INTEGER NOT NULL DEFAULT 0,
+	last_read_at      INTEGER NOT NULL DEFAULT 0,
+	last_message_id   TEXT NOT NULL DEFAULT '',
+	last_direction    TEXT NOT NULL DEFAULT '',
+	last_type         TEXT NOT NULL DEFAULT '',
+	last_preview      TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS idx_chat_summaries_last ON chat_summaries (last_message_at);
+
+-- Message counts per UTC day and direction.
+CREATE TABLE IF NOT EXISTS daily_message_counts (
+	day       TEXT NOT NULL,
+	direction TEXT NOT NULL,
+	count     INTEGER NOT NULL DEFAULT 0,
+	PRIMARY KEY (day, direction)
+);
+
+CREATE TABLE IF NOT EXISTS contact_activity (
+	contact_id       TEXT PRIMARY KEY,
+	last_chat        TEXT NOT NULL DEFAULT '',
+	message_count    INTEGER NOT NULL DEFAULT 0,
+	last_inbound_at  INTEGER NOT NULL DEFAULT 0,
+	last_outbound_at INTEGER NOT NULL DEFAULT 0,
+	last_activity_at INTEGER NOT NULL DEFAULT 0
+);
+CREATE INDEX IF NOT EXISTS idx_contact_activity_last ON contact_activity (last_activity_at);
+
+INSERT OR REPLACE INTO chat_summaries
+	(chat, message_count, inbound_count, outbound_count, first_message_at, last_message_at,
+	 last_inbound_at, last_outbound_at, last_read_at)
+SELECT chat, COUNT(*),
+	SUM(direction = 'in'), SUM(direction = 'out'),
+	MIN(timestamp), MAX(timestamp),
+	MAX(CASE WHEN direction = 'in' THEN timestamp ELSE 0 END),
+	MAX(CASE WHEN direction = 'out' THEN timestamp ELSE 0 END),
+	MAX(read_at)
+FROM messages GROUP BY chat;
+
+UPDATE chat_summaries SET (contact_id, last_message_id, last_direction, last_type, last_preview) = (
+	SELECT contact_id, message_id, direction, type, substr(content, 1, 200) FROM messages m
+	WHERE m.chat = chat_summaries.chat ORDER BY timestamp DESC, id DESC LIMIT 1
+);
+
+INSERT OR REPLACE INTO daily_message_counts (day, direction, count)
+SELECT date(timestamp, 'unixepoch'), direction, COUNT(*) FROM messages GROUP BY 1, 2;
+
+INSERT OR REPLACE INTO contact_activity
+	(contact_id, message_count, last_inbound_at, last_outbound_at, last_activity_at)
+SELECT contact_id, COUNT(*),
+	MAX(CASE WHEN direction = 'in' THEN timestamp ELSE 0 END),
+	MAX(CASE WHEN direction = 'out' THEN timestamp ELSE 0 END),
+	MAX(timestamp)
+FROM messages WHERE contact_id != '' GROUP BY contact_id;
+
+UPDATE contact_activity SET last_chat = (
+	SELECT chat FROM messages m WHERE m.contact_id = contact_activity.contact_id
+	ORDER BY timestamp DESC, id DESC LIMIT 1
+);
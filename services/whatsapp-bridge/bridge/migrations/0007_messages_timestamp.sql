@@ -0,0 +1,2 @@
+-- Lets the retention janitor find expired messages without a full scan.
+CREATE INDEX IF NOT EXISTS idx_messages_ts ON messages (timestamp);
@@ -0,0 +1,11 @@
+-- The current reaction of each reactor to a message; a removed reaction
+-- deletes its row.
+CREATE TABLE IF NOT EXISTS message_reactions (
+	message_id TEXT NOT NULL,
+	chat       TEXT NOT NULL,
+	reactor    TEXT NOT NULL,
+	contact_id TEXT NOT NULL DEFAULT '',
+	emoji      TEXT NOT NULL,
+	timestamp  INTEGER NOT NULL,
+	PRIMARY KEY (message_id, reactor)
+);
@@ -0,0 +1,3 @@
+-- The template and A/B variant an outbound message was rendered from; empty otherwise.
+ALTER TABLE messages ADD COLUMN template TEXT NOT NULL DEFAULT '';
+ALTER TABLE messages ADD COLUMN variant TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,2 @@
+-- The API request (X-Request-ID) that sent an outbound message; empty otherwise.
+ALTER TABLE messages ADD COLUMN request_id TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,2 @@
+-- Lets feedback detection find a chat's latest messages without a scan.
+CREATE INDEX IF NOT EXISTS idx_messages_chat_id ON messages (chat, id);
@@ -0,0 +1,262 @@
+package bridge
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// MQTT transport, for edge deployments whose devices and agents already
+// speak MQTT: an "mqtt" sink publishes events under a topic prefix, and the
+// outbound subscriber sends the messages published to a topic.
+//
+//	MQTT_URL                     - broker URL (default tcp://localhost:1883; ssl:// and ws:// also work)
+//	MQTT_CLIENT_ID               - client ID prefix; sinks and the subscriber add a suffix (default whatsapp-bridge)
+//	MQTT_USERNAME, MQTT_PASSWORD - broker credentials
+//	MQTT_QOS                     - QoS of published and subscribed messages (default 1)
+//	MQTT_INBOUND_TOPIC           - topic prefix; events go to <prefix>/<type> (default whatsapp/inbound)
+//	MQTT_OUTBOUND_TOPIC          - topic (filter) of messages to send; unset disables the subscriber
+//	MQTT_OUTBOUND_RESULTS_TOPIC  - where send results go (default <outbound topic>/results, wildcards dropped)
+//	MQTT_OUTBOUND_MAX_ATTEMPTS   - send attempts before a message is given up (default 5)
+
+func mqttURL() string {
+	return envString("MQTT_URL", "tcp://localhost:1883")
+}
+
+func mqttQoS() byte {
+	qos := envInt("MQTT_QOS", 1)
+	if qos < 0 || qos > 2 {
+		qos = 1
+	}
+	return byte(qos)
+}
+
+// mqttOptions configures a client that connects and reconnects in the
+// background, so a broker outage at startup or later does not stop the
+// bridge. onConnect runs after every (re)connection.
+func mqttOptions(url, clientID string, onConnect mqtt.OnConnectHandler) *mqtt.ClientOptions {
+	return mqtt.NewClientOptions().
+		AddBroker(url).
+		SetClientID(clientID).
+		SetUsername(envString("MQTT_USERNAME", "")).
+		SetPassword(envString("MQTT_PASSWORD", "")).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetConnectRetryInterval(5 * time.Second).
+		SetMaxReconnectInterval(time.Minute).
+		SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+			log.Printf("⚠️ MQTT connection %s lost: %v", clientID, err)
+		}).
+		SetOnConnectHandler(func(c mqtt.Client) {
+			log.Printf("✅ MQTT %s connected to %s", clientID, url)
+			if onConnect != nil {
+				onConnect(c)
+			}
+		})
+}
+
+// mqttConnect starts connecting a client in the background.
+func mqttConnect(opts *mqtt.ClientOptions) mqtt.Client {
+	client := mqtt.NewClient(opts)
+	client.Connect()
+	return client
+}
+
+// mqttWait waits for a token, giving up when ctx is done.
+func mqttWait(ctx context.Context, token mqtt.Token) error {
+	select {
+	case <-token.Done():
+		return token.Error()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// mqttSink publishes events to <prefix>/<event type>, or to the per-type
+// override or routed channel when there is one. MQTT 3.1.1 has no headers,
+// so consumers that need the chat read it from the payload.
+type mqttSink struct {
+	name   string
+	client mqtt.Client
+	qos    byte
+	prefix string
+	topics map[string]string
+}
+
+func (b *WhatsAppBridge) newMQTTSink(cfg SinkConfig) *mqttSink {
+	url, prefix := cfg.URL, cfg.Topic
+	if url == "" {
+		url = mqttURL()
+	}
+	if prefix == "" {
+		prefix = envString("MQTT_INBOUND_TOPIC", "whatsapp/inbound")
+	}
+	clientID := envString("MQTT_CLIENT_ID", "whatsapp-bridge") + "-" + cfg.Name
+	return &mqttSink{
+		name:   cfg.Name,
+		client: mqttConnect(mqttOptions(url, clientID, nil)),
+		qos:    mqttQoS(),
+		prefix: strings.TrimSuffix(prefix, "/"),
+		topics: cfg.Channels,
+	}
+}
+
+func (s *mqttSink) Name() string { return s.name }
+
+func (s *mqttSink) Deliver(ctx context.Context, evt BridgeEvent) error {
+	data, err := evt.MarshalPayload()
+	if err != nil {
+		return err
+	}
+	topic := s.prefix + "/" + evt.Type
+	if evt.Channel != "" {
+		topic = evt.Channel
+	} else if override, ok := s.topics[evt.Type]; ok {
+		topic = override
+	}
+	if !s.client.IsConnectionOpen() {
+		return fmt.Errorf("not connected to MQTT broker")
+	}
+	return mqttWait(ctx, s.client.Publish(mqttTopic(topic), s.qos, false, data))
+}
+
+// mqttTopic replaces the wildcard characters MQTT does not allow in
+// published topic names.
+func mqttTopic(topic string) string {
+	return strings.NewReplacer("+", "_", "#", "_").Replace(topic)
+}
+
+// MQTTOutboundConfig configures the subscriber of outbound messages.
+type MQTTOutboundConfig struct {
+	URL          string
+	ClientID     string
+	Topic        string
+	ResultsTopic string
+	QoS          byte
+	MaxAttempts  int
+}
+
+// mqttOutboundConfigFromEnv returns nil unless MQTT_OUTBOUND_TOPIC is set.
+func mqttOutboundConfigFromEnv() *MQTTOutboundConfig {
+	topic := envString("MQTT_OUTBOUND_TOPIC", "")
+	if topic == "" {
+		return nil
+	}
+	results := strings.TrimSuffix(strings.TrimSuffix(strings.TrimSuffix(topic, "#"), "+"), "/")
+	return &MQTTOutboundConfig{
+		URL:          mqttURL(),
+		ClientID:     envString("MQTT_CLIENT_ID", "whatsapp-bridge") + "-outbound",
+		Topic:        topic,
+		ResultsTopic: envString("MQTT_OUTBOUND_RESULTS_TOPIC", mqttTopic(results+"/results")),
+		QoS:          mqttQoS(),
+		MaxAttempts:  envInt("MQTT_OUTBOUND_MAX_ATTEMPTS", 5),
+	}
+}
+
+// subscribeMQTTOutbound sends the messages published to the outbound topic
+// until the bridge context is cancelled.
+//
+// Messages are OutgoingMessage JSON (same shape as /send). The subscriber
+// keeps a persistent session, so with QoS 1 or 2 the broker holds messages
+// while the bridge is offline, and acknowledges each one only after it was
+// sent or given up; client_message_id is the idempotency key, so a message
+// redelivered after a crash is sent once. Messages are sent in order, and
+// transient failures are retried in place up to MaxAttempts. Each message
+// gets an OutgoingResult on the results topic.
+func (b *WhatsAppBridge) subscribeMQTTOutbound(cfg *MQTTOutboundConfig) {
+	// The client's handler only queues; sending happens here so a slow
+	// send never blocks the connection's keepalives.
+	queue := make(chan mqtt.Message, 100)
+	subscribe := func(c mqtt.Client) {
+		token := c.Subscribe(cfg.Topic, cfg.QoS, func(_ mqtt.Client, m mqtt.Message) {
+			if m.Topic() == cfg.ResultsTopic {
+				m.Ack() // our own results, when the filter matches them
+				return
+			}
+			select {
+			case queue <- m:
+			case <-b.intake.Done():
+			}
+		})
+		if err := mqttWait(b.ctx, token); err != nil {
+			log.Printf("Error subscribing to MQTT topic %s: %v", cfg.Topic, err)
+		}
+	}
+
+	opts := mqttOptions(cfg.URL, cfg.ClientID, subscribe).
+		SetCleanSession(false).
+		SetAutoAckDisabled(true)
+	client := mqttConnect(opts)
+	defer client.Disconnect(250)
+	log.Printf("📥 Consuming outgoing messages from MQTT topic %s", cfg.Topic)
+
+	for {
+		select {
+		case <-b.intake.Done():
+			return
+		case m := <-queue:
+			result := b.processMQTTOutbound(cfg, m.Topic(), m.Payload())
+			if b.ctx.Err() != nil {
+				return // shutting down mid-retry; the broker redelivers
+			}
+			data, _ := json.Marshal(result)
+			if err := mqttWait(b.ctx, client.Publish(cfg.ResultsTopic, cfg.QoS, false, data)); err != nil {
+				log.Printf("Error publishing outgoing result to %s: %v", cfg.ResultsTopic, err)
+			}
+			m.Ack()
+		}
+	}
+}
+
+// processMQTTOutbound sends one message, retrying transient failures.
+func (b *WhatsAppBridge) processMQTTOutbound(cfg *MQTTOutboundConfig, topic string, payload []byte) OutgoingResult {
+	var msg OutgoingMessage
+	if err := json.Unmarshal(payload, &msg); err != nil {
+		return OutgoingResult{Status: "failed", Error: fmt.Sprintf("invalid payload: %v", err)}
+	}
+	id := msg.ClientMessageID
+	result := OutgoingResult{ID: id}
+	if err := msg.Validate(); err != nil {
+		result.Status, result.Error = "failed", err.Error()
+		return result
+	}
+
+	operator, scope := "mqtt:"+topic, "mqtt:"+cfg.Topic
+	ctx := withOperator(b.ctx, operator)
+	backoff := time.Second
+	for attempt := 1; ; attempt++ {
+		resp, previous, replayed, err := b.sendIdempotent(ctx, scope, id, msg)
+		switch {
+		case replayed:
+			result.Status = "duplicate"
+			result.MessageID, _ = previous["message_id"].(string)
+			return result
+		case errors.Is(err, errIdempotencyMismatch):
+			result.Status, result.Error = "failed", err.Error()
+			return result
+		case errors.Is(err, errPermanent):
+			log.Printf("Outgoing MQTT message %s failed permanently: %v", id, err)
+			result.Status, result.MessageID, result.Error = "failed", resp.ID, err.Error()
+			return result
+		case err == nil:
+			result.Status, result.MessageID = resp.status(), resp.ID
+			return result
+		}
+		if attempt >= cfg.MaxAttempts {
+			log.Printf("☠️ Outgoing MQTT message %s failed %d times, giving up: %v", id, attempt, err)
+			result.Status, result.Error = "dead_letter", err.Error()
+			return result
+		}
+		log.Printf("Outgoing MQTT message %s failed (attempt %d/%d), will retry: %v", id, attempt, cfg.MaxAttempts, err)
+		if sleepContext(b.ctx, backoff) != nil {
+			return result
+		}
+		backoff = min(backoff*2, time.Minute)
+	}
+}
@@ -0,0 +1,301 @@
+package bridge
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// NATS JetStream transport, for deployments that already run NATS: a
+// "nats" sink publishes events to JetStream subjects, and the outgoing
+// consumer sends messages published to a subject through a durable
+// consumer, so agents need neither Redis nor the HTTP API.
+//
+//	NATS_URL                     - server URL(s), comma-separated (default nats://127.0.0.1:4222)
+//	NATS_EVENTS_STREAM           - stream holding events (default WHATSAPP_EVENTS)
+//	NATS_EVENTS_SUBJECT          - subject prefix; events go to <prefix>.<type> (default whatsapp.events)
+//	NATS_OUTGOING_SUBJECT        - subject of outbound messages; unset disables the consumer
+//	NATS_OUTGOING_STREAM         - stream holding them (default WHATSAPP_OUTGOING)
+//	NATS_OUTGOING_DURABLE        - durable consumer name shared by replicas (default whatsapp-bridge)
+//	NATS_OUTGOING_RESULTS_SUBJECT - where send results go (default <subject>.results)
+//	NATS_OUTGOING_MAX_DELIVERIES - deliveries before a message is given up (default 5)
+//	NATS_OUTGOING_ACK_WAIT       - redelivery timeout of unacked messages (default 60s)
+
+// natsConnect opens a connection that keeps reconnecting in the background,
+// so a NATS outage at startup or later does not stop the bridge.
+func natsConnect(url string) (*nats.Conn, error) {
+	if url == "" {
+		url = envString("NATS_URL", nats.DefaultURL)
+	}
+	return nats.Connect(url,
+		nats.Name("whatsapp-bridge"),
+		nats.RetryOnFailedConnect(true),
+		nats.MaxReconnects(-1),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			if err != nil {
+				log.Printf("⚠️ NATS disconnected: %v", err)
+			}
+		}),
+		nats.ReconnectHandler(func(nc *nats.Conn) {
+			log.Printf("✅ NATS reconnected to %s", nc.ConnectedUrl())
+		}),
+	)
+}
+
+// natsSink publishes events to <subject>.<event type> with Event-Type, Chat
+// and Route headers. Routed events and channel overrides go to
+// <subject>.<channel> instead, so the stream captures them too. The stream
+// is created on first delivery, so the sink starts even while NATS is
+// unreachable.
+type natsSink struct {
+	name     string
+	js       jetstream.JetStream
+	stream   string
+	subject  string
+	subjects map[string]string
+
+	mu    sync.Mutex
+	ready bool
+}
+
+func (b *WhatsAppBridge) newNATSSink(cfg SinkConfig) (*natsSink, error) {
+	nc, err := natsConnect(cfg.URL)
+	if err != nil {
+		return nil, err
+	}
+	js, err := jetstream.New(nc)
+	if err != nil {
+		return nil, err
+	}
+	stream, subject := cfg.Stream, cfg.Subject
+	if stream == "" {
+		stream = envString("NATS_EVENTS_STREAM", "WHATSAPP_EVENTS")
+	}
+	if subject == "" {
+		subject = envString("NATS_EVENTS_SUBJECT", "whatsapp.events")
+	}
+	return &natsSink{name: cfg.Name, js: js, stream: stream, subject: subject, subjects: cfg.Channels}, nil
+}
+
+func (s *natsSink) Name() string { return s.name }
+
+func (s *natsSink) Deliver(ctx context.Context, evt BridgeEvent) error {
+	if err := s.ensureStream(ctx); err != nil {
+		return err
+	}
+	data, err := evt.MarshalPayload()
+	if err != nil {
+		return err
+	}
+	token := evt.Type
+	if evt.Channel != "" {
+		token = evt.Channel
+	} else if override, ok := s.subjects[evt.Type]; ok {
+		token = override
+	}
+	msg := nats.NewMsg(s.subject + "." + natsSubjectToken(token))
+	msg.Data = data
+	msg.Header.Set("Event-Type", evt.Type)
+	if evt.Chat != "" {
+		msg.Header.Set("Chat", evt.Chat)
+		msg.Header.Set("Shard-Key", evt.ShardKey)
+	}
+	if evt.Route != "" {
+		msg.Header.Set("Route", evt.Route)
+	}
+	_, err = s.js.PublishMsg(ctx, msg)
+	return err
+}
+
+func (s *natsSink) ensureStream(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ready {
+		return nil
+	}
+	_, err := s.js.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
+		Name:     s.stream,
+		Subjects: []string{s.subject + ".>"},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set up stream %s: %v", s.stream, err)
+	}
+	s.ready = true
+	return nil
+}
+
+// NATSOutgoingConfig configures the JetStream consumer for outbound messages.
+type NATSOutgoingConfig struct {
+	URL            string
+	Subject        string
+	Stream         string
+	Durable        string
+	ResultsSubject string
+	MaxDeliveries  int
+	AckWait        time.Duration
+}
+
+// natsOutgoingConfigFromEnv returns nil unless NATS_OUTGOING_SUBJECT is set.
+func natsOutgoingConfigFromEnv() *NATSOutgoingConfig {
+	subject := envString("NATS_OUTGOING_SUBJECT", "")
+	if subject == "" {
+		return nil
+	}
+	return &NATSOutgoingConfig{
+		URL:            envString("NATS_URL", nats.DefaultURL),
+		Subject:        subject,
+		Stream:         envString("NATS_OUTGOING_STREAM", "WHATSAPP_OUTGOING"),
+		Durable:        envString("NATS_OUTGOING_DURABLE", "whatsapp-bridge"),
+		ResultsSubject: envString("NATS_OUTGOING_RESULTS_SUBJECT", subject+".results"),
+		MaxDeliveries:  envInt("NATS_OUTGOING_MAX_DELIVERIES", 5),
+		AckWait:        envDuration("NATS_OUTGOING_ACK_WAIT", 60*time.Second),
+	}
+}
+
+// consumeNATSOutgoing sends the messages published to the outgoing subject
+// until the bridge context is cancelled. Messages are OutgoingMessage JSON
+// (same shape as /send); a Nats-Msg-Id header or client_message_id makes
+// redeliveries and republishes send only once. Every message gets an
+// OutgoingResult on the results subject, which the stream does not capture.
+func (b *WhatsAppBridge) consumeNATSOutgoing(cfg *NATSOutgoingConfig) {
+	nc, err := natsConnect(cfg.URL)
+	if err != nil {
+		log.Printf("❌ Failed to connect to NATS: %v", err)
+		return
+	}
+	defer nc.Drain()
+	js, err := jetstream.New(nc)
+	if err != nil {
+		log.Printf("❌ Failed to open JetStream: %v", err)
+		return
+	}
+
+	// Retry setup until NATS is reachable.
+	var consumer jetstream.Consumer
+	for b.intake.Err() == nil {
+		consumer, err = b.setupNATSConsumer(js, cfg)
+		if err == nil {
+			break
+		}
+		log.Printf("Error setting up NATS consumer %s: %v", cfg.Durable, err)
+		if sleepContext(b.intake, 5*time.Second) != nil {
+			return
+		}
+	}
+	if consumer == nil {
+		return
+	}
+
+	consumeCtx, err := consumer.Consume(func(msg jetstream.Msg) {
+		result := b.processNATSOutgoing(cfg, msg)
+		if result.Status == "" {
+			return // left for redelivery
+		}
+		data, _ := json.Marshal(result)
+		if err := nc.Publish(cfg.ResultsSubject, data); err != nil {
+			log.Printf("Error publishing outgoing result to %s: %v", cfg.ResultsSubject, err)
+		}
+	})
+	if err != nil {
+		log.Printf("❌ Failed to consume %s: %v", cfg.Subject, err)
+		return
+	}
+	log.Printf("📥 Consuming outgoing messages from NATS subject %s (stream %s, durable %s)",
+		cfg.Subject, cfg.Stream, cfg.Durable)
+	<-b.intake.Done()
+	consumeCtx.Stop()
+}
+
+func (b *WhatsAppBridge) setupNATSConsumer(js jetstream.JetStream, cfg *NATSOutgoingConfig) (jetstream.Consumer, error) {
+	ctx, cancel := context.WithTimeout(b.ctx, 10*time.Second)
+	defer cancel()
+	if _, err := js.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
+		Name:     cfg.Stream,
+		Subjects: []string{cfg.Subject},
+	}); err != nil {
+		return nil, err
+	}
+	return js.CreateOrUpdateConsumer(ctx, cfg.Stream, jetstream.ConsumerConfig{
+		Durable:       cfg.Durable,
+		FilterSubject: cfg.Subject,
+		AckPolicy:     jetstream.AckExplicitPolicy,
+		AckWait:       cfg.AckWait,
+		MaxDeliver:    cfg.MaxDeliveries,
+	})
+}
+
+// processNATSOutgoing sends one message and acks it, returning its result,
+// or a zero result when the message was left for redelivery.
+func (b *WhatsAppBridge) processNATSOutgoing(cfg *NATSOutgoingConfig, msg jetstream.Msg) OutgoingResult {
+	var out OutgoingMessage
+	if err := json.Unmarshal(msg.Data(), &out); err != nil {
+		msg.Term()
+		return OutgoingResult{Status: "failed", Error: fmt.Sprintf("invalid payload: %v", err)}
+	}
+	id := msg.Headers().Get(nats.MsgIdHdr)
+	if id == "" {
+		id = out.ClientMessageID
+	}
+	result := OutgoingResult{ID: id}
+	if err := out.Validate(); err != nil {
+		msg.Term()
+		result.Status, result.Error = "failed", err.Error()
+		return result
+	}
+
+	deliveries := 1
+	if meta, err := msg.Metadata(); err == nil {
+		deliveries = int(meta.NumDelivered)
+	}
+	retry := func(err error) OutgoingResult {
+		if deliveries >= cfg.MaxDeliveries {
+			log.Printf("☠️ Outgoing NATS message %s failed %d times, giving up: %v", id, deliveries, err)
+			msg.Term()
+			result.Status, result.Error = "dead_letter", err.Error()
+			return result
+		}
+		log.Printf("Outgoing NATS message %s failed (delivery %d/%d), will retry: %v", id, deliveries, cfg.MaxDeliveries, err)
+		msg.NakWithDelay(time.Duration(deliveries) * 5 * time.Second)
+		return OutgoingResult{}
+	}
+
+	operator := "nats:" + cfg.Subject
+	resp, previous, replayed, err := b.sendIdempotent(withOperator(b.ctx, operator), operator, id, out)
+	switch {
+	case replayed:
+		msg.Ack()
+		result.Status = "duplicate"
+		result.MessageID, _ = previous["message_id"].(string)
+		return result
+	case errors.Is(err, errIdempotencyInProgress):
+		msg.NakWithDelay(cfg.AckWait)
+		return OutgoingResult{}
+	case errors.Is(err, errIdempotencyMismatch):
+		msg.Term()
+		result.Status, result.Error = "failed", err.Error()
+		return result
+	case errors.Is(err, errPermanent):
+		log.Printf("Outgoing NATS message %s failed permanently: %v", id, err)
+		msg.Term()
+		result.Status, result.MessageID, result.Error = "failed", resp.ID, err.Error()
+		return result
+	case err != nil:
+		return retry(err)
+	}
+	msg.Ack()
+	result.Status, result.MessageID = resp.status(), resp.ID
+	return result
+}
+
+// natsSubjectToken makes s safe as a single subject token.
+func natsSubjectToken(s string) string {
+	return strings.NewReplacer(".", "_", " ", "_", "*", "_", ">", "_").Replace(s)
+}
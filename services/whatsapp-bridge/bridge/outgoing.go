@@ -0,0 +1,272 @@
+package bridge
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"google.golang.org/protobuf/proto"
+)
+
+// buildOutgoingMessage turns an OutgoingMessage into the WhatsApp protobuf
+// and reports its archive type. Plain text goes out as a Conversation;
+// anything needing ContextInfo (quoted replies, mentions, a disappearing
+// timer) is sent as an ExtendedTextMessage. With MediaURL set the media is
+// uploaded and the text becomes its caption. id is the ID the message will
+// be sent under.
+func (b *WhatsAppBridge) buildOutgoingMessage(ctx context.Context, chat types.JID, id string, msg OutgoingMessage) (*waE2E.Message, string, error) {
+	text, mentioned := extractMentions(renderSuggestions(msg.Message, msg.Suggestions), msg.Mentions)
+
+	contextInfo := b.quoteContext(chat, msg)
+	if len(mentioned) > 0 || msg.EphemeralTTL > 0 {
+		if contextInfo == nil {
+			contextInfo = &waE2E.ContextInfo{}
+		}
+		if len(mentioned) > 0 {
+			contextInfo.MentionedJID = mentioned
+		}
+		if msg.EphemeralTTL > 0 {
+			contextInfo.Expiration = proto.Uint32(uint32(msg.EphemeralTTL))
+		}
+	}
+
+	if msg.MediaURL != "" {
+		// Channel media is uploaded unencrypted through a separate API.
+		if chat.Server == types.NewsletterServer {
+			return nil, "", fmt.Errorf("%w: media is not supported for newsletters", errPermanent)
+		}
+		return b.buildMediaMessage(ctx, chat, id, text, contextInfo, msg)
+	}
+	if contextInfo == nil {
+		return &waE2E.Message{Conversation: proto.String(text)}, "text", nil
+	}
+	return &waE2E.Message{
+		ExtendedTextMessage: &waE2E.ExtendedTextMessage{
+			Text:        proto.String(text),
+			ContextInfo: contextInfo,
+		},
+	}, "text", nil
+}
+
+// buildMediaMessage fetches and uploads msg.MediaURL, choosing the message
+// kind from its MIME type, or from the header of the template it came from.
+// View-once media is wrapped so recipients can open it a single time.
+func (b *WhatsAppBridge) buildMediaMessage(ctx context.Context, chat types.JID, id, caption string, contextInfo *waE2E.ContextInfo, msg OutgoingMessage) (*waE2E.Message, string, error) {
+	header := msg.templateHeader
+	var uploaded whatsmeow.UploadResponse
+	var mimeType string
+	cached := header != nil && b.cachedTemplateMedia(ctx, msg.MediaURL, header.Type, &uploaded, &mimeType)
+
+	var data []byte
+	if !cached {
+		var err error
+		data, mimeType, err = loadOutgoingMedia(ctx, msg.MediaURL, "")
+		if err != nil {
+			return nil, "", fmt.Errorf("%w: %v", errPermanent, err)
+		}
+		if mimeType == "" || mimeType == "application/octet-stream" {
+			mimeType = http.DetectContentType(data)
+		}
+		mimeType, _, _ = strings.Cut(mimeType, ";")
+	}
+
+	kind := "document"
+	switch {
+	case header != nil:
+		kind = header.Type
+	case strings.HasPrefix(mimeType, "image/"):
+		kind = "image"
+	case strings.HasPrefix(mimeType, "video/"):
+		kind = "video"
+	case strings.HasPrefix(mimeType, "audio/"):
+		kind = "audio"
+	}
+	if msg.ViewOnce && kind != "image" && kind != "video" && kind != "audio" {
+		return nil, "", fmt.Errorf("%w: view_once is only supported for images, videos and audio", errPermanent)
+	}
+
+	if !cached {
+		mediaType := map[string]whatsmeow.MediaType{
+			"image": whatsmeow.MediaImage,
+			"video": whatsmeow.MediaVideo,
+			"audio": whatsmeow.MediaAudio,
+		}[kind]
+		if mediaType == "" {
+			mediaType = whatsmeow.MediaDocument
+		}
+		var err error
+		if uploaded, err = b.client.Upload(ctx, data, mediaType); err != nil {
+			return nil, "", fmt.Errorf("failed to upload media: %v", err)
+		}
+		b.recordUsage(ctx, operatorFromContext(ctx), UsageMediaBytes, int64(len(data)))
+		if header != nil {
+			b.cacheTemplateMedia(ctx, msg.MediaURL, header.Type, uploaded, mimeType)
+		}
+	}
+
+	fileName := mediaFileName(msg.MediaURL)
+	if header != nil && header.FileName != "" {
+		fileName = header.FileName
+	}
+	var thumbnail string
+	if data != nil {
+		thumbnail = b.thumbnails.Queue(id, kind, hex.EncodeToString(uploaded.FileSHA256), data)
+	}
+	b.keepOutgoingMedia(ctx, chat.String(), id, kind, data, uploaded.FileSHA256, mediaExtension(fileName, mimeType), mimeType, thumbnail)
+
+	out := &waE2E.Message{}
+	switch kind {
+	case "image":
+		out.ImageMessage = &waE2E.ImageMessage{
+			Caption:       proto.String(caption),
+			Mimetype:      proto.String(mimeType),
+			URL:           proto.String(uploaded.URL),
+			DirectPath:    proto.String(uploaded.DirectPath),
+			MediaKey:      uploaded.MediaKey,
+			FileEncSHA256: uploaded.FileEncSHA256,
+			FileSHA256:    uploaded.FileSHA256,
+			FileLength:    proto.Uint64(uploaded.FileLength),
+			ContextInfo:   contextInfo,
+			ViewOnce:      proto.Bool(msg.ViewOnce),
+		}
+	case "video":
+		out.VideoMessage = &waE2E.VideoMessage{
+			Caption:       proto.String(caption),
+			Mimetype:      proto.String(mimeType),
+			URL:           proto.String(uploaded.URL),
+			DirectPath:    proto.String(uploaded.DirectPath),
+			MediaKey:      uploaded.MediaKey,
+			FileEncSHA256: uploaded.FileEncSHA256,
+			FileSHA256:    uploaded.FileSHA256,
+			FileLength:    proto.Uint64(uploaded.FileLength),
+			ContextInfo:   contextInfo,
+			ViewOnce:      proto.Bool(msg.ViewOnce),
+		}
+	case "audio":
+		// Audio messages carry no caption.
+		out.AudioMessage = &waE2E.AudioMessage{
+			Mimetype:      proto.String(mimeType),
+			URL:           proto.String(uploaded.URL),
+			DirectPath:    proto.String(uploaded.DirectPath),
+			MediaKey:      uploaded.MediaKey,
+			FileEncSHA256: uploaded.FileEncSHA256,
+			FileSHA256:    uploaded.FileSHA256,
+			FileLength:    proto.Uint64(uploaded.FileLength),
+			ContextInfo:   contextInfo,
+			ViewOnce:      proto.Bool(msg.ViewOnce),
+		}
+	default:
+		out.DocumentMessage = &waE2E.DocumentMessage{
+			Caption:       proto.String(caption),
+			FileName:      proto.String(fileName),
+			Mimetype:      proto.String(mimeType),
+			URL:           proto.String(uploaded.URL),
+			DirectPath:    proto.String(uploaded.DirectPath),
+			MediaKey:      uploaded.MediaKey,
+			FileEncSHA256: uploaded.FileEncSHA256,
+			FileSHA256:    uploaded.FileSHA256,
+			FileLength:    proto.Uint64(uploaded.FileLength),
+			ContextInfo:   contextInfo,
+		}
+	}
+
+	if msg.ViewOnce {
+		return &waE2E.Message{ViewOnceMessage: &waE2E.FutureProofMessage{Message: out}}, kind, nil
+	}
+	return out, kind, nil
+}
+
+// templateMediaKey caches an upload per URL and kind; the kind decides the
+// media type the file is encrypted for.
+func templateMediaKey(url, kind string) string {
+	sum := sha256.Sum256([]byte(kind + " " + url))
+	return "whatsapp:template_media:" + hex.EncodeToString(sum[:])
+}
+
+type cachedUpload struct {
+	Upload   whatsmeow.UploadResponse `json:"upload"`
+	MimeType string                   `json:"mime_type"`
+}
+
+// cachedTemplateMedia fills uploaded and mimeType from a previous upload of
+// url, reporting whether there was one.
+func (b *WhatsAppBridge) cachedTemplateMedia(ctx context.Context, url, kind string, uploaded *whatsmeow.UploadResponse, mimeType *string) bool {
+	data, err := b.redisClient.Get(ctx, templateMediaKey(url, kind)).Bytes()
+	if err != nil {
+		return false
+	}
+	var cached cachedUpload
+	if json.Unmarshal(data, &cached) != nil {
+		return false
+	}
+	*uploaded, *mimeType = cached.Upload, cached.MimeType
+	return true
+}
+
+func (b *WhatsAppBridge) cacheTemplateMedia(ctx context.Context, url, kind string, uploaded whatsmeow.UploadResponse, mimeType string) {
+	data, _ := json.Marshal(cachedUpload{Upload: uploaded, MimeType: mimeType})
+	b.redisClient.Set(ctx, templateMediaKey(url, kind), data, envDuration("TEMPLATE_MEDIA_CACHE_TTL", 24*time.Hour))
+}
+
+// mediaFileName derives a document file name from its URL.
+func mediaFileName(rawURL string) string {
+	if u, err := url.Parse(rawURL); err == nil {
+		if name := path.Base(u.Path); name != "." && name != "/" {
+			return name
+		}
+	}
+	return "file"
+}
+
+// quoteContext builds the ContextInfo quoting msg.ReplyToMessageID, or nil
+// when the message is not a reply. The quoted author and text come from the
+// request when given, then from the archive; in a 1:1 chat without either
+// the other party is assumed to be the author.
+func (b *WhatsAppBridge) quoteContext(chat types.JID, msg OutgoingMessage) *waE2E.ContextInfo {
+	if msg.ReplyToMessageID == "" {
+		return nil
+	}
+
+	archived, _ := b.archiveDB.FindMessage(msg.ReplyToMessageID)
+
+	participant := chat
+	switch {
+	case msg.ReplyToParticipant != "":
+		jid, err := parseJIDOrPhone(msg.ReplyToParticipant)
+		if err != nil {
+			log.Printf("⚠️ Invalid reply_to_participant %q: %v", msg.ReplyToParticipant, err)
+		} else {
+			participant = jid
+		}
+	case archived != nil && archived.Direction == DirectionOutbound:
+		if own := b.ownJID(); own != "" {
+			participant, _ = types.ParseJID(own)
+		}
+	case archived != nil:
+		if jid, err := types.ParseJID(archived.Sender); err == nil {
+			participant = jid
+		}
+	}
+
+	quotedText := msg.ReplyToText
+	if quotedText == "" && archived != nil {
+		quotedText = archived.Content
+	}
+
+	return &waE2E.ContextInfo{
+		StanzaID:      proto.String(msg.ReplyToMessageID),
+		Participant:   proto.String(participant.ToNonAD().String()),
+		QuotedMessage: &waE2E.Message{Conversation: proto.String(quotedText)},
+	}
+}
@@ -0,0 +1,131 @@
+package bridge
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// OutgoingChannelConfig configures sending over Redis pub/sub, for agents
+// that would rather PUBLISH a reply than call back into the HTTP API.
+//
+// Messages published to Channel are OutgoingMessage JSON documents (same
+// shape as /send). Each one gets an OutgoingResult on ReplyChannel whose ID
+// is the message's client_message_id, so the publisher can match the ack or
+// error to its request. Pub/sub is fire-and-forget: messages published
+// while the bridge is down are lost, and every subscribed replica receives
+// them, so several replicas only avoid double sends when client_message_id
+// is set. Use OUTGOING_STREAM where delivery must be guaranteed.
+//
+// Workers send at once, each in order the messages of the recipients it
+// is assigned, so a recipient's messages keep the order they were published
+// in. While every worker is busy, up to Buffer messages wait; past that
+// Redis keeps further ones in the subscriber's output buffer, and drops
+// the subscription (and the messages) when that is full.
+type OutgoingChannelConfig struct {
+	Channel      string
+	ReplyChannel string
+	Workers      int // OUTGOING_CHANNEL_WORKERS, default 4
+	Buffer       int // OUTGOING_CHANNEL_BUFFER, default 1000
+}
+
+// outgoingChannelConfigFromEnv returns nil unless OUTGOING_CHANNEL is set
+// (e.g. to "whatsapp:outgoing").
+func outgoingChannelConfigFromEnv() *OutgoingChannelConfig {
+	channel := envString("OUTGOING_CHANNEL", "")
+	if channel == "" {
+		return nil
+	}
+	return &OutgoingChannelConfig{
+		Channel:      channel,
+		ReplyChannel: envString("OUTGOING_REPLY_CHANNEL", channel+":results"),
+		Workers:      max(envInt("OUTGOING_CHANNEL_WORKERS", 4), 1),
+		Buffer:       max(envInt("OUTGOING_CHANNEL_BUFFER", 1000), 1),
+	}
+}
+
+// subscribeOutgoing sends every message published to the outgoing channel
+// until the bridge context is cancelled.
+func (b *WhatsAppBridge) subscribeOutgoing(cfg *OutgoingChannelConfig) {
+	pubsub := b.redisClient.Subscribe(b.intake, cfg.Channel)
+	defer pubsub.Close()
+	log.Printf("📥 Sending messages published to %s with %d workers (results on %s)", cfg.Channel, cfg.Workers, cfg.ReplyChannel)
+
+	queues := make([]chan OutgoingMessage, cfg.Workers)
+	for i := range queues {
+		queues[i] = make(chan OutgoingMessage, cfg.Buffer/cfg.Workers+1)
+		go func(queue <-chan OutgoingMessage) {
+			for msg := range queue {
+				b.publishOutgoingResult(cfg, b.sendChannelMessage(cfg, msg))
+			}
+		}(queues[i])
+	}
+	defer func() {
+		for _, queue := range queues {
+			close(queue)
+		}
+	}()
+
+	messages := pubsub.Channel(redis.WithChannelSize(cfg.Buffer))
+	for {
+		select {
+		case <-b.intake.Done():
+			return
+		case m, ok := <-messages:
+			if !ok {
+				return
+			}
+			var msg OutgoingMessage
+			if err := json.Unmarshal([]byte(m.Payload), &msg); err != nil {
+				b.publishOutgoingResult(cfg, OutgoingResult{Status: "failed", Error: fmt.Sprintf("invalid payload: %v", err)})
+				continue
+			}
+			worker := fnv.New32a()
+			worker.Write([]byte(msg.Phone))
+			// Blocks while that worker's queue is full.
+			select {
+			case queues[worker.Sum32()%uint32(len(queues))] <- msg:
+			case <-b.ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+func (b *WhatsAppBridge) publishOutgoingResult(cfg *OutgoingChannelConfig, result OutgoingResult) {
+	data, _ := json.Marshal(result)
+	if err := b.redisClient.Publish(b.ctx, cfg.ReplyChannel, data).Err(); err != nil {
+		log.Printf("Error publishing outgoing result to %s: %v", cfg.ReplyChannel, err)
+	}
+}
+
+func (b *WhatsAppBridge) sendChannelMessage(cfg *OutgoingChannelConfig, msg OutgoingMessage) OutgoingResult {
+	result := OutgoingResult{ID: msg.ClientMessageID}
+	if err := msg.Validate(); err != nil {
+		result.Status, result.Error = "failed", err.Error()
+		return result
+	}
+
+	operator := "pubsub:" + cfg.Channel
+	resp, previous, replayed, err := b.sendIdempotent(withOperator(b.ctx, operator), operator, msg.ClientMessageID, msg)
+	switch {
+	case replayed:
+		result.Status = "duplicate"
+		result.MessageID, _ = previous["message_id"].(string)
+		return result
+	case errors.Is(err, errIdempotencyInProgress):
+		// Another replica picked up the same publish.
+		result.Status = "duplicate"
+		return result
+	case err != nil:
+		log.Printf("Outgoing message from %s failed: %v", cfg.Channel, err)
+		result.Status, result.MessageID, result.Error = "failed", resp.ID, err.Error()
+		return result
+	}
+	result.Status, result.MessageID, result.Variant = resp.status(), resp.ID, resp.Variant
+	return result
+}
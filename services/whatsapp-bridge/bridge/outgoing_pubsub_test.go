@@ -0,0 +1,77 @@
+package bridge_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+
+	"github.com/phenobarbital/ai-parrot/whatsapp-bridge/bridge"
+	"github.com/phenobarbital/ai-parrot/whatsapp-bridge/bridgetest"
+)
+
+func TestOutgoingChannelSendsInOrderPerRecipient(t *testing.T) {
+	h := bridgetest.New(t,
+		bridgetest.WithEnv("OUTGOING_CHANNEL", "whatsapp:outgoing"),
+		bridgetest.WithEnv("OUTGOING_CHANNEL_WORKERS", "3"),
+		bridgetest.WithEnv("OUTGOING_CHANNEL_BUFFER", "2"),
+		bridgetest.WithEnv("RATE_LIMIT_CHAT_PER_MINUTE", "0"),
+		bridgetest.WithEnv("RATE_LIMIT_GLOBAL_PER_MINUTE", "0"),
+	)
+	ctx := context.Background()
+	results := h.RedisClient.Subscribe(ctx, "whatsapp:outgoing:results")
+	defer results.Close()
+	if _, err := results.Receive(ctx); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(bridgetest.DefaultTimeout)
+	for h.Redis.PubSubNumSub("whatsapp:outgoing")["whatsapp:outgoing"] == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("bridge did not subscribe to the outgoing channel")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// More messages than the buffer holds, to two recipients.
+	phones := []string{"5215512345678", "5215587654321"}
+	const perPhone = 10
+	for i := 0; i < perPhone; i++ {
+		for _, phone := range phones {
+			payload, _ := json.Marshal(bridge.OutgoingMessage{
+				Phone:           phone,
+				Message:         fmt.Sprintf("message %d", i),
+				ClientMessageID: fmt.Sprintf("%s-%d", phone, i),
+			})
+			h.RedisClient.Publish(ctx, "whatsapp:outgoing", payload)
+		}
+	}
+	h.RedisClient.Publish(ctx, "whatsapp:outgoing", "not json")
+
+	statuses := make(map[string]int)
+	for range len(phones)*perPhone + 1 {
+		m, err := results.ReceiveMessage(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var result bridge.OutgoingResult
+		if err := json.Unmarshal([]byte(m.Payload), &result); err != nil {
+			t.Fatal(err)
+		}
+		statuses[result.Status]++
+	}
+	if statuses["sent"] != len(phones)*perPhone || statuses["failed"] != 1 {
+		t.Fatalf("results by status = %v", statuses)
+	}
+
+	next := make(map[types.JID]int)
+	for _, sent := range h.Sent() {
+		want := fmt.Sprintf("message %d", next[sent.To])
+		if got := sent.Message.GetConversation(); got != want {
+			t.Fatalf("sent %q to %s, want %q", got, sent.To, want)
+		}
+		next[sent.To]++
+	}
+}
@@ -0,0 +1,234 @@
+package bridge
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// OutgoingStreamConfig configures the Redis Streams consumer for outbound messages.
+//
+// Producers XADD entries to Stream with two fields:
+//
+//	id      - the producer's message ID, used as the idempotency key
+//	payload - an OutgoingMessage JSON document (same shape as /send)
+//	operator - optional name recorded in the archive's audit trail
+//
+// Entries are only XACKed once the send succeeded (or failed permanently), so
+// a crashed bridge leaves them pending; after VisibilityTimeout another
+// consumer reclaims them. A per-ID record of completed sends guarantees that
+// producer retries and reclaims never message the customer twice.
+type OutgoingStreamConfig struct {
+	Stream            string
+	Group             string
+	Consumer          string
+	ResultsStream     string
+	DeadLetterStream  string
+	VisibilityTimeout time.Duration
+	MaxDeliveries     int64
+	IdempotencyTTL    time.Duration
+}
+
+// OutgoingResult is appended to the results stream for every processed entry.
+type OutgoingResult struct {
+	ID        string `json:"id"`
+	Status    string `json:"status"` // sent, queued, duplicate, failed, dead_letter
+	MessageID string `json:"message_id,omitempty"`
+	Variant   string `json:"variant,omitempty"` // template variant sent
+	Error     string `json:"error,omitempty"`
+}
+
+// errPermanent marks failures that will not succeed on retry.
+var errPermanent = errors.New("permanent failure")
+
+// outgoingStreamConfigFromEnv returns nil unless OUTGOING_STREAM is set.
+func outgoingStreamConfigFromEnv() *OutgoingStreamConfig {
+	stream := envString("OUTGOING_STREAM", "")
+	if stream == "" {
+		return nil
+	}
+	hostname, _ := os.Hostname()
+	return &OutgoingStreamConfig{
+		Stream:            stream,
+		Group:             envString("OUTGOING_GROUP", "whatsapp-bridge"),
+		Consumer:          envString("OUTGOING_CONSUMER", hostname),
+		ResultsStream:     envString("OUTGOING_RESULTS_STREAM", stream+":results"),
+		DeadLetterStream:  envString("OUTGOING_DEAD_LETTER_STREAM", stream+":dead"),
+		VisibilityTimeout: envDuration("OUTGOING_VISIBILITY_TIMEOUT", 60*time.Second),
+		MaxDeliveries:     int64(envInt("OUTGOING_MAX_DELIVERIES", 5)),
+		IdempotencyTTL:    envDuration("OUTGOING_IDEMPOTENCY_TTL", 24*time.Hour),
+	}
+}
+
+// consumeOutgoingStream reads the outgoing stream as part of a consumer group
+// until the bridge context is cancelled.
+func (b *WhatsAppBridge) consumeOutgoingStream(cfg *OutgoingStreamConfig) {
+	err := b.redisClient.XGroupCreateMkStream(b.ctx, cfg.Stream, cfg.Group, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		log.Printf("❌ Failed to create consumer group %s on %s: %v", cfg.Group, cfg.Stream, err)
+		return
+	}
+	log.Printf("📥 Consuming outgoing messages from stream %s (group %s, consumer %s)",
+		cfg.Stream, cfg.Group, cfg.Consumer)
+
+	lastReclaim := time.Time{}
+	for b.intake.Err() == nil {
+		if !b.client.IsConnected() {
+			time.Sleep(2 * time.Second)
+			continue
+		}
+
+		if time.Since(lastReclaim) >= cfg.VisibilityTimeout/2 {
+			b.reclaimOutgoing(cfg)
+			lastReclaim = time.Now()
+		}
+
+		streams, err := b.redisClient.XReadGroup(b.intake, &redis.XReadGroupArgs{
+			Group:    cfg.Group,
+			Consumer: cfg.Consumer,
+			Streams:  []string{cfg.Stream, ">"},
+			Count:    10,
+			Block:    5 * time.Second,
+		}).Result()
+		if err != nil {
+			if err != redis.Nil {
+				log.Printf("Error reading outgoing stream: %v", err)
+				time.Sleep(time.Second)
+			}
+			continue
+		}
+
+		for _, stream := range streams {
+			for _, entry := range stream.Messages {
+				b.processOutgoingEntry(cfg, entry, 1)
+			}
+		}
+	}
+}
+
+// reclaimOutgoing takes over entries whose consumer exceeded the visibility
+// timeout without acking, dead-lettering those past MaxDeliveries.
+func (b *WhatsAppBridge) reclaimOutgoing(cfg *OutgoingStreamConfig) {
+	pending, err := b.redisClient.XPendingExt(b.ctx, &redis.XPendingExtArgs{
+		Stream: cfg.Stream,
+		Group:  cfg.Group,
+		Idle:   cfg.VisibilityTimeout,
+		Start:  "-",
+		End:    "+",
+		Count:  50,
+	}).Result()
+	if err != nil {
+		log.Printf("Error listing pending outgoing entries: %v", err)
+		return
+	}
+
+	for _, p := range pending {
+		entries, err := b.redisClient.XClaim(b.ctx, &redis.XClaimArgs{
+			Stream:   cfg.Stream,
+			Group:    cfg.Group,
+			Consumer: cfg.Consumer,
+			MinIdle:  cfg.VisibilityTimeout,
+			Messages: []string{p.ID},
+		}).Result()
+		if err != nil {
+			log.Printf("Error claiming outgoing entry %s: %v", p.ID, err)
+			continue
+		}
+		for _, entry := range entries {
+			// XCLAIM counts as a new delivery.
+			b.processOutgoingEntry(cfg, entry, p.RetryCount+1)
+		}
+	}
+}
+
+// processOutgoingEntry sends a single stream entry at most once per producer ID.
+func (b *WhatsAppBridge) processOutgoingEntry(cfg *OutgoingStreamConfig, entry redis.XMessage, deliveries int64) {
+	id := streamField(entry, "id")
+	if id == "" {
+		id = entry.ID
+	}
+	doneKey := "whatsapp:outgoing:done:" + id
+	lockKey := "whatsapp:outgoing:lock:" + id
+
+	// Already delivered by an earlier attempt: just ack and re-announce.
+	if messageID, err := b.redisClient.Get(b.ctx, doneKey).Result(); err == nil {
+		b.finishOutgoing(cfg, entry, OutgoingResult{ID: id, Status: "duplicate", MessageID: messageID})
+		return
+	}
+
+	if deliveries > cfg.MaxDeliveries {
+		log.Printf("☠️ Outgoing %s exceeded %d deliveries, dead-lettering", id, cfg.MaxDeliveries)
+		b.redisClient.XAdd(b.ctx, &redis.XAddArgs{Stream: cfg.DeadLetterStream, Values: entry.Values})
+		backlog, _ := b.redisClient.XLen(b.ctx, cfg.DeadLetterStream).Result()
+		b.notifier.Notify(AlertDeadLetter, fmt.Sprintf("☠️ Outgoing message %s dead-lettered; %s now holds %d entries", id, cfg.DeadLetterStream, backlog))
+		b.finishOutgoing(cfg, entry, OutgoingResult{ID: id, Status: "dead_letter", Error: "max deliveries exceeded"})
+		return
+	}
+
+	// Guard against two consumers working the same producer ID concurrently
+	// (e.g. a producer that enqueued a retry while the first copy is in flight).
+	locked, err := b.redisClient.SetNX(b.ctx, lockKey, cfg.Consumer, cfg.VisibilityTimeout).Result()
+	if err != nil || !locked {
+		return
+	}
+	defer b.redisClient.Del(b.ctx, lockKey)
+
+	// Producers may attribute the send; otherwise credit the stream itself.
+	operator := streamField(entry, "operator")
+	if operator == "" {
+		operator = "stream:" + cfg.Stream
+	}
+	resp, err := b.sendStreamPayload(withOperator(b.ctx, operator), streamField(entry, "payload"))
+	if err != nil {
+		if errors.Is(err, errPermanent) {
+			log.Printf("Outgoing %s failed permanently: %v", id, err)
+			b.finishOutgoing(cfg, entry, OutgoingResult{ID: id, Status: "failed", Error: err.Error()})
+		} else {
+			// Leave unacked; it becomes visible again after the timeout.
+			log.Printf("Outgoing %s failed (delivery %d/%d), will retry: %v", id, deliveries, cfg.MaxDeliveries, err)
+		}
+		return
+	}
+
+	b.redisClient.Set(b.ctx, doneKey, resp.ID, cfg.IdempotencyTTL)
+	b.finishOutgoing(cfg, entry, OutgoingResult{ID: id, Status: resp.status(), MessageID: resp.ID, Variant: resp.Variant})
+}
+
+func (b *WhatsAppBridge) sendStreamPayload(ctx context.Context, payload string) (SendResult, error) {
+	var msg OutgoingMessage
+	if err := json.Unmarshal([]byte(payload), &msg); err != nil {
+		return SendResult{}, fmt.Errorf("%w: invalid payload: %v", errPermanent, err)
+	}
+	if err := msg.Validate(); err != nil {
+		return SendResult{}, fmt.Errorf("%w: %v", errPermanent, err)
+	}
+	return b.sendOutgoing(ctx, msg)
+}
+
+// finishOutgoing acks the entry and appends its result to the results stream.
+func (b *WhatsAppBridge) finishOutgoing(cfg *OutgoingStreamConfig, entry redis.XMessage, result OutgoingResult) {
+	if err := b.redisClient.XAck(b.ctx, cfg.Stream, cfg.Group, entry.ID).Err(); err != nil {
+		log.Printf("Error acking outgoing entry %s: %v", entry.ID, err)
+	}
+	data, _ := json.Marshal(result)
+	b.redisClient.XAdd(b.ctx, &redis.XAddArgs{
+		Stream: cfg.ResultsStream,
+		Values: map[string]interface{}{"id": result.ID, "result": data},
+	})
+}
+
+func streamField(entry redis.XMessage, key string) string {
+	if v, ok := entry.Values[key]; ok {
+		if s, ok := v.(string); ok {
+			return s
+		}
+	}
+	return ""
+}
@@ -0,0 +1,409 @@
+package bridge
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	mrand "math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+// tokenBucket refills at rate tokens per second up to burst. Reservations
+// may drive it negative, so concurrent senders queue behind each other.
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(perMinute, burst int, now time.Time) *tokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{rate: float64(perMinute) / 60, burst: float64(burst), tokens: float64(burst), last: now}
+}
+
+// refill adds the tokens accrued since the last call.
+func (t *tokenBucket) refill(now time.Time) {
+	t.tokens = min(t.burst, t.tokens+now.Sub(t.last).Seconds()*t.rate)
+	t.last = now
+}
+
+// wait returns how long until a token is available, as of the last refill.
+func (t *tokenBucket) wait() time.Duration {
+	if t.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - t.tokens) / t.rate * float64(time.Second))
+}
+
+// idle reports whether the bucket has refilled, i.e. is safe to forget.
+func (t *tokenBucket) idle(now time.Time) bool {
+	return t.tokens+now.Sub(t.last).Seconds()*t.rate >= t.burst
+}
+
+// Pacer spaces outgoing messages to look less like automation. Token
+// buckets limit sends per chat (RATE_LIMIT_CHAT_PER_MINUTE, default 12,
+// bursts of RATE_LIMIT_CHAT_BURST, default 3) and overall
+// (RATE_LIMIT_GLOBAL_PER_MINUTE, default 60, bursts of
+// RATE_LIMIT_GLOBAL_BURST, default 10); a rate of 0 disables that limit.
+// Each send is further delayed by a random PACING_JITTER (default 0). With
+// TYPING_DELAY the chat shows "typing..." for a time proportional to the
+// text, TYPING_CHARS_PER_SECOND (default 20) capped at TYPING_MAX_DELAY
+// (default 8s). A nil Pacer sends immediately.
+//
+// Sends are queued for as long as the limits require, except for HTTP API
+// requests that would wait longer than RATE_LIMIT_MAX_WAIT (default 10s):
+// those are rejected with a *RateLimitError, which the API reports as 429
+// with Retry-After, so clients back off instead of holding requests open.
+// The wait is capped so that, with the typing delay and jitter, a request
+// still answers within WriteTimeout; a request sending several parts also
+// stops once the next one could not go out before its deadline (see
+// requestDeadline). A send whose wait is cancelled gives its tokens back.
+type Pacer struct {
+	chatRate    int
+	chatBurst   int
+	global      *tokenBucket
+	globalRate  int
+	maxWait     time.Duration
+	reserved    time.Duration // jitter and typing delay, on top of the wait
+	jitter      time.Duration
+	typing      bool
+	typingSpeed float64
+	typingMax   time.Duration
+	bridge      *WhatsAppBridge
+
+	mu    sync.Mutex
+	chats map[types.JID]*tokenBucket
+}
+
+// rateLimitMaxWait returns RATE_LIMIT_MAX_WAIT, capped so that a request
+// that waits as long and then spends reserved on the send itself still
+// answers within WriteTimeout.
+func rateLimitMaxWait(reserved time.Duration) time.Duration {
+	maxWait := envDuration("RATE_LIMIT_MAX_WAIT", 10*time.Second)
+	limit := max(WriteTimeout-writeMargin-reserved, time.Second)
+	if maxWait <= 0 || maxWait > limit {
+		log.Printf("RATE_LIMIT_MAX_WAIT capped at %s to answer API requests within %s", limit, WriteTimeout)
+		maxWait = limit
+	}
+	return maxWait
+}
+
+func (b *WhatsAppBridge) pacerFromEnv() *Pacer {
+	p := &Pacer{
+		chatRate:    envInt("RATE_LIMIT_CHAT_PER_MINUTE", 12),
+		chatBurst:   envInt("RATE_LIMIT_CHAT_BURST", 3),
+		jitter:      envDuration("PACING_JITTER", 0),
+		typing:      envBool("TYPING_DELAY", false),
+		typingSpeed: envFloat("TYPING_CHARS_PER_SECOND", 20),
+		typingMax:   envDuration("TYPING_MAX_DELAY", 8*time.Second),
+		bridge:      b,
+		chats:       make(map[types.JID]*tokenBucket),
+	}
+	p.reserved = p.jitter
+	if p.typing {
+		p.reserved += p.typingMax
+	}
+	p.maxWait = rateLimitMaxWait(p.reserved)
+	if rate := envInt("RATE_LIMIT_GLOBAL_PER_MINUTE", 60); rate > 0 {
+		p.global = newTokenBucket(rate, envInt("RATE_LIMIT_GLOBAL_BURST", 10), time.Now())
+		p.globalRate = rate
+	}
+	if p.chatRate <= 0 && p.global == nil && p.jitter <= 0 && !p.typing {
+		return nil
+	}
+	return p
+}
+
+// Wait blocks until a message of textLen characters may be sent to chat,
+// returning early with the context's error if it is cancelled, or a
+// *RateLimitError if the request may not wait that long.
+func (p *Pacer) Wait(ctx context.Context, chat types.JID, textLen int) error {
+	if p == nil {
+		return nil
+	}
+
+	var maxWait time.Duration
+	if rejectsOverLimit(ctx) {
+		maxWait = p.maxWait
+		if deadline, ok := requestDeadline(ctx); ok {
+			left := time.Until(deadline) - p.reserved
+			if left <= 0 {
+				wait, _, quota := p.peek(chat)
+				err := outOfTime(chat, max(wait, time.Second))
+				err.Quota = quota
+				log.Printf("🚦 Rejecting message to %s: %v", chat, err)
+				return err
+			}
+			maxWait = min(maxWait, left)
+		}
+	}
+	// Campaign sends wait for a free token rather than reserve one, so
+	// they never queue ahead of other sends.
+	yield := priorityFromContext(ctx) == PriorityCampaign
+	delay, err := p.reserve(chat, maxWait, yield)
+	for err == nil && yield && delay > 0 {
+		if err := sleepContext(ctx, delay); err != nil {
+			return err
+		}
+		delay, err = p.reserve(chat, maxWait, yield)
+	}
+	if err != nil {
+		log.Printf("🚦 Rejecting message to %s: %v", chat, err)
+		return err
+	}
+	if p.jitter > 0 {
+		delay += time.Duration(mrand.Int63n(int64(p.jitter)))
+	}
+	if delay >= 5*time.Second {
+		log.Printf("⏳ Pacing message to %s by %s", chat, delay.Round(time.Second))
+	}
+	if err := sleepContext(ctx, delay); err != nil {
+		p.refund(chat)
+		return err
+	}
+
+	if !p.typing || textLen == 0 || p.typingSpeed <= 0 {
+		return nil
+	}
+	if chat.Server != types.DefaultUserServer && chat.Server != types.HiddenUserServer && chat.Server != types.GroupServer {
+		return nil
+	}
+	typing := min(time.Duration(float64(textLen)/p.typingSpeed*float64(time.Second)), p.typingMax)
+	if err := p.bridge.client.SendChatPresence(ctx, chat, types.ChatPresenceComposing, types.ChatPresenceMediaText); err != nil {
+		log.Printf("Error sending typing indicator to %s: %v", chat, err)
+	}
+	if err := sleepContext(ctx, typing); err != nil {
+		p.refund(chat)
+		return err
+	}
+	return nil
+}
+
+// refund gives back the tokens a send to chat reserved, when it was
+// cancelled before going out.
+func (p *Pacer) refund(chat types.JID) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if bucket := p.chats[chat]; bucket != nil {
+		bucket.tokens = min(bucket.burst, bucket.tokens+1)
+	}
+	if p.global != nil {
+		p.global.tokens = min(p.global.burst, p.global.tokens+1)
+	}
+}
+
+// reserve takes a token from the chat's bucket and the global one and
+// returns the longer of the two waits. When maxWait is set and the wait
+// would exceed it, no token is taken and a *RateLimitError is returned.
+// With yield, no token is taken unless one is free: a non-zero wait means
+// try again after it.
+func (p *Pacer) reserve(chat types.JID, maxWait time.Duration, yield bool) (time.Duration, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+
+	var buckets []*tokenBucket
+	var quota []RateLimitQuota
+	var delay time.Duration
+	scope := ""
+	if p.chatRate > 0 {
+		if len(p.chats) > 1024 {
+			for jid, bucket := range p.chats {
+				if bucket.idle(now) {
+					delete(p.chats, jid)
+				}
+			}
+		}
+		bucket := p.chats[chat]
+		if bucket == nil {
+			bucket = newTokenBucket(p.chatRate, p.chatBurst, now)
+			p.chats[chat] = bucket
+		}
+		bucket.refill(now)
+		delay, scope = bucket.wait(), "chat"
+		buckets = append(buckets, bucket)
+		quota = append(quota, bucket.quota("chat", p.chatRate))
+	}
+	if p.global != nil {
+		p.global.refill(now)
+		if wait := p.global.wait(); wait > delay {
+			delay, scope = wait, "global"
+		}
+		buckets = append(buckets, p.global)
+		quota = append(quota, p.global.quota("global", p.globalRate))
+	}
+
+	if maxWait > 0 && delay > maxWait {
+		return 0, &RateLimitError{
+			Scope:      scope,
+			Chat:       chat.String(),
+			RetryAfter: delay,
+			RetryAt:    now.Add(delay),
+			Quota:      quota,
+		}
+	}
+	if yield && delay > 0 {
+		return delay, nil
+	}
+	for _, bucket := range buckets {
+		bucket.tokens--
+	}
+	return delay, nil
+}
+
+// peek returns the wait reserve would return for a send to chat and the
+// limit causing it, without taking a token.
+func (p *Pacer) peek(chat types.JID) (time.Duration, string, []RateLimitQuota) {
+	if p == nil {
+		return 0, "", nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+
+	var quota []RateLimitQuota
+	var delay time.Duration
+	scope := ""
+	if p.chatRate > 0 {
+		bucket := *newTokenBucket(p.chatRate, p.chatBurst, now)
+		if known := p.chats[chat]; known != nil {
+			bucket = *known
+			bucket.refill(now)
+		}
+		delay, scope = bucket.wait(), "chat"
+		quota = append(quota, bucket.quota("chat", p.chatRate))
+	}
+	if p.global != nil {
+		global := *p.global
+		global.refill(now)
+		if wait := global.wait(); wait > delay {
+			delay, scope = wait, "global"
+		}
+		quota = append(quota, global.quota("global", p.globalRate))
+	}
+	return delay, scope, quota
+}
+
+// RateLimitQuota is the state of one limit when a send was rejected.
+type RateLimitQuota struct {
+	Scope     string  `json:"scope"` // chat, global or country
+	PerMinute int     `json:"per_minute"`
+	Burst     int     `json:"burst"`
+	Available float64 `json:"available"` // sends possible right now; negative when sends are queued
+	Queued    int     `json:"queued"`    // accepted sends still waiting for this limit
+}
+
+func (t *tokenBucket) quota(scope string, perMinute int) RateLimitQuota {
+	q := RateLimitQuota{Scope: scope, PerMinute: perMinute, Burst: int(t.burst), Available: math.Floor(t.tokens*100) / 100}
+	if t.tokens < 0 {
+		q.Queued = int(math.Ceil(-t.tokens))
+	}
+	return q
+}
+
+// RateLimitError rejects a send that would have to wait longer than
+// RATE_LIMIT_MAX_WAIT. RetryAt is the earliest time the limit that was hit
+// admits another message.
+type RateLimitError struct {
+	Scope      string           `json:"scope"` // limit that was hit: chat, global, country, allowed_hours, send_window or request
+	Chat       string           `json:"chat"`
+	RetryAfter time.Duration    `json:"-"`
+	RetryAt    time.Time        `json:"-"`
+	Quota      []RateLimitQuota `json:"quota"`
+}
+
+func (e *RateLimitError) Error() string {
+	if e.Scope == "allowed_hours" {
+		return fmt.Sprintf("outside the recipient's allowed hours, retry in %s", e.RetryAfter.Round(time.Second))
+	}
+	if e.Scope == "request" {
+		return fmt.Sprintf("no time left in the request to send, retry in %s", e.RetryAfter.Round(time.Second))
+	}
+	if e.Scope == "send_window" {
+		return fmt.Sprintf("outside the send window, retry in %s", e.RetryAfter.Round(time.Second))
+	}
+	return fmt.Sprintf("%s rate limit exceeded, retry in %s", e.Scope, e.RetryAfter.Round(time.Second))
+}
+
+type rejectOverLimitKey struct{}
+
+// rejectsOverLimit reports whether sends on ctx are rejected rather than
+// queued past RATE_LIMIT_MAX_WAIT; only HTTP API requests are.
+func rejectsOverLimit(ctx context.Context) bool {
+	reject, _ := ctx.Value(rejectOverLimitKey{}).(bool)
+	return reject
+}
+
+// writeMargin is kept free at the end of WriteTimeout for answering.
+const writeMargin = 3 * time.Second
+
+type requestDeadlineKey struct{}
+
+// requestDeadline returns when the sends of an API request must be done for
+// it to answer within WriteTimeout. It is a context value rather than the
+// context's deadline, as handlers send on a context.WithoutCancel so a
+// client hanging up does not abort a send midway.
+func requestDeadline(ctx context.Context) (time.Time, bool) {
+	deadline, ok := ctx.Value(requestDeadlineKey{}).(time.Time)
+	return deadline, ok
+}
+
+// outOfTime rejects a send to chat that could not go out before its
+// request's deadline.
+func outOfTime(chat types.JID, retryAfter time.Duration) *RateLimitError {
+	return &RateLimitError{Scope: "request", Chat: chat.String(), RetryAfter: retryAfter,
+		RetryAt: time.Now().Add(retryAfter), Quota: []RateLimitQuota{}}
+}
+
+// rateLimitMiddleware marks API requests so their sends are rejected rather
+// than held open when the pacer is backed up, and gives the request's sends
+// a deadline within WriteTimeout.
+func rateLimitMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), rejectOverLimitKey{}, true)
+		ctx = context.WithValue(ctx, requestDeadlineKey{}, time.Now().Add(WriteTimeout-writeMargin))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// writeRateLimited answers 429 with Retry-After (whole seconds, rounded up)
+// and the retry time and quota usage in the body.
+func (b *WhatsAppBridge) writeRateLimited(w http.ResponseWriter, err *RateLimitError, messageID string) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(err.RetryAfter.Seconds()))))
+	data := map[string]interface{}{
+		"scope":        err.Scope,
+		"chat":         err.Chat,
+		"retry_after":  math.Ceil(err.RetryAfter.Seconds()*1000) / 1000,
+		"retry_at":     err.RetryAt.Unix(),
+		"retry_at_iso": b.formatTime(err.RetryAt),
+		"quota":        err.Quota,
+	}
+	if messageID != "" {
+		data["message_id"] = messageID
+	}
+	writeJSON(w, http.StatusTooManyRequests, Response{Success: false, Error: err.Error(), Data: data})
+}
+
+// sleepContext sleeps for d or until ctx is done.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,96 @@
+package bridge
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+func TestPacerRefundsCancelledWait(t *testing.T) {
+	t.Setenv("RATE_LIMIT_CHAT_PER_MINUTE", "1")
+	t.Setenv("RATE_LIMIT_CHAT_BURST", "1")
+	t.Setenv("RATE_LIMIT_GLOBAL_PER_MINUTE", "0")
+	p := (&WhatsAppBridge{}).pacerFromEnv()
+	chat := types.NewJID("5215512345678", types.DefaultUserServer)
+
+	if err := p.Wait(context.Background(), chat, 0); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := p.Wait(ctx, chat, 0); err != context.DeadlineExceeded {
+		t.Fatalf("cancelled wait returned %v", err)
+	}
+
+	// The cancelled send queued nobody: the next one waits for one token,
+	// not two.
+	delay, _, _ := p.peek(chat)
+	if delay > time.Minute {
+		t.Fatalf("next send waits %s after a cancelled one", delay)
+	}
+}
+
+func TestPacerMaxWaitWithinWriteTimeout(t *testing.T) {
+	for _, tc := range []struct {
+		maxWait, typing string
+		want            time.Duration
+	}{
+		{"", "false", 10 * time.Second},
+		{"5s", "false", 5 * time.Second},
+		{"1m", "false", WriteTimeout - 3*time.Second},
+		{"0", "false", WriteTimeout - 3*time.Second},
+		{"", "true", WriteTimeout - 3*time.Second - 8*time.Second},
+	} {
+		t.Setenv("RATE_LIMIT_MAX_WAIT", tc.maxWait)
+		t.Setenv("TYPING_DELAY", tc.typing)
+		if got := (&WhatsAppBridge{}).pacerFromEnv().maxWait; got != tc.want {
+			t.Errorf("RATE_LIMIT_MAX_WAIT=%q TYPING_DELAY=%s: max wait %s, want %s", tc.maxWait, tc.typing, got, tc.want)
+		}
+	}
+}
+
+// apiRequest returns a context like an API request's with deadline left of
+// its time to send.
+func apiRequest(left time.Duration) context.Context {
+	ctx := context.WithValue(context.Background(), rejectOverLimitKey{}, true)
+	return context.WithValue(ctx, requestDeadlineKey{}, time.Now().Add(left))
+}
+
+func TestPacerStopsAtRequestDeadline(t *testing.T) {
+	// A token every 2s, well within the max wait but not the time left.
+	t.Setenv("RATE_LIMIT_CHAT_PER_MINUTE", "30")
+	t.Setenv("RATE_LIMIT_CHAT_BURST", "1")
+	t.Setenv("RATE_LIMIT_GLOBAL_PER_MINUTE", "0")
+	p := (&WhatsAppBridge{}).pacerFromEnv()
+	chat := types.NewJID("5215512345678", types.DefaultUserServer)
+
+	if err := p.Wait(apiRequest(time.Second), chat, 0); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	err := p.Wait(apiRequest(time.Second), chat, 0)
+	if _, limited := err.(*RateLimitError); !limited {
+		t.Fatalf("wait past the request's deadline returned %v", err)
+	}
+	if waited := time.Since(start); waited > 100*time.Millisecond {
+		t.Errorf("rejected after waiting %s", waited)
+	}
+	if err := p.Wait(apiRequest(0), chat, 0).(*RateLimitError); err.Scope != "request" {
+		t.Errorf("wait with no time left rejected as %v", err)
+	}
+}
+
+func TestSplitPauseStopsAtRequestDeadline(t *testing.T) {
+	b := &WhatsAppBridge{splitter: &MessageSplitter{Delay: 2 * time.Second}}
+	msg := OutgoingMessage{Phone: "5215512345678"}
+	err := b.pauseBetweenParts(apiRequest(time.Second), msg)
+	if limited, ok := err.(*RateLimitError); !ok || limited.Scope != "request" {
+		t.Fatalf("pause past the request's deadline returned %v", err)
+	}
+	b.splitter.Delay = 10 * time.Millisecond
+	if err := b.pauseBetweenParts(context.Background(), msg); err != nil {
+		t.Errorf("pause outside a request returned %v", err)
+	}
+}
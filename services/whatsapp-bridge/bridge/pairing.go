@@ -0,0 +1,199 @@
+package bridge
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+
+	"github.com/phenobarbital/ai-parrot/whatsapp-bridge/pairing"
+)
+
+// pairingSnapshot is what a websocket client that connects mid-flow needs
+// to catch up: the current state and the code being shown, if any.
+type pairingSnapshot struct {
+	state    pairing.Event
+	qr       *pairing.Event
+	pairCode *pairing.Event
+}
+
+// broadcastPairing sends evt to every websocket client, dropping the ones
+// that fail. The writes happen outside wsMu, so a slow client holds up
+// neither the other clients nor new connections.
+func (b *WhatsAppBridge) broadcastPairing(evt pairing.Event) {
+	b.wsMu.Lock()
+	clients := make([]*wsClient, 0, len(b.wsClients))
+	for client := range b.wsClients {
+		clients = append(clients, client)
+	}
+	b.wsMu.Unlock()
+
+	for _, client := range clients {
+		if err := client.write(evt); err != nil {
+			log.Printf("Error broadcasting to WebSocket: %v", err)
+			client.conn.Close()
+			b.wsMu.Lock()
+			delete(b.wsClients, client)
+			b.wsMu.Unlock()
+		}
+	}
+}
+
+// setPairingState records and broadcasts a state transition.
+func (b *WhatsAppBridge) setPairingState(state, detail string) {
+	b.wsMu.Lock()
+	if b.pairing.state.State == state && b.pairing.state.Detail == detail {
+		b.wsMu.Unlock()
+		return
+	}
+	b.pairing.state = pairing.Event{Type: pairing.EventState, State: state, Detail: detail}
+	if state != pairing.StateWaitingScan {
+		b.pairing.qr, b.pairing.pairCode = nil, nil
+	}
+	b.wsMu.Unlock()
+	b.broadcastPairing(pairing.Event{Type: pairing.EventState, State: state, Detail: detail})
+}
+
+func (b *WhatsAppBridge) broadcastQRCode(code string, png []byte, timeout time.Duration) {
+	b.setPairingState(pairing.StateWaitingScan, "")
+	evt := pairing.Event{Type: pairing.EventQRCode, Data: code, ExpiresIn: int(timeout.Seconds())}
+	if png != nil {
+		evt.Image = "data:image/png;base64," + base64.StdEncoding.EncodeToString(png)
+	}
+	b.wsMu.Lock()
+	b.pairing.qr = &evt
+	b.wsMu.Unlock()
+	b.broadcastPairing(evt)
+}
+
+// qrChannelEvent turns the QR channel's closing events into states.
+func (b *WhatsAppBridge) qrChannelEvent(evt whatsmeow.QRChannelItem) {
+	switch {
+	case evt == whatsmeow.QRChannelSuccess:
+		b.setPairingState(pairing.StatePaired, "")
+	case evt == whatsmeow.QRChannelTimeout:
+		b.setPairingState(pairing.StateTimeout, "")
+	case evt.Error != nil:
+		b.setPairingState(pairing.StateError, evt.Error.Error())
+	default:
+		b.setPairingState(pairing.StateError, evt.Event)
+	}
+}
+
+func (b *WhatsAppBridge) broadcastAuthenticated() {
+	b.setPairingState(pairing.StateAuthenticated, "")
+	b.broadcastPairing(pairing.Event{Type: pairing.EventAuthenticated, JID: b.ownJID()})
+}
+
+// handleWebSocket serves /ws, the pairing feed described in the pairing
+// package: the current state and code first, then every change. Clients
+// may also subscribe to events (see ws_events.go).
+func (b *WhatsAppBridge) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	// /ws is public; credentials are only checked when subscribing.
+	var operator string
+	if b.auth.Enabled() {
+		apiKey := r.Header.Get("X-API-Key")
+		if apiKey == "" {
+			apiKey = r.URL.Query().Get("access_token")
+		}
+		operator, _ = b.auth.authenticateCredentials(apiKey, r.Header.Get("Authorization"))
+	}
+	conn, err := b.wsUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("WebSocket upgrade error: %v", err)
+		return
+	}
+	client := &wsClient{
+		conn:     conn,
+		operator: operator,
+		events:   make(chan BridgeEvent, envInt("WS_EVENT_BUFFER", 256)),
+		done:     make(chan struct{}),
+	}
+
+	b.wsMu.Lock()
+	state := b.pairing.state
+	if state.Type == "" {
+		state = pairing.Event{Type: pairing.EventState, State: pairing.StateStarting}
+		if b.authenticated {
+			state.State = pairing.StateAuthenticated
+		}
+	}
+	catchUp := []pairing.Event{state}
+	if b.pairing.qr != nil {
+		catchUp = append(catchUp, *b.pairing.qr)
+	}
+	if b.pairing.pairCode != nil {
+		catchUp = append(catchUp, *b.pairing.pairCode)
+	}
+	b.wsClients[client] = true
+	bufferMarks.observe("ws_clients", "", int64(len(b.wsClients)))
+	// Broadcasts from now on wait for the catch-up, which is written
+	// without holding up everyone else behind wsMu.
+	client.writeMu.Lock()
+	b.wsMu.Unlock()
+	for _, evt := range catchUp {
+		if err := client.writeLocked(evt); err != nil {
+			break // the read loop notices and cleans up
+		}
+	}
+	client.writeMu.Unlock()
+
+	go b.writeWSEvents(client)
+	go func() {
+		defer close(client.done)
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				b.wsMu.Lock()
+				delete(b.wsClients, client)
+				b.wsMu.Unlock()
+				conn.Close()
+				return
+			}
+			b.handleWSControl(client, data)
+		}
+	}()
+}
+
+// handlePairCode serves POST /pair/code {"phone": "..."}: it links the
+// account by phone number instead of QR, returning the code to enter on
+// the phone and sending it to websocket clients. It only works while the
+// bridge is waiting to be paired.
+func (b *WhatsAppBridge) handlePairCode(w http.ResponseWriter, r *http.Request) {
+	var req pairing.PairCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, Response{Success: false, Error: "invalid request body"})
+		return
+	}
+	phone, err := normalizePhone(req.Phone)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, Response{Success: false, Error: err.Error()})
+		return
+	}
+	if b.client.Device().ID != nil {
+		writeJSON(w, http.StatusConflict, Response{Success: false, Error: "already paired"})
+		return
+	}
+	if !b.client.IsConnected() {
+		writeJSON(w, http.StatusServiceUnavailable, Response{Success: false, Error: "not connected to WhatsApp yet"})
+		return
+	}
+	code, err := b.client.PairPhone(r.Context(), phone, true, whatsmeow.PairClientChrome,
+		envString("PAIR_CLIENT_DISPLAY_NAME", "Chrome (Linux)"))
+	if err != nil {
+		writeJSON(w, http.StatusBadGateway, Response{Success: false, Error: err.Error()})
+		return
+	}
+	log.Printf("🔢 Pairing code requested for %s", phone)
+
+	b.setPairingState(pairing.StateWaitingScan, "")
+	evt := pairing.Event{Type: pairing.EventPairCode, Data: code, Phone: phone}
+	b.wsMu.Lock()
+	b.pairing.pairCode = &evt
+	b.wsMu.Unlock()
+	b.broadcastPairing(evt)
+	writeJSON(w, http.StatusOK, Response{Success: true, Data: evt})
+}
@@ -0,0 +1,118 @@
+package bridge
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+// errNotOnWhatsApp rejects sends to numbers without a WhatsApp account,
+// which WhatsApp would otherwise accept and silently drop.
+var errNotOnWhatsApp = fmt.Errorf("%w: recipient is not on WhatsApp", errPermanent)
+
+// normalizePhone reduces a phone number to the digits of its international
+// form: "+", spaces, dashes, dots and parentheses are stripped, as is a
+// "00" international prefix. A number with a national trunk prefix
+// ("0612 345 678") gets its leading zeros replaced by DEFAULT_COUNTRY_CODE;
+// without one configured such numbers are rejected, as are numbers outside
+// E.164's 7 to 15 digits.
+func normalizePhone(raw string) (string, error) {
+	international := strings.HasPrefix(strings.TrimSpace(raw), "+")
+	var digits strings.Builder
+	for _, r := range raw {
+		switch {
+		case r >= '0' && r <= '9':
+			digits.WriteRune(r)
+		case strings.ContainsRune("+ -.()\t", r):
+		default:
+			return "", fmt.Errorf("invalid phone number %q", raw)
+		}
+	}
+	phone := digits.String()
+
+	if !international {
+		if rest, ok := strings.CutPrefix(phone, "00"); ok {
+			phone = rest
+		} else if strings.HasPrefix(phone, "0") {
+			countryCode := strings.TrimLeft(envString("DEFAULT_COUNTRY_CODE", ""), "+")
+			if countryCode == "" {
+				return "", fmt.Errorf("phone number %q has no country code; use the international format or set DEFAULT_COUNTRY_CODE", raw)
+			}
+			phone = countryCode + strings.TrimLeft(phone, "0")
+		}
+	}
+	phone = strings.TrimLeft(phone, "0")
+
+	if len(phone) < 7 || len(phone) > 15 {
+		return "", fmt.Errorf("invalid phone number %q: expected 7 to 15 digits with the country code", raw)
+	}
+	return phone, nil
+}
+
+func onWhatsAppKey(phone string) string { return "whatsapp:onwhatsapp:" + phone }
+
+// RecipientVerification configures verifyRecipient.
+type RecipientVerification struct {
+	Enabled bool
+	TTL     time.Duration
+}
+
+func recipientVerificationFromEnv() RecipientVerification {
+	return RecipientVerification{
+		Enabled: envBool("VERIFY_RECIPIENTS", true),
+		TTL:     envDuration("VERIFY_RECIPIENTS_TTL", 24*time.Hour),
+	}
+}
+
+// verifyRecipient checks that a phone-number recipient has a WhatsApp
+// account and returns its canonical JID, which may differ from the number
+// given (e.g. Brazilian mobiles registered before the extra 9 digit).
+// Results are cached for VERIFY_RECIPIENTS_TTL (default 24h) to keep the
+// lookups, which WhatsApp rate limits, rare. Groups, LIDs and other chats
+// are returned as is, and lookup failures let the send proceed unverified.
+// Disabled with VERIFY_RECIPIENTS=false.
+func (b *WhatsAppBridge) verifyRecipient(ctx context.Context, jid types.JID) (types.JID, error) {
+	if jid.Server != types.DefaultUserServer || !b.verification.Enabled {
+		return jid, nil
+	}
+
+	key := onWhatsAppKey(jid.User)
+	if cached, err := b.redisClient.Get(ctx, key).Result(); err == nil {
+		if cached == "" {
+			return jid, fmt.Errorf("%w: +%s", errNotOnWhatsApp, jid.User)
+		}
+		if canonical, err := types.ParseJID(cached); err == nil {
+			return canonical, nil
+		}
+	}
+
+	if !b.client.IsConnected() {
+		return jid, nil
+	}
+	lookupCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	results, err := b.client.IsOnWhatsApp(lookupCtx, []string{"+" + jid.User})
+	if err != nil || len(results) == 0 {
+		log.Printf("⚠️ Could not verify +%s is on WhatsApp, sending anyway: %v", jid.User, err)
+		return jid, nil
+	}
+
+	ttl := b.verification.TTL
+	if !results[0].IsIn {
+		b.redisClient.Set(ctx, key, "", ttl)
+		return jid, fmt.Errorf("%w: +%s", errNotOnWhatsApp, jid.User)
+	}
+	canonical := results[0].JID.ToNonAD()
+	if canonical.IsEmpty() {
+		canonical = jid
+	}
+	b.redisClient.Set(ctx, key, canonical.String(), ttl)
+	if canonical != jid {
+		log.Printf("+%s is registered on WhatsApp as %s", jid.User, canonical)
+	}
+	return canonical, nil
+}
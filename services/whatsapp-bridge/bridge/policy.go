@@ -0,0 +1,186 @@
+package bridge
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+// POST /policy/evaluate runs a hypothetical outbound message through the
+// checks a send goes through, without sending it or using up any quota, so
+// campaign tooling can pre-validate an audience. The body is a /send
+// message plus optional tags, echoed back to match results to audience
+// segments. Each check reports whether it applies and would let the
+// message through:
+//
+//	recipient - the number is on WhatsApp (VERIFY_RECIPIENTS); the lookup is
+//	            cached as for sends
+//	consent   - CONSENT_REQUIRED
+//	country     - the recipient's country profile: allowed hours, template
+//	              requirement and rate
+//	send_window - the request's send_window, as a campaign would apply it
+//	              to the recipient; only when one is given
+//	rate        - the pacer's chat and global rates
+//	content     - the template renders; parts is how many messages the text
+//	              would be split into, variant the template variant it
+//	              would be sent in
+//	maintenance - informational, never rejects: during a maintenance window
+//	              the message is sent, but replies are not published
+//
+// The recipient, consent and country checks are the ones sendOutgoing runs
+// (see sendChecks). Rates only reject API sends queued past
+// RATE_LIMIT_MAX_WAIT; below it, wait_seconds is how long the send would be
+// paced.
+
+// Policies reported by POST /policy/evaluate.
+const (
+	PolicyRecipient   = "recipient"
+	PolicyConsent     = "consent"
+	PolicyCountry     = "country"
+	PolicySendWindow  = "send_window"
+	PolicyRate        = "rate"
+	PolicyContent     = "content"
+	PolicyMaintenance = "maintenance"
+)
+
+// PolicyEvaluationRequest is the body of POST /policy/evaluate.
+type PolicyEvaluationRequest struct {
+	OutgoingMessage
+	SendWindow *SendWindow `json:"send_window,omitempty"`
+	Tags       []string    `json:"tags,omitempty"`
+}
+
+// PolicyEvaluation is the response of POST /policy/evaluate. Allowed is
+// set when every check passes.
+type PolicyEvaluation struct {
+	Allowed   bool          `json:"allowed"`
+	Recipient string        `json:"recipient"` // canonical JID
+	Priority  string        `json:"priority"`
+	Tags      []string      `json:"tags,omitempty"`
+	Checks    []PolicyCheck `json:"checks"`
+}
+
+// PolicyCheck is the outcome of one policy.
+type PolicyCheck struct {
+	Policy      string           `json:"policy"`
+	Applies     bool             `json:"applies"`
+	Allowed     bool             `json:"allowed"`
+	Reason      string           `json:"reason,omitempty"`
+	Profile     string           `json:"profile,omitempty"`      // country profile name
+	WaitSeconds float64          `json:"wait_seconds,omitempty"` // pacing before the send
+	RetryAt     int64            `json:"retry_at,omitempty"`     // when a rejected send may be retried
+	Quota       []RateLimitQuota `json:"quota,omitempty"`
+	Parts       int              `json:"parts,omitempty"`
+	Variant     string           `json:"variant,omitempty"` // template variant the recipient would get
+}
+
+// reject marks the check failed with err, taking the retry time of rate
+// limits.
+func (c *PolicyCheck) reject(err error) {
+	c.Allowed = false
+	c.Reason = err.Error()
+	var limited *RateLimitError
+	if errors.As(err, &limited) {
+		c.RetryAt = limited.RetryAt.Unix()
+	}
+}
+
+// pace records a wait for a rate and returns the error an API send would
+// get for it, waiting past maxWait.
+func (c *PolicyCheck) pace(scope string, chat types.JID, wait, maxWait time.Duration) error {
+	c.WaitSeconds = math.Ceil(wait.Seconds()*1000) / 1000
+	if maxWait > 0 && wait > maxWait {
+		return &RateLimitError{Scope: scope, Chat: chat.String(), RetryAfter: wait, RetryAt: time.Now().Add(wait), Quota: c.Quota}
+	}
+	return nil
+}
+
+// evaluatePolicies runs the checks of sendOutgoing on msg. It fails only
+// when the request's send window is invalid.
+func (b *WhatsAppBridge) evaluatePolicies(ctx context.Context, req PolicyEvaluationRequest) (*PolicyEvaluation, error) {
+	window, err := req.SendWindow.parse()
+	if err != nil {
+		return nil, err
+	}
+	msg := req.OutgoingMessage
+	jid, _ := msg.recipient()
+	eval := &PolicyEvaluation{Tags: req.Tags}
+	ctx, canonical, _ := b.sendChecks(ctx, jid, msg, eval)
+	eval.Recipient = canonical.String()
+	eval.Priority = priorityFromContext(ctx)
+
+	if window != nil {
+		check := PolicyCheck{Policy: PolicySendWindow, Applies: true, Allowed: true}
+		now := time.Now()
+		loc := window.locationFor(BulkRecipient{Phone: canonical.User}, b.location)
+		if wait := window.opensIn(loc, now); wait > 0 {
+			check.reject(&RateLimitError{Scope: "send_window", Chat: canonical.String(), RetryAfter: wait, RetryAt: now.Add(wait)})
+		}
+		eval.Checks = append(eval.Checks, check)
+	}
+
+	rate := PolicyCheck{Policy: PolicyRate, Allowed: true, Applies: b.pacer != nil}
+	var maxWait time.Duration
+	if b.pacer != nil {
+		maxWait = b.pacer.maxWait
+	}
+	wait, scope, quota := b.pacer.peek(canonical)
+	rate.Quota = quota
+	if err := rate.pace(scope, canonical, wait, maxWait); err != nil {
+		rate.reject(err)
+	}
+
+	content := PolicyCheck{Policy: PolicyContent, Applies: true, Allowed: true}
+	text, media := msg.Message, msg.MediaURL != ""
+	if msg.Template != "" {
+		if rendered, err := b.renderTemplate(msg.Template, canonical.String(), msg.Params); err != nil {
+			content.reject(err)
+		} else {
+			text, media = rendered.Text, media || rendered.Header != nil
+			content.Variant = rendered.Variant
+		}
+	}
+	if content.Allowed {
+		content.Parts = 1
+		if !media {
+			content.Parts = len(b.splitter.Split(text))
+		}
+	}
+
+	maintenance := PolicyCheck{Policy: PolicyMaintenance, Allowed: true}
+	if m := b.inMaintenance(); m != nil {
+		maintenance.Applies = true
+		maintenance.Reason = "in maintenance until " + time.Unix(m.EndsAt, 0).In(b.location).Format(time.RFC3339) + ": replies will not be published"
+	}
+
+	eval.Checks = append(eval.Checks, rate, content, maintenance)
+	eval.Allowed = true
+	for _, check := range eval.Checks {
+		eval.Allowed = eval.Allowed && check.Allowed
+	}
+	return eval, nil
+}
+
+// handleEvaluatePolicy serves POST /policy/evaluate.
+func (b *WhatsAppBridge) handleEvaluatePolicy(w http.ResponseWriter, r *http.Request) {
+	var req PolicyEvaluationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, Response{Success: false, Error: err.Error()})
+		return
+	}
+	if err := req.Validate(); err != nil {
+		writeJSON(w, http.StatusBadRequest, Response{Success: false, Error: err.Error()})
+		return
+	}
+	eval, err := b.evaluatePolicies(r.Context(), req)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, Response{Success: false, Error: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, Response{Success: true, Data: eval})
+}
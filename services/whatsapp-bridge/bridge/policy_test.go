@@ -0,0 +1,105 @@
+package bridge_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/phenobarbital/ai-parrot/whatsapp-bridge/bridge"
+	"github.com/phenobarbital/ai-parrot/whatsapp-bridge/bridgetest"
+)
+
+// evaluate runs req through POST /policy/evaluate.
+func evaluate(t *testing.T, h *bridgetest.Harness, req bridge.PolicyEvaluationRequest) *bridge.PolicyEvaluation {
+	t.Helper()
+	status, resp := h.Do(http.MethodPost, "/policy/evaluate", req)
+	if status != http.StatusOK {
+		t.Fatalf("POST /policy/evaluate = %d %s", status, resp.Error)
+	}
+	var eval bridge.PolicyEvaluation
+	decodeData(t, resp.Data, &eval)
+	return &eval
+}
+
+// policyCheck returns the check of policy in eval, failing when it is absent.
+func policyCheck(t *testing.T, eval *bridge.PolicyEvaluation, policy string) bridge.PolicyCheck {
+	t.Helper()
+	for _, check := range eval.Checks {
+		if check.Policy == policy {
+			return check
+		}
+	}
+	t.Fatalf("no %s check in %+v", policy, eval.Checks)
+	return bridge.PolicyCheck{}
+}
+
+func TestEvaluateCountryRateUsesPacerMaxWait(t *testing.T) {
+	// A token every 15s is over the default 10s wait.
+	h := bridgetest.New(t,
+		bridgetest.WithEnv("COUNTRY_POLICIES", `[{"name": "mexico", "country_codes": ["52"], "per_minute": 4, "burst": 1}]`),
+		bridgetest.WithEnv("RATE_LIMIT_CHAT_PER_MINUTE", "0"),
+		bridgetest.WithEnv("RATE_LIMIT_GLOBAL_PER_MINUTE", "0"),
+	)
+	h.Send(bridge.OutgoingMessage{Phone: "5215512345678", Message: "first"})
+
+	eval := evaluate(t, h, bridge.PolicyEvaluationRequest{
+		OutgoingMessage: bridge.OutgoingMessage{Phone: "5215587654321", Message: "second"},
+	})
+	if country := policyCheck(t, eval, bridge.PolicyCountry); country.Allowed || country.RetryAt == 0 {
+		t.Errorf("country check = %+v, want rejected with a retry time", country)
+	}
+	if eval.Allowed {
+		t.Error("evaluation allowed a send /send would reject")
+	}
+	// Evaluating takes no token: the send is still rejected the same way.
+	if status, _ := h.Do(http.MethodPost, "/send", bridge.OutgoingMessage{Phone: "5215587654321", Message: "second"}); status != http.StatusTooManyRequests {
+		t.Errorf("send after evaluating answered %d, want 429", status)
+	}
+}
+
+func TestEvaluateSendWindow(t *testing.T) {
+	h := bridgetest.New(t)
+	now := time.Now().UTC()
+	closed := &bridge.SendWindow{
+		Start:    now.Add(2 * time.Hour).Format("15:04"),
+		End:      now.Add(3 * time.Hour).Format("15:04"),
+		Timezone: "UTC",
+	}
+	eval := evaluate(t, h, bridge.PolicyEvaluationRequest{
+		OutgoingMessage: bridge.OutgoingMessage{Phone: "5215512345678", Message: "hello"},
+		SendWindow:      closed,
+	})
+	if check := policyCheck(t, eval, bridge.PolicySendWindow); check.Allowed || check.RetryAt == 0 {
+		t.Errorf("send_window check = %+v, want rejected with a retry time", check)
+	}
+	if eval.Allowed {
+		t.Error("evaluation allowed a send outside its send window")
+	}
+
+	status, _ := h.Do(http.MethodPost, "/policy/evaluate", bridge.PolicyEvaluationRequest{
+		OutgoingMessage: bridge.OutgoingMessage{Phone: "5215512345678", Message: "hello"},
+		SendWindow:      &bridge.SendWindow{Start: "9am", End: "17:00"},
+	})
+	if status != http.StatusBadRequest {
+		t.Errorf("invalid send_window answered %d, want 400", status)
+	}
+}
+
+func TestEvaluateReportsMaintenance(t *testing.T) {
+	h := bridgetest.New(t)
+	req := bridge.PolicyEvaluationRequest{
+		OutgoingMessage: bridge.OutgoingMessage{Phone: "5215512345678", Message: "hello"},
+	}
+	if check := policyCheck(t, evaluate(t, h, req), bridge.PolicyMaintenance); check.Applies {
+		t.Errorf("maintenance check outside a window = %+v", check)
+	}
+
+	startMaintenance(t, h)
+	eval := evaluate(t, h, req)
+	if check := policyCheck(t, eval, bridge.PolicyMaintenance); !check.Applies || !check.Allowed || check.Reason == "" {
+		t.Errorf("maintenance check during a window = %+v, want applying, allowed and explained", check)
+	}
+	if !eval.Allowed {
+		t.Errorf("maintenance rejected the evaluation: %+v", eval.Checks)
+	}
+}
@@ -0,0 +1,158 @@
+package bridge
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// EventPollVote is published when a participant votes on a poll we created.
+const EventPollVote = "poll_vote"
+
+// PollMessage is the payload accepted by the /send/poll endpoint.
+type PollMessage struct {
+	Phone       string   `json:"phone"`
+	Server      string   `json:"server,omitempty"`
+	ChatType    string   `json:"chat_type,omitempty"`
+	Question    string   `json:"question"`
+	Options     []string `json:"options"`
+	MultiSelect bool     `json:"multi_select,omitempty"`
+}
+
+// PollVote is published for each decrypted vote. An empty selection means
+// the voter retracted their vote.
+type PollVote struct {
+	PollMessageID   string   `json:"poll_message_id"`
+	Question        string   `json:"question,omitempty"`
+	Chat            string   `json:"chat"`
+	Voter           string   `json:"voter"`
+	VoterName       string   `json:"voter_name,omitempty"`
+	SelectedOptions []string `json:"selected_options"`
+	SelectedIndices []int    `json:"selected_indices"`
+	MessageID       string   `json:"message_id"`
+	Timestamp       int64    `json:"timestamp"`
+	TimestampISO    string   `json:"timestamp_iso"`
+}
+
+// pollRecord is cached in Redis so votes (which only carry option hashes) can
+// be mapped back to option names and indices.
+type pollRecord struct {
+	Question string   `json:"question"`
+	Options  []string `json:"options"`
+}
+
+func pollKey(messageID string) string {
+	return "whatsapp:poll:" + messageID
+}
+
+func (b *WhatsAppBridge) handleSendPoll(w http.ResponseWriter, r *http.Request) {
+	var msg PollMessage
+	if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+		writeJSON(w, http.StatusBadRequest, Response{Success: false, Error: err.Error()})
+		return
+	}
+
+	if msg.Phone == "" || msg.Question == "" || len(msg.Options) < 2 {
+		writeJSON(w, http.StatusBadRequest, Response{Success: false, Error: "phone, question and at least two options are required"})
+		return
+	}
+	if len(msg.Options) > 12 {
+		writeJSON(w, http.StatusBadRequest, Response{Success: false, Error: "polls support at most 12 options"})
+		return
+	}
+	jid, err := resolveRecipient(msg.Phone, msg.Server, msg.ChatType)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, Response{Success: false, Error: err.Error()})
+		return
+	}
+	ctx, jid, err := b.checkSend(context.WithoutCancel(r.Context()), jid, OutgoingMessage{})
+	if err != nil {
+		b.writeSendError(w, err, SendResult{})
+		return
+	}
+
+	// 0 lets voters pick any number of options.
+	selectable := 1
+	if msg.MultiSelect {
+		selectable = 0
+	}
+
+	log.Printf("Sending poll to %s: %s", jid.User, msg.Question)
+
+	poll := b.client.BuildPollCreation(msg.Question, msg.Options, selectable)
+	resp, err := b.deliver(ctx, jid, poll, len([]rune(msg.Question)))
+	if err != nil {
+		log.Printf("Error sending poll to %s: %v", jid.User, err)
+		b.reportSendFailure(err, jid, "poll")
+		b.writeSendError(w, err, SendResult{})
+		return
+	}
+
+	record, _ := json.Marshal(pollRecord{Question: msg.Question, Options: msg.Options})
+	if err := b.redisClient.Set(b.ctx, pollKey(resp.ID), record, envDuration("POLL_TTL", 30*24*time.Hour)).Err(); err != nil {
+		log.Printf("Error caching poll %s: %v", resp.ID, err)
+	}
+
+	log.Printf("Poll sent to %s, ID: %s", jid.User, resp.ID)
+	b.archiveOutgoing(r.Context(), jid.String(), resp.ID, "poll", msg.Question, resp.Timestamp)
+	data := b.timestampFields(resp.Timestamp)
+	data["message_id"] = resp.ID
+	writeJSON(w, http.StatusOK, Response{Success: true, Data: data})
+}
+
+// handlePollVote decrypts a PollUpdateMessage and publishes the selection,
+// unless held for maintenance.
+func (b *WhatsAppBridge) handlePollVote(msg *events.Message, held bool) {
+	update := msg.Message.GetPollUpdateMessage()
+	pollID := update.GetPollCreationMessageKey().GetID()
+	if held {
+		log.Printf("🚧 Maintenance: not publishing poll vote %s from %s", msg.Info.ID, msg.Info.Sender.User)
+		return
+	}
+
+	vote, err := b.client.DecryptPollVote(b.ctx, msg)
+	if err != nil {
+		log.Printf("Error decrypting poll vote for %s: %v", pollID, err)
+		return
+	}
+
+	event := PollVote{
+		PollMessageID:   pollID,
+		Chat:            msg.Info.Chat.String(),
+		Voter:           msg.Info.Sender.User,
+		VoterName:       msg.Info.PushName,
+		SelectedOptions: []string{},
+		SelectedIndices: []int{},
+		MessageID:       msg.Info.ID,
+		Timestamp:       msg.Info.Timestamp.Unix(),
+		TimestampISO:    b.formatTime(msg.Info.Timestamp),
+	}
+
+	var poll pollRecord
+	if data, err := b.redisClient.Get(b.ctx, pollKey(pollID)).Bytes(); err == nil {
+		json.Unmarshal(data, &poll)
+	} else {
+		log.Printf("⚠️ Vote for unknown poll %s, options cannot be resolved", pollID)
+	}
+	event.Question = poll.Question
+
+	for _, selected := range vote.GetSelectedOptions() {
+		for i, option := range poll.Options {
+			hash := sha256.Sum256([]byte(option))
+			if bytes.Equal(hash[:], selected) {
+				event.SelectedOptions = append(event.SelectedOptions, option)
+				event.SelectedIndices = append(event.SelectedIndices, i)
+				break
+			}
+		}
+	}
+
+	log.Printf("🗳️ Poll vote from %s on %s: %v", event.Voter, pollID, event.SelectedOptions)
+	b.publish(EventPollVote, event.Chat, event)
+}
@@ -0,0 +1,138 @@
+package bridge
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// Every send, whichever endpoint or queue it comes from, goes through the
+// same steps: checkSend verifies the recipient is on WhatsApp
+// (VERIFY_RECIPIENTS), applies CONSENT_REQUIRED and the recipient's country
+// policy, and picks the send's priority; deliver then paces the message and
+// sends it in a send slot of that priority. Re-sends after reconnect take
+// the same steps again.
+
+// checkSend runs the pre-send checks of msg to jid. It returns ctx carrying
+// the send's priority and the canonical recipient, which may differ from
+// jid (see verifyRecipient).
+func (b *WhatsAppBridge) checkSend(ctx context.Context, jid types.JID, msg OutgoingMessage) (context.Context, types.JID, error) {
+	return b.sendChecks(ctx, jid, msg, nil)
+}
+
+// sendChecks runs the pre-send checks, stopping at the first that fails.
+// With eval it is a dry run for POST /policy/evaluate instead: every check
+// runs and is added to eval.Checks, and the country rate is only looked at,
+// neither waited for nor used up.
+func (b *WhatsAppBridge) sendChecks(ctx context.Context, jid types.JID, msg OutgoingMessage, eval *PolicyEvaluation) (context.Context, types.JID, error) {
+	dryRun := eval != nil
+	// done records check and reports whether the send stops there.
+	done := func(check PolicyCheck) bool {
+		if dryRun {
+			eval.Checks = append(eval.Checks, check)
+		}
+		return !dryRun && !check.Allowed
+	}
+
+	recipient := PolicyCheck{Policy: PolicyRecipient, Allowed: true,
+		Applies: jid.Server == types.DefaultUserServer && b.verification.Enabled}
+	canonical, err := b.verifyRecipient(ctx, jid)
+	if err != nil {
+		recipient.reject(err)
+	}
+	if done(recipient) {
+		return ctx, jid, err
+	}
+
+	consent := PolicyCheck{Policy: PolicyConsent, Allowed: true,
+		Applies: b.consent.required && !msg.ConsentOverride &&
+			(canonical.Server == types.DefaultUserServer || canonical.Server == types.HiddenUserServer)}
+	if err = b.checkConsent(canonical, msg.ConsentOverride); err != nil {
+		consent.reject(err)
+	}
+	if done(consent) {
+		return ctx, canonical, err
+	}
+
+	country := PolicyCheck{Policy: PolicyCountry, Allowed: true}
+	if profile := b.countryPolicies.profileFor(canonical); profile != nil {
+		country.Applies, country.Profile = true, profile.Name
+		if err = b.countryRules(profile, canonical, msg, time.Now()); err != nil {
+			if !dryRun {
+				log.Printf("🌍 Rejecting message to %s under country policy %s: %v", canonical, profile.Name, err)
+			}
+		} else if dryRun {
+			if wait, quota := b.countryPolicies.peek(profile); quota != nil {
+				country.Quota = []RateLimitQuota{*quota}
+				err = country.pace("country", canonical, wait, b.countryPolicies.maxWait)
+			}
+		} else {
+			err = b.countryPolicies.wait(ctx, profile, canonical)
+		}
+		if err != nil {
+			country.reject(err)
+		}
+	}
+	if done(country) {
+		return ctx, canonical, err
+	}
+	return withPriority(ctx, b.sendPriority(ctx, canonical, msg)), canonical, nil
+}
+
+// deliver waits for the pacer to admit a message of textLen characters to
+// jid, then sends it holding a send slot.
+func (b *WhatsAppBridge) deliver(ctx context.Context, jid types.JID, content *waE2E.Message, textLen int, extra ...whatsmeow.SendRequestExtra) (whatsmeow.SendResponse, error) {
+	if err := b.pacer.Wait(ctx, jid, textLen); err != nil {
+		return whatsmeow.SendResponse{}, err
+	}
+	release, err := b.sendSlots.acquire(ctx)
+	if err != nil {
+		return whatsmeow.SendResponse{}, err
+	}
+	defer release()
+	return b.client.SendMessage(ctx, jid, content, extra...)
+}
+
+// sendErrorStatus maps a failed send to its HTTP status.
+func sendErrorStatus(err error) int {
+	switch {
+	case isPartialSend(err):
+		// Failed midway for a reason of its own; the status is the cause's.
+		return http.StatusInternalServerError
+	case errors.Is(err, errNoConsent), errors.Is(err, errTemplateRequired):
+		return http.StatusForbidden
+	case errors.Is(err, errNotOnWhatsApp):
+		return http.StatusNotFound
+	case errors.Is(err, errPermanent):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// writeSendError answers a failed send: 429 with Retry-After when it was
+// rate limited, else the status of sendErrorStatus. result identifies what
+// was sent, if anything, so the caller can follow up on
+// GET /messages/{id}/status. A message that was partly sent is reported as
+// such whatever stopped it, since retrying it would repeat the sent parts.
+func (b *WhatsAppBridge) writeSendError(w http.ResponseWriter, err error, result SendResult) {
+	var limited *RateLimitError
+	if errors.As(err, &limited) && !isPartialSend(err) {
+		b.writeRateLimited(w, limited, result.ID)
+		return
+	}
+	failure := Response{Success: false, Error: err.Error()}
+	if result.ID != "" {
+		data := map[string]interface{}{"message_id": result.ID}
+		if len(result.PartIDs) > 0 {
+			data["part_ids"] = result.PartIDs
+		}
+		failure.Data = data
+	}
+	writeJSON(w, sendErrorStatus(err), failure)
+}
@@ -0,0 +1,172 @@
+package bridge
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+// Send priorities keep bulk traffic from delaying live conversations:
+//
+//	realtime      - replies to a chat awaiting one
+//	transactional - other API and queue sends (the default)
+//	campaign      - bulk campaign sends
+//
+// Sends take one of SEND_CONCURRENCY (default 4; 0 disables the limit)
+// slots for the WhatsApp round-trip, and freed slots go to the highest
+// priority waiting, so a reply waits for at most one in-flight send.
+// Campaign sends also yield to the others in the pacer: they wait for a
+// free token instead of reserving one ahead of everyone else.
+//
+// A message's Priority field sets its class, though never above the class
+// it is sent under: a campaign's messages stay campaign sends. Otherwise
+// campaign sends are campaign, sends to a chat whose conversation state is
+// awaiting a reply are realtime and everything else is transactional.
+const (
+	PriorityRealtime      = "realtime"
+	PriorityTransactional = "transactional"
+	PriorityCampaign      = "campaign"
+)
+
+// priorityRank orders the classes, most urgent first.
+var priorityRank = map[string]int{
+	PriorityRealtime:      0,
+	PriorityTransactional: 1,
+	PriorityCampaign:      2,
+}
+
+func validPriority(priority string) error {
+	if _, ok := priorityRank[priority]; !ok && priority != "" {
+		return fmt.Errorf("unknown priority %q (want realtime, transactional or campaign)", priority)
+	}
+	return nil
+}
+
+type priorityKey struct{}
+
+func withPriority(ctx context.Context, priority string) context.Context {
+	return context.WithValue(ctx, priorityKey{}, priority)
+}
+
+// priorityFromContext returns the priority of sends on ctx.
+func priorityFromContext(ctx context.Context) string {
+	if priority, ok := ctx.Value(priorityKey{}).(string); ok {
+		return priority
+	}
+	return PriorityTransactional
+}
+
+// sendPriority picks the class of msg to chat.
+func (b *WhatsAppBridge) sendPriority(ctx context.Context, chat types.JID, msg OutgoingMessage) string {
+	priority, capped := ctx.Value(priorityKey{}).(string)
+	if msg.Priority != "" {
+		if capped && priorityRank[msg.Priority] < priorityRank[priority] {
+			return priority
+		}
+		return msg.Priority
+	}
+	if capped {
+		return priority
+	}
+	if state, err := b.archiveDB.ConversationState(chat.String()); err == nil && state != nil && state.AwaitingReply {
+		return PriorityRealtime
+	}
+	return PriorityTransactional
+}
+
+// sendSlots hands out the send slots, highest priority first and in
+// arrival order within a priority. A nil sendSlots never blocks.
+type sendSlots struct {
+	mu      sync.Mutex
+	free    int
+	waiting [3][]chan struct{} // by priority rank
+}
+
+func sendSlotsFromEnv() *sendSlots {
+	n := envInt("SEND_CONCURRENCY", 4)
+	if n <= 0 {
+		return nil
+	}
+	return &sendSlots{free: n}
+}
+
+// acquire waits for a slot for a send of the priority on ctx and returns
+// the function that frees it.
+func (s *sendSlots) acquire(ctx context.Context) (func(), error) {
+	if s == nil {
+		return func() {}, nil
+	}
+	rank := priorityRank[priorityFromContext(ctx)]
+	s.mu.Lock()
+	if s.free > 0 && !s.queuedAhead(rank) {
+		s.free--
+		s.mu.Unlock()
+		return s.release, nil
+	}
+	granted := make(chan struct{})
+	s.waiting[rank] = append(s.waiting[rank], granted)
+	bufferMarks.observe("send_slots", "", int64(s.waitingLocked()))
+	s.mu.Unlock()
+
+	select {
+	case <-granted:
+		return s.release, nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		for i, ch := range s.waiting[rank] {
+			if ch == granted {
+				s.waiting[rank] = append(s.waiting[rank][:i], s.waiting[rank][i+1:]...)
+				return nil, ctx.Err()
+			}
+		}
+		// Granted as we gave up: pass the slot on.
+		s.releaseLocked()
+		return nil, ctx.Err()
+	}
+}
+
+// queuedAhead reports whether sends of the rank or a more urgent one wait.
+func (s *sendSlots) queuedAhead(rank int) bool {
+	for r := 0; r <= rank; r++ {
+		if len(s.waiting[r]) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// waitingCount returns the number of sends waiting for a slot.
+func (s *sendSlots) waitingCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.waitingLocked()
+}
+
+func (s *sendSlots) waitingLocked() int {
+	n := 0
+	for _, waiting := range s.waiting {
+		n += len(waiting)
+	}
+	return n
+}
+
+func (s *sendSlots) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.releaseLocked()
+}
+
+func (s *sendSlots) releaseLocked() {
+	for r := range s.waiting {
+		if len(s.waiting[r]) > 0 {
+			next := s.waiting[r][0]
+			s.waiting[r] = s.waiting[r][1:]
+			close(next)
+			return
+		}
+	}
+	s.free++
+}
@@ -0,0 +1,29 @@
+package bridge
+
+import (
+	"context"
+	"testing"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+func TestSendPriorityCappedByContext(t *testing.T) {
+	b := &WhatsAppBridge{}
+	chat := types.NewJID("5215512345678", types.DefaultUserServer)
+	campaign := withPriority(context.Background(), PriorityCampaign)
+	for _, tc := range []struct {
+		ctx      context.Context
+		priority string
+		want     string
+	}{
+		{context.Background(), "", PriorityTransactional},
+		{context.Background(), PriorityRealtime, PriorityRealtime},
+		{campaign, "", PriorityCampaign},
+		{campaign, PriorityRealtime, PriorityCampaign},
+		{withPriority(context.Background(), PriorityTransactional), PriorityCampaign, PriorityCampaign},
+	} {
+		if got := b.sendPriority(tc.ctx, chat, OutgoingMessage{Priority: tc.priority}); got != tc.want {
+			t.Errorf("priority %q under %q = %q, want %q", tc.priority, priorityFromContext(tc.ctx), got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package bridge
+
+import (
+	"fmt"
+	"time"
+)
+
+// Payload profiles select the JSON schema a sink receives for message
+// events; other event types are always delivered unchanged.
+const (
+	ProfileDefault  = "default"  // IncomingMessage as-is
+	ProfileChatwoot = "chatwoot" // shaped like Chatwoot's message_created webhook
+	ProfileMinimal  = "minimal"  // just who, where, what and when
+)
+
+// payloadProfiles maps a profile name to its message transform.
+var payloadProfiles = map[string]func(IncomingMessage, string) interface{}{
+	ProfileDefault:  func(m IncomingMessage, _ string) interface{} { return m },
+	ProfileChatwoot: chatwootPayload,
+	ProfileMinimal:  minimalPayload,
+}
+
+// ChatwootMessage mirrors the fields of Chatwoot's message_created webhook
+// that consumers typically read.
+type ChatwootMessage struct {
+	Event        string               `json:"event"`
+	ID           string               `json:"id"`
+	SourceID     string               `json:"source_id"`
+	Content      string               `json:"content"`
+	ContentType  string               `json:"content_type"`
+	MessageType  string               `json:"message_type"`
+	Private      bool                 `json:"private"`
+	CreatedAt    string               `json:"created_at"`
+	Sender       ChatwootSender       `json:"sender"`
+	Conversation ChatwootConversation `json:"conversation"`
+	Attachments  []ChatwootAttachment `json:"attachments,omitempty"`
+}
+
+// ChatwootSender is the contact who sent the message.
+type ChatwootSender struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	PhoneNumber string `json:"phone_number"`
+	Identifier  string `json:"identifier"`
+	Type        string `json:"type"`
+}
+
+// ChatwootConversation identifies the conversation by its WhatsApp chat.
+type ChatwootConversation struct {
+	ContactInbox ChatwootContactInbox `json:"contact_inbox"`
+	Meta         map[string]string    `json:"meta,omitempty"`
+}
+
+// ChatwootContactInbox carries the channel-side conversation key.
+type ChatwootContactInbox struct {
+	SourceID string `json:"source_id"`
+}
+
+// ChatwootAttachment references inbound media.
+type ChatwootAttachment struct {
+	FileType string `json:"file_type"`
+	DataURL  string `json:"data_url"`
+}
+
+// MinimalMessage is the smallest useful message payload.
+type MinimalMessage struct {
+	ID        string `json:"id"`
+	From      string `json:"from"`
+	Chat      string `json:"chat"`
+	Type      string `json:"type"`
+	Text      string `json:"text"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+func chatwootPayload(m IncomingMessage, chat string) interface{} {
+	contentType := "text"
+	var attachments []ChatwootAttachment
+	if m.Media != "" {
+		contentType = "file"
+		url := m.Media
+		if m.MediaInfo != nil && m.MediaInfo.Data != "" {
+			url = "data:" + m.MediaInfo.MimeType + ";base64," + m.MediaInfo.Data
+		}
+		attachments = append(attachments, ChatwootAttachment{FileType: chatwootFileType(m.Type), DataURL: url})
+	}
+	senderID := m.ContactID
+	if senderID == "" {
+		senderID = m.From
+	}
+	payload := ChatwootMessage{
+		Event:       "message_created",
+		ID:          m.MessageID,
+		SourceID:    m.MessageID,
+		Content:     m.Content,
+		ContentType: contentType,
+		MessageType: "incoming",
+		CreatedAt:   time.Unix(m.Timestamp, 0).UTC().Format(time.RFC3339),
+		Sender: ChatwootSender{
+			ID:          senderID,
+			Name:        m.FromName,
+			PhoneNumber: "+" + m.From,
+			Identifier:  m.From + "@" + m.FromServer,
+			Type:        "contact",
+		},
+		Conversation: ChatwootConversation{ContactInbox: ChatwootContactInbox{SourceID: chat}},
+		Attachments:  attachments,
+	}
+	if m.IsGroup {
+		payload.Conversation.Meta = map[string]string{"group_name": m.GroupName}
+	}
+	return payload
+}
+
+// chatwootFileType maps bridge message types to Chatwoot attachment types.
+func chatwootFileType(msgType string) string {
+	switch msgType {
+	case "image", "audio", "video":
+		return msgType
+	}
+	return "file"
+}
+
+func minimalPayload(m IncomingMessage, chat string) interface{} {
+	return MinimalMessage{
+		ID:        m.MessageID,
+		From:      m.From,
+		Chat:      chat,
+		Type:      m.Type,
+		Text:      m.Content,
+		Timestamp: m.Timestamp,
+	}
+}
+
+// validateProfile rejects unknown profile names at startup.
+func validateProfile(profile string) error {
+	if _, ok := payloadProfiles[profile]; !ok {
+		return fmt.Errorf("unknown payload profile %q", profile)
+	}
+	return nil
+}
+
+// applyProfile reshapes message payloads for a sink's profile.
+func applyProfile(profile string, evt BridgeEvent) BridgeEvent {
+	if profile == "" || profile == ProfileDefault || evt.Type != EventMessage {
+		return evt
+	}
+	if msg, ok := evt.Payload.(IncomingMessage); ok {
+		evt.Payload = payloadProfiles[profile](msg, evt.Chat)
+	}
+	return evt
+}
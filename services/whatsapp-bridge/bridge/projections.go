@@ -0,0 +1,303 @@
+package bridge
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Read models behind the /dashboard endpoints. Store updates them in the
+// same transaction as the message itself, so they are never behind the
+// archive and dashboards read a handful of rows instead of aggregating the
+// messages table.
+
+// previewLength caps the last-message preview kept per chat, in characters.
+const previewLength = 200
+
+// ChatSummary is one row of GET /dashboard/chats. A chat whose last message
+// is inbound is waiting for a reply.
+type ChatSummary struct {
+	Chat           string `json:"chat"`
+	ContactID      string `json:"contact_id,omitempty"`
+	MessageCount   int64  `json:"message_count"`
+	InboundCount   int64  `json:"inbound_count"`
+	OutboundCount  int64  `json:"outbound_count"`
+	FirstMessageAt int64  `json:"first_message_at"`
+	LastMessageAt  int64  `json:"last_message_at"`
+	LastInboundAt  int64  `json:"last_inbound_at,omitempty"`
+	LastOutboundAt int64  `json:"last_outbound_at,omitempty"`
+	LastReadAt     int64  `json:"last_read_at,omitempty"` // latest read receipt for our messages
+	LastMessageID  string `json:"last_message_id"`
+	LastDirection  string `json:"last_direction"`
+	LastType       string `json:"last_type"`
+	LastPreview    string `json:"last_preview"`
+}
+
+// DailyCount is the number of messages archived on a UTC day.
+type DailyCount struct {
+	Day      string `json:"day"` // YYYY-MM-DD
+	Inbound  int64  `json:"inbound"`
+	Outbound int64  `json:"outbound"`
+}
+
+// ContactActivity is one row of GET /dashboard/contacts.
+type ContactActivity struct {
+	ContactID      string `json:"contact_id"`
+	LastChat       string `json:"last_chat"`
+	MessageCount   int64  `json:"message_count"`
+	LastInboundAt  int64  `json:"last_inbound_at,omitempty"`
+	LastOutboundAt int64  `json:"last_outbound_at,omitempty"`
+	LastActivityAt int64  `json:"last_activity_at"`
+}
+
+// project folds an archived message into the read models. Messages may
+// arrive out of order (history sync, retries), so "last" fields only move
+// forward in time.
+func project(tx *sql.Tx, m ArchivedMessage) error {
+	in, out := int64(0), int64(0)
+	if m.Direction == DirectionInbound {
+		in = 1
+	} else {
+		out = 1
+	}
+	preview := m.Content
+	if runes := []rune(preview); len(runes) > previewLength {
+		preview = string(runes[:previewLength])
+	}
+
+	_, err := tx.Exec(`INSERT INTO chat_summaries
+		(chat, contact_id, message_count, inbound_count, outbound_count, first_message_at, last_message_at,
+		 last_inbound_at, last_outbound_at, last_message_id, last_direction, last_type, last_preview)
+		VALUES (?, ?, 1, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (chat) DO UPDATE SET
+			message_count = message_count + 1,
+			inbound_count = inbound_count + excluded.inbound_count,
+			outbound_count = outbound_count + excluded.outbound_count,
+			first_message_at = MIN(first_message_at, excluded.first_message_at),
+			last_inbound_at = MAX(last_inbound_at, excluded.last_inbound_at),
+			last_outbound_at = MAX(last_outbound_at, excluded.last_outbound_at),
+			contact_id = CASE WHEN excluded.contact_id != '' THEN excluded.contact_id ELSE contact_id END,
+			last_message_id = CASE WHEN excluded.last_message_at >= last_message_at THEN excluded.last_message_id ELSE last_message_id END,
+			last_direction = CASE WHEN excluded.last_message_at >= last_message_at THEN excluded.last_direction ELSE last_direction END,
+			last_type = CASE WHEN excluded.last_message_at >= last_message_at THEN excluded.last_type ELSE last_type END,
+			last_preview = CASE WHEN excluded.last_message_at >= last_message_at THEN excluded.last_preview ELSE last_preview END,
+			last_message_at = MAX(last_message_at, excluded.last_message_at)`,
+		m.Chat, m.ContactID, in, out, m.Timestamp, m.Timestamp,
+		in*m.Timestamp, out*m.Timestamp, m.MessageID, m.Direction, m.Type, preview)
+	if err != nil {
+		return fmt.Errorf("chat_summaries: %v", err)
+	}
+
+	_, err = tx.Exec(`INSERT INTO daily_message_counts (day, direction, count) VALUES (?, ?, 1)
+		ON CONFLICT (day, direction) DO UPDATE SET count = count + 1`,
+		time.Unix(m.Timestamp, 0).UTC().Format(time.DateOnly), m.Direction)
+	if err != nil {
+		return fmt.Errorf("daily_message_counts: %v", err)
+	}
+
+	if m.ContactID == "" {
+		return nil
+	}
+	_, err = tx.Exec(`INSERT INTO contact_activity
+		(contact_id, last_chat, message_count, last_inbound_at, last_outbound_at, last_activity_at)
+		VALUES (?, ?, 1, ?, ?, ?)
+		ON CONFLICT (contact_id) DO UPDATE SET
+			message_count = message_count + 1,
+			last_inbound_at = MAX(last_inbound_at, excluded.last_inbound_at),
+			last_outbound_at = MAX(last_outbound_at, excluded.last_outbound_at),
+			last_chat = CASE WHEN excluded.last_activity_at >= last_activity_at THEN excluded.last_chat ELSE last_chat END,
+			last_activity_at = MAX(last_activity_at, excluded.last_activity_at)`,
+		m.ContactID, m.Chat, in*m.Timestamp, out*m.Timestamp, m.Timestamp)
+	if err != nil {
+		return fmt.Errorf("contact_activity: %v", err)
+	}
+	return nil
+}
+
+// mergeContactActivity folds old's activity into survivor's when two
+// contacts turn out to be the same person.
+func mergeContactActivity(tx *sql.Tx, survivor, old string) error {
+	_, err := tx.Exec(`INSERT INTO contact_activity
+		(contact_id, last_chat, message_count, last_inbound_at, last_outbound_at, last_activity_at)
+		SELECT ?, last_chat, message_count, last_inbound_at, last_outbound_at, last_activity_at
+		FROM contact_activity WHERE contact_id = ?
+		ON CONFLICT (contact_id) DO UPDATE SET
+			message_count = message_count + excluded.message_count,
+			last_inbound_at = MAX(last_inbound_at, excluded.last_inbound_at),
+			last_outbound_at = MAX(last_outbound_at, excluded.last_outbound_at),
+			last_chat = CASE WHEN excluded.last_activity_at > last_activity_at THEN excluded.last_chat ELSE last_chat END,
+			last_activity_at = MAX(last_activity_at, excluded.last_activity_at)`, survivor, old)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM contact_activity WHERE contact_id = ?`, old); err != nil {
+		return err
+	}
+	_, err = tx.Exec(`UPDATE chat_summaries SET contact_id = ? WHERE contact_id = ?`, survivor, old)
+	return err
+}
+
+// ChatSummaries returns chats active since the given time, most recent
+// first; awaiting limits them to chats whose last message is inbound.
+func (a *Archive) ChatSummaries(since int64, awaiting bool, limit int) ([]ChatSummary, error) {
+	if a == nil {
+		return nil, fmt.Errorf("archive is disabled")
+	}
+	query := `SELECT chat, contact_id, message_count, inbound_count, outbound_count, first_message_at,
+		last_message_at, last_inbound_at, last_outbound_at, last_read_at, last_message_id,
+		last_direction, last_type, last_preview
+		FROM chat_summaries WHERE last_message_at >= ?`
+	args := []interface{}{since}
+	if awaiting {
+		query += ` AND last_direction = ?`
+		args = append(args, DirectionInbound)
+	}
+	query += ` ORDER BY last_message_at DESC LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := a.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []ChatSummary{}
+	for rows.Next() {
+		var s ChatSummary
+		if err := rows.Scan(&s.Chat, &s.ContactID, &s.MessageCount, &s.InboundCount, &s.OutboundCount,
+			&s.FirstMessageAt, &s.LastMessageAt, &s.LastInboundAt, &s.LastOutboundAt, &s.LastReadAt,
+			&s.LastMessageID, &s.LastDirection, &s.LastType, &s.LastPreview); err != nil {
+			return nil, err
+		}
+		out = append(out, s)
+	}
+	return out, rows.Err()
+}
+
+// DailyCounts returns message counts for the UTC days in [since, until],
+// given as YYYY-MM-DD, oldest first. Days without messages are omitted.
+func (a *Archive) DailyCounts(since, until string) ([]DailyCount, error) {
+	if a == nil {
+		return nil, fmt.Errorf("archive is disabled")
+	}
+	rows, err := a.db.Query(`SELECT day,
+		SUM(CASE WHEN direction = ? THEN count ELSE 0 END),
+		SUM(CASE WHEN direction = ? THEN count ELSE 0 END)
+		FROM daily_message_counts WHERE day >= ? AND day <= ?
+		GROUP BY day ORDER BY day`, DirectionInbound, DirectionOutbound, since, until)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []DailyCount{}
+	for rows.Next() {
+		var d DailyCount
+		if err := rows.Scan(&d.Day, &d.Inbound, &d.Outbound); err != nil {
+			return nil, err
+		}
+		out = append(out, d)
+	}
+	return out, rows.Err()
+}
+
+// ContactActivities returns contacts active since the given time, most
+// recent first.
+func (a *Archive) ContactActivities(since int64, limit int) ([]ContactActivity, error) {
+	if a == nil {
+		return nil, fmt.Errorf("archive is disabled")
+	}
+	rows, err := a.db.Query(`SELECT contact_id, last_chat, message_count, last_inbound_at,
+		last_outbound_at, last_activity_at FROM contact_activity
+		WHERE last_activity_at >= ? ORDER BY last_activity_at DESC LIMIT ?`, since, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []ContactActivity{}
+	for rows.Next() {
+		var c ContactActivity
+		if err := rows.Scan(&c.ContactID, &c.LastChat, &c.MessageCount, &c.LastInboundAt,
+			&c.LastOutboundAt, &c.LastActivityAt); err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+// dashboardParams reads since (Unix seconds or RFC3339) and limit (default
+// 50, at most 1000) from the query string.
+func dashboardParams(r *http.Request) (since int64, limit int, err error) {
+	q := r.URL.Query()
+	if since, err = parseTimeParam(q.Get("since")); err != nil {
+		return 0, 0, fmt.Errorf("invalid since: %v", err)
+	}
+	limit = 50
+	if v := q.Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit <= 0 {
+			return 0, 0, fmt.Errorf("invalid limit: %q", v)
+		}
+	}
+	return since, min(limit, 1000), nil
+}
+
+// handleDashboardChats serves GET /dashboard/chats[?since=&awaiting=true&limit=].
+func (b *WhatsAppBridge) handleDashboardChats(w http.ResponseWriter, r *http.Request) {
+	since, limit, err := dashboardParams(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, Response{Success: false, Error: err.Error()})
+		return
+	}
+	awaiting := r.URL.Query().Get("awaiting") == "true"
+	chats, err := b.archiveDB.ChatSummaries(since, awaiting, limit)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, Response{Success: true, Data: chats})
+}
+
+// handleDashboardDaily serves GET /dashboard/daily[?since=&until=], days as
+// YYYY-MM-DD in UTC; the default range is the last 30 days.
+func (b *WhatsAppBridge) handleDashboardDaily(w http.ResponseWriter, r *http.Request) {
+	now := time.Now().UTC()
+	since := r.URL.Query().Get("since")
+	until := r.URL.Query().Get("until")
+	if since == "" {
+		since = now.AddDate(0, 0, -29).Format(time.DateOnly)
+	}
+	if until == "" {
+		until = now.Format(time.DateOnly)
+	}
+	for _, day := range []string{since, until} {
+		if _, err := time.Parse(time.DateOnly, day); err != nil {
+			writeJSON(w, http.StatusBadRequest, Response{Success: false, Error: fmt.Sprintf("invalid day %q, expected YYYY-MM-DD", day)})
+			return
+		}
+	}
+	counts, err := b.archiveDB.DailyCounts(since, until)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, Response{Success: true, Data: counts})
+}
+
+// handleDashboardContacts serves GET /dashboard/contacts[?since=&limit=].
+func (b *WhatsAppBridge) handleDashboardContacts(w http.ResponseWriter, r *http.Request) {
+	since, limit, err := dashboardParams(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, Response{Success: false, Error: err.Error()})
+		return
+	}
+	contacts, err := b.archiveDB.ContactActivities(since, limit)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, Response{Success: true, Data: contacts})
+}
@@ -0,0 +1,117 @@
+package bridge
+
+import (
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// QuotedMessage is the message an inbound message replies to, published as
+// its quoted field. FromMe is set when it is one of the bridge's own
+// messages, i.e. the user is answering the agent. Content is the quoted
+// text or caption, taken from the archive when the reply does not carry it.
+type QuotedMessage struct {
+	MessageID string `json:"message_id"`
+	Sender    string `json:"sender,omitempty"` // JID of its author
+	FromMe    bool   `json:"from_me"`
+	Type      string `json:"type,omitempty"`
+	Content   string `json:"content,omitempty"`
+}
+
+// contextInfo returns the context of msg: what it quotes and mentions.
+func contextInfo(msg *waE2E.Message) *waE2E.ContextInfo {
+	switch {
+	case msg.GetExtendedTextMessage() != nil:
+		return msg.GetExtendedTextMessage().GetContextInfo()
+	case msg.GetImageMessage() != nil:
+		return msg.GetImageMessage().GetContextInfo()
+	case msg.GetVideoMessage() != nil:
+		return msg.GetVideoMessage().GetContextInfo()
+	case msg.GetAudioMessage() != nil:
+		return msg.GetAudioMessage().GetContextInfo()
+	case msg.GetDocumentMessage() != nil:
+		return msg.GetDocumentMessage().GetContextInfo()
+	case msg.GetStickerMessage() != nil:
+		return msg.GetStickerMessage().GetContextInfo()
+	case msg.GetLocationMessage() != nil:
+		return msg.GetLocationMessage().GetContextInfo()
+	case msg.GetLiveLocationMessage() != nil:
+		return msg.GetLiveLocationMessage().GetContextInfo()
+	case msg.GetContactMessage() != nil:
+		return msg.GetContactMessage().GetContextInfo()
+	case msg.GetContactsArrayMessage() != nil:
+		return msg.GetContactsArrayMessage().GetContextInfo()
+	}
+	return nil
+}
+
+// quotedType names the type of a quoted message as inbound messages are
+// typed.
+func quotedType(msg *waE2E.Message) string {
+	switch {
+	case msg == nil:
+		return ""
+	case msg.GetConversation() != "" || msg.GetExtendedTextMessage() != nil:
+		return "text"
+	case msg.GetImageMessage() != nil:
+		return "image"
+	case msg.GetVideoMessage() != nil:
+		return "video"
+	case msg.GetAudioMessage() != nil:
+		return "audio"
+	case msg.GetDocumentMessage() != nil:
+		return "document"
+	case msg.GetStickerMessage() != nil:
+		return "sticker"
+	case msg.GetLocationMessage() != nil:
+		return "location"
+	case msg.GetContactMessage() != nil || msg.GetContactsArrayMessage() != nil:
+		return "contacts"
+	}
+	return "unknown"
+}
+
+// quotedMessage returns what msg replies to, or nil when it is no reply.
+func (b *WhatsAppBridge) quotedMessage(msg *waE2E.Message) *QuotedMessage {
+	ctx := contextInfo(msg)
+	if ctx.GetStanzaID() == "" {
+		return nil
+	}
+	quoted := &QuotedMessage{
+		MessageID: ctx.GetStanzaID(),
+		Type:      quotedType(ctx.GetQuotedMessage()),
+		Content:   editedText(ctx.GetQuotedMessage()),
+	}
+	if sender, err := types.ParseJID(ctx.GetParticipant()); err == nil && !sender.IsEmpty() {
+		quoted.Sender = sender.ToNonAD().String()
+		quoted.FromMe = b.isOwnJID(sender)
+	}
+	if archived, err := b.archiveDB.FindMessage(quoted.MessageID); err == nil {
+		quoted.FromMe = quoted.FromMe || archived.Direction == DirectionOutbound
+		if quoted.Content == "" {
+			quoted.Content = archived.Content
+		}
+		if quoted.Type == "" {
+			quoted.Type = archived.Type
+		}
+	}
+	return quoted
+}
+
+// isOwnJID reports whether jid is the bridge's account, by phone number or
+// LID.
+func (b *WhatsAppBridge) isOwnJID(jid types.JID) bool {
+	if b.client == nil {
+		return false
+	}
+	device := b.client.Device()
+	if device == nil || device.ID == nil {
+		return false
+	}
+	switch jid.Server {
+	case types.DefaultUserServer:
+		return jid.User == device.ID.User
+	case types.HiddenUserServer:
+		return jid.User == device.LID.User
+	}
+	return false
+}
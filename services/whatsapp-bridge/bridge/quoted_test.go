@@ -0,0 +1,51 @@
+package bridge_test
+
+import (
+	"testing"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/phenobarbital/ai-parrot/whatsapp-bridge/bridge"
+	"github.com/phenobarbital/ai-parrot/whatsapp-bridge/bridgetest"
+)
+
+// replyTo builds a text replying to id, by participant.
+func replyTo(text, id, participant string, quoted *waE2E.Message) *waE2E.Message {
+	return &waE2E.Message{ExtendedTextMessage: &waE2E.ExtendedTextMessage{
+		Text: proto.String(text),
+		ContextInfo: &waE2E.ContextInfo{
+			StanzaID:      proto.String(id),
+			Participant:   proto.String(participant),
+			QuotedMessage: quoted,
+		},
+	}}
+}
+
+func TestInboundQuotedReply(t *testing.T) {
+	h := bridgetest.New(t)
+	jid := types.NewJID("5215512345678", types.DefaultUserServer)
+
+	// Answering the agent: the quote carries no text, which the archive has.
+	data, _ := h.Send(bridge.OutgoingMessage{Phone: jid.User, Message: "Table for two at 8?"}).Data.(map[string]any)
+	sent, _ := data["message_id"].(string)
+	h.Receive(jid, jid, replyTo("yes", sent, bridgetest.DefaultOwnJID.String(), nil))
+	quoted := h.ExpectMessage().Quoted
+	if quoted == nil || quoted.MessageID != sent || !quoted.FromMe || quoted.Type != "text" || quoted.Content != "Table for two at 8?" {
+		t.Errorf("reply to the agent quoted %+v", quoted)
+	}
+
+	// Quoting a message the bridge never saw.
+	h.Receive(jid, jid, replyTo("this one", "UNKNOWN1", "5215587654321@s.whatsapp.net",
+		&waE2E.Message{ImageMessage: &waE2E.ImageMessage{Caption: proto.String("menu")}}))
+	quoted = h.ExpectMessage().Quoted
+	if quoted == nil || quoted.FromMe || quoted.Sender != "5215587654321@s.whatsapp.net" || quoted.Type != "image" || quoted.Content != "menu" {
+		t.Errorf("reply to a contact quoted %+v", quoted)
+	}
+
+	h.ReceiveText(jid.User, "no reply")
+	if quoted := h.ExpectMessage().Quoted; quoted != nil {
+		t.Errorf("plain text quoted %+v", quoted)
+	}
+}
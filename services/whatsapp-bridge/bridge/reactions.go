@@ -0,0 +1,282 @@
+package bridge
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// ReactionRequest is the payload accepted by POST /messages/{id}/react.
+//
+// Phone/Server identify the chat and may be omitted when the target message
+// is in the archive. Sender is the author of the target message (phone or
+// JID), needed for group messages; FromMe marks a message we sent. An empty
+// Emoji removes a previous reaction.
+type ReactionRequest struct {
+	Phone  string `json:"phone,omitempty"`
+	Server string `json:"server,omitempty"`
+	Sender string `json:"sender,omitempty"`
+	FromMe bool   `json:"from_me,omitempty"`
+	Emoji  string `json:"emoji"`
+}
+
+func (b *WhatsAppBridge) handleReact(w http.ResponseWriter, r *http.Request) {
+	messageID := mux.Vars(r)["id"]
+
+	var req ReactionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, Response{Success: false, Error: err.Error()})
+		return
+	}
+
+	chat, sender, err := b.resolveMessageTarget(messageID, req.Phone, req.Server, req.Sender, req.FromMe)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, Response{Success: false, Error: err.Error()})
+		return
+	}
+
+	ctx, chat, err := b.checkSend(context.WithoutCancel(r.Context()), chat, OutgoingMessage{})
+	if err != nil {
+		b.writeSendError(w, err, SendResult{})
+		return
+	}
+
+	log.Printf("Reacting %q to message %s in %s", req.Emoji, messageID, chat.User)
+
+	resp, err := b.deliver(ctx, chat, b.client.BuildReaction(chat, sender, messageID, req.Emoji), 0)
+	if err != nil {
+		log.Printf("Error sending reaction to %s: %v", chat.User, err)
+		b.reportSendFailure(err, chat, "reaction")
+		b.writeSendError(w, err, SendResult{})
+		return
+	}
+
+	b.archiveOutgoing(r.Context(), chat.String(), resp.ID, "reaction", req.Emoji, resp.Timestamp)
+	data := b.timestampFields(resp.Timestamp)
+	data["message_id"] = resp.ID
+	data["target_message_id"] = messageID
+	writeJSON(w, http.StatusOK, Response{Success: true, Data: data})
+}
+
+// resolveMessageTarget determines the chat and author of an existing message,
+// from explicit request fields or, when the chat is omitted, from the archive.
+// An empty sender JID denotes one of our own messages.
+func (b *WhatsAppBridge) resolveMessageTarget(messageID, phone, server, sender string, fromMe bool) (types.JID, types.JID, error) {
+	if phone == "" {
+		archived, err := b.archiveDB.FindMessage(messageID)
+		if err != nil {
+			return types.EmptyJID, types.EmptyJID, fmt.Errorf("phone is required: message %s not found in archive", messageID)
+		}
+		chat, err := types.ParseJID(archived.Chat)
+		if err != nil {
+			return types.EmptyJID, types.EmptyJID, fmt.Errorf("invalid archived chat: %v", err)
+		}
+		if archived.Direction == DirectionOutbound {
+			return chat, types.EmptyJID, nil
+		}
+		author, err := types.ParseJID(archived.Sender)
+		return chat, author, err
+	}
+
+	chat := recipientJID(phone, server)
+	switch {
+	case fromMe:
+		return chat, types.EmptyJID, nil
+	case sender != "":
+		author, err := parseJIDOrPhone(sender)
+		return chat, author, err
+	default:
+		// In a 1:1 chat the other party authored every message not from us.
+		return chat, chat, nil
+	}
+}
+
+// parseJIDOrPhone accepts either a full JID or a bare phone number.
+func parseJIDOrPhone(s string) (types.JID, error) {
+	if strings.Contains(s, "@") {
+		return types.ParseJID(s)
+	}
+	return recipientJID(s, ""), nil
+}
+
+// EventReactionsUpdated is published when an inbound reaction changes the
+// reactions to a message, with the new aggregate, so agents can take 👍/👎
+// on their answers as feedback.
+const EventReactionsUpdated = "reactions_updated"
+
+// EventReaction is published for every inbound reaction, including its
+// removal, so agents can act on the reaction itself, e.g. take 👍 on a
+// proposal as confirmation, without tracking the aggregate.
+const EventReaction = "reaction"
+
+// InboundReaction is the payload of reaction events. Removed is set, and
+// Emoji empty, when the reactor took their reaction back; TargetDirection
+// is out for reactions to messages the bridge sent.
+type InboundReaction struct {
+	MessageID       string `json:"message_id"` // of the reaction itself
+	Chat            string `json:"chat"`
+	TargetID        string `json:"target_id"`
+	TargetDirection string `json:"target_direction,omitempty"`
+	Reactor         string `json:"reactor"` // JID
+	ReactorName     string `json:"reactor_name,omitempty"`
+	ContactID       string `json:"contact_id,omitempty"`
+	Emoji           string `json:"emoji"`
+	Removed         bool   `json:"removed"`
+	Timestamp       int64  `json:"timestamp"`
+	TimestampISO    string `json:"timestamp_iso"`
+}
+
+// MessageReactions aggregates the current reactions to a message.
+type MessageReactions struct {
+	MessageID string         `json:"message_id"`
+	Total     int            `json:"total"`
+	Counts    map[string]int `json:"counts"` // by emoji
+	Reactors  []Reaction     `json:"reactors"`
+}
+
+// Reaction is one reactor's current reaction.
+type Reaction struct {
+	Reactor   string `json:"reactor"` // JID
+	ContactID string `json:"contact_id,omitempty"`
+	Emoji     string `json:"emoji"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+// ReactionsUpdated is the payload of reactions_updated events. Emoji is
+// the reactor's new reaction, empty when removed; TargetDirection is out
+// for reactions to messages the bridge sent.
+type ReactionsUpdated struct {
+	MessageID       string           `json:"message_id"` // of the reaction itself
+	Chat            string           `json:"chat"`
+	Reactor         string           `json:"reactor"`
+	ReactorName     string           `json:"reactor_name,omitempty"`
+	Emoji           string           `json:"emoji"`
+	TargetDirection string           `json:"target_direction,omitempty"`
+	Reactions       MessageReactions `json:"reactions"`
+	Timestamp       int64            `json:"timestamp"`
+	TimestampISO    string           `json:"timestamp_iso"`
+}
+
+// SetReaction records chat reactor's reaction to messageID, or removes it
+// when emoji is empty. A change older than the stored one is ignored, so
+// redelivered reactions cannot undo newer ones.
+func (a *Archive) SetReaction(messageID, chat string, r Reaction) error {
+	if a == nil {
+		return nil
+	}
+	if r.Emoji == "" {
+		_, err := a.db.Exec(`DELETE FROM message_reactions
+			WHERE message_id = ? AND reactor = ? AND timestamp <= ?`, messageID, r.Reactor, r.Timestamp)
+		return err
+	}
+	_, err := a.db.Exec(`INSERT INTO message_reactions
+		(message_id, chat, reactor, contact_id, emoji, timestamp) VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (message_id, reactor) DO UPDATE SET emoji = excluded.emoji,
+			contact_id = excluded.contact_id, timestamp = excluded.timestamp
+		WHERE excluded.timestamp >= message_reactions.timestamp`,
+		messageID, chat, r.Reactor, r.ContactID, r.Emoji, r.Timestamp)
+	return err
+}
+
+// Reactions returns the aggregate reactions to messageID.
+func (a *Archive) Reactions(messageID string) (*MessageReactions, error) {
+	if a == nil {
+		return nil, fmt.Errorf("archive is disabled")
+	}
+	rows, err := a.db.Query(`SELECT reactor, contact_id, emoji, timestamp
+		FROM message_reactions WHERE message_id = ? ORDER BY timestamp, reactor`, messageID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := &MessageReactions{MessageID: messageID, Counts: map[string]int{}, Reactors: []Reaction{}}
+	for rows.Next() {
+		var r Reaction
+		if err := rows.Scan(&r.Reactor, &r.ContactID, &r.Emoji, &r.Timestamp); err != nil {
+			return nil, err
+		}
+		out.Reactors = append(out.Reactors, r)
+		out.Counts[r.Emoji]++
+		out.Total++
+	}
+	return out, rows.Err()
+}
+
+// handleInboundReaction publishes a reaction, records it and publishes the
+// new aggregate. Held for maintenance, it is only recorded.
+func (b *WhatsAppBridge) handleInboundReaction(msg *events.Message, held bool) {
+	info := msg.Info
+	reaction := msg.Message.GetReactionMessage()
+	target := reaction.GetKey().GetID()
+	r := Reaction{
+		Reactor:   info.Sender.ToNonAD().String(),
+		ContactID: b.resolveContact(info.Sender, info.SenderAlt),
+		Emoji:     reaction.GetText(),
+		Timestamp: info.Timestamp.Unix(),
+	}
+	if held {
+		if err := b.archiveDB.SetReaction(target, info.Chat.String(), r); err != nil {
+			log.Printf("Error recording reaction to %s: %v", target, err)
+		}
+		log.Printf("🚧 Maintenance: not publishing reaction %s from %s", info.ID, info.Sender.User)
+		return
+	}
+	var direction string
+	if archived, err := b.archiveDB.FindMessage(target); err == nil {
+		direction = archived.Direction
+	}
+	b.publish(EventReaction, info.Chat.String(), InboundReaction{
+		MessageID:       info.ID,
+		Chat:            info.Chat.String(),
+		TargetID:        target,
+		TargetDirection: direction,
+		Reactor:         r.Reactor,
+		ReactorName:     info.PushName,
+		ContactID:       r.ContactID,
+		Emoji:           r.Emoji,
+		Removed:         r.Emoji == "",
+		Timestamp:       r.Timestamp,
+		TimestampISO:    b.formatTime(info.Timestamp),
+	})
+
+	if err := b.archiveDB.SetReaction(target, info.Chat.String(), r); err != nil {
+		log.Printf("Error recording reaction to %s: %v", target, err)
+		return
+	}
+	log.Printf("💬 Reaction %q from %s to %s", r.Emoji, info.Sender.User, target)
+
+	event := ReactionsUpdated{
+		MessageID:       info.ID,
+		Chat:            info.Chat.String(),
+		Reactor:         r.Reactor,
+		ReactorName:     info.PushName,
+		Emoji:           r.Emoji,
+		TargetDirection: direction,
+		Reactions:       MessageReactions{MessageID: target},
+		Timestamp:       r.Timestamp,
+		TimestampISO:    b.formatTime(info.Timestamp),
+	}
+	if aggregate, err := b.archiveDB.Reactions(target); err == nil {
+		event.Reactions = *aggregate
+	}
+	b.publish(EventReactionsUpdated, event.Chat, event)
+	b.feedback.Reaction(info, r.ContactID, target, r.Emoji)
+}
+
+// handleMessageReactions serves GET /messages/{id}/reactions.
+func (b *WhatsAppBridge) handleMessageReactions(w http.ResponseWriter, r *http.Request) {
+	reactions, err := b.archiveDB.Reactions(mux.Vars(r)["id"])
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, Response{Success: true, Data: reactions})
+}
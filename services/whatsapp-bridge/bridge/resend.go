@@ -0,0 +1,174 @@
+package bridge
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/socket"
+)
+
+// Re-sending after reconnect: a send that fails because the connection to
+// WhatsApp dropped (not because of the recipient or the message) is kept
+// and sent again, with the same message ID, once the bridge is connected
+// again. The message stays queued meanwhile; its sent status event carries
+// resent_after_reconnect. Messages that waited longer than RESEND_MAX_AGE
+// (default 5m, 0 disables re-sending) are failed instead, since a reply
+// arriving that late is usually worse than none.
+//
+//	whatsapp:resend - hash: message ID -> pendingResend JSON
+
+const resendKey = "whatsapp:resend"
+
+// errResendQueued is returned by sendSingle for sends that failed on a
+// dropped connection and will be re-sent. sendOutgoing reports them as
+// accepted with SendResult.Queued; the API answers 202 and queue consumers
+// settle them, so the message is not sent a second time.
+var errResendQueued = errors.New("disconnected from WhatsApp, message queued to be re-sent after reconnect")
+
+// pendingResend is a message waiting for the connection to come back.
+type pendingResend struct {
+	Chat      string          `json:"chat"`
+	Message   OutgoingMessage `json:"message"`
+	Header    *TemplateHeader `json:"template_header,omitempty"`
+	Operator  string          `json:"operator"`
+	RequestID string          `json:"request_id,omitempty"`
+	FailedAt  int64           `json:"failed_at"`
+}
+
+type resentKey struct{}
+
+// resentAfterReconnect reports whether ctx belongs to a re-send.
+func resentAfterReconnect(ctx context.Context) bool {
+	resent, _ := ctx.Value(resentKey{}).(bool)
+	return resent
+}
+
+func resendMaxAge() time.Duration {
+	return envDuration("RESEND_MAX_AGE", 5*time.Minute)
+}
+
+// isDisconnectError reports whether a send failed because there was no
+// connection, or it dropped before the server acknowledged the message.
+func isDisconnectError(err error) bool {
+	var disconnected *whatsmeow.DisconnectedError
+	return errors.Is(err, whatsmeow.ErrNotConnected) ||
+		errors.Is(err, socket.ErrSocketClosed) ||
+		errors.As(err, &disconnected)
+}
+
+// queueResend keeps a message whose send failed on a disconnect, reporting
+// false when re-sending is disabled or the message could not be stored.
+func (b *WhatsAppBridge) queueResend(ctx context.Context, id, chat string, msg OutgoingMessage) bool {
+	if resendMaxAge() <= 0 {
+		return false
+	}
+	data, _ := json.Marshal(pendingResend{
+		Chat:      chat,
+		Message:   msg,
+		Header:    msg.templateHeader,
+		Operator:  operatorFromContext(ctx),
+		RequestID: requestIDFromContext(ctx),
+		FailedAt:  time.Now().Unix(),
+	})
+	if err := b.redisClient.HSet(context.WithoutCancel(ctx), resendKey, id, data).Err(); err != nil {
+		log.Printf("Error queueing %s to be re-sent: %v", id, err)
+		return false
+	}
+	log.Printf("🔁 Message %s to %s queued to be re-sent after reconnect", id, chat)
+	// The connection may have come back while this send was failing.
+	if b.client.IsConnected() {
+		go b.resendPending()
+	}
+	return true
+}
+
+// resendPending re-sends, oldest first, the messages that failed on a
+// disconnect. It runs on every (re)connection.
+func (b *WhatsAppBridge) resendPending() {
+	b.resendMu.Lock()
+	defer b.resendMu.Unlock()
+
+	all, err := b.redisClient.HGetAll(b.ctx, resendKey).Result()
+	if err != nil {
+		log.Printf("Error loading messages to re-send: %v", err)
+		return
+	}
+	ids := make([]string, 0, len(all))
+	pending := make(map[string]pendingResend, len(all))
+	for id, data := range all {
+		var p pendingResend
+		if err := json.Unmarshal([]byte(data), &p); err != nil {
+			b.redisClient.HDel(b.ctx, resendKey, id)
+			continue
+		}
+		ids = append(ids, id)
+		pending[id] = p
+	}
+	sort.Slice(ids, func(i, j int) bool { return pending[ids[i]].FailedAt < pending[ids[j]].FailedAt })
+
+	maxAge := resendMaxAge()
+	for _, id := range ids {
+		// Claiming the message first keeps other replicas from sending it too.
+		if claimed, err := b.redisClient.HDel(b.ctx, resendKey, id).Result(); err != nil || claimed == 0 {
+			continue
+		}
+		p := pending[id]
+		ctx := context.WithValue(withOperator(withRequestID(b.ctx, p.RequestID), p.Operator), resentKey{}, true)
+		if p.Message.Priority != "" {
+			ctx = withPriority(ctx, p.Message.Priority)
+		}
+		if age := time.Since(time.Unix(p.FailedAt, 0)); maxAge <= 0 || age > maxAge {
+			log.Printf("Message %s to %s waited %s for a reconnect, not re-sending", id, p.Chat, age.Round(time.Second))
+			b.trackFailed(ctx, id, fmt.Errorf("not re-sent: disconnected from WhatsApp for more than %s", maxAge))
+			continue
+		}
+		if err := b.resend(ctx, id, p); err != nil {
+			if isDisconnectError(err) {
+				// Dropped again: put it back for the next connection.
+				data, _ := json.Marshal(p)
+				b.redisClient.HSet(b.ctx, resendKey, id, data)
+				return
+			}
+			log.Printf("Error re-sending message %s to %s: %v", id, p.Chat, err)
+			b.trackFailed(ctx, id, err)
+		}
+	}
+}
+
+// resend sends a pending message again under its original ID, after the
+// pre-send checks, which may have changed while it waited.
+func (b *WhatsAppBridge) resend(ctx context.Context, id string, p pendingResend) error {
+	jid, err := p.Message.recipient()
+	if err != nil {
+		return err
+	}
+	msg := p.Message
+	msg.templateHeader = p.Header
+	if ctx, jid, err = b.checkSend(ctx, jid, msg); err != nil {
+		return err
+	}
+	content, msgType, err := b.buildOutgoingMessage(ctx, jid, id, msg)
+	if err != nil {
+		return err
+	}
+	resp, err := b.deliver(ctx, jid, content, len([]rune(msg.Message)), whatsmeow.SendRequestExtra{ID: id})
+	if err != nil {
+		b.reportSendFailure(err, jid, msgType)
+		return err
+	}
+	log.Printf("🔁 Message re-sent to %s after reconnect, ID: %s%s", jid.User, id, requestNote(ctx))
+	if len(msg.Suggestions) > 0 {
+		b.rememberSuggestions(jid.String(), id, msg.Suggestions)
+	}
+	b.archiveOutgoing(ctx, jid.String(), id, msgType, msg.Message, resp.Timestamp)
+	operator := operatorFromContext(ctx)
+	go b.chatwoot.MirrorOutgoing(b.ctx, jid.String(), msg.Message, operator)
+	go b.matrix.MirrorOutgoing(b.ctx, jid.String(), msg.Message, operator)
+	return nil
+}
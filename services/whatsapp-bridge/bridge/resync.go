@@ -0,0 +1,151 @@
+package bridge
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync/atomic"
+
+	"go.mau.fi/whatsmeow/appstate"
+)
+
+// EventResyncProgress is published as each stage of a resync starts,
+// finishes or fails, and once more when the whole resync ends.
+const EventResyncProgress = "resync_progress"
+
+// Resync stage statuses.
+const (
+	ResyncStarted = "started"
+	ResyncDone    = "done"
+	ResyncFailed  = "failed"
+)
+
+// ResyncProgress is the payload of resync_progress events. Stage is
+// "app_state:<patch>", "groups", "contacts" or, for the final event,
+// "finished".
+type ResyncProgress struct {
+	ID       string `json:"id"`
+	Stage    string `json:"stage"`
+	Status   string `json:"status"`
+	Count    int    `json:"count,omitempty"` // groups or contacts known after the stage
+	Error    string `json:"error,omitempty"`
+	Operator string `json:"operator,omitempty"`
+}
+
+// ResyncRequest is the optional body of POST /admin/resync. Patches limits
+// the app-state collections fetched (default: all); Full re-downloads them
+// from scratch instead of applying changes since the last sync, and
+// defaults to true since a resync is meant to repair a drifted store.
+type ResyncRequest struct {
+	Patches []string `json:"patches,omitempty"`
+	Full    *bool    `json:"full,omitempty"`
+}
+
+// resyncRunning guards against concurrent resyncs.
+var resyncRunning atomic.Bool
+
+// handleResync serves POST /admin/resync, refetching app state (chat
+// names, mutes, pins, contact names), the joined groups and the contact
+// list from the phone in the background. Progress is reported through
+// resync_progress events.
+func (b *WhatsAppBridge) handleResync(w http.ResponseWriter, r *http.Request) {
+	var req ResyncRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, Response{Success: false, Error: err.Error()})
+			return
+		}
+	}
+	patches := make([]appstate.WAPatchName, 0, len(appstate.AllPatchNames))
+	if len(req.Patches) == 0 {
+		patches = append(patches, appstate.AllPatchNames[:]...)
+	}
+	for _, name := range req.Patches {
+		if !isPatchName(name) {
+			writeJSON(w, http.StatusBadRequest, Response{Success: false, Error: fmt.Sprintf("unknown app state patch %q", name)})
+			return
+		}
+		patches = append(patches, appstate.WAPatchName(name))
+	}
+	full := req.Full == nil || *req.Full
+
+	if !b.client.IsConnected() {
+		writeJSON(w, http.StatusServiceUnavailable, Response{Success: false, Error: "WhatsApp is not connected"})
+		return
+	}
+	if !resyncRunning.CompareAndSwap(false, true) {
+		writeJSON(w, http.StatusConflict, Response{Success: false, Error: "a resync is already running"})
+		return
+	}
+
+	buf := make([]byte, 8)
+	rand.Read(buf)
+	id := "rsy_" + hex.EncodeToString(buf)
+	operator := operatorFromContext(r.Context())
+	go func() {
+		defer resyncRunning.Store(false)
+		b.resync(withOperator(b.ctx, operator), id, patches, full)
+	}()
+	writeJSON(w, http.StatusAccepted, Response{Success: true, Data: map[string]interface{}{
+		"id":      id,
+		"patches": patches,
+		"full":    full,
+	}})
+}
+
+func isPatchName(name string) bool {
+	for _, known := range appstate.AllPatchNames {
+		if string(known) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// resync runs every stage, carrying on past failures so one broken
+// collection does not block the rest.
+func (b *WhatsAppBridge) resync(ctx context.Context, id string, patches []appstate.WAPatchName, full bool) {
+	operator := operatorFromContext(ctx)
+	log.Printf("🔄 Resync %s started by %s", id, operator)
+	failed := 0
+	stage := func(name string, run func() (int, error)) {
+		b.publish(EventResyncProgress, "", ResyncProgress{ID: id, Stage: name, Status: ResyncStarted, Operator: operator})
+		count, err := run()
+		progress := ResyncProgress{ID: id, Stage: name, Status: ResyncDone, Count: count, Operator: operator}
+		if err != nil {
+			failed++
+			progress.Status, progress.Error = ResyncFailed, err.Error()
+			log.Printf("Resync %s: %s failed: %v", id, name, err)
+		}
+		b.publish(EventResyncProgress, "", progress)
+	}
+
+	for _, patch := range patches {
+		stage("app_state:"+string(patch), func() (int, error) {
+			return 0, b.client.FetchAppState(ctx, patch, full, false)
+		})
+	}
+	stage("groups", func() (int, error) {
+		groups, err := b.client.GetJoinedGroups(ctx)
+		return len(groups), err
+	})
+	stage("contacts", func() (int, error) {
+		contacts := b.client.Device().Contacts
+		if contacts == nil {
+			return 0, nil
+		}
+		all, err := contacts.GetAllContacts(ctx)
+		return len(all), err
+	})
+
+	final := ResyncProgress{ID: id, Stage: "finished", Status: ResyncDone, Operator: operator}
+	if failed > 0 {
+		final.Status, final.Error = ResyncFailed, fmt.Sprintf("%d stage(s) failed", failed)
+	}
+	b.publish(EventResyncProgress, "", final)
+	log.Printf("🔄 Resync %s %s", id, final.Status)
+}
@@ -0,0 +1,296 @@
+package bridge
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Janitor enforces the retention policy every RETENTION_INTERVAL (default
+// 1h) and on POST /admin/cleanup, which starts a run in the background;
+// GET /admin/cleanup reports the last one. Media stored longer than
+// MEDIA_RETENTION_MAX_AGE is deleted, then the oldest media until the
+// library fits in MEDIA_RETENTION_MAX_BYTES, then archived messages older
+// than ARCHIVE_RETENTION_MAX_AGE. Zero (the default) disables each limit.
+// Pruned media is gone for good: it is not downloaded again on demand.
+// Thumbnails count as media of their own and go with the media they show.
+// SQLite reuses the pages of deleted messages rather than shrinking the
+// archive file.
+type Janitor struct {
+	MediaMaxAge   time.Duration
+	MediaMaxBytes int64
+	ArchiveMaxAge time.Duration
+	Interval      time.Duration
+
+	bridge  *WhatsAppBridge
+	running atomic.Bool
+	last    atomic.Pointer[CleanupReport]
+	tracked sync.Once
+}
+
+// CleanupReport is the outcome of one janitor run.
+type CleanupReport struct {
+	Trigger         string  `json:"trigger"`       // schedule or api
+	MediaDeleted    int     `json:"media_deleted"` // files, thumbnails included
+	MediaBytesFreed int64   `json:"media_bytes_freed"`
+	MediaBlobs      int     `json:"media_blobs"` // files left after the run
+	MediaBytes      int64   `json:"media_bytes"`
+	ArchiveDeleted  int64   `json:"archive_deleted"`
+	Error           string  `json:"error,omitempty"`
+	DurationMS      float64 `json:"duration_ms"`
+}
+
+func (b *WhatsAppBridge) janitorFromEnv() *Janitor {
+	return &Janitor{
+		MediaMaxAge:   envDuration("MEDIA_RETENTION_MAX_AGE", 0),
+		MediaMaxBytes: int64(envInt("MEDIA_RETENTION_MAX_BYTES", 0)),
+		ArchiveMaxAge: envDuration("ARCHIVE_RETENTION_MAX_AGE", 0),
+		Interval:      envDuration("RETENTION_INTERVAL", time.Hour),
+		bridge:        b,
+	}
+}
+
+// Enabled reports whether any limit is set.
+func (j *Janitor) Enabled() bool {
+	return j.MediaMaxAge > 0 || j.MediaMaxBytes > 0 || j.ArchiveMaxAge > 0
+}
+
+// Run cleans up right away and then every Interval until ctx is done.
+func (j *Janitor) Run(ctx context.Context) {
+	if !j.Enabled() || j.Interval <= 0 {
+		return
+	}
+	log.Printf("🧹 Retention janitor every %s", j.Interval)
+	ticker := time.NewTicker(j.Interval)
+	defer ticker.Stop()
+	for {
+		j.Cleanup(ctx, "schedule")
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// errCleanupRunning is returned when a cleanup is already under way.
+var errCleanupRunning = fmt.Errorf("a cleanup is already running")
+
+// Cleanup applies the retention policy once.
+func (j *Janitor) Cleanup(ctx context.Context, trigger string) (*CleanupReport, error) {
+	if !j.running.CompareAndSwap(false, true) {
+		return nil, errCleanupRunning
+	}
+	defer j.running.Store(false)
+	return j.cleanup(ctx, trigger), nil
+}
+
+// Start applies the retention policy once in the background.
+func (j *Janitor) Start(ctx context.Context, trigger string) error {
+	if !j.running.CompareAndSwap(false, true) {
+		return errCleanupRunning
+	}
+	go func() {
+		defer j.running.Store(false)
+		j.cleanup(ctx, trigger)
+	}()
+	return nil
+}
+
+func (j *Janitor) cleanup(ctx context.Context, trigger string) *CleanupReport {
+	j.tracked.Do(func() { j.bridge.media.track(ctx) })
+	start := time.Now()
+	report := &CleanupReport{Trigger: trigger}
+	var errs []string
+	if err := j.pruneMedia(ctx, report); err != nil {
+		errs = append(errs, "media: "+err.Error())
+	}
+	if j.ArchiveMaxAge > 0 && j.bridge.archiveDB != nil {
+		deleted, err := j.bridge.archiveDB.Prune(start.Add(-j.ArchiveMaxAge).Unix())
+		report.ArchiveDeleted = deleted
+		if err != nil {
+			errs = append(errs, "archive: "+err.Error())
+		}
+	}
+	report.Error = strings.Join(errs, "; ")
+	report.DurationMS = float64(time.Since(start).Microseconds()) / 1000
+
+	if report.MediaDeleted > 0 || report.ArchiveDeleted > 0 {
+		log.Printf("🧹 Cleanup (%s): %d media files (%s) and %d archived messages deleted; %d files (%s) kept",
+			trigger, report.MediaDeleted, formatBytes(report.MediaBytesFreed), report.ArchiveDeleted,
+			report.MediaBlobs, formatBytes(report.MediaBytes))
+	}
+	if report.Error != "" {
+		log.Printf("Error during cleanup (%s): %s", trigger, report.Error)
+	}
+	j.last.Store(report)
+	return report
+}
+
+// pruneMedia deletes expired blobs, then the oldest ones over the size cap.
+func (j *Janitor) pruneMedia(ctx context.Context, report *CleanupReport) error {
+	lib := j.bridge.media
+	blobs, err := lib.inventory(ctx)
+	if err != nil {
+		return err
+	}
+	var total int64
+	for _, blob := range blobs {
+		total += blob.size
+	}
+	thumbnails := make(map[string]int64) // sizes of the thumbnails still stored
+	for _, blob := range blobs {
+		if blob.thumbnail {
+			thumbnails[blob.sum] = blob.size
+		}
+	}
+	deleted := func(size int64) {
+		report.MediaDeleted++
+		report.MediaBlobs--
+		report.MediaBytesFreed += size
+		total -= size
+	}
+	cutoff := time.Now().Add(-j.MediaMaxAge).Unix()
+	report.MediaBlobs = len(blobs)
+	for _, blob := range blobs {
+		if _, stored := thumbnails[blob.sum]; blob.thumbnail && !stored {
+			continue // deleted with its media
+		}
+		expired := j.MediaMaxAge > 0 && blob.storedAt < cutoff
+		overCap := j.MediaMaxBytes > 0 && total > j.MediaMaxBytes
+		if !expired && !overCap {
+			continue
+		}
+		if blob.thumbnail {
+			if err := lib.purgeThumbnail(ctx, blob.sum); err != nil {
+				return err
+			}
+		} else if err := lib.Purge(ctx, blob.sum); err != nil {
+			return err
+		} else if size, ok := thumbnails[blob.sum]; ok {
+			deleted(size) // Purge deletes the thumbnail too
+		}
+		delete(thumbnails, blob.sum)
+		deleted(blob.size)
+	}
+	report.MediaBytes = total
+	return nil
+}
+
+// blobEntry is a blob as the janitor sees it.
+type blobEntry struct {
+	sum       string
+	size      int64
+	storedAt  int64
+	thumbnail bool // the thumbnail of the content, not the content
+}
+
+// inventory lists the stored blobs and thumbnails, oldest first.
+func (l *MediaLibrary) inventory(ctx context.Context) ([]blobEntry, error) {
+	entries, err := l.redis.ZRangeWithScores(ctx, mediaBlobsKey, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	pipe := l.redis.Pipeline()
+	sizes := make([]*redis.StringCmd, len(entries))
+	for i, entry := range entries {
+		sizes[i] = pipe.HGet(ctx, mediaBlobKey(entry.Member.(string)), "size")
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+	blobs := make([]blobEntry, len(entries))
+	for i, entry := range entries {
+		size, _ := strconv.ParseInt(sizes[i].Val(), 10, 64)
+		blobs[i] = blobEntry{sum: entry.Member.(string), size: size, storedAt: int64(entry.Score)}
+	}
+
+	thumbs, err := l.redis.ZRangeWithScores(ctx, mediaThumbsKey, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	thumbSizes, err := l.redis.HGetAll(ctx, mediaThumbSizesKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range thumbs {
+		sum := entry.Member.(string)
+		size, _ := strconv.ParseInt(thumbSizes[sum], 10, 64)
+		blobs = append(blobs, blobEntry{sum: sum, size: size, storedAt: int64(entry.Score), thumbnail: true})
+	}
+	sort.SliceStable(blobs, func(i, k int) bool { return blobs[i].storedAt < blobs[k].storedAt })
+	return blobs, nil
+}
+
+// track adds blobs stored before retention existed to the retention index,
+// as if stored now.
+func (l *MediaLibrary) track(ctx context.Context) {
+	iter := l.redis.Scan(ctx, 0, mediaBlobKey("*"), 500).Iterator()
+	now := float64(time.Now().Unix())
+	for iter.Next(ctx) {
+		sum := strings.TrimPrefix(iter.Val(), mediaBlobKey(""))
+		l.redis.ZAddNX(ctx, mediaBlobsKey, &redis.Z{Score: now, Member: sum})
+	}
+	if err := iter.Err(); err != nil {
+		log.Printf("Error indexing stored media for retention: %v", err)
+	}
+}
+
+// Prune deletes the messages archived before the given Unix time, in
+// batches so archiving is not blocked for long, and the reactions made
+// before it. The dashboard projections keep counting them.
+func (a *Archive) Prune(before int64) (int64, error) {
+	const batch = 1000
+	var total int64
+	for {
+		res, err := a.db.Exec(`DELETE FROM messages WHERE id IN
+			(SELECT id FROM messages WHERE timestamp < ? LIMIT ?)`, before, batch)
+		if err != nil {
+			return total, err
+		}
+		n, _ := res.RowsAffected()
+		total += n
+		if n < batch {
+			break
+		}
+	}
+	_, err := a.db.Exec(`DELETE FROM message_reactions WHERE timestamp < ?`, before)
+	return total, err
+}
+
+// handleCleanup serves POST /admin/cleanup, starting a cleanup that
+// GET /admin/cleanup reports on once done.
+func (b *WhatsAppBridge) handleCleanup(w http.ResponseWriter, r *http.Request) {
+	if !b.janitor.Enabled() {
+		writeJSON(w, http.StatusBadRequest, Response{Success: false, Error: "no retention limit is configured"})
+		return
+	}
+	if err := b.janitor.Start(b.ctx, "api"); err != nil {
+		writeJSON(w, http.StatusConflict, Response{Success: false, Error: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusAccepted, Response{Success: true, Data: CleanupStatus{Running: true, Last: b.janitor.last.Load()}})
+}
+
+// CleanupStatus is the response of GET /admin/cleanup.
+type CleanupStatus struct {
+	Running bool           `json:"running"`
+	Last    *CleanupReport `json:"last,omitempty"` // the last finished run
+}
+
+// handleCleanupStatus serves GET /admin/cleanup.
+func (b *WhatsAppBridge) handleCleanupStatus(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, Response{Success: true, Data: CleanupStatus{
+		Running: b.janitor.running.Load(),
+		Last:    b.janitor.last.Load(),
+	}})
+}
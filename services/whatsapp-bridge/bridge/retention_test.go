@@ -0,0 +1,52 @@
+package bridge_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+
+	"github.com/phenobarbital/ai-parrot/whatsapp-bridge/bridge"
+	"github.com/phenobarbital/ai-parrot/whatsapp-bridge/bridgetest"
+)
+
+// runCleanup starts a cleanup through the API and returns its report.
+func runCleanup(t *testing.T, h *bridgetest.Harness) *bridge.CleanupReport {
+	t.Helper()
+	if status, resp := h.Do(http.MethodPost, "/admin/cleanup", nil); status != http.StatusAccepted {
+		t.Fatalf("POST /admin/cleanup = %d %s, want 202", status, resp.Error)
+	}
+	deadline := time.Now().Add(bridgetest.DefaultTimeout)
+	for {
+		_, resp := h.Do(http.MethodGet, "/admin/cleanup", nil)
+		var cleanup bridge.CleanupStatus
+		decodeData(t, resp.Data, &cleanup)
+		if !cleanup.Running && cleanup.Last != nil {
+			return cleanup.Last
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("cleanup did not finish")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestCleanupRunsInBackground(t *testing.T) {
+	h := bridgetest.New(t,
+		bridgetest.WithEnv("MEDIA_DOWNLOAD", "true"),
+		bridgetest.WithEnv("MEDIA_DOWNLOAD_DIR", t.TempDir()),
+		bridgetest.WithEnv("MEDIA_RETENTION_MAX_BYTES", "1"),
+		bridgetest.WithEnv("RETENTION_INTERVAL", "0"),
+	)
+	media := encryptMedia(t, testPNG(t), whatsmeow.MediaImage)
+	receiveImage(h, "IMG1", "5215512345678", serveMedia(t, media.File).URL+"/image", media)
+	h.ExpectEvent(bridge.EventMediaDownloaded)
+
+	if report := runCleanup(t, h); report.Trigger != "api" || report.MediaDeleted != 1 || report.Error != "" {
+		t.Fatalf("cleanup report = %+v", report)
+	}
+	if resp, _ := getMedia(t, h, "IMG1"); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("GET /media/IMG1 after cleanup = %d, want 404", resp.StatusCode)
+	}
+}
@@ -0,0 +1,237 @@
+package bridge
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// RoutingConfig lets several specialized agents share one number by sending
+// each inbound message to the channel of the first matching rule. It is read
+// from ROUTES (inline JSON) or ROUTES_CONFIG (a JSON file):
+//
+//	{
+//	  "chat_tags": {"5215512345678@s.whatsapp.net": ["vip"], "*@g.us": ["group"]},
+//	  "rules": [
+//	    {"name": "sales", "commands": ["/sales"], "keywords": ["price", "buy"],
+//	     "channel": "sales:messages", "sticky": true},
+//	    {"name": "support", "tags": ["vip"], "channel": "support:messages"}
+//	  ]
+//	}
+//
+// A rule matches when all of its chat and tag constraints hold and, if it
+// lists commands or keywords, the text starts with one of the commands or
+// contains one of the keywords as a word. Besides its chat_tags, a chat is
+// tagged with its WhatsApp Business labels (see labels.go). Commands always
+// win and switch a sticky route; otherwise a chat's sticky route
+// (ROUTE_STICKY_TTL, default 24h) is kept before other rules are tried.
+// Unrouted messages keep the sink defaults (whatsapp:messages).
+type RoutingConfig struct {
+	ChatTags map[string][]string `json:"chat_tags,omitempty"` // chat JID glob -> tags
+	Rules    []RouteRule         `json:"rules"`
+}
+
+// RouteRule maps matching messages to a downstream channel.
+type RouteRule struct {
+	Name     string   `json:"name"`
+	Channel  string   `json:"channel"`
+	Commands []string `json:"commands,omitempty"` // e.g. "/sales", matched on the first word
+	Keywords []string `json:"keywords,omitempty"` // case-insensitive whole words
+	Chats    []string `json:"chats,omitempty"`    // chat JID globs
+	Tags     []string `json:"tags,omitempty"`     // any of the chat's tags
+	Sticky   bool     `json:"sticky,omitempty"`   // keep routing the chat here afterwards
+}
+
+// MessageRouter resolves routes for inbound messages. A nil router routes
+// nothing.
+type MessageRouter struct {
+	cfg       RoutingConfig
+	stickyTTL time.Duration
+	bridge    *WhatsAppBridge
+}
+
+// routerFromEnv loads ROUTES / ROUTES_CONFIG, returning nil when neither is set.
+func (b *WhatsAppBridge) routerFromEnv() (*MessageRouter, error) {
+	raw := []byte(envString("ROUTES", ""))
+	if file := envString("ROUTES_CONFIG", ""); file != "" && len(raw) == 0 {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read ROUTES_CONFIG: %v", err)
+		}
+		raw = data
+	}
+	if len(raw) == 0 {
+		return nil, nil
+	}
+
+	var cfg RoutingConfig
+	if err := json.Unmarshal(raw, &cfg); err != nil {
+		return nil, fmt.Errorf("invalid routing configuration: %v", err)
+	}
+	for i, rule := range cfg.Rules {
+		if rule.Channel == "" {
+			return nil, fmt.Errorf("route %d (%s) has no channel", i, rule.Name)
+		}
+		if rule.Name == "" {
+			cfg.Rules[i].Name = rule.Channel
+		}
+	}
+	log.Printf("🧭 Loaded %d routing rule(s)", len(cfg.Rules))
+	return &MessageRouter{
+		cfg:       cfg,
+		stickyTTL: envDuration("ROUTE_STICKY_TTL", 24*time.Hour),
+		bridge:    b,
+	}, nil
+}
+
+// Route returns the rule that should receive a message, or nil.
+func (r *MessageRouter) Route(chat, content string) *RouteRule {
+	if r == nil {
+		return nil
+	}
+	tags := r.tagsFor(chat)
+	command := firstWord(content)
+
+	if command != "" {
+		for i := range r.cfg.Rules {
+			rule := &r.cfg.Rules[i]
+			if rule.scopeMatches(chat, tags) && containsFold(rule.Commands, command) {
+				r.remember(chat, rule)
+				return rule
+			}
+		}
+	}
+
+	if sticky := r.stickyRule(chat); sticky != nil {
+		return sticky
+	}
+
+	words := wordSet(content)
+	for i := range r.cfg.Rules {
+		rule := &r.cfg.Rules[i]
+		if !rule.scopeMatches(chat, tags) {
+			continue
+		}
+		if len(rule.Commands) > 0 || len(rule.Keywords) > 0 {
+			if !rule.keywordMatches(words) {
+				continue
+			}
+		}
+		r.remember(chat, rule)
+		return rule
+	}
+	return nil
+}
+
+// scopeMatches checks the rule's chat and tag constraints.
+func (rule *RouteRule) scopeMatches(chat string, tags []string) bool {
+	if len(rule.Chats) > 0 && !matchesAny(rule.Chats, chat) {
+		return false
+	}
+	if len(rule.Tags) > 0 {
+		for _, tag := range rule.Tags {
+			if containsString(tags, tag) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func (rule *RouteRule) keywordMatches(words map[string]bool) bool {
+	for _, kw := range rule.Keywords {
+		if words[strings.ToLower(kw)] {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *MessageRouter) tagsFor(chat string) []string {
+	var tags []string
+	for pattern, t := range r.cfg.ChatTags {
+		if matchesAny([]string{pattern}, chat) {
+			tags = append(tags, t...)
+		}
+	}
+	return append(tags, r.bridge.labelTags(chat)...)
+}
+
+func stickyRouteKey(chat string) string {
+	return "whatsapp:route:" + chat
+}
+
+func (r *MessageRouter) remember(chat string, rule *RouteRule) {
+	if !rule.Sticky {
+		return
+	}
+	b := r.bridge
+	if err := b.redisClient.Set(b.ctx, stickyRouteKey(chat), rule.Name, r.stickyTTL).Err(); err != nil {
+		log.Printf("Error storing sticky route for %s: %v", chat, err)
+	}
+}
+
+func (r *MessageRouter) stickyRule(chat string) *RouteRule {
+	b := r.bridge
+	name, err := b.redisClient.Get(b.ctx, stickyRouteKey(chat)).Result()
+	if err != nil {
+		return nil
+	}
+	for i := range r.cfg.Rules {
+		if r.cfg.Rules[i].Name == name {
+			// Refresh so an active conversation keeps its route.
+			b.redisClient.Expire(b.ctx, stickyRouteKey(chat), r.stickyTTL)
+			return &r.cfg.Rules[i]
+		}
+	}
+	return nil
+}
+
+// publishMessage publishes an inbound message, on its routed channel when a
+// rule matches.
+func (b *WhatsAppBridge) publishMessage(chat string, msg IncomingMessage) {
+	rule := b.router.Route(chat, msg.Content)
+	if rule == nil {
+		b.publish(EventMessage, chat, msg)
+		return
+	}
+	msg.Route = rule.Name
+	b.sinks.Publish(BridgeEvent{Type: EventMessage, Chat: chat, Payload: msg, Route: rule.Name, Channel: rule.Channel})
+}
+
+// firstWord returns the leading token of text when it looks like a command.
+func firstWord(text string) string {
+	text = strings.TrimSpace(text)
+	if !strings.HasPrefix(text, "/") && !strings.HasPrefix(text, "!") {
+		return ""
+	}
+	if i := strings.IndexFunc(text, unicode.IsSpace); i >= 0 {
+		return text[:i]
+	}
+	return text
+}
+
+// wordSet lowercases text and splits it into words.
+func wordSet(text string) map[string]bool {
+	words := make(map[string]bool)
+	for _, w := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		words[w] = true
+	}
+	return words
+}
+
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
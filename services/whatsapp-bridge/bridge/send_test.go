@@ -0,0 +1,92 @@
+package bridge_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+
+	"github.com/phenobarbital/ai-parrot/whatsapp-bridge/bridge"
+	"github.com/phenobarbital/ai-parrot/whatsapp-bridge/bridgetest"
+)
+
+// onePerMinute lets one message a minute through to each chat.
+var onePerMinute = []bridgetest.Option{
+	bridgetest.WithEnv("RATE_LIMIT_CHAT_PER_MINUTE", "1"),
+	bridgetest.WithEnv("RATE_LIMIT_CHAT_BURST", "1"),
+	bridgetest.WithEnv("RATE_LIMIT_GLOBAL_PER_MINUTE", "0"),
+	bridgetest.WithEnv("RATE_LIMIT_MAX_WAIT", "1s"),
+}
+
+func TestSendRateLimited(t *testing.T) {
+	h := bridgetest.New(t, onePerMinute...)
+	h.Send(bridge.OutgoingMessage{Phone: "5215512345678", Message: "first"})
+
+	status, resp := h.Do(http.MethodPost, "/send", bridge.OutgoingMessage{Phone: "5215512345678", Message: "second"})
+	if status != http.StatusTooManyRequests {
+		t.Fatalf("second send answered %d, want 429: %s", status, resp.Error)
+	}
+	data, _ := resp.Data.(map[string]any)
+	if data["scope"] != "chat" {
+		t.Errorf("rate limit scope = %v, want chat", data["scope"])
+	}
+	if len(h.Sent()) != 1 {
+		t.Errorf("sent %d messages, want 1", len(h.Sent()))
+	}
+}
+
+func TestSendSplitRateLimitedMidway(t *testing.T) {
+	h := bridgetest.New(t, append(onePerMinute,
+		bridgetest.WithEnv("MESSAGE_MAX_LENGTH", "20"),
+		bridgetest.WithEnv("MESSAGE_SPLIT_DELAY", "0"),
+	)...)
+
+	// The first part takes the only token; the second is over the limit.
+	text := strings.Repeat("palabra ", 6)
+	status, resp := h.Do(http.MethodPost, "/send", bridge.OutgoingMessage{Phone: "5215512345678", Message: text})
+	if status == http.StatusOK || status == http.StatusBadRequest || status == http.StatusTooManyRequests {
+		t.Fatalf("partly sent message answered %d: %s", status, resp.Error)
+	}
+	data, _ := resp.Data.(map[string]any)
+	parts, _ := data["part_ids"].([]any)
+	if sent := h.Sent(); len(parts) != 1 || len(sent) != 1 || parts[0] != sent[0].ID {
+		t.Fatalf("part_ids = %v, sent %d parts", data["part_ids"], len(sent))
+	}
+}
+
+func TestSendQueuedOnDisconnect(t *testing.T) {
+	h := bridgetest.New(t)
+	h.Client.FailNextSend(whatsmeow.ErrNotConnected)
+
+	msg := bridge.OutgoingMessage{Phone: "5215512345678", Message: "hola", ClientMessageID: "order-1"}
+	status, resp := h.Do(http.MethodPost, "/send", msg)
+	data, _ := resp.Data.(map[string]any)
+	if status != http.StatusAccepted || !resp.Success || data["status"] != bridge.SendStatusQueued {
+		t.Fatalf("send while disconnected answered %d %v: %s", status, data, resp.Error)
+	}
+	id, _ := data["message_id"].(string)
+
+	// The fake is connected again, so the message is re-sent with its ID.
+	deadline := time.Now().Add(bridgetest.DefaultTimeout)
+	for len(h.Sent()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("queued message was not re-sent")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if sent := h.LastSent(); sent.ID != id {
+		t.Fatalf("re-sent %s, queued %s", sent.ID, id)
+	}
+
+	// A retry gets the queued response back instead of a second send.
+	status, resp = h.Do(http.MethodPost, "/send", msg)
+	data, _ = resp.Data.(map[string]any)
+	if status != http.StatusAccepted || data["message_id"] != id {
+		t.Fatalf("retry answered %d %v", status, data)
+	}
+	if len(h.Sent()) != 1 {
+		t.Fatalf("sent %d messages, want 1", len(h.Sent()))
+	}
+}
@@ -0,0 +1,199 @@
+package bridge
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// SendWindow limits a campaign to local business hours of each recipient,
+// e.g. {"start": "09:00", "end": "20:00"}. A window whose end is before its
+// start spans midnight. Each recipient's timezone is their own "timezone",
+// else the window's Timezone, else one inferred from the phone's country
+// code, else BRIDGE_TIMEZONE.
+type SendWindow struct {
+	Start    string `json:"start"`
+	End      string `json:"end"`
+	Timezone string `json:"timezone,omitempty"`
+}
+
+// sendWindow is a validated SendWindow, in minutes after local midnight.
+type sendWindow struct {
+	start, end int
+	location   *time.Location // nil to infer per recipient
+}
+
+func (w *SendWindow) parse() (*sendWindow, error) {
+	if w == nil {
+		return nil, nil
+	}
+	start, err := parseClock(w.Start)
+	if err != nil {
+		return nil, fmt.Errorf("send_window.start: %v", err)
+	}
+	end, err := parseClock(w.End)
+	if err != nil {
+		return nil, fmt.Errorf("send_window.end: %v", err)
+	}
+	if start == end {
+		return nil, fmt.Errorf("send_window start and end must differ")
+	}
+	parsed := &sendWindow{start: start, end: end}
+	if w.Timezone != "" {
+		if parsed.location, err = time.LoadLocation(w.Timezone); err != nil {
+			return nil, fmt.Errorf("send_window.timezone: %v", err)
+		}
+	}
+	return parsed, nil
+}
+
+// parseClock reads "HH:MM" as minutes after midnight.
+func parseClock(v string) (int, error) {
+	t, err := time.Parse("15:04", v)
+	if err != nil {
+		return 0, fmt.Errorf("expected HH:MM, got %q", v)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// opensIn returns how long until the window opens at loc, or 0 while open.
+func (w *sendWindow) opensIn(loc *time.Location, now time.Time) time.Duration {
+	if w == nil {
+		return 0
+	}
+	local := now.In(loc)
+	minute := local.Hour()*60 + local.Minute()
+	open := minute >= w.start && minute < w.end
+	if w.start > w.end {
+		open = minute >= w.start || minute < w.end
+	}
+	if open {
+		return 0
+	}
+	next := time.Date(local.Year(), local.Month(), local.Day(), w.start/60, w.start%60, 0, 0, loc)
+	if !next.After(local) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next.Sub(local)
+}
+
+// locationFor picks the timezone the window applies in for a recipient.
+func (w *sendWindow) locationFor(recipient BulkRecipient, fallback *time.Location) *time.Location {
+	if w == nil {
+		return fallback
+	}
+	if recipient.Timezone != "" {
+		if loc, err := time.LoadLocation(recipient.Timezone); err == nil {
+			return loc
+		}
+	}
+	if w.location != nil {
+		return w.location
+	}
+	if recipient.ChatType == "" || recipient.ChatType == "user" {
+		user, _, _ := strings.Cut(recipient.Phone, "@")
+		if phone, err := normalizePhone(user); err == nil {
+			if loc := phoneLocation(phone); loc != nil {
+				return loc
+			}
+		}
+	}
+	return fallback
+}
+
+// countryTimezones maps calling codes to the timezone most of the country's
+// population lives in. Countries spanning several zones (+1, +7, +55, +61)
+// get their most populous one; set the recipient's timezone where that is
+// not good enough.
+var countryTimezones = map[string]string{
+	"1":   "America/New_York",
+	"7":   "Europe/Moscow",
+	"20":  "Africa/Cairo",
+	"27":  "Africa/Johannesburg",
+	"30":  "Europe/Athens",
+	"31":  "Europe/Amsterdam",
+	"32":  "Europe/Brussels",
+	"33":  "Europe/Paris",
+	"34":  "Europe/Madrid",
+	"36":  "Europe/Budapest",
+	"39":  "Europe/Rome",
+	"40":  "Europe/Bucharest",
+	"41":  "Europe/Zurich",
+	"43":  "Europe/Vienna",
+	"44":  "Europe/London",
+	"45":  "Europe/Copenhagen",
+	"46":  "Europe/Stockholm",
+	"47":  "Europe/Oslo",
+	"48":  "Europe/Warsaw",
+	"49":  "Europe/Berlin",
+	"51":  "America/Lima",
+	"52":  "America/Mexico_City",
+	"53":  "America/Havana",
+	"54":  "America/Argentina/Buenos_Aires",
+	"55":  "America/Sao_Paulo",
+	"56":  "America/Santiago",
+	"57":  "America/Bogota",
+	"58":  "America/Caracas",
+	"60":  "Asia/Kuala_Lumpur",
+	"61":  "Australia/Sydney",
+	"62":  "Asia/Jakarta",
+	"63":  "Asia/Manila",
+	"64":  "Pacific/Auckland",
+	"65":  "Asia/Singapore",
+	"66":  "Asia/Bangkok",
+	"81":  "Asia/Tokyo",
+	"82":  "Asia/Seoul",
+	"84":  "Asia/Ho_Chi_Minh",
+	"86":  "Asia/Shanghai",
+	"90":  "Europe/Istanbul",
+	"91":  "Asia/Kolkata",
+	"92":  "Asia/Karachi",
+	"93":  "Asia/Kabul",
+	"94":  "Asia/Colombo",
+	"95":  "Asia/Yangon",
+	"98":  "Asia/Tehran",
+	"212": "Africa/Casablanca",
+	"213": "Africa/Algiers",
+	"216": "Africa/Tunis",
+	"234": "Africa/Lagos",
+	"233": "Africa/Accra",
+	"254": "Africa/Nairobi",
+	"255": "Africa/Dar_es_Salaam",
+	"256": "Africa/Kampala",
+	"351": "Europe/Lisbon",
+	"353": "Europe/Dublin",
+	"358": "Europe/Helsinki",
+	"380": "Europe/Kyiv",
+	"420": "Europe/Prague",
+	"502": "America/Guatemala",
+	"503": "America/El_Salvador",
+	"504": "America/Tegucigalpa",
+	"505": "America/Managua",
+	"506": "America/Costa_Rica",
+	"507": "America/Panama",
+	"591": "America/La_Paz",
+	"593": "America/Guayaquil",
+	"595": "America/Asuncion",
+	"598": "America/Montevideo",
+	"880": "Asia/Dhaka",
+	"966": "Asia/Riyadh",
+	"971": "Asia/Dubai",
+	"972": "Asia/Jerusalem",
+}
+
+// phoneLocation infers a timezone from the calling code of an international
+// phone number, or returns nil.
+func phoneLocation(phone string) *time.Location {
+	for n := 3; n >= 1; n-- {
+		if len(phone) <= n {
+			continue
+		}
+		if name, ok := countryTimezones[phone[:n]]; ok {
+			if loc, err := time.LoadLocation(name); err == nil {
+				return loc
+			}
+			return nil
+		}
+	}
+	return nil
+}
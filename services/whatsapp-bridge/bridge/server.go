@@ -0,0 +1,249 @@
+package bridge
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Configure loads every optional component from the environment: error
+// reporting, on-call alerts, authentication, health tracking, message
+// splitting, media policy, storage and downloads, country policies,
+// translation, routing, digests, reply debouncing, the sink fan-out and the
+// gRPC API.
+func (b *WhatsAppBridge) Configure() error {
+	var err error
+	b.callbackURL = envString("CALLBACK_URL", "")
+	b.reporter = NewErrorReporterFromEnv()
+	if b.notifier, err = telegramNotifierFromEnv(); err != nil {
+		return err
+	}
+
+	if b.events, err = eventFilterFromEnv(); err != nil {
+		return err
+	}
+	b.auth = NewAuthenticatorFromEnv()
+	b.health = b.healthTrackerFromEnv()
+	b.splitter = messageSplitterFromEnv()
+	b.pacer = b.pacerFromEnv()
+	b.sendSlots = sendSlotsFromEnv()
+	b.mediaPolicy = mediaPolicyFromEnv()
+	if b.media, err = mediaLibraryFromEnv(b.redisClient); err != nil {
+		return err
+	}
+	if b.downloader, err = b.mediaDownloaderFromEnv(); err != nil {
+		return err
+	}
+	b.janitor = b.janitorFromEnv()
+	b.thumbnails = b.thumbnailerFromEnv()
+	b.inbound = b.inboundWorkersFromEnv()
+	b.feedback = b.feedbackFromEnv()
+	b.idle = b.idleWatcherFromEnv()
+	b.consent = consentPolicyFromEnv()
+	b.verification = recipientVerificationFromEnv()
+	b.business = businessLookupFromEnv()
+	if b.countryPolicies, err = countryPoliciesFromEnv(); err != nil {
+		return err
+	}
+	b.translator = b.translatorFromEnv()
+	if b.transforms, err = outboundTransformsFromEnv(); err != nil {
+		return err
+	}
+	if b.router, err = b.routerFromEnv(); err != nil {
+		return err
+	}
+	b.digester = b.digesterFromEnv()
+	b.debouncer = b.debouncerFromEnv()
+	b.campaigns = b.campaignerFromEnv()
+	b.liveLocationTTL = max(envDuration("LIVE_LOCATION_TTL", 8*time.Hour), time.Second)
+	if b.chatwoot, err = b.chatwootFromEnv(); err != nil {
+		return err
+	}
+	if b.matrix, err = b.matrixFromEnv(); err != nil {
+		return err
+	}
+
+	if err := b.setupSinks(); err != nil {
+		return err
+	}
+	if b.grpc = b.grpcServerFromEnv(); b.grpc != nil {
+		b.AddSink(b.grpc, SinkConfig{Name: "grpc", Type: "grpc"})
+	}
+	b.AddSink(wsEventSink{bridge: b}, SinkConfig{Name: "ws", Type: "ws"})
+	if b.sse = b.sseHubFromEnv(); b.sse != nil {
+		b.AddSink(b.sse, SinkConfig{Name: "sse", Type: "sse", Events: sseEventTypes})
+	}
+	return nil
+}
+
+// Start opens the archive and launches background workers. It runs after
+// InitializeWhatsApp, which creates the data directory.
+func (b *WhatsAppBridge) Start() error {
+	b.enterPhase(b.ctx, PhaseStarting)
+	var err error
+	if b.archiveDB, err = OpenArchiveFromEnv(); err != nil {
+		return err
+	}
+	if b.consent.required && b.archiveDB == nil {
+		return fmt.Errorf("CONSENT_REQUIRED needs the archive (ARCHIVE_ENABLED)")
+	}
+	if b.digester != nil {
+		go b.digester.Run(b.ctx)
+	}
+	go b.campaigns.Run(b.ctx)
+	b.inbound.Run()
+	b.downloader.Resume(b.ctx)
+	go b.janitor.Run(b.ctx)
+	go b.idle.Run(b.ctx)
+	if cfg := outgoingStreamConfigFromEnv(); cfg != nil {
+		go b.consumeOutgoingStream(cfg)
+	}
+	if cfg := outgoingChannelConfigFromEnv(); cfg != nil {
+		go b.subscribeOutgoing(cfg)
+	}
+	if cfg := natsOutgoingConfigFromEnv(); cfg != nil {
+		go b.consumeNATSOutgoing(cfg)
+	}
+	if cfg := kafkaOutboundConfigFromEnv(); cfg != nil {
+		go b.consumeKafkaOutbound(cfg)
+	}
+	if cfg := amqpOutboundConfigFromEnv(); cfg != nil {
+		go b.consumeAMQPOutbound(cfg)
+	}
+	if cfg := mqttOutboundConfigFromEnv(); cfg != nil {
+		go b.subscribeMQTTOutbound(cfg)
+	}
+	if b.grpc != nil {
+		go b.grpc.serve()
+	}
+	return nil
+}
+
+// AddSink registers an extra event destination alongside the configured ones.
+func (b *WhatsAppBridge) AddSink(sink MessageSink, cfg SinkConfig) {
+	b.sinks.Add(sink, cfg)
+	runner := b.sinks.runners[len(b.sinks.runners)-1]
+	go runner.run(b.ctx, b.sinks)
+}
+
+// WriteTimeout is how long the HTTP server gives a request to answer; API
+// sends never wait on the pacer longer than it allows.
+const WriteTimeout = 15 * time.Second
+
+// Handler returns the HTTP API with access logging, recovery,
+// authentication and CORS applied.
+func (b *WhatsAppBridge) Handler() http.Handler {
+	router := mux.NewRouter()
+	router.HandleFunc("/health", b.handleHealth).Methods("GET")
+	router.HandleFunc("/events", b.handleEvents).Methods("GET")
+	router.HandleFunc("/metrics", b.handleMetrics).Methods("GET")
+	router.HandleFunc("/send", b.handleSend).Methods("POST")
+	router.HandleFunc("/send/voice", b.handleSendVoice).Methods("POST")
+	router.HandleFunc("/send/contacts", b.handleSendContacts).Methods("POST")
+	router.HandleFunc("/send/poll", b.handleSendPoll).Methods("POST")
+	router.HandleFunc("/send/bulk", b.handleSendBulk).Methods("POST")
+	router.HandleFunc("/policy/evaluate", b.handleEvaluatePolicy).Methods("POST")
+	router.HandleFunc("/send/bulk/{id}", b.handleGetCampaign).Methods("GET")
+	router.HandleFunc("/send/bulk/{id}", b.handleCancelCampaign).Methods("DELETE")
+	router.HandleFunc("/broadcast-lists", b.handleListBroadcastLists).Methods("GET")
+	router.HandleFunc("/broadcast-lists/{id}", b.handleGetBroadcastList).Methods("GET")
+	router.HandleFunc("/broadcast-lists/{id}", b.handlePutBroadcastList).Methods("PUT")
+	router.HandleFunc("/broadcast-lists/{id}", b.handleDeleteBroadcastList).Methods("DELETE")
+	router.HandleFunc("/broadcast-lists/{id}/send", b.handleSendBroadcast).Methods("POST")
+	router.HandleFunc("/messages/{id}/react", b.handleReact).Methods("POST")
+	router.HandleFunc("/messages/{id}/reactions", b.handleMessageReactions).Methods("GET")
+	router.HandleFunc("/messages/{id}", b.handleEditMessage).Methods("PATCH")
+	router.HandleFunc("/messages/{id}/status", b.handleMessageStatus).Methods("GET")
+	router.HandleFunc("/media/{id}", b.handleGetMedia).Methods("GET")
+	router.HandleFunc("/media/{id}", b.handleDeleteMedia).Methods("DELETE")
+	router.HandleFunc("/media/{id}/thumbnail", b.handleGetThumbnail).Methods("GET")
+	router.HandleFunc("/qr", b.handleQRPage).Methods("GET")
+	router.HandleFunc("/qr.png", b.handleQRCode).Methods("GET")
+	router.HandleFunc("/ws", b.handleWebSocket)
+	router.HandleFunc("/pair/code", b.handlePairCode).Methods("POST")
+	router.HandleFunc("/archive/messages", b.handleArchiveMessages).Methods("GET")
+	router.HandleFunc("/archive/export", b.handleArchiveExport).Methods("GET")
+	router.HandleFunc("/archive/finetune", b.handleFineTuneExport).Methods("GET")
+	router.HandleFunc("/dashboard/chats", b.handleDashboardChats).Methods("GET")
+	router.HandleFunc("/dashboard/daily", b.handleDashboardDaily).Methods("GET")
+	router.HandleFunc("/dashboard/contacts", b.handleDashboardContacts).Methods("GET")
+	router.HandleFunc("/labels", b.handleListLabels).Methods("GET")
+	router.HandleFunc("/chats/{chat}/labels", b.handleGetChatLabels).Methods("GET")
+	router.HandleFunc("/chats/{chat}/labels/{label}", b.handlePutChatLabel).Methods("PUT")
+	router.HandleFunc("/chats/{chat}/labels/{label}", b.handleDeleteChatLabel).Methods("DELETE")
+	router.HandleFunc("/contacts/consent/import", b.handleImportConsent).Methods("POST")
+	router.HandleFunc("/contacts/{id}", b.handleGetContact).Methods("GET")
+	router.HandleFunc("/contacts/{id}/consent", b.handlePutConsent).Methods("PUT")
+	router.HandleFunc("/admin/accounts/{id}/health", b.handleAccountHealth).Methods("GET")
+	if b.chatwoot != nil && b.chatwoot.webhookToken != "" {
+		// Public route: only served when the token authenticates it.
+		router.HandleFunc("/chatwoot/webhook", b.handleChatwootWebhook).Methods("POST")
+	}
+	router.HandleFunc("/_matrix/app/v1/transactions/{txn}", b.handleMatrixTransaction).Methods("PUT")
+	router.HandleFunc("/admin/resync", b.handleResync).Methods("POST")
+	router.HandleFunc("/admin/verify-session", b.handleVerifySession).Methods("POST")
+	router.HandleFunc("/admin/device", b.handleGetDevice).Methods("GET")
+	router.HandleFunc("/admin/cleanup", b.handleCleanupStatus).Methods("GET")
+	router.HandleFunc("/admin/cleanup", b.handleCleanup).Methods("POST")
+	router.HandleFunc("/admin/maintenance", b.handleGetMaintenance).Methods("GET")
+	router.HandleFunc("/admin/maintenance", b.handleStartMaintenance).Methods("POST")
+	router.HandleFunc("/admin/maintenance", b.handleStopMaintenance).Methods("DELETE")
+	router.HandleFunc("/admin/webhooks/failures", b.handleListWebhookFailures).Methods("GET")
+	router.HandleFunc("/admin/webhooks/failures/{id}/retry", b.handleRetryWebhookFailure).Methods("POST")
+	router.HandleFunc("/admin/webhooks/failures/{id}", b.handleDeleteWebhookFailure).Methods("DELETE")
+	router.HandleFunc("/admin/templates", b.handleListTemplates).Methods("GET")
+	router.HandleFunc("/admin/usage", b.handleUsage).Methods("GET")
+	router.HandleFunc("/admin/templates/{name}", b.handleGetTemplate).Methods("GET")
+	router.HandleFunc("/admin/templates/{name}", b.handlePutTemplate).Methods("PUT")
+	router.HandleFunc("/admin/templates/{name}", b.handleDeleteTemplate).Methods("DELETE")
+
+	router.Use(b.recoverMiddleware)
+	router.Use(b.auth.Middleware)
+	router.Use(b.usageMiddleware)
+	router.Use(b.drainMiddleware)
+	router.Use(rateLimitMiddleware)
+
+	// CORS middleware
+	router.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-API-Key, X-Request-ID")
+			w.Header().Set("Access-Control-Expose-Headers", "X-Request-ID")
+			if r.Method == "OPTIONS" {
+				w.WriteHeader(http.StatusOK)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	})
+	return accessLogMiddleware(router)
+}
+
+// Shutdown drains the bridge if Drain was not called, flushes buffered
+// digests and debounced bursts, disconnects from WhatsApp and waits for the
+// sinks to deliver the remaining events and error reports.
+func (b *WhatsAppBridge) Shutdown() {
+	if !b.lifecycle.markStopped() {
+		return
+	}
+	b.Drain(b.ctx)
+	if b.client != nil {
+		b.client.Disconnect()
+	}
+	// Messages received before the disconnect are still processed.
+	b.inbound.Close()
+	b.thumbnails.Wait()
+	b.digester.Flush()
+	b.debouncer.Flush()
+	b.enterPhase(b.ctx, PhaseStopped)
+	if !b.sinks.Flush(envDuration("LIFECYCLE_FLUSH_TIMEOUT", 5*time.Second)) {
+		log.Printf("⚠️ Some events were not delivered before shutdown")
+	}
+	b.reporter.Flush(2 * time.Second)
+	// Stops the workers, janitors and whatever still runs on b.ctx.
+	b.cancel()
+}
@@ -0,0 +1,97 @@
+package bridge
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+)
+
+// POST /admin/verify-session confirms the stored session still works by
+// looking up the bridge's own number on WhatsApp, a usync round-trip the
+// server refuses for a revoked session, instead of waiting for the next
+// send to fail. The result is returned, 503 unless valid so cron checks
+// can use the status alone, and published as a session_verified event.
+//
+//	SESSION_VERIFY_TIMEOUT - how long the round-trip may take (default 10s)
+
+// EventSessionVerified is published with the result of each verification.
+const EventSessionVerified = "session_verified"
+
+// Session verification outcomes.
+const (
+	SessionValid        = "valid"
+	SessionNotPaired    = "not_paired"   // no session stored
+	SessionDisconnected = "disconnected" // not connected to WhatsApp
+	SessionFailed       = "failed"       // the round-trip failed
+	SessionTimeout      = "timeout"      // the round-trip took longer than SESSION_VERIFY_TIMEOUT
+)
+
+// SessionVerification is the result of POST /admin/verify-session and the
+// payload of session_verified events.
+type SessionVerification struct {
+	Valid     bool    `json:"valid"`
+	Status    string  `json:"status"`
+	JID       string  `json:"jid,omitempty"`
+	Error     string  `json:"error,omitempty"`
+	LatencyMS float64 `json:"latency_ms,omitempty"` // of the round-trip
+	Operator  string  `json:"operator,omitempty"`
+	Timestamp int64   `json:"timestamp"`
+}
+
+// verifySession runs the round-trip.
+func (b *WhatsAppBridge) verifySession(ctx context.Context) SessionVerification {
+	result := SessionVerification{Timestamp: time.Now().Unix()}
+	device := b.client.Device()
+	if device == nil || device.ID == nil {
+		result.Status = SessionNotPaired
+		result.Error = "no session is stored"
+		return result
+	}
+	result.JID = device.ID.ToNonAD().String()
+	if !b.client.IsConnected() {
+		result.Status = SessionDisconnected
+		result.Error = "not connected to WhatsApp"
+		return result
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, envDuration("SESSION_VERIFY_TIMEOUT", 10*time.Second))
+	defer cancel()
+	start := time.Now()
+	resp, err := b.client.IsOnWhatsApp(ctx, []string{"+" + device.ID.User})
+	result.LatencyMS = float64(time.Since(start).Microseconds()) / 1000
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		result.Status = SessionTimeout
+		result.Error = err.Error()
+	case err != nil:
+		result.Status = SessionFailed
+		result.Error = err.Error()
+	case len(resp) == 0 || !resp[0].IsIn:
+		result.Status = SessionFailed
+		result.Error = "own number is not on WhatsApp"
+	default:
+		result.Status = SessionValid
+		result.Valid = true
+	}
+	return result
+}
+
+// handleVerifySession serves POST /admin/verify-session.
+func (b *WhatsAppBridge) handleVerifySession(w http.ResponseWriter, r *http.Request) {
+	result := b.verifySession(r.Context())
+	result.Operator = operatorFromContext(r.Context())
+	if result.Valid {
+		log.Printf("🔐 Session of %s verified in %.0fms", result.JID, result.LatencyMS)
+	} else {
+		log.Printf("⚠️ Session verification failed: %s %s", result.Status, result.Error)
+	}
+	b.publish(EventSessionVerified, "", result)
+
+	status := http.StatusOK
+	if !result.Valid {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, Response{Success: result.Valid, Data: result, Error: result.Error})
+}
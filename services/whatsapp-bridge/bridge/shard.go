@@ -0,0 +1,19 @@
+package bridge
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// shardKey is the shard_key of events about chat: the first 16 hex digits
+// of the SHA-256 of its JID. It is the same on every bridge instance and
+// across restarts, so consumers scaled out behind Redis Streams, Kafka or
+// any other sink can route all of a chat's events to the same worker, e.g.
+// by taking it modulo their worker count. Events without a chat have none.
+func shardKey(chat string) string {
+	if chat == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(chat))
+	return hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,525 @@
+package bridge
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Event types published through the sink fan-out.
+const (
+	EventMessage = "message"
+)
+
+// Delivery guarantees a sink can be configured with.
+const (
+	DeliveryAtMostOnce  = "at_most_once"  // single attempt, dropped on failure
+	DeliveryAtLeastOnce = "at_least_once" // retried with backoff until MaxRetries
+)
+
+// BridgeEvent is a single event offered to every configured sink.
+type BridgeEvent struct {
+	Type     string       // event type, e.g. EventMessage
+	Chat     string       // chat JID the event belongs to, used by chat filters
+	Payload  interface{}  // JSON-serializable body
+	Route    string       // routing rule name, set for routed messages
+	Channel  string       // routed destination, overriding the sink's default channel
+	Bot      *BotIdentity // account the event belongs to, set by the fan-out
+	ShardKey string       // hash of Chat for partitioning consumers, set by the fan-out
+}
+
+// MessageSink delivers bridge events to one downstream destination.
+type MessageSink interface {
+	Name() string
+	Deliver(ctx context.Context, evt BridgeEvent) error
+}
+
+// SinkConfig describes one destination in SINKS / SINKS_CONFIG.
+//
+//	[
+//	  {"name": "agent", "type": "redis"},
+//	  {"name": "audit", "type": "redis_stream", "stream": "whatsapp:events"},
+//	  {"name": "crm", "type": "webhook", "url": "https://crm/hook",
+//	   "events": ["message"], "chats": ["*@s.whatsapp.net"],
+//	   "delivery": "at_least_once", "max_retries": 8, "profile": "chatwoot"}
+//	]
+//
+// PAYLOAD_PROFILE sets the profile of sinks that don't name one; chatwoot and
+// matrix sinks always use the default.
+type SinkConfig struct {
+	Name         string            `json:"name"`
+	Type         string            `json:"type"`               // redis, redis_stream, nats, kafka, amqp, mqtt, webhook, stdout, chatwoot, matrix
+	URL          string            `json:"url,omitempty"`      // webhook target; nats server (default NATS_URL); kafka brokers (default KAFKA_BROKERS); amqp broker (default AMQP_URL); mqtt broker (default MQTT_URL)
+	Channels     map[string]string `json:"channels,omitempty"` // redis, redis_stream, nats, kafka, amqp, mqtt: event type -> channel, stream, subject, topic or routing key override
+	Stream       string            `json:"stream,omitempty"`   // redis_stream: default stream (whatsapp:events); nats: JetStream stream
+	Subject      string            `json:"subject,omitempty"`  // nats: subject prefix (default NATS_EVENTS_SUBJECT)
+	Topic        string            `json:"topic,omitempty"`    // kafka: topic (default KAFKA_INBOUND_TOPIC); mqtt: topic prefix (default MQTT_INBOUND_TOPIC)
+	Exchange     string            `json:"exchange,omitempty"` // amqp: topic exchange (default AMQP_EXCHANGE)
+	Secret       string            `json:"secret,omitempty"`   // webhook: HMAC key signing requests (default WEBHOOK_SECRET)
+	MaxLen       int64             `json:"max_len,omitempty"`  // redis_stream: approximate cap (default 100000)
+	Events       []string          `json:"events,omitempty"`   // empty = all event types
+	Chats        []string          `json:"chats,omitempty"`    // glob patterns on chat JID; empty = all
+	ExcludeChats []string          `json:"exclude_chats,omitempty"`
+	Routes       []string          `json:"routes,omitempty"`  // only events routed by these rules
+	Profile      string            `json:"profile,omitempty"` // message schema: default, chatwoot, minimal
+	Delivery     string            `json:"delivery,omitempty"`
+	MaxRetries   int               `json:"max_retries,omitempty"`
+	QueueSize    int               `json:"queue_size,omitempty"`
+}
+
+// sinkRunner owns a sink's queue and worker so a slow or failing sink never
+// blocks the others.
+type sinkRunner struct {
+	sink    MessageSink
+	cfg     SinkConfig
+	queue   chan BridgeEvent
+	pending atomic.Int64 // queued or being delivered
+}
+
+// FanOut dispatches events to every sink whose filters accept them.
+type FanOut struct {
+	runners  []*sinkRunner
+	reporter *ErrorReporter
+	identity func() *BotIdentity
+	failures *webhookFailures
+}
+
+// setupSinks builds the fan-out from SINKS (inline JSON) or SINKS_CONFIG (a
+// JSON file). Without either, it reproduces the classic behavior: one sink
+// of type TRANSPORT (default redis, i.e. pub/sub), plus the HTTP callback
+// when CALLBACK_URL is set and a webhook per WEBHOOK_URLS entry.
+func (b *WhatsAppBridge) setupSinks() error {
+	var configs []SinkConfig
+
+	raw := []byte(envString("SINKS", ""))
+	if file := envString("SINKS_CONFIG", ""); file != "" && len(raw) == 0 {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("failed to read SINKS_CONFIG: %v", err)
+		}
+		raw = data
+	}
+
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &configs); err != nil {
+			return fmt.Errorf("invalid sinks configuration: %v", err)
+		}
+	} else {
+		transport := envString("TRANSPORT", "redis")
+		configs = append(configs, SinkConfig{Name: transport, Type: transport})
+		if b.callbackURL != "" {
+			configs = append(configs, SinkConfig{Name: "callback", Type: "webhook", URL: b.callbackURL})
+		}
+		configs = append(configs, webhookConfigsFromEnv()...)
+		if b.chatwoot != nil {
+			configs = append(configs, SinkConfig{Name: "chatwoot", Type: "chatwoot",
+				Events: []string{EventMessage}, Delivery: DeliveryAtLeastOnce})
+		}
+		if b.matrix != nil {
+			configs = append(configs, SinkConfig{Name: "matrix", Type: "matrix",
+				Events: []string{EventMessage}, Delivery: DeliveryAtLeastOnce})
+		}
+	}
+
+	defaultProfile := envString("PAYLOAD_PROFILE", ProfileDefault)
+	fanOut := &FanOut{reporter: b.reporter, identity: b.botIdentityFromEnv(), failures: b.webhookFailures()}
+	for i, cfg := range configs {
+		if cfg.Name == "" {
+			cfg.Name = fmt.Sprintf("%s-%d", cfg.Type, i)
+		}
+		if cfg.Type == "chatwoot" || cfg.Type == "matrix" {
+			// The connectors read IncomingMessage themselves.
+			if cfg.Profile != "" && cfg.Profile != ProfileDefault {
+				return fmt.Errorf("sink %s: %s sinks only take the %s profile", cfg.Name, cfg.Type, ProfileDefault)
+			}
+			cfg.Profile = ProfileDefault
+		}
+		if cfg.Profile == "" {
+			cfg.Profile = defaultProfile
+		}
+		if err := validateProfile(cfg.Profile); err != nil {
+			return fmt.Errorf("sink %s: %v", cfg.Name, err)
+		}
+		sink, err := b.newSink(cfg)
+		if err != nil {
+			return fmt.Errorf("sink %s: %v", cfg.Name, err)
+		}
+		fanOut.Add(sink, cfg)
+		log.Printf("📤 Sink %s (%s) enabled", cfg.Name, cfg.Type)
+	}
+
+	b.sinks = fanOut
+	fanOut.Start(b.ctx)
+	return nil
+}
+
+func (b *WhatsAppBridge) newSink(cfg SinkConfig) (MessageSink, error) {
+	switch cfg.Type {
+	case "redis":
+		return &redisSink{name: cfg.Name, client: b.redisClient, channels: cfg.Channels}, nil
+	case "webhook":
+		if cfg.URL == "" {
+			return nil, fmt.Errorf("webhook sink requires url")
+		}
+		secret := cfg.Secret
+		if secret == "" {
+			secret = envString("WEBHOOK_SECRET", "")
+		}
+		return &webhookSink{name: cfg.Name, url: cfg.URL, secret: []byte(secret), client: &http.Client{Timeout: 10 * time.Second}}, nil
+	case "redis_stream":
+		stream, maxLen := cfg.Stream, cfg.MaxLen
+		if stream == "" {
+			stream = "whatsapp:events"
+		}
+		if maxLen <= 0 {
+			maxLen = 100000
+		}
+		return &redisStreamSink{name: cfg.Name, client: b.redisClient, stream: stream, streams: cfg.Channels, maxLen: maxLen}, nil
+	case "stdout":
+		b.stdoutSink = true
+		return &writerSink{name: cfg.Name, w: os.Stdout}, nil
+	case "nats":
+		return b.newNATSSink(cfg)
+	case "kafka":
+		return b.newKafkaSink(cfg), nil
+	case "amqp":
+		return b.newAMQPSink(cfg), nil
+	case "mqtt":
+		return b.newMQTTSink(cfg), nil
+	case "chatwoot":
+		if b.chatwoot == nil {
+			return nil, fmt.Errorf("chatwoot sink requires CHATWOOT_URL")
+		}
+		return b.chatwoot, nil
+	case "matrix":
+		if b.matrix == nil {
+			return nil, fmt.Errorf("matrix sink requires MATRIX_HOMESERVER_URL")
+		}
+		return b.matrix, nil
+	}
+	return nil, fmt.Errorf("unknown sink type %q", cfg.Type)
+}
+
+// Add registers a sink with its filters and delivery policy.
+func (f *FanOut) Add(sink MessageSink, cfg SinkConfig) {
+	if cfg.Delivery == "" {
+		cfg.Delivery = DeliveryAtMostOnce
+	}
+	if cfg.Delivery == DeliveryAtLeastOnce && cfg.MaxRetries == 0 {
+		cfg.MaxRetries = 5
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = 1000
+	}
+	f.runners = append(f.runners, &sinkRunner{
+		sink:  sink,
+		cfg:   cfg,
+		queue: make(chan BridgeEvent, cfg.QueueSize),
+	})
+}
+
+// Start launches one worker per sink.
+func (f *FanOut) Start(ctx context.Context) {
+	for _, r := range f.runners {
+		go r.run(ctx, f)
+	}
+}
+
+// Publish enqueues evt on every accepting sink without blocking; a full
+// queue drops the event for that sink only.
+func (f *FanOut) Publish(evt BridgeEvent) {
+	if f == nil {
+		return
+	}
+	if f.identity != nil {
+		evt.Bot = f.identity()
+	}
+	evt.ShardKey = shardKey(evt.Chat)
+	for _, r := range f.runners {
+		if !r.accepts(evt) {
+			continue
+		}
+		r.pending.Add(1)
+		select {
+		case r.queue <- evt:
+			bufferMarks.observe("sink_queue", r.cfg.Name, int64(len(r.queue)))
+		default:
+			r.pending.Add(-1)
+			log.Printf("⚠️ Sink %s queue full, dropping %s event", r.cfg.Name, evt.Type)
+			f.reporter.CaptureMessage("warning", "sink_overflow", "sink queue full", map[string]string{
+				"sink":  r.cfg.Name,
+				"event": evt.Type,
+			})
+		}
+	}
+}
+
+func (r *sinkRunner) accepts(evt BridgeEvent) bool {
+	if len(r.cfg.Events) > 0 && !containsString(r.cfg.Events, evt.Type) {
+		return false
+	}
+	if len(r.cfg.Routes) > 0 && !containsString(r.cfg.Routes, evt.Route) {
+		return false
+	}
+	if len(r.cfg.Chats) > 0 && !matchesAny(r.cfg.Chats, evt.Chat) {
+		return false
+	}
+	return !matchesAny(r.cfg.ExcludeChats, evt.Chat)
+}
+
+func (r *sinkRunner) run(ctx context.Context, f *FanOut) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case evt := <-r.queue:
+			r.deliver(ctx, evt, f)
+			r.pending.Add(-1)
+		}
+	}
+}
+
+// Flush waits up to timeout for the events already published to be
+// delivered (or given up), reporting whether every sink caught up.
+func (f *FanOut) Flush(timeout time.Duration) bool {
+	if f == nil {
+		return true
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		idle := true
+		for _, r := range f.runners {
+			if r.pending.Load() > 0 {
+				idle = false
+				break
+			}
+		}
+		if idle {
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// deliver applies the sink's delivery guarantee: one attempt for
+// at-most-once, exponential backoff (capped at 30s) for at-least-once.
+// Webhook events that exhaust their retries, or whose retries are cut
+// short by ctx, go to the failure queue.
+func (r *sinkRunner) deliver(ctx context.Context, evt BridgeEvent, f *FanOut) {
+	evt = applyProfile(r.cfg.Profile, evt)
+	backoff := 500 * time.Millisecond
+	for attempt := 0; ; attempt++ {
+		err := r.sink.Deliver(ctx, evt)
+		if err == nil {
+			return
+		}
+		if attempt >= r.cfg.MaxRetries || ctx.Err() != nil || sleepContext(ctx, backoff) != nil {
+			log.Printf("Sink %s failed to deliver %s event after %d attempt(s): %v",
+				r.cfg.Name, evt.Type, attempt+1, err)
+			f.reporter.Capture(err, "sink_delivery", map[string]string{
+				"sink":  r.cfg.Name,
+				"event": evt.Type,
+				"chat":  evt.Chat,
+			})
+			if r.cfg.Type == "webhook" {
+				f.failures.Add(r.cfg.Name, evt, attempt+1, err)
+			}
+			return
+		}
+		if backoff *= 2; backoff > 30*time.Second {
+			backoff = 30 * time.Second
+		}
+	}
+}
+
+// publish offers an event to all configured sinks.
+func (b *WhatsAppBridge) publish(eventType, chat string, payload interface{}) {
+	if !b.events.Enabled(eventType) {
+		return
+	}
+	b.sinks.Publish(BridgeEvent{Type: eventType, Chat: chat, Payload: payload})
+}
+
+// redisSink publishes events on Redis pub/sub channels.
+type redisSink struct {
+	name     string
+	client   *redis.Client
+	channels map[string]string
+}
+
+func (s *redisSink) Name() string { return s.name }
+
+func (s *redisSink) Deliver(ctx context.Context, evt BridgeEvent) error {
+	data, err := evt.MarshalPayload()
+	if err != nil {
+		return err
+	}
+	return s.client.Publish(ctx, s.channel(evt), data).Err()
+}
+
+// channel picks the Redis channel for evt: its routed channel if any, else
+// the configured override, else whatsapp:messages for "message" events and
+// whatsapp:<type> for anything else.
+func (s *redisSink) channel(evt BridgeEvent) string {
+	if evt.Channel != "" {
+		return evt.Channel
+	}
+	eventType := evt.Type
+	if ch, ok := s.channels[eventType]; ok {
+		return ch
+	}
+	if eventType == EventMessage {
+		return "whatsapp:messages"
+	}
+	return "whatsapp:" + eventType
+}
+
+// redisStreamSink appends events to Redis Streams, which unlike pub/sub
+// keep them for consumers that are offline. Entries carry the event type,
+// chat and route next to the JSON payload.
+type redisStreamSink struct {
+	name    string
+	client  *redis.Client
+	stream  string
+	streams map[string]string
+	maxLen  int64
+}
+
+func (s *redisStreamSink) Name() string { return s.name }
+
+func (s *redisStreamSink) Deliver(ctx context.Context, evt BridgeEvent) error {
+	data, err := evt.MarshalPayload()
+	if err != nil {
+		return err
+	}
+	stream := s.stream
+	if evt.Channel != "" {
+		stream = evt.Channel
+	} else if override, ok := s.streams[evt.Type]; ok {
+		stream = override
+	}
+	return s.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: stream,
+		MaxLen: s.maxLen,
+		Approx: true,
+		Values: map[string]interface{}{
+			"type":      evt.Type,
+			"chat":      evt.Chat,
+			"route":     evt.Route,
+			"shard_key": evt.ShardKey,
+			"payload":   data,
+		},
+	}).Err()
+}
+
+// writerSink writes events as JSON lines, for piping the bridge into other
+// processes and for debugging. Logs go to stderr, and so does the pairing
+// QR code while a stdout sink is configured, so stdout stays clean.
+type writerSink struct {
+	name string
+	mu   sync.Mutex
+	w    io.Writer
+}
+
+func (s *writerSink) Name() string { return s.name }
+
+func (s *writerSink) Deliver(ctx context.Context, evt BridgeEvent) error {
+	payload, err := evt.MarshalPayload()
+	if err != nil {
+		return err
+	}
+	line, err := json.Marshal(struct {
+		Type    string          `json:"type"`
+		Chat    string          `json:"chat,omitempty"`
+		Route   string          `json:"route,omitempty"`
+		Payload json.RawMessage `json:"payload"`
+	}{evt.Type, evt.Chat, evt.Route, payload})
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.w.Write(append(line, '\n'))
+	return err
+}
+
+// webhookSink POSTs events as JSON to an HTTP endpoint. With a secret,
+// requests carry X-Signature-Timestamp (Unix seconds) and
+// X-Signature: sha256=<hex HMAC-SHA256 of "<timestamp>.<body>">, so the
+// receiver can check where they come from and reject replays.
+type webhookSink struct {
+	name   string
+	url    string
+	secret []byte
+	client *http.Client
+}
+
+func (s *webhookSink) Name() string { return s.name }
+
+func (s *webhookSink) Deliver(ctx context.Context, evt BridgeEvent) error {
+	data, err := evt.MarshalPayload()
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Event-Type", evt.Type)
+	if evt.ShardKey != "" {
+		req.Header.Set("X-Shard-Key", evt.ShardKey)
+	}
+	if evt.Route != "" {
+		req.Header.Set("X-Route", evt.Route)
+	}
+	if len(s.secret) > 0 {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set("X-Signature-Timestamp", timestamp)
+		req.Header.Set("X-Signature", "sha256="+webhookSignature(s.secret, timestamp, data))
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("%s returned status %d", s.url, resp.StatusCode)
+	}
+	return nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesAny reports whether s matches any glob pattern (path.Match syntax).
+func matchesAny(patterns []string, s string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, s); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,34 @@
+package bridge
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// failingSink rejects every event, counting the attempts.
+type failingSink struct{ attempts int }
+
+func (s *failingSink) Name() string { return "failing" }
+
+func (s *failingSink) Deliver(context.Context, BridgeEvent) error {
+	s.attempts++
+	return errors.New("unreachable")
+}
+
+func TestSinkRetryStopsOnShutdown(t *testing.T) {
+	sink := &failingSink{}
+	r := &sinkRunner{sink: sink, cfg: SinkConfig{Name: "failing", Type: "stdout", MaxRetries: 10}}
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	start := time.Now()
+	r.deliver(ctx, BridgeEvent{Type: EventMessage}, &FanOut{})
+	if elapsed := time.Since(start); elapsed > 300*time.Millisecond {
+		t.Errorf("deliver kept retrying for %s after shutdown", elapsed)
+	}
+	if sink.attempts != 1 {
+		t.Errorf("attempts = %d, want 1 before the first backoff was cut short", sink.attempts)
+	}
+}
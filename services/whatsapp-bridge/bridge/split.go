@@ -0,0 +1,250 @@
+package bridge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// MessageSplitter breaks texts longer than MESSAGE_MAX_LENGTH (default 4096
+// characters) into parts sent MESSAGE_SPLIT_DELAY apart (default 1s),
+// preferring paragraph, then line, then sentence, then word boundaries.
+// With MESSAGE_SPLIT_NUMBERING each part ends with "(i/n)".
+type MessageSplitter struct {
+	MaxLength int
+	Numbering bool
+	Delay     time.Duration
+}
+
+// SendResult is the outcome of sendOutgoing. The embedded response is the
+// first part's; PartIDs lists every part when the text was split. Template
+// and Variant name what a templated message was rendered from.
+type SendResult struct {
+	whatsmeow.SendResponse
+	PartIDs  []string
+	Template string
+	Variant  string
+	Queued   bool // a part waits to be re-sent after reconnect (see resend.go)
+
+	// Text is the first part as sent: rendered, translated and transformed.
+	// With Type, its archived type, it gives the content_hash of MessageID.
+	Text string
+	Type string
+}
+
+// status is the status reported for a successful send.
+func (r SendResult) status() string {
+	if r.Queued {
+		return SendStatusQueued
+	}
+	return SendStatusSent
+}
+
+// PartialSendError is returned when a split message failed after some of
+// its parts went out. It counts as permanent, so queue consumers don't
+// retry and repeat the parts already delivered, but unwraps to the cause of
+// the failure, which decides how the API reports it.
+type PartialSendError struct {
+	Sent    int
+	Total   int
+	PartIDs []string // of the parts sent
+	Err     error
+}
+
+func (e *PartialSendError) Error() string {
+	return fmt.Sprintf("sent %d of %d parts: %v", e.Sent, e.Total, e.Err)
+}
+
+func (e *PartialSendError) Unwrap() error { return e.Err }
+
+// Is makes a partial send permanent for retrying callers.
+func (e *PartialSendError) Is(target error) bool { return target == errPermanent }
+
+// partialSend wraps err for a message of total parts, result holding the
+// ones sent.
+func partialSend(result SendResult, total int, err error) error {
+	return &PartialSendError{Sent: len(result.PartIDs), Total: total, PartIDs: result.PartIDs, Err: err}
+}
+
+// isPartialSend reports whether err left a message partly sent.
+func isPartialSend(err error) bool {
+	var partial *PartialSendError
+	return errors.As(err, &partial)
+}
+
+func messageSplitterFromEnv() *MessageSplitter {
+	return &MessageSplitter{
+		MaxLength: envInt("MESSAGE_MAX_LENGTH", 4096),
+		Numbering: envBool("MESSAGE_SPLIT_NUMBERING", false),
+		Delay:     envDuration("MESSAGE_SPLIT_DELAY", time.Second),
+	}
+}
+
+// Split returns text unchanged when it fits, otherwise its parts.
+func (s *MessageSplitter) Split(text string) []string {
+	runes := []rune(text)
+	if s == nil || s.MaxLength <= 0 || len(runes) <= s.MaxLength {
+		return []string{text}
+	}
+
+	limit := s.MaxLength
+	if s.Numbering {
+		limit -= len(" (999/999)") // room for the part counter
+	}
+
+	var parts []string
+	for len(runes) > limit {
+		cut := splitPoint(runes[:limit])
+		if part := strings.TrimSpace(string(runes[:cut])); part != "" {
+			parts = append(parts, part)
+		}
+		runes = []rune(strings.TrimLeft(string(runes[cut:]), " \n\t"))
+	}
+	if rest := strings.TrimSpace(string(runes)); rest != "" {
+		parts = append(parts, rest)
+	}
+
+	if s.Numbering && len(parts) > 1 {
+		for i := range parts {
+			parts[i] = fmt.Sprintf("%s (%d/%d)", parts[i], i+1, len(parts))
+		}
+	}
+	return parts
+}
+
+// splitPoint finds where to cut window, ignoring boundaries in its first
+// third so parts don't end up tiny.
+func splitPoint(window []rune) int {
+	text := string(window)
+	floor := len(string(window[:len(window)/3]))
+	for _, sep := range []string{"\n\n", "\n", ". ", "! ", "? ", "; ", " "} {
+		if i := strings.LastIndex(text, sep); i >= floor {
+			// Keep sentence punctuation with the part it ends.
+			return len([]rune(text[:i+len(strings.TrimRight(sep, " \n"))]))
+		}
+	}
+	return len(window)
+}
+
+// sendOutgoing sends msg, splitting long texts into sequential parts. Only
+// the first part quotes ReplyToMessageID and carries explicit mentions; only
+// the last lists suggestions. With MentionAll the first part also tags the
+// group's participants, and the rest are tagged in follow-up messages after
+// the last part. Once a part has gone out, a later failure is a
+// *PartialSendError listing the parts already delivered; that includes an
+// API request running out of time for the next part (see requestDeadline).
+func (b *WhatsAppBridge) sendOutgoing(ctx context.Context, msg OutgoingMessage) (SendResult, error) {
+	if jid, err := msg.recipient(); err == nil {
+		var canonical types.JID
+		if ctx, canonical, err = b.checkSend(ctx, jid, msg); err != nil {
+			return SendResult{}, err
+		}
+		if canonical != jid {
+			msg.Phone, msg.Server, msg.ChatType = canonical.String(), "", ""
+		}
+		msg.Priority = priorityFromContext(ctx)
+	}
+	if msg.Template != "" {
+		jid, _ := msg.recipient()
+		rendered, err := b.renderTemplate(msg.Template, jid.String(), msg.Params)
+		if err != nil {
+			return SendResult{}, err
+		}
+		ctx = withTemplate(ctx, sentTemplate{Template: msg.Template, Variant: rendered.Variant})
+		msg.Message = rendered.Text
+		if rendered.Header != nil && msg.MediaURL == "" {
+			msg.MediaURL, msg.templateHeader = rendered.MediaURL, rendered.Header
+		}
+	}
+	if !msg.Raw {
+		jid, _ := msg.recipient()
+		chat := jid.String()
+		msg.Message = b.translator.Outgoing(ctx, chat, msg.Language, msg.Message)
+		msg.Message = b.transformOutgoing(msg.Message)
+	}
+	var followUps [][]string
+	if msg.MentionAll {
+		jid, _ := msg.recipient()
+		chunks, err := b.mentionAllChunks(ctx, jid)
+		if err != nil {
+			return SendResult{}, err
+		}
+		msg.Mentions = append(append([]string(nil), msg.Mentions...), chunks[0]...)
+		followUps = chunks[1:]
+	}
+	parts := []string{msg.Message}
+	if msg.MediaURL == "" {
+		parts = b.splitter.Split(msg.Message)
+	}
+	total := len(parts) + len(followUps)
+
+	rendered := templateFromContext(ctx)
+	result := SendResult{Template: rendered.Template, Variant: rendered.Variant}
+	for i, text := range parts {
+		part := msg
+		part.Message = text
+		if i > 0 {
+			part.ReplyToMessageID, part.ReplyToParticipant, part.ReplyToText = "", "", ""
+			part.Mentions = nil
+			if err := b.pauseBetweenParts(ctx, msg); err != nil {
+				return result, partialSend(result, total, err)
+			}
+		}
+		if i < len(parts)-1 {
+			part.Suggestions = nil
+		}
+
+		resp, msgType, err := b.sendSingle(ctx, part)
+		if i == 0 {
+			result.Text, result.Type = text, msgType
+		}
+		if errors.Is(err, errResendQueued) {
+			result.Queued, err = true, nil
+		}
+		if err != nil {
+			if i > 0 {
+				return result, partialSend(result, total, err)
+			}
+			result.ID = resp.ID // of the failed attempt, for status lookups
+			return result, err
+		}
+		if i == 0 {
+			result.SendResponse = resp
+		}
+		result.PartIDs = append(result.PartIDs, resp.ID)
+	}
+
+	for _, mentions := range followUps {
+		if err := b.pauseBetweenParts(ctx, msg); err != nil {
+			return result, partialSend(result, total, err)
+		}
+		part := OutgoingMessage{Phone: msg.Phone, Server: msg.Server, ChatType: msg.ChatType,
+			Message: mentionTokens(mentions), Mentions: mentions, EphemeralTTL: msg.EphemeralTTL,
+			Raw: true, Priority: msg.Priority}
+		resp, _, err := b.sendSingle(ctx, part)
+		if errors.Is(err, errResendQueued) {
+			result.Queued, err = true, nil
+		}
+		if err != nil {
+			return result, partialSend(result, total, err)
+		}
+		result.PartIDs = append(result.PartIDs, resp.ID)
+	}
+	return result, nil
+}
+
+// pauseBetweenParts waits MESSAGE_SPLIT_DELAY before the next part of msg.
+// It fails at once when the delay would take an API request past its
+// deadline, and when ctx is done.
+func (b *WhatsAppBridge) pauseBetweenParts(ctx context.Context, msg OutgoingMessage) error {
+	if deadline, ok := requestDeadline(ctx); ok && time.Until(deadline) < b.splitter.Delay {
+		jid, _ := msg.recipient()
+		return outOfTime(jid, b.splitter.Delay)
+	}
+	return sleepContext(ctx, b.splitter.Delay)
+}
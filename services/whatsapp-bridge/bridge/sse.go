@@ -0,0 +1,272 @@
+package bridge
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Server-Sent Events feed at GET /events, for browser dashboards that
+// follow conversations without Redis access. It streams inbound messages,
+// message status and connection events. Every event is also appended to a
+// Redis stream whose entry ID is the SSE event ID, so a client that
+// reconnects with Last-Event-ID (EventSource does this on its own) gets
+// what it missed first, as far back as the stream is kept.
+//
+//	SSE_ENABLED        - serve /events (default true)
+//	SSE_STREAM         - stream events are kept in for resuming (default whatsapp:sse)
+//	SSE_STREAM_MAXLEN  - approximate number of events kept (default 10000)
+//	SSE_BUFFER         - events a slow client may fall behind before it is disconnected (default 256)
+//	SSE_HEARTBEAT      - interval of keepalive comments, for proxies that close idle connections (default 15s)
+//
+// Query parameters filter the feed: types (comma-separated event types) and
+// chats (comma-separated chat patterns, as in sink filters). Browsers cannot
+// send auth headers with EventSource, so ?access_token= is accepted too.
+
+var sseEventTypes = []string{EventMessage, EventMessageStatus, EventConnection}
+
+// sseHub is the sink that records events and feeds the /events clients.
+type sseHub struct {
+	redis     *redis.Client
+	stream    string
+	maxLen    int64
+	buffer    int
+	heartbeat time.Duration
+
+	mu      sync.Mutex
+	clients map[*sseClient]struct{}
+}
+
+type sseClient struct {
+	types  []string
+	chats  []string
+	events chan sseEvent
+	// lagged is closed when the client fell too far behind; it reconnects
+	// and resumes from the stream instead.
+	lagged chan struct{}
+}
+
+// sseEvent is one event as sent on the wire.
+type sseEvent struct {
+	ID   string
+	Type string
+	Chat string
+	Data []byte
+}
+
+// sseHubFromEnv returns nil when SSE_ENABLED is false.
+func (b *WhatsAppBridge) sseHubFromEnv() *sseHub {
+	if !envBool("SSE_ENABLED", true) {
+		return nil
+	}
+	return &sseHub{
+		redis:     b.redisClient,
+		stream:    envString("SSE_STREAM", "whatsapp:sse"),
+		maxLen:    int64(envInt("SSE_STREAM_MAXLEN", 10000)),
+		buffer:    envInt("SSE_BUFFER", 256),
+		heartbeat: envDuration("SSE_HEARTBEAT", 15*time.Second),
+		clients:   make(map[*sseClient]struct{}),
+	}
+}
+
+func (h *sseHub) Name() string { return "sse" }
+
+// Deliver appends evt to the stream and hands it to the matching clients.
+func (h *sseHub) Deliver(ctx context.Context, evt BridgeEvent) error {
+	data, err := evt.MarshalPayload()
+	if err != nil {
+		return err
+	}
+	id, err := h.redis.XAdd(ctx, &redis.XAddArgs{
+		Stream: h.stream,
+		MaxLen: h.maxLen,
+		Approx: true,
+		Values: map[string]interface{}{"type": evt.Type, "chat": evt.Chat, "payload": data},
+	}).Result()
+	if err != nil {
+		// Still stream it live; it just cannot be resumed from.
+		log.Printf("Error appending %s event to %s: %v", evt.Type, h.stream, err)
+	}
+	h.broadcast(sseEvent{ID: id, Type: evt.Type, Chat: evt.Chat, Data: data})
+	return nil
+}
+
+func (h *sseHub) broadcast(evt sseEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for c := range h.clients {
+		if !c.accepts(evt) {
+			continue
+		}
+		select {
+		case c.events <- evt:
+		default:
+			log.Printf("⚠️ SSE client is behind, disconnecting it")
+			close(c.lagged)
+			delete(h.clients, c)
+		}
+	}
+}
+
+func (c *sseClient) accepts(evt sseEvent) bool {
+	if len(c.types) > 0 && !containsString(c.types, evt.Type) {
+		return false
+	}
+	return len(c.chats) == 0 || matchesAny(c.chats, evt.Chat)
+}
+
+func (h *sseHub) subscribe(c *sseClient) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.clients[c] = struct{}{}
+	bufferMarks.observe("sse_clients", "", int64(len(h.clients)))
+}
+
+func (h *sseHub) unsubscribe(c *sseClient) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.clients, c)
+}
+
+// replay sends the matching events recorded after lastID, returning the ID
+// of the last one read.
+func (h *sseHub) replay(ctx context.Context, w http.ResponseWriter, c *sseClient, lastID string) (string, error) {
+	for {
+		entries, err := h.redis.XRangeN(ctx, h.stream, "("+lastID, "+", 500).Result()
+		if err != nil {
+			return lastID, err
+		}
+		for _, entry := range entries {
+			lastID = entry.ID
+			evt := sseEvent{ID: entry.ID}
+			evt.Type, _ = entry.Values["type"].(string)
+			evt.Chat, _ = entry.Values["chat"].(string)
+			payload, _ := entry.Values["payload"].(string)
+			evt.Data = []byte(payload)
+			if !c.accepts(evt) {
+				continue
+			}
+			if err := writeSSE(w, evt); err != nil {
+				return lastID, err
+			}
+		}
+		if len(entries) < 500 {
+			return lastID, nil
+		}
+	}
+}
+
+// writeSSE writes one event. Payloads are single-line JSON.
+func writeSSE(w http.ResponseWriter, evt sseEvent) error {
+	var sb strings.Builder
+	if evt.ID != "" {
+		fmt.Fprintf(&sb, "id: %s\n", evt.ID)
+	}
+	fmt.Fprintf(&sb, "event: %s\ndata: %s\n\n", evt.Type, evt.Data)
+	if _, err := io.WriteString(w, sb.String()); err != nil {
+		return err
+	}
+	w.(http.Flusher).Flush()
+	return nil
+}
+
+// streamIDAfter reports whether stream entry ID a comes after b.
+func streamIDAfter(a, b string) bool {
+	parse := func(id string) (uint64, uint64) {
+		ms, seq, _ := strings.Cut(id, "-")
+		m, _ := strconv.ParseUint(ms, 10, 64)
+		s, _ := strconv.ParseUint(seq, 10, 64)
+		return m, s
+	}
+	am, as := parse(a)
+	bm, bs := parse(b)
+	return am > bm || (am == bm && as > bs)
+}
+
+// handleEvents serves GET /events.
+func (b *WhatsAppBridge) handleEvents(w http.ResponseWriter, r *http.Request) {
+	h := b.sse
+	if h == nil {
+		writeJSON(w, http.StatusNotFound, Response{Success: false, Error: "the event feed is disabled"})
+		return
+	}
+	if _, ok := w.(http.Flusher); !ok {
+		writeJSON(w, http.StatusInternalServerError, Response{Success: false, Error: "streaming is not supported"})
+		return
+	}
+	query := r.URL.Query()
+	c := &sseClient{
+		types:  splitList(query.Get("types")),
+		chats:  splitList(query.Get("chats")),
+		events: make(chan sseEvent, h.buffer),
+		lagged: make(chan struct{}),
+	}
+	for _, t := range c.types {
+		if !containsString(sseEventTypes, t) {
+			writeJSON(w, http.StatusBadRequest, Response{Success: false,
+				Error: fmt.Sprintf("unknown event type %q (known: %s)", t, strings.Join(sseEventTypes, ", "))})
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no") // nginx would otherwise buffer the stream
+	// The server's write timeout is meant for regular requests.
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, "retry: 3000\n\n")
+	w.(http.Flusher).Flush()
+
+	// Subscribe before replaying so nothing published in between is lost;
+	// live events already replayed are skipped below.
+	h.subscribe(c)
+	defer h.unsubscribe(c)
+
+	lastID := r.Header.Get("Last-Event-ID")
+	if lastID == "" {
+		lastID = query.Get("last_event_id")
+	}
+	if lastID != "" {
+		last, err := h.replay(r.Context(), w, c, lastID)
+		if err != nil {
+			// Likely a malformed or foreign ID; carry on live.
+			log.Printf("Error replaying events after %s: %v", lastID, err)
+		}
+		lastID = last
+	}
+
+	heartbeat := time.NewTicker(h.heartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-b.intake.Done():
+			return // draining: let the server shut down
+		case <-c.lagged:
+			return
+		case <-heartbeat.C:
+			if _, err := io.WriteString(w, ": ping\n\n"); err != nil {
+				return
+			}
+			w.(http.Flusher).Flush()
+		case evt := <-c.events:
+			if lastID != "" && evt.ID != "" && !streamIDAfter(evt.ID, lastID) {
+				continue
+			}
+			if err := writeSSE(w, evt); err != nil {
+				return
+			}
+		}
+	}
+}
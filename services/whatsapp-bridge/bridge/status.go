@@ -0,0 +1,262 @@
+package bridge
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/gorilla/mux"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// EventMessageStatus is published when one of our messages advances to a
+// new delivery state.
+const EventMessageStatus = "message_status"
+
+// Delivery states of sent messages, in order; a message only moves forward.
+// Failed and revoked are final.
+const (
+	StatusQueued    = "queued" // accepted, waiting for pacing or media upload
+	StatusSent      = "sent"
+	StatusDelivered = "delivered"
+	StatusRead      = "read"
+	StatusPlayed    = "played" // voice notes and videos
+	StatusFailed    = "failed"
+	StatusRevoked   = "revoked" // deleted for everyone from one of our devices
+)
+
+var statusRank = map[string]int{
+	StatusQueued:    0,
+	StatusSent:      1,
+	StatusDelivered: 2,
+	StatusRead:      3,
+	StatusPlayed:    4,
+	StatusFailed:    5,
+	StatusRevoked:   5,
+}
+
+// MessageStatus is the payload of message_status events and of the
+// STATUS_STREAM entries.
+type MessageStatus struct {
+	MessageID    string `json:"message_id"`
+	Chat         string `json:"chat"`
+	Status       string `json:"status"`
+	Participant  string `json:"participant,omitempty"` // group member whose receipt advanced it
+	Error        string `json:"error,omitempty"`       // why a failed send failed
+	Timestamp    int64  `json:"timestamp"`
+	TimestampISO string `json:"timestamp_iso"`
+	RequestID    string `json:"request_id,omitempty"` // API request that sent the message
+
+	// ResentAfterReconnect marks the sent status of a message whose first
+	// send failed on a dropped connection and was re-sent after reconnect.
+	ResentAfterReconnect bool `json:"resent_after_reconnect,omitempty"`
+}
+
+// statusKey holds a sent message's chat, current status and the time it
+// reached each state, for STATUS_TTL (default 7 days) after sending.
+func statusKey(messageID string) string { return "whatsapp:msgstatus:" + messageID }
+
+// trackQueued starts tracking a message as soon as it has an ID, so sends
+// that never make it out are reported as failed rather than unknown.
+func (b *WhatsAppBridge) trackQueued(ctx context.Context, chat, messageID string) {
+	key := statusKey(messageID)
+	pipe := b.redisClient.TxPipeline()
+	pipe.HSet(ctx, key, "chat", chat, "status", StatusQueued, "rank", statusRank[StatusQueued], "queued_at", time.Now().Unix())
+	pipe.Expire(ctx, key, envDuration("STATUS_TTL", 7*24*time.Hour))
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("Error tracking status of %s: %v", messageID, err)
+	}
+}
+
+// trackFailed marks a queued message as failed with the send error.
+func (b *WhatsAppBridge) trackFailed(ctx context.Context, messageID string, sendErr error) {
+	now := time.Now()
+	key := statusKey(messageID)
+	chat, err := advanceStatus.Run(ctx, b.redisClient, []string{key},
+		StatusFailed, statusRank[StatusFailed], now.Unix()).Text()
+	if err != nil {
+		if err != redis.Nil {
+			log.Printf("Error updating status of %s: %v", messageID, err)
+		}
+		return
+	}
+	b.redisClient.HSet(ctx, key, "error", sendErr.Error())
+	b.publishStatus(ctx, MessageStatus{MessageID: messageID, Chat: chat, Status: StatusFailed, Error: sendErr.Error(), Timestamp: now.Unix(),
+		RequestID: requestIDFromContext(ctx)}, now)
+}
+
+// advanceStatus moves a tracked message to a higher-ranked status and
+// returns its chat, or false when the message is unknown or already there.
+var advanceStatus = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then return false end
+local rank = tonumber(redis.call('HGET', KEYS[1], 'rank') or '0')
+if tonumber(ARGV[2]) <= rank then return false end
+redis.call('HSET', KEYS[1], 'status', ARGV[1], 'rank', ARGV[2], ARGV[1] .. '_at', ARGV[3])
+return redis.call('HGET', KEYS[1], 'chat')
+`)
+
+// trackSent starts tracking a message we sent and publishes its sent
+// status.
+func (b *WhatsAppBridge) trackSent(ctx context.Context, chat, messageID string, ts time.Time) {
+	key := statusKey(messageID)
+	pipe := b.redisClient.TxPipeline()
+	pipe.HSet(ctx, key, "chat", chat, "status", StatusSent, "rank", statusRank[StatusSent], "sent_at", ts.Unix())
+	pipe.Expire(ctx, key, envDuration("STATUS_TTL", 7*24*time.Hour))
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("Error tracking status of %s: %v", messageID, err)
+		return
+	}
+	b.publishStatus(ctx, MessageStatus{
+		MessageID: messageID, Chat: chat, Status: StatusSent, Timestamp: ts.Unix(),
+		RequestID: requestIDFromContext(ctx), ResentAfterReconnect: resentAfterReconnect(ctx),
+	}, ts)
+}
+
+// recordStatusReceipt advances the messages a delivery, read or played
+// receipt refers to. Receipts from our other devices are ignored.
+func (b *WhatsAppBridge) recordStatusReceipt(receipt *events.Receipt) {
+	if receipt.IsFromMe {
+		return
+	}
+	var status string
+	switch receipt.Type {
+	case types.ReceiptTypeDelivered:
+		status = StatusDelivered
+	case types.ReceiptTypeRead:
+		status = StatusRead
+	case types.ReceiptTypePlayed:
+		status = StatusPlayed
+	default:
+		return
+	}
+	ts := receipt.Timestamp
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+
+	for _, id := range receipt.MessageIDs {
+		chat, err := advanceStatus.Run(b.ctx, b.redisClient, []string{statusKey(id)},
+			status, statusRank[status], ts.Unix()).Text()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			log.Printf("Error updating status of %s: %v", id, err)
+			continue
+		}
+		update := MessageStatus{MessageID: id, Chat: chat, Status: status, Timestamp: ts.Unix()}
+		if receipt.IsGroup {
+			update.Participant = receipt.Sender.ToNonAD().String()
+		}
+		b.publishStatus(b.ctx, update, ts)
+	}
+}
+
+// recordRevoke marks one of our messages as revoked when a "delete for
+// everyone" sent from another of our devices comes back to us.
+func (b *WhatsAppBridge) recordRevoke(msg *events.Message) {
+	if !msg.Info.IsFromMe || !isRevoke(msg.Message) {
+		return
+	}
+	id := msg.Message.GetProtocolMessage().GetKey().GetID()
+	if id == "" {
+		return
+	}
+	ts := msg.Info.Timestamp
+	chat, err := advanceStatus.Run(b.ctx, b.redisClient, []string{statusKey(id)},
+		StatusRevoked, statusRank[StatusRevoked], ts.Unix()).Text()
+	if err != nil {
+		if err != redis.Nil {
+			log.Printf("Error updating status of %s: %v", id, err)
+		}
+		return
+	}
+	b.publishStatus(b.ctx, MessageStatus{MessageID: id, Chat: chat, Status: StatusRevoked, Timestamp: ts.Unix()}, ts)
+}
+
+// publishStatus appends the update to STATUS_STREAM (default
+// "whatsapp:status", trimmed to about STATUS_STREAM_MAXLEN entries, default
+// 100000) and publishes it to the sinks, when receipts are published.
+func (b *WhatsAppBridge) publishStatus(ctx context.Context, update MessageStatus, ts time.Time) {
+	if !b.events.Enabled(EventMessageStatus) {
+		return
+	}
+	update.TimestampISO = b.formatTime(ts)
+	if stream := envString("STATUS_STREAM", "whatsapp:status"); stream != "" {
+		values := map[string]interface{}{
+			"message_id":  update.MessageID,
+			"chat":        update.Chat,
+			"status":      update.Status,
+			"participant": update.Participant,
+			"error":       update.Error,
+			"timestamp":   update.Timestamp,
+		}
+		if update.ResentAfterReconnect {
+			values["resent_after_reconnect"] = "true"
+		}
+		if update.RequestID != "" {
+			values["request_id"] = update.RequestID
+		}
+		err := b.redisClient.XAdd(ctx, &redis.XAddArgs{
+			Stream: stream,
+			MaxLen: int64(envInt("STATUS_STREAM_MAXLEN", 100000)),
+			Approx: true,
+			Values: values,
+		}).Err()
+		if err != nil {
+			log.Printf("Error appending status of %s to %s: %v", update.MessageID, stream, err)
+		}
+	}
+	b.publish(EventMessageStatus, update.Chat, update)
+}
+
+// MessageStatusRecord is the response of GET /messages/{id}/status.
+// Timestamps holds the time the message reached each state it went through.
+type MessageStatusRecord struct {
+	MessageID     string            `json:"message_id"`
+	Chat          string            `json:"chat"`
+	Status        string            `json:"status"`
+	Error         string            `json:"error,omitempty"`
+	Timestamps    map[string]int64  `json:"timestamps"`
+	TimestampsISO map[string]string `json:"timestamps_iso"`
+}
+
+// handleMessageStatus serves GET /messages/{id}/status for messages sent
+// within STATUS_TTL.
+func (b *WhatsAppBridge) handleMessageStatus(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	fields, err := b.redisClient.HGetAll(r.Context(), statusKey(id)).Result()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	if len(fields) == 0 {
+		writeJSON(w, http.StatusNotFound, Response{Success: false, Error: "no status known for message " + id})
+		return
+	}
+
+	record := MessageStatusRecord{
+		MessageID:     id,
+		Chat:          fields["chat"],
+		Status:        fields["status"],
+		Error:         fields["error"],
+		Timestamps:    make(map[string]int64),
+		TimestampsISO: make(map[string]string),
+	}
+	for field, value := range fields {
+		status, ok := strings.CutSuffix(field, "_at")
+		if !ok {
+			continue
+		}
+		if unix, err := strconv.ParseInt(value, 10, 64); err == nil {
+			record.Timestamps[status] = unix
+			record.TimestampsISO[status] = b.formatTime(time.Unix(unix, 0))
+		}
+	}
+	writeJSON(w, http.StatusOK, Response{Success: true, Data: record})
+}
@@ -0,0 +1,78 @@
+package bridge_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow/proto/waCommon"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/phenobarbital/ai-parrot/whatsapp-bridge/bridge"
+	"github.com/phenobarbital/ai-parrot/whatsapp-bridge/bridgetest"
+)
+
+// emitOwnProtocol simulates a protocol message sent from one of our other
+// devices about message id.
+func emitOwnProtocol(h *bridgetest.Harness, chat types.JID, id string, protocolType *waE2E.ProtocolMessage_Type) {
+	h.Emit(&events.Message{
+		Info: types.MessageInfo{
+			MessageSource: types.MessageSource{Chat: chat, Sender: bridgetest.DefaultOwnJID, IsFromMe: true},
+			ID:            "OWN" + id,
+			Timestamp:     time.Now(),
+		},
+		Message: &waE2E.Message{ProtocolMessage: &waE2E.ProtocolMessage{
+			Type: protocolType,
+			Key:  &waCommon.MessageKey{RemoteJID: proto.String(chat.String()), FromMe: proto.Bool(true), ID: proto.String(id)},
+		}},
+	})
+}
+
+func messageStatus(t *testing.T, h *bridgetest.Harness, id string) bridge.MessageStatusRecord {
+	t.Helper()
+	status, resp := h.Do(http.MethodGet, "/messages/"+id+"/status", nil)
+	if status != http.StatusOK {
+		t.Fatalf("GET status of %s: %d %s", id, status, resp.Error)
+	}
+	var record bridge.MessageStatusRecord
+	decodeData(t, resp.Data, &record)
+	return record
+}
+
+// decodeData round-trips the data of a response through JSON into v.
+func decodeData(t *testing.T, data any, v any) {
+	t.Helper()
+	encoded, err := json.Marshal(data)
+	if err == nil {
+		err = json.Unmarshal(encoded, v)
+	}
+	if err != nil {
+		t.Fatalf("decode response data: %v", err)
+	}
+}
+
+func TestMessageStatusRevoke(t *testing.T) {
+	h := bridgetest.New(t)
+	h.Send(bridge.OutgoingMessage{Phone: "5215512345678", Message: "hola"})
+	sent := h.LastSent()
+
+	// A protocol message without a type is not a revoke, although REVOKE
+	// is the type's zero value.
+	emitOwnProtocol(h, sent.To, sent.ID, nil)
+	if got := messageStatus(t, h, sent.ID).Status; got != bridge.StatusSent {
+		t.Fatalf("status after untyped protocol message = %q, want %q", got, bridge.StatusSent)
+	}
+
+	emitOwnProtocol(h, sent.To, sent.ID, waE2E.ProtocolMessage_REVOKE.Enum())
+	record := messageStatus(t, h, sent.ID)
+	if record.Status != bridge.StatusRevoked {
+		t.Fatalf("status after revoke = %q, want %q", record.Status, bridge.StatusRevoked)
+	}
+	if _, ok := record.Timestamps[bridge.StatusRevoked]; !ok {
+		t.Errorf("no revoked timestamp in %v", record.Timestamps)
+	}
+}
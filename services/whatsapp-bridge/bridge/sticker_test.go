@@ -0,0 +1,64 @@
+package bridge_test
+
+import (
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/phenobarbital/ai-parrot/whatsapp-bridge/bridge"
+	"github.com/phenobarbital/ai-parrot/whatsapp-bridge/bridgetest"
+)
+
+// receiveSticker simulates an inbound sticker served by url.
+func receiveSticker(h *bridgetest.Harness, id, phone, url string, media encryptedMedia) {
+	jid := types.NewJID(phone, types.DefaultUserServer)
+	h.Emit(&events.Message{
+		Info: types.MessageInfo{
+			MessageSource: types.MessageSource{Chat: jid, Sender: jid},
+			ID:            id,
+			Timestamp:     time.Now(),
+		},
+		Message: &waE2E.Message{StickerMessage: &waE2E.StickerMessage{
+			URL:           proto.String(url),
+			DirectPath:    proto.String("/v/t62/sticker"),
+			MediaKey:      media.MediaKey,
+			FileEncSHA256: media.FileEncSHA256,
+			FileSHA256:    media.FileSHA256,
+			FileLength:    proto.Uint64(uint64(len(media.Plaintext))),
+			Mimetype:      proto.String("image/webp"),
+		}},
+	})
+}
+
+func TestStickersBypassAllowedTypes(t *testing.T) {
+	media := encryptMedia(t, []byte("RIFF sticker"), whatsmeow.MediaImage)
+	h := bridgetest.New(t, bridgetest.WithEnv("MEDIA_ALLOWED_TYPES", "application/pdf"))
+	receiveSticker(h, "STICKER1", "5215512345678", serveMedia(t, media.File).URL, media)
+
+	if msg := h.ExpectMessage(); msg.Type != "sticker" || msg.MessageID != "STICKER1" {
+		t.Fatalf("message = %+v", msg)
+	}
+	h.ExpectNoEvent(bridge.EventMediaRejected, 100*time.Millisecond)
+}
+
+func TestStickerDownloadIsOptIn(t *testing.T) {
+	media := encryptMedia(t, []byte("RIFF sticker"), whatsmeow.MediaImage)
+	srv := serveMedia(t, media.File)
+
+	h := bridgetest.New(t)
+	receiveSticker(h, "STICKER2", "5215512345678", srv.URL, media)
+	h.ExpectNoEvent(bridge.EventMediaDownloaded, 200*time.Millisecond)
+
+	h = bridgetest.New(t, bridgetest.WithEnv("STICKER_DOWNLOAD", "true"))
+	receiveSticker(h, "STICKER3", "5215512345678", srv.URL, media)
+	var downloaded bridge.MediaDownloaded
+	h.DecodePayload(h.ExpectEvent(bridge.EventMediaDownloaded), &downloaded)
+	if downloaded.MessageID != "STICKER3" || downloaded.Type != "sticker" {
+		t.Fatalf("media_downloaded = %+v", downloaded)
+	}
+}
@@ -0,0 +1,93 @@
+package bridge
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Suggestion is a quick-reply option attached to an outgoing message.
+type Suggestion struct {
+	ID    string `json:"id"`
+	Title string `json:"title"`
+}
+
+// SuggestionReply is attached to inbound payloads when a user's reply picks
+// one of the suggestions last offered in that chat.
+type SuggestionReply struct {
+	ID        string `json:"id"`
+	Title     string `json:"title"`
+	Index     int    `json:"index"` // 1-based position in the rendered list
+	MessageID string `json:"message_id"`
+}
+
+// pendingSuggestions is cached per chat until answered or expired.
+type pendingSuggestions struct {
+	MessageID   string       `json:"message_id"`
+	Suggestions []Suggestion `json:"suggestions"`
+}
+
+func suggestionsKey(chat string) string {
+	return "whatsapp:suggestions:" + chat
+}
+
+// renderSuggestions appends the options to text as a numbered list, the
+// portable fallback for clients without interactive message support.
+func renderSuggestions(text string, suggestions []Suggestion) string {
+	if len(suggestions) == 0 {
+		return text
+	}
+	var sb strings.Builder
+	sb.WriteString(text)
+	sb.WriteString("\n")
+	for i, s := range suggestions {
+		fmt.Fprintf(&sb, "\n%d. %s", i+1, s.Title)
+	}
+	return sb.String()
+}
+
+// rememberSuggestions stores the options offered in chat so a later numeric
+// (or exact title) reply can be mapped back to the suggestion ID.
+func (b *WhatsAppBridge) rememberSuggestions(chat, messageID string, suggestions []Suggestion) {
+	data, _ := json.Marshal(pendingSuggestions{MessageID: messageID, Suggestions: suggestions})
+	ttl := envDuration("SUGGESTIONS_TTL", 24*time.Hour)
+	if err := b.redisClient.Set(b.ctx, suggestionsKey(chat), data, ttl).Err(); err != nil {
+		log.Printf("Error storing suggestions for %s: %v", chat, err)
+	}
+}
+
+// matchSuggestion maps an inbound reply ("2", "2.", or the option title) to
+// the pending suggestion for chat, consuming it on a match.
+func (b *WhatsAppBridge) matchSuggestion(chat, content string) *SuggestionReply {
+	data, err := b.redisClient.Get(b.ctx, suggestionsKey(chat)).Bytes()
+	if err != nil {
+		return nil
+	}
+	var pending pendingSuggestions
+	if json.Unmarshal(data, &pending) != nil {
+		return nil
+	}
+
+	answer := strings.TrimSuffix(strings.TrimSpace(content), ".")
+	index := -1
+	if n, err := strconv.Atoi(answer); err == nil && n >= 1 && n <= len(pending.Suggestions) {
+		index = n - 1
+	} else {
+		for i, s := range pending.Suggestions {
+			if strings.EqualFold(answer, s.Title) {
+				index = i
+				break
+			}
+		}
+	}
+	if index < 0 {
+		return nil
+	}
+
+	b.redisClient.Del(b.ctx, suggestionsKey(chat))
+	s := pending.Suggestions[index]
+	return &SuggestionReply{ID: s.ID, Title: s.Title, Index: index + 1, MessageID: pending.MessageID}
+}
@@ -0,0 +1,130 @@
+package bridge
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Operational alert kinds; repeats of the same kind within the cooldown are
+// suppressed.
+const (
+	AlertReauth     = "reauth"
+	AlertDisconnect = "disconnect"
+	AlertReconnect  = "reconnect"
+	AlertBan        = "ban"
+	AlertDeadLetter = "dead_letter"
+	AlertHealth     = "health"
+)
+
+// TelegramNotifier sends operational alerts to an on-call Telegram chat.
+// Configured with TELEGRAM_BOT_TOKEN and TELEGRAM_CHAT_ID; alerts of one
+// kind are sent at most once per TELEGRAM_ALERT_COOLDOWN (default 5m), and
+// are prefixed with TELEGRAM_ALERT_LABEL (default the hostname) so several
+// bridges can share a chat. A nil TelegramNotifier drops every alert.
+type TelegramNotifier struct {
+	apiURL   string
+	token    string
+	chatID   string
+	label    string
+	cooldown time.Duration
+	client   *http.Client
+
+	mu   sync.Mutex
+	last map[string]time.Time
+	down bool // a disconnect alert is outstanding
+}
+
+// telegramNotifierFromEnv returns nil unless TELEGRAM_BOT_TOKEN is set.
+func telegramNotifierFromEnv() (*TelegramNotifier, error) {
+	token := envString("TELEGRAM_BOT_TOKEN", "")
+	if token == "" {
+		return nil, nil
+	}
+	chatID := envString("TELEGRAM_CHAT_ID", "")
+	if chatID == "" {
+		return nil, fmt.Errorf("TELEGRAM_BOT_TOKEN requires TELEGRAM_CHAT_ID")
+	}
+	hostname, _ := os.Hostname()
+	return &TelegramNotifier{
+		apiURL:   strings.TrimRight(envString("TELEGRAM_API_URL", "https://api.telegram.org"), "/"),
+		token:    token,
+		chatID:   chatID,
+		label:    envString("TELEGRAM_ALERT_LABEL", hostname),
+		cooldown: envDuration("TELEGRAM_ALERT_COOLDOWN", 5*time.Minute),
+		client:   &http.Client{Timeout: 10 * time.Second},
+		last:     make(map[string]time.Time),
+	}, nil
+}
+
+// Notify sends text in the background unless an alert of the same kind went
+// out within the cooldown.
+func (n *TelegramNotifier) Notify(kind, text string) {
+	if n == nil {
+		return
+	}
+	n.mu.Lock()
+	switch kind {
+	case AlertDisconnect, AlertReauth, AlertBan:
+		n.down = true
+	case AlertReconnect:
+		// Only worth saying when someone was told it was down.
+		if !n.down {
+			n.mu.Unlock()
+			return
+		}
+		n.down = false
+	}
+	if last, ok := n.last[kind]; ok && time.Since(last) < n.cooldown {
+		n.mu.Unlock()
+		return
+	}
+	n.last[kind] = time.Now()
+	n.mu.Unlock()
+
+	if n.label != "" {
+		text = "[" + n.label + "] " + text
+	}
+	go func() {
+		if err := n.send(context.Background(), text); err != nil {
+			log.Printf("Error sending Telegram alert: %v", err)
+		}
+	}()
+}
+
+func (n *TelegramNotifier) send(ctx context.Context, text string) error {
+	data, err := json.Marshal(map[string]interface{}{
+		"chat_id":                  n.chatID,
+		"text":                     text,
+		"disable_web_page_preview": true,
+	})
+	if err != nil {
+		return err
+	}
+	endpoint := fmt.Sprintf("%s/bot%s/sendMessage", n.apiURL, n.token)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		// The error embeds the URL, and with it the bot token.
+		return fmt.Errorf("telegram request failed: %v", strings.ReplaceAll(err.Error(), n.token, "***"))
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("telegram returned %d: %s", resp.StatusCode, strings.TrimSpace(string(detail)))
+	}
+	return nil
+}
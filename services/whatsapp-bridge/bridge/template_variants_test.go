@@ -0,0 +1,54 @@
+package bridge_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/phenobarbital/ai-parrot/whatsapp-bridge/bridge"
+	"github.com/phenobarbital/ai-parrot/whatsapp-bridge/bridgetest"
+)
+
+func TestTemplateVariants(t *testing.T) {
+	h := bridgetest.New(t,
+		bridgetest.WithEnv("RATE_LIMIT_CHAT_PER_MINUTE", "0"),
+		bridgetest.WithEnv("RATE_LIMIT_GLOBAL_PER_MINUTE", "0"),
+	)
+	if status, resp := h.Do(http.MethodPut, "/admin/templates/promo", bridge.MessageTemplate{
+		Body: "control {{.name}}",
+		Variants: []bridge.TemplateVariant{
+			{Name: "control", Weight: 1},
+			{Name: "short", Weight: 1, Body: "short {{.name}}"},
+			{Name: "paused", Weight: 0, Body: "paused {{.name}}"},
+		},
+	}); status != http.StatusOK {
+		t.Fatalf("PUT /admin/templates/promo = %d %s", status, resp.Error)
+	}
+
+	seen := map[string]int{}
+	for i := range 12 {
+		phone := fmt.Sprintf("52155123456%02d", i)
+		msg := bridge.OutgoingMessage{Phone: phone, Template: "promo", Params: map[string]interface{}{"name": "Ana"}}
+		data, _ := h.Send(msg).Data.(map[string]any)
+		variant, _ := data["variant"].(string)
+		if body := h.LastSent().Message.GetConversation(); body != variant+" Ana" {
+			t.Errorf("%s got %q as variant %q", phone, body, variant)
+		}
+		seen[variant]++
+
+		again, _ := h.Send(msg).Data.(map[string]any)
+		if again["variant"] != variant {
+			t.Errorf("%s got variant %v, then %v", phone, variant, again["variant"])
+		}
+	}
+	if seen["control"] == 0 || seen["short"] == 0 || seen["paused"] != 0 || len(seen) != 2 {
+		t.Errorf("variants sent: %v", seen)
+	}
+
+	if status, _ := h.Do(http.MethodPut, "/admin/templates/broken", bridge.MessageTemplate{
+		Body:     "hi",
+		Variants: []bridge.TemplateVariant{{Name: "a"}, {Name: "b"}},
+	}); status != http.StatusBadRequest {
+		t.Errorf("template with only paused variants answered %d, want 400", status)
+	}
+}
@@ -0,0 +1,330 @@
+package bridge
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/gorilla/mux"
+)
+
+// templatesKey is the Redis hash holding named message templates.
+const templatesKey = "whatsapp:templates"
+
+// MessageTemplate is a named Go text/template used as message copy, e.g.
+// "Hi {{.name}}, your order {{.order_id}} ships {{.date}}." A Header sends
+// the message as media with the body as its caption; Footer is appended
+// after a blank line. Both are rendered with the same params as the body.
+//
+// Variants turn the template into an A/B test: each recipient gets one
+// variant, picked by weight from a hash of the template name and the
+// recipient's JID, so a recipient keeps getting the same variant for as long
+// as the variants stay the same. The variant sent is recorded in the
+// archive and returned in send results.
+type MessageTemplate struct {
+	Name        string            `json:"name"`
+	Body        string            `json:"body"`
+	Header      *TemplateHeader   `json:"header,omitempty"`
+	Footer      string            `json:"footer,omitempty"`
+	Variants    []TemplateVariant `json:"variants,omitempty"`
+	Description string            `json:"description,omitempty"`
+	UpdatedAt   int64             `json:"updated_at"`
+	UpdatedBy   string            `json:"updated_by,omitempty"`
+}
+
+// TemplateVariant is one version of a template under test. Its parts
+// replace the template's, which are used for those it leaves empty, so a
+// variant with no parts is the control group. A weight of 0 pauses the
+// variant.
+type TemplateVariant struct {
+	Name   string          `json:"name"`
+	Weight int             `json:"weight"`
+	Body   string          `json:"body,omitempty"`
+	Header *TemplateHeader `json:"header,omitempty"`
+	Footer string          `json:"footer,omitempty"`
+}
+
+// variantFor picks the variant recipient gets, or nil when the template has
+// none.
+func (t *MessageTemplate) variantFor(recipient string) *TemplateVariant {
+	total := 0
+	for _, v := range t.Variants {
+		total += v.Weight
+	}
+	if total <= 0 {
+		return nil
+	}
+	sum := sha256.Sum256([]byte(t.Name + "\x00" + recipient))
+	n := int(binary.BigEndian.Uint64(sum[:8]) % uint64(total))
+	for i := range t.Variants {
+		if n < t.Variants[i].Weight {
+			return &t.Variants[i]
+		}
+		n -= t.Variants[i].Weight
+	}
+	return nil
+}
+
+// withVariant returns the template as variant v sends it.
+func (t MessageTemplate) withVariant(v *TemplateVariant) *MessageTemplate {
+	if v.Body != "" {
+		t.Body = v.Body
+	}
+	if v.Header != nil {
+		t.Header = v.Header
+	}
+	if v.Footer != "" {
+		t.Footer = v.Footer
+	}
+	return &t
+}
+
+// validate checks the template's parts and variants parse.
+func (t *MessageTemplate) validate() error {
+	if t.Body == "" {
+		return fmt.Errorf("body is required")
+	}
+	parts := []string{t.Body, t.Footer}
+	if t.Header != nil {
+		if err := t.Header.validate(); err != nil {
+			return err
+		}
+		parts = append(parts, t.Header.URL)
+	}
+	seen := make(map[string]bool)
+	total := 0
+	for _, v := range t.Variants {
+		if v.Name == "" || seen[v.Name] {
+			return fmt.Errorf("variants need unique names")
+		}
+		seen[v.Name] = true
+		if v.Weight < 0 {
+			return fmt.Errorf("variant %s: weight must not be negative", v.Name)
+		}
+		total += v.Weight
+		parts = append(parts, v.Body, v.Footer)
+		if v.Header != nil {
+			if err := v.Header.validate(); err != nil {
+				return fmt.Errorf("variant %s: %v", v.Name, err)
+			}
+			parts = append(parts, v.Header.URL)
+		}
+	}
+	if len(t.Variants) > 0 && total == 0 {
+		return fmt.Errorf("at least one variant needs a weight")
+	}
+	for _, part := range parts {
+		if _, err := parseTemplate(t.Name, part); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TemplateHeader is the media a template is sent with. The upload is
+// cached by URL for TEMPLATE_MEDIA_CACHE_TTL (default 24h), so a campaign
+// uploads its header image once rather than per recipient.
+type TemplateHeader struct {
+	Type     string `json:"type"` // image, video or document
+	URL      string `json:"url"`
+	FileName string `json:"file_name,omitempty"` // for documents
+}
+
+// renderedTemplate is a template filled with a message's params.
+type renderedTemplate struct {
+	Text     string
+	MediaURL string
+	Header   *TemplateHeader
+	Variant  string // the variant rendered, for templates with variants
+}
+
+func (h *TemplateHeader) validate() error {
+	switch h.Type {
+	case "image", "video", "document":
+	default:
+		return fmt.Errorf("header type must be image, video or document")
+	}
+	if h.URL == "" {
+		return fmt.Errorf("header url is required")
+	}
+	return nil
+}
+
+// templateFuncs are available inside template bodies.
+var templateFuncs = template.FuncMap{
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	"title": func(s string) string {
+		words := strings.Fields(s)
+		for i, w := range words {
+			words[i] = strings.ToUpper(w[:1]) + w[1:]
+		}
+		return strings.Join(words, " ")
+	},
+	"default": func(def, v interface{}) interface{} {
+		if v == nil || v == "" {
+			return def
+		}
+		return v
+	},
+}
+
+// parseTemplate compiles a body; missing params are errors rather than
+// "<no value>" in a customer's message.
+func parseTemplate(name, body string) (*template.Template, error) {
+	return template.New(name).Funcs(templateFuncs).Option("missingkey=error").Parse(body)
+}
+
+func (b *WhatsAppBridge) loadTemplate(name string) (*MessageTemplate, error) {
+	data, err := b.redisClient.HGet(b.ctx, templatesKey, name).Bytes()
+	if err == redis.Nil {
+		return nil, fmt.Errorf("template %q not found", name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var tpl MessageTemplate
+	if err := json.Unmarshal(data, &tpl); err != nil {
+		return nil, fmt.Errorf("template %q is corrupt: %v", name, err)
+	}
+	return &tpl, nil
+}
+
+// sentTemplate names the template and variant a send was rendered from.
+type sentTemplate struct {
+	Template string
+	Variant  string
+}
+
+type sentTemplateKey struct{}
+
+func withTemplate(ctx context.Context, t sentTemplate) context.Context {
+	return context.WithValue(ctx, sentTemplateKey{}, t)
+}
+
+// templateFromContext returns the template of sends on ctx, if any.
+func templateFromContext(ctx context.Context) sentTemplate {
+	t, _ := ctx.Value(sentTemplateKey{}).(sentTemplate)
+	return t
+}
+
+// renderTemplate renders the named template with params, in the variant
+// recipient gets. Unknown templates and missing params are permanent
+// failures.
+func (b *WhatsAppBridge) renderTemplate(name, recipient string, params map[string]interface{}) (*renderedTemplate, error) {
+	tpl, err := b.loadTemplate(name)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errPermanent, err)
+	}
+	variant := tpl.variantFor(recipient)
+	if variant != nil {
+		tpl = tpl.withVariant(variant)
+	}
+	render := func(part, body string) (string, error) {
+		t, err := parseTemplate(name, body)
+		if err != nil {
+			return "", fmt.Errorf("%w: %v", errPermanent, err)
+		}
+		var buf bytes.Buffer
+		if err := t.Execute(&buf, params); err != nil {
+			return "", fmt.Errorf("%w: rendering template %q %s: %v", errPermanent, name, part, err)
+		}
+		return buf.String(), nil
+	}
+
+	out := &renderedTemplate{Header: tpl.Header}
+	if variant != nil {
+		out.Variant = variant.Name
+	}
+	if out.Text, err = render("body", tpl.Body); err != nil {
+		return nil, err
+	}
+	if tpl.Footer != "" {
+		footer, err := render("footer", tpl.Footer)
+		if err != nil {
+			return nil, err
+		}
+		out.Text += "\n\n" + footer
+	}
+	if tpl.Header != nil {
+		if out.MediaURL, err = render("header", tpl.Header.URL); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// handleListTemplates serves GET /admin/templates.
+func (b *WhatsAppBridge) handleListTemplates(w http.ResponseWriter, r *http.Request) {
+	all, err := b.redisClient.HGetAll(r.Context(), templatesKey).Result()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	templates := make([]MessageTemplate, 0, len(all))
+	for _, data := range all {
+		var tpl MessageTemplate
+		if json.Unmarshal([]byte(data), &tpl) == nil {
+			templates = append(templates, tpl)
+		}
+	}
+	sort.Slice(templates, func(i, j int) bool { return templates[i].Name < templates[j].Name })
+	writeJSON(w, http.StatusOK, Response{Success: true, Data: templates})
+}
+
+// handleGetTemplate serves GET /admin/templates/{name}.
+func (b *WhatsAppBridge) handleGetTemplate(w http.ResponseWriter, r *http.Request) {
+	tpl, err := b.loadTemplate(mux.Vars(r)["name"])
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, Response{Success: false, Error: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, Response{Success: true, Data: tpl})
+}
+
+// handlePutTemplate serves PUT /admin/templates/{name}, creating or
+// replacing a template after checking that it parses.
+func (b *WhatsAppBridge) handlePutTemplate(w http.ResponseWriter, r *http.Request) {
+	var tpl MessageTemplate
+	if err := json.NewDecoder(r.Body).Decode(&tpl); err != nil {
+		writeJSON(w, http.StatusBadRequest, Response{Success: false, Error: err.Error()})
+		return
+	}
+	tpl.Name = mux.Vars(r)["name"]
+	if err := tpl.validate(); err != nil {
+		writeJSON(w, http.StatusBadRequest, Response{Success: false, Error: err.Error()})
+		return
+	}
+	tpl.UpdatedAt = time.Now().Unix()
+	tpl.UpdatedBy = operatorFromContext(r.Context())
+
+	data, _ := json.Marshal(tpl)
+	if err := b.redisClient.HSet(r.Context(), templatesKey, tpl.Name, data).Err(); err != nil {
+		writeJSON(w, http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, Response{Success: true, Data: tpl})
+}
+
+// handleDeleteTemplate serves DELETE /admin/templates/{name}.
+func (b *WhatsAppBridge) handleDeleteTemplate(w http.ResponseWriter, r *http.Request) {
+	n, err := b.redisClient.HDel(r.Context(), templatesKey, mux.Vars(r)["name"]).Result()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	if n == 0 {
+		writeJSON(w, http.StatusNotFound, Response{Success: false, Error: "template not found"})
+		return
+	}
+	writeJSON(w, http.StatusOK, Response{Success: true})
+}
@@ -0,0 +1,359 @@
+package bridge
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif" // decoders for image.Decode
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/gorilla/mux"
+)
+
+// Thumbnailer keeps small JPEG previews of image and video messages in the
+// media store, so chat UIs need not fetch the full file to render one.
+// Inbound media starts with the preview WhatsApp embeds in the message and
+// gets a sharper one once the file is downloaded; outbound media gets one
+// as it is sent. Images are scaled in process (JPEG, PNG and GIF); videos
+// use the first frame, through ffmpeg. Previews are shared by every message
+// with the same content and served by GET /media/{id}/thumbnail; payloads
+// carry their storage key in media_info.thumbnail. A nil Thumbnailer keeps
+// none.
+//
+// Previews of messages as they arrive or are sent are made in the
+// background, so payloads may name a preview before it is stored: GET
+// /media/{id}/thumbnail answers 404 until it is, or when it could not be
+// made. Images are measured before being decoded, and those over
+// THUMBNAIL_MAX_PIXELS get no preview. Previews count toward the media
+// retention limits (see retention.go).
+//
+//	THUMBNAILS            - keep previews (default false)
+//	THUMBNAIL_SIZE        - longest side in pixels (default 320)
+//	THUMBNAIL_QUALITY     - JPEG quality (default 75)
+//	THUMBNAIL_TIMEOUT     - how long ffmpeg may take on a video (default 10s)
+//	THUMBNAIL_MAX_PIXELS  - largest image scaled, in pixels (default 25000000)
+//	THUMBNAIL_CONCURRENCY - previews made at once (default 2)
+type Thumbnailer struct {
+	Size      int
+	Quality   int
+	Timeout   time.Duration
+	MaxPixels int64
+
+	library *MediaLibrary
+	redis   *redis.Client
+	ctx     context.Context
+	slots   chan struct{}
+	wg      sync.WaitGroup
+}
+
+func (b *WhatsAppBridge) thumbnailerFromEnv() *Thumbnailer {
+	if !envBool("THUMBNAILS", false) {
+		return nil
+	}
+	return &Thumbnailer{
+		Size:      max(envInt("THUMBNAIL_SIZE", 320), 16),
+		Quality:   min(max(envInt("THUMBNAIL_QUALITY", 75), 1), 100),
+		Timeout:   envDuration("THUMBNAIL_TIMEOUT", 10*time.Second),
+		MaxPixels: int64(max(envInt("THUMBNAIL_MAX_PIXELS", 25_000_000), 1)),
+		library:   b.media,
+		redis:     b.redisClient,
+		ctx:       b.ctx,
+		slots:     make(chan struct{}, max(envInt("THUMBNAIL_CONCURRENCY", 2), 1)),
+	}
+}
+
+// mediaThumbsKey scores stored previews, by content hash, by the Unix time
+// they were stored; mediaThumbSizesKey holds their sizes. The retention
+// janitor prunes them along with the media.
+const (
+	mediaThumbsKey     = "whatsapp:media_thumbs"
+	mediaThumbSizesKey = "whatsapp:media_thumb_sizes"
+)
+
+// thumbnailKey is where the preview of content with the given hex sha256
+// is stored.
+func thumbnailKey(sum string) string {
+	return "thumbs/" + sum[:2] + "/" + sum + ".jpg"
+}
+
+// thumbnailRefKey maps a message ID to its preview's key.
+func thumbnailRefKey(messageID string) string { return "whatsapp:thumbnail:" + messageID }
+
+// Embedded stores the preview carried by an inbound image or video message
+// in the background and returns its key, or "" when there is none.
+func (t *Thumbnailer) Embedded(messageID, sum string, media inboundMedia) string {
+	if t == nil || len(sum) != 64 {
+		return ""
+	}
+	withThumb, ok := media.(interface{ GetJPEGThumbnail() []byte })
+	if !ok || len(withThumb.GetJPEGThumbnail()) == 0 {
+		return ""
+	}
+	key := thumbnailKey(sum)
+	t.background(func(ctx context.Context) {
+		// A generated preview is sharper than the embedded one: keep it.
+		if !t.library.Store.Exists(ctx, key) {
+			if err := t.put(ctx, sum, withThumb.GetJPEGThumbnail()); err != nil {
+				log.Printf("Error storing the thumbnail of %s: %v", messageID, err)
+				return
+			}
+		}
+		t.remember(ctx, messageID, key)
+	})
+	return key
+}
+
+// Queue makes the preview of image or video content in the background and
+// returns the key it is stored under, or "" for other kinds.
+func (t *Thumbnailer) Queue(messageID, kind, sum string, content []byte) string {
+	if t == nil || len(sum) != 64 || (kind != "image" && kind != "video") {
+		return ""
+	}
+	t.background(func(ctx context.Context) {
+		t.Generate(ctx, messageID, kind, sum, bytes.NewReader(content))
+	})
+	return thumbnailKey(sum)
+}
+
+// background runs fn once a slot is free.
+func (t *Thumbnailer) background(fn func(ctx context.Context)) {
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+		select {
+		case t.slots <- struct{}{}:
+			defer func() { <-t.slots }()
+		case <-t.ctx.Done():
+			return
+		}
+		fn(t.ctx)
+	}()
+}
+
+// Wait returns once the previews queued so far are made.
+func (t *Thumbnailer) Wait() {
+	if t != nil {
+		t.wg.Wait()
+	}
+}
+
+// Generate makes the preview of image or video content, stores it and
+// returns its key, or "" for other kinds or when it cannot be made.
+func (t *Thumbnailer) Generate(ctx context.Context, messageID, kind, sum string, content io.Reader) string {
+	if t == nil || len(sum) != 64 || (kind != "image" && kind != "video") {
+		return ""
+	}
+	var thumb []byte
+	var err error
+	if kind == "image" {
+		thumb, err = t.scaleImage(content)
+	} else {
+		thumb, err = t.videoFrame(ctx, content)
+	}
+	if errors.Is(err, exec.ErrNotFound) {
+		return "" // no ffmpeg: videos keep the embedded preview
+	}
+	if err != nil {
+		log.Printf("Error making the thumbnail of %s: %v", messageID, err)
+		return ""
+	}
+	key := thumbnailKey(sum)
+	if err := t.put(ctx, sum, thumb); err != nil {
+		log.Printf("Error storing the thumbnail of %s: %v", messageID, err)
+		return ""
+	}
+	t.remember(ctx, messageID, key)
+	return key
+}
+
+// FromStored regenerates the preview of a downloaded image or video.
+func (t *Thumbnailer) FromStored(ctx context.Context, messageID, kind string, blob *StoredMedia) string {
+	if t == nil || (kind != "image" && kind != "video") {
+		return ""
+	}
+	content, _, err := t.library.Store.Open(ctx, blob.Key)
+	if err != nil {
+		log.Printf("Error opening media %s for its thumbnail: %v", blob.Key, err)
+		return ""
+	}
+	defer content.Close()
+	return t.Generate(ctx, messageID, kind, blob.SHA256, content)
+}
+
+// put stores the preview of the content with the given hex sha256 and
+// adds it to the retention index.
+func (t *Thumbnailer) put(ctx context.Context, sum string, thumb []byte) error {
+	if err := os.MkdirAll(t.library.Dir, 0755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(t.library.Dir, "thumbnail-*.part")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(thumb)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = t.library.Store.Put(ctx, thumbnailKey(sum), f.Name(), "image/jpeg")
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	pipe := t.redis.TxPipeline()
+	pipe.ZAdd(ctx, mediaThumbsKey, &redis.Z{Score: float64(time.Now().Unix()), Member: sum})
+	pipe.HSet(ctx, mediaThumbSizesKey, sum, len(thumb))
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+func (t *Thumbnailer) remember(ctx context.Context, messageID, key string) {
+	if err := t.redis.Set(ctx, thumbnailRefKey(messageID), key, mediaSourceTTL()).Err(); err != nil {
+		log.Printf("Error recording the thumbnail of %s: %v", messageID, err)
+	}
+}
+
+// scaleImage decodes an image and encodes it as a JPEG at most Size
+// pixels on its longest side. The dimensions are read from the header
+// first: a small file can hold an image that takes gigabytes decoded.
+func (t *Thumbnailer) scaleImage(content io.Reader) ([]byte, error) {
+	var header bytes.Buffer
+	config, _, err := image.DecodeConfig(io.TeeReader(content, &header))
+	if err != nil {
+		return nil, err
+	}
+	if int64(config.Width)*int64(config.Height) > t.MaxPixels {
+		return nil, fmt.Errorf("%dx%d image is over THUMBNAIL_MAX_PIXELS", config.Width, config.Height)
+	}
+	src, _, err := image.Decode(io.MultiReader(&header, content))
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, downscale(src, t.Size), &jpeg.Options{Quality: t.Quality}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// downscale shrinks src to fit in size x size by averaging the source
+// pixels under each destination pixel. Smaller images are returned as is.
+func downscale(src image.Image, size int) image.Image {
+	bounds := src.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if w <= size && h <= size {
+		return src
+	}
+	dw, dh := size, max(h*size/w, 1)
+	if h > w {
+		dw, dh = max(w*size/h, 1), size
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		y0, y1 := bounds.Min.Y+y*h/dh, bounds.Min.Y+max((y+1)*h/dh, y*h/dh+1)
+		for x := 0; x < dw; x++ {
+			x0, x1 := bounds.Min.X+x*w/dw, bounds.Min.X+max((x+1)*w/dw, x*w/dw+1)
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					pr, pg, pb, pa := src.At(sx, sy).RGBA()
+					r, g, b, a, n = r+uint64(pr), g+uint64(pg), b+uint64(pb), a+uint64(pa), n+1
+				}
+			}
+			i := dst.PixOffset(x, y)
+			dst.Pix[i], dst.Pix[i+1], dst.Pix[i+2], dst.Pix[i+3] =
+				uint8(r/n>>8), uint8(g/n>>8), uint8(b/n>>8), uint8(a/n>>8)
+		}
+	}
+	return dst
+}
+
+// videoFrame grabs the first frame of a video with ffmpeg. The video is
+// written to a temporary file: most MP4s cannot be read from a pipe.
+func (t *Thumbnailer) videoFrame(ctx context.Context, content io.Reader) ([]byte, error) {
+	f, err := os.CreateTemp("", "thumbnail-*.video")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f.Name())
+	_, err = io.Copy(f, content)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, t.Timeout)
+	defer cancel()
+	scale := fmt.Sprintf("scale='min(%d,iw)':'min(%d,ih)':force_original_aspect_ratio=decrease", t.Size, t.Size)
+	cmd := exec.CommandContext(ctx, envString("FFMPEG_PATH", "ffmpeg"), "-hide_banner", "-loglevel", "error",
+		"-i", f.Name(), "-frames:v", "1", "-vf", scale, "-q:v", strconv.Itoa(31-t.Quality*29/100),
+		"-f", "image2", "-c:v", "mjpeg", "pipe:1")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%w: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	if stdout.Len() == 0 {
+		return nil, fmt.Errorf("ffmpeg returned no frame")
+	}
+	return stdout.Bytes(), nil
+}
+
+// deleteThumbnail removes the preview of the media stored under key.
+func (l *MediaLibrary) deleteThumbnail(ctx context.Context, key string) {
+	sum := strings.TrimSuffix(path.Base(key), path.Ext(key))
+	if len(sum) != 64 {
+		return
+	}
+	if err := l.purgeThumbnail(ctx, sum); err != nil {
+		log.Printf("Error removing the thumbnail of %s: %v", key, err)
+	}
+}
+
+// purgeThumbnail deletes the preview of the content with the given hex
+// sha256, its records first.
+func (l *MediaLibrary) purgeThumbnail(ctx context.Context, sum string) error {
+	pipe := l.redis.TxPipeline()
+	pipe.ZRem(ctx, mediaThumbsKey, sum)
+	pipe.HDel(ctx, mediaThumbSizesKey, sum)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+	return l.Store.Delete(ctx, thumbnailKey(sum))
+}
+
+// handleGetThumbnail serves GET /media/{id}/thumbnail.
+func (b *WhatsAppBridge) handleGetThumbnail(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	key, err := b.redisClient.Get(r.Context(), thumbnailRefKey(id)).Result()
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, Response{Success: false, Error: "no thumbnail for message " + id})
+		return
+	}
+	content, modTime, err := b.media.Store.Open(r.Context(), key)
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, Response{Success: false, Error: "thumbnail of message " + id + " is gone"})
+		return
+	}
+	defer content.Close()
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+	http.ServeContent(w, r, path.Base(key), modTime, content)
+}
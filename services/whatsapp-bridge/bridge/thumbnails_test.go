@@ -0,0 +1,69 @@
+package bridge_test
+
+import (
+	"net/http"
+	"testing"
+
+	"go.mau.fi/whatsmeow"
+
+	"github.com/phenobarbital/ai-parrot/whatsapp-bridge/bridge"
+	"github.com/phenobarbital/ai-parrot/whatsapp-bridge/bridgetest"
+)
+
+// getThumbnail fetches GET /media/{id}/thumbnail and returns its status.
+func getThumbnail(t *testing.T, h *bridgetest.Harness, id string) int {
+	t.Helper()
+	resp, err := h.Server.Client().Get(h.Server.URL + "/media/" + id + "/thumbnail")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestThumbnailOfDownloadedImage(t *testing.T) {
+	h := bridgetest.New(t,
+		bridgetest.WithEnv("THUMBNAILS", "true"),
+		bridgetest.WithEnv("MEDIA_DOWNLOAD", "true"),
+		bridgetest.WithEnv("MEDIA_RETENTION_MAX_BYTES", "1"),
+		bridgetest.WithEnv("RETENTION_INTERVAL", "0"),
+	)
+	media := encryptMedia(t, testPNG(t), whatsmeow.MediaImage)
+	receiveImage(h, "IMG1", "5215512345678", serveMedia(t, media.File).URL+"/image", media)
+
+	var downloaded bridge.MediaDownloaded
+	h.DecodePayload(h.ExpectEvent(bridge.EventMediaDownloaded), &downloaded)
+	if downloaded.Thumbnail == "" {
+		t.Fatal("media_downloaded has no thumbnail")
+	}
+	if status := getThumbnail(t, h, "IMG1"); status != http.StatusOK {
+		t.Fatalf("GET /media/IMG1/thumbnail = %d, want 200", status)
+	}
+
+	// The thumbnail counts toward the retention limits and goes with its image.
+	if report := runCleanup(t, h); report.MediaDeleted != 2 || report.MediaBlobs != 0 || report.MediaBytes != 0 {
+		t.Fatalf("cleanup report = %+v", report)
+	}
+	if status := getThumbnail(t, h, "IMG1"); status != http.StatusNotFound {
+		t.Fatalf("GET /media/IMG1/thumbnail after cleanup = %d, want 404", status)
+	}
+}
+
+func TestThumbnailSkipsImagesOverMaxPixels(t *testing.T) {
+	h := bridgetest.New(t,
+		bridgetest.WithEnv("THUMBNAILS", "true"),
+		bridgetest.WithEnv("THUMBNAIL_MAX_PIXELS", "16"),
+		bridgetest.WithEnv("MEDIA_DOWNLOAD", "true"),
+	)
+	media := encryptMedia(t, testPNG(t), whatsmeow.MediaImage)
+	receiveImage(h, "IMG2", "5215512345678", serveMedia(t, media.File).URL+"/image", media)
+
+	var downloaded bridge.MediaDownloaded
+	h.DecodePayload(h.ExpectEvent(bridge.EventMediaDownloaded), &downloaded)
+	if downloaded.Thumbnail != "" {
+		t.Fatalf("8x8 image over a 16 pixel limit got thumbnail %q", downloaded.Thumbnail)
+	}
+	if status := getThumbnail(t, h, "IMG2"); status != http.StatusNotFound {
+		t.Fatalf("GET /media/IMG2/thumbnail = %d, want 404", status)
+	}
+}
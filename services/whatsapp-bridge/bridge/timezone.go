@@ -0,0 +1,35 @@
+package bridge
+
+import (
+	"log"
+	"time"
+)
+
+// loadLocation resolves BRIDGE_TIMEZONE (an IANA name such as
+// "America/Mexico_City") and falls back to UTC when unset or invalid.
+func loadLocation() *time.Location {
+	name := envString("BRIDGE_TIMEZONE", "UTC")
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		log.Printf("⚠️ Unknown BRIDGE_TIMEZONE %q, using UTC: %v", name, err)
+		return time.UTC
+	}
+	return loc
+}
+
+// formatTime renders t as RFC3339 in the bridge's configured timezone.
+func (b *WhatsAppBridge) formatTime(t time.Time) string {
+	return t.In(b.location).Format(time.RFC3339)
+}
+
+// timestampFields returns the Unix and localized representations of t for
+// inclusion in JSON responses. "timestamp" keeps its original encoding for
+// existing clients.
+func (b *WhatsAppBridge) timestampFields(t time.Time) map[string]interface{} {
+	return map[string]interface{}{
+		"timestamp":      t,
+		"timestamp_unix": t.Unix(),
+		"timestamp_iso":  b.formatTime(t),
+		"timezone":       b.location.String(),
+	}
+}
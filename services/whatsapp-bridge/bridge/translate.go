@@ -0,0 +1,150 @@
+package bridge
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Translation is attached to inbound payloads whose text is not already in
+// the target language.
+type Translation struct {
+	Text           string `json:"text"`
+	SourceLanguage string `json:"source_language"`
+	TargetLanguage string `json:"target_language"`
+}
+
+// Translator calls a LibreTranslate-compatible endpoint (TRANSLATE_URL, e.g.
+// http://libretranslate:5000/translate, with optional TRANSLATE_API_KEY):
+//
+//	request:  {"q": "...", "source": "auto", "target": "en", "format": "text"}
+//	response: {"translatedText": "...", "detectedLanguage": {"language": "es"}}
+//
+// Inbound text is translated into TRANSLATE_TARGET (default "en") and each
+// chat's detected language is remembered, so that with TRANSLATE_OUTGOING
+// replies are translated back into it. Failures never block a message: it
+// is delivered untranslated. A nil Translator does nothing.
+type Translator struct {
+	url      string
+	apiKey   string
+	target   string
+	outgoing bool
+	langTTL  time.Duration
+	client   *http.Client
+	bridge   *WhatsAppBridge
+}
+
+// translatorFromEnv returns nil unless TRANSLATE_URL is set.
+func (b *WhatsAppBridge) translatorFromEnv() *Translator {
+	url := envString("TRANSLATE_URL", "")
+	if url == "" {
+		return nil
+	}
+	return &Translator{
+		url:      url,
+		apiKey:   envString("TRANSLATE_API_KEY", ""),
+		target:   envString("TRANSLATE_TARGET", "en"),
+		outgoing: envBool("TRANSLATE_OUTGOING", false),
+		langTTL:  envDuration("TRANSLATE_LANGUAGE_TTL", 30*24*time.Hour),
+		client:   &http.Client{Timeout: envDuration("TRANSLATE_TIMEOUT", 5*time.Second)},
+		bridge:   b,
+	}
+}
+
+func chatLanguageKey(chat string) string { return "whatsapp:lang:" + chat }
+
+// Inbound translates text into the target language and remembers the chat's
+// language. It returns nil when the text is already in the target language.
+func (t *Translator) Inbound(ctx context.Context, chat, text string) *Translation {
+	if t == nil || strings.TrimSpace(text) == "" {
+		return nil
+	}
+	translated, source, err := t.translate(ctx, text, "auto", t.target)
+	if err != nil {
+		log.Printf("Error translating message in %s: %v", chat, err)
+		return nil
+	}
+	if source != "" {
+		t.bridge.redisClient.Set(ctx, chatLanguageKey(chat), source, t.langTTL)
+	}
+	if source == t.target || translated == text {
+		return nil
+	}
+	return &Translation{Text: translated, SourceLanguage: source, TargetLanguage: t.target}
+}
+
+// Outgoing translates a reply into language, or into the chat's last
+// detected language when empty. It returns text unchanged when outgoing
+// translation is off, the language is unknown or already the target, or
+// the endpoint fails.
+func (t *Translator) Outgoing(ctx context.Context, chat, language, text string) string {
+	if t == nil || strings.TrimSpace(text) == "" {
+		return text
+	}
+	if language == "" {
+		if !t.outgoing {
+			return text
+		}
+		language, _ = t.bridge.redisClient.Get(ctx, chatLanguageKey(chat)).Result()
+	}
+	if language == "" || language == t.target {
+		return text
+	}
+	translated, _, err := t.translate(ctx, text, t.target, language)
+	if err != nil {
+		log.Printf("Error translating reply to %s into %s: %v", chat, language, err)
+		return text
+	}
+	return translated
+}
+
+func (t *Translator) translate(ctx context.Context, text, source, target string) (string, string, error) {
+	body := map[string]string{
+		"q":      text,
+		"source": source,
+		"target": target,
+		"format": "text",
+	}
+	if t.apiKey != "" {
+		body["api_key"] = t.apiKey
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return "", "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url, bytes.NewReader(data))
+	if err != nil {
+		return "", "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return "", "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return "", "", fmt.Errorf("translation endpoint returned %d: %s", resp.StatusCode, strings.TrimSpace(string(detail)))
+	}
+
+	var out struct {
+		TranslatedText   string `json:"translatedText"`
+		DetectedLanguage struct {
+			Language string `json:"language"`
+		} `json:"detectedLanguage"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", "", fmt.Errorf("invalid translation response: %v", err)
+	}
+	if source == "auto" {
+		source = out.DetectedLanguage.Language
+	}
+	return out.TranslatedText, source, nil
+}
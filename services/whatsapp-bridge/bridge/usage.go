@@ -0,0 +1,191 @@
+package bridge
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Usage accounting for chargeback and abuse detection across the teams
+// sharing a bridge. Usage is counted per operator: the name an API key or
+// JWT resolves to, or the consumer for queue-driven sends ("amqp:<queue>",
+// "kafka:<topic>"...). Counters roll up by day in the bridge's timezone and
+// are served by GET /admin/usage: to each operator its own, to the
+// operators in BRIDGE_ADMIN_OPERATORS everyone's.
+//
+//	USAGE_TRACKING  - count usage (default true)
+//	USAGE_RETENTION - how long daily rollups are kept (default 90 days)
+//
+//	whatsapp:usage:<YYYY-MM-DD> - hash: "<operator>|<metric>" -> count, with
+//	                              "\" and "|" in operator names escaped by "\"
+
+// Usage metrics.
+const (
+	UsageAPICalls     = "api_calls"     // authenticated HTTP requests
+	UsageMessagesSent = "messages_sent" // messages that left the bridge, parts of split messages included
+	UsageMediaBytes   = "media_bytes"   // bytes of media uploaded to WhatsApp
+)
+
+var usageMetrics = []string{UsageAPICalls, UsageMessagesSent, UsageMediaBytes}
+
+const usageDateLayout = "2006-01-02"
+
+func usageKey(day string) string { return "whatsapp:usage:" + day }
+
+var (
+	usageEscaper   = strings.NewReplacer(`\`, `\\`, `|`, `\|`)
+	usageUnescaper = strings.NewReplacer(`\\`, `\`, `\|`, `|`)
+)
+
+// usageField names the operator's metric in a day's hash.
+func usageField(operator, metric string) string {
+	return usageEscaper.Replace(operator) + "|" + metric
+}
+
+// parseUsageField splits a field at its last "|", since metrics have none.
+func parseUsageField(field string) (operator, metric string, ok bool) {
+	i := strings.LastIndexByte(field, '|')
+	if i < 0 {
+		return "", "", false
+	}
+	return usageUnescaper.Replace(field[:i]), field[i+1:], true
+}
+
+// recordUsage adds n to the operator's metric for today. Counting never
+// fails the operation being counted.
+func (b *WhatsAppBridge) recordUsage(ctx context.Context, operator, metric string, n int64) {
+	if n == 0 || !envBool("USAGE_TRACKING", true) {
+		return
+	}
+	key := usageKey(time.Now().In(b.location).Format(usageDateLayout))
+	pipe := b.redisClient.Pipeline()
+	pipe.HIncrBy(ctx, key, usageField(operator, metric), n)
+	pipe.Expire(ctx, key, envDuration("USAGE_RETENTION", 90*24*time.Hour))
+	if _, err := pipe.Exec(context.WithoutCancel(ctx)); err != nil {
+		log.Printf("Error recording %s usage of %s: %v", metric, operator, err)
+	}
+}
+
+// usageMiddleware counts API calls by operator. Public paths, which carry no
+// operator when auth is on, and health checks are not counted.
+func (b *WhatsAppBridge) usageMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		operator, ok := r.Context().Value(operatorKey{}).(string)
+		if ok && r.Method != http.MethodOptions && r.URL.Path != "/health" {
+			b.recordUsage(r.Context(), operator, UsageAPICalls, 1)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// UsageDay is one day of usage, by operator and metric.
+type UsageDay struct {
+	Date      string                      `json:"date"`
+	Operators map[string]map[string]int64 `json:"operators"`
+}
+
+// UsageReport is the response of GET /admin/usage.
+type UsageReport struct {
+	From     string                      `json:"from"`
+	To       string                      `json:"to"`
+	Timezone string                      `json:"timezone"`
+	Days     []UsageDay                  `json:"days"`
+	Totals   map[string]map[string]int64 `json:"totals"` // operator -> metric -> count over the range
+}
+
+// usageReport reads the rollups of the days from..to, optionally of one
+// operator.
+func (b *WhatsAppBridge) usageReport(ctx context.Context, from, to time.Time, operator string) (*UsageReport, error) {
+	report := &UsageReport{
+		From:     from.Format(usageDateLayout),
+		To:       to.Format(usageDateLayout),
+		Timezone: b.location.String(),
+		Days:     []UsageDay{},
+		Totals:   make(map[string]map[string]int64),
+	}
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		date := day.Format(usageDateLayout)
+		fields, err := b.redisClient.HGetAll(ctx, usageKey(date)).Result()
+		if err != nil {
+			return nil, err
+		}
+		usage := UsageDay{Date: date, Operators: make(map[string]map[string]int64)}
+		for field, value := range fields {
+			op, metric, ok := parseUsageField(field)
+			if !ok || (operator != "" && op != operator) {
+				continue
+			}
+			n, _ := strconv.ParseInt(value, 10, 64)
+			addUsage(usage.Operators, op, metric, n)
+			addUsage(report.Totals, op, metric, n)
+		}
+		if len(usage.Operators) > 0 {
+			report.Days = append(report.Days, usage)
+		}
+	}
+	return report, nil
+}
+
+// addUsage adds n to m[operator][metric], with every metric present so
+// reports have a stable shape.
+func addUsage(m map[string]map[string]int64, operator, metric string, n int64) {
+	if m[operator] == nil {
+		m[operator] = make(map[string]int64, len(usageMetrics))
+		for _, name := range usageMetrics {
+			m[operator][name] = 0
+		}
+	}
+	m[operator][metric] += n
+}
+
+// handleUsage serves GET /admin/usage?from=YYYY-MM-DD&to=YYYY-MM-DD&operator=...
+// The range defaults to the last 7 days and spans at most 366. Operators
+// other than admins only get their own usage.
+func (b *WhatsAppBridge) handleUsage(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	operator := query.Get("operator")
+	if caller := operatorFromContext(r.Context()); !b.auth.IsAdmin(caller) {
+		if operator != "" && operator != caller {
+			writeJSON(w, http.StatusForbidden, Response{Success: false, Error: "only admins may see other operators' usage"})
+			return
+		}
+		operator = caller
+	}
+	today := time.Now().In(b.location)
+	today = time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, b.location)
+	parse := func(name string, def time.Time) (time.Time, error) {
+		value := query.Get(name)
+		if value == "" {
+			return def, nil
+		}
+		t, err := time.ParseInLocation(usageDateLayout, value, b.location)
+		if err != nil {
+			return t, fmt.Errorf("invalid %s %q, expected YYYY-MM-DD", name, value)
+		}
+		return t, nil
+	}
+	to, err := parse("to", today)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, Response{Success: false, Error: err.Error()})
+		return
+	}
+	from, err := parse("from", to.AddDate(0, 0, -6))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, Response{Success: false, Error: err.Error()})
+		return
+	}
+	if from.After(to) || to.Sub(from) > 366*24*time.Hour {
+		writeJSON(w, http.StatusBadRequest, Response{Success: false, Error: "from must not be after to, and the range must span at most 366 days"})
+		return
+	}
+	report, err := b.usageReport(r.Context(), from, to, operator)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, Response{Success: true, Data: report})
+}
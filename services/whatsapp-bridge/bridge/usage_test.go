@@ -0,0 +1,66 @@
+package bridge_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/phenobarbital/ai-parrot/whatsapp-bridge/bridge"
+	"github.com/phenobarbital/ai-parrot/whatsapp-bridge/bridgetest"
+)
+
+// doWithKey is h.Do authenticated with an API key.
+func doWithKey(t *testing.T, h *bridgetest.Harness, key, method, path string, body any) (int, bridge.Response) {
+	t.Helper()
+	var buf bytes.Buffer
+	if body != nil {
+		json.NewEncoder(&buf).Encode(body)
+	}
+	req, _ := http.NewRequest(method, h.Server.URL+path, &buf)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-API-Key", key)
+	resp, err := h.Server.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var out bridge.Response
+	json.NewDecoder(resp.Body).Decode(&out)
+	return resp.StatusCode, out
+}
+
+func TestUsageScopedToCaller(t *testing.T) {
+	h := bridgetest.New(t,
+		bridgetest.WithEnv("BRIDGE_API_KEYS", "team-key:team|a,ops-key:ops"),
+		bridgetest.WithEnv("BRIDGE_ADMIN_OPERATORS", "ops"),
+	)
+	if status, resp := doWithKey(t, h, "team-key", http.MethodPost, "/send",
+		bridge.OutgoingMessage{Phone: "5215512345678", Message: "hola"}); status != http.StatusOK {
+		t.Fatalf("send: %d %s", status, resp.Error)
+	}
+
+	status, resp := doWithKey(t, h, "team-key", http.MethodGet, "/admin/usage", nil)
+	if status != http.StatusOK {
+		t.Fatalf("own usage: %d %s", status, resp.Error)
+	}
+	var report bridge.UsageReport
+	decodeData(t, resp.Data, &report)
+	if len(report.Totals) != 1 || report.Totals["team|a"][bridge.UsageMessagesSent] != 1 {
+		t.Fatalf("own usage totals = %v", report.Totals)
+	}
+
+	if status, _ := doWithKey(t, h, "team-key", http.MethodGet, "/admin/usage?operator=ops", nil); status != http.StatusForbidden {
+		t.Fatalf("other operator's usage: %d, want 403", status)
+	}
+
+	status, resp = doWithKey(t, h, "ops-key", http.MethodGet, "/admin/usage", nil)
+	if status != http.StatusOK {
+		t.Fatalf("admin usage: %d %s", status, resp.Error)
+	}
+	var all bridge.UsageReport
+	decodeData(t, resp.Data, &all)
+	if _, ok := all.Totals["team|a"]; !ok || len(all.Totals) != 2 {
+		t.Fatalf("admin usage totals = %v", all.Totals)
+	}
+}
@@ -0,0 +1,258 @@
+package bridge
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"google.golang.org/protobuf/proto"
+)
+
+// ContactCard describes one contact to share. Either VCard (raw vCard text)
+// or Name plus Phone must be provided.
+type ContactCard struct {
+	Name  string `json:"name,omitempty"`
+	Phone string `json:"phone,omitempty"`
+	Org   string `json:"org,omitempty"`
+	Email string `json:"email,omitempty"`
+	VCard string `json:"vcard,omitempty"`
+}
+
+// SharedContact is a contact card received in a chat, parsed from its vCard.
+type SharedContact struct {
+	Name   string         `json:"name"`
+	Org    string         `json:"org,omitempty"`
+	Phones []ContactPhone `json:"phones"`
+	Emails []string       `json:"emails,omitempty"`
+	VCard  string         `json:"vcard"`
+}
+
+// ContactPhone is a phone number of a shared contact. WAID is the number's
+// WhatsApp user, when the sender's phone knew it, which is also its JID's
+// user part.
+type ContactPhone struct {
+	Number string   `json:"number"`
+	WAID   string   `json:"waid,omitempty"`
+	Types  []string `json:"types,omitempty"` // e.g. CELL, WORK
+}
+
+// ContactsMessage is the payload accepted by the /send/contacts endpoint.
+type ContactsMessage struct {
+	Phone    string        `json:"phone"`
+	Server   string        `json:"server,omitempty"`
+	ChatType string        `json:"chat_type,omitempty"`
+	Contacts []ContactCard `json:"contacts"`
+}
+
+func (b *WhatsAppBridge) handleSendContacts(w http.ResponseWriter, r *http.Request) {
+	var msg ContactsMessage
+	if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+		writeJSON(w, http.StatusBadRequest, Response{Success: false, Error: err.Error()})
+		return
+	}
+
+	if msg.Phone == "" || len(msg.Contacts) == 0 {
+		writeJSON(w, http.StatusBadRequest, Response{Success: false, Error: "phone and contacts are required"})
+		return
+	}
+	jid, err := resolveRecipient(msg.Phone, msg.Server, msg.ChatType)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, Response{Success: false, Error: err.Error()})
+		return
+	}
+	ctx, jid, err := b.checkSend(context.WithoutCancel(r.Context()), jid, OutgoingMessage{})
+	if err != nil {
+		b.writeSendError(w, err, SendResult{})
+		return
+	}
+
+	cards := make([]*waE2E.ContactMessage, 0, len(msg.Contacts))
+	for i, c := range msg.Contacts {
+		card, err := c.toContactMessage()
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, Response{Success: false, Error: fmt.Sprintf("contacts[%d]: %v", i, err)})
+			return
+		}
+		cards = append(cards, card)
+	}
+
+	message := &waE2E.Message{}
+	if len(cards) == 1 {
+		message.ContactMessage = cards[0]
+	} else {
+		message.ContactsArrayMessage = &waE2E.ContactsArrayMessage{
+			DisplayName: proto.String(fmt.Sprintf("%d contacts", len(cards))),
+			Contacts:    cards,
+		}
+	}
+
+	log.Printf("Sending %d contact card(s) to %s", len(cards), jid.User)
+
+	resp, err := b.deliver(ctx, jid, message, 0)
+	if err != nil {
+		log.Printf("Error sending contacts to %s: %v", jid.User, err)
+		b.reportSendFailure(err, jid, "contacts")
+		b.writeSendError(w, err, SendResult{})
+		return
+	}
+
+	log.Printf("Contacts sent to %s, ID: %s", jid.User, resp.ID)
+	names := make([]string, len(cards))
+	for i, card := range cards {
+		names[i] = card.GetDisplayName()
+	}
+	b.archiveOutgoing(r.Context(), jid.String(), resp.ID, "contacts", strings.Join(names, ", "), resp.Timestamp)
+	data := b.timestampFields(resp.Timestamp)
+	data["message_id"] = resp.ID
+	data["contacts"] = len(cards)
+	writeJSON(w, http.StatusOK, Response{Success: true, Data: data})
+}
+
+// toContactMessage builds the WhatsApp ContactMessage for a card, generating
+// a vCard 3.0 document from the structured fields when no raw vCard is given.
+func (c ContactCard) toContactMessage() (*waE2E.ContactMessage, error) {
+	if c.VCard != "" {
+		if !strings.Contains(strings.ToUpper(c.VCard), "BEGIN:VCARD") {
+			return nil, fmt.Errorf("vcard must start with BEGIN:VCARD")
+		}
+		name := c.Name
+		if name == "" {
+			name = vcardProperty(c.VCard, "FN")
+		}
+		return &waE2E.ContactMessage{
+			DisplayName: proto.String(name),
+			Vcard:       proto.String(c.VCard),
+		}, nil
+	}
+
+	if c.Name == "" || c.Phone == "" {
+		return nil, fmt.Errorf("name and phone (or vcard) are required")
+	}
+
+	return &waE2E.ContactMessage{
+		DisplayName: proto.String(c.Name),
+		Vcard:       proto.String(buildVCard(c)),
+	}, nil
+}
+
+// buildVCard renders a vCard 3.0 with a waid parameter so WhatsApp shows the
+// "Message" button for the number.
+func buildVCard(c ContactCard) string {
+	digits := recipientJID(c.Phone, "").User
+
+	var sb strings.Builder
+	sb.WriteString("BEGIN:VCARD\nVERSION:3.0\n")
+	fmt.Fprintf(&sb, "N:;%s;;;\n", vcardEscape(c.Name))
+	fmt.Fprintf(&sb, "FN:%s\n", vcardEscape(c.Name))
+	if c.Org != "" {
+		fmt.Fprintf(&sb, "ORG:%s;\n", vcardEscape(c.Org))
+	}
+	fmt.Fprintf(&sb, "TEL;type=CELL;type=VOICE;waid=%s:+%s\n", digits, digits)
+	if c.Email != "" {
+		fmt.Fprintf(&sb, "EMAIL;type=INTERNET:%s\n", vcardEscape(c.Email))
+	}
+	sb.WriteString("END:VCARD")
+	return sb.String()
+}
+
+var vcardEscaper = strings.NewReplacer(`\`, `\\`, ",", `\,`, ";", `\;`, "\n", `\n`)
+
+func vcardEscape(s string) string {
+	return vcardEscaper.Replace(s)
+}
+
+// contactsFromMessage returns the cards of a contact or contacts array
+// message.
+func contactsFromMessage(msg *waE2E.Message) []SharedContact {
+	cards := msg.GetContactsArrayMessage().GetContacts()
+	if single := msg.GetContactMessage(); single != nil {
+		cards = []*waE2E.ContactMessage{single}
+	}
+	contacts := make([]SharedContact, 0, len(cards))
+	for _, card := range cards {
+		contacts = append(contacts, parseVCard(card.GetDisplayName(), card.GetVcard()))
+	}
+	return contacts
+}
+
+// parseVCard extracts the name, organization, phone numbers and emails of
+// a vCard, falling back to displayName for cards without FN.
+func parseVCard(displayName, vcard string) SharedContact {
+	contact := SharedContact{Name: displayName, Phones: []ContactPhone{}, VCard: vcard}
+	for _, line := range vcardLines(vcard) {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		params := strings.Split(key, ";")
+		// iOS groups properties as "item1.TEL".
+		name := strings.ToUpper(strings.TrimSpace(params[0]))
+		if _, after, grouped := strings.Cut(name, "."); grouped {
+			name = after
+		}
+		value = vcardUnescape(strings.TrimSpace(value))
+		switch name {
+		case "FN":
+			if value != "" {
+				contact.Name = value
+			}
+		case "ORG":
+			contact.Org = strings.TrimRight(value, ";")
+		case "TEL":
+			phone := ContactPhone{Number: value}
+			for _, param := range params[1:] {
+				k, v, _ := strings.Cut(param, "=")
+				switch strings.ToLower(strings.TrimSpace(k)) {
+				case "waid":
+					phone.WAID = v
+				case "type":
+					phone.Types = append(phone.Types, strings.ToUpper(v))
+				}
+			}
+			contact.Phones = append(contact.Phones, phone)
+		case "EMAIL":
+			contact.Emails = append(contact.Emails, value)
+		}
+	}
+	return contact
+}
+
+// vcardLines splits a vCard into logical lines, unfolding continuations
+// (lines starting with a space or tab).
+func vcardLines(vcard string) []string {
+	var lines []string
+	for _, line := range strings.Split(strings.ReplaceAll(vcard, "\r\n", "\n"), "\n") {
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+var vcardUnescaper = strings.NewReplacer(`\\`, `\`, `\,`, ",", `\;`, ";", `\n`, "\n", `\N`, "\n")
+
+func vcardUnescape(s string) string {
+	return vcardUnescaper.Replace(s)
+}
+
+// vcardProperty returns the value of the first line whose property name
+// (ignoring parameters) matches name, e.g. "FN".
+func vcardProperty(vcard, name string) string {
+	for _, line := range strings.Split(strings.ReplaceAll(vcard, "\r\n", "\n"), "\n") {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key, _, _ = strings.Cut(key, ";")
+		if strings.EqualFold(strings.TrimSpace(key), name) {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
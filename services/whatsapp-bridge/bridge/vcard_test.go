@@ -0,0 +1,42 @@
+package bridge_test
+
+import (
+	"slices"
+	"testing"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/phenobarbital/ai-parrot/whatsapp-bridge/bridgetest"
+)
+
+func TestInboundContacts(t *testing.T) {
+	h := bridgetest.New(t)
+	jid := types.NewJID("5215512345678", types.DefaultUserServer)
+
+	// An iOS card: grouped properties, escapes and a folded line.
+	ana := "BEGIN:VCARD\r\nVERSION:3.0\r\nN:Pérez;Ana;;;\r\nFN:Ana Pérez\r\nORG:Tacos\\, S.A.;\r\n" +
+		"item1.TEL;type=CELL;waid=5215587654321:+52 1 55 8765 4321\r\nitem2.EMAIL;type=INTERNET:ana@ta\r\n cos.example\r\nEND:VCARD"
+	h.Receive(jid, jid, &waE2E.Message{ContactsArrayMessage: &waE2E.ContactsArrayMessage{
+		Contacts: []*waE2E.ContactMessage{
+			{DisplayName: proto.String("Ana"), Vcard: proto.String(ana)},
+			{DisplayName: proto.String("Luis"), Vcard: proto.String("BEGIN:VCARD\nVERSION:3.0\nTEL:+52 55 1111 2222\nEND:VCARD")},
+		},
+	}})
+	msg := h.ExpectMessage()
+	if msg.Type != "contacts" || len(msg.Contacts) != 2 || msg.Content != "Ana Pérez, Luis" {
+		t.Fatalf("contacts published as %s %q with %d card(s)", msg.Type, msg.Content, len(msg.Contacts))
+	}
+	card := msg.Contacts[0]
+	if card.Org != "Tacos, S.A." || !slices.Equal(card.Emails, []string{"ana@tacos.example"}) || card.VCard != ana {
+		t.Errorf("card = %+v", card)
+	}
+	if len(card.Phones) != 1 || card.Phones[0].WAID != "5215587654321" || card.Phones[0].Number != "+52 1 55 8765 4321" ||
+		!slices.Equal(card.Phones[0].Types, []string{"CELL"}) {
+		t.Errorf("phones = %+v", card.Phones)
+	}
+	if luis := msg.Contacts[1]; luis.Name != "Luis" || len(luis.Phones) != 1 || luis.Phones[0].WAID != "" {
+		t.Errorf("card without FN = %+v", luis)
+	}
+}
@@ -0,0 +1,197 @@
+package bridge
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os/exec"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// voiceMimetype is what WhatsApp clients expect for push-to-talk bubbles.
+	voiceMimetype = "audio/ogg; codecs=opus"
+	// waveformSamples is the number of amplitude bars rendered in the bubble.
+	waveformSamples = 64
+	// pcmSampleRate is the rate used when decoding audio for duration/waveform.
+	pcmSampleRate = 8000
+)
+
+// VoiceMessage is the payload accepted by the /send/voice endpoint.
+// Exactly one of AudioURL or Audio (base64) must be set; any format ffmpeg
+// understands (mp3, wav, m4a, ogg) is converted to ogg/opus.
+type VoiceMessage struct {
+	Phone    string `json:"phone"`
+	Server   string `json:"server,omitempty"`
+	ChatType string `json:"chat_type,omitempty"`
+	AudioURL string `json:"audio_url,omitempty"`
+	Audio    string `json:"audio,omitempty"`
+}
+
+func (b *WhatsAppBridge) handleSendVoice(w http.ResponseWriter, r *http.Request) {
+	var msg VoiceMessage
+	if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+		writeJSON(w, http.StatusBadRequest, Response{Success: false, Error: err.Error()})
+		return
+	}
+
+	if msg.Phone == "" || (msg.AudioURL == "" && msg.Audio == "") {
+		writeJSON(w, http.StatusBadRequest, Response{Success: false, Error: "phone and audio_url or audio are required"})
+		return
+	}
+	jid, err := resolveRecipient(msg.Phone, msg.Server, msg.ChatType)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, Response{Success: false, Error: err.Error()})
+		return
+	}
+	sendCtx, jid, err := b.checkSend(context.WithoutCancel(r.Context()), jid, OutgoingMessage{})
+	if err != nil {
+		b.writeSendError(w, err, SendResult{})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Minute)
+	defer cancel()
+
+	input, _, err := loadOutgoingMedia(ctx, msg.AudioURL, msg.Audio)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, Response{Success: false, Error: err.Error()})
+		return
+	}
+
+	audioMsg, err := b.buildVoiceNote(ctx, input)
+	if err != nil {
+		log.Printf("Error preparing voice note: %v", err)
+		b.reporter.Capture(err, "voice_conversion", map[string]string{"message_type": "voice"})
+		writeJSON(w, http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+
+	log.Printf("Sending voice note to %s (%ds)", jid.User, audioMsg.GetSeconds())
+
+	resp, err := b.deliver(sendCtx, jid, &waE2E.Message{AudioMessage: audioMsg}, 0)
+	if err != nil {
+		log.Printf("Error sending voice note to %s: %v", jid.User, err)
+		b.reportSendFailure(err, jid, "voice")
+		b.writeSendError(w, err, SendResult{})
+		return
+	}
+
+	log.Printf("Voice note sent to %s, ID: %s", jid.User, resp.ID)
+	b.archiveOutgoing(r.Context(), jid.String(), resp.ID, "voice", "", resp.Timestamp)
+	data := b.timestampFields(resp.Timestamp)
+	data["message_id"] = resp.ID
+	data["seconds"] = audioMsg.GetSeconds()
+	writeJSON(w, http.StatusOK, Response{Success: true, Data: data})
+}
+
+// buildVoiceNote converts arbitrary audio to ogg/opus, uploads it and returns
+// an AudioMessage flagged as PTT with duration and waveform populated.
+func (b *WhatsAppBridge) buildVoiceNote(ctx context.Context, input []byte) (*waE2E.AudioMessage, error) {
+	ogg, err := runFFmpeg(ctx, input,
+		"-vn", "-ac", "1", "-ar", "48000",
+		"-c:a", "libopus", "-b:a", "32k", "-application", "voip",
+		"-f", "ogg")
+	if err != nil {
+		return nil, fmt.Errorf("opus conversion failed: %v", err)
+	}
+
+	pcm, err := runFFmpeg(ctx, input, "-vn", "-ac", "1", "-ar", fmt.Sprint(pcmSampleRate), "-f", "s16le")
+	if err != nil {
+		return nil, fmt.Errorf("audio analysis failed: %v", err)
+	}
+	seconds, waveform := analyzePCM(pcm)
+
+	uploaded, err := b.client.Upload(ctx, ogg, whatsmeow.MediaAudio)
+	if err != nil {
+		return nil, fmt.Errorf("upload failed: %v", err)
+	}
+	b.recordUsage(ctx, operatorFromContext(ctx), UsageMediaBytes, int64(len(ogg)))
+
+	return &waE2E.AudioMessage{
+		URL:               proto.String(uploaded.URL),
+		DirectPath:        proto.String(uploaded.DirectPath),
+		MediaKey:          uploaded.MediaKey,
+		Mimetype:          proto.String(voiceMimetype),
+		FileEncSHA256:     uploaded.FileEncSHA256,
+		FileSHA256:        uploaded.FileSHA256,
+		FileLength:        proto.Uint64(uploaded.FileLength),
+		Seconds:           proto.Uint32(seconds),
+		PTT:               proto.Bool(true),
+		Waveform:          waveform,
+		MediaKeyTimestamp: proto.Int64(time.Now().Unix()),
+	}, nil
+}
+
+// runFFmpeg pipes input through ffmpeg with the given output arguments and
+// returns stdout. The binary can be overridden with FFMPEG_PATH.
+func runFFmpeg(ctx context.Context, input []byte, outputArgs ...string) ([]byte, error) {
+	args := append([]string{"-hide_banner", "-loglevel", "error", "-i", "pipe:0"}, outputArgs...)
+	args = append(args, "pipe:1")
+
+	cmd := exec.CommandContext(ctx, envString("FFMPEG_PATH", "ffmpeg"), args...)
+	cmd.Stdin = bytes.NewReader(input)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%v: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return stdout.Bytes(), nil
+}
+
+// analyzePCM computes the duration in seconds and a 64-bar waveform (values
+// 0-100) from mono 16-bit little-endian PCM sampled at pcmSampleRate.
+func analyzePCM(pcm []byte) (uint32, []byte) {
+	samples := len(pcm) / 2
+	seconds := uint32(math.Ceil(float64(samples) / pcmSampleRate))
+
+	waveform := make([]byte, waveformSamples)
+	if samples == 0 {
+		return seconds, waveform
+	}
+
+	bucketSize := samples / waveformSamples
+	if bucketSize == 0 {
+		bucketSize = 1
+	}
+
+	levels := make([]float64, waveformSamples)
+	peak := 0.0
+	for i := 0; i < waveformSamples; i++ {
+		start := i * bucketSize
+		if start >= samples {
+			break
+		}
+		end := start + bucketSize
+		if end > samples {
+			end = samples
+		}
+		sum := 0.0
+		for j := start; j < end; j++ {
+			v := int16(binary.LittleEndian.Uint16(pcm[j*2:]))
+			sum += math.Abs(float64(v))
+		}
+		levels[i] = sum / float64(end-start)
+		if levels[i] > peak {
+			peak = levels[i]
+		}
+	}
+
+	if peak > 0 {
+		for i, level := range levels {
+			waveform[i] = byte(math.Round(level / peak * 100))
+		}
+	}
+	return seconds, waveform
+}
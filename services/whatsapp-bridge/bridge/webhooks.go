@@ -0,0 +1,279 @@
+package bridge
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/gorilla/mux"
+)
+
+// Webhook delivery for consumers that cannot reach Redis: every URL in
+// WEBHOOK_URLS gets the inbound messages POSTed, signed when WEBHOOK_SECRET
+// is set and retried with exponential backoff. Events that still fail land
+// in a failure queue, from where they can be inspected and redelivered.
+//
+//	WEBHOOK_URLS              - comma-separated endpoints
+//	WEBHOOK_SECRET            - HMAC key of the X-Signature header (also the default of webhook sinks in SINKS)
+//	WEBHOOK_EVENTS            - event types to POST (default message)
+//	WEBHOOK_MAX_RETRIES       - retries before an event goes to the failure queue (default 8)
+//	WEBHOOK_FAILURE_STREAM    - Redis stream of failed deliveries (default whatsapp:webhook_failures)
+//	WEBHOOK_FAILURE_MAX_LEN   - approximate cap of that stream (default 10000)
+
+// webhookConfigsFromEnv returns one at-least-once webhook sink per
+// WEBHOOK_URLS entry.
+func webhookConfigsFromEnv() []SinkConfig {
+	events := envList("WEBHOOK_EVENTS")
+	if len(events) == 0 {
+		events = []string{EventMessage}
+	}
+	var configs []SinkConfig
+	for i, url := range envList("WEBHOOK_URLS") {
+		configs = append(configs, SinkConfig{
+			Name:       fmt.Sprintf("webhook-%d", i+1),
+			Type:       "webhook",
+			URL:        url,
+			Events:     events,
+			Delivery:   DeliveryAtLeastOnce,
+			MaxRetries: envInt("WEBHOOK_MAX_RETRIES", 8),
+		})
+	}
+	return configs
+}
+
+// webhookSignature is the hex HMAC-SHA256 of "<timestamp>.<body>".
+func webhookSignature(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte{'.'})
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookFailures is the failure queue: a Redis stream whose entries hold
+// the sink, event type, chat, route, the payload as it was POSTed, the last
+// error, the number of attempts and when delivery was given up.
+type webhookFailures struct {
+	redis  *redis.Client
+	stream string
+	maxLen int64
+}
+
+func (b *WhatsAppBridge) webhookFailures() *webhookFailures {
+	if b.redisClient == nil {
+		return nil
+	}
+	return &webhookFailures{
+		redis:  b.redisClient,
+		stream: envString("WEBHOOK_FAILURE_STREAM", "whatsapp:webhook_failures"),
+		maxLen: int64(envInt("WEBHOOK_FAILURE_MAX_LEN", 10000)),
+	}
+}
+
+// WebhookFailure is an entry of the failure queue.
+type WebhookFailure struct {
+	ID       string          `json:"id"`
+	Sink     string          `json:"sink"`
+	Type     string          `json:"type"`
+	Chat     string          `json:"chat,omitempty"`
+	Route    string          `json:"route,omitempty"`
+	Payload  json.RawMessage `json:"payload"`
+	Error    string          `json:"error"`
+	Attempts int             `json:"attempts"`
+	FailedAt int64           `json:"failed_at"`
+}
+
+// Add queues an event a sink gave up on.
+func (q *webhookFailures) Add(sink string, evt BridgeEvent, attempts int, cause error) {
+	if q == nil {
+		return
+	}
+	payload, err := evt.MarshalPayload()
+	if err != nil {
+		return
+	}
+	err = q.redis.XAdd(context.Background(), &redis.XAddArgs{
+		Stream: q.stream,
+		MaxLen: q.maxLen,
+		Approx: true,
+		Values: map[string]interface{}{
+			"sink":      sink,
+			"type":      evt.Type,
+			"chat":      evt.Chat,
+			"route":     evt.Route,
+			"payload":   payload,
+			"error":     cause.Error(),
+			"attempts":  attempts,
+			"failed_at": time.Now().Unix(),
+		},
+	}).Err()
+	if err != nil {
+		log.Printf("Error queueing failed %s event of sink %s: %v", evt.Type, sink, err)
+	}
+}
+
+func webhookFailureFromEntry(msg redis.XMessage) WebhookFailure {
+	field := func(key string) string {
+		s, _ := msg.Values[key].(string)
+		return s
+	}
+	failure := WebhookFailure{
+		ID:      msg.ID,
+		Sink:    field("sink"),
+		Type:    field("type"),
+		Chat:    field("chat"),
+		Route:   field("route"),
+		Payload: json.RawMessage(field("payload")),
+		Error:   field("error"),
+	}
+	failure.Attempts, _ = strconv.Atoi(field("attempts"))
+	failure.FailedAt, _ = strconv.ParseInt(field("failed_at"), 10, 64)
+	if !json.Valid(failure.Payload) {
+		failure.Payload = json.RawMessage("null")
+	}
+	return failure
+}
+
+// List returns up to limit failures after the one with ID after (from the
+// start when empty), oldest first, optionally of one sink. The stream is
+// read a page at a time, so a long queue is never loaded whole.
+func (q *webhookFailures) List(ctx context.Context, sink, after string, limit int) ([]WebhookFailure, error) {
+	start := "-"
+	if after != "" {
+		start = "(" + after
+	}
+	failures := []WebhookFailure{}
+	for len(failures) < limit {
+		entries, err := q.redis.XRangeN(ctx, q.stream, start, "+", int64(max(limit, 100))).Result()
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			failure := webhookFailureFromEntry(entry)
+			if sink != "" && failure.Sink != sink {
+				continue
+			}
+			if failures = append(failures, failure); len(failures) >= limit {
+				break
+			}
+		}
+		if len(entries) < max(limit, 100) {
+			break
+		}
+		start = "(" + entries[len(entries)-1].ID
+	}
+	return failures, nil
+}
+
+// Get returns the failure with the given stream ID.
+func (q *webhookFailures) Get(ctx context.Context, id string) (*WebhookFailure, error) {
+	entries, err := q.redis.XRange(ctx, q.stream, id, id).Result()
+	if err != nil || len(entries) == 0 {
+		return nil, fmt.Errorf("no failed delivery %s", id)
+	}
+	failure := webhookFailureFromEntry(entries[0])
+	return &failure, nil
+}
+
+// Delete drops a failure, reporting whether it existed.
+func (q *webhookFailures) Delete(ctx context.Context, id string) (bool, error) {
+	n, err := q.redis.XDel(ctx, q.stream, id).Result()
+	return n > 0, err
+}
+
+// sink returns the sink registered under name.
+func (f *FanOut) sink(name string) MessageSink {
+	if f == nil {
+		return nil
+	}
+	for _, r := range f.runners {
+		if r.cfg.Name == name {
+			return r.sink
+		}
+	}
+	return nil
+}
+
+// handleListWebhookFailures serves GET /admin/webhooks/failures?sink=&limit=&after=;
+// the next page is after the ID of the last failure returned.
+func (b *WhatsAppBridge) handleListWebhookFailures(w http.ResponseWriter, r *http.Request) {
+	q := b.sinks.failuresQueue()
+	if q == nil {
+		writeJSON(w, http.StatusNotFound, Response{Success: false, Error: "webhook failure queue is disabled"})
+		return
+	}
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+	failures, err := q.List(r.Context(), r.URL.Query().Get("sink"), r.URL.Query().Get("after"), limit)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, Response{Success: true, Data: failures})
+}
+
+// handleRetryWebhookFailure serves POST /admin/webhooks/failures/{id}/retry:
+// it POSTs the payload to its sink again, as originally sent, and drops the
+// entry when that succeeds.
+func (b *WhatsAppBridge) handleRetryWebhookFailure(w http.ResponseWriter, r *http.Request) {
+	q := b.sinks.failuresQueue()
+	if q == nil {
+		writeJSON(w, http.StatusNotFound, Response{Success: false, Error: "webhook failure queue is disabled"})
+		return
+	}
+	id := mux.Vars(r)["id"]
+	failure, err := q.Get(r.Context(), id)
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, Response{Success: false, Error: err.Error()})
+		return
+	}
+	sink := b.sinks.sink(failure.Sink)
+	if sink == nil {
+		writeJSON(w, http.StatusConflict, Response{Success: false, Error: "sink " + failure.Sink + " is no longer configured"})
+		return
+	}
+	evt := BridgeEvent{Type: failure.Type, Chat: failure.Chat, Route: failure.Route, Payload: failure.Payload}
+	if err := sink.Deliver(r.Context(), evt); err != nil {
+		writeJSON(w, http.StatusBadGateway, Response{Success: false, Error: err.Error()})
+		return
+	}
+	q.Delete(r.Context(), id)
+	writeJSON(w, http.StatusOK, Response{Success: true, Data: map[string]string{"id": id, "sink": failure.Sink}})
+}
+
+// handleDeleteWebhookFailure serves DELETE /admin/webhooks/failures/{id}.
+func (b *WhatsAppBridge) handleDeleteWebhookFailure(w http.ResponseWriter, r *http.Request) {
+	q := b.sinks.failuresQueue()
+	if q == nil {
+		writeJSON(w, http.StatusNotFound, Response{Success: false, Error: "webhook failure queue is disabled"})
+		return
+	}
+	id := mux.Vars(r)["id"]
+	found, err := q.Delete(r.Context(), id)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, Response{Success: false, Error: err.Error()})
+		return
+	}
+	if !found {
+		writeJSON(w, http.StatusNotFound, Response{Success: false, Error: "no failed delivery " + id})
+		return
+	}
+	writeJSON(w, http.StatusOK, Response{Success: true})
+}
+
+func (f *FanOut) failuresQueue() *webhookFailures {
+	if f == nil {
+		return nil
+	}
+	return f.failures
+}
@@ -0,0 +1,55 @@
+package bridge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+func TestWebhookFailuresListPages(t *testing.T) {
+	mr := miniredis.RunT(t)
+	redisClient := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer redisClient.Close()
+	q := &webhookFailures{redis: redisClient, stream: "whatsapp:webhook_failures", maxLen: 10000}
+
+	// 250 failures, every fifth of sink b: more than a page of the stream.
+	for i := range 250 {
+		sink := "a"
+		if i%5 == 0 {
+			sink = "b"
+		}
+		q.Add(sink, BridgeEvent{Type: EventMessage, Payload: map[string]int{"n": i}}, 3, errors.New("timeout"))
+	}
+
+	ctx := context.Background()
+	var seen []string
+	after := ""
+	for {
+		page, err := q.List(ctx, "b", after, 20)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, failure := range page {
+			if failure.Sink != "b" {
+				t.Fatalf("listed a failure of sink %s", failure.Sink)
+			}
+			seen = append(seen, string(failure.Payload))
+		}
+		if len(page) < 20 {
+			break
+		}
+		after = page[len(page)-1].ID
+	}
+	if len(seen) != 50 {
+		t.Fatalf("listed %d failures of sink b, want 50", len(seen))
+	}
+	for i, payload := range seen {
+		if want := fmt.Sprintf(`{"n":%d}`, i*5); payload != want {
+			t.Fatalf("failure %d has payload %s, want %s", i, payload, want)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package bridge
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// /ws carries the pairing feed to every client. A client can also subscribe
+// to the published events (messages, receipts, presence, group updates...)
+// by sending
+//
+//	{"action": "subscribe", "token": "<API key or JWT>",
+//	 "types": ["message"], "categories": ["receipts"], "chats": ["*@g.us"]}
+//
+// types and categories (the PUBLISH_EVENTS names) select events, all of them
+// when both are empty; chats are patterns as in sink filters. The token may
+// instead be given at connect time as ?access_token= or in the usual auth
+// headers; it is only needed when API auth is enabled, since /ws itself is
+// public for the QR page. Subscribing again replaces the filters and
+// {"action": "unsubscribe"} stops the events. Events arrive as WSEventFrame;
+// WS_EVENT_BUFFER (default 256) is how many a slow client may fall behind
+// before events are dropped for it.
+
+// WSEventFrame is an event as sent to subscribed /ws clients.
+type WSEventFrame struct {
+	Type    string          `json:"type"` // "event"
+	Event   string          `json:"event"`
+	Chat    string          `json:"chat,omitempty"`
+	Route   string          `json:"route,omitempty"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// wsControl is a message from a /ws client.
+type wsControl struct {
+	Action     string   `json:"action"`
+	Token      string   `json:"token,omitempty"`
+	Types      []string `json:"types,omitempty"`
+	Categories []string `json:"categories,omitempty"`
+	Chats      []string `json:"chats,omitempty"`
+}
+
+// wsReply acknowledges or rejects a control message.
+type wsReply struct {
+	Type       string   `json:"type"` // "subscribed", "unsubscribed" or "error"
+	Detail     string   `json:"detail,omitempty"`
+	Types      []string `json:"types,omitempty"`
+	Categories []string `json:"categories,omitempty"`
+	Chats      []string `json:"chats,omitempty"`
+}
+
+// wsClient is one /ws connection. Writes go through write, so pairing
+// broadcasts and the event writer never interleave.
+type wsClient struct {
+	conn    *websocket.Conn
+	writeMu sync.Mutex
+
+	// Set at connect time from the request, when it carried credentials.
+	operator string
+
+	// Guarded by the bridge's wsMu.
+	subscribed bool
+	types      []string
+	categories []string
+	chats      []string
+
+	events chan BridgeEvent
+	done   chan struct{}
+}
+
+func (c *wsClient) write(v any) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return c.writeLocked(v)
+}
+
+// writeLocked writes v; callers hold writeMu.
+func (c *wsClient) writeLocked(v any) error {
+	c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	return c.conn.WriteJSON(v)
+}
+
+func (c *wsClient) accepts(evt BridgeEvent) bool {
+	if !c.subscribed {
+		return false
+	}
+	if len(c.types) > 0 || len(c.categories) > 0 {
+		if !containsString(c.types, evt.Type) && !containsString(c.categories, eventCategories[evt.Type]) {
+			return false
+		}
+	}
+	return len(c.chats) == 0 || matchesAny(c.chats, evt.Chat)
+}
+
+// wsEventSink feeds published events to the subscribed /ws clients.
+type wsEventSink struct{ bridge *WhatsAppBridge }
+
+func (s wsEventSink) Name() string { return "ws" }
+
+// Deliver queues evt for every matching client without blocking.
+func (s wsEventSink) Deliver(ctx context.Context, evt BridgeEvent) error {
+	b := s.bridge
+	b.wsMu.Lock()
+	defer b.wsMu.Unlock()
+	for c := range b.wsClients {
+		if !c.accepts(evt) {
+			continue
+		}
+		select {
+		case c.events <- evt:
+		default:
+			log.Printf("⚠️ WebSocket event stream is behind, dropping %s event", evt.Type)
+		}
+	}
+	return nil
+}
+
+// writeWSEvents sends a client its queued events until it disconnects.
+func (b *WhatsAppBridge) writeWSEvents(c *wsClient) {
+	for {
+		select {
+		case <-c.done:
+			return
+		case evt := <-c.events:
+			payload, err := evt.MarshalPayload()
+			if err != nil {
+				log.Printf("Error encoding %s event for WebSocket: %v", evt.Type, err)
+				continue
+			}
+			frame := WSEventFrame{Type: "event", Event: evt.Type, Chat: evt.Chat, Route: evt.Route, Payload: payload}
+			if err := c.write(frame); err != nil {
+				c.conn.Close() // the read loop notices and cleans up
+				return
+			}
+		}
+	}
+}
+
+// handleWSControl applies a control message from a client.
+func (b *WhatsAppBridge) handleWSControl(c *wsClient, data []byte) {
+	var ctl wsControl
+	if err := json.Unmarshal(data, &ctl); err != nil {
+		c.write(wsReply{Type: "error", Detail: "invalid message"})
+		return
+	}
+	switch ctl.Action {
+	case "subscribe":
+		if err := b.authorizeWSClient(c, ctl.Token); err != nil {
+			c.write(wsReply{Type: "error", Detail: err.Error()})
+			return
+		}
+		for _, category := range ctl.Categories {
+			if !containsString(eventCategoryNames, category) {
+				c.write(wsReply{Type: "error", Detail: fmt.Sprintf("unknown category %q (known: %s)",
+					category, strings.Join(eventCategoryNames, ", "))})
+				return
+			}
+		}
+		b.wsMu.Lock()
+		c.subscribed, c.types, c.categories, c.chats = true, ctl.Types, ctl.Categories, ctl.Chats
+		b.wsMu.Unlock()
+		log.Printf("🔭 WebSocket client %s subscribed to events", c.operator)
+		c.write(wsReply{Type: "subscribed", Types: ctl.Types, Categories: ctl.Categories, Chats: ctl.Chats})
+	case "unsubscribe":
+		b.wsMu.Lock()
+		c.subscribed = false
+		b.wsMu.Unlock()
+		c.write(wsReply{Type: "unsubscribed"})
+	default:
+		c.write(wsReply{Type: "error", Detail: fmt.Sprintf("unknown action %q", ctl.Action)})
+	}
+}
+
+// authorizeWSClient resolves the client's operator from token, unless it
+// authenticated when connecting.
+func (b *WhatsAppBridge) authorizeWSClient(c *wsClient, token string) error {
+	if !b.auth.Enabled() {
+		c.operator = anonymousOperator
+		return nil
+	}
+	if token == "" {
+		if c.operator != "" {
+			return nil
+		}
+		return fmt.Errorf("authentication required to subscribe to events")
+	}
+	operator, err := b.auth.authenticateCredentials(token, "")
+	if err != nil {
+		return err
+	}
+	c.operator = operator
+	return nil
+}
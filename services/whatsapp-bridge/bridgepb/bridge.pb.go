@@ -0,0 +1,786 @@
+// gRPC API of the WhatsApp bridge, for agent backends that prefer typed,
+// streaming RPC over HTTP and Redis. Served on GRPC_ADDR; authenticated like
+// the HTTP API, with an "authorization: Bearer <key or JWT>" or "x-api-key"
+// metadata entry.
+//
+// Regenerate the Go code after editing (see bridgepb/generate.go).
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        v5.29.3
+// source: bridge.proto
+
+package bridgepb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	structpb "google.golang.org/protobuf/types/known/structpb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type EventsRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Event types to receive (e.g. "message", "message_status"); empty for all.
+	Types []string `protobuf:"bytes,1,rep,name=types,proto3" json:"types,omitempty"`
+	// Chat JID glob patterns (e.g. "*@g.us"); empty for all chats.
+	Chats         []string `protobuf:"bytes,2,rep,name=chats,proto3" json:"chats,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *EventsRequest) Reset() {
+	*x = EventsRequest{}
+	mi := &file_bridge_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *EventsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*EventsRequest) ProtoMessage() {}
+
+func (x *EventsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_bridge_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use EventsRequest.ProtoReflect.Descriptor instead.
+func (*EventsRequest) Descriptor() ([]byte, []int) {
+	return file_bridge_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *EventsRequest) GetTypes() []string {
+	if x != nil {
+		return x.Types
+	}
+	return nil
+}
+
+func (x *EventsRequest) GetChats() []string {
+	if x != nil {
+		return x.Chats
+	}
+	return nil
+}
+
+type Event struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Type  string                 `protobuf:"bytes,1,opt,name=type,proto3" json:"type,omitempty"`
+	Chat  string                 `protobuf:"bytes,2,opt,name=chat,proto3" json:"chat,omitempty"`
+	// Routing rule that matched, for routed messages.
+	Route string `protobuf:"bytes,3,opt,name=route,proto3" json:"route,omitempty"`
+	// The payload exactly as the sinks publish it, as JSON.
+	PayloadJson string `protobuf:"bytes,4,opt,name=payload_json,json=payloadJson,proto3" json:"payload_json,omitempty"`
+	// The inbound message, for "message" events.
+	Message       *IncomingMessage `protobuf:"bytes,5,opt,name=message,proto3" json:"message,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Event) Reset() {
+	*x = Event{}
+	mi := &file_bridge_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Event) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Event) ProtoMessage() {}
+
+func (x *Event) ProtoReflect() protoreflect.Message {
+	mi := &file_bridge_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Event.ProtoReflect.Descriptor instead.
+func (*Event) Descriptor() ([]byte, []int) {
+	return file_bridge_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Event) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *Event) GetChat() string {
+	if x != nil {
+		return x.Chat
+	}
+	return ""
+}
+
+func (x *Event) GetRoute() string {
+	if x != nil {
+		return x.Route
+	}
+	return ""
+}
+
+func (x *Event) GetPayloadJson() string {
+	if x != nil {
+		return x.PayloadJson
+	}
+	return ""
+}
+
+func (x *Event) GetMessage() *IncomingMessage {
+	if x != nil {
+		return x.Message
+	}
+	return nil
+}
+
+type IncomingMessage struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	From          string                 `protobuf:"bytes,1,opt,name=from,proto3" json:"from,omitempty"`
+	FromServer    string                 `protobuf:"bytes,2,opt,name=from_server,json=fromServer,proto3" json:"from_server,omitempty"`
+	FromName      string                 `protobuf:"bytes,3,opt,name=from_name,json=fromName,proto3" json:"from_name,omitempty"`
+	Content       string                 `protobuf:"bytes,4,opt,name=content,proto3" json:"content,omitempty"`
+	Type          string                 `protobuf:"bytes,5,opt,name=type,proto3" json:"type,omitempty"`
+	Media         string                 `protobuf:"bytes,6,opt,name=media,proto3" json:"media,omitempty"`
+	Timestamp     int64                  `protobuf:"varint,7,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	TimestampIso  string                 `protobuf:"bytes,8,opt,name=timestamp_iso,json=timestampIso,proto3" json:"timestamp_iso,omitempty"`
+	Timezone      string                 `protobuf:"bytes,9,opt,name=timezone,proto3" json:"timezone,omitempty"`
+	MessageId     string                 `protobuf:"bytes,10,opt,name=message_id,json=messageId,proto3" json:"message_id,omitempty"`
+	IsGroup       bool                   `protobuf:"varint,11,opt,name=is_group,json=isGroup,proto3" json:"is_group,omitempty"`
+	GroupName     string                 `protobuf:"bytes,12,opt,name=group_name,json=groupName,proto3" json:"group_name,omitempty"`
+	ContentHash   string                 `protobuf:"bytes,13,opt,name=content_hash,json=contentHash,proto3" json:"content_hash,omitempty"`
+	ContactId     string                 `protobuf:"bytes,14,opt,name=contact_id,json=contactId,proto3" json:"contact_id,omitempty"`
+	Route         string                 `protobuf:"bytes,15,opt,name=route,proto3" json:"route,omitempty"`
+	Consent       string                 `protobuf:"bytes,16,opt,name=consent,proto3" json:"consent,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *IncomingMessage) Reset() {
+	*x = IncomingMessage{}
+	mi := &file_bridge_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *IncomingMessage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*IncomingMessage) ProtoMessage() {}
+
+func (x *IncomingMessage) ProtoReflect() protoreflect.Message {
+	mi := &file_bridge_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use IncomingMessage.ProtoReflect.Descriptor instead.
+func (*IncomingMessage) Descriptor() ([]byte, []int) {
+	return file_bridge_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *IncomingMessage) GetFrom() string {
+	if x != nil {
+		return x.From
+	}
+	return ""
+}
+
+func (x *IncomingMessage) GetFromServer() string {
+	if x != nil {
+		return x.FromServer
+	}
+	return ""
+}
+
+func (x *IncomingMessage) GetFromName() string {
+	if x != nil {
+		return x.FromName
+	}
+	return ""
+}
+
+func (x *IncomingMessage) GetContent() string {
+	if x != nil {
+		return x.Content
+	}
+	return ""
+}
+
+func (x *IncomingMessage) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *IncomingMessage) GetMedia() string {
+	if x != nil {
+		return x.Media
+	}
+	return ""
+}
+
+func (x *IncomingMessage) GetTimestamp() int64 {
+	if x != nil {
+		return x.Timestamp
+	}
+	return 0
+}
+
+func (x *IncomingMessage) GetTimestampIso() string {
+	if x != nil {
+		return x.TimestampIso
+	}
+	return ""
+}
+
+func (x *IncomingMessage) GetTimezone() string {
+	if x != nil {
+		return x.Timezone
+	}
+	return ""
+}
+
+func (x *IncomingMessage) GetMessageId() string {
+	if x != nil {
+		return x.MessageId
+	}
+	return ""
+}
+
+func (x *IncomingMessage) GetIsGroup() bool {
+	if x != nil {
+		return x.IsGroup
+	}
+	return false
+}
+
+func (x *IncomingMessage) GetGroupName() string {
+	if x != nil {
+		return x.GroupName
+	}
+	return ""
+}
+
+func (x *IncomingMessage) GetContentHash() string {
+	if x != nil {
+		return x.ContentHash
+	}
+	return ""
+}
+
+func (x *IncomingMessage) GetContactId() string {
+	if x != nil {
+		return x.ContactId
+	}
+	return ""
+}
+
+func (x *IncomingMessage) GetRoute() string {
+	if x != nil {
+		return x.Route
+	}
+	return ""
+}
+
+func (x *IncomingMessage) GetConsent() string {
+	if x != nil {
+		return x.Consent
+	}
+	return ""
+}
+
+type Suggestion struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Title         string                 `protobuf:"bytes,2,opt,name=title,proto3" json:"title,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Suggestion) Reset() {
+	*x = Suggestion{}
+	mi := &file_bridge_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Suggestion) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Suggestion) ProtoMessage() {}
+
+func (x *Suggestion) ProtoReflect() protoreflect.Message {
+	mi := &file_bridge_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Suggestion.ProtoReflect.Descriptor instead.
+func (*Suggestion) Descriptor() ([]byte, []int) {
+	return file_bridge_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *Suggestion) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Suggestion) GetTitle() string {
+	if x != nil {
+		return x.Title
+	}
+	return ""
+}
+
+// OutgoingMessage mirrors the JSON body of POST /send.
+type OutgoingMessage struct {
+	state              protoimpl.MessageState `protogen:"open.v1"`
+	Phone              string                 `protobuf:"bytes,1,opt,name=phone,proto3" json:"phone,omitempty"`
+	Server             string                 `protobuf:"bytes,2,opt,name=server,proto3" json:"server,omitempty"`
+	Message            string                 `protobuf:"bytes,3,opt,name=message,proto3" json:"message,omitempty"`
+	MediaUrl           string                 `protobuf:"bytes,4,opt,name=media_url,json=mediaUrl,proto3" json:"media_url,omitempty"`
+	ChatType           string                 `protobuf:"bytes,5,opt,name=chat_type,json=chatType,proto3" json:"chat_type,omitempty"`
+	ReplyToMessageId   string                 `protobuf:"bytes,6,opt,name=reply_to_message_id,json=replyToMessageId,proto3" json:"reply_to_message_id,omitempty"`
+	ReplyToParticipant string                 `protobuf:"bytes,7,opt,name=reply_to_participant,json=replyToParticipant,proto3" json:"reply_to_participant,omitempty"`
+	ReplyToText        string                 `protobuf:"bytes,8,opt,name=reply_to_text,json=replyToText,proto3" json:"reply_to_text,omitempty"`
+	Mentions           []string               `protobuf:"bytes,9,rep,name=mentions,proto3" json:"mentions,omitempty"`
+	Suggestions        []*Suggestion          `protobuf:"bytes,10,rep,name=suggestions,proto3" json:"suggestions,omitempty"`
+	ViewOnce           bool                   `protobuf:"varint,11,opt,name=view_once,json=viewOnce,proto3" json:"view_once,omitempty"`
+	EphemeralTtl       int32                  `protobuf:"varint,12,opt,name=ephemeral_ttl,json=ephemeralTtl,proto3" json:"ephemeral_ttl,omitempty"`
+	Raw                bool                   `protobuf:"varint,13,opt,name=raw,proto3" json:"raw,omitempty"`
+	ConsentOverride    bool                   `protobuf:"varint,14,opt,name=consent_override,json=consentOverride,proto3" json:"consent_override,omitempty"`
+	// Idempotency key: a repeated ID returns the original result instead of
+	// sending again.
+	ClientMessageId string           `protobuf:"bytes,15,opt,name=client_message_id,json=clientMessageId,proto3" json:"client_message_id,omitempty"`
+	Language        string           `protobuf:"bytes,16,opt,name=language,proto3" json:"language,omitempty"`
+	Template        string           `protobuf:"bytes,17,opt,name=template,proto3" json:"template,omitempty"`
+	Params          *structpb.Struct `protobuf:"bytes,18,opt,name=params,proto3" json:"params,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *OutgoingMessage) Reset() {
+	*x = OutgoingMessage{}
+	mi := &file_bridge_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *OutgoingMessage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*OutgoingMessage) ProtoMessage() {}
+
+func (x *OutgoingMessage) ProtoReflect() protoreflect.Message {
+	mi := &file_bridge_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use OutgoingMessage.ProtoReflect.Descriptor instead.
+func (*OutgoingMessage) Descriptor() ([]byte, []int) {
+	return file_bridge_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *OutgoingMessage) GetPhone() string {
+	if x != nil {
+		return x.Phone
+	}
+	return ""
+}
+
+func (x *OutgoingMessage) GetServer() string {
+	if x != nil {
+		return x.Server
+	}
+	return ""
+}
+
+func (x *OutgoingMessage) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *OutgoingMessage) GetMediaUrl() string {
+	if x != nil {
+		return x.MediaUrl
+	}
+	return ""
+}
+
+func (x *OutgoingMessage) GetChatType() string {
+	if x != nil {
+		return x.ChatType
+	}
+	return ""
+}
+
+func (x *OutgoingMessage) GetReplyToMessageId() string {
+	if x != nil {
+		return x.ReplyToMessageId
+	}
+	return ""
+}
+
+func (x *OutgoingMessage) GetReplyToParticipant() string {
+	if x != nil {
+		return x.ReplyToParticipant
+	}
+	return ""
+}
+
+func (x *OutgoingMessage) GetReplyToText() string {
+	if x != nil {
+		return x.ReplyToText
+	}
+	return ""
+}
+
+func (x *OutgoingMessage) GetMentions() []string {
+	if x != nil {
+		return x.Mentions
+	}
+	return nil
+}
+
+func (x *OutgoingMessage) GetSuggestions() []*Suggestion {
+	if x != nil {
+		return x.Suggestions
+	}
+	return nil
+}
+
+func (x *OutgoingMessage) GetViewOnce() bool {
+	if x != nil {
+		return x.ViewOnce
+	}
+	return false
+}
+
+func (x *OutgoingMessage) GetEphemeralTtl() int32 {
+	if x != nil {
+		return x.EphemeralTtl
+	}
+	return 0
+}
+
+func (x *OutgoingMessage) GetRaw() bool {
+	if x != nil {
+		return x.Raw
+	}
+	return false
+}
+
+func (x *OutgoingMessage) GetConsentOverride() bool {
+	if x != nil {
+		return x.ConsentOverride
+	}
+	return false
+}
+
+func (x *OutgoingMessage) GetClientMessageId() string {
+	if x != nil {
+		return x.ClientMessageId
+	}
+	return ""
+}
+
+func (x *OutgoingMessage) GetLanguage() string {
+	if x != nil {
+		return x.Language
+	}
+	return ""
+}
+
+func (x *OutgoingMessage) GetTemplate() string {
+	if x != nil {
+		return x.Template
+	}
+	return ""
+}
+
+func (x *OutgoingMessage) GetParams() *structpb.Struct {
+	if x != nil {
+		return x.Params
+	}
+	return nil
+}
+
+type SendResponse struct {
+	state           protoimpl.MessageState `protogen:"open.v1"`
+	ClientMessageId string                 `protobuf:"bytes,1,opt,name=client_message_id,json=clientMessageId,proto3" json:"client_message_id,omitempty"`
+	// "sent", "queued" (disconnected, re-sent after reconnect), "duplicate"
+	// (client_message_id seen before) or "failed".
+	Status    string `protobuf:"bytes,2,opt,name=status,proto3" json:"status,omitempty"`
+	MessageId string `protobuf:"bytes,3,opt,name=message_id,json=messageId,proto3" json:"message_id,omitempty"`
+	// IDs of all parts when the message was split.
+	PartIds       []string `protobuf:"bytes,4,rep,name=part_ids,json=partIds,proto3" json:"part_ids,omitempty"`
+	Timestamp     int64    `protobuf:"varint,5,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	Error         string   `protobuf:"bytes,6,opt,name=error,proto3" json:"error,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SendResponse) Reset() {
+	*x = SendResponse{}
+	mi := &file_bridge_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SendResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SendResponse) ProtoMessage() {}
+
+func (x *SendResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_bridge_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SendResponse.ProtoReflect.Descriptor instead.
+func (*SendResponse) Descriptor() ([]byte, []int) {
+	return file_bridge_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *SendResponse) GetClientMessageId() string {
+	if x != nil {
+		return x.ClientMessageId
+	}
+	return ""
+}
+
+func (x *SendResponse) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *SendResponse) GetMessageId() string {
+	if x != nil {
+		return x.MessageId
+	}
+	return ""
+}
+
+func (x *SendResponse) GetPartIds() []string {
+	if x != nil {
+		return x.PartIds
+	}
+	return nil
+}
+
+func (x *SendResponse) GetTimestamp() int64 {
+	if x != nil {
+		return x.Timestamp
+	}
+	return 0
+}
+
+func (x *SendResponse) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+var File_bridge_proto protoreflect.FileDescriptor
+
+const file_bridge_proto_rawDesc = "" +
+	"\n" +
+	"\fbridge.proto\x12\x11whatsappbridge.v1\x1a\x1cgoogle/protobuf/struct.proto\";\n" +
+	"\rEventsRequest\x12\x14\n" +
+	"\x05types\x18\x01 \x03(\tR\x05types\x12\x14\n" +
+	"\x05chats\x18\x02 \x03(\tR\x05chats\"\xa6\x01\n" +
+	"\x05Event\x12\x12\n" +
+	"\x04type\x18\x01 \x01(\tR\x04type\x12\x12\n" +
+	"\x04chat\x18\x02 \x01(\tR\x04chat\x12\x14\n" +
+	"\x05route\x18\x03 \x01(\tR\x05route\x12!\n" +
+	"\fpayload_json\x18\x04 \x01(\tR\vpayloadJson\x12<\n" +
+	"\amessage\x18\x05 \x01(\v2\".whatsappbridge.v1.IncomingMessageR\amessage\"\xd1\x03\n" +
+	"\x0fIncomingMessage\x12\x12\n" +
+	"\x04from\x18\x01 \x01(\tR\x04from\x12\x1f\n" +
+	"\vfrom_server\x18\x02 \x01(\tR\n" +
+	"fromServer\x12\x1b\n" +
+	"\tfrom_name\x18\x03 \x01(\tR\bfromName\x12\x18\n" +
+	"\acontent\x18\x04 \x01(\tR\acontent\x12\x12\n" +
+	"\x04type\x18\x05 \x01(\tR\x04type\x12\x14\n" +
+	"\x05media\x18\x06 \x01(\tR\x05media\x12\x1c\n" +
+	"\ttimestamp\x18\a \x01(\x03R\ttimestamp\x12#\n" +
+	"\rtimestamp_iso\x18\b \x01(\tR\ftimestampIso\x12\x1a\n" +
+	"\btimezone\x18\t \x01(\tR\btimezone\x12\x1d\n" +
+	"\n" +
+	"message_id\x18\n" +
+	" \x01(\tR\tmessageId\x12\x19\n" +
+	"\bis_group\x18\v \x01(\bR\aisGroup\x12\x1d\n" +
+	"\n" +
+	"group_name\x18\f \x01(\tR\tgroupName\x12!\n" +
+	"\fcontent_hash\x18\r \x01(\tR\vcontentHash\x12\x1d\n" +
+	"\n" +
+	"contact_id\x18\x0e \x01(\tR\tcontactId\x12\x14\n" +
+	"\x05route\x18\x0f \x01(\tR\x05route\x12\x18\n" +
+	"\aconsent\x18\x10 \x01(\tR\aconsent\"2\n" +
+	"\n" +
+	"Suggestion\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x14\n" +
+	"\x05title\x18\x02 \x01(\tR\x05title\"\x89\x05\n" +
+	"\x0fOutgoingMessage\x12\x14\n" +
+	"\x05phone\x18\x01 \x01(\tR\x05phone\x12\x16\n" +
+	"\x06server\x18\x02 \x01(\tR\x06server\x12\x18\n" +
+	"\amessage\x18\x03 \x01(\tR\amessage\x12\x1b\n" +
+	"\tmedia_url\x18\x04 \x01(\tR\bmediaUrl\x12\x1b\n" +
+	"\tchat_type\x18\x05 \x01(\tR\bchatType\x12-\n" +
+	"\x13reply_to_message_id\x18\x06 \x01(\tR\x10replyToMessageId\x120\n" +
+	"\x14reply_to_participant\x18\a \x01(\tR\x12replyToParticipant\x12\"\n" +
+	"\rreply_to_text\x18\b \x01(\tR\vreplyToText\x12\x1a\n" +
+	"\bmentions\x18\t \x03(\tR\bmentions\x12?\n" +
+	"\vsuggestions\x18\n" +
+	" \x03(\v2\x1d.whatsappbridge.v1.SuggestionR\vsuggestions\x12\x1b\n" +
+	"\tview_once\x18\v \x01(\bR\bviewOnce\x12#\n" +
+	"\rephemeral_ttl\x18\f \x01(\x05R\fephemeralTtl\x12\x10\n" +
+	"\x03raw\x18\r \x01(\bR\x03raw\x12)\n" +
+	"\x10consent_override\x18\x0e \x01(\bR\x0fconsentOverride\x12*\n" +
+	"\x11client_message_id\x18\x0f \x01(\tR\x0fclientMessageId\x12\x1a\n" +
+	"\blanguage\x18\x10 \x01(\tR\blanguage\x12\x1a\n" +
+	"\btemplate\x18\x11 \x01(\tR\btemplate\x12/\n" +
+	"\x06params\x18\x12 \x01(\v2\x17.google.protobuf.StructR\x06params\"\xc0\x01\n" +
+	"\fSendResponse\x12*\n" +
+	"\x11client_message_id\x18\x01 \x01(\tR\x0fclientMessageId\x12\x16\n" +
+	"\x06status\x18\x02 \x01(\tR\x06status\x12\x1d\n" +
+	"\n" +
+	"message_id\x18\x03 \x01(\tR\tmessageId\x12\x19\n" +
+	"\bpart_ids\x18\x04 \x03(\tR\apartIds\x12\x1c\n" +
+	"\ttimestamp\x18\x05 \x01(\x03R\ttimestamp\x12\x14\n" +
+	"\x05error\x18\x06 \x01(\tR\x05error2\xfc\x01\n" +
+	"\x0eWhatsAppBridge\x12F\n" +
+	"\x06Events\x12 .whatsappbridge.v1.EventsRequest\x1a\x18.whatsappbridge.v1.Event0\x01\x12K\n" +
+	"\x04Send\x12\".whatsappbridge.v1.OutgoingMessage\x1a\x1f.whatsappbridge.v1.SendResponse\x12U\n" +
+	"\n" +
+	"SendStream\x12\".whatsappbridge.v1.OutgoingMessage\x1a\x1f.whatsappbridge.v1.SendResponse(\x010\x01B=Z;github.com/phenobarbital/ai-parrot/whatsapp-bridge/bridgepbb\x06proto3"
+
+var (
+	file_bridge_proto_rawDescOnce sync.Once
+	file_bridge_proto_rawDescData []byte
+)
+
+func file_bridge_proto_rawDescGZIP() []byte {
+	file_bridge_proto_rawDescOnce.Do(func() {
+		file_bridge_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_bridge_proto_rawDesc), len(file_bridge_proto_rawDesc)))
+	})
+	return file_bridge_proto_rawDescData
+}
+
+var file_bridge_proto_msgTypes = make([]protoimpl.MessageInfo, 6)
+var file_bridge_proto_goTypes = []any{
+	(*EventsRequest)(nil),   // 0: whatsappbridge.v1.EventsRequest
+	(*Event)(nil),           // 1: whatsappbridge.v1.Event
+	(*IncomingMessage)(nil), // 2: whatsappbridge.v1.IncomingMessage
+	(*Suggestion)(nil),      // 3: whatsappbridge.v1.Suggestion
+	(*OutgoingMessage)(nil), // 4: whatsappbridge.v1.OutgoingMessage
+	(*SendResponse)(nil),    // 5: whatsappbridge.v1.SendResponse
+	(*structpb.Struct)(nil), // 6: google.protobuf.Struct
+}
+var file_bridge_proto_depIdxs = []int32{
+	2, // 0: whatsappbridge.v1.Event.message:type_name -> whatsappbridge.v1.IncomingMessage
+	3, // 1: whatsappbridge.v1.OutgoingMessage.suggestions:type_name -> whatsappbridge.v1.Suggestion
+	6, // 2: whatsappbridge.v1.OutgoingMessage.params:type_name -> google.protobuf.Struct
+	0, // 3: whatsappbridge.v1.WhatsAppBridge.Events:input_type -> whatsappbridge.v1.EventsRequest
+	4, // 4: whatsappbridge.v1.WhatsAppBridge.Send:input_type -> whatsappbridge.v1.OutgoingMessage
+	4, // 5: whatsappbridge.v1.WhatsAppBridge.SendStream:input_type -> whatsappbridge.v1.OutgoingMessage
+	1, // 6: whatsappbridge.v1.WhatsAppBridge.Events:output_type -> whatsappbridge.v1.Event
+	5, // 7: whatsappbridge.v1.WhatsAppBridge.Send:output_type -> whatsappbridge.v1.SendResponse
+	5, // 8: whatsappbridge.v1.WhatsAppBridge.SendStream:output_type -> whatsappbridge.v1.SendResponse
+	6, // [6:9] is the sub-list for method output_type
+	3, // [3:6] is the sub-list for method input_type
+	3, // [3:3] is the sub-list for extension type_name
+	3, // [3:3] is the sub-list for extension extendee
+	0, // [0:3] is the sub-list for field type_name
+}
+
+func init() { file_bridge_proto_init() }
+func file_bridge_proto_init() {
+	if File_bridge_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_bridge_proto_rawDesc), len(file_bridge_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   6,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_bridge_proto_goTypes,
+		DependencyIndexes: file_bridge_proto_depIdxs,
+		MessageInfos:      file_bridge_proto_msgTypes,
+	}.Build()
+	File_bridge_proto = out.File
+	file_bridge_proto_goTypes = nil
+	file_bridge_proto_depIdxs = nil
+}
@@ -0,0 +1,218 @@
+// gRPC API of the WhatsApp bridge, for agent backends that prefer typed,
+// streaming RPC over HTTP and Redis. Served on GRPC_ADDR; authenticated like
+// the HTTP API, with an "authorization: Bearer <key or JWT>" or "x-api-key"
+// metadata entry.
+//
+// Regenerate the Go code after editing (see bridgepb/generate.go).
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             v5.29.3
+// source: bridge.proto
+
+package bridgepb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	WhatsAppBridge_Events_FullMethodName     = "/whatsappbridge.v1.WhatsAppBridge/Events"
+	WhatsAppBridge_Send_FullMethodName       = "/whatsappbridge.v1.WhatsAppBridge/Send"
+	WhatsAppBridge_SendStream_FullMethodName = "/whatsappbridge.v1.WhatsAppBridge/SendStream"
+)
+
+// WhatsAppBridgeClient is the client API for WhatsAppBridge service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type WhatsAppBridgeClient interface {
+	// Events streams the events the bridge publishes (inbound messages,
+	// delivery statuses and whatever else PUBLISH_EVENTS enables) from the
+	// moment of the call. Events arriving faster than the client reads them
+	// are dropped for that client.
+	Events(ctx context.Context, in *EventsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Event], error)
+	// Send sends one message, like POST /send.
+	Send(ctx context.Context, in *OutgoingMessage, opts ...grpc.CallOption) (*SendResponse, error)
+	// SendStream sends every message of the request stream in order and
+	// answers each with its result, so a backend can keep one call open for
+	// all its replies.
+	SendStream(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[OutgoingMessage, SendResponse], error)
+}
+
+type whatsAppBridgeClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewWhatsAppBridgeClient(cc grpc.ClientConnInterface) WhatsAppBridgeClient {
+	return &whatsAppBridgeClient{cc}
+}
+
+func (c *whatsAppBridgeClient) Events(ctx context.Context, in *EventsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Event], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &WhatsAppBridge_ServiceDesc.Streams[0], WhatsAppBridge_Events_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[EventsRequest, Event]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type WhatsAppBridge_EventsClient = grpc.ServerStreamingClient[Event]
+
+func (c *whatsAppBridgeClient) Send(ctx context.Context, in *OutgoingMessage, opts ...grpc.CallOption) (*SendResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SendResponse)
+	err := c.cc.Invoke(ctx, WhatsAppBridge_Send_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *whatsAppBridgeClient) SendStream(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[OutgoingMessage, SendResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &WhatsAppBridge_ServiceDesc.Streams[1], WhatsAppBridge_SendStream_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[OutgoingMessage, SendResponse]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type WhatsAppBridge_SendStreamClient = grpc.BidiStreamingClient[OutgoingMessage, SendResponse]
+
+// WhatsAppBridgeServer is the server API for WhatsAppBridge service.
+// All implementations must embed UnimplementedWhatsAppBridgeServer
+// for forward compatibility.
+type WhatsAppBridgeServer interface {
+	// Events streams the events the bridge publishes (inbound messages,
+	// delivery statuses and whatever else PUBLISH_EVENTS enables) from the
+	// moment of the call. Events arriving faster than the client reads them
+	// are dropped for that client.
+	Events(*EventsRequest, grpc.ServerStreamingServer[Event]) error
+	// Send sends one message, like POST /send.
+	Send(context.Context, *OutgoingMessage) (*SendResponse, error)
+	// SendStream sends every message of the request stream in order and
+	// answers each with its result, so a backend can keep one call open for
+	// all its replies.
+	SendStream(grpc.BidiStreamingServer[OutgoingMessage, SendResponse]) error
+	mustEmbedUnimplementedWhatsAppBridgeServer()
+}
+
+// UnimplementedWhatsAppBridgeServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedWhatsAppBridgeServer struct{}
+
+func (UnimplementedWhatsAppBridgeServer) Events(*EventsRequest, grpc.ServerStreamingServer[Event]) error {
+	return status.Errorf(codes.Unimplemented, "method Events not implemented")
+}
+func (UnimplementedWhatsAppBridgeServer) Send(context.Context, *OutgoingMessage) (*SendResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Send not implemented")
+}
+func (UnimplementedWhatsAppBridgeServer) SendStream(grpc.BidiStreamingServer[OutgoingMessage, SendResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method SendStream not implemented")
+}
+func (UnimplementedWhatsAppBridgeServer) mustEmbedUnimplementedWhatsAppBridgeServer() {}
+func (UnimplementedWhatsAppBridgeServer) testEmbeddedByValue()                        {}
+
+// UnsafeWhatsAppBridgeServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to WhatsAppBridgeServer will
+// result in compilation errors.
+type UnsafeWhatsAppBridgeServer interface {
+	mustEmbedUnimplementedWhatsAppBridgeServer()
+}
+
+func RegisterWhatsAppBridgeServer(s grpc.ServiceRegistrar, srv WhatsAppBridgeServer) {
+	// If the following call pancis, it indicates UnimplementedWhatsAppBridgeServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&WhatsAppBridge_ServiceDesc, srv)
+}
+
+func _WhatsAppBridge_Events_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(EventsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(WhatsAppBridgeServer).Events(m, &grpc.GenericServerStream[EventsRequest, Event]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type WhatsAppBridge_EventsServer = grpc.ServerStreamingServer[Event]
+
+func _WhatsAppBridge_Send_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(OutgoingMessage)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(WhatsAppBridgeServer).Send(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: WhatsAppBridge_Send_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(WhatsAppBridgeServer).Send(ctx, req.(*OutgoingMessage))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _WhatsAppBridge_SendStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(WhatsAppBridgeServer).SendStream(&grpc.GenericServerStream[OutgoingMessage, SendResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type WhatsAppBridge_SendStreamServer = grpc.BidiStreamingServer[OutgoingMessage, SendResponse]
+
+// WhatsAppBridge_ServiceDesc is the grpc.ServiceDesc for WhatsAppBridge service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var WhatsAppBridge_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "whatsappbridge.v1.WhatsAppBridge",
+	HandlerType: (*WhatsAppBridgeServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Send",
+			Handler:    _WhatsAppBridge_Send_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Events",
+			Handler:       _WhatsAppBridge_Events_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "SendStream",
+			Handler:       _WhatsAppBridge_SendStream_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "bridge.proto",
+}
@@ -0,0 +1,6 @@
+// Package bridgepb holds the protobuf messages and gRPC service of the
+// bridge's gRPC API (bridge.proto), for the server in package bridge and for
+// Go clients.
+package bridgepb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative bridge.proto
@@ -0,0 +1,386 @@
+package bridgetest
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/appstate"
+	"go.mau.fi/whatsmeow/proto/waCommon"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/store"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/phenobarbital/ai-parrot/whatsapp-bridge/bridge"
+)
+
+// SentMessage is one message the bridge handed to the fake client.
+type SentMessage struct {
+	To        types.JID
+	ID        types.MessageID
+	Message   *waE2E.Message
+	Timestamp time.Time
+}
+
+// ChatPresence is one typing indicator the bridge sent.
+type ChatPresence struct {
+	Chat  types.JID
+	State types.ChatPresence
+}
+
+// FakeClient is an in-memory bridge.Client. It records sent messages and
+// uploads, serves downloads from uploaded media, and dispatches simulated
+// events to the handlers the bridge registered.
+type FakeClient struct {
+	mu        sync.Mutex
+	device    *store.Device
+	handlers  []whatsmeow.EventHandler
+	connected bool
+	sent      []SentMessage
+	sendErr   []error
+	media     map[string][]byte // direct path -> plaintext
+	groups    map[types.JID]*types.GroupInfo
+	pollVotes map[types.MessageID]*waE2E.PollVoteMessage
+	notOnWA   map[string]bool // phones without an account
+	business  map[types.JID]*bridge.BusinessInfo
+	presences []ChatPresence
+	nextID    int
+}
+
+// NewFakeClient returns a fake logged in as ownJID.
+func NewFakeClient(ownJID types.JID) *FakeClient {
+	return &FakeClient{
+		device:    &store.Device{ID: &ownJID},
+		media:     make(map[string][]byte),
+		groups:    make(map[types.JID]*types.GroupInfo),
+		pollVotes: make(map[types.MessageID]*waE2E.PollVoteMessage),
+		notOnWA:   make(map[string]bool),
+		business:  make(map[types.JID]*bridge.BusinessInfo),
+	}
+}
+
+// Emit delivers evt synchronously to every registered event handler, as
+// whatsmeow does for events received from the server.
+func (c *FakeClient) Emit(evt any) {
+	c.mu.Lock()
+	handlers := append([]whatsmeow.EventHandler(nil), c.handlers...)
+	c.mu.Unlock()
+	for _, h := range handlers {
+		h(evt)
+	}
+}
+
+// Sent returns a copy of every message sent so far.
+func (c *FakeClient) Sent() []SentMessage {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]SentMessage(nil), c.sent...)
+}
+
+// Presences returns the chat presences sent so far, oldest first.
+func (c *FakeClient) Presences() []ChatPresence {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]ChatPresence(nil), c.presences...)
+}
+
+// FailNextSend makes the next SendMessage call return err.
+func (c *FakeClient) FailNextSend(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sendErr = append(c.sendErr, err)
+}
+
+// FailSendAfter lets the next n SendMessage calls through and makes the one
+// after them return err, e.g. to fail the second part of a split message.
+func (c *FakeClient) FailSendAfter(n int, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for range n {
+		c.sendErr = append(c.sendErr, nil)
+	}
+	c.sendErr = append(c.sendErr, err)
+}
+
+// SetGroup registers group metadata returned by GetGroupInfo.
+func (c *FakeClient) SetGroup(info *types.GroupInfo) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.groups[info.JID] = info
+}
+
+// SetPollVote sets the decrypted vote returned for the poll update message id.
+func (c *FakeClient) SetPollVote(id types.MessageID, vote *waE2E.PollVoteMessage) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pollVotes[id] = vote
+}
+
+// SetNotOnWhatsApp makes IsOnWhatsApp report phone (digits only) as not
+// registered; every other number is.
+func (c *FakeClient) SetNotOnWhatsApp(phone string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.notOnWA[phone] = true
+}
+
+// SetBusinessProfile makes GetBusinessProfile return profile for its JID;
+// other JIDs are not businesses.
+func (c *FakeClient) SetBusinessProfile(profile *bridge.BusinessInfo) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.business[profile.JID] = profile
+}
+
+// AddMedia stores plaintext under directPath so Download can serve it for
+// simulated inbound media.
+func (c *FakeClient) AddMedia(directPath string, plaintext []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.media[directPath] = plaintext
+}
+
+func (c *FakeClient) AddEventHandler(handler whatsmeow.EventHandler) uint32 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.handlers = append(c.handlers, handler)
+	return uint32(len(c.handlers))
+}
+
+func (c *FakeClient) Connect() error {
+	c.mu.Lock()
+	c.connected = true
+	c.mu.Unlock()
+	c.Emit(&events.Connected{})
+	return nil
+}
+
+func (c *FakeClient) Disconnect() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.connected = false
+}
+
+func (c *FakeClient) IsConnected() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.connected
+}
+
+func (c *FakeClient) GetQRChannel(ctx context.Context) (<-chan whatsmeow.QRChannelItem, error) {
+	ch := make(chan whatsmeow.QRChannelItem)
+	close(ch)
+	return ch, nil
+}
+
+// PairPhone returns a fixed code: the fake is always paired.
+func (c *FakeClient) PairPhone(ctx context.Context, phone string, showPushNotification bool, clientType whatsmeow.PairClientType, clientDisplayName string) (string, error) {
+	return "FAKE-CODE", nil
+}
+
+func (c *FakeClient) GenerateMessageID() types.MessageID {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.nextID++
+	return fmt.Sprintf("FAKE%016d", c.nextID)
+}
+
+func (c *FakeClient) SendMessage(ctx context.Context, to types.JID, message *waE2E.Message, extra ...whatsmeow.SendRequestExtra) (whatsmeow.SendResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.sendErr) > 0 {
+		err := c.sendErr[0]
+		c.sendErr = c.sendErr[1:]
+		if err != nil {
+			return whatsmeow.SendResponse{}, err
+		}
+	}
+
+	c.nextID++
+	resp := whatsmeow.SendResponse{
+		ID:        fmt.Sprintf("FAKE%016d", c.nextID),
+		Timestamp: time.Now(),
+	}
+	if len(extra) > 0 && extra[0].ID != "" {
+		resp.ID = extra[0].ID
+	}
+	c.sent = append(c.sent, SentMessage{To: to, ID: resp.ID, Message: message, Timestamp: resp.Timestamp})
+	return resp, nil
+}
+
+func (c *FakeClient) Upload(ctx context.Context, plaintext []byte, appInfo whatsmeow.MediaType) (whatsmeow.UploadResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	sum := sha256.Sum256(plaintext)
+	path := fmt.Sprintf("/fake/%x", sum[:8])
+	c.media[path] = plaintext
+	return whatsmeow.UploadResponse{
+		URL:           "https://mmg.whatsapp.net" + path,
+		DirectPath:    path,
+		MediaKey:      sum[:],
+		FileEncSHA256: sum[:],
+		FileSHA256:    sum[:],
+		FileLength:    uint64(len(plaintext)),
+	}, nil
+}
+
+func (c *FakeClient) Download(ctx context.Context, msg whatsmeow.DownloadableMessage) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	data, ok := c.media[msg.GetDirectPath()]
+	if !ok {
+		return nil, whatsmeow.ErrMediaDownloadFailedWith404
+	}
+	return data, nil
+}
+
+func (c *FakeClient) GetGroupInfo(ctx context.Context, jid types.JID) (*types.GroupInfo, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if info, ok := c.groups[jid]; ok {
+		return info, nil
+	}
+	return nil, whatsmeow.ErrGroupNotFound
+}
+
+func (c *FakeClient) GetJoinedGroups(ctx context.Context) ([]*types.GroupInfo, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	groups := make([]*types.GroupInfo, 0, len(c.groups))
+	for _, info := range c.groups {
+		groups = append(groups, info)
+	}
+	return groups, nil
+}
+
+// FetchAppState succeeds without doing anything: the fake has no app state.
+func (c *FakeClient) FetchAppState(ctx context.Context, name appstate.WAPatchName, fullSync, onlyIfNotSynced bool) error {
+	return nil
+}
+
+// SendAppState accepts every patch without doing anything.
+func (c *FakeClient) SendAppState(ctx context.Context, patch appstate.PatchInfo) error {
+	return nil
+}
+
+func (c *FakeClient) IsOnWhatsApp(ctx context.Context, phones []string) ([]types.IsOnWhatsAppResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := make([]types.IsOnWhatsAppResponse, len(phones))
+	for i, phone := range phones {
+		user := strings.TrimPrefix(phone, "+")
+		out[i] = types.IsOnWhatsAppResponse{
+			Query: phone,
+			JID:   types.NewJID(user, types.DefaultUserServer),
+			IsIn:  !c.notOnWA[user],
+		}
+	}
+	return out, nil
+}
+
+// GetUserDevices reports the phone of every user, plus the fake's own device
+// for its own account.
+func (c *FakeClient) GetUserDevices(ctx context.Context, jids []types.JID) ([]types.JID, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var out []types.JID
+	for _, jid := range jids {
+		out = append(out, jid.ToNonAD())
+		if own := c.device.ID; own != nil && jid.User == own.User && own.Device != 0 {
+			out = append(out, *own)
+		}
+	}
+	return out, nil
+}
+
+func (c *FakeClient) GetBusinessProfile(ctx context.Context, jid types.JID) (*bridge.BusinessInfo, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	profile, ok := c.business[jid]
+	if !ok {
+		return nil, fmt.Errorf("fake: %s is not a business", jid)
+	}
+	return profile, nil
+}
+
+func (c *FakeClient) SendChatPresence(ctx context.Context, jid types.JID, state types.ChatPresence, media types.ChatPresenceMedia) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.presences = append(c.presences, ChatPresence{Chat: jid, State: state})
+	return nil
+}
+
+func (c *FakeClient) BuildEdit(chat types.JID, id types.MessageID, newContent *waE2E.Message) *waE2E.Message {
+	return &waE2E.Message{
+		EditedMessage: &waE2E.FutureProofMessage{
+			Message: &waE2E.Message{
+				ProtocolMessage: &waE2E.ProtocolMessage{
+					Key:           c.messageKey(chat, types.EmptyJID, id),
+					Type:          waE2E.ProtocolMessage_MESSAGE_EDIT.Enum(),
+					EditedMessage: newContent,
+					TimestampMS:   proto.Int64(time.Now().UnixMilli()),
+				},
+			},
+		},
+	}
+}
+
+func (c *FakeClient) BuildReaction(chat, sender types.JID, id types.MessageID, reaction string) *waE2E.Message {
+	return &waE2E.Message{
+		ReactionMessage: &waE2E.ReactionMessage{
+			Key:               c.messageKey(chat, sender, id),
+			Text:              proto.String(reaction),
+			SenderTimestampMS: proto.Int64(time.Now().UnixMilli()),
+		},
+	}
+}
+
+func (c *FakeClient) BuildPollCreation(name string, optionNames []string, selectableOptionCount int) *waE2E.Message {
+	options := make([]*waE2E.PollCreationMessage_Option, len(optionNames))
+	for i, option := range optionNames {
+		options[i] = &waE2E.PollCreationMessage_Option{OptionName: proto.String(option)}
+	}
+	return &waE2E.Message{
+		PollCreationMessage: &waE2E.PollCreationMessage{
+			Name:                   proto.String(name),
+			Options:                options,
+			SelectableOptionsCount: proto.Uint32(uint32(selectableOptionCount)),
+		},
+	}
+}
+
+func (c *FakeClient) DecryptPollVote(ctx context.Context, vote *events.Message) (*waE2E.PollVoteMessage, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if v, ok := c.pollVotes[vote.Info.ID]; ok {
+		return v, nil
+	}
+	return nil, fmt.Errorf("no vote registered for %s", vote.Info.ID)
+}
+
+func (c *FakeClient) Device() *store.Device {
+	return c.device
+}
+
+// messageKey mirrors whatsmeow's BuildMessageKey: keys are ours unless the
+// sender is someone else.
+func (c *FakeClient) messageKey(chat, sender types.JID, id types.MessageID) *waCommon.MessageKey {
+	key := &waCommon.MessageKey{
+		FromMe:    proto.Bool(true),
+		ID:        proto.String(id),
+		RemoteJID: proto.String(chat.String()),
+	}
+	if own := c.device.ID; !sender.IsEmpty() && (own == nil || sender.User != own.User) {
+		key.FromMe = proto.Bool(false)
+		if chat.Server == types.GroupServer {
+			key.Participant = proto.String(sender.ToNonAD().String())
+		}
+	}
+	return key
+}
@@ -0,0 +1,302 @@
+// Package bridgetest runs a complete WhatsApp bridge in-process against a
+// fake WhatsApp client and an embedded Redis (miniredis), so scenarios can
+// be exercised end to end without a paired phone or external services.
+//
+//	h := bridgetest.New(t)
+//	h.ReceiveText("5215512345678", "hola")
+//	msg := h.ExpectMessage()
+//	h.Send(bridge.OutgoingMessage{Phone: msg.From, Message: "¡Hola!"})
+package bridgetest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/phenobarbital/ai-parrot/whatsapp-bridge/bridge"
+)
+
+// DefaultOwnJID is the account the fake client is logged in as.
+var DefaultOwnJID = types.NewJID("15550000000", types.DefaultUserServer)
+
+// DefaultTimeout bounds the Expect* helpers.
+var DefaultTimeout = 2 * time.Second
+
+// Harness is a running bridge with its fakes. Everything is torn down by
+// tb.Cleanup.
+type Harness struct {
+	TB          testing.TB
+	Bridge      *bridge.WhatsAppBridge
+	Client      *FakeClient
+	Redis       *miniredis.Miniredis
+	RedisClient *redis.Client
+	Server      *httptest.Server
+
+	capture *captureSink
+	seq     int
+}
+
+// Option customizes the harness before the bridge is configured.
+type Option func(*options)
+
+type options struct {
+	env    map[string]string
+	ownJID types.JID
+}
+
+// WithEnv sets an environment variable (e.g. ROUTES, DIGEST_GROUPS) for the
+// bridge's configuration; it is restored when the test ends.
+func WithEnv(key, value string) Option {
+	return func(o *options) { o.env[key] = value }
+}
+
+// WithOwnJID changes the account the fake client is logged in as.
+func WithOwnJID(jid types.JID) Option {
+	return func(o *options) { o.ownJID = jid }
+}
+
+// New starts a bridge wired to a fresh miniredis, a FakeClient and a
+// temporary archive, and serves its HTTP API on an httptest server. The
+// bridge reads its configuration from the environment, so harnesses must
+// not run in parallel tests.
+func New(tb testing.TB, opts ...Option) *Harness {
+	tb.Helper()
+	o := &options{env: make(map[string]string), ownJID: DefaultOwnJID}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	tb.Setenv("ARCHIVE_DB", "file:"+filepath.Join(tb.TempDir(), "bridge.db")+"?_foreign_keys=on&_busy_timeout=5000")
+	tb.Setenv("MEDIA_DOWNLOAD_DIR", filepath.Join(tb.TempDir(), "media"))
+	// Emit returns once a message is handled, unless a test asks for workers.
+	tb.Setenv("INBOUND_WORKERS", "0")
+	for key, value := range o.env {
+		tb.Setenv(key, value)
+	}
+
+	mr := miniredis.RunT(tb)
+	redisClient := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	client := NewFakeClient(o.ownJID)
+
+	h := &Harness{
+		TB:          tb,
+		Bridge:      bridge.New(redisClient, client),
+		Client:      client,
+		Redis:       mr,
+		RedisClient: redisClient,
+		capture:     newCaptureSink(),
+	}
+	if err := h.Bridge.Configure(); err != nil {
+		tb.Fatalf("bridgetest: configure: %v", err)
+	}
+	if err := h.Bridge.Start(); err != nil {
+		tb.Fatalf("bridgetest: start: %v", err)
+	}
+	h.Bridge.AddSink(h.capture, bridge.SinkConfig{Name: "bridgetest", Type: "capture"})
+	if err := h.Bridge.Connect(); err != nil {
+		tb.Fatalf("bridgetest: connect: %v", err)
+	}
+	h.Server = httptest.NewServer(h.Bridge.Handler())
+
+	tb.Cleanup(func() {
+		h.Server.Close()
+		h.Bridge.Shutdown()
+		redisClient.Close()
+	})
+	return h
+}
+
+// Emit dispatches a raw whatsmeow event to the bridge. Messages are handled
+// before it returns, unless the test set INBOUND_WORKERS.
+func (h *Harness) Emit(evt any) {
+	h.Client.Emit(evt)
+}
+
+// Receive simulates an inbound message from sender in chat and returns its ID.
+func (h *Harness) Receive(chat, sender types.JID, msg *waE2E.Message) types.MessageID {
+	h.seq++
+	id := fmt.Sprintf("IN%016d", h.seq)
+	h.Emit(&events.Message{
+		Info: types.MessageInfo{
+			MessageSource: types.MessageSource{
+				Chat:    chat,
+				Sender:  sender,
+				IsGroup: chat.Server == types.GroupServer,
+			},
+			ID:        id,
+			PushName:  "Test " + sender.User,
+			Timestamp: time.Now(),
+		},
+		Message: msg,
+	})
+	return id
+}
+
+// ReceiveText simulates a 1:1 text message from phone.
+func (h *Harness) ReceiveText(phone, text string) types.MessageID {
+	jid := types.NewJID(phone, types.DefaultUserServer)
+	return h.Receive(jid, jid, &waE2E.Message{Conversation: proto.String(text)})
+}
+
+// ReceiveGroupText simulates a text message from phone in group (the user
+// part of a @g.us JID), registering the group if needed.
+func (h *Harness) ReceiveGroupText(group, phone, text string) types.MessageID {
+	chat := types.NewJID(group, types.GroupServer)
+	if _, err := h.Client.GetGroupInfo(context.Background(), chat); err != nil {
+		h.Client.SetGroup(&types.GroupInfo{JID: chat, GroupName: types.GroupName{Name: "Group " + group}})
+	}
+	return h.Receive(chat, types.NewJID(phone, types.DefaultUserServer), &waE2E.Message{Conversation: proto.String(text)})
+}
+
+// Do sends an HTTP request to the bridge API, JSON-encoding body when not
+// nil, and decodes the standard response envelope.
+func (h *Harness) Do(method, path string, body any) (int, bridge.Response) {
+	h.TB.Helper()
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			h.TB.Fatalf("bridgetest: encode request: %v", err)
+		}
+	}
+	req, err := http.NewRequest(method, h.Server.URL+path, &buf)
+	if err != nil {
+		h.TB.Fatalf("bridgetest: build request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := h.Server.Client().Do(req)
+	if err != nil {
+		h.TB.Fatalf("bridgetest: %s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	var out bridge.Response
+	json.NewDecoder(resp.Body).Decode(&out)
+	return resp.StatusCode, out
+}
+
+// Send posts msg to /send and fails the test unless it succeeds.
+func (h *Harness) Send(msg bridge.OutgoingMessage) bridge.Response {
+	h.TB.Helper()
+	status, resp := h.Do(http.MethodPost, "/send", msg)
+	if status != http.StatusOK || !resp.Success {
+		h.TB.Fatalf("bridgetest: send failed with %d: %s", status, resp.Error)
+	}
+	return resp
+}
+
+// Sent returns every message the bridge sent through the fake client.
+func (h *Harness) Sent() []SentMessage {
+	return h.Client.Sent()
+}
+
+// LastSent returns the most recent sent message, failing when none was sent.
+func (h *Harness) LastSent() SentMessage {
+	h.TB.Helper()
+	sent := h.Sent()
+	if len(sent) == 0 {
+		h.TB.Fatalf("bridgetest: no message was sent")
+	}
+	return sent[len(sent)-1]
+}
+
+// ExpectEvent waits for the next published event of eventType, skipping
+// others, and fails the test after DefaultTimeout.
+func (h *Harness) ExpectEvent(eventType string) bridge.BridgeEvent {
+	h.TB.Helper()
+	evt, ok := h.capture.next(eventType, DefaultTimeout)
+	if !ok {
+		h.TB.Fatalf("bridgetest: no %s event within %s", eventType, DefaultTimeout)
+	}
+	return evt
+}
+
+// ExpectNoEvent fails the test if an event of eventType is published within d.
+func (h *Harness) ExpectNoEvent(eventType string, d time.Duration) {
+	h.TB.Helper()
+	if evt, ok := h.capture.next(eventType, d); ok {
+		h.TB.Fatalf("bridgetest: unexpected %s event: %+v", eventType, evt.Payload)
+	}
+}
+
+// ExpectMessage waits for the next inbound message event.
+func (h *Harness) ExpectMessage() bridge.IncomingMessage {
+	h.TB.Helper()
+	evt := h.ExpectEvent(bridge.EventMessage)
+	msg, ok := evt.Payload.(bridge.IncomingMessage)
+	if !ok {
+		h.TB.Fatalf("bridgetest: message payload is %T", evt.Payload)
+	}
+	return msg
+}
+
+// DecodePayload round-trips an event payload through JSON into v, matching
+// what downstream consumers receive.
+func (h *Harness) DecodePayload(evt bridge.BridgeEvent, v any) {
+	h.TB.Helper()
+	data, err := evt.MarshalPayload()
+	if err == nil {
+		err = json.Unmarshal(data, v)
+	}
+	if err != nil {
+		h.TB.Fatalf("bridgetest: decode %s payload: %v", evt.Type, err)
+	}
+}
+
+// captureSink records every published event for the Expect helpers.
+type captureSink struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	events []bridge.BridgeEvent
+}
+
+func newCaptureSink() *captureSink {
+	s := &captureSink{}
+	s.cond = sync.NewCond(&s.mu)
+	return s
+}
+
+func (s *captureSink) Name() string { return "bridgetest" }
+
+func (s *captureSink) Deliver(_ context.Context, evt bridge.BridgeEvent) error {
+	s.mu.Lock()
+	s.events = append(s.events, evt)
+	s.mu.Unlock()
+	s.cond.Broadcast()
+	return nil
+}
+
+// next removes and returns the first queued event of eventType.
+func (s *captureSink) next(eventType string, timeout time.Duration) (bridge.BridgeEvent, bool) {
+	deadline := time.Now().Add(timeout)
+	timer := time.AfterFunc(timeout, s.cond.Broadcast)
+	defer timer.Stop()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for {
+		for i, evt := range s.events {
+			if evt.Type == eventType {
+				s.events = append(s.events[:i], s.events[i+1:]...)
+				return evt, true
+			}
+		}
+		if !time.Now().Before(deadline) {
+			return bridge.BridgeEvent{}, false
+		}
+		s.cond.Wait()
+	}
+}
@@ -1,558 +1,89 @@
 package main
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
-	"strings"
+	"strconv"
 	"syscall"
 	"time"
 
-	"github.com/go-redis/redis/v8"
-	"github.com/gorilla/mux"
-	"github.com/gorilla/websocket"
-	_ "github.com/mattn/go-sqlite3"
-	qrterminal "github.com/mdp/qrterminal/v3"
-	"github.com/skip2/go-qrcode"
-	"go.mau.fi/whatsmeow"
-	"go.mau.fi/whatsmeow/proto/waE2E"
-	"go.mau.fi/whatsmeow/store"
-	"go.mau.fi/whatsmeow/store/sqlstore"
-	"go.mau.fi/whatsmeow/types"
-	"go.mau.fi/whatsmeow/types/events"
-	waLog "go.mau.fi/whatsmeow/util/log"
-	"google.golang.org/protobuf/proto"
+	"github.com/phenobarbital/ai-parrot/whatsapp-bridge/bridge"
 )
 
-// WhatsAppBridge manages WhatsApp connection and message routing.
-type WhatsAppBridge struct {
-	client        *whatsmeow.Client
-	redisClient   *redis.Client
-	ctx           context.Context
-	qrCodeData    string
-	qrCodePNG     []byte
-	authenticated bool
-	callbackURL   string // HTTP callback URL for direct integration
-
-	// WebSocket connections for QR code streaming
-	wsUpgrader websocket.Upgrader
-	wsClients  map[*websocket.Conn]bool
-}
-
-// IncomingMessage is the structure published to Redis for each received message.
-type IncomingMessage struct {
-	From       string                 `json:"from"`
-	FromServer string                 `json:"from_server,omitempty"`
-	FromName   string                 `json:"from_name,omitempty"`
-	Content    string                 `json:"content"`
-	Type       string                 `json:"type"`
-	Media      string                 `json:"media,omitempty"`
-	Timestamp  int64                  `json:"timestamp"`
-	MessageID  string                 `json:"message_id"`
-	IsGroup    bool                   `json:"is_group"`
-	GroupName  string                 `json:"group_name,omitempty"`
-	Extra      map[string]interface{} `json:"extra,omitempty"`
-}
-
-// OutgoingMessage is the payload accepted by the /send endpoint.
-type OutgoingMessage struct {
-	Phone    string `json:"phone"`
-	Server   string `json:"server,omitempty"`
-	Message  string `json:"message"`
-	MediaURL string `json:"media_url,omitempty"`
-}
-
-// Response is the standard JSON envelope returned by all HTTP handlers.
-type Response struct {
-	Success bool        `json:"success"`
-	Data    interface{} `json:"data,omitempty"`
-	Error   string      `json:"error,omitempty"`
-}
-
-// NewWhatsAppBridge creates a bridge connected to Redis.
-func NewWhatsAppBridge(redisURL string) (*WhatsAppBridge, error) {
-	opt, err := redis.ParseURL(redisURL)
-	if err != nil {
-		return nil, fmt.Errorf("invalid Redis URL: %v", err)
-	}
-
-	redisClient := redis.NewClient(opt)
-	ctx := context.Background()
-
-	if err := redisClient.Ping(ctx).Err(); err != nil {
-		return nil, fmt.Errorf("Redis connection failed: %v", err)
-	}
-
-	bridge := &WhatsAppBridge{
-		ctx:         ctx,
-		redisClient: redisClient,
-		wsUpgrader: websocket.Upgrader{
-			CheckOrigin: func(r *http.Request) bool { return true },
-		},
-		wsClients: make(map[*websocket.Conn]bool),
-	}
-
-	return bridge, nil
-}
-
-// InitializeWhatsApp sets up the whatsmeow client with SQLite session storage.
-func (b *WhatsAppBridge) InitializeWhatsApp() error {
-	dbLog := waLog.Stdout("Database", "INFO", true)
-
-	// Ensure data directory exists
-	if _, err := os.Stat("data"); os.IsNotExist(err) {
-		os.Mkdir("data", 0755)
-	}
-
-	container, err := sqlstore.New(b.ctx, "sqlite3", "file:data/whatsapp.db?_foreign_keys=on", dbLog)
-	if err != nil {
-		return fmt.Errorf("failed to connect to database: %v", err)
-	}
-
-	deviceStore, err := container.GetFirstDevice(b.ctx)
-	if err != nil {
-		return fmt.Errorf("failed to get device: %v", err)
-	}
-
-	clientLog := waLog.Stdout("Client", "INFO", true)
-
-	// Customize device name shown in WhatsApp > Linked Devices
-	store.DeviceProps.Os = proto.String("Parrot Bridge")
-	store.DeviceProps.RequireFullSync = proto.Bool(false)
-
-	b.client = whatsmeow.NewClient(deviceStore, clientLog)
-	b.client.AddEventHandler(b.handleEvent)
-
-	return nil
-}
-
-func (b *WhatsAppBridge) handleEvent(evt interface{}) {
-	log.Printf("🔔 Event received: %T", evt)
-	switch v := evt.(type) {
-	case *events.Message:
-		log.Printf("📩 Message event: from=%s, isFromMe=%v, chat=%s, type=%T",
-			v.Info.Sender.User, v.Info.IsFromMe, v.Info.Chat.User, v.Message)
-		b.handleIncomingMessage(v)
-	case *events.Receipt:
-		log.Printf("Receipt: %v", v)
-	case *events.Presence:
-		log.Printf("Presence: %s is unavailable=%v", v.From, v.Unavailable)
-	case *events.ChatPresence:
-		log.Printf("ChatPresence: %s", v.State)
-	case *events.Connected:
-		log.Println("✅ WhatsApp connected")
-		b.authenticated = true
-		b.broadcastAuthenticated()
-	case *events.LoggedOut:
-		log.Println("⚠️ Logged out from WhatsApp")
-		b.authenticated = false
-	}
-}
-
-func (b *WhatsAppBridge) handleIncomingMessage(msg *events.Message) {
-	info := msg.Info
-
-	log.Printf("📋 handleIncomingMessage: sender=%s, isFromMe=%v, isGroup=%v, chat=%s",
-		info.Sender.User, info.IsFromMe, info.IsGroup, info.Chat.User)
-
-	// Skip messages from self
-	if info.IsFromMe {
-		log.Printf("⏭️ Skipping message from self (IsFromMe=true)")
-		return
-	}
-	log.Printf("✅ Processing incoming message from %s", info.Sender.User)
-
-	incomingMsg := IncomingMessage{
-		From:       info.Sender.User,
-		FromServer: info.Sender.Server,
-		Timestamp:  info.Timestamp.Unix(),
-		MessageID:  info.ID,
-		IsGroup:    info.IsGroup,
-		Extra:      make(map[string]interface{}),
-	}
-
-	if info.PushName != "" {
-		incomingMsg.FromName = info.PushName
-	}
-
-	if info.IsGroup {
-		groupInfo, err := b.client.GetGroupInfo(b.ctx, info.Chat)
-		if err == nil {
-			incomingMsg.GroupName = groupInfo.Name
-		}
-	}
-
-	// Extract message content based on type
-	if msg.Message.GetConversation() != "" {
-		incomingMsg.Type = "text"
-		incomingMsg.Content = msg.Message.GetConversation()
-	} else if extendedMsg := msg.Message.GetExtendedTextMessage(); extendedMsg != nil {
-		incomingMsg.Type = "text"
-		incomingMsg.Content = extendedMsg.GetText()
-	} else if imageMsg := msg.Message.GetImageMessage(); imageMsg != nil {
-		incomingMsg.Type = "image"
-		incomingMsg.Content = imageMsg.GetCaption()
-		incomingMsg.Media = imageMsg.GetURL()
-	} else if audioMsg := msg.Message.GetAudioMessage(); audioMsg != nil {
-		incomingMsg.Type = "audio"
-		incomingMsg.Media = audioMsg.GetURL()
-	} else if videoMsg := msg.Message.GetVideoMessage(); videoMsg != nil {
-		incomingMsg.Type = "video"
-		incomingMsg.Content = videoMsg.GetCaption()
-		incomingMsg.Media = videoMsg.GetURL()
-	} else if docMsg := msg.Message.GetDocumentMessage(); docMsg != nil {
-		incomingMsg.Type = "document"
-		incomingMsg.Content = docMsg.GetFileName()
-		incomingMsg.Media = docMsg.GetURL()
-	} else {
-		incomingMsg.Type = "unknown"
-		incomingMsg.Content = "Unsupported message type"
-	}
-
-	log.Printf("📨 Message from %s (%s): %s", incomingMsg.From, incomingMsg.FromName, incomingMsg.Content)
-
-	// Publish via Redis (always)
-	b.publishToRedis(incomingMsg)
-
-	// Also POST to HTTP callback if configured
-	if b.callbackURL != "" {
-		go b.postToCallback(incomingMsg)
-	}
-}
-
-func (b *WhatsAppBridge) publishToRedis(msg IncomingMessage) {
-	data, err := json.Marshal(msg)
-	if err != nil {
-		log.Printf("Error marshaling message: %v", err)
-		return
-	}
-
-	err = b.redisClient.Publish(b.ctx, "whatsapp:messages", data).Err()
-	if err != nil {
-		log.Printf("Error publishing to Redis: %v", err)
-	}
-}
-
-func (b *WhatsAppBridge) postToCallback(msg IncomingMessage) {
-	data, err := json.Marshal(msg)
-	if err != nil {
-		log.Printf("Error marshaling message for callback: %v", err)
-		return
-	}
-
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Post(b.callbackURL, "application/json", bytes.NewReader(data))
-	if err != nil {
-		log.Printf("Error posting to callback %s: %v", b.callbackURL, err)
-		return
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode >= 400 {
-		log.Printf("Callback %s returned status %d", b.callbackURL, resp.StatusCode)
+func main() {
+	redisURL := os.Getenv("REDIS_URL")
+	if redisURL == "" {
+		redisURL = "redis://localhost:6379"
 	}
-}
-
-// Connect performs QR-based authentication or resumes an existing session.
-func (b *WhatsAppBridge) Connect() error {
-	if b.client.Store.ID == nil {
-		qrChan, err := b.client.GetQRChannel(b.ctx)
-		if err != nil {
-			return fmt.Errorf("failed to get QR channel: %v", err)
-		}
-
-		err = b.client.Connect()
-		if err != nil {
-			return fmt.Errorf("failed to connect: %v", err)
-		}
-
-		for evt := range qrChan {
-			if evt.Event == "code" {
-				b.qrCodeData = evt.Code
 
-				png, err := qrcode.Encode(evt.Code, qrcode.Medium, 256)
-				if err == nil {
-					b.qrCodePNG = png
-				}
-
-				qrterminal.GenerateHalfBlock(evt.Code, qrterminal.L, os.Stdout)
-				fmt.Println("\n📱 Scan this QR code with WhatsApp")
-				fmt.Println("Or visit http://localhost:8765/qr for web QR code")
-
-				b.broadcastQRCode(evt.Code)
-			} else {
-				log.Printf("QR event: %s", evt.Event)
-			}
-		}
-	} else {
-		err := b.client.Connect()
-		if err != nil {
-			return fmt.Errorf("failed to connect: %v", err)
-		}
-		log.Println("✅ WhatsApp connected (already authenticated)")
-		b.authenticated = true
+	port := os.Getenv("BRIDGE_PORT")
+	if port == "" {
+		port = "8765"
 	}
 
-	return nil
-}
+	callbackURL := os.Getenv("CALLBACK_URL")
 
-func (b *WhatsAppBridge) broadcastQRCode(code string) {
-	for client := range b.wsClients {
-		err := client.WriteJSON(map[string]string{
-			"type": "qr_code",
-			"data": code,
-		})
-		if err != nil {
-			log.Printf("Error broadcasting to WebSocket: %v", err)
-			client.Close()
-			delete(b.wsClients, client)
+	// "whatsapp-bridge doctor" runs the self-tests and exits.
+	if len(os.Args) > 1 && os.Args[1] == "doctor" {
+		results := bridge.RunChecks(context.Background(), redisURL)
+		for _, r := range results {
+			fmt.Println(r)
 		}
-	}
-}
-
-func (b *WhatsAppBridge) broadcastAuthenticated() {
-	for client := range b.wsClients {
-		err := client.WriteJSON(map[string]string{
-			"type": "authenticated",
-		})
-		if err != nil {
-			client.Close()
-			delete(b.wsClients, client)
+		if bridge.ChecksFailed(results) {
+			os.Exit(1)
 		}
-	}
-}
-
-// --- HTTP Handlers ---
-
-func (b *WhatsAppBridge) handleHealth(w http.ResponseWriter, r *http.Request) {
-	response := Response{
-		Success: true,
-		Data: map[string]interface{}{
-			"connected":     b.client.IsConnected(),
-			"authenticated": b.authenticated,
-			"logged_in":     b.client.Store.ID != nil,
-		},
-	}
-	json.NewEncoder(w).Encode(response)
-}
-
-func (b *WhatsAppBridge) handleSend(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-
-	var msg OutgoingMessage
-	if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(Response{Success: false, Error: err.Error()})
 		return
 	}
 
-	if msg.Phone == "" || msg.Message == "" {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(Response{Success: false, Error: "phone and message are required"})
+	// "whatsapp-bridge migrate [status | up [version]]" manages the archive
+	// schema for rollouts with ARCHIVE_AUTO_MIGRATE=false.
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(os.Args[2:]); err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
 		return
 	}
 
-	// Sanitize phone: strip +, spaces, dashes
-	phone := strings.TrimLeft(msg.Phone, "+")
-	phone = strings.ReplaceAll(phone, " ", "")
-	phone = strings.ReplaceAll(phone, "-", "")
-
-	log.Printf("Sending message to %s (server: %s): %s", phone, msg.Server, msg.Message)
-
-	server := types.DefaultUserServer
-	if msg.Server != "" {
-		server = msg.Server
-	}
-	jid := types.NewJID(phone, server)
-
-	message := &waE2E.Message{
-		Conversation: proto.String(msg.Message),
+	results := bridge.RunChecks(context.Background(), redisURL)
+	for _, r := range results {
+		log.Println(r)
 	}
-
-	resp, err := b.client.SendMessage(b.ctx, jid, message)
-	if err != nil {
-		log.Printf("Error sending message to %s: %v", phone, err)
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(Response{
-			Success: false,
-			Error:   err.Error(),
-		})
-		return
+	if bridge.ChecksFailed(results) {
+		log.Fatalf("Startup checks failed; fix the issues above, or skip checks with STARTUP_CHECKS_SKIP (\"all\" for every check)")
 	}
 
-	log.Printf("Message sent to %s, ID: %s", phone, resp.ID)
-	json.NewEncoder(w).Encode(Response{
-		Success: true,
-		Data: map[string]interface{}{
-			"message_id": resp.ID,
-			"timestamp":  resp.Timestamp,
-		},
-	})
-}
-
-func (b *WhatsAppBridge) handleQRCode(w http.ResponseWriter, r *http.Request) {
-	if b.qrCodePNG == nil {
-		http.Error(w, "No QR code available", http.StatusNotFound)
-		return
-	}
-
-	w.Header().Set("Content-Type", "image/png")
-	w.Write(b.qrCodePNG)
-}
-
-func (b *WhatsAppBridge) handleQRPage(w http.ResponseWriter, r *http.Request) {
-	html := `
-<!DOCTYPE html>
-<html>
-<head>
-    <title>WhatsApp QR Code</title>
-    <style>
-        body {
-            font-family: Arial, sans-serif;
-            display: flex;
-            flex-direction: column;
-            align-items: center;
-            justify-content: center;
-            min-height: 100vh;
-            margin: 0;
-            background: linear-gradient(135deg, #667eea 0%, #764ba2 100%);
-        }
-        .container {
-            background: white;
-            padding: 2rem;
-            border-radius: 10px;
-            box-shadow: 0 10px 40px rgba(0,0,0,0.2);
-            text-align: center;
-        }
-        h1 { color: #333; margin-bottom: 1rem; }
-        #qrcode { margin: 1rem 0; }
-        .status {
-            padding: 0.5rem 1rem;
-            border-radius: 5px;
-            margin-top: 1rem;
-        }
-        .status.connected { background: #10b981; color: white; }
-        .status.waiting   { background: #f59e0b; color: white; }
-    </style>
-</head>
-<body>
-    <div class="container">
-        <h1>🔐 WhatsApp Authentication</h1>
-        <p>Scan this QR code with WhatsApp on your phone</p>
-        <div id="qrcode"></div>
-        <div id="status" class="status waiting">Waiting for scan...</div>
-    </div>
-    <script>
-        const ws = new WebSocket('ws://' + window.location.host + '/ws');
-        const qrDiv = document.getElementById('qrcode');
-        const statusDiv = document.getElementById('status');
-        ws.onmessage = function(event) {
-            const data = JSON.parse(event.data);
-            if (data.type === 'qr_code') {
-                qrDiv.innerHTML = '<img src="/qr.png?' + Date.now() + '" alt="QR Code">';
-            } else if (data.type === 'authenticated') {
-                statusDiv.className = 'status connected';
-                statusDiv.textContent = '✅ Connected to WhatsApp!';
-                setTimeout(() => { window.close(); }, 2000);
-            }
-        };
-        fetch('/qr.png').then(r => { if (r.ok) qrDiv.innerHTML = '<img src="/qr.png" alt="QR Code">'; });
-    </script>
-</body>
-</html>
-	`
-	w.Header().Set("Content-Type", "text/html")
-	w.Write([]byte(html))
-}
-
-func (b *WhatsAppBridge) handleWebSocket(w http.ResponseWriter, r *http.Request) {
-	conn, err := b.wsUpgrader.Upgrade(w, r, nil)
+	b, err := bridge.NewWhatsAppBridge(redisURL)
 	if err != nil {
-		log.Printf("WebSocket upgrade error: %v", err)
-		return
-	}
-
-	b.wsClients[conn] = true
-
-	if b.qrCodeData != "" {
-		conn.WriteJSON(map[string]string{
-			"type": "qr_code",
-			"data": b.qrCodeData,
-		})
-	}
-
-	go func() {
-		for {
-			if _, _, err := conn.ReadMessage(); err != nil {
-				delete(b.wsClients, conn)
-				conn.Close()
-				break
-			}
-		}
-	}()
-}
-
-func main() {
-	redisURL := os.Getenv("REDIS_URL")
-	if redisURL == "" {
-		redisURL = "redis://localhost:6379"
+		log.Fatalf("Failed to create bridge: %v", err)
 	}
 
-	port := os.Getenv("BRIDGE_PORT")
-	if port == "" {
-		port = "8765"
+	if err := b.Configure(); err != nil {
+		log.Fatalf("Failed to configure bridge: %v", err)
 	}
 
-	callbackURL := os.Getenv("CALLBACK_URL")
-
-	bridge, err := NewWhatsAppBridge(redisURL)
-	if err != nil {
-		log.Fatalf("Failed to create bridge: %v", err)
+	if err := b.InitializeWhatsApp(); err != nil {
+		log.Fatalf("Failed to initialize WhatsApp: %v", err)
 	}
 
-	bridge.callbackURL = callbackURL
-
-	if err := bridge.InitializeWhatsApp(); err != nil {
-		log.Fatalf("Failed to initialize WhatsApp: %v", err)
+	if err := b.Start(); err != nil {
+		log.Fatalf("Failed to start bridge: %v", err)
 	}
 
 	go func() {
-		if err := bridge.Connect(); err != nil {
+		if err := b.Connect(); err != nil {
 			log.Fatalf("Failed to connect to WhatsApp: %v", err)
 		}
 	}()
 
-	router := mux.NewRouter()
-	router.HandleFunc("/health", bridge.handleHealth).Methods("GET")
-	router.HandleFunc("/send", bridge.handleSend).Methods("POST")
-	router.HandleFunc("/qr", bridge.handleQRPage).Methods("GET")
-	router.HandleFunc("/qr.png", bridge.handleQRCode).Methods("GET")
-	router.HandleFunc("/ws", bridge.handleWebSocket)
-
-	// CORS middleware
-	router.Use(func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			w.Header().Set("Access-Control-Allow-Origin", "*")
-			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-			w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-			if r.Method == "OPTIONS" {
-				w.WriteHeader(http.StatusOK)
-				return
-			}
-			next.ServeHTTP(w, r)
-		})
-	})
-
 	srv := &http.Server{
 		Addr:         ":" + port,
-		Handler:      router,
+		Handler:      b.Handler(),
 		ReadTimeout:  15 * time.Second,
-		WriteTimeout: 15 * time.Second,
+		WriteTimeout: bridge.WriteTimeout,
 	}
 
 	log.Printf("🚀 WhatsApp Bridge starting on http://localhost:%s", port)
@@ -572,13 +103,78 @@ func main() {
 	<-sigChan
 
 	log.Println("🛑 Shutting down...")
+	drainCtx, cancelDrain := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancelDrain()
+	b.Drain(drainCtx)
+
+	// Give the sends in flight time to finish, and load balancers time to
+	// see /health report draining, before closing the listener. A second
+	// signal skips the wait.
+	select {
+	case <-time.After(drainWindow()):
+	case <-sigChan:
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
-
 	if err := srv.Shutdown(ctx); err != nil {
 		log.Printf("Server shutdown error: %v", err)
 	}
 
-	bridge.client.Disconnect()
+	b.Shutdown()
 	log.Println("👋 Goodbye!")
 }
+
+// drainWindow is SHUTDOWN_DRAIN_WINDOW (default 5s), how long shutdown
+// waits between draining and closing the HTTP server.
+func drainWindow() time.Duration {
+	if v := os.Getenv("SHUTDOWN_DRAIN_WINDOW"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			return d
+		}
+		log.Printf("⚠️ Invalid SHUTDOWN_DRAIN_WINDOW %q, using 5s", v)
+	}
+	return 5 * time.Second
+}
+
+func runMigrate(args []string) error {
+	command := "up"
+	if len(args) > 0 {
+		command = args[0]
+	}
+	switch command {
+	case "status":
+		migrations, err := bridge.ArchiveMigrations()
+		if err != nil {
+			return err
+		}
+		for _, m := range migrations {
+			state := "pending"
+			if m.AppliedAt != 0 {
+				state = "applied " + time.Unix(m.AppliedAt, 0).Format(time.RFC3339)
+			}
+			fmt.Printf("%04d_%s\t%s\n", m.Version, m.Name, state)
+		}
+		return nil
+	case "up":
+		target := 0
+		if len(args) > 1 {
+			var err error
+			if target, err = strconv.Atoi(args[1]); err != nil {
+				return fmt.Errorf("invalid target version %q", args[1])
+			}
+		}
+		applied, err := bridge.MigrateArchive(target)
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			fmt.Println("Archive schema is up to date")
+		}
+		for _, m := range applied {
+			fmt.Printf("Applied %04d_%s\n", m.Version, m.Name)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown migrate command %q; use status or up [version]", command)
+}
@@ -0,0 +1,151 @@
+package pairing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Client follows a bridge's pairing flow.
+type Client struct {
+	// BaseURL is the bridge's HTTP address, e.g. http://whatsapp-bridge:8765.
+	BaseURL string
+	// Token authenticates RequestPairingCode (API key or JWT); the
+	// websocket itself is public, like the /qr page.
+	Token string
+
+	HTTPClient *http.Client
+	Dialer     *websocket.Dialer
+}
+
+// NewClient returns a client of the bridge at baseURL.
+func NewClient(baseURL, token string) *Client {
+	return &Client{
+		BaseURL:    strings.TrimSuffix(baseURL, "/"),
+		Token:      token,
+		HTTPClient: &http.Client{Timeout: 30 * time.Second},
+		Dialer:     websocket.DefaultDialer,
+	}
+}
+
+func (c *Client) wsURL() (string, error) {
+	u, err := url.Parse(c.BaseURL)
+	if err != nil {
+		return "", err
+	}
+	switch u.Scheme {
+	case "https":
+		u.Scheme = "wss"
+	case "http", "":
+		u.Scheme = "ws"
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/ws"
+	return u.String(), nil
+}
+
+// Watch calls fn with every event until ctx is cancelled or fn returns
+// false; WaitAuthenticated stops at authentication. Dropped connections,
+// including ones the bridge closes, are redialed with backoff; the bridge
+// resends the current state on each, so fn sees a state event first after
+// every reconnect.
+func (c *Client) Watch(ctx context.Context, fn func(Event) bool) error {
+	target, err := c.wsURL()
+	if err != nil {
+		return err
+	}
+	header := http.Header{}
+	if c.Token != "" {
+		header.Set("Authorization", "Bearer "+c.Token)
+	}
+	backoff := time.Second
+	for {
+		conn, _, err := c.Dialer.DialContext(ctx, target, header)
+		if err == nil {
+			backoff = time.Second
+			done, readErr := c.read(ctx, conn, fn)
+			if done {
+				return readErr
+			}
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > 30*time.Second {
+			backoff = 30 * time.Second
+		}
+	}
+}
+
+// read delivers a connection's events, reporting whether watching is over.
+func (c *Client) read(ctx context.Context, conn *websocket.Conn, fn func(Event) bool) (bool, error) {
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+	for {
+		var evt Event
+		if err := conn.ReadJSON(&evt); err != nil {
+			if ctx.Err() != nil {
+				return true, ctx.Err()
+			}
+			return false, err
+		}
+		if !fn(evt) {
+			return true, nil
+		}
+	}
+}
+
+// WaitAuthenticated watches until the session is logged in, calling fn (if
+// not nil) with every event on the way, e.g. to render QR codes.
+func (c *Client) WaitAuthenticated(ctx context.Context, fn func(Event)) error {
+	return c.Watch(ctx, func(evt Event) bool {
+		if fn != nil {
+			fn(evt)
+		}
+		return evt.Type != EventAuthenticated && evt.State != StateAuthenticated
+	})
+}
+
+// RequestPairingCode asks the bridge for a code to link the account of
+// phone (international format) without scanning. The code is returned and
+// also sent to websocket watchers as a pair_code event.
+func (c *Client) RequestPairingCode(ctx context.Context, phone string) (string, error) {
+	body, _ := json.Marshal(PairCodeRequest{Phone: phone})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.BaseURL+"/pair/code", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	var out struct {
+		Success bool   `json:"success"`
+		Data    Event  `json:"data"`
+		Error   string `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", fmt.Errorf("bridge returned status %d", resp.StatusCode)
+	}
+	if !out.Success {
+		return "", fmt.Errorf("bridge refused pairing code: %s", out.Error)
+	}
+	return out.Data.Data, nil
+}
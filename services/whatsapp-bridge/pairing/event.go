@@ -0,0 +1,53 @@
+// Package pairing is the contract of the bridge's pairing websocket (/ws)
+// and a client for it, so apps can embed the WhatsApp login (QR code,
+// pairing code, progress) in their own UI instead of framing the bridge's
+// /qr page.
+//
+// On connect the bridge sends a "state" event with the current state, then
+// the current QR code or pairing code if there is one. Afterwards it sends
+// every new QR code, pairing code and state change as it happens.
+package pairing
+
+// Event types sent on the websocket.
+const (
+	// EventState reports a state transition; State and Detail are set.
+	EventState = "state"
+	// EventQRCode carries a new QR code: Data is the string to encode,
+	// Image a PNG data URL of it, ExpiresIn its validity in seconds.
+	EventQRCode = "qr_code"
+	// EventPairCode carries the code to type into the phone (Linked
+	// devices, Link with phone number instead) after a pairing code was
+	// requested for Phone.
+	EventPairCode = "pair_code"
+	// EventAuthenticated is sent once the session is logged in, for
+	// clients that only wait for the end of pairing.
+	EventAuthenticated = "authenticated"
+)
+
+// States of the login flow.
+const (
+	StateStarting      = "starting"      // connecting, no code yet
+	StateWaitingScan   = "waiting_scan"  // a QR or pairing code is being shown
+	StatePaired        = "paired"        // the phone accepted; the session is being set up
+	StateAuthenticated = "authenticated" // logged in and connected
+	StateTimeout       = "timeout"       // the codes ran out before pairing; the bridge needs a restart
+	StateLoggedOut     = "logged_out"    // the session was removed from the phone
+	StateError         = "error"         // pairing failed; Detail says why
+)
+
+// Event is one message of the pairing websocket.
+type Event struct {
+	Type      string `json:"type"`
+	State     string `json:"state,omitempty"`
+	Detail    string `json:"detail,omitempty"`
+	Data      string `json:"data,omitempty"`       // qr_code: QR content; pair_code: the code
+	Image     string `json:"image,omitempty"`      // qr_code: data:image/png;base64,...
+	Phone     string `json:"phone,omitempty"`      // pair_code: phone the code was requested for
+	ExpiresIn int    `json:"expires_in,omitempty"` // qr_code: seconds until the code is replaced
+	JID       string `json:"jid,omitempty"`        // authenticated: the account's JID
+}
+
+// PairCodeRequest is the body of POST /pair/code.
+type PairCodeRequest struct {
+	Phone string `json:"phone"`
+}